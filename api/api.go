@@ -42,10 +42,14 @@ type Server struct {
 	MemoryStore     mdata.Metrics
 	BackendStore    mdata.Store
 	MetaRecords     idx.MetaRecordIdx
+	Macros          idx.MacroIdx
+	Events          idx.EventIdx
 	Cache           cache.Cache
 	shutdown        chan struct{}
 	Tracer          opentracing.Tracer
 	prioritySetters []PrioritySetter
+	localOrg        uint32
+	localOrgSet     bool
 }
 
 func (s *Server) BindMetricIndex(i idx.MetricIndex) {
@@ -60,6 +64,12 @@ func (s *Server) BindBackendStore(store mdata.Store) {
 func (s *Server) BindMetaRecords(mr idx.MetaRecordIdx) {
 	s.MetaRecords = mr
 }
+func (s *Server) BindMacros(m idx.MacroIdx) {
+	s.Macros = m
+}
+func (s *Server) BindEvents(e idx.EventIdx) {
+	s.Events = e
+}
 
 func (s *Server) BindCache(cache cache.Cache) {
 	s.Cache = cache
@@ -69,6 +79,18 @@ func (s *Server) BindTracer(tracer opentracing.Tracer) {
 	s.Tracer = tracer
 }
 
+// BindLocalOrg sets the org under which this node ingests its own stats.
+// those series are only known by this node, so queries for this org are served by it alone.
+func (s *Server) BindLocalOrg(orgId uint32) {
+	s.localOrg = orgId
+	s.localOrgSet = true
+}
+
+// isLocalOrg returns whether the given org is the one this node ingests its own stats under
+func (s *Server) isLocalOrg(orgId uint32) bool {
+	return s.localOrgSet && orgId == s.localOrg
+}
+
 type PrioritySetter interface {
 	ExplainPriority() interface{}
 }
@@ -19,6 +19,7 @@ import (
 	"github.com/grafana/metrictank/api/response"
 	"github.com/grafana/metrictank/cluster"
 	"github.com/grafana/metrictank/expr/tagquery"
+	"github.com/grafana/metrictank/idx"
 	"github.com/grafana/metrictank/idx/cassandra"
 	"github.com/grafana/metrictank/stats"
 	"github.com/grafana/metrictank/tracing"
@@ -38,8 +39,42 @@ var (
 
 	// metric api.cluster.speculative.requests is how many speculative http requests made to peers
 	speculativeRequests = stats.NewCounter32("api.cluster.speculative.requests")
+
+	// metric api.cluster.hedged.requests is how many requests were made to peers because the request to another member of the shard group took longer than the hedge-quantile of its latency
+	hedgedRequests = stats.NewCounter32("api.cluster.hedged.requests")
+
+	// metric api.cluster.streams is how many requests from peers were answered with a stream
+	streamsServed = stats.NewCounter32("api.cluster.streams")
 )
 
+// how many tags are sent per item when streaming tags to a peer
+const streamTagBatchSize = 1000
+
+// batchIdx returns our index as an idx.BatchIdx, so that index responses can be streamed as the index produces them.
+// indexes that don't support batches return their full result as a single batch.
+func (s *Server) batchIdx() idx.BatchIdx {
+	if b, ok := s.MetricIndex.(idx.BatchIdx); ok {
+		return b
+	}
+	return singleBatchIdx{s.MetricIndex}
+}
+
+type singleBatchIdx struct {
+	idx.MetricIndex
+}
+
+func (i singleBatchIdx) ListFunc(orgId uint32, fn func([]idx.Archive) error) error {
+	return fn(i.List(orgId))
+}
+
+func (i singleBatchIdx) FindByTagFunc(orgId uint32, query tagquery.Query, fn func([]idx.Node) error) error {
+	return fn(i.FindByTag(orgId, query))
+}
+
+func (i singleBatchIdx) TagsFunc(orgId uint32, filter *regexp.Regexp, fn func([]string) error) error {
+	return fn(i.Tags(orgId, filter))
+}
+
 func (s *Server) explainPriority(ctx *middleware.Context) {
 	var data []interface{}
 	for _, p := range s.prioritySetters {
@@ -79,6 +114,7 @@ func (s *Server) getClusterStatus(ctx *middleware.Context) {
 		ClusterName: cluster.ClusterName,
 		NodeName:    cluster.Manager.ThisNode().GetName(),
 		Members:     cluster.Manager.MemberList(false, false),
+		PeerHealth:  cluster.HealthStatus(),
 	}
 	response.Write(ctx, response.NewJson(200, status, ""))
 }
@@ -158,9 +194,14 @@ func (s *Server) indexTagDetails(ctx *middleware.Context, req models.IndexTagDet
 }
 
 func (s *Server) indexTags(ctx *middleware.Context, req models.IndexTags) {
+	stream := cluster.WantsStream(ctx.Req.Request)
 
 	// query nodes don't own any data
 	if s.MetricIndex == nil {
+		if stream {
+			streamResponse(ctx, "indexTags", nil)
+			return
+		}
 		response.Write(ctx, response.NewMsgp(200, &models.IndexTagsResp{}))
 		return
 	}
@@ -171,6 +212,26 @@ func (s *Server) indexTags(ctx *middleware.Context, req models.IndexTags) {
 		return
 	}
 
+	if stream {
+		// the peer deduplicates the tags
+		streamResponse(ctx, "indexTags", func(write func(msgp.Encodable) error) error {
+			return s.batchIdx().TagsFunc(req.OrgId, re, func(tags []string) error {
+				for len(tags) > 0 {
+					n := streamTagBatchSize
+					if n > len(tags) {
+						n = len(tags)
+					}
+					batch := models.StringList(tags[:n])
+					if err := write(&batch); err != nil {
+						return err
+					}
+					tags = tags[n:]
+				}
+				return nil
+			})
+		})
+		return
+	}
 	tags := s.MetricIndex.Tags(req.OrgId, re)
 	response.Write(ctx, response.NewMsgp(200, &models.IndexTagsResp{Tags: tags}))
 }
@@ -363,9 +424,14 @@ func (s *Server) IndexTagTerms(ctx *middleware.Context, req models.IndexTagTerms
 }
 
 func (s *Server) indexFindByTag(ctx *middleware.Context, req models.IndexFindByTag) {
+	stream := cluster.WantsStream(ctx.Req.Request)
 
 	// query nodes don't own any data.
 	if s.MetricIndex == nil {
+		if stream {
+			streamResponse(ctx, "indexFindByTag", nil)
+			return
+		}
 		response.Write(ctx, response.NewMsgp(200, &models.IndexFindByTagResp{}))
 		return
 	}
@@ -376,6 +442,19 @@ func (s *Server) indexFindByTag(ctx *middleware.Context, req models.IndexFindByT
 		return
 	}
 
+	if stream {
+		streamResponse(ctx, "indexFindByTag", func(write func(msgp.Encodable) error) error {
+			return s.batchIdx().FindByTagFunc(req.OrgId, query, func(metrics []idx.Node) error {
+				for i := range metrics {
+					if err := write(&metrics[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+		return
+	}
 	metrics := s.MetricIndex.FindByTag(req.OrgId, query)
 	response.Write(ctx, response.NewMsgp(200, &models.IndexFindByTagResp{Metrics: metrics}))
 }
@@ -400,13 +479,31 @@ func (s *Server) indexGet(ctx *middleware.Context, req models.IndexGet) {
 
 // IndexList returns msgp encoded schema.MetricDefinition's
 func (s *Server) indexList(ctx *middleware.Context, req models.IndexList) {
+	stream := cluster.WantsStream(ctx.Req.Request)
 
 	// query nodes don't own any data.
 	if s.MetricIndex == nil {
+		if stream {
+			streamResponse(ctx, "indexList", nil)
+			return
+		}
 		response.Write(ctx, response.NewMsgpArray(200, nil))
 		return
 	}
 
+	if stream {
+		streamResponse(ctx, "indexList", func(write func(msgp.Encodable) error) error {
+			return s.batchIdx().ListFunc(req.OrgId, func(defs []idx.Archive) error {
+				for i := range defs {
+					if err := write(&defs[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+		return
+	}
 	defs := s.MetricIndex.List(req.OrgId)
 	resp := make([]msgp.Marshaler, len(defs))
 	for i := range defs {
@@ -417,6 +514,10 @@ func (s *Server) indexList(ctx *middleware.Context, req models.IndexList) {
 }
 
 func (s *Server) getData(ctx *middleware.Context, request models.GetData) {
+	if cluster.WantsStream(ctx.Req.Request) {
+		s.streamData(ctx, request)
+		return
+	}
 	var ss models.StorageStats
 	series, err := s.getTargetsLocal(ctx.Req.Context(), &ss, request.Requests)
 	if err != nil {
@@ -438,6 +539,57 @@ func (s *Server) getData(ctx *middleware.Context, request models.GetData) {
 	}
 }
 
+// streamData streams the series to the peer as they are fetched, followed by the storage stats.
+// if the peer goes away, or can't be written to, the fetching is aborted.
+func (s *Server) streamData(ctx *middleware.Context, request models.GetData) {
+	streamsServed.Inc()
+	reqCtx, cancel := context.WithCancel(ctx.Req.Context())
+	defer cancel()
+	stream := cluster.NewStreamWriter(reqCtx, ctx.Resp)
+
+	var ss models.StorageStats
+	var writeErr error
+	err := s.getTargetsLocalFunc(reqCtx, &ss, request.Requests, func(series models.Series) {
+		if writeErr == nil {
+			writeErr = stream.Write(&series)
+			if writeErr != nil {
+				cancel()
+			}
+		}
+		pointSlicePool.PutMaybeNil(series.Datapoints)
+	})
+	if writeErr != nil {
+		log.Debugf("HTTP getData() failed to stream response: %s", writeErr.Error())
+		return
+	}
+	if err != nil {
+		log.Errorf("HTTP getData() %s", err.Error())
+		err = stream.Fail(err)
+	} else {
+		err = stream.Close(&ss)
+	}
+	if err != nil {
+		log.Debugf("HTTP getData() failed to stream response: %s", err.Error())
+	}
+}
+
+// streamResponse streams the items produced by produce to the peer that made the request.
+// produce is called with the function to write each item with, and must return the first error it returns.
+// a nil produce results in an empty response.
+func streamResponse(ctx *middleware.Context, name string, produce func(write func(msgp.Encodable) error) error) {
+	streamsServed.Inc()
+	stream := cluster.NewStreamWriter(ctx.Req.Context(), ctx.Resp)
+	if produce != nil {
+		if err := produce(stream.Write); err != nil {
+			log.Debugf("HTTP %s failed to stream response: %s", name, err.Error())
+			return
+		}
+	}
+	if err := stream.Close(nil); err != nil {
+		log.Debugf("HTTP %s failed to stream response: %s", name, err.Error())
+	}
+}
+
 func (s *Server) indexDelete(ctx *middleware.Context, req models.IndexDelete) {
 
 	// nothing to do on query nodes.
@@ -535,10 +687,10 @@ func (s *Server) queryAllPeers(ctx context.Context, data cluster.Traceable, name
 // ctx:          request context
 // name:         name to be used in logging & tracing
 // fetchFunc:    function to call to fetch the data from a peer
-func (s *Server) queryAllShards(ctx context.Context, name string, fetchFn fetchFunc) (map[string]PeerResponse, error) {
+func (s *Server) queryAllShards(ctx context.Context, orgId uint32, name string, fetchFn fetchFunc) (map[string]PeerResponse, error) {
 	result := make(map[string]PeerResponse)
 
-	responseChan, errorChan := s.queryAllShardsGeneric(ctx, name, fetchFn)
+	responseChan, errorChan := s.queryAllShardsGeneric(ctx, orgId, name, fetchFn)
 
 	for resp := range responseChan {
 		result[resp.peer.GetName()] = PeerResponse{
@@ -551,6 +703,20 @@ func (s *Server) queryAllShards(ctx context.Context, name string, fetchFn fetchF
 	return result, err
 }
 
+// peerGroups returns the nodes to query for the given org, see cluster.MembersForSpeculativeQuery.
+// the stats we ingest ourselves are not known to any other node, so only we are queried for them.
+func (s *Server) peerGroups(orgId uint32) (map[int32][]cluster.Node, error) {
+	if !s.isLocalOrg(orgId) {
+		return cluster.MembersForSpeculativeQuery()
+	}
+	thisNode := cluster.Manager.ThisNode()
+	var shardGroup int32
+	if partitions := thisNode.GetPartitions(); len(partitions) > 0 {
+		shardGroup = partitions[0]
+	}
+	return map[int32][]cluster.Node{shardGroup: {thisNode}}, nil
+}
+
 // queryAllShardsGeneric takes a function and calls it for one peer in each shard
 // across the cluster. If any peer fails, we try another replica. If enough
 // peers have been heard from (based on speculation-threshold configuration), and we
@@ -559,8 +725,8 @@ func (s *Server) queryAllShards(ctx context.Context, name string, fetchFn fetchF
 // ctx:          request context
 // name:         name to be used in logging & tracing
 // fetchFunc:    function to call to fetch the data from a peer
-func (s *Server) queryAllShardsGeneric(ctx context.Context, name string, fetchFn fetchFunc) (<-chan GenericPeerResponse, <-chan error) {
-	peerGroups, err := cluster.MembersForSpeculativeQuery()
+func (s *Server) queryAllShardsGeneric(ctx context.Context, orgId uint32, name string, fetchFn fetchFunc) (<-chan GenericPeerResponse, <-chan error) {
+	peerGroups, err := s.peerGroups(orgId)
 	if err != nil {
 		log.Errorf("HTTP peerQuery unable to get peers, %s", err.Error())
 		resultChan := make(chan GenericPeerResponse)
@@ -586,6 +752,46 @@ func fetchFuncPost(data cluster.Traceable, name, path string) fetchFunc {
 	}
 }
 
+// seriesBudget counts the series received from the peers of a request, as they are received,
+// so that a limit can be applied to the request as a whole, rather than to each peer.
+// replicas of the same shard group return the same series, so only the peer of each shard group
+// that returned the most series so far is counted.
+type seriesBudget struct {
+	sync.Mutex
+	limit  int
+	peers  map[string]int // series received per peer
+	groups map[int32]int  // series counted per shard group
+	total  int
+}
+
+func newSeriesBudget(limit int) *seriesBudget {
+	return &seriesBudget{
+		limit:  limit,
+		peers:  make(map[string]int),
+		groups: make(map[int32]int),
+	}
+}
+
+// add counts n more series received from the given peer, and returns the total of the request
+func (b *seriesBudget) add(peer cluster.Node, n int) int {
+	b.Lock()
+	defer b.Unlock()
+	b.peers[peer.GetName()] += n
+	group := peer.GetPartitions()[0]
+	if count := b.peers[peer.GetName()]; count > b.groups[group] {
+		b.total += count - b.groups[group]
+		b.groups[group] = count
+	}
+	return b.total
+}
+
+// exceeded returns whether more series than the limit have been received
+func (b *seriesBudget) exceeded() bool {
+	b.Lock()
+	defer b.Unlock()
+	return b.total > b.limit
+}
+
 type shardResponse struct {
 	shardGroup int32
 	data       GenericPeerResponse
@@ -597,6 +803,7 @@ type shardState struct {
 	shard          int32          // shard ID
 	remainingPeers []cluster.Node // peers that we have not sent a query to yet
 	inflight       int            // number of requests in flight
+	hedgeAt        time.Time      // when to hedge the last request, if it is still in flight. zero if not hedged
 }
 
 // AskPeer issues the query on the next peer, if available, and returns it
@@ -607,6 +814,12 @@ func (state *shardState) AskPeer(ctx context.Context, peerGroups map[int32][]clu
 	peer := state.remainingPeers[0]
 	state.remainingPeers = state.remainingPeers[1:]
 	state.inflight++
+	state.hedgeAt = time.Time{}
+	if hedgeQuantile > 0 {
+		if latency, ok := cluster.Health(peer.GetName()).Quantile(hedgeQuantile); ok {
+			state.hedgeAt = time.Now().Add(latency)
+		}
+	}
 	go state.askPeer(ctx, peerGroups, peer, fn, responses)
 	return peer, true
 }
@@ -629,6 +842,7 @@ func (state *shardState) askPeer(ctx context.Context, peerGroups map[int32][]clu
 // is called it for one peer of each shard. If any peer fails, we try another replica.
 // If enough peers have been heard from (based on speculation-threshold configuration),
 // and we are missing the others, try to speculatively query other members of the shard group.
+// If a peer takes longer than the hedge-quantile of its recent latencies, query another member of its shard group as well.
 // ctx:          request context
 // peerGroups:   peers grouped by shard
 // fetchFn:        function to call to fetch the data from a peer
@@ -669,7 +883,8 @@ func queryPeers(ctx context.Context, peerGroups map[int32][]cluster.Node, name s
 		var specSpan opentracing.Span
 		var ticker *time.Ticker
 		var tickChan <-chan time.Time
-		if speculationThreshold != 1 {
+		speculated := speculationThreshold == 1
+		if !speculated || hedgeQuantile > 0 {
 			ticker = time.NewTicker(5 * time.Millisecond)
 			tickChan = ticker.C
 			defer ticker.Stop()
@@ -718,11 +933,30 @@ func queryPeers(ctx context.Context, peerGroups map[int32][]cluster.Node, name s
 				delete(originalPeers, resp.data.peer.GetName())
 
 			case <-tickChan:
+				// hedge the requests that take longer than usual for their peer
+				now := time.Now()
+				for shardGroup, state := range states {
+					if _, ok := receivedResponses[shardGroup]; ok || state.hedgeAt.IsZero() || now.Before(state.hedgeAt) {
+						continue
+					}
+					if _, ok := state.AskPeer(reqCtx, peerGroups, fetchFn, responses); ok {
+						hedgedRequests.Inc()
+					} else {
+						state.hedgeAt = time.Time{}
+					}
+				}
+
+				if speculated {
+					continue
+				}
 				// Check if it's time to speculate!
 				ratioReceived := float64(len(receivedResponses)) / float64(len(peerGroups))
 				if ratioReceived >= speculationThreshold {
 					// kick off speculative queries to other members now
-					ticker.Stop()
+					speculated = true
+					if hedgeQuantile == 0 {
+						ticker.Stop()
+					}
 					speculativeAttempts.Inc()
 					var specCtx context.Context
 					specCtx, specSpan = tracing.NewSpan(OpCtx, span.Tracer(), "speculative-queries")
@@ -744,7 +978,8 @@ func queryPeers(ctx context.Context, peerGroups map[int32][]cluster.Node, name s
 			speculativeWins.Inc()
 			if specSpan != nil {
 				specSpan.LogFields(traceLog.Int32("spec-wins", int32(len(originalPeers))))
-			} else {
+			} else if hedgeQuantile == 0 {
+				// without speculation, only hedged requests can win
 				log.Warnf("Something weird: %v", originalPeers)
 			}
 		}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/cluster"
+)
+
+func TestPeerGroupsLocalOrg(t *testing.T) {
+	mode := cluster.Mode
+	cluster.Mode = cluster.ModeShard
+	defer func() { cluster.Mode = mode }()
+
+	manager := cluster.InitMock()
+	// we are a replica of the peer with the same partitions
+	manager.Peers = append(manager.Peers,
+		cluster.NewMockNode(true, "this", []int32{0, 1}, nil),
+		cluster.NewMockNode(false, "replica", []int32{0, 1}, nil),
+		cluster.NewMockNode(false, "other", []int32{2, 3}, nil),
+	)
+
+	s := &Server{}
+	s.BindLocalOrg(100)
+
+	groups, err := s.peerGroups(100)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(groups) != 1 || len(groups[0]) != 1 || groups[0][0].GetName() != "this" {
+		t.Fatalf("expected only this node to be queried for the local org, got %v", groups)
+	}
+}
+
+func TestSeriesBudgetReplicas(t *testing.T) {
+	a := cluster.NewMockNode(false, "a", []int32{0, 1}, nil)
+	aReplica := cluster.NewMockNode(false, "a-replica", []int32{0, 1}, nil)
+	b := cluster.NewMockNode(false, "b", []int32{2, 3}, nil)
+
+	budget := newSeriesBudget(10)
+	steps := []struct {
+		peer  cluster.Node
+		n     int
+		total int
+	}{
+		{a, 3, 3},
+		{aReplica, 2, 3}, // replica returns the same series, so doesn't count until it is ahead
+		{aReplica, 2, 4},
+		{b, 5, 9},
+		{a, 1, 9},
+	}
+	for i, step := range steps {
+		if total := budget.add(step.peer, step.n); total != step.total {
+			t.Fatalf("step %d: expected total %d, got %d", i, step.total, total)
+		}
+	}
+	if budget.exceeded() {
+		t.Fatalf("expected budget of 10 not to be exceeded with 9 series")
+	}
+	budget.add(b, 2)
+	if !budget.exceeded() {
+		t.Fatalf("expected budget of 10 to be exceeded with 11 series")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/grafana/globalconf"
 	"github.com/grafana/metrictank/api/middleware"
 	"github.com/grafana/metrictank/expr"
+	"github.com/grafana/metrictank/schema"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -31,10 +32,17 @@ var (
 	getTargetsConcurrency int
 	tagdbDefaultLimit     uint
 	speculationThreshold  float64
+	hedgeQuantile         float64
 	optimizations         expr.Optimizations
 
 	graphiteProxy *httputil.ReverseProxy
 	timeZone      *time.Location
+
+	federationEnabled     bool
+	federationClustersStr string
+	federationRegionTag   string
+	federationRegion      string
+	federationTimeout     time.Duration
 )
 
 func ConfigSetup() {
@@ -54,10 +62,19 @@ func ConfigSetup() {
 	apiCfg.IntVar(&getTargetsConcurrency, "get-targets-concurrency", 20, "maximum number of concurrent threads for fetching data on the local node. Each thread handles a single series.")
 	apiCfg.UintVar(&tagdbDefaultLimit, "tagdb-default-limit", 100, "default limit for tagdb query results, can be overridden with query parameter \"limit\"")
 	apiCfg.Float64Var(&speculationThreshold, "speculation-threshold", 1, "ratio of peer responses after which speculation is used. Set to 1 to disable.")
+	apiCfg.Float64Var(&hedgeQuantile, "hedge-quantile", 0, "quantile (e.g. 0.95) of the recent latencies of a peer, after which a request to it is hedged: also sent to another member of its shard group. Set to 0 to disable.")
 	apiCfg.BoolVar(&optimizations.PreNormalization, "pre-normalization", true, "enable pre-normalization optimization")
 	apiCfg.BoolVar(&optimizations.MDP, "mdp-optimization", false, "enable MaxDataPoints optimization (experimental)")
 	apiCfg.BoolVar(&middleware.LogHeaders, "log-headers", false, "output query headers in logs")
 	globalconf.Register("http", apiCfg, flag.ExitOnError)
+
+	fedCfg := flag.NewFlagSet("federation", flag.ExitOnError)
+	fedCfg.BoolVar(&federationEnabled, "enabled", false, "forward render, find and tag requests to the remote clusters, and merge their results with the local ones")
+	fedCfg.StringVar(&federationClustersStr, "clusters", "", "remote clusters as comma separated name=url pairs, e.g. us-east=http://metrictank-query.us-east:6060")
+	fedCfg.StringVar(&federationRegionTag, "region-tag", "region", "tag to add to the series, with the name of the cluster they come from as value, so that the series of each cluster, including the results of functions like sumSeries, stay separate")
+	fedCfg.StringVar(&federationRegion, "region", "", "name of the local cluster, used as value of the region tag of local series. required when federation is enabled")
+	fedCfg.DurationVar(&federationTimeout, "timeout", 10*time.Second, "timeout of requests to remote clusters. the results of clusters that time out are missing from the response")
+	globalconf.Register("federation", fedCfg, flag.ExitOnError)
 }
 
 func ConfigProcess() {
@@ -73,6 +90,28 @@ func ConfigProcess() {
 	}
 	graphiteProxy = NewGraphiteProxy(u)
 
+	if hedgeQuantile < 0 || hedgeQuantile >= 1 {
+		log.Fatal("API Config: hedge-quantile must be at least 0 and less than 1")
+	}
+
+	if federationEnabled {
+		remoteClusters, err = parseRemoteClusters(federationClustersStr)
+		if err != nil {
+			log.Fatalf("API Config: invalid federation clusters: %s", err.Error())
+		}
+		if federationTimeout <= 0 {
+			log.Fatal("API Config: federation timeout must be a non-zero duration string like 10s")
+		}
+		// each cluster evaluates the functions on its own series. without region tag, the results of
+		// aggregating functions of different clusters would be merged as if they were the same series
+		if !schema.ValidateTagKey(federationRegionTag) {
+			log.Fatalf("API Config: federation region-tag must be a valid tag key, got %q", federationRegionTag)
+		}
+		if !schema.ValidateTagValue(federationRegion) {
+			log.Fatalf("API Config: federation region must be a valid tag value, got %q", federationRegion)
+		}
+	}
+
 	if timeZoneStr == "local" {
 		timeZone = time.Local
 	} else {
@@ -0,0 +1,409 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/metrictank/api/middleware"
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/api/response"
+	"github.com/grafana/metrictank/cluster"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/schema"
+	"github.com/grafana/metrictank/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// metric api.consistency.checked_series is the number of series compared across replicas by consistency checks
+	consistencyChecked = stats.NewCounter32("api.consistency.checked_series")
+	// metric api.consistency.divergent_series is the number of series found to differ across replicas, or to miss chunks in the store
+	consistencyDivergent = stats.NewCounter32("api.consistency.divergent_series")
+	// metric api.consistency.missing_chunks is the number of finished chunks found missing from the store by consistency checks
+	consistencyMissing = stats.NewCounter32("api.consistency.missing_chunks")
+	// metric api.consistency.repaired_chunks is the number of missing chunks saved from the memory of a replica by consistency checks
+	consistencyRepaired = stats.NewCounter32("api.consistency.repaired_chunks")
+)
+
+// chunkDigester is implemented by the metrics of the memory store
+type chunkDigester interface {
+	Digest(from, to uint32) (mdata.MetricDigest, error)
+	RepairChunks(t0s []uint32) []uint32
+}
+
+// consistencyCheck compares the in-memory data of series from the local index across the replicas
+// of their partitions, and checks that their finished chunks are in the store.
+func (s *Server) consistencyCheck(ctx *middleware.Context, req models.ConsistencyCheck) {
+	// query nodes don't own any data
+	if s.MetricIndex == nil || s.MemoryStore == nil {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, "consistency checks must be run on a node with data"))
+		return
+	}
+	now := time.Now()
+	from, to, err := getFromTo(models.FromTo{From: req.From, To: req.To}, now, uint32(now.Unix())-3600, uint32(now.Unix())-300)
+	if err != nil {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if from >= to {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, "from must be before to"))
+		return
+	}
+
+	var defs []idx.Archive
+	for _, key := range req.Keys {
+		mkey, err := schema.MKeyFromString(key)
+		if err != nil {
+			response.Write(ctx, response.NewError(http.StatusBadRequest, "invalid key "+key))
+			return
+		}
+		def, ok := s.MetricIndex.Get(mkey)
+		if !ok {
+			response.Write(ctx, response.NewError(http.StatusNotFound, "series not found in the local index: "+key))
+			return
+		}
+		defs = append(defs, def)
+	}
+	if req.Sample > 0 {
+		if req.OrgId == 0 {
+			response.Write(ctx, response.NewError(http.StatusBadRequest, "orgId is required when sampling series"))
+			return
+		}
+		list := s.MetricIndex.List(req.OrgId)
+		for i, j := range rand.Perm(len(list)) {
+			if i == req.Sample {
+				break
+			}
+			defs = append(defs, list[j])
+		}
+	}
+	if len(defs) == 0 {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, "no series to check. specify keys, or orgId and sample"))
+		return
+	}
+
+	res := s.checkConsistency(ctx.Req.Context(), defs, from, to, req.Repair)
+	response.Write(ctx, response.NewJson(http.StatusOK, res, ""))
+}
+
+// consistencyPeers returns the ready peers with data, including this node
+func consistencyPeers() []cluster.Node {
+	peers := cluster.Manager.MemberList(true, true)
+	if cluster.Manager.IsReady() {
+		peers = append(peers, cluster.Manager.ThisNode())
+	}
+	return peers
+}
+
+func nodeHasPartition(node cluster.Node, partition int32) bool {
+	for _, p := range node.GetPartitions() {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) checkConsistency(ctx context.Context, defs []idx.Archive, from, to uint32, repair bool) models.ConsistencyCheckResp {
+	res := models.ConsistencyCheckResp{
+		From:   from,
+		To:     to,
+		Errors: make(map[string]string),
+	}
+
+	// ask every replica for the digests of the series of its partitions
+	peers := consistencyPeers()
+	replicas := make(map[string][]string) // peer names by key
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	digests := make(map[string]map[string]mdata.MetricDigest) // by peer name
+	for _, peer := range peers {
+		var keys []string
+		for _, def := range defs {
+			if nodeHasPartition(peer, def.Partition) {
+				keys = append(keys, def.Id.String())
+				replicas[def.Id.String()] = append(replicas[def.Id.String()], peer.GetName())
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(peer cluster.Node, req models.ConsistencyDigest) {
+			defer wg.Done()
+			var resp models.ConsistencyDigestResp
+			var err error
+			if peer.IsLocal() {
+				resp = s.consistencyDigestLocal(req)
+			} else {
+				var buf []byte
+				buf, err = peer.Post(ctx, "consistencyDigestRemote", "/consistency/digest", req)
+				if err == nil {
+					err = json.Unmarshal(buf, &resp)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Errorf("HTTP consistencyCheck error querying %s/consistency/digest: %s", peer.GetName(), err.Error())
+				res.Errors[peer.GetName()] = err.Error()
+				return
+			}
+			digests[peer.GetName()] = resp.Digests
+		}(peer, models.ConsistencyDigest{Keys: keys, From: from, To: to})
+	}
+	wg.Wait()
+
+	for _, def := range defs {
+		key := def.Id.String()
+		sc := models.SeriesConsistency{
+			Key:       key,
+			Partition: def.Partition,
+			Replicas:  make(map[string]mdata.MetricDigest),
+		}
+		for _, name := range replicas[key] {
+			peerDigests, ok := digests[name]
+			if !ok {
+				// failed to query the peer
+				continue
+			}
+			if d, ok := peerDigests[key]; ok {
+				sc.Replicas[name] = d
+			} else {
+				sc.MissingOn = append(sc.MissingOn, name)
+			}
+		}
+		sort.Strings(sc.MissingOn)
+		var finished []uint32
+		sc.DivergentChunks, finished = compareReplicas(sc.Replicas, to)
+
+		if s.BackendStore != nil && len(finished) > 0 {
+			missing, err := s.missingChunks(ctx, def.Id, sc.Replicas, finished)
+			if err != nil {
+				sc.Error = err.Error()
+			}
+			sc.MissingChunks = missing
+			consistencyMissing.Add(len(missing))
+		}
+		if repair && len(sc.MissingChunks) > 0 {
+			s.repairChunks(ctx, &sc, peers)
+		}
+
+		consistencyChecked.Inc()
+		res.Checked++
+		if len(sc.MissingOn) == 0 && len(sc.DivergentChunks) == 0 && len(sc.MissingChunks) == 0 && sc.Error == "" {
+			res.Consistent++
+			continue
+		}
+		consistencyDivergent.Inc()
+		res.Divergent = append(res.Divergent, sc)
+	}
+	return res
+}
+
+// compareReplicas compares the digests of a series across its replicas.
+// It returns the t0's of the chunks of which the points differ, and of the finished chunks that ended before to,
+// which should be in the store.
+// Only the chunks that all replicas should have completely (starting from the newest Oldest) are compared.
+func compareReplicas(replicas map[string]mdata.MetricDigest, to uint32) ([]uint32, []uint32) {
+	var oldest uint32
+	byT0 := make(map[uint32][]mdata.ChunkDigest)
+	for _, d := range replicas {
+		if d.Oldest > oldest {
+			oldest = d.Oldest
+		}
+		for _, cd := range d.Chunks {
+			byT0[cd.T0] = append(byT0[cd.T0], cd)
+		}
+	}
+
+	span := replicaChunkSpan(replicas)
+	var divergent, finished []uint32
+	for t0, cds := range byT0 {
+		// replicas without a digest for the chunk don't have any points in it
+		if t0 >= oldest && len(replicas) > 1 {
+			var diff bool
+			for _, cd := range cds[1:] {
+				if cd.Points != cds[0].Points || cd.Checksum != cds[0].Checksum {
+					diff = true
+				}
+			}
+			if len(cds) != len(replicas) {
+				for _, cd := range cds {
+					if cd.Points > 0 {
+						diff = true
+					}
+				}
+			}
+			if diff {
+				divergent = append(divergent, t0)
+			}
+		}
+		for _, cd := range cds {
+			if cd.Finished && !cd.First && t0+span <= to {
+				finished = append(finished, t0)
+				break
+			}
+		}
+	}
+	sort.Slice(divergent, func(i, j int) bool { return divergent[i] < divergent[j] })
+	sort.Slice(finished, func(i, j int) bool { return finished[i] < finished[j] })
+	return divergent, finished
+}
+
+func replicaChunkSpan(replicas map[string]mdata.MetricDigest) uint32 {
+	for _, d := range replicas {
+		return d.ChunkSpan
+	}
+	return 0
+}
+
+// missingChunks returns which of the given chunks of the raw archive of the series are not in the store
+func (s *Server) missingChunks(ctx context.Context, key schema.MKey, replicas map[string]mdata.MetricDigest, t0s []uint32) ([]uint32, error) {
+	var ttl uint32
+	for _, d := range replicas {
+		ttl = d.TTL
+	}
+	itgens, err := s.BackendStore.Search(ctx, schema.AMKey{MKey: key}, ttl, t0s[0], t0s[len(t0s)-1]+1)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[uint32]struct{}, len(itgens))
+	for _, itgen := range itgens {
+		stored[itgen.T0] = struct{}{}
+	}
+	var missing []uint32
+	for _, t0 := range t0s {
+		if _, ok := stored[t0]; !ok {
+			missing = append(missing, t0)
+		}
+	}
+	return missing, nil
+}
+
+// repairChunks saves the missing chunks of the series from the replicas with the most complete copy
+func (s *Server) repairChunks(ctx context.Context, sc *models.SeriesConsistency, peers []cluster.Node) {
+	byName := make(map[string]cluster.Node)
+	for _, peer := range peers {
+		byName[peer.GetName()] = peer
+	}
+	todo := make(map[string][]uint32) // t0's by peer name
+	for _, t0 := range sc.MissingChunks {
+		var best string
+		var bestPoints uint32
+		for name, d := range sc.Replicas {
+			for _, cd := range d.Chunks {
+				if cd.T0 == t0 && cd.Finished && (cd.NumPoints > bestPoints || (cd.NumPoints == bestPoints && name < best)) {
+					best, bestPoints = name, cd.NumPoints
+				}
+			}
+		}
+		if best != "" {
+			todo[best] = append(todo[best], t0)
+		}
+	}
+
+	var names []string
+	for name, t0s := range todo {
+		req := models.ConsistencyRepair{Key: sc.Key, T0s: t0s}
+		var resp models.ConsistencyRepairResp
+		var err error
+		peer := byName[name]
+		if peer.IsLocal() {
+			resp, err = s.consistencyRepairLocal(req)
+		} else {
+			var buf []byte
+			buf, err = peer.Post(ctx, "consistencyRepairRemote", "/consistency/repair", req)
+			if err == nil {
+				err = json.Unmarshal(buf, &resp)
+			}
+		}
+		if err != nil {
+			log.Errorf("HTTP consistencyCheck error repairing %s via %s: %s", sc.Key, name, err.Error())
+			sc.Error = err.Error()
+			continue
+		}
+		if len(resp.Saved) > 0 {
+			names = append(names, name)
+			sc.Repaired = append(sc.Repaired, resp.Saved...)
+			consistencyRepaired.Add(len(resp.Saved))
+		}
+	}
+	sort.Slice(sc.Repaired, func(i, j int) bool { return sc.Repaired[i] < sc.Repaired[j] })
+	sort.Strings(names)
+	sc.RepairedBy = strings.Join(names, ",")
+}
+
+// consistencyDigest returns the digests of the in-memory data of the requested series
+func (s *Server) consistencyDigest(ctx *middleware.Context, req models.ConsistencyDigest) {
+	response.Write(ctx, response.NewJson(http.StatusOK, s.consistencyDigestLocal(req), ""))
+}
+
+func (s *Server) consistencyDigestLocal(req models.ConsistencyDigest) models.ConsistencyDigestResp {
+	resp := models.ConsistencyDigestResp{
+		Digests: make(map[string]mdata.MetricDigest),
+	}
+	// query nodes don't own any data
+	if s.MemoryStore == nil {
+		return resp
+	}
+	for _, key := range req.Keys {
+		mkey, err := schema.MKeyFromString(key)
+		if err != nil {
+			continue
+		}
+		m, ok := s.MemoryStore.Get(mkey)
+		if !ok {
+			continue
+		}
+		d, ok := m.(chunkDigester)
+		if !ok {
+			continue
+		}
+		digest, err := d.Digest(req.From, req.To)
+		if err != nil {
+			continue
+		}
+		resp.Digests[key] = digest
+	}
+	return resp
+}
+
+// consistencyRepair saves the requested finished chunks from memory to the store
+func (s *Server) consistencyRepair(ctx *middleware.Context, req models.ConsistencyRepair) {
+	resp, err := s.consistencyRepairLocal(req)
+	if err != nil {
+		response.Write(ctx, response.WrapError(err))
+		return
+	}
+	response.Write(ctx, response.NewJson(http.StatusOK, resp, ""))
+}
+
+func (s *Server) consistencyRepairLocal(req models.ConsistencyRepair) (models.ConsistencyRepairResp, error) {
+	var resp models.ConsistencyRepairResp
+	if s.MemoryStore == nil {
+		return resp, response.NewError(http.StatusBadRequest, "node has no data")
+	}
+	mkey, err := schema.MKeyFromString(req.Key)
+	if err != nil {
+		return resp, response.NewError(http.StatusBadRequest, "invalid key "+req.Key)
+	}
+	m, ok := s.MemoryStore.Get(mkey)
+	if !ok {
+		return resp, response.NewError(http.StatusNotFound, "series not found: "+req.Key)
+	}
+	d, ok := m.(chunkDigester)
+	if !ok {
+		return resp, response.NewError(http.StatusBadRequest, "series can't be repaired")
+	}
+	resp.Saved = d.RepairChunks(req.T0s)
+	log.Infof("HTTP consistencyRepair saved chunks %v of %s", resp.Saved, req.Key)
+	return resp, nil
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/metrictank/mdata"
+)
+
+func TestCompareReplicas(t *testing.T) {
+	a := mdata.MetricDigest{
+		ChunkSpan: 60,
+		Oldest:    60,
+		Chunks: []mdata.ChunkDigest{
+			{T0: 60, Points: 60, Checksum: 1, NumPoints: 60, Finished: true},
+			{T0: 120, Points: 60, Checksum: 2, NumPoints: 60, Finished: true},
+			{T0: 180, Points: 60, Checksum: 3, NumPoints: 60, Finished: true},
+			{T0: 240, Points: 10, Checksum: 4, NumPoints: 10},
+		},
+	}
+	// restarted in the middle of chunk 60, and missed a point in chunk 180
+	b := mdata.MetricDigest{
+		ChunkSpan: 60,
+		Oldest:    90,
+		Chunks: []mdata.ChunkDigest{
+			{T0: 60, Points: 30, Checksum: 5, NumPoints: 30, Finished: true, First: true},
+			{T0: 120, Points: 60, Checksum: 2, NumPoints: 60, Finished: true},
+			{T0: 180, Points: 59, Checksum: 6, NumPoints: 59, Finished: true},
+			{T0: 240, Points: 10, Checksum: 4, NumPoints: 10},
+		},
+	}
+	// doesn't have chunk 240 yet
+	c := mdata.MetricDigest{
+		ChunkSpan: 60,
+		Oldest:    60,
+		Chunks: []mdata.ChunkDigest{
+			{T0: 60, Points: 60, Checksum: 1, NumPoints: 60, Finished: true},
+			{T0: 120, Points: 60, Checksum: 2, NumPoints: 60, Finished: true},
+			{T0: 180, Points: 60, Checksum: 3, NumPoints: 60},
+		},
+	}
+
+	cases := []struct {
+		name         string
+		replicas     map[string]mdata.MetricDigest
+		to           uint32
+		expDivergent []uint32
+		expFinished  []uint32
+	}{
+		{"single replica", map[string]mdata.MetricDigest{"a": a}, 300, nil, []uint32{60, 120, 180}},
+		{"partial first chunk", map[string]mdata.MetricDigest{"a": a, "b": b}, 300, []uint32{180}, []uint32{60, 120, 180}},
+		{"missing chunk", map[string]mdata.MetricDigest{"a": a, "c": c}, 300, []uint32{240}, []uint32{60, 120, 180}},
+		{"finished chunks must end before to", map[string]mdata.MetricDigest{"a": a, "c": c}, 200, []uint32{240}, []uint32{60, 120}},
+	}
+	for _, tc := range cases {
+		divergent, finished := compareReplicas(tc.replicas, tc.to)
+		if !reflect.DeepEqual(divergent, tc.expDivergent) {
+			t.Errorf("%s: expected divergent chunks %v, got %v", tc.name, tc.expDivergent, divergent)
+		}
+		if !reflect.DeepEqual(finished, tc.expFinished) {
+			t.Errorf("%s: expected finished chunks %v, got %v", tc.name, tc.expFinished, finished)
+		}
+	}
+}
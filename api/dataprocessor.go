@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"runtime"
 	"sync"
@@ -256,16 +257,39 @@ func (s *Server) getTargetsRemote(ctx context.Context, ss *models.StorageStats,
 			// Return empty response, no error
 			return resp, nil
 		}
-		body, err := node.PostRaw(ctx, "getTargetsRemote", "/getdata", models.GetData{Requests: reqs})
-		if body == nil || err != nil {
+		stream, err := node.PostStream(ctx, "getTargetsRemote", "/getdata", models.GetData{Requests: reqs})
+		if stream == nil || err != nil {
 			return nil, err
 		}
-		err = msgp.Decode(body, &resp)
-		body.Close()
+		defer stream.Close()
+		if !stream.Streamed() {
+			err = msgp.Decode(stream, &resp)
+			return resp, err
+		}
+		resp.Series = make([]models.Series, 0, len(reqs))
+		for {
+			var series models.Series
+			err = stream.Next(&series)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			resp.Series = append(resp.Series, series)
+		}
+		err = stream.Trailer(&resp.Stats)
 		return resp, err
 	})
 
-	out := make([]models.Series, 0)
+	// the series of each peer are collected until its response is complete, because replicas of the
+	// same shard group may be asked at the same time (see queryPeers), and only one of them is used.
+	// every request results in one series, so the output can be allocated in one go.
+	var numReqs int
+	for _, reqs := range shardReqs {
+		numReqs += len(reqs)
+	}
+	out := make([]models.Series, 0, numReqs)
 	for r := range resultChan {
 		resp := r.resp.(models.GetDataRespV1)
 		log.Debugf("DP getTargetsRemote: %s returned %d series", r.peer.GetName(), len(resp.Series))
@@ -280,59 +304,71 @@ func (s *Server) getTargetsRemote(ctx context.Context, ss *models.StorageStats,
 
 // getTargetsLocal returns the series corresponding to the given requests, along with the first error encountered
 func (s *Server) getTargetsLocal(ctx context.Context, ss *models.StorageStats, reqs []models.Req) ([]models.Series, error) {
+	out := make([]models.Series, 0, len(reqs))
+	err := s.getTargetsLocalFunc(ctx, ss, reqs, func(series models.Series) {
+		out = append(out, series)
+	})
+	return out, err
+}
+
+// getTargetsLocalFunc calls fn with the series corresponding to each of the given requests as they become available,
+// and returns the first error encountered. fn is called for every series, also when there is an error, and is not called concurrently.
+// no more than getTargetsConcurrency series are fetched while fn is running, so a slow fn (e.g. streaming to a slow peer) slows down the fetching.
+func (s *Server) getTargetsLocalFunc(ctx context.Context, ss *models.StorageStats, reqs []models.Req, fn func(models.Series)) error {
 	log.Debugf("DP getTargetsLocal: handling %d reqs locally", len(reqs))
 	rCtx, span := tracing.NewSpan(ctx, s.Tracer, "getTargetsLocal")
 	defer span.Finish()
 	span.LogFields(traceLog.Int("num_reqs", len(reqs)))
-	responses := make(chan getTargetResp, len(reqs))
+	responses := make(chan getTargetResp)
 
 	var wg sync.WaitGroup
 	reqLimiter := util.NewLimiter(getTargetsConcurrency)
 
 	rCtx, cancel := context.WithCancel(rCtx)
 	defer cancel()
-LOOP:
-	for _, req := range reqs {
-		// if there are already getDataConcurrency goroutines running, then block
-		// until a slot becomes free or our context is canceled.
-		if !reqLimiter.Acquire(rCtx) {
-			//request canceled
-			break LOOP
-		}
-		wg.Add(1)
-		go func(req models.Req) {
-			pre := time.Now()
-			series, err := s.getTarget(rCtx, ss, req)
-			if err != nil {
-				cancel() // cancel all other requests.
-			} else {
-				getTargetDuration.Value(time.Now().Sub(pre))
-			}
-			responses <- getTargetResp{series, err}
-			wg.Done()
-			// pop an item of our limiter so that other requests can be processed.
-			reqLimiter.Release()
-		}(req)
-	}
 	go func() {
+	LOOP:
+		for _, req := range reqs {
+			// if there are already getDataConcurrency goroutines running, then block
+			// until a slot becomes free or our context is canceled.
+			if !reqLimiter.Acquire(rCtx) {
+				//request canceled
+				break LOOP
+			}
+			wg.Add(1)
+			go func(req models.Req) {
+				pre := time.Now()
+				series, err := s.getTarget(rCtx, ss, req)
+				if err != nil {
+					cancel() // cancel all other requests.
+				} else {
+					getTargetDuration.Value(time.Now().Sub(pre))
+				}
+				responses <- getTargetResp{series, err}
+				wg.Done()
+				// pop an item of our limiter so that other requests can be processed.
+				reqLimiter.Release()
+			}(req)
+		}
 		wg.Wait()
 		close(responses)
 	}()
-	out := make([]models.Series, 0, len(reqs))
 	var firstErr error
+	var found int
 	for resp := range responses {
 		if resp.err != nil && firstErr == nil {
 			tags.Error.Set(span, true)
 			firstErr = resp.err
 		}
-		out = append(out, resp.series)
+		fn(resp.series)
+		found++
 	}
 	if firstErr != nil {
-		return out, firstErr
+		return firstErr
 	}
 	ss.Trace(span)
-	log.Debugf("DP getTargetsLocal: %d series found locally", len(out))
-	return out, nil
+	log.Debugf("DP getTargetsLocal: %d series found locally", found)
+	return nil
 
 }
 
@@ -630,6 +666,7 @@ func (s *Server) getSeriesCachedStore(ctx *requestContext, ss *models.StorageSta
 // series into groups based on their target, query, consolidator etc. If they collide, they get merged.
 // each first uniquely-identified series's backing datapoints slice is reused
 // any subsequent non-uniquely-identified series is merged into the former and is passed to the seriescycler
+// the merged series are returned in the order of their first occurrence.
 // input series must be canonical
 func mergeSeries(in []models.Series, sc seriescycle.SeriesCycler) []models.Series {
 	type segment struct {
@@ -643,6 +680,7 @@ func mergeSeries(in []models.Series, sc seriescycle.SeriesCycler) []models.Serie
 		pngroup models.PNGroup
 	}
 	seriesByTarget := make(map[segment][]models.Series)
+	var order []segment
 	for _, series := range in {
 		s := segment{
 			series.Target,
@@ -654,11 +692,14 @@ func mergeSeries(in []models.Series, sc seriescycle.SeriesCycler) []models.Serie
 			series.QueryMDP,
 			series.QueryPNGroup,
 		}
+		if _, ok := seriesByTarget[s]; !ok {
+			order = append(order, s)
+		}
 		seriesByTarget[s] = append(seriesByTarget[s], series)
 	}
 	merged := make([]models.Series, len(seriesByTarget))
-	i := 0
-	for _, series := range seriesByTarget {
+	for i, s := range order {
+		series := seriesByTarget[s]
 		if len(series) == 1 {
 			merged[i] = series[0]
 		} else {
@@ -683,7 +724,6 @@ func mergeSeries(in []models.Series, sc seriescycle.SeriesCycler) []models.Serie
 				merged[i].Meta = merged[i].Meta.Merge(series[j].Meta)
 			}
 		}
-		i++
 	}
 	return merged
 }
@@ -587,6 +587,11 @@ func TestMergeSeries(t *testing.T) {
 	if len(merged) != 5 {
 		t.Errorf("Expected data to be merged down to 5 series. got %d instead", len(merged))
 	}
+	for i, serie := range merged {
+		if exp := fmt.Sprintf("some.series.foo%d", i); serie.Target != exp {
+			t.Errorf("expected series %d to be %s, got %s", i, exp, serie.Target)
+		}
+	}
 	for _, serie := range merged {
 		if serie.Target == "some.series.foo1" {
 			if len(serie.Datapoints) != 4 {
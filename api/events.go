@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/api/middleware"
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/api/response"
+	"github.com/grafana/metrictank/expr"
+	"github.com/grafana/metrictank/idx"
+)
+
+// eventsGetter returns a getter for the events of the given org, to be used by the events() function
+func (s *Server) eventsGetter(orgId uint32) expr.EventsGetter {
+	if s.Events == nil {
+		return nil
+	}
+	return func(from, to uint32, tags []string) []idx.Event {
+		return s.Events.EventFind(orgId, int64(from), int64(to), tags)
+	}
+}
+
+// eventId parses the id of the event from the url
+func eventId(ctx *middleware.Context) (int64, error) {
+	return strconv.ParseInt(ctx.Params(":id"), 10, 64)
+}
+
+func (s *Server) eventsGetData(ctx *middleware.Context, request models.EventsGetData) {
+	if s.Events == nil {
+		response.Write(ctx, response.NewError(http.StatusNotImplemented, "Event support is not enabled"))
+		return
+	}
+
+	now := time.Now()
+	defaultFrom := uint32(now.Add(-time.Duration(24) * time.Hour).Unix())
+	defaultTo := uint32(now.Unix())
+	fromUnix, toUnix, err := getFromTo(request.FromTo, now, defaultFrom, defaultTo)
+	if err != nil {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if fromUnix >= toUnix {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, InvalidTimeRangeErr.Error()))
+		return
+	}
+
+	// like render, from is exclusive and to inclusive
+	events := s.Events.EventFind(ctx.OrgId, int64(fromUnix)+1, int64(toUnix)+1, strings.Fields(request.Tags))
+	response.Write(ctx, response.NewJson(200, events, ""))
+}
+
+func (s *Server) eventAdd(ctx *middleware.Context, request models.EventAdd) {
+	if s.Events == nil {
+		response.Write(ctx, response.NewError(http.StatusNotImplemented, "Event support is not enabled"))
+		return
+	}
+
+	event := idx.Event{
+		When: request.When,
+		What: request.What,
+		Data: request.Data,
+		Tags: request.Tags,
+	}
+	if event.When == 0 {
+		event.When = time.Now().Unix()
+	}
+
+	event, err := s.Events.EventAdd(ctx.OrgId, event)
+	if err != nil {
+		response.Write(ctx, response.WrapError(err))
+		return
+	}
+
+	response.Write(ctx, response.NewJson(200, event, ""))
+}
+
+func (s *Server) eventGet(ctx *middleware.Context) {
+	if s.Events == nil {
+		response.Write(ctx, response.NewError(http.StatusNotImplemented, "Event support is not enabled"))
+		return
+	}
+
+	id, err := eventId(ctx)
+	if err != nil {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	event, ok := s.Events.EventGet(ctx.OrgId, id)
+	if !ok {
+		response.Write(ctx, response.Errorf(http.StatusNotFound, "event %d not found", id))
+		return
+	}
+
+	response.Write(ctx, response.NewJson(200, event, ""))
+}
+
+func (s *Server) eventDelete(ctx *middleware.Context) {
+	if s.Events == nil {
+		response.Write(ctx, response.NewError(http.StatusNotImplemented, "Event support is not enabled"))
+		return
+	}
+
+	id, err := eventId(ctx)
+	if err != nil {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	err = s.Events.EventDelete(ctx.OrgId, id)
+	if err != nil {
+		response.Write(ctx, response.WrapError(err))
+		return
+	}
+
+	response.Write(ctx, response.NewJson(200, struct{ Status string }{Status: "OK"}, ""))
+}
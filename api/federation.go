@@ -0,0 +1,389 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/api/seriescycle"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/schema"
+	"github.com/grafana/metrictank/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// metric api.federation.requests is the number of requests sent to remote clusters
+	federationRequests = stats.NewCounter32("api.federation.requests")
+	// metric api.federation.errors is the number of requests to remote clusters that failed, or returned a response that could not be decoded
+	federationErrors = stats.NewCounter32("api.federation.errors")
+	// metric api.federation.latency is the duration of requests to remote clusters
+	federationLatency = stats.NewLatencyHistogram15s32("api.federation.latency")
+)
+
+// federatedHeader is set on the requests sent to remote clusters.
+// requests that have it are served from the local cluster only, so that clusters
+// can federate to each other without forwarding requests in a loop.
+const federatedHeader = "X-Metrictank-Federated"
+
+var federationClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// remoteCluster is a metrictank cluster that requests are federated to
+type remoteCluster struct {
+	name string
+	url  *url.URL
+}
+
+var remoteClusters []remoteCluster
+
+// parseRemoteClusters parses a comma separated list of name=url pairs.
+// names are used as value of the region tag, so they must be valid tag values.
+func parseRemoteClusters(s string) ([]remoteCluster, error) {
+	var clusters []remoteCluster
+	seen := make(map[string]struct{})
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q is not a name=url pair", pair)
+		}
+		name, addr := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !schema.ValidateTagValue(name) {
+			return nil, fmt.Errorf("invalid cluster name %q", name)
+		}
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("duplicate cluster name %q", name)
+		}
+		seen[name] = struct{}{}
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url for cluster %q: %s", name, err.Error())
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("url for cluster %q must be an absolute http or https url, got %q", name, addr)
+		}
+		clusters = append(clusters, remoteCluster{name: name, url: u})
+	}
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no clusters specified")
+	}
+	return clusters, nil
+}
+
+// shouldFederate returns whether the request must be forwarded to the remote clusters
+func shouldFederate(req *http.Request) bool {
+	return federationEnabled && req.Header.Get(federatedHeader) == ""
+}
+
+// post sends the request to the cluster, and returns the body of the response
+func (c remoteCluster) post(ctx context.Context, orgId uint32, path string, params url.Values) ([]byte, error) {
+	u := *c.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	req, err := http.NewRequest("POST", u.String(), strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Org-Id", strconv.FormatUint(uint64(orgId), 10))
+	req.Header.Set(federatedHeader, "1")
+
+	federationRequests.Inc()
+	pre := time.Now()
+	resp, err := federationClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	federationLatency.Value(time.Since(pre))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// federationResult is the response of a remote cluster to a federated request
+type federationResult struct {
+	cluster string
+	body    []byte
+	err     error
+}
+
+// federate sends the request to all remote clusters concurrently, and returns their results in the order of the clusters.
+// the returned channel receives the results once all clusters have responded or timed out.
+func federate(ctx context.Context, orgId uint32, path string, params url.Values) <-chan []federationResult {
+	out := make(chan []federationResult, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, federationTimeout)
+		defer cancel()
+		results := make([]federationResult, len(remoteClusters))
+		var wg sync.WaitGroup
+		for i, c := range remoteClusters {
+			wg.Add(1)
+			go func(i int, c remoteCluster) {
+				defer wg.Done()
+				body, err := c.post(ctx, orgId, path, params)
+				results[i] = federationResult{cluster: c.name, body: body, err: err}
+			}(i, c)
+		}
+		wg.Wait()
+		out <- results
+	}()
+	return out
+}
+
+// decodeFederated calls decode for the body of all successful results.
+// results whose body can't be decoded are marked as failed.
+// failures are logged and counted, and reported in the returned meta.
+func decodeFederated(path string, results []federationResult, decode func(cluster string, body []byte) error) models.FederationMeta {
+	var meta models.FederationMeta
+	for _, r := range results {
+		err := r.err
+		if err == nil {
+			err = decode(r.cluster, r.body)
+			if err != nil {
+				err = fmt.Errorf("failed to decode response: %s", err.Error())
+			}
+		}
+		if err != nil {
+			federationErrors.Inc()
+			log.Warnf("API federation: request %s to cluster %s failed: %s", path, r.cluster, err.Error())
+			if meta.Failed == nil {
+				meta.Failed = make(map[string]string)
+			}
+			meta.Failed[r.cluster] = err.Error()
+			continue
+		}
+		meta.Clusters = append(meta.Clusters, r.cluster)
+	}
+	return meta
+}
+
+// federationWarnings returns a warning for each cluster whose results are missing
+func federationWarnings(meta models.FederationMeta) []string {
+	var warnings []string
+	for _, c := range remoteClusters {
+		if err, ok := meta.Failed[c.name]; ok {
+			warnings = append(warnings, fmt.Sprintf("Results of cluster %s are missing: %s", c.name, err))
+		}
+	}
+	return warnings
+}
+
+// tagRegion adds the region tag to the series, so that series with the same name
+// in different clusters are not merged.
+func tagRegion(series []models.Series, region string) {
+	for i := range series {
+		// the tags may be shared with other series, so we must not modify them
+		tags := make(map[string]string, len(series[i].Tags)+1)
+		for k, v := range series[i].Tags {
+			tags[k] = v
+		}
+		tags[federationRegionTag] = region
+		series[i].Tags = tags
+		series[i].Target += ";" + federationRegionTag + "=" + region
+	}
+}
+
+// federationFromTo returns the params to request the given time range from remote clusters.
+// from and to are in the graphite convention: from exclusive, to inclusive.
+func federationFromTo(from, to uint32) url.Values {
+	return url.Values{
+		"from":  {strconv.FormatUint(uint64(from), 10)},
+		"until": {strconv.FormatUint(uint64(to), 10)},
+	}
+}
+
+// federateRender forwards a render request to the remote clusters, which return the series as msgp
+func federateRender(ctx context.Context, orgId uint32, request models.GraphiteRender, from, to uint32) <-chan []federationResult {
+	params := federationFromTo(from, to)
+	params["target"] = request.Targets
+	params.Set("format", "msgp")
+	params.Set("maxDataPoints", strconv.FormatUint(uint64(request.MaxDataPoints), 10))
+	params.Set("process", request.Process)
+	params.Set("optimizations", request.Optimizations)
+	if request.NoProxy {
+		params.Set("local", "1")
+	}
+	return federate(ctx, orgId, "/render", params)
+}
+
+// mergeFederatedRender merges the series of the remote clusters with the local ones.
+// all series are tagged with their region, so the series of different clusters stay separate.
+func mergeFederatedRender(local []models.Series, results []federationResult) ([]models.Series, models.FederationMeta) {
+	tagRegion(local, federationRegion)
+	all := make([]models.Series, 0, len(local))
+	all = append(all, local...)
+	meta := decodeFederated("/render", results, func(cluster string, body []byte) error {
+		var remote models.SeriesByTarget
+		if _, err := remote.UnmarshalMsg(body); err != nil {
+			return err
+		}
+		tagRegion(remote, cluster)
+		all = append(all, remote...)
+		return nil
+	})
+	return mergeSeries(all, seriescycle.NullCycler), meta
+}
+
+// federateFind forwards a find request to the remote clusters, which return the nodes in the completer format
+func federateFind(ctx context.Context, orgId uint32, query string, from, to uint32) <-chan []federationResult {
+	params := federationFromTo(from, to)
+	params.Set("query", query)
+	params.Set("format", "completer")
+	return federate(ctx, orgId, "/metrics/find", params)
+}
+
+// mergeFederatedFind adds the nodes of the remote clusters whose path was not seen yet.
+// like with the nodes of the local cluster, if a path is a leaf in one cluster and a branch in another,
+// only the first one seen is kept.
+func mergeFederatedFind(nodes []idx.Node, seenPaths map[string]struct{}, results []federationResult) []idx.Node {
+	decodeFederated("/metrics/find", results, func(cluster string, body []byte) error {
+		var remote models.SeriesCompleter
+		if err := json.Unmarshal(body, &remote); err != nil {
+			return err
+		}
+		for _, item := range remote["metrics"] {
+			if _, ok := seenPaths[item.Path]; !ok {
+				leaf := item.IsLeaf == "1"
+				nodes = append(nodes, idx.Node{Path: item.Path, Leaf: leaf, HasChildren: !leaf})
+				seenPaths[item.Path] = struct{}{}
+			}
+		}
+		return nil
+	})
+	return nodes
+}
+
+func federateTags(ctx context.Context, orgId uint32, request models.GraphiteTags) <-chan []federationResult {
+	return federate(ctx, orgId, "/tags", url.Values{"filter": {request.Filter}})
+}
+
+// decodeGraphiteTags decodes a json models.GraphiteTagsResp
+func decodeGraphiteTags(body []byte) ([]string, error) {
+	var resp models.GraphiteTagsResp
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(resp))
+	for _, t := range resp {
+		tags = append(tags, t.Tag)
+	}
+	return tags, nil
+}
+
+func federateAutoCompleteTags(ctx context.Context, orgId uint32, request models.GraphiteAutoCompleteTags) <-chan []federationResult {
+	params := url.Values{
+		"tagPrefix": {request.Prefix},
+		"expr":      request.Expr,
+		"limit":     {strconv.FormatUint(uint64(request.Limit), 10)},
+	}
+	return federate(ctx, orgId, "/tags/autoComplete/tags", params)
+}
+
+func federateAutoCompleteTagValues(ctx context.Context, orgId uint32, request models.GraphiteAutoCompleteTagValues) <-chan []federationResult {
+	params := url.Values{
+		"tag":         {request.Tag},
+		"valuePrefix": {request.Prefix},
+		"expr":        request.Expr,
+		"limit":       {strconv.FormatUint(uint64(request.Limit), 10)},
+	}
+	return federate(ctx, orgId, "/tags/autoComplete/values", params)
+}
+
+// federateTagFindSeries forwards a find series request to the remote clusters, which return the series with their last update
+func federateTagFindSeries(ctx context.Context, orgId uint32, request models.GraphiteTagFindSeries) <-chan []federationResult {
+	params := url.Values{
+		"expr":   request.Expr,
+		"from":   {strconv.FormatInt(request.From, 10)},
+		"limit":  {strconv.Itoa(request.Limit)},
+		"format": {"lastts-json"},
+	}
+	return federate(ctx, orgId, "/tags/findSeries", params)
+}
+
+// mergeFederatedTagFindSeries adds the series of the remote clusters that were not found yet.
+// series found in multiple clusters are returned once, with the most recent last update.
+// it returns the warnings of the remote clusters, and one for each cluster whose results are missing.
+func mergeFederatedTagFindSeries(found []models.SeriesLastTs, results []federationResult) ([]models.SeriesLastTs, []string) {
+	pos := make(map[string]int, len(found))
+	for i, s := range found {
+		pos[s.Series] = i
+	}
+	var warnings []string
+	meta := decodeFederated("/tags/findSeries", results, func(cluster string, body []byte) error {
+		var remote models.GraphiteTagFindSeriesLastTsResp
+		if err := json.Unmarshal(body, &remote); err != nil {
+			return err
+		}
+		for _, s := range remote.Series {
+			if i, ok := pos[s.Series]; ok {
+				if s.Ts > found[i].Ts {
+					found[i].Ts = s.Ts
+				}
+				continue
+			}
+			pos[s.Series] = len(found)
+			found = append(found, s)
+		}
+		for _, w := range remote.Warnings {
+			warnings = append(warnings, fmt.Sprintf("Cluster %s: %s", cluster, w))
+		}
+		return nil
+	})
+	return found, append(warnings, federationWarnings(meta)...)
+}
+
+// mergeFederatedTags returns the sorted union of the local tags (or tag values) and those of the remote clusters.
+// the remote clusters return a json list of strings, unless decode is given.
+func mergeFederatedTags(path string, local []string, results []federationResult, decode func(body []byte) ([]string, error)) []string {
+	if decode == nil {
+		decode = func(body []byte) ([]string, error) {
+			var tags []string
+			err := json.Unmarshal(body, &tags)
+			return tags, err
+		}
+	}
+	set := make(map[string]struct{}, len(local))
+	for _, t := range local {
+		set[t] = struct{}{}
+	}
+	decodeFederated(path, results, func(cluster string, body []byte) error {
+		remote, err := decode(body)
+		if err != nil {
+			return err
+		}
+		for _, t := range remote {
+			set[t] = struct{}{}
+		}
+		return nil
+	})
+	merged := make([]string, 0, len(set))
+	for t := range set {
+		merged = append(merged, t)
+	}
+	sort.Strings(merged)
+	return merged
+}
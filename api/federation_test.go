@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+func TestParseRemoteClusters(t *testing.T) {
+	clusters, err := parseRemoteClusters("us-east=http://mt.us-east:6060, eu=https://mt.eu/metrictank/")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(clusters) != 2 || clusters[0].name != "us-east" || clusters[0].url.Host != "mt.us-east:6060" || clusters[1].name != "eu" || clusters[1].url.Path != "/metrictank/" {
+		t.Fatalf("unexpected clusters %v", clusters)
+	}
+
+	for _, s := range []string{
+		"",
+		"us-east",
+		"us-east=mt.us-east:6060",
+		"us-east=ftp://mt.us-east",
+		"us;east=http://mt.us-east",
+		"eu=http://a,eu=http://b",
+	} {
+		if _, err := parseRemoteClusters(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+}
+
+// withRemoteClusters enables federation to the given servers for the duration of the test
+func withRemoteClusters(t *testing.T, servers map[string]*httptest.Server) func() {
+	var s string
+	for _, name := range []string{"a", "b", "c"} {
+		if srv, ok := servers[name]; ok {
+			if s != "" {
+				s += ","
+			}
+			s += name + "=" + srv.URL
+		}
+	}
+	clusters, err := parseRemoteClusters(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteClusters, federationEnabled, federationTimeout = clusters, true, time.Second
+	return func() {
+		remoteClusters, federationEnabled = nil, false
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+}
+
+func federatedSeries(target string, vals ...float64) models.Series {
+	s := models.Series{Target: target, Interval: 10, Tags: map[string]string{"name": target}}
+	for i, v := range vals {
+		s.Datapoints = append(s.Datapoints, schema.Point{Val: v, Ts: uint32(10 * (i + 1))})
+	}
+	return s
+}
+
+func TestFederateRender(t *testing.T) {
+	cases := []struct {
+		regionTag  string
+		expTargets []string
+	}{
+		{"region", []string{"a;region=local", "a;region=a", "b;region=a"}},
+		{"dc", []string{"a;dc=local", "a;dc=a", "b;dc=a"}},
+	}
+	for _, c := range cases {
+		var form url.Values
+		var header http.Header
+		ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			form, header = r.PostForm, r.Header
+			body, _ := models.SeriesByTarget{federatedSeries("a", 1, math.NaN()), federatedSeries("b", 3, 4)}.MarshalMsg(nil)
+			w.Write(body)
+		}))
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}))
+		cleanup := withRemoteClusters(t, map[string]*httptest.Server{"a": ok, "b": failing})
+
+		request := models.GraphiteRender{Targets: []string{"a", "b"}, MaxDataPoints: 800}
+		results := <-federateRender(context.Background(), 3, request, 10, 20)
+		cleanup()
+
+		if form.Get("from") != "10" || form.Get("until") != "20" || form.Get("format") != "msgp" || !reflect.DeepEqual(form["target"], request.Targets) {
+			t.Fatalf("unexpected params %v", form)
+		}
+		if header.Get("X-Org-Id") != "3" || header.Get(federatedHeader) == "" {
+			t.Fatalf("unexpected headers %v", header)
+		}
+
+		federationRegionTag, federationRegion = c.regionTag, "local"
+		local := []models.Series{federatedSeries("a", math.NaN(), 2)}
+		out, meta := mergeFederatedRender(local, results)
+		federationRegionTag, federationRegion = "region", ""
+
+		var targets []string
+		for _, s := range out {
+			targets = append(targets, s.Target)
+		}
+		if !reflect.DeepEqual(targets, c.expTargets) {
+			t.Fatalf("region tag %q: expected targets %v, got %v", c.regionTag, c.expTargets, targets)
+		}
+		// series a of both clusters, e.g. the sum of the series of each cluster, are not merged
+		if out[0].Tags[c.regionTag] != "local" || out[1].Tags[c.regionTag] != "a" || out[1].Tags["name"] != "a" {
+			t.Fatalf("expected region tags, got %v and %v", out[0].Tags, out[1].Tags)
+		}
+		if !math.IsNaN(out[0].Datapoints[0].Val) || out[1].Datapoints[0].Val != 1 {
+			t.Fatalf("expected series a of both clusters to keep their own values, got %v and %v", out[0].Datapoints, out[1].Datapoints)
+		}
+		if !meta.Partial() || !reflect.DeepEqual(meta.Clusters, []string{"a"}) || len(meta.Failed) != 1 || meta.Failed["b"] == "" {
+			t.Fatalf("unexpected meta %+v", meta)
+		}
+	}
+}
+
+func TestFederateTagFindSeries(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"series":[{"val":"a;dc=eu","lastTs":20},{"val":"c;dc=us","lastTs":5}],"warnings":["Result set truncated due to limit"]}`))
+	}))
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`not json`))
+	}))
+	defer withRemoteClusters(t, map[string]*httptest.Server{"a": remote, "b": invalid})()
+
+	results := <-federateTagFindSeries(context.Background(), 1, models.GraphiteTagFindSeries{Expr: []string{"dc=~.*"}})
+	local := []models.SeriesLastTs{{Series: "a;dc=eu", Ts: 10}, {Series: "b;dc=eu", Ts: 30}}
+	found, warnings := mergeFederatedTagFindSeries(local, results)
+	exp := []models.SeriesLastTs{{Series: "a;dc=eu", Ts: 20}, {Series: "b;dc=eu", Ts: 30}, {Series: "c;dc=us", Ts: 5}}
+	if !reflect.DeepEqual(found, exp) {
+		t.Fatalf("expected %v, got %v", exp, found)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("expected a warning for the truncation in cluster a, and for the failure of cluster b, got %v", warnings)
+	}
+}
+
+func TestMergeFederatedTags(t *testing.T) {
+	results := []federationResult{
+		{cluster: "a", body: []byte(`[{"tag":"dc"},{"tag":"name"}]`)},
+		{cluster: "b", body: []byte(`[{"tag":"region"}]`)},
+	}
+	tags := mergeFederatedTags("/tags", []string{"name", "host"}, results, decodeGraphiteTags)
+	if exp := []string{"dc", "host", "name", "region"}; !reflect.DeepEqual(tags, exp) {
+		t.Fatalf("expected %v, got %v", exp, tags)
+	}
+}
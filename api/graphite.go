@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"sort"
 	"strings"
@@ -11,13 +13,13 @@ import (
 	"time"
 
 	"github.com/grafana/metrictank/idx/memory"
-	"github.com/grafana/metrictank/schema"
 	"github.com/tinylib/msgp/msgp"
 	"golang.org/x/sync/errgroup"
 	macaron "gopkg.in/macaron.v1"
 
 	"github.com/grafana/metrictank/api/middleware"
 	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/api/render"
 	"github.com/grafana/metrictank/api/response"
 	"github.com/grafana/metrictank/api/seriescycle"
 	"github.com/grafana/metrictank/cluster"
@@ -137,7 +139,7 @@ func (s *Server) findSeries(ctx context.Context, orgId uint32, patterns []string
 	var leavesTotal int
 	series := make([]Series, 0)
 
-	responseChan, errorChan := s.queryAllShardsGeneric(ctx, "findSeriesRemote", fetchFn)
+	responseChan, errorChan := s.queryAllShardsGeneric(ctx, orgId, "findSeriesRemote", fetchFn)
 
 MainLoop:
 	for {
@@ -249,6 +251,17 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 		traceLog.Int32("span", int32(toUnix-fromUnix)),
 	)
 
+	// validate the graph options up front, so we don't execute the request only to fail rendering it
+	var graphParams render.Params
+	if request.Format == "png" || request.Format == "svg" {
+		loc, _ := getLocation(request.FromTo.Tz) // already validated by getFromTo
+		graphParams, err = render.NewParams(request.GraphOptions, fromUnix, toUnix, loc)
+		if err != nil {
+			response.Write(ctx, response.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+	}
+
 	// render API is modeled after graphite, so from exclusive, to inclusive.
 	// in MT, from is inclusive, to is exclusive (which is akin to slice syntax)
 	// so we must adjust
@@ -267,6 +280,13 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 		return
 	}
 
+	// note: graphite doesn't know our macros, so there is no point in proxying on error
+	exprs, err = expr.ExpandMacros(exprs, s.macroGetter(ctx.OrgId))
+	if err != nil {
+		ctx.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+
 	reqRenderTargetCount.Value(len(request.Targets))
 
 	if request.Process == "none" {
@@ -313,6 +333,16 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 		return
 	}
 
+	plan.BindEvents(s.eventsGetter(ctx.OrgId))
+	loc, _ := getLocation(request.FromTo.Tz) // already validated by getFromTo
+	plan.BindLocation(loc)
+
+	// remote clusters are queried while we execute the plan locally
+	var federated <-chan []federationResult
+	if shouldFederate(ctx.Req.Request) {
+		federated = federateRender(ctx.Req.Context(), ctx.OrgId, request, fromUnix-1, toUnix-1)
+	}
+
 	execCtx, execSpan := tracing.NewSpan(ctx.Req.Context(), s.Tracer, "executePlan")
 	defer execSpan.Finish()
 	out, meta, err := s.executePlan(execCtx, ctx.OrgId, &plan)
@@ -341,6 +371,10 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 	default:
 	}
 
+	if federated != nil {
+		out, meta.Federation = mergeFederatedRender(out, <-federated)
+	}
+
 	noDataPoints := true
 	for _, o := range out {
 		if len(o.Datapoints) != 0 {
@@ -361,6 +395,12 @@ func (s *Server) renderMetrics(ctx *middleware.Context, request models.GraphiteR
 		response.Write(ctx, response.NewPickle(200, models.SeriesByTarget(out)))
 	case "csv":
 		response.Write(ctx, response.NewCsv(200, models.SeriesByTarget(out)))
+	case "arrow":
+		response.Write(ctx, response.NewArrow(200, models.SeriesByTarget(out)))
+	case "png":
+		response.Write(ctx, response.NewPng(200, render.NewGraph(out, graphParams)))
+	case "svg":
+		response.Write(ctx, response.NewSvg(200, render.NewGraph(out, graphParams)))
 	default:
 		if request.Meta {
 			response.Write(ctx, response.NewFastJson(200, models.ResponseWithMeta{Series: models.SeriesByTarget(out), Meta: meta}))
@@ -380,6 +420,10 @@ func (s *Server) metricsFind(ctx *middleware.Context, request models.GraphiteFin
 	}
 	nodes := make([]idx.Node, 0)
 	reqCtx := ctx.Req.Context()
+	var federated <-chan []federationResult
+	if shouldFederate(ctx.Req.Request) {
+		federated = federateFind(reqCtx, ctx.OrgId, request.Query, fromUnix, toUnix)
+	}
 	series, err := s.findSeries(reqCtx, ctx.OrgId, []string{request.Query}, int64(fromUnix), false, maxSeriesPerReq)
 	if err != nil {
 		response.Write(ctx, response.WrapError(err))
@@ -409,6 +453,9 @@ func (s *Server) metricsFind(ctx *middleware.Context, request models.GraphiteFin
 			}
 		}
 	}
+	if federated != nil {
+		nodes = mergeFederatedFind(nodes, seenPaths, <-federated)
+	}
 
 	switch request.Format {
 	case "", "treejson", "json":
@@ -497,90 +544,109 @@ func (s *Server) listLocal(orgId uint32) []idx.Archive {
 	return s.MetricIndex.List(orgId)
 }
 
-func (s *Server) listRemote(ctx context.Context, orgId uint32, peer cluster.Node) ([]idx.Archive, error) {
+// listRemote calls fn with each Archive of the given org on the given peer, as they are received.
+// fn may be called concurrently for different peers.
+func (s *Server) listRemote(ctx context.Context, orgId uint32, peer cluster.Node, fn func(idx.Archive)) error {
 	log.Debugf("HTTP IndexJson() querying %s/index/list for %d", peer.GetName(), orgId)
-	buf, err := peer.Post(ctx, "listRemote", "/index/list", models.IndexList{OrgId: orgId})
+	stream, err := peer.PostStream(ctx, "listRemote", "/index/list", models.IndexList{OrgId: orgId})
 	if err != nil {
 		log.Errorf("HTTP IndexJson() error querying %s/index/list: %q", peer.GetName(), err.Error())
-		return nil, err
+		return err
 	}
-	select {
-	case <-ctx.Done():
+	if stream == nil {
 		//request canceled
-		return nil, nil
-	default:
+		return nil
+	}
+	defer stream.Close()
+	if stream.Streamed() {
+		for {
+			var def idx.Archive
+			err = stream.Next(&def)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				log.Errorf("HTTP IndexJson() error reading stream from %s/index/list: %q", peer.GetName(), err.Error())
+				return err
+			}
+			fn(def)
+		}
+	}
+	buf, err := ioutil.ReadAll(stream)
+	if err != nil {
+		log.Errorf("HTTP IndexJson() error reading body from %s/index/list: %q", peer.GetName(), err.Error())
+		return err
 	}
-	result := make([]idx.Archive, 0)
 	for len(buf) != 0 {
 		var def idx.Archive
 		buf, err = def.UnmarshalMsg(buf)
 		if err != nil {
 			log.Errorf("HTTP IndexJson() error unmarshaling body from %s/index/list: %q", peer.GetName(), err.Error())
-			return nil, err
+			return err
 		}
-		result = append(result, def)
+		fn(def)
 	}
-	return result, nil
+	return nil
 }
 
 func (s *Server) metricsIndex(ctx *middleware.Context) {
-	peers, err := cluster.MembersForQuery()
-	if err != nil {
-		response.Write(ctx, response.WrapError(err))
-		return
+	var peers []cluster.Node
+	var err error
+	if s.isLocalOrg(ctx.OrgId) {
+		peers = []cluster.Node{cluster.Manager.ThisNode()}
+	} else {
+		peers, err = cluster.MembersForQuery()
+		if err != nil {
+			response.Write(ctx, response.WrapError(err))
+			return
+		}
 	}
 	reqCtx, cancel := context.WithCancel(ctx.Req.Context())
 	defer cancel()
-	responses := make(chan struct {
-		series []idx.Archive
-		err    error
-	}, 1)
+
+	// the defs are merged as they come in, and only the first def of each name is kept,
+	// because the response only consists of the names.
+	var mu sync.Mutex
+	series := make([]idx.Archive, 0)
+	seenNames := make(map[string]struct{})
+	add := func(def idx.Archive) {
+		mu.Lock()
+		if _, ok := seenNames[def.Name]; !ok {
+			series = append(series, def)
+			seenNames[def.Name] = struct{}{}
+		}
+		mu.Unlock()
+	}
+
+	errs := make(chan error, len(peers))
 	var wg sync.WaitGroup
 	for _, peer := range peers {
 		wg.Add(1)
 		if peer.IsLocal() {
 			go func() {
-				result := s.listLocal(ctx.OrgId)
-				responses <- struct {
-					series []idx.Archive
-					err    error
-				}{result, nil}
+				for _, def := range s.listLocal(ctx.OrgId) {
+					add(def)
+				}
 				wg.Done()
 			}()
 		} else {
 			go func(peer cluster.Node) {
-				result, err := s.listRemote(reqCtx, ctx.OrgId, peer)
+				err := s.listRemote(reqCtx, ctx.OrgId, peer, add)
 				if err != nil {
+					// the first error is the cause, the others may be caused by canceling the other requests
+					errs <- err
 					cancel()
 				}
-				responses <- struct {
-					series []idx.Archive
-					err    error
-				}{result, err}
 				wg.Done()
 			}(peer)
 		}
 	}
+	wg.Wait()
+	close(errs)
 
-	// wait for all list goroutines to end, then close our responses channel
-	go func() {
-		wg.Wait()
-		close(responses)
-	}()
-
-	series := make([]idx.Archive, 0)
-	seenDefs := make(map[schema.MKey]struct{})
-	for resp := range responses {
-		if resp.err != nil {
-			response.Write(ctx, response.WrapError(err))
-			return
-		}
-		for _, def := range resp.series {
-			if _, ok := seenDefs[def.Id]; !ok {
-				series = append(series, def)
-				seenDefs[def.Id] = struct{}{}
-			}
-		}
+	if err := <-errs; err != nil {
+		response.Write(ctx, response.WrapError(err))
+		return
 	}
 
 	// check to see if the request has been canceled, if so abort now.
@@ -1145,7 +1211,7 @@ func (s *Server) clusterTagDetails(ctx context.Context, orgId uint32, tag, filte
 	result := make(map[string]uint64)
 
 	data := models.IndexTagDetails{OrgId: orgId, Tag: tag, Filter: filter}
-	resps, err := s.queryAllShards(ctx, "clusterTagDetails", fetchFuncPost(data, "clusterTagDetails", "/index/tag_details"))
+	resps, err := s.queryAllShards(ctx, orgId, "clusterTagDetails", fetchFuncPost(data, "clusterTagDetails", "/index/tag_details"))
 	if err != nil {
 		return nil, err
 	}
@@ -1187,6 +1253,11 @@ func (s *Server) graphiteTagFindSeries(ctx *middleware.Context, request models.G
 		isSoftLimit = false
 	}
 
+	var federated <-chan []federationResult
+	if shouldFederate(ctx.Req.Request) {
+		federated = federateTagFindSeries(reqCtx, ctx.OrgId, request)
+	}
+
 	series, err := s.clusterFindByTag(reqCtx, ctx.OrgId, expressions, request.From, limit, isSoftLimit)
 	if err != nil {
 		response.Write(ctx, response.WrapError(err))
@@ -1206,28 +1277,40 @@ func (s *Server) graphiteTagFindSeries(ctx *middleware.Context, request models.G
 		warnings = append(warnings, "Result set truncated due to limit")
 	}
 
-	switch request.Format {
-	case "lastts-json":
-		retval := models.GraphiteTagFindSeriesLastTsResp{Warnings: warnings}
-		retval.Series = make([]models.SeriesLastTs, 0, len(series))
-		for _, serie := range series {
-			var lastUpdate int64
-			for _, node := range serie.Series {
-				for _, ndef := range node.Defs {
-					if ndef.LastUpdate > lastUpdate {
-						lastUpdate = ndef.LastUpdate
-					}
+	found := make([]models.SeriesLastTs, 0, len(series))
+	for _, serie := range series {
+		var lastUpdate int64
+		for _, node := range serie.Series {
+			for _, ndef := range node.Defs {
+				if ndef.LastUpdate > lastUpdate {
+					lastUpdate = ndef.LastUpdate
 				}
 			}
-			retval.Series = append(retval.Series, models.SeriesLastTs{Series: serie.Pattern, Ts: lastUpdate})
 		}
+		// note: for findByTag the "Pattern" is the full metric nameWithTags
+		found = append(found, models.SeriesLastTs{Series: serie.Pattern, Ts: lastUpdate})
+	}
+
+	if federated != nil {
+		var remoteWarnings []string
+		found, remoteWarnings = mergeFederatedTagFindSeries(found, <-federated)
+		warnings = append(warnings, remoteWarnings...)
+		if limit > 0 && len(found) > limit {
+			found = found[:limit]
+			if len(series) != limit {
+				warnings = append(warnings, "Result set truncated due to limit")
+			}
+		}
+	}
 
+	switch request.Format {
+	case "lastts-json":
+		retval := models.GraphiteTagFindSeriesLastTsResp{Series: found, Warnings: warnings}
 		response.Write(ctx, response.NewJson(200, retval, ""))
 	case "series-json":
-		seriesNames := make([]string, 0, len(series))
-		for _, serie := range series {
-			// note: for findByTag the "Pattern" is the full metric nameWithTags
-			seriesNames = append(seriesNames, serie.Pattern)
+		seriesNames := make([]string, 0, len(found))
+		for _, serie := range found {
+			seriesNames = append(seriesNames, serie.Series)
 		}
 
 		if request.Meta == true {
@@ -1245,16 +1328,60 @@ func (s *Server) clusterFindByTag(ctx context.Context, orgId uint32, expressions
 	data := models.IndexFindByTag{OrgId: orgId, Expr: expressions.Strings(), From: from}
 	newCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	responseChan, errorChan := s.queryAllShardsGeneric(newCtx, "clusterFindByTag",
+	// Only check if maxSeriesPerReq > 0 (meaning enabled) or soft-limited
+	checkSeriesLimit := maxSeriesPerReq > 0 || softLimit
+	errLimit := response.NewError(
+		http.StatusForbidden,
+		fmt.Sprintf("Request exceeds max-series-per-req limit (%d). Reduce the number of targets or ask your admin to increase the limit.", maxSeriesPerReq))
+
+	// the limit applies to the series of all peers together, as they are received
+	budget := newSeriesBudget(maxSeries)
+	// limited returns whether no more series need to be read after receiving the given total
+	limited := func(total int) bool {
+		if !checkSeriesLimit {
+			return false
+		}
+		if softLimit {
+			// we have all the series we can return
+			return total >= maxSeries
+		}
+		if total > maxSeries {
+			// the request gets rejected, so there's no point in waiting for the other peers
+			cancel()
+			return true
+		}
+		return false
+	}
+
+	responseChan, errorChan := s.queryAllShardsGeneric(newCtx, orgId, "clusterFindByTag",
 		func(reqCtx context.Context, peer cluster.Node, peerGroups map[int32][]cluster.Node) (interface{}, error) {
 			resp := models.IndexFindByTagResp{}
-			body, err := peer.PostRaw(reqCtx, "clusterFindByTag", "/index/find_by_tag", data)
-			if body == nil || err != nil {
+			stream, err := peer.PostStream(reqCtx, "clusterFindByTag", "/index/find_by_tag", data)
+			if stream == nil || err != nil {
 				return nil, err
 			}
-			err = msgp.Decode(body, &resp)
-			body.Close()
-			return resp, err
+			defer stream.Close()
+			if !stream.Streamed() {
+				err = msgp.Decode(stream, &resp)
+				if err == nil {
+					limited(budget.add(peer, len(resp.Metrics)))
+				}
+				return resp, err
+			}
+			for {
+				var node idx.Node
+				err = stream.Next(&node)
+				if err == io.EOF {
+					return resp, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				resp.Metrics = append(resp.Metrics, node)
+				if limited(budget.add(peer, 1)) {
+					return resp, nil
+				}
+			}
 		})
 
 	var allSeries []Series
@@ -1262,8 +1389,6 @@ func (s *Server) clusterFindByTag(ctx context.Context, orgId uint32, expressions
 	for r := range responseChan {
 		resp := r.resp.(models.IndexFindByTagResp)
 
-		// Only check if maxSeriesPerReq > 0 (meaning enabled) or soft-limited
-		checkSeriesLimit := maxSeriesPerReq > 0 || softLimit
 		if checkSeriesLimit && len(resp.Metrics)+len(allSeries) > maxSeries {
 			if softLimit {
 				remainingSpace := maxSeries - len(allSeries)
@@ -1277,10 +1402,7 @@ func (s *Server) clusterFindByTag(ctx context.Context, orgId uint32, expressions
 				}
 				return allSeries, nil
 			}
-			return nil,
-				response.NewError(
-					http.StatusForbidden,
-					fmt.Sprintf("Request exceeds max-series-per-req limit (%d). Reduce the number of targets or ask your admin to increase the limit.", maxSeriesPerReq))
+			return nil, errLimit
 		}
 
 		for _, series := range resp.Metrics {
@@ -1293,16 +1415,27 @@ func (s *Server) clusterFindByTag(ctx context.Context, orgId uint32, expressions
 	}
 
 	err := <-errorChan
+	if checkSeriesLimit && !softLimit && budget.exceeded() {
+		// the request was aborted as soon as the limit was exceeded
+		return nil, errLimit
+	}
 	return allSeries, err
 }
 
 func (s *Server) graphiteTags(ctx *middleware.Context, request models.GraphiteTags) {
 	reqCtx := ctx.Req.Context()
+	var federated <-chan []federationResult
+	if shouldFederate(ctx.Req.Request) {
+		federated = federateTags(reqCtx, ctx.OrgId, request)
+	}
 	tags, err := s.clusterTags(reqCtx, ctx.OrgId, request.Filter)
 	if err != nil {
 		response.Write(ctx, response.WrapError(err))
 		return
 	}
+	if federated != nil {
+		tags = mergeFederatedTags("/tags", tags, <-federated, decodeGraphiteTags)
+	}
 
 	select {
 	case <-reqCtx.Done():
@@ -1321,8 +1454,52 @@ func (s *Server) graphiteTags(ctx *middleware.Context, request models.GraphiteTa
 
 func (s *Server) clusterTags(ctx context.Context, orgId uint32, filter string) ([]string, error) {
 	data := models.IndexTags{OrgId: orgId, Filter: filter}
-	resps, err := s.queryAllShards(ctx, "clusterTags", fetchFuncPost(data, "clusterTags", "/index/tags"))
-	if err != nil {
+	newCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the tags are merged as they are received. a set union is not affected by
+	// replicas of the same shard group both returning (some of) their tags.
+	var mu sync.Mutex
+	tagSet := make(map[string]struct{})
+	add := func(tags []string) {
+		mu.Lock()
+		for _, tag := range tags {
+			tagSet[tag] = struct{}{}
+		}
+		mu.Unlock()
+	}
+
+	responseChan, errorChan := s.queryAllShardsGeneric(newCtx, orgId, "clusterTags",
+		func(reqCtx context.Context, peer cluster.Node, peerGroups map[int32][]cluster.Node) (interface{}, error) {
+			stream, err := peer.PostStream(reqCtx, "clusterTags", "/index/tags", data)
+			if stream == nil || err != nil {
+				return nil, err
+			}
+			defer stream.Close()
+			if !stream.Streamed() {
+				resp := models.IndexTagsResp{}
+				err = msgp.Decode(stream, &resp)
+				if err == nil {
+					add(resp.Tags)
+				}
+				return nil, err
+			}
+			for {
+				var tags models.StringList
+				err = stream.Next(&tags)
+				if err == io.EOF {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				add(tags)
+			}
+		})
+
+	for range responseChan {
+	}
+	if err := <-errorChan; err != nil {
 		return nil, err
 	}
 
@@ -1333,20 +1510,10 @@ func (s *Server) clusterTags(ctx context.Context, orgId uint32, filter string) (
 	default:
 	}
 
-	tagSet := make(map[string]struct{})
-	resp := models.IndexTagsResp{}
-	for _, r := range resps {
-		_, err = resp.UnmarshalMsg(r.buf)
-		if err != nil {
-			return nil, err
-		}
-		for _, tag := range resp.Tags {
-			tagSet[tag] = struct{}{}
-		}
-	}
-
 	// we want to make an empty list, because this results in the json response "[]" if it's empty
 	// if we initialize "tags" with "var tags []string" the json response (if empty) is "nil" instead of "[]"
+	mu.Lock()
+	defer mu.Unlock()
 	tags := make([]string, 0, len(tagSet))
 	for t := range tagSet {
 		tags = append(tags, t)
@@ -1360,11 +1527,21 @@ func (s *Server) graphiteAutoCompleteTags(ctx *middleware.Context, request model
 		request.Limit = tagdbDefaultLimit
 	}
 
+	var federated <-chan []federationResult
+	if shouldFederate(ctx.Req.Request) {
+		federated = federateAutoCompleteTags(ctx.Req.Context(), ctx.OrgId, request)
+	}
 	tags, err := s.clusterAutoCompleteTags(ctx.Req.Context(), ctx.OrgId, request.Prefix, request.Expr, request.Limit)
 	if err != nil {
 		response.Write(ctx, response.WrapErrorForTagDB(err))
 		return
 	}
+	if federated != nil {
+		tags = mergeFederatedTags("/tags/autoComplete/tags", tags, <-federated, nil)
+		if uint(len(tags)) > request.Limit {
+			tags = tags[:request.Limit]
+		}
+	}
 
 	response.Write(ctx, response.NewJson(200, tags, ""))
 }
@@ -1373,7 +1550,7 @@ func (s *Server) clusterAutoCompleteTags(ctx context.Context, orgId uint32, pref
 	tagSet := make(map[string]struct{})
 
 	data := models.IndexAutoCompleteTags{OrgId: orgId, Prefix: prefix, Expr: expressions, Limit: limit}
-	responses, err := s.queryAllShards(ctx, "clusterAutoCompleteTags", fetchFuncPost(data, "clusterAutoCompleteTags", "/index/tags/autoComplete/tags"))
+	responses, err := s.queryAllShards(ctx, orgId, "clusterAutoCompleteTags", fetchFuncPost(data, "clusterAutoCompleteTags", "/index/tags/autoComplete/tags"))
 	if err != nil {
 		return nil, err
 	}
@@ -1407,11 +1584,21 @@ func (s *Server) graphiteAutoCompleteTagValues(ctx *middleware.Context, request
 		request.Limit = tagdbDefaultLimit
 	}
 
+	var federated <-chan []federationResult
+	if shouldFederate(ctx.Req.Request) {
+		federated = federateAutoCompleteTagValues(ctx.Req.Context(), ctx.OrgId, request)
+	}
 	resp, err := s.clusterAutoCompleteTagValues(ctx.Req.Context(), ctx.OrgId, request.Tag, request.Prefix, request.Expr, request.Limit)
 	if err != nil {
 		response.Write(ctx, response.WrapErrorForTagDB(err))
 		return
 	}
+	if federated != nil {
+		resp = mergeFederatedTags("/tags/autoComplete/values", resp, <-federated, nil)
+		if uint(len(resp)) > request.Limit {
+			resp = resp[:request.Limit]
+		}
+	}
 
 	response.Write(ctx, response.NewJson(200, resp, ""))
 }
@@ -1420,7 +1607,7 @@ func (s *Server) clusterAutoCompleteTagValues(ctx context.Context, orgId uint32,
 	valSet := make(map[string]struct{})
 
 	data := models.IndexAutoCompleteTagValues{OrgId: orgId, Tag: tag, Prefix: prefix, Expr: expressions, Limit: limit}
-	responses, err := s.queryAllShards(ctx, "clusterAutoCompleteValues", fetchFuncPost(data, "clusterAutoCompleteValues", "/index/tags/autoComplete/values"))
+	responses, err := s.queryAllShards(ctx, orgId, "clusterAutoCompleteValues", fetchFuncPost(data, "clusterAutoCompleteValues", "/index/tags/autoComplete/values"))
 	if err != nil {
 		return nil, err
 	}
@@ -1451,7 +1638,7 @@ func (s *Server) clusterAutoCompleteTagValues(ctx context.Context, orgId uint32,
 
 func (s *Server) graphiteTagTerms(ctx *middleware.Context, request models.GraphiteTagTerms) {
 	data := models.IndexTagTerms{OrgId: ctx.OrgId, Tags: request.Tags, Expr: request.Expr, From: request.From, To: request.To}
-	responses, err := s.queryAllShards(ctx.Req.Context(), "graphiteTagTerms", fetchFuncPost(data, "graphiteTagTerms", "/index/tags/terms"))
+	responses, err := s.queryAllShards(ctx.Req.Context(), ctx.OrgId, "graphiteTagTerms", fetchFuncPost(data, "graphiteTagTerms", "/index/tags/terms"))
 	if err != nil {
 		response.Write(ctx, response.WrapErrorForTagDB(err))
 		return
@@ -1629,6 +1816,11 @@ func (s *Server) showPlan(ctx *middleware.Context, request models.GraphiteRender
 		response.Write(ctx, response.NewError(http.StatusBadRequest, err.Error()))
 		return
 	}
+	exprs, err = expr.ExpandMacros(exprs, s.macroGetter(ctx.OrgId))
+	if err != nil {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
 
 	stable := request.Process == "stable"
 	mdp := request.MaxDataPoints
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/grafana/metrictank/api/middleware"
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/api/response"
+	"github.com/grafana/metrictank/expr"
+	"github.com/grafana/metrictank/idx"
+)
+
+// macroGetter returns a getter for the macros of the given org, to expand
+// the macro() calls in queries
+func (s *Server) macroGetter(orgId uint32) expr.MacroGetter {
+	if s.Macros == nil {
+		return nil
+	}
+	return func(name string) (idx.Macro, bool) {
+		return s.Macros.MacroGet(orgId, name)
+	}
+}
+
+// parseMacro converts a macro from a request into an idx.Macro and validates its expression
+func parseMacro(req models.MacroUpsert) (idx.Macro, error) {
+	macro := idx.Macro{
+		Name:   req.Name,
+		Params: req.Params,
+		Expr:   req.Expr,
+	}
+	_, err := expr.ParseMacro(macro)
+	return macro, err
+}
+
+func (s *Server) getMacros(ctx *middleware.Context) {
+	if s.Macros == nil {
+		response.Write(ctx, response.NewError(http.StatusNotImplemented, "Macro support is not enabled"))
+		return
+	}
+
+	response.Write(ctx, response.NewJson(200, s.Macros.MacroList(ctx.OrgId), ""))
+}
+
+func (s *Server) macroUpsert(ctx *middleware.Context, req models.MacroUpsert) {
+	if s.Macros == nil {
+		response.Write(ctx, response.NewError(http.StatusNotImplemented, "Macro support is not enabled"))
+		return
+	}
+
+	macro, err := parseMacro(req)
+	if err != nil {
+		response.Write(ctx, response.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	err = s.Macros.MacroUpsert(ctx.OrgId, macro)
+	if err != nil {
+		response.Write(ctx, response.WrapError(err))
+		return
+	}
+
+	response.Write(ctx, response.NewJson(200, struct{ Status string }{Status: "OK"}, ""))
+}
+
+func (s *Server) macroDelete(ctx *middleware.Context, req models.MacroDelete) {
+	if s.Macros == nil {
+		response.Write(ctx, response.NewError(http.StatusNotImplemented, "Macro support is not enabled"))
+		return
+	}
+
+	err := s.Macros.MacroDelete(ctx.OrgId, req.Name)
+	if err != nil {
+		response.Write(ctx, response.WrapError(err))
+		return
+	}
+
+	response.Write(ctx, response.NewJson(200, struct{ Status string }{Status: "OK"}, ""))
+}
+
+func (s *Server) macroSwap(ctx *middleware.Context, req models.MacroSwap) {
+	if s.Macros == nil {
+		response.Write(ctx, response.NewError(http.StatusNotImplemented, "Macro support is not enabled"))
+		return
+	}
+
+	macros := make([]idx.Macro, len(req.Macros))
+	for i, rawMacro := range req.Macros {
+		var err error
+		macros[i], err = parseMacro(rawMacro)
+		if err != nil {
+			response.Write(ctx, response.Errorf(http.StatusBadRequest, "Error when parsing macro %d: %s", i, err))
+			return
+		}
+	}
+
+	err := s.Macros.MacroSwap(ctx.OrgId, macros)
+	if err != nil {
+		response.Write(ctx, response.WrapError(err))
+		return
+	}
+
+	response.Write(ctx, response.NewJson(200, struct{ Status string }{Status: "OK"}, ""))
+}
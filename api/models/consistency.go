@@ -0,0 +1,96 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/mdata"
+	opentracing "github.com/opentracing/opentracing-go"
+	traceLog "github.com/opentracing/opentracing-go/log"
+)
+
+// ConsistencyCheck requests a comparison of the data of series across the replicas of their partitions
+type ConsistencyCheck struct {
+	// org to sample series from
+	OrgId uint32 `json:"orgId" form:"orgId"`
+	// number of random series from the local index to check
+	Sample int `json:"sample" form:"sample"`
+	// ids of specific series to check
+	Keys []string `json:"keys" form:"keys"`
+	// range of the data to compare. defaults to -1h until -5min, as the most recent points may not have reached all replicas yet
+	From string `json:"from" form:"from"`
+	To   string `json:"to" form:"to"`
+	// save finished chunks that are missing from the store, from the replica with the most complete copy
+	Repair bool `json:"repair" form:"repair"`
+}
+
+type ConsistencyCheckResp struct {
+	From       uint32              `json:"from"`
+	To         uint32              `json:"to"`
+	Checked    int                 `json:"checked"`
+	Consistent int                 `json:"consistent"`
+	Divergent  []SeriesConsistency `json:"divergent"`
+	// errors querying the replicas, by peer name
+	Errors map[string]string `json:"errors"`
+}
+
+// SeriesConsistency describes how the data of a series diverges
+type SeriesConsistency struct {
+	Key       string `json:"key"`
+	Partition int32  `json:"partition"`
+	// digests of the data held in memory, by peer name
+	Replicas map[string]mdata.MetricDigest `json:"replicas"`
+	// replicas that don't have the series in memory
+	MissingOn []string `json:"missingOn"`
+	// t0's of chunks of which the points differ between replicas
+	DivergentChunks []uint32 `json:"divergentChunks"`
+	// t0's of finished chunks that are missing from the store
+	MissingChunks []uint32 `json:"missingChunks"`
+	// t0's of the missing chunks that were saved, and the replica that saved them
+	Repaired   []uint32 `json:"repaired"`
+	RepairedBy string   `json:"repairedBy"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ConsistencyDigest requests the digests of the in-memory data of series
+type ConsistencyDigest struct {
+	Keys []string `json:"keys" binding:"Required"`
+	From uint32   `json:"from" binding:"Required"`
+	To   uint32   `json:"to" binding:"Required"`
+}
+
+func (c ConsistencyDigest) Trace(span opentracing.Span) {
+	span.LogFields(
+		traceLog.Int("num_keys", len(c.Keys)),
+		traceLog.Int32("from", int32(c.From)),
+		traceLog.Int32("to", int32(c.To)),
+	)
+}
+
+func (c ConsistencyDigest) TraceDebug(span opentracing.Span) {
+	span.LogFields(traceLog.String("keys", fmt.Sprintf("%q", c.Keys)))
+}
+
+type ConsistencyDigestResp struct {
+	// digests by key. series that are not in memory are omitted
+	Digests map[string]mdata.MetricDigest `json:"digests"`
+}
+
+// ConsistencyRepair requests to save the given finished chunks of a series from memory to the store
+type ConsistencyRepair struct {
+	Key string   `json:"key" binding:"Required"`
+	T0s []uint32 `json:"t0s" binding:"Required"`
+}
+
+func (c ConsistencyRepair) Trace(span opentracing.Span) {
+	span.LogFields(
+		traceLog.String("key", c.Key),
+		traceLog.String("t0s", fmt.Sprintf("%v", c.T0s)),
+	)
+}
+
+func (c ConsistencyRepair) TraceDebug(span opentracing.Span) {
+}
+
+type ConsistencyRepairResp struct {
+	Saved []uint32 `json:"saved"`
+}
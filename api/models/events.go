@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	traceLog "github.com/opentracing/opentracing-go/log"
+)
+
+// EventTags are the tags of an event. Like graphite, we accept them
+// either as a list or as a single space separated string
+type EventTags []string
+
+func (t *EventTags) UnmarshalJSON(data []byte) error {
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err == nil {
+		*t = tags
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("tags must be a list of strings or a space separated string")
+	}
+	*t = strings.Fields(str)
+	return nil
+}
+
+type EventAdd struct {
+	What string    `json:"what" form:"what" binding:"Required"`
+	When int64     `json:"when" form:"when"` // defaults to now
+	Data string    `json:"data" form:"data"`
+	Tags EventTags `json:"tags" form:"tags"`
+}
+
+func (e EventAdd) Trace(span opentracing.Span) {
+	span.LogFields(
+		traceLog.String("what", e.What),
+		traceLog.Int64("when", e.When),
+		traceLog.String("tags", fmt.Sprintf("%q", []string(e.Tags))),
+	)
+}
+
+func (e EventAdd) TraceDebug(span opentracing.Span) {
+	span.LogFields(
+		traceLog.String("data", e.Data),
+	)
+}
+
+type EventsGetData struct {
+	FromTo
+	Tags string `json:"tags" form:"tags"` // space separated, only events which have all of them are returned
+}
+
+func (e EventsGetData) Trace(span opentracing.Span) {
+	span.LogFields(
+		traceLog.String("from", e.From),
+		traceLog.String("until", e.Until),
+		traceLog.String("to", e.To),
+		traceLog.String("tz", e.Tz),
+		traceLog.String("tags", e.Tags),
+	)
+}
+
+func (e EventsGetData) TraceDebug(span opentracing.Span) {
+}
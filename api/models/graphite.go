@@ -51,11 +51,34 @@ type GraphiteRender struct {
 	MaxDataPoints uint32   `json:"maxDataPoints" form:"maxDataPoints" binding:"Default(800)"`
 	Targets       []string `json:"target" form:"target"`
 	TargetsRails  []string `form:"target[]"` // # Rails/PHP/jQuery common practice format: ?target[]=path.1&target[]=path.2 -> like graphite, we allow this.
-	Format        string   `json:"format" form:"format" binding:"In(,json,csv,msgp,msgpack,pickle)"`
+	Format        string   `json:"format" form:"format" binding:"In(,json,csv,msgp,msgpack,pickle,png,svg,arrow)"`
 	NoProxy       bool     `json:"local" form:"local"` //this is set to true by graphite-web when it passes request to cluster servers
 	Meta          bool     `json:"meta" form:"meta"`   // request for meta data, which will be returned as long as the format is compatible (json) and we don't have to go via graphite
 	Process       string   `json:"process" form:"process" binding:"In(,none,stable,any);Default(stable)"`
 	Optimizations string   `json:"optimizations" form:"optimizations"`
+	GraphOptions
+}
+
+// GraphOptions are the options for rendering graphs (png and svg formats), named after those of graphite-web.
+// the options that are optional numbers or booleans are strings, so we can tell whether they were set.
+// see render.NewParams for the defaults
+type GraphOptions struct {
+	Width      int    `json:"width" form:"width"`
+	Height     int    `json:"height" form:"height"`
+	Title      string `json:"title" form:"title"`
+	VTitle     string `json:"vtitle" form:"vtitle"`
+	YMin       string `json:"yMin" form:"yMin"`
+	YMax       string `json:"yMax" form:"yMax"`
+	AreaMode   string `json:"areaMode" form:"areaMode" binding:"In(,none,first,all,stacked)"`
+	AreaAlpha  string `json:"areaAlpha" form:"areaAlpha"`
+	LineWidth  string `json:"lineWidth" form:"lineWidth"`
+	ColorList  string `json:"colorList" form:"colorList"`
+	BgColor    string `json:"bgcolor" form:"bgcolor"`
+	FgColor    string `json:"fgcolor" form:"fgcolor"`
+	HideLegend string `json:"hideLegend" form:"hideLegend"`
+	HideAxes   string `json:"hideAxes" form:"hideAxes"`
+	HideGrid   string `json:"hideGrid" form:"hideGrid"`
+	GraphOnly  string `json:"graphOnly" form:"graphOnly"`
 }
 
 func (gr GraphiteRender) Validate(ctx *macaron.Context, errs binding.Errors) binding.Errors {
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"sort"
 	"strconv"
 	"time"
 )
@@ -24,6 +25,7 @@ func (rwm ResponseWithMeta) MarshalJSONFast(b []byte) ([]byte, error) {
 type RenderMeta struct {
 	RenderStats
 	StorageStats
+	Federation FederationMeta // only set when the request was federated to remote clusters
 }
 
 func (rm RenderMeta) MarshalJSONFast(b []byte) ([]byte, error) {
@@ -34,6 +36,55 @@ func (rm RenderMeta) MarshalJSONFast(b []byte) ([]byte, error) {
 	b, _ = rm.RenderStats.MarshalJSONFastRaw(b)
 	b = append(b, ',')
 	b, _ = rm.StorageStats.MarshalJSONFastRaw(b)
+	b = append(b, '}')
+	if !rm.Federation.IsZero() {
+		b = append(b, `,"federation":`...)
+		b, _ = rm.Federation.MarshalJSONFast(b)
+	}
+	b = append(b, '}')
+	return b, nil
+}
+
+// FederationMeta describes which remote clusters contributed to a federated response.
+// the stats of the remote clusters are not included.
+type FederationMeta struct {
+	Clusters []string          // remote clusters whose results are included
+	Failed   map[string]string // remote clusters whose results are missing, with their error. if not empty, the response is partial
+}
+
+func (fm FederationMeta) IsZero() bool {
+	return len(fm.Clusters) == 0 && len(fm.Failed) == 0
+}
+
+// Partial returns whether results of remote clusters are missing
+func (fm FederationMeta) Partial() bool {
+	return len(fm.Failed) != 0
+}
+
+func (fm FederationMeta) MarshalJSONFast(b []byte) ([]byte, error) {
+	b = append(b, `{"partial":`...)
+	b = strconv.AppendBool(b, fm.Partial())
+	b = append(b, `,"clusters":[`...)
+	for i, c := range fm.Clusters {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendQuoteToASCII(b, c)
+	}
+	b = append(b, `],"failed":{`...)
+	names := make([]string, 0, len(fm.Failed))
+	for name := range fm.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendQuoteToASCII(b, name)
+		b = append(b, ':')
+		b = strconv.AppendQuoteToASCII(b, fm.Failed[name])
+	}
 	b = append(b, `}}`...)
 	return b, nil
 }
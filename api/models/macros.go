@@ -0,0 +1,51 @@
+package models
+
+import (
+	"fmt"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	traceLog "github.com/opentracing/opentracing-go/log"
+)
+
+type MacroUpsert struct {
+	Name   string   `json:"name" form:"name" binding:"Required"`
+	Params []string `json:"params" form:"params"`
+	Expr   string   `json:"expr" form:"expr" binding:"Required"`
+}
+
+func (m MacroUpsert) Trace(span opentracing.Span) {
+	span.LogFields(
+		traceLog.String("name", m.Name),
+		traceLog.String("params", fmt.Sprintf("%q", m.Params)),
+		traceLog.String("expr", m.Expr),
+	)
+}
+
+func (m MacroUpsert) TraceDebug(span opentracing.Span) {
+}
+
+type MacroDelete struct {
+	Name string `json:"name" form:"name" binding:"Required"`
+}
+
+func (m MacroDelete) Trace(span opentracing.Span) {
+	span.LogFields(
+		traceLog.String("name", m.Name),
+	)
+}
+
+func (m MacroDelete) TraceDebug(span opentracing.Span) {
+}
+
+type MacroSwap struct {
+	Macros []MacroUpsert `json:"macros"`
+}
+
+func (m MacroSwap) Trace(span opentracing.Span) {
+	span.LogFields(
+		traceLog.Uint32("macroCount", uint32(len(m.Macros))),
+	)
+}
+
+func (m MacroSwap) TraceDebug(span opentracing.Span) {
+}
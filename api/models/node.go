@@ -14,9 +14,10 @@ type NodeStatus struct {
 }
 
 type ClusterStatus struct {
-	ClusterName string         `json:"clusterName"`
-	NodeName    string         `json:"nodeName"`
-	Members     []cluster.Node `json:"members"`
+	ClusterName string                              `json:"clusterName"`
+	NodeName    string                              `json:"nodeName"`
+	Members     []cluster.Node                      `json:"members"`
+	PeerHealth  map[string]cluster.PeerHealthStatus `json:"peerHealth"`
 }
 
 type ClusterMembers struct {
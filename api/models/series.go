@@ -31,9 +31,28 @@ type Series struct {
 	QueryMDP     uint32                     // to tie series back to request it came from
 	QueryPNGroup PNGroup                    // to tie series back to request it came from
 	Meta         SeriesMeta                 // note: this series could be a "just fetched" series, or one derived from many other series
+	Style        SeriesStyle                // presentation hints set by styling functions. does not affect the data
 	Datapoints   []schema.Point
 }
 
+// SeriesStyle describes how a series should be drawn, as requested by graphite's
+// styling functions such as color(), lineWidth(), dashed(), stacked() and alpha().
+// they are used when rendering graphs (png and svg formats), and otherwise merely passed on to the client.
+// zero values mean the property was not set.
+type SeriesStyle struct {
+	Color          string  // set by color(), threshold() and verticalLine()
+	LineWidth      float64 // set by lineWidth()
+	Dashed         float64 // length of the dashes, set by dashed()
+	Alpha          float64 // transparency between 0 and 1, set by alpha()
+	Stacked        bool    // set by stacked()
+	DrawAsInfinite bool    // set by verticalLine()
+}
+
+// IsZero returns whether none of the style properties have been set
+func (s SeriesStyle) IsZero() bool {
+	return s == SeriesStyle{}
+}
+
 // SeriesMeta counts the number of series for each set of meta properties
 // note: it's illegal for SeriesMeta to include multiple entries that include the same properties
 type SeriesMeta []SeriesMetaProperties
@@ -227,6 +246,7 @@ func (s Series) Copy(emptyDatapoints []schema.Point) Series {
 		QueryMDP:     s.QueryMDP,
 		QueryPNGroup: s.QueryPNGroup,
 		Meta:         s.Meta.Copy(),
+		Style:        s.Style,
 	}
 }
 
@@ -288,6 +308,10 @@ func (series SeriesByTarget) MarshalJSONFast(b []byte) ([]byte, error) {
 			// Replace trailing comma with a closing bracket
 			b[len(b)-1] = '}'
 		}
+		if !s.Style.IsZero() {
+			b = append(b, `,"style":`...)
+			b, _ = s.Style.MarshalJSONFast(b)
+		}
 		b = append(b, `,"datapoints":[`...)
 		for _, p := range s.Datapoints {
 			b = append(b, '[')
@@ -327,6 +351,10 @@ func (series SeriesByTarget) MarshalJSONFastWithMeta(b []byte) ([]byte, error) {
 			// Replace trailing comma with a closing bracket
 			b[len(b)-1] = '}'
 		}
+		if !s.Style.IsZero() {
+			b = append(b, `,"style":`...)
+			b, _ = s.Style.MarshalJSONFast(b)
+		}
 		b = append(b, `,"datapoints":[`...)
 		for _, p := range s.Datapoints {
 			b = append(b, '[')
@@ -385,6 +413,44 @@ func (meta SeriesMeta) MarshalJSONFast(b []byte) ([]byte, error) {
 
 }
 
+// MarshalJSONFast marshals the properties that have been set, using graphite's option names
+func (style SeriesStyle) MarshalJSONFast(b []byte) ([]byte, error) {
+	b = append(b, '{')
+	if style.Color != "" {
+		b = append(b, `"color":`...)
+		b = strconv.AppendQuoteToASCII(b, style.Color)
+		b = append(b, ',')
+	}
+	if style.LineWidth != 0 {
+		b = append(b, `"lineWidth":`...)
+		b = strconv.AppendFloat(b, style.LineWidth, 'f', -1, 64)
+		b = append(b, ',')
+	}
+	if style.Dashed != 0 {
+		b = append(b, `"dashed":`...)
+		b = strconv.AppendFloat(b, style.Dashed, 'f', -1, 64)
+		b = append(b, ',')
+	}
+	if style.Alpha != 0 {
+		b = append(b, `"alpha":`...)
+		b = strconv.AppendFloat(b, style.Alpha, 'f', -1, 64)
+		b = append(b, ',')
+	}
+	if style.Stacked {
+		b = append(b, `"stacked":true,`...)
+	}
+	if style.DrawAsInfinite {
+		b = append(b, `"drawAsInfinite":true,`...)
+	}
+	if style.IsZero() {
+		b = append(b, '}')
+	} else {
+		// Replace trailing comma with a closing bracket
+		b[len(b)-1] = '}'
+	}
+	return b, nil
+}
+
 func (series SeriesByTarget) MarshalJSON() ([]byte, error) {
 	return series.MarshalJSONFast(nil)
 }
@@ -482,3 +548,19 @@ func (series SeriesByTarget) Csv(buf []byte) ([]byte, error) {
 	}
 	return buffer.Bytes(), nil
 }
+
+// ArrowSeries writes the series for render&format=arrow
+func (series SeriesByTarget) ArrowSeries(write func(target string, tags map[string]string, interval uint32, ts []uint32, vals []float64) error) error {
+	for _, serie := range series {
+		ts := make([]uint32, len(serie.Datapoints))
+		vals := make([]float64, len(serie.Datapoints))
+		for i, point := range serie.Datapoints {
+			ts[i] = point.Ts
+			vals[i] = point.Val
+		}
+		if err := write(serie.Target, serie.Tags, serie.Interval, ts, vals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
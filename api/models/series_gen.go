@@ -824,3 +824,231 @@ func (z *SeriesMetaProperties) Msgsize() (s int) {
 	s = 1 + 9 + msgp.Uint16Size + 8 + msgp.Uint8Size + 13 + msgp.Uint32Size + 11 + msgp.Uint32Size + 9 + msgp.Uint32Size + 22 + z.ConsolidatorNormFetch.Msgsize() + 15 + z.ConsolidatorRC.Msgsize() + 6 + msgp.Uint32Size
 	return
 }
+
+// DecodeMsg implements msgp.Decodable
+func (z *SeriesStyle) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Color":
+			z.Color, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Color")
+				return
+			}
+		case "LineWidth":
+			z.LineWidth, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "LineWidth")
+				return
+			}
+		case "Dashed":
+			z.Dashed, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Dashed")
+				return
+			}
+		case "Alpha":
+			z.Alpha, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Alpha")
+				return
+			}
+		case "Stacked":
+			z.Stacked, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "Stacked")
+				return
+			}
+		case "DrawAsInfinite":
+			z.DrawAsInfinite, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "DrawAsInfinite")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *SeriesStyle) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 6
+	// write "Color"
+	err = en.Append(0x86, 0xa5, 0x43, 0x6f, 0x6c, 0x6f, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Color)
+	if err != nil {
+		err = msgp.WrapError(err, "Color")
+		return
+	}
+	// write "LineWidth"
+	err = en.Append(0xa9, 0x4c, 0x69, 0x6e, 0x65, 0x57, 0x69, 0x64, 0x74, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.LineWidth)
+	if err != nil {
+		err = msgp.WrapError(err, "LineWidth")
+		return
+	}
+	// write "Dashed"
+	err = en.Append(0xa6, 0x44, 0x61, 0x73, 0x68, 0x65, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Dashed)
+	if err != nil {
+		err = msgp.WrapError(err, "Dashed")
+		return
+	}
+	// write "Alpha"
+	err = en.Append(0xa5, 0x41, 0x6c, 0x70, 0x68, 0x61)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Alpha)
+	if err != nil {
+		err = msgp.WrapError(err, "Alpha")
+		return
+	}
+	// write "Stacked"
+	err = en.Append(0xa7, 0x53, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.Stacked)
+	if err != nil {
+		err = msgp.WrapError(err, "Stacked")
+		return
+	}
+	// write "DrawAsInfinite"
+	err = en.Append(0xae, 0x44, 0x72, 0x61, 0x77, 0x41, 0x73, 0x49, 0x6e, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.DrawAsInfinite)
+	if err != nil {
+		err = msgp.WrapError(err, "DrawAsInfinite")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *SeriesStyle) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 6
+	// string "Color"
+	o = append(o, 0x86, 0xa5, 0x43, 0x6f, 0x6c, 0x6f, 0x72)
+	o = msgp.AppendString(o, z.Color)
+	// string "LineWidth"
+	o = append(o, 0xa9, 0x4c, 0x69, 0x6e, 0x65, 0x57, 0x69, 0x64, 0x74, 0x68)
+	o = msgp.AppendFloat64(o, z.LineWidth)
+	// string "Dashed"
+	o = append(o, 0xa6, 0x44, 0x61, 0x73, 0x68, 0x65, 0x64)
+	o = msgp.AppendFloat64(o, z.Dashed)
+	// string "Alpha"
+	o = append(o, 0xa5, 0x41, 0x6c, 0x70, 0x68, 0x61)
+	o = msgp.AppendFloat64(o, z.Alpha)
+	// string "Stacked"
+	o = append(o, 0xa7, 0x53, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x64)
+	o = msgp.AppendBool(o, z.Stacked)
+	// string "DrawAsInfinite"
+	o = append(o, 0xae, 0x44, 0x72, 0x61, 0x77, 0x41, 0x73, 0x49, 0x6e, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x65)
+	o = msgp.AppendBool(o, z.DrawAsInfinite)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *SeriesStyle) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Color":
+			z.Color, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Color")
+				return
+			}
+		case "LineWidth":
+			z.LineWidth, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "LineWidth")
+				return
+			}
+		case "Dashed":
+			z.Dashed, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Dashed")
+				return
+			}
+		case "Alpha":
+			z.Alpha, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Alpha")
+				return
+			}
+		case "Stacked":
+			z.Stacked, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Stacked")
+				return
+			}
+		case "DrawAsInfinite":
+			z.DrawAsInfinite, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "DrawAsInfinite")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SeriesStyle) Msgsize() (s int) {
+	s = 1 + 6 + msgp.StringPrefixSize + len(z.Color) + 10 + msgp.Float64Size + 7 + msgp.Float64Size + 6 + msgp.Float64Size + 8 + msgp.BoolSize + 15 + msgp.BoolSize
+	return
+}
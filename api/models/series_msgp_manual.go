@@ -125,6 +125,12 @@ func (z *Series) DecodeMsg(dc *msgp.Reader) (err error) {
 					return
 				}
 			}
+		case "Style":
+			err = z.Style.DecodeMsg(dc)
+			if err != nil {
+				err = msgp.WrapError(err, "Style")
+				return
+			}
 		case "Datapoints":
 			var zb0004 uint32
 			zb0004, err = dc.ReadArrayHeader()
@@ -157,9 +163,9 @@ func (z *Series) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Series) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 12
+	// map header, size 13
 	// write "Target"
-	err = en.Append(0x8c, 0xa6, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74)
+	err = en.Append(0x8d, 0xa6, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74)
 	if err != nil {
 		return
 	}
@@ -287,6 +293,16 @@ func (z *Series) EncodeMsg(en *msgp.Writer) (err error) {
 			return
 		}
 	}
+	// write "Style"
+	err = en.Append(0xa5, 0x53, 0x74, 0x79, 0x6c, 0x65)
+	if err != nil {
+		return
+	}
+	err = z.Style.EncodeMsg(en)
+	if err != nil {
+		err = msgp.WrapError(err, "Style")
+		return
+	}
 	// write "Datapoints"
 	err = en.Append(0xaa, 0x44, 0x61, 0x74, 0x61, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x73)
 	if err != nil {
@@ -310,9 +326,9 @@ func (z *Series) EncodeMsg(en *msgp.Writer) (err error) {
 // MarshalMsg implements msgp.Marshaler
 func (z *Series) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 12
+	// map header, size 13
 	// string "Target"
-	o = append(o, 0x8c, 0xa6, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74)
+	o = append(o, 0x8d, 0xa6, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74)
 	o = msgp.AppendString(o, z.Target)
 	// string "Tags"
 	o = append(o, 0xa4, 0x54, 0x61, 0x67, 0x73)
@@ -367,6 +383,13 @@ func (z *Series) MarshalMsg(b []byte) (o []byte, err error) {
 			return
 		}
 	}
+	// string "Style"
+	o = append(o, 0xa5, 0x53, 0x74, 0x79, 0x6c, 0x65)
+	o, err = z.Style.MarshalMsg(o)
+	if err != nil {
+		err = msgp.WrapError(err, "Style")
+		return
+	}
 	// string "Datapoints"
 	o = append(o, 0xaa, 0x44, 0x61, 0x74, 0x61, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x73)
 	o = msgp.AppendArrayHeader(o, uint32(len(z.Datapoints)))
@@ -501,6 +524,12 @@ func (z *Series) UnmarshalMsg(bts []byte) (o []byte, err error) {
 					return
 				}
 			}
+		case "Style":
+			bts, err = z.Style.UnmarshalMsg(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Style")
+				return
+			}
 		case "Datapoints":
 			var zb0004 uint32
 			zb0004, bts, err = msgp.ReadArrayHeaderBytes(bts)
@@ -545,7 +574,7 @@ func (z *Series) Msgsize() (s int) {
 	for za0003 := range z.Meta {
 		s += z.Meta[za0003].Msgsize()
 	}
-	s += 11 + msgp.ArrayHeaderSize
+	s += 6 + z.Style.Msgsize() + 11 + msgp.ArrayHeaderSize
 	for za0004 := range z.Datapoints {
 		s += z.Datapoints[za0004].Msgsize()
 	}
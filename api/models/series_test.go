@@ -79,6 +79,25 @@ func TestJsonMarshal(t *testing.T) {
 			},
 			out: `[{"target":"a","datapoints":[[123,60],[10000,120],[0,180],[1,240]]},{"target":"foo(bar)","datapoints":[[123.456,10],[123.7,20],[124.1001,30],[125,40],[126,50]]}]`,
 		},
+		{
+			in: []Series{
+				{
+					Target: "a",
+					Style: SeriesStyle{
+						Color:     "red",
+						LineWidth: 2,
+						Dashed:    5,
+						Alpha:     0.5,
+						Stacked:   true,
+					},
+					Datapoints: []schema.Point{
+						{Val: 1, Ts: 60},
+					},
+					Interval: 60,
+				},
+			},
+			out: `[{"target":"a","style":{"color":"red","lineWidth":2,"dashed":5,"alpha":0.5,"stacked":true},"datapoints":[[1,60]]}]`,
+		},
 	}
 
 	for _, c := range cases {
@@ -0,0 +1,447 @@
+// Package render draws graphs of series as png or svg images, like graphite-web's render api does
+package render
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type point struct {
+	x, y float64
+}
+
+type anchor uint8
+
+const (
+	anchorStart anchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+// canvas is what graphs are drawn on. coordinates are in pixels, from the top left corner
+type canvas interface {
+	// clip restricts all further drawing to the given rectangle
+	clip(x, y, w, h float64)
+	unclip()
+	rect(x, y, w, h float64, c color.NRGBA)
+	// polyline draws a line through the points. a single point is drawn as a dot.
+	// if dash is not zero, the line is dashed with dashes and gaps of that length
+	polyline(points []point, c color.NRGBA, width, dash float64)
+	polygon(points []point, c color.NRGBA)
+	// text draws a line of text, of which y is the top
+	text(x, y float64, s string, c color.NRGBA, a anchor)
+	// vtext draws a line of text rotated counterclockwise, centered on x,y
+	vtext(x, y float64, s string, c color.NRGBA)
+}
+
+// maxCoord limits how far outside of the image we draw, for points with extreme values
+const maxCoord = 1e6
+
+// maxLineWidth is the widest line we draw, in pixels
+const maxLineWidth = 100
+
+// graphSeries is a series as it will be drawn
+type graphSeries struct {
+	name      string
+	color     color.NRGBA
+	lineWidth float64
+	dash      float64
+	fill      bool
+	infinite  bool
+	ts        []uint32
+	top       []float64 // values, after stacking. NaN for gaps
+	base      []float64 // lower bound of the area to fill. NaN to fill until the x axis
+}
+
+// Graph is a graph of series, that can be rendered as png or svg
+type Graph struct {
+	params Params
+	series []graphSeries
+}
+
+// NewGraph creates a graph of the given series, which are not retained.
+func NewGraph(series []models.Series, params Params) *Graph {
+	g := &Graph{
+		params: params,
+		series: make([]graphSeries, 0, len(series)),
+	}
+	stackTotals := make(map[uint32]float64)
+	for i, s := range series {
+		gs := graphSeries{
+			name:      s.Target,
+			color:     params.Colors[i%len(params.Colors)],
+			lineWidth: params.LineWidth,
+			dash:      s.Style.Dashed,
+			infinite:  s.Style.DrawAsInfinite,
+			ts:        make([]uint32, len(s.Datapoints)),
+			top:       make([]float64, len(s.Datapoints)),
+		}
+		if s.Style.Color != "" {
+			if c, err := parseColor(s.Style.Color); err == nil {
+				gs.color = c
+			}
+		}
+		if s.Style.LineWidth > 0 {
+			gs.lineWidth = math.Min(s.Style.LineWidth, maxLineWidth)
+		}
+		if s.Style.Alpha > 0 {
+			gs.color.A = uint8(float64(gs.color.A) * math.Min(s.Style.Alpha, 1))
+		}
+		stacked := !gs.infinite && (params.AreaMode == "stacked" || s.Style.Stacked)
+		gs.fill = !gs.infinite && (stacked || params.AreaMode == "all" || (params.AreaMode == "first" && i == 0))
+		if stacked {
+			gs.base = make([]float64, len(s.Datapoints))
+		}
+		for j, p := range s.Datapoints {
+			gs.ts[j] = p.Ts
+			gs.top[j] = p.Val
+			if stacked {
+				gs.base[j] = stackTotals[p.Ts]
+				if !math.IsNaN(p.Val) {
+					gs.top[j] = gs.base[j] + p.Val
+					stackTotals[p.Ts] = gs.top[j]
+				}
+			}
+		}
+		g.series = append(g.series, gs)
+	}
+	return g
+}
+
+// dataRange returns the min and max value to draw. ok is false if there are none
+func (g *Graph) dataRange() (min, max float64, ok bool) {
+	min, max = math.Inf(1), math.Inf(-1)
+	for _, s := range g.series {
+		if s.infinite {
+			continue
+		}
+		for j, v := range s.top {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+			if s.base != nil {
+				min = math.Min(min, s.base[j])
+			}
+		}
+	}
+	return min, max, !math.IsInf(min, 1)
+}
+
+// yAxis returns the range of the y axis and the values at which to draw ticks
+func (g *Graph) yAxis(numTicks int) (float64, float64, []float64, float64) {
+	p := g.params
+	min, max, ok := g.dataRange()
+	if !ok {
+		min, max = 0, 1
+	}
+	if p.AreaMode != "none" && min > 0 {
+		min = 0
+	}
+	if !math.IsNaN(p.YMin) {
+		min = p.YMin
+	}
+	if !math.IsNaN(p.YMax) {
+		max = p.YMax
+	}
+	if max < min {
+		// only one of yMin and yMax is set, and it is beyond the data
+		if math.IsNaN(p.YMin) {
+			min = max - 1
+		} else {
+			max = min + 1
+		}
+	}
+	if min == max {
+		if min == 0 {
+			max = 1
+		} else {
+			min, max = min-math.Abs(min)/2, max+math.Abs(max)/2
+		}
+	}
+
+	step := niceStep((max - min) / float64(numTicks))
+	if math.IsNaN(p.YMin) {
+		min = math.Floor(min/step) * step
+	}
+	if math.IsNaN(p.YMax) {
+		max = math.Ceil(max/step) * step
+	}
+	var ticks []float64
+	for v := math.Ceil(min/step) * step; v <= max+step/1e6; v += step {
+		ticks = append(ticks, v)
+	}
+	return min, max, ticks, step
+}
+
+// niceStep returns the smallest step of the form 1, 2, 2.5 or 5 * 10^n that is at least the given step
+func niceStep(step float64) float64 {
+	if step <= 0 || math.IsNaN(step) || math.IsInf(step, 0) {
+		return 1
+	}
+	mag := math.Pow(10, math.Floor(math.Log10(step)))
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if m*mag >= step*(1-1e-9) {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// formatValue formats a value of the y axis with an SI prefix, and enough decimals to tell apart the ticks
+func formatValue(v, step, absMax float64) string {
+	unit, suffix := 1.0, ""
+	switch {
+	case absMax >= 1e12:
+		unit, suffix = 1e12, "T"
+	case absMax >= 1e9:
+		unit, suffix = 1e9, "G"
+	case absMax >= 1e6:
+		unit, suffix = 1e6, "M"
+	case absMax >= 1e3:
+		unit, suffix = 1e3, "K"
+	}
+	scaled := step / unit
+	decimals := 0
+	for decimals < 10 && math.Abs(scaled*math.Pow(10, float64(decimals))-math.Round(scaled*math.Pow(10, float64(decimals)))) > 1e-6 {
+		decimals++
+	}
+	if math.Abs(v) < step/1e6 {
+		v = 0 // avoid -0 and rounding errors
+	}
+	return strconv.FormatFloat(v/unit, 'f', decimals, 64) + suffix
+}
+
+// time steps for the x axis, in seconds
+var timeSteps = []uint32{
+	1, 2, 5, 10, 15, 30,
+	60, 2 * 60, 5 * 60, 10 * 60, 15 * 60, 30 * 60,
+	3600, 2 * 3600, 3 * 3600, 6 * 3600, 12 * 3600,
+	86400, 2 * 86400, 4 * 86400, 7 * 86400, 14 * 86400, 28 * 86400, 91 * 86400, 364 * 86400,
+}
+
+// xAxis returns the timestamps at which to draw ticks on the x axis, and the format of their labels,
+// such that they fit within the given width
+func (g *Graph) xAxis(width float64) ([]uint32, string) {
+	from, to := g.params.From, g.params.To
+	span := to - from
+	var step uint32
+	var format string
+	for _, step = range timeSteps {
+		switch {
+		case step < 60:
+			format = "15:04:05"
+		case step < 86400 && span <= 86400:
+			format = "15:04"
+		case step < 86400:
+			format = "01/02 15:04"
+		default:
+			format = "01/02"
+		}
+		labelWidth := textWidth(format) + 3*charWidth
+		if float64(span/step)*labelWidth <= width {
+			break
+		}
+	}
+	// align the ticks to the step in local time
+	_, offset := time.Unix(int64(from), 0).In(g.params.Location).Zone()
+	first := (int64(from)+int64(offset)+int64(step)-1)/int64(step)*int64(step) - int64(offset)
+	var ticks []uint32
+	for ts := first; ts <= int64(to); ts += int64(step) {
+		ticks = append(ticks, uint32(ts))
+	}
+	return ticks, format
+}
+
+// legendLayout returns the rows of the legend: the indices of the series in each row
+func (g *Graph) legendLayout(width float64) [][]int {
+	var rows [][]int
+	var row []int
+	x := 0.0
+	for i, s := range g.series {
+		w := legendEntryWidth(s.name)
+		if len(row) > 0 && x+w > width {
+			rows = append(rows, row)
+			row, x = nil, 0
+		}
+		row = append(row, i)
+		x += w
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func legendEntryWidth(name string) float64 {
+	return charHeight + 4 + textWidth(name) + 2*charWidth
+}
+
+// draw draws the graph on the canvas
+func (g *Graph) draw(c canvas) {
+	p := g.params
+	width, height := float64(p.Width), float64(p.Height)
+	c.rect(0, 0, width, height, p.BgColor)
+
+	margin := 10.0
+	if p.GraphOnly {
+		margin = 0
+	}
+	left, top, right, bottom := margin, margin, width-margin, height-margin
+	showAxes := !p.GraphOnly && !p.HideAxes
+
+	if p.Title != "" && !p.GraphOnly {
+		c.text(width/2, top, p.Title, p.FgColor, anchorMiddle)
+		top += charHeight + 4
+	}
+
+	showLegend := !p.GraphOnly && (p.Legend == legendShow || (p.Legend == legendAuto && len(g.series) <= maxAutoLegendSeries))
+	if showLegend && len(g.series) > 0 {
+		rows := g.legendLayout(right - left)
+		legendHeight := float64(len(rows)) * (charHeight + 2)
+		if p.Legend == legendShow || legendHeight <= (bottom-top)/2 {
+			bottom -= legendHeight + 4
+			for r, row := range rows {
+				y := bottom + 4 + float64(r)*(charHeight+2)
+				x := left
+				for _, i := range row {
+					s := g.series[i]
+					c.rect(x, y+1, charHeight-2, charHeight-2, s.color)
+					c.text(x+charHeight+2, y, s.name, p.FgColor, anchorStart)
+					x += legendEntryWidth(s.name)
+				}
+			}
+		}
+	}
+
+	if showAxes {
+		bottom -= charHeight + 4
+		if p.VTitle != "" {
+			c.vtext(left+charHeight/2, (top+bottom)/2, p.VTitle, p.FgColor)
+			left += charHeight + 4
+		}
+	}
+
+	numTicks := int(math.Max(1, math.Min(5, (bottom-top)/(3*charHeight))))
+	yMin, yMax, yTicks, yStep := g.yAxis(numTicks)
+	absMax := math.Max(math.Abs(yMin), math.Abs(yMax))
+	yLabels := make([]string, len(yTicks))
+	if showAxes {
+		labelWidth := 0.0
+		for i, v := range yTicks {
+			yLabels[i] = formatValue(v, yStep, absMax)
+			labelWidth = math.Max(labelWidth, textWidth(yLabels[i]))
+		}
+		left += labelWidth + 4
+		right -= charWidth * 2 // room for the last x axis label
+	}
+	if right-left < 1 || bottom-top < 1 {
+		return
+	}
+
+	from, to := float64(p.From), float64(p.To)
+	xOf := func(ts uint32) float64 {
+		return left + (float64(ts)-from)/(to-from)*(right-left)
+	}
+	yOf := func(v float64) float64 {
+		y := bottom - (v-yMin)/(yMax-yMin)*(bottom-top)
+		return math.Max(-maxCoord, math.Min(maxCoord, y))
+	}
+
+	xTicks, xFormat := g.xAxis(right - left)
+	gridColor := p.FgColor
+	gridColor.A /= 4
+	if !p.HideGrid && !p.GraphOnly {
+		for _, v := range yTicks {
+			c.polyline([]point{{left, yOf(v)}, {right, yOf(v)}}, gridColor, 1, 0)
+		}
+		for _, ts := range xTicks {
+			c.polyline([]point{{xOf(ts), top}, {xOf(ts), bottom}}, gridColor, 1, 0)
+		}
+	}
+	if showAxes {
+		for i, v := range yTicks {
+			c.text(left-4, yOf(v)-charHeight/2, yLabels[i], p.FgColor, anchorEnd)
+		}
+		for _, ts := range xTicks {
+			label := time.Unix(int64(ts), 0).In(p.Location).Format(xFormat)
+			c.text(xOf(ts), bottom+4, label, p.FgColor, anchorMiddle)
+		}
+	}
+
+	c.clip(left, top, right-left, bottom-top)
+	axisBase := math.Max(yMin, math.Min(yMax, 0))
+	for _, s := range g.series {
+		if !s.fill {
+			continue
+		}
+		fillColor := s.color
+		if !math.IsNaN(p.AreaAlpha) {
+			fillColor.A = uint8(float64(fillColor.A) * p.AreaAlpha)
+		}
+		for _, run := range runs(s.top) {
+			poly := make([]point, 0, 2*(run[1]-run[0]))
+			for j := run[0]; j < run[1]; j++ {
+				poly = append(poly, point{xOf(s.ts[j]), yOf(s.top[j])})
+			}
+			for j := run[1] - 1; j >= run[0]; j-- {
+				base := axisBase
+				if s.base != nil {
+					base = s.base[j]
+				}
+				poly = append(poly, point{xOf(s.ts[j]), yOf(base)})
+			}
+			c.polygon(poly, fillColor)
+		}
+	}
+	for _, s := range g.series {
+		if s.infinite {
+			for j, v := range s.top {
+				if !math.IsNaN(v) && v != 0 {
+					x := xOf(s.ts[j])
+					c.polyline([]point{{x, top}, {x, bottom}}, s.color, s.lineWidth, s.dash)
+				}
+			}
+			continue
+		}
+		for _, run := range runs(s.top) {
+			line := make([]point, 0, run[1]-run[0])
+			for j := run[0]; j < run[1]; j++ {
+				line = append(line, point{xOf(s.ts[j]), yOf(s.top[j])})
+			}
+			c.polyline(line, s.color, s.lineWidth, s.dash)
+		}
+	}
+	c.unclip()
+
+	if showAxes {
+		c.polyline([]point{{left, top}, {left, bottom}, {right, bottom}}, p.FgColor, 1, 0)
+	}
+}
+
+// runs returns the start (inclusive) and end (exclusive) indices of the runs of values that are not NaN
+func runs(vals []float64) [][2]int {
+	var out [][2]int
+	start := -1
+	for i, v := range vals {
+		if math.IsNaN(v) {
+			if start >= 0 {
+				out = append(out, [2]int{start, i})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		out = append(out, [2]int{start, len(vals)})
+	}
+	return out
+}
@@ -0,0 +1,256 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+func testSeries() []models.Series {
+	var series []models.Series
+	for i, target := range []string{"a", "b"} {
+		s := models.Series{Target: target, Interval: 60}
+		for ts := uint32(60); ts <= 3600; ts += 60 {
+			v := float64(ts) * float64(i+1)
+			if ts == 1800 {
+				v = math.NaN()
+			}
+			s.Datapoints = append(s.Datapoints, schema.Point{Val: v, Ts: ts})
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+func testParams(t *testing.T, opts models.GraphOptions) Params {
+	p, err := NewParams(opts, 0, 3600, time.UTC)
+	if err != nil {
+		t.Fatalf("failed to create params: %s", err)
+	}
+	return p
+}
+
+func TestPNG(t *testing.T) {
+	for _, areaMode := range []string{"", "first", "all", "stacked"} {
+		p := testParams(t, models.GraphOptions{Width: 200, Height: 100, Title: "title", AreaMode: areaMode, ColorList: "ff0000,00ff00"})
+		buf, err := NewGraph(testSeries(), p).PNG(nil)
+		if err != nil {
+			t.Fatalf("areaMode %q: failed to render png: %s", areaMode, err)
+		}
+		img, err := png.Decode(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("areaMode %q: failed to decode png: %s", areaMode, err)
+		}
+		if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 100 {
+			t.Fatalf("areaMode %q: expected 200x100 image, got %v", areaMode, b)
+		}
+		found := make(map[color.NRGBA]bool)
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				found[color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)] = true
+			}
+		}
+		for _, c := range []color.NRGBA{{0, 0, 0, 255}, {255, 0, 0, 255}, {0, 255, 0, 255}} {
+			if !found[c] {
+				t.Fatalf("areaMode %q: expected color %v in the image", areaMode, c)
+			}
+		}
+	}
+}
+
+// a tiny dash length must not result in a segment per fraction of a pixel
+func TestPNGTinyDash(t *testing.T) {
+	series := testSeries()
+	for i := range series {
+		series[i].Style.Dashed = 0.000001
+	}
+	p := testParams(t, models.GraphOptions{Width: 200, Height: 100})
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewGraph(series, p).PNG(nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failed to render png: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("rendering a png with a tiny dash length did not finish in time")
+	}
+	segments := dashSegments([]point{{0, 0}, {100, 0}}, 0.000001, [2]point{{-10, -10}, {110, 10}})
+	if len(segments) != 50 {
+		t.Fatalf("expected 50 segments of 1px, got %d", len(segments))
+	}
+}
+
+// only the parts of a dashed line that are on the canvas must result in segments,
+// and lines with many points get longer dashes
+func TestDashSegmentsClipped(t *testing.T) {
+	clip := [2]point{{-2, -2}, {102, 102}}
+	segments := dashSegments([]point{{50, -1e6}, {50, 1e6}}, 1, clip)
+	if len(segments) != 52 {
+		t.Fatalf("expected 52 segments of 1px for the visible 104px, got %d", len(segments))
+	}
+	for _, s := range segments {
+		for _, p := range s {
+			if p.y < clip[0].y || p.y > clip[1].y {
+				t.Fatalf("expected segments within the clip rectangle, got %v", s)
+			}
+		}
+	}
+	// the dash pattern continues across the clipped part: the line restarts 1e6 + 104px further
+	segments = dashSegments([]point{{50, -1e6}, {50, 1e6}, {50, 1e6 + 1}, {50, -1e6 - 1}}, 1, clip)
+	if len(segments) != 104 {
+		t.Fatalf("expected 104 segments of 1px for the line crossing the canvas twice, got %d", len(segments))
+	}
+	if math.Abs(segments[52][0].y-102) > 1e-6 || math.Abs(segments[52][1].y-101) > 1e-6 {
+		t.Fatalf("expected the second crossing to start with a dash at the edge, got %v", segments[52])
+	}
+
+	zigzag := make([]point, 20000)
+	for i := range zigzag {
+		zigzag[i] = point{float64(i) / 200, float64(i%2) * 100}
+	}
+	segments = dashSegments(zigzag, 1, clip)
+	if len(segments) > maxDashes+len(zigzag) {
+		t.Fatalf("expected at most %d segments, got %d", maxDashes+len(zigzag), len(segments))
+	}
+
+	segments = dashSegments([]point{{-1e6, -1e6}, {-1e6, 1e6}}, 0, clip)
+	if len(segments) != 0 {
+		t.Fatalf("expected no segments for a line outside of the canvas, got %v", segments)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	p := testParams(t, models.GraphOptions{Title: "<title>", AreaMode: "stacked", HideLegend: "false"})
+	buf, err := NewGraph(testSeries(), p).SVG(nil)
+	if err != nil {
+		t.Fatalf("failed to render svg: %s", err)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(buf))
+	var texts []string
+	paths := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local == "path" {
+				paths++
+			}
+		case xml.CharData:
+			if s := strings.TrimSpace(string(tok)); s != "" {
+				texts = append(texts, s)
+			}
+		}
+	}
+	if paths == 0 {
+		t.Fatalf("expected paths in svg, got %s", buf)
+	}
+	for _, exp := range []string{"<title>", "a", "b"} {
+		found := false
+		for _, text := range texts {
+			found = found || text == exp
+		}
+		if !found {
+			t.Fatalf("expected text %q in svg, got %v", exp, texts)
+		}
+	}
+}
+
+func TestNewParams(t *testing.T) {
+	p := testParams(t, models.GraphOptions{})
+	if p.Width != 330 || p.Height != 250 || p.AreaMode != "none" || !math.IsNaN(p.YMin) || len(p.Colors) != 12 {
+		t.Fatalf("unexpected defaults %+v", p)
+	}
+	cases := []models.GraphOptions{
+		{Width: maxSize + 1},
+		{Height: -1},
+		{YMin: "foo"},
+		{YMin: "10", YMax: "5"},
+		{AreaAlpha: "2"},
+		{LineWidth: "0"},
+		{ColorList: "red,nocolor"},
+		{BgColor: "12345"},
+		{HideLegend: "maybe"},
+	}
+	for _, opts := range cases {
+		if _, err := NewParams(opts, 0, 3600, time.UTC); err == nil {
+			t.Fatalf("expected error for %+v", opts)
+		}
+	}
+	if _, err := NewParams(models.GraphOptions{}, 3600, 3600, time.UTC); err == nil {
+		t.Fatal("expected error for empty time range")
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	cases := []struct {
+		in  string
+		exp color.NRGBA
+	}{
+		{"red", color.NRGBA{200, 0, 50, 255}},
+		{"DarkGrey", color.NRGBA{111, 111, 111, 255}},
+		{"ff8000", color.NRGBA{255, 128, 0, 255}},
+		{"#ff800080", color.NRGBA{255, 128, 0, 128}},
+	}
+	for _, c := range cases {
+		got, err := parseColor(c.in)
+		if err != nil || got != c.exp {
+			t.Fatalf("parseColor(%q): expected %v, got %v (err %v)", c.in, c.exp, got, err)
+		}
+	}
+}
+
+func TestYAxis(t *testing.T) {
+	cases := []struct {
+		step float64
+		exp  float64
+	}{
+		{0.07, 0.1},
+		{1, 1},
+		{1.5, 2},
+		{2.2, 2.5},
+		{30, 50},
+		{600, 1000},
+	}
+	for _, c := range cases {
+		if got := niceStep(c.step); math.Abs(got-c.exp) > 1e-9 {
+			t.Fatalf("niceStep(%v): expected %v, got %v", c.step, c.exp, got)
+		}
+	}
+
+	formats := []struct {
+		v, step, absMax float64
+		exp             string
+	}{
+		{0, 0.5, 2, "0.0"},
+		{1500, 500, 2500, "1.5K"},
+		{2e6, 1e6, 5e6, "2M"},
+		{-0.25, 0.25, 1, "-0.25"},
+	}
+	for _, f := range formats {
+		if got := formatValue(f.v, f.step, f.absMax); got != f.exp {
+			t.Fatalf("formatValue(%v, %v, %v): expected %q, got %q", f.v, f.step, f.absMax, f.exp, got)
+		}
+	}
+
+	g := NewGraph(testSeries(), testParams(t, models.GraphOptions{}))
+	min, max, ticks, _ := g.yAxis(5)
+	if min != 0 || max < 7200 || len(ticks) < 2 {
+		t.Fatalf("unexpected y axis %v %v %v", min, max, ticks)
+	}
+}
@@ -0,0 +1,225 @@
+package render
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+// maxSize is the maximum width and height of a graph, in pixels
+const maxSize = 4000
+
+// legendMode describes whether the legend is drawn
+type legendMode uint8
+
+const (
+	legendAuto legendMode = iota // only if there are not too many series
+	legendShow
+	legendHide
+)
+
+// maxAutoLegendSeries is the maximum number of series for which the legend is drawn, unless requested explicitly
+const maxAutoLegendSeries = 10
+
+// Params describes how to render a graph
+type Params struct {
+	Width     int
+	Height    int
+	Title     string
+	VTitle    string
+	YMin      float64 // NaN if not set
+	YMax      float64 // NaN if not set
+	AreaMode  string  // none, first, all or stacked
+	AreaAlpha float64 // NaN if not set
+	LineWidth float64
+	Colors    []color.NRGBA
+	BgColor   color.NRGBA
+	FgColor   color.NRGBA
+	Legend    legendMode
+	HideAxes  bool
+	HideGrid  bool
+	GraphOnly bool
+
+	// range of the x axis
+	From     uint32
+	To       uint32
+	Location *time.Location
+}
+
+// graphite-web's default color list
+var defaultColors = "blue,green,red,purple,brown,yellow,aqua,grey,magenta,pink,gold,rose"
+
+// NewParams validates the graph options of a render request, and applies the defaults of graphite-web.
+// from and to are the range of the x axis.
+func NewParams(opts models.GraphOptions, from, to uint32, loc *time.Location) (Params, error) {
+	p := Params{
+		Width:     opts.Width,
+		Height:    opts.Height,
+		Title:     opts.Title,
+		VTitle:    opts.VTitle,
+		AreaMode:  opts.AreaMode,
+		LineWidth: 1.2,
+		From:      from,
+		To:        to,
+		Location:  loc,
+	}
+	if p.Width == 0 {
+		p.Width = 330
+	}
+	if p.Height == 0 {
+		p.Height = 250
+	}
+	if p.Width < 0 || p.Height < 0 || p.Width > maxSize || p.Height > maxSize {
+		return p, fmt.Errorf("width and height must be between 1 and %d", maxSize)
+	}
+	if from >= to {
+		return p, fmt.Errorf("from must be before to")
+	}
+	if p.AreaMode == "" {
+		p.AreaMode = "none"
+	}
+	if p.Location == nil {
+		p.Location = time.Local
+	}
+
+	var err error
+	if p.YMin, err = parseOptionalFloat("yMin", opts.YMin); err != nil {
+		return p, err
+	}
+	if p.YMax, err = parseOptionalFloat("yMax", opts.YMax); err != nil {
+		return p, err
+	}
+	if !math.IsNaN(p.YMin) && !math.IsNaN(p.YMax) && p.YMin >= p.YMax {
+		return p, fmt.Errorf("yMin must be lower than yMax")
+	}
+	if p.AreaAlpha, err = parseOptionalFloat("areaAlpha", opts.AreaAlpha); err != nil {
+		return p, err
+	}
+	if !math.IsNaN(p.AreaAlpha) && (p.AreaAlpha < 0 || p.AreaAlpha > 1) {
+		return p, fmt.Errorf("areaAlpha must be between 0 and 1")
+	}
+	if opts.LineWidth != "" {
+		p.LineWidth, err = strconv.ParseFloat(opts.LineWidth, 64)
+		if err != nil || p.LineWidth <= 0 || p.LineWidth > maxLineWidth {
+			return p, fmt.Errorf("invalid lineWidth %q", opts.LineWidth)
+		}
+	}
+
+	colorList := opts.ColorList
+	if colorList == "" {
+		colorList = defaultColors
+	}
+	for _, name := range strings.Split(colorList, ",") {
+		c, err := parseColor(strings.TrimSpace(name))
+		if err != nil {
+			return p, err
+		}
+		p.Colors = append(p.Colors, c)
+	}
+	if p.BgColor, err = parseColorDefault(opts.BgColor, "black"); err != nil {
+		return p, err
+	}
+	if p.FgColor, err = parseColorDefault(opts.FgColor, "white"); err != nil {
+		return p, err
+	}
+
+	if opts.HideLegend != "" {
+		hide, err := strconv.ParseBool(opts.HideLegend)
+		if err != nil {
+			return p, fmt.Errorf("invalid hideLegend %q", opts.HideLegend)
+		}
+		p.Legend = legendShow
+		if hide {
+			p.Legend = legendHide
+		}
+	}
+	if p.HideAxes, err = parseOptionalBool("hideAxes", opts.HideAxes); err != nil {
+		return p, err
+	}
+	if p.HideGrid, err = parseOptionalBool("hideGrid", opts.HideGrid); err != nil {
+		return p, err
+	}
+	if p.GraphOnly, err = parseOptionalBool("graphOnly", opts.GraphOnly); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+func parseOptionalFloat(name, val string) (float64, error) {
+	if val == "" {
+		return math.NaN(), nil
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid %s %q", name, val)
+	}
+	return f, nil
+}
+
+func parseOptionalBool(name, val string) (bool, error) {
+	if val == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", name, val)
+	}
+	return b, nil
+}
+
+// the color names known by graphite-web
+var colorAliases = map[string]color.NRGBA{
+	"black":     {0, 0, 0, 255},
+	"white":     {255, 255, 255, 255},
+	"blue":      {100, 100, 255, 255},
+	"green":     {0, 200, 0, 255},
+	"red":       {200, 0, 50, 255},
+	"yellow":    {255, 255, 0, 255},
+	"orange":    {255, 165, 0, 255},
+	"purple":    {200, 100, 255, 255},
+	"brown":     {150, 100, 50, 255},
+	"cyan":      {0, 255, 255, 255},
+	"aqua":      {0, 150, 150, 255},
+	"gray":      {175, 175, 175, 255},
+	"grey":      {175, 175, 175, 255},
+	"magenta":   {255, 0, 255, 255},
+	"pink":      {255, 100, 100, 255},
+	"gold":      {200, 200, 0, 255},
+	"rose":      {200, 150, 200, 255},
+	"darkblue":  {0, 0, 255, 255},
+	"darkgreen": {0, 255, 0, 255},
+	"darkred":   {255, 0, 0, 255},
+	"darkgray":  {111, 111, 111, 255},
+	"darkgrey":  {111, 111, 111, 255},
+}
+
+// parseColor parses a color name known by graphite-web, or a hex color as rrggbb or rrggbbaa, optionally prefixed with #
+func parseColor(s string) (color.NRGBA, error) {
+	if c, ok := colorAliases[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	if len(hex) == 6 {
+		v = v<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+func parseColorDefault(s, def string) (color.NRGBA, error) {
+	if s == "" {
+		s = def
+	}
+	return parseColor(s)
+}
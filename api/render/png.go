@@ -0,0 +1,274 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+)
+
+// pngCanvas rasterizes onto an image. lines are anti-aliased, shapes and text are not.
+type pngCanvas struct {
+	img    *image.RGBA
+	bounds image.Rectangle // the clip rectangle
+}
+
+func newPngCanvas(width, height int) *pngCanvas {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	return &pngCanvas{
+		img:    img,
+		bounds: img.Bounds(),
+	}
+}
+
+// PNG appends the graph, rendered as png image, to buf
+func (g *Graph) PNG(buf []byte) ([]byte, error) {
+	c := newPngCanvas(g.params.Width, g.params.Height)
+	g.draw(c)
+	w := bytes.NewBuffer(buf)
+	err := png.Encode(w, c.img)
+	return w.Bytes(), err
+}
+
+// blend draws the color over the pixel, with the given coverage of the pixel between 0 and 1
+func (c *pngCanvas) blend(x, y int, col color.NRGBA, coverage float64) {
+	if !(image.Point{x, y}.In(c.bounds)) {
+		return
+	}
+	a := float64(col.A) / 255 * coverage
+	if a <= 0 {
+		return
+	}
+	i := c.img.PixOffset(x, y)
+	pix := c.img.Pix[i : i+4 : i+4]
+	pix[0] = uint8(float64(col.R)*a + float64(pix[0])*(1-a) + 0.5)
+	pix[1] = uint8(float64(col.G)*a + float64(pix[1])*(1-a) + 0.5)
+	pix[2] = uint8(float64(col.B)*a + float64(pix[2])*(1-a) + 0.5)
+	pix[3] = uint8(255*a + float64(pix[3])*(1-a) + 0.5)
+}
+
+func (c *pngCanvas) clip(x, y, w, h float64) {
+	c.bounds = image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h))).Intersect(c.img.Bounds())
+}
+
+func (c *pngCanvas) unclip() {
+	c.bounds = c.img.Bounds()
+}
+
+func (c *pngCanvas) rect(x, y, w, h float64, col color.NRGBA) {
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h))).Intersect(c.bounds)
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			c.blend(px, py, col, 1)
+		}
+	}
+}
+
+func (c *pngCanvas) polyline(points []point, col color.NRGBA, width, dash float64) {
+	r := width / 2
+	// parts of the line that are further than the line width outside of the clip rectangle don't affect any pixel
+	margin := r + 1
+	clip := [2]point{
+		{float64(c.bounds.Min.X) - margin, float64(c.bounds.Min.Y) - margin},
+		{float64(c.bounds.Max.X) + margin, float64(c.bounds.Max.Y) + margin},
+	}
+	segments := dashSegments(points, dash, clip)
+	// the coverage of the pixels by the line. we take the max across segments,
+	// so that the overlap of segments at their joints is not drawn twice
+	coverage := make(map[int]float64)
+	for _, s := range segments {
+		a, b := s[0], s[1]
+		box := image.Rect(
+			int(math.Floor(math.Min(a.x, b.x)-r-1)), int(math.Floor(math.Min(a.y, b.y)-r-1)),
+			int(math.Ceil(math.Max(a.x, b.x)+r+1)), int(math.Ceil(math.Max(a.y, b.y)+r+1)),
+		).Intersect(c.bounds)
+		for py := box.Min.Y; py < box.Max.Y; py++ {
+			for px := box.Min.X; px < box.Max.X; px++ {
+				d := distToSegment(point{float64(px) + 0.5, float64(py) + 0.5}, a, b)
+				cov := math.Min(1, r+0.5-d)
+				if cov <= 0 {
+					continue
+				}
+				i := c.img.PixOffset(px, py)
+				if cov > coverage[i] {
+					coverage[i] = cov
+				}
+			}
+		}
+	}
+	stride := c.img.Stride
+	for i, cov := range coverage {
+		c.blend((i%stride)/4, i/stride, col, cov)
+	}
+}
+
+// maxDashes limits the number of dashes of a line. lines that would have more get longer dashes
+const maxDashes = 10000
+
+// dashSegments splits a polyline into the segments to draw, leaving out the parts outside of the
+// clip rectangle, given by its min and max corner
+func dashSegments(points []point, dash float64, clip [2]point) [][2]point {
+	if len(points) == 1 {
+		return [][2]point{{points[0], points[0]}}
+	}
+	var out [][2]point
+	if dash <= 0 {
+		for i := 1; i < len(points); i++ {
+			a, b := points[i-1], points[i]
+			if t0, t1, ok := clipSegment(a, b, clip); ok {
+				out = append(out, [2]point{interpolate(a, b, t0), interpolate(a, b, t1)})
+			}
+		}
+		return out
+	}
+	visible := 0.0
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		if t0, t1, ok := clipSegment(a, b, clip); ok {
+			visible += (t1 - t0) * math.Hypot(b.x-a.x, b.y-a.y)
+		}
+	}
+	// every dash is at least a pixel, and long lines get longer dashes, to bound the number of segments
+	dash = math.Max(dash, math.Max(1, visible/(2*maxDashes)))
+	period := 2 * dash
+	// the dash pattern runs along the whole line, including the parts that are clipped.
+	// offset is where in the pattern the current segment starts
+	offset := 0.0
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		length := math.Hypot(b.x-a.x, b.y-a.y)
+		if t0, t1, ok := clipSegment(a, b, clip); ok && length > 0 {
+			from, to := t0*length, t1*length
+			// dash k covers [k*period-offset, k*period-offset+dash) of the segment
+			for k := math.Floor((offset + from) / period); k*period-offset < to; k++ {
+				start := math.Max(from, k*period-offset)
+				end := math.Min(to, k*period-offset+dash)
+				// ignore slivers due to rounding errors on long segments
+				if end-start > 1e-6 {
+					out = append(out, [2]point{interpolate(a, b, start/length), interpolate(a, b, end/length)})
+				}
+			}
+		}
+		offset = math.Mod(offset+length, period)
+	}
+	return out
+}
+
+// clipSegment returns the part of the segment from a to b that lies within the clip rectangle,
+// as fractions of the segment, using the Liang-Barsky algorithm. ok is false if no part of it does
+func clipSegment(a, b point, clip [2]point) (t0, t1 float64, ok bool) {
+	t0, t1 = 0, 1
+	dx, dy := b.x-a.x, b.y-a.y
+	edges := [4][2]float64{
+		{-dx, a.x - clip[0].x},
+		{dx, clip[1].x - a.x},
+		{-dy, a.y - clip[0].y},
+		{dy, clip[1].y - a.y},
+	}
+	for _, e := range edges {
+		p, q := e[0], e[1]
+		if p == 0 {
+			// parallel to the edge
+			if q < 0 {
+				return 0, 0, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			t0 = math.Max(t0, t)
+		} else {
+			t1 = math.Min(t1, t)
+		}
+		if t0 > t1 {
+			return 0, 0, false
+		}
+	}
+	return t0, t1, true
+}
+
+func interpolate(a, b point, f float64) point {
+	return point{a.x + (b.x-a.x)*f, a.y + (b.y-a.y)*f}
+}
+
+func distToSegment(p, a, b point) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	l2 := dx*dx + dy*dy
+	if l2 == 0 {
+		return math.Hypot(p.x-a.x, p.y-a.y)
+	}
+	t := math.Max(0, math.Min(1, ((p.x-a.x)*dx+(p.y-a.y)*dy)/l2))
+	return math.Hypot(p.x-(a.x+t*dx), p.y-(a.y+t*dy))
+}
+
+// polygon fills the polygon using the even-odd rule, by filling the pixels whose centers are inside of it
+func (c *pngCanvas) polygon(points []point, col color.NRGBA) {
+	if len(points) < 3 {
+		return
+	}
+	minY, maxY := points[0].y, points[0].y
+	for _, p := range points {
+		minY = math.Min(minY, p.y)
+		maxY = math.Max(maxY, p.y)
+	}
+	y0 := int(math.Max(float64(c.bounds.Min.Y), math.Floor(minY)))
+	y1 := int(math.Min(float64(c.bounds.Max.Y), math.Ceil(maxY)))
+	var xs []float64
+	for py := y0; py < y1; py++ {
+		y := float64(py) + 0.5
+		xs = xs[:0]
+		for i := range points {
+			a, b := points[i], points[(i+1)%len(points)]
+			if (a.y <= y) != (b.y <= y) {
+				xs = append(xs, a.x+(y-a.y)/(b.y-a.y)*(b.x-a.x))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			x0 := int(math.Max(float64(c.bounds.Min.X), math.Ceil(xs[i]-0.5)))
+			x1 := int(math.Min(float64(c.bounds.Max.X), math.Ceil(xs[i+1]-0.5)))
+			for px := x0; px < x1; px++ {
+				c.blend(px, py, col, 1)
+			}
+		}
+	}
+}
+
+func (c *pngCanvas) text(x, y float64, s string, col color.NRGBA, a anchor) {
+	switch a {
+	case anchorMiddle:
+		x -= textWidth(s) / 2
+	case anchorEnd:
+		x -= textWidth(s)
+	}
+	x0, y0 := int(math.Round(x)), int(math.Round(y))+(charHeight-glyphHeight)/2
+	for i, r := range []rune(s) {
+		g := glyph(r)
+		for gy, row := range g {
+			for gx := 0; gx < glyphWidth; gx++ {
+				if row&(1<<uint(glyphWidth-1-gx)) != 0 {
+					c.blend(x0+i*charWidth+gx, y0+gy, col, 1)
+				}
+			}
+		}
+	}
+}
+
+func (c *pngCanvas) vtext(x, y float64, s string, col color.NRGBA) {
+	// the glyphs are rotated counterclockwise: their rows become columns, from left to right,
+	// and the text runs from the bottom up
+	x0 := int(math.Round(x)) - charHeight/2 + (charHeight-glyphHeight)/2
+	y0 := int(math.Round(y + textWidth(s)/2))
+	for i, r := range []rune(s) {
+		g := glyph(r)
+		for gy, row := range g {
+			for gx := 0; gx < glyphWidth; gx++ {
+				if row&(1<<uint(glyphWidth-1-gx)) != 0 {
+					c.blend(x0+gy, y0-i*charWidth-gx-1, col, 1)
+				}
+			}
+		}
+	}
+}
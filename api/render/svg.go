@@ -0,0 +1,126 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// svgCanvas writes svg elements. text is drawn in a monospace font sized to match the png font
+type svgCanvas struct {
+	buf     *bytes.Buffer
+	clips   int  // number of clip paths defined
+	clipped bool // whether a clipped group is open
+}
+
+// SVG appends the graph, rendered as svg image, to buf
+func (g *Graph) SVG(buf []byte) ([]byte, error) {
+	c := &svgCanvas{
+		buf: bytes.NewBuffer(buf),
+	}
+	fmt.Fprintf(c.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="monospace" font-size="10">`,
+		g.params.Width, g.params.Height, g.params.Width, g.params.Height)
+	c.buf.WriteByte('\n')
+	g.draw(c)
+	c.unclip()
+	c.buf.WriteString("</svg>\n")
+	return c.buf.Bytes(), nil
+}
+
+func svgNum(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// svgColor returns the attributes for the given color, e.g. fill="#rrggbb" fill-opacity="0.5"
+func svgColor(attr string, c color.NRGBA) string {
+	s := fmt.Sprintf(`%s="#%02x%02x%02x"`, attr, c.R, c.G, c.B)
+	if c.A != 255 {
+		s += fmt.Sprintf(` %s-opacity="%s"`, attr, svgNum(float64(c.A)/255))
+	}
+	return s
+}
+
+func (c *svgCanvas) clip(x, y, w, h float64) {
+	c.unclip()
+	c.clips++
+	fmt.Fprintf(c.buf, `<clipPath id="clip%d"><rect x="%s" y="%s" width="%s" height="%s"/></clipPath>`+"\n",
+		c.clips, svgNum(x), svgNum(y), svgNum(w), svgNum(h))
+	fmt.Fprintf(c.buf, `<g clip-path="url(#clip%d)">`+"\n", c.clips)
+	c.clipped = true
+}
+
+func (c *svgCanvas) unclip() {
+	if c.clipped {
+		c.buf.WriteString("</g>\n")
+		c.clipped = false
+	}
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, col color.NRGBA) {
+	fmt.Fprintf(c.buf, `<rect x="%s" y="%s" width="%s" height="%s" %s/>`+"\n", svgNum(x), svgNum(y), svgNum(w), svgNum(h), svgColor("fill", col))
+}
+
+func (c *svgCanvas) path(points []point, closed bool) string {
+	var d bytes.Buffer
+	for i, p := range points {
+		if i == 0 {
+			d.WriteByte('M')
+		} else {
+			d.WriteString(" L")
+		}
+		d.WriteString(svgNum(p.x))
+		d.WriteByte(' ')
+		d.WriteString(svgNum(p.y))
+	}
+	if len(points) == 1 {
+		// a dot, drawn thanks to the round line caps
+		d.WriteString(" L" + svgNum(points[0].x) + " " + svgNum(points[0].y))
+	}
+	if closed {
+		d.WriteString(" Z")
+	}
+	return d.String()
+}
+
+func (c *svgCanvas) polyline(points []point, col color.NRGBA, width, dash float64) {
+	if len(points) == 0 {
+		return
+	}
+	fmt.Fprintf(c.buf, `<path d="%s" fill="none" %s stroke-width="%s" stroke-linejoin="round" stroke-linecap="round"`,
+		c.path(points, false), svgColor("stroke", col), svgNum(width))
+	if dash > 0 {
+		fmt.Fprintf(c.buf, ` stroke-dasharray="%s"`, svgNum(dash))
+	}
+	c.buf.WriteString("/>\n")
+}
+
+func (c *svgCanvas) polygon(points []point, col color.NRGBA) {
+	if len(points) < 3 {
+		return
+	}
+	fmt.Fprintf(c.buf, `<path d="%s" fill-rule="evenodd" %s/>`+"\n", c.path(points, true), svgColor("fill", col))
+}
+
+var svgAnchors = map[anchor]string{
+	anchorStart:  "start",
+	anchorMiddle: "middle",
+	anchorEnd:    "end",
+}
+
+func (c *svgCanvas) text(x, y float64, s string, col color.NRGBA, a anchor) {
+	// the y of svg text is its baseline
+	fmt.Fprintf(c.buf, `<text x="%s" y="%s" text-anchor="%s" %s>`, svgNum(x), svgNum(y+charHeight-2), svgAnchors[a], svgColor("fill", col))
+	xml.EscapeText(c.buf, []byte(s))
+	c.buf.WriteString("</text>\n")
+}
+
+func (c *svgCanvas) vtext(x, y float64, s string, col color.NRGBA) {
+	bx := x + charHeight/2 - 2
+	fmt.Fprintf(c.buf, `<text x="%s" y="%s" text-anchor="middle" transform="rotate(-90 %s %s)" %s>`,
+		svgNum(x), svgNum(bx-x+y), svgNum(x), svgNum(y), svgColor("fill", col))
+	xml.EscapeText(c.buf, []byte(s))
+	c.buf.WriteString("</text>\n")
+}
@@ -0,0 +1,478 @@
+package response
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// arrowType is a column type supported by the arrow encoder
+type arrowType uint8
+
+const (
+	arrowUtf8      arrowType = iota // column values are a string (the same for all rows) or a []string
+	arrowUint32                     // column values are a uint32 (the same for all rows) or a []uint32
+	arrowTimestamp                  // timestamps in seconds, in UTC. column values are a []uint32
+	arrowFloat64                    // column values are a []float64. NaN is encoded as null if the field is nullable
+	arrowUtf8Map                    // map of strings to strings. column values are a map[string]string (the same for all rows)
+)
+
+// arrowField describes a column of an arrow schema
+type arrowField struct {
+	name     string
+	typ      arrowType
+	nullable bool
+}
+
+// arrowRecord is a record batch, with the values of each column in the order of the schema
+type arrowRecord struct {
+	length  int
+	columns []interface{}
+}
+
+// arrowSeriesSchema is the long format table of series, with one row per point
+var arrowSeriesSchema = []arrowField{
+	{name: "target", typ: arrowUtf8},
+	{name: "tags", typ: arrowUtf8Map},
+	{name: "interval", typ: arrowUint32},
+	{name: "ts", typ: arrowTimestamp},
+	{name: "value", typ: arrowFloat64, nullable: true},
+}
+
+// Arrowable is implemented by lists of series, which are encoded as one record batch per series
+type Arrowable interface {
+	// ArrowSeries calls write for each series, until it returns an error.
+	// ts and vals hold the timestamps and values of the points, NaN values are encoded as nulls.
+	ArrowSeries(write func(target string, tags map[string]string, interval uint32, ts []uint32, vals []float64) error) error
+}
+
+// Arrow is an Apache Arrow IPC stream (https://arrow.apache.org/docs/format/Columnar.html#ipc-streaming-format)
+// it implements Streamer, such that record batches are sent as they are encoded.
+type Arrow struct {
+	code int
+	body Arrowable
+	buf  []byte
+}
+
+func NewArrow(code int, body Arrowable) *Arrow {
+	return &Arrow{
+		code: code,
+		body: body,
+		buf:  BufferPool.Get(),
+	}
+}
+
+func (r *Arrow) Code() int {
+	return r.code
+}
+
+func (r *Arrow) Close() {
+	BufferPool.Put(r.buf)
+}
+
+func (r *Arrow) Body() ([]byte, error) {
+	r.buf = appendArrowSchema(r.buf, arrowSeriesSchema)
+	err := r.body.ArrowSeries(func(target string, tags map[string]string, interval uint32, ts []uint32, vals []float64) error {
+		var err error
+		r.buf, err = appendArrowSeries(r.buf, target, tags, interval, ts, vals)
+		return err
+	})
+	if err != nil {
+		return r.buf, err
+	}
+	return appendArrowEOS(r.buf), nil
+}
+
+func (r *Arrow) WriteBody(w io.Writer) error {
+	r.buf = appendArrowSchema(r.buf[:0], arrowSeriesSchema)
+	err := r.body.ArrowSeries(func(target string, tags map[string]string, interval uint32, ts []uint32, vals []float64) error {
+		var err error
+		r.buf, err = appendArrowSeries(r.buf, target, tags, interval, ts, vals)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(r.buf)
+		r.buf = r.buf[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(appendArrowEOS(r.buf))
+	return err
+}
+
+func (r *Arrow) Headers() (headers map[string]string) {
+	return map[string]string{"content-type": "application/vnd.apache.arrow.stream"}
+}
+
+func appendArrowSeries(buf []byte, target string, tags map[string]string, interval uint32, ts []uint32, vals []float64) ([]byte, error) {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	return appendArrowRecord(buf, arrowSeriesSchema, arrowRecord{
+		length:  len(ts),
+		columns: []interface{}{target, tags, interval, ts, vals},
+	})
+}
+
+// arrow metadata constants, see Schema.fbs and Message.fbs in the arrow repository
+const (
+	arrowMetadataV5 = 4
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowTypeInt           = 2
+	arrowTypeFloatingPoint = 3
+	arrowTypeUtf8          = 5
+	arrowTypeTimestamp     = 10
+	arrowTypeStruct        = 13
+	arrowTypeMap           = 17
+
+	arrowPrecisionDouble = 2
+	arrowUnitSecond      = 0
+)
+
+func arrowFieldMeta(name string, nullable bool, typeType uint8, typ fbTable, children ...fbTable) fbTable {
+	if children == nil {
+		children = []fbTable{}
+	}
+	// name, nullable, type_type, type, dictionary, children
+	return fbTable{name, nullable, typeType, typ, nil, children}
+}
+
+func appendArrowSchema(buf []byte, schema []arrowField) []byte {
+	fields := make([]fbTable, len(schema))
+	for i, f := range schema {
+		switch f.typ {
+		case arrowUtf8:
+			fields[i] = arrowFieldMeta(f.name, f.nullable, arrowTypeUtf8, fbTable{})
+		case arrowUint32:
+			fields[i] = arrowFieldMeta(f.name, f.nullable, arrowTypeInt, fbTable{int32(32), false})
+		case arrowTimestamp:
+			fields[i] = arrowFieldMeta(f.name, f.nullable, arrowTypeTimestamp, fbTable{int16(arrowUnitSecond), "UTC"})
+		case arrowFloat64:
+			fields[i] = arrowFieldMeta(f.name, f.nullable, arrowTypeFloatingPoint, fbTable{int16(arrowPrecisionDouble)})
+		case arrowUtf8Map:
+			entries := arrowFieldMeta("entries", false, arrowTypeStruct, fbTable{},
+				arrowFieldMeta("key", false, arrowTypeUtf8, fbTable{}),
+				arrowFieldMeta("value", true, arrowTypeUtf8, fbTable{}),
+			)
+			fields[i] = arrowFieldMeta(f.name, f.nullable, arrowTypeMap, fbTable{false}, entries)
+		}
+	}
+	// endianness (little), fields
+	header := fbTable{int16(0), fields}
+	return appendArrowMessage(buf, arrowHeaderSchema, header, nil)
+}
+
+// arrowBody accumulates the field nodes and buffers of a record batch
+type arrowBody struct {
+	nodes   [][2]int64 // length and null count of each field
+	buffers [][2]int64 // offset in body and length of each buffer
+	data    []byte
+}
+
+func (b *arrowBody) node(length, nulls int) {
+	b.nodes = append(b.nodes, [2]int64{int64(length), int64(nulls)})
+}
+
+// buffer appends a buffer, padded to 8 bytes as required by arrow
+func (b *arrowBody) buffer(data []byte) {
+	b.buffers = append(b.buffers, [2]int64{int64(len(b.data)), int64(len(data))})
+	b.data = append(b.data, data...)
+	for len(b.data)%8 != 0 {
+		b.data = append(b.data, 0)
+	}
+}
+
+// strings appends the offsets and data buffers of a utf8 column
+func (b *arrowBody) strings(n int, value func(i int) string) {
+	offsets := make([]byte, 4*(n+1))
+	var data []byte
+	for i := 0; i < n; i++ {
+		data = append(data, value(i)...)
+		binary.LittleEndian.PutUint32(offsets[4*(i+1):], uint32(len(data)))
+	}
+	b.buffer(offsets)
+	b.buffer(data)
+}
+
+func (b *arrowBody) column(f arrowField, length int, col interface{}) error {
+	switch f.typ {
+	case arrowUtf8:
+		b.node(length, 0)
+		b.buffer(nil) // validity
+		switch v := col.(type) {
+		case string:
+			b.strings(length, func(i int) string { return v })
+		case []string:
+			if len(v) != length {
+				return fmt.Errorf("column %s: expected %d values, got %d", f.name, length, len(v))
+			}
+			b.strings(length, func(i int) string { return v[i] })
+		default:
+			return fmt.Errorf("column %s: unsupported values %T", f.name, col)
+		}
+	case arrowUint32, arrowTimestamp:
+		data := make([]byte, 4*length)
+		switch v := col.(type) {
+		case uint32:
+			for i := 0; i < length; i++ {
+				binary.LittleEndian.PutUint32(data[4*i:], v)
+			}
+		case []uint32:
+			if len(v) != length {
+				return fmt.Errorf("column %s: expected %d values, got %d", f.name, length, len(v))
+			}
+			for i, val := range v {
+				binary.LittleEndian.PutUint32(data[4*i:], val)
+			}
+		default:
+			return fmt.Errorf("column %s: unsupported values %T", f.name, col)
+		}
+		if f.typ == arrowTimestamp {
+			// timestamps are 64 bit
+			wide := make([]byte, 8*length)
+			for i := 0; i < length; i++ {
+				binary.LittleEndian.PutUint64(wide[8*i:], uint64(binary.LittleEndian.Uint32(data[4*i:])))
+			}
+			data = wide
+		}
+		b.node(length, 0)
+		b.buffer(nil)
+		b.buffer(data)
+	case arrowFloat64:
+		v, ok := col.([]float64)
+		if !ok {
+			return fmt.Errorf("column %s: unsupported values %T", f.name, col)
+		}
+		if len(v) != length {
+			return fmt.Errorf("column %s: expected %d values, got %d", f.name, length, len(v))
+		}
+		data := make([]byte, 8*length)
+		validity := make([]byte, (length+7)/8)
+		nulls := 0
+		for i, val := range v {
+			if f.nullable && math.IsNaN(val) {
+				nulls++
+				continue
+			}
+			validity[i/8] |= 1 << uint(i%8)
+			binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(val))
+		}
+		b.node(length, nulls)
+		if nulls == 0 {
+			validity = nil
+		}
+		b.buffer(validity)
+		b.buffer(data)
+	case arrowUtf8Map:
+		v, ok := col.(map[string]string)
+		if !ok {
+			return fmt.Errorf("column %s: unsupported values %T", f.name, col)
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		offsets := make([]byte, 4*(length+1))
+		for i := 0; i < length; i++ {
+			binary.LittleEndian.PutUint32(offsets[4*(i+1):], uint32((i+1)*len(keys)))
+		}
+		entries := length * len(keys)
+		b.node(length, 0)
+		b.buffer(nil)
+		b.buffer(offsets)
+		// the entries struct, and its key and value children
+		b.node(entries, 0)
+		b.buffer(nil)
+		b.node(entries, 0)
+		b.buffer(nil)
+		b.strings(entries, func(i int) string { return keys[i%len(keys)] })
+		b.node(entries, 0)
+		b.buffer(nil)
+		b.strings(entries, func(i int) string { return v[keys[i%len(keys)]] })
+	}
+	return nil
+}
+
+func appendArrowRecord(buf []byte, schema []arrowField, rec arrowRecord) ([]byte, error) {
+	if len(rec.columns) != len(schema) {
+		return buf, fmt.Errorf("expected %d columns, got %d", len(schema), len(rec.columns))
+	}
+	var body arrowBody
+	for i, f := range schema {
+		if err := body.column(f, rec.length, rec.columns[i]); err != nil {
+			return buf, err
+		}
+	}
+	// length, nodes, buffers
+	header := fbTable{int64(rec.length), fbStructs(body.nodes), fbStructs(body.buffers)}
+	return appendArrowMessage(buf, arrowHeaderRecordBatch, header, body.data), nil
+}
+
+// appendArrowMessage appends an encapsulated message: a continuation marker, the length of the metadata,
+// the Message flatbuffer and the body
+func appendArrowMessage(buf []byte, headerType uint8, header fbTable, body []byte) []byte {
+	// version, header_type, header, bodyLength
+	meta := fbBuild(fbTable{int16(arrowMetadataV5), headerType, header, int64(len(body))})
+	for len(meta)%8 != 0 {
+		meta = append(meta, 0)
+	}
+	buf = append(buf, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(buf[len(buf)-4:], uint32(len(meta)))
+	buf = append(buf, meta...)
+	return append(buf, body...)
+}
+
+func appendArrowEOS(buf []byte) []byte {
+	return append(buf, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0)
+}
+
+// fbTable describes a flatbuffers table as its fields, by field id.
+// supported field values are nil (absent), bool, uint8, int16, int32, int64, string,
+// fbTable, []fbTable and fbStructs.
+type fbTable []interface{}
+
+// fbStructs is a vector of structs of two longs, such as arrow's FieldNode and Buffer
+type fbStructs [][2]int64
+
+// fbBuilder writes a flatbuffer front to back: objects are written after the tables that refer to them,
+// as offsets must point forward, and each vtable is written just before its table.
+type fbBuilder struct {
+	buf []byte
+}
+
+func fbBuild(root fbTable) []byte {
+	b := fbBuilder{buf: make([]byte, 4, 256)}
+	b.putUint32(0, uint32(b.table(root)))
+	return b.buf
+}
+
+func (b *fbBuilder) putUint32(pos int, v uint32) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], v)
+}
+
+// pad pads the buffer until its length plus offset is a multiple of align
+func (b *fbBuilder) pad(align, offset int) {
+	for (len(b.buf)+offset)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func fbSize(v interface{}) int {
+	switch v.(type) {
+	case bool, uint8:
+		return 1
+	case int16:
+		return 2
+	case int64:
+		return 8
+	}
+	// int32 and offsets
+	return 4
+}
+
+func (b *fbBuilder) table(t fbTable) int {
+	var ids []int
+	has8 := false
+	for id, v := range t {
+		if v != nil {
+			ids = append(ids, id)
+			has8 = has8 || fbSize(v) == 8
+		}
+	}
+	// laying out the fields from large to small keeps them aligned
+	sort.SliceStable(ids, func(i, j int) bool { return fbSize(t[ids[i]]) > fbSize(t[ids[j]]) })
+
+	b.pad(2, 0)
+	vtable := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4+2*len(t))...)
+	if has8 {
+		b.pad(8, 4)
+	} else {
+		b.pad(4, 0)
+	}
+	start := len(b.buf)
+	b.buf = append(b.buf, 0, 0, 0, 0)
+	b.putUint32(start, uint32(int32(start-vtable)))
+
+	var refs []int // ids of the fields that are offsets to other objects
+	pos := map[int]int{}
+	for _, id := range ids {
+		pos[id] = len(b.buf)
+		binary.LittleEndian.PutUint16(b.buf[vtable+4+2*id:], uint16(len(b.buf)-start))
+		switch v := t[id].(type) {
+		case bool:
+			if v {
+				b.buf = append(b.buf, 1)
+			} else {
+				b.buf = append(b.buf, 0)
+			}
+		case uint8:
+			b.buf = append(b.buf, v)
+		case int16:
+			b.buf = append(b.buf, 0, 0)
+			binary.LittleEndian.PutUint16(b.buf[pos[id]:], uint16(v))
+		case int32:
+			b.buf = append(b.buf, 0, 0, 0, 0)
+			b.putUint32(pos[id], uint32(v))
+		case int64:
+			b.buf = append(b.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint64(b.buf[pos[id]:], uint64(v))
+		default:
+			b.buf = append(b.buf, 0, 0, 0, 0)
+			refs = append(refs, id)
+		}
+	}
+	binary.LittleEndian.PutUint16(b.buf[vtable:], uint16(4+2*len(t)))
+	binary.LittleEndian.PutUint16(b.buf[vtable+2:], uint16(len(b.buf)-start))
+
+	for _, id := range refs {
+		obj := b.object(t[id])
+		b.putUint32(pos[id], uint32(obj-pos[id]))
+	}
+	return start
+}
+
+// object writes a string, table or vector and returns its position
+func (b *fbBuilder) object(v interface{}) int {
+	switch v := v.(type) {
+	case string:
+		b.pad(4, 0)
+		start := len(b.buf)
+		b.buf = append(b.buf, 0, 0, 0, 0)
+		b.putUint32(start, uint32(len(v)))
+		b.buf = append(b.buf, v...)
+		b.buf = append(b.buf, 0)
+		return start
+	case fbTable:
+		return b.table(v)
+	case []fbTable:
+		b.pad(4, 0)
+		start := len(b.buf)
+		b.buf = append(b.buf, make([]byte, 4+4*len(v))...)
+		b.putUint32(start, uint32(len(v)))
+		for i, t := range v {
+			elem := start + 4 + 4*i
+			b.putUint32(elem, uint32(b.table(t)-elem))
+		}
+		return start
+	case fbStructs:
+		b.pad(8, 4)
+		start := len(b.buf)
+		b.buf = append(b.buf, make([]byte, 4+16*len(v))...)
+		b.putUint32(start, uint32(len(v)))
+		for i, s := range v {
+			binary.LittleEndian.PutUint64(b.buf[start+4+16*i:], uint64(s[0]))
+			binary.LittleEndian.PutUint64(b.buf[start+12+16*i:], uint64(s[1]))
+		}
+		return start
+	}
+	panic(fmt.Sprintf("unsupported flatbuffer value %T", v))
+}
@@ -0,0 +1,225 @@
+package response
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// fbReader reads flatbuffer tables, as generated code would
+type fbReader struct {
+	buf []byte
+	pos int // position of the table
+}
+
+func fbRoot(buf []byte) fbReader {
+	return fbReader{buf, int(binary.LittleEndian.Uint32(buf))}
+}
+
+// field returns the position of the given field, or 0 if absent
+func (r fbReader) field(id int) int {
+	vtable := r.pos - int(int32(binary.LittleEndian.Uint32(r.buf[r.pos:])))
+	if 4+2*id >= int(binary.LittleEndian.Uint16(r.buf[vtable:])) {
+		return 0
+	}
+	off := int(binary.LittleEndian.Uint16(r.buf[vtable+4+2*id:]))
+	if off == 0 {
+		return 0
+	}
+	return r.pos + off
+}
+
+func (r fbReader) uint8(id int) uint8 {
+	if p := r.field(id); p != 0 {
+		return r.buf[p]
+	}
+	return 0
+}
+
+func (r fbReader) int16(id int) int16 {
+	if p := r.field(id); p != 0 {
+		return int16(binary.LittleEndian.Uint16(r.buf[p:]))
+	}
+	return 0
+}
+
+func (r fbReader) int32(id int) int32 {
+	if p := r.field(id); p != 0 {
+		return int32(binary.LittleEndian.Uint32(r.buf[p:]))
+	}
+	return 0
+}
+
+func (r fbReader) int64(id int) int64 {
+	if p := r.field(id); p != 0 {
+		if p%8 != 0 {
+			panic("unaligned long")
+		}
+		return int64(binary.LittleEndian.Uint64(r.buf[p:]))
+	}
+	return 0
+}
+
+func (r fbReader) deref(p int) int {
+	return p + int(binary.LittleEndian.Uint32(r.buf[p:]))
+}
+
+func (r fbReader) table(id int) fbReader {
+	return fbReader{r.buf, r.deref(r.field(id))}
+}
+
+func (r fbReader) string(id int) string {
+	p := r.deref(r.field(id))
+	n := int(binary.LittleEndian.Uint32(r.buf[p:]))
+	return string(r.buf[p+4 : p+4+n])
+}
+
+func (r fbReader) tables(id int) []fbReader {
+	p := r.field(id)
+	if p == 0 {
+		return nil
+	}
+	p = r.deref(p)
+	out := make([]fbReader, binary.LittleEndian.Uint32(r.buf[p:]))
+	for i := range out {
+		out[i] = fbReader{r.buf, r.deref(p + 4 + 4*i)}
+	}
+	return out
+}
+
+func (r fbReader) structs(id int) [][2]int64 {
+	p := r.deref(r.field(id))
+	if (p+4)%8 != 0 {
+		panic("unaligned structs")
+	}
+	out := make([][2]int64, binary.LittleEndian.Uint32(r.buf[p:]))
+	for i := range out {
+		out[i][0] = int64(binary.LittleEndian.Uint64(r.buf[p+4+16*i:]))
+		out[i][1] = int64(binary.LittleEndian.Uint64(r.buf[p+12+16*i:]))
+	}
+	return out
+}
+
+type arrowMessage struct {
+	header     fbReader
+	headerType uint8
+	body       []byte
+}
+
+func readArrowMessages(t *testing.T, buf []byte) []arrowMessage {
+	var msgs []arrowMessage
+	for {
+		if len(buf) < 8 || binary.LittleEndian.Uint32(buf) != 0xffffffff {
+			t.Fatalf("expected continuation marker, got %v", buf)
+		}
+		size := int(binary.LittleEndian.Uint32(buf[4:]))
+		if size == 0 {
+			if len(buf) != 8 {
+				t.Fatalf("expected stream to end after EOS, got %d more bytes", len(buf)-8)
+			}
+			return msgs
+		}
+		if size%8 != 0 {
+			t.Fatalf("metadata size %d is not a multiple of 8", size)
+		}
+		msg := fbRoot(buf[8 : 8+size])
+		if msg.int16(0) != arrowMetadataV5 {
+			t.Fatalf("expected metadata version V5, got %d", msg.int16(0))
+		}
+		bodyLen := int(msg.int64(3))
+		msgs = append(msgs, arrowMessage{
+			header:     msg.table(2),
+			headerType: msg.uint8(1),
+			body:       buf[8+size : 8+size+bodyLen],
+		})
+		buf = buf[8+size+bodyLen:]
+	}
+}
+
+type testArrowable struct{}
+
+func (testArrowable) ArrowSeries(write func(target string, tags map[string]string, interval uint32, ts []uint32, vals []float64) error) error {
+	err := write("a", map[string]string{"dc": "eu", "name": "a"}, 10, []uint32{10, 20, 30}, []float64{1, math.NaN(), 3})
+	if err != nil {
+		return err
+	}
+	return write("empty", nil, 60, nil, nil)
+}
+
+func TestArrow(t *testing.T) {
+	resp := NewArrow(200, testArrowable{})
+	body, err := resp.Body()
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	var streamed bytes.Buffer
+	if err := NewArrow(200, testArrowable{}).WriteBody(&streamed); err != nil {
+		t.Fatalf("failed to stream: %s", err)
+	}
+	if !bytes.Equal(body, streamed.Bytes()) {
+		t.Fatal("expected streamed body to match the buffered one")
+	}
+
+	msgs := readArrowMessages(t, body)
+	if len(msgs) != 3 || msgs[0].headerType != arrowHeaderSchema || msgs[1].headerType != arrowHeaderRecordBatch || msgs[2].headerType != arrowHeaderRecordBatch {
+		t.Fatalf("expected a schema and 2 record batches, got %v", msgs)
+	}
+
+	fields := msgs[0].header.tables(1)
+	expTypes := []uint8{arrowTypeUtf8, arrowTypeMap, arrowTypeInt, arrowTypeTimestamp, arrowTypeFloatingPoint}
+	for i, f := range arrowSeriesSchema {
+		if fields[i].string(0) != f.name || (fields[i].uint8(1) == 1) != f.nullable || fields[i].uint8(2) != expTypes[i] {
+			t.Fatalf("field %d: unexpected metadata for %v", i, f)
+		}
+	}
+	if typ := fields[2].table(3); typ.int32(0) != 32 || typ.uint8(1) != 0 {
+		t.Fatal("expected interval to be an unsigned 32 bit integer")
+	}
+	if typ := fields[3].table(3); typ.int16(0) != arrowUnitSecond || typ.string(1) != "UTC" {
+		t.Fatal("expected ts to be a timestamp in seconds, in UTC")
+	}
+	entries := fields[1].tables(5)
+	if len(entries) != 1 || entries[0].uint8(2) != arrowTypeStruct || len(entries[0].tables(5)) != 2 {
+		t.Fatal("expected the map to have an entries struct with a key and value")
+	}
+
+	batch := msgs[1].header
+	if batch.int64(0) != 3 {
+		t.Fatalf("expected 3 rows, got %d", batch.int64(0))
+	}
+	nodes := batch.structs(1)
+	buffers := batch.structs(2)
+	// target, tags, entries, key, value, interval, ts, value
+	if len(nodes) != 8 || len(buffers) != 18 {
+		t.Fatalf("expected 8 nodes and 18 buffers, got %v and %v", nodes, buffers)
+	}
+	if nodes[7] != [2]int64{3, 1} || nodes[3] != [2]int64{6, 0} {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+	data := func(i int) []byte {
+		if buffers[i][0]%8 != 0 {
+			t.Fatalf("buffer %d is not aligned", i)
+		}
+		return msgs[1].body[buffers[i][0] : buffers[i][0]+buffers[i][1]]
+	}
+	if string(data(2)) != "aaa" {
+		t.Fatalf("expected target column aaa, got %q", data(2))
+	}
+	if string(data(8)) != "dcnamedcnamedcname" || string(data(11)) != "euaeuaeua" {
+		t.Fatalf("unexpected tags %q %q", data(8), data(11))
+	}
+	if binary.LittleEndian.Uint32(data(13)[4:]) != 10 || binary.LittleEndian.Uint64(data(15)[16:]) != 30 {
+		t.Fatal("unexpected interval or ts")
+	}
+	if validity := data(16); len(validity) != 1 || validity[0] != 5 {
+		t.Fatalf("expected validity bitmap 101, got %v", validity)
+	}
+	if math.Float64frombits(binary.LittleEndian.Uint64(data(17)[16:])) != 3 {
+		t.Fatal("unexpected value")
+	}
+
+	if msgs[2].header.int64(0) != 0 {
+		t.Fatal("expected empty record batch")
+	}
+}
@@ -0,0 +1,73 @@
+package response
+
+type Pngable interface {
+	PNG([]byte) ([]byte, error)
+}
+
+type Png struct {
+	code int
+	body Pngable
+	buf  []byte
+}
+
+func NewPng(code int, body Pngable) *Png {
+	return &Png{
+		code: code,
+		body: body,
+		buf:  BufferPool.Get(),
+	}
+}
+
+func (r *Png) Code() int {
+	return r.code
+}
+
+func (r *Png) Close() {
+	BufferPool.Put(r.buf)
+}
+
+func (r *Png) Body() ([]byte, error) {
+	var err error
+	r.buf, err = r.body.PNG(r.buf)
+	return r.buf, err
+}
+
+func (r *Png) Headers() (headers map[string]string) {
+	return map[string]string{"content-type": "image/png"}
+}
+
+type Svgable interface {
+	SVG([]byte) ([]byte, error)
+}
+
+type Svg struct {
+	code int
+	body Svgable
+	buf  []byte
+}
+
+func NewSvg(code int, body Svgable) *Svg {
+	return &Svg{
+		code: code,
+		body: body,
+		buf:  BufferPool.Get(),
+	}
+}
+
+func (r *Svg) Code() int {
+	return r.code
+}
+
+func (r *Svg) Close() {
+	BufferPool.Put(r.buf)
+}
+
+func (r *Svg) Body() ([]byte, error) {
+	var err error
+	r.buf, err = r.body.SVG(r.buf)
+	return r.buf, err
+}
+
+func (r *Svg) Headers() (headers map[string]string) {
+	return map[string]string{"content-type": "image/svg+xml"}
+}
@@ -2,9 +2,11 @@ package response
 
 import (
 	"errors"
+	"io"
 	"net/http"
 
 	"github.com/grafana/metrictank/util"
+	log "github.com/sirupsen/logrus"
 )
 
 var ErrMetricNotFound = errors.New("metric not found")
@@ -13,6 +15,10 @@ var BufferPool = util.NewBufferPool() // used by pickle, fastjson and msgp respo
 
 func Write(w http.ResponseWriter, resp Response) {
 	defer resp.Close()
+	if s, ok := resp.(Streamer); ok {
+		stream(w, s)
+		return
+	}
 	body, err := resp.Body()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -33,3 +39,33 @@ type Response interface {
 	Headers() map[string]string
 	Close()
 }
+
+// Streamer is implemented by responses that can write their body in parts, as they are encoded
+type Streamer interface {
+	Response
+	WriteBody(w io.Writer) error
+}
+
+// flushWriter flushes every write to the client
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+func stream(w http.ResponseWriter, s Streamer) {
+	for k, v := range s.Headers() {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(s.Code())
+	// the status has been sent, so errors can only be reported by cutting the response short
+	if err := s.WriteBody(flushWriter{w}); err != nil {
+		log.Errorf("failed to stream response: %s", err.Error())
+	}
+}
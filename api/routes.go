@@ -52,6 +52,8 @@ func (s *Server) RegisterRoutes() {
 	r.Combo("/index/tags/delSeries", ready, bind(models.IndexTagDelSeries{})).Get(s.indexTagDelSeries).Post(s.indexTagDelSeries)
 	r.Combo("/index/tags/terms", ready, bind(models.IndexTagTerms{})).Get(s.IndexTagTerms).Post(s.IndexTagTerms)
 	r.Combo("/index/tags/delByQuery", ready, bind(models.IndexTagDelByQuery{})).Get(s.IndexTagDelByQuery).Post(s.IndexTagDelByQuery)
+	r.Post("/consistency/digest", ready, bind(models.ConsistencyDigest{}), s.consistencyDigest)
+	r.Post("/consistency/repair", ready, bind(models.ConsistencyRepair{}), s.consistencyRepair)
 
 	r.Options("/*", func(ctx *macaron.Context) {
 		ctx.Write(nil)
@@ -61,6 +63,7 @@ func (s *Server) RegisterRoutes() {
 	r.Combo("/showplan", cBody, withOrg, ready, bind(models.GraphiteRender{})).Get(s.showPlan).Post(s.showPlan)
 	r.Combo("/tags/terms", ready, bind(models.GraphiteTagTerms{})).Get(s.graphiteTagTerms).Post(s.graphiteTagTerms)
 	r.Combo("/ccache/delete", bind(models.CCacheDelete{})).Post(s.ccacheDelete).Get(s.ccacheDelete)
+	r.Combo("/consistency/check", ready, bind(models.ConsistencyCheck{})).Get(s.consistencyCheck).Post(s.consistencyCheck)
 	r.Combo("/tags/delByQuery", withOrg, ready, bind(models.GraphiteTagDelByQuery{})).Post(s.graphiteTagDelByQuery).Get(s.graphiteTagDelByQuery)
 
 	// Graphite endpoints
@@ -83,6 +86,19 @@ func (s *Server) RegisterRoutes() {
 	r.Post("/metaTags/swap", withOrg, ready, bind(models.MetaTagRecordSwap{}), s.metaTagRecordSwap)
 	r.Get("/metaTags", withOrg, ready, s.getMetaTagRecords)
 
+	// Macros
+	r.Post("/macros/upsert", withOrg, ready, bind(models.MacroUpsert{}), s.macroUpsert)
+	r.Post("/macros/delete", withOrg, ready, bind(models.MacroDelete{}), s.macroDelete)
+	r.Post("/macros/swap", withOrg, ready, bind(models.MacroSwap{}), s.macroSwap)
+	r.Get("/macros", withOrg, ready, s.getMacros)
+
+	// Events (graphite compatible)
+	r.Get("/events/get_data", withOrg, ready, bind(models.EventsGetData{}), s.eventsGetData)
+	r.Post("/events", withOrg, ready, bind(models.EventAdd{}), s.eventAdd)
+	r.Post("/events/", withOrg, ready, bind(models.EventAdd{}), s.eventAdd)
+	r.Get("/events/:id([0-9]+)", withOrg, ready, s.eventGet)
+	r.Delete("/events/:id([0-9]+)", withOrg, ready, s.eventDelete)
+
 	// Prometheus metrics endpoint
 	r.Get("/prometheus/metrics", promhttp.Handler())
 }
@@ -67,7 +67,8 @@ type partitionCandidates struct {
 // only 1 member per partition is returned.
 // The nodes are selected based on priority, preferring thisNode if it
 // has the lowest prio, otherwise using a random selection from all
-// nodes with the lowest prio.
+// nodes with the lowest prio. Nodes with an open circuit breaker are
+// only selected for partitions that no other node can serve.
 func MembersForQuery() ([]Node, error) {
 	thisNode := Manager.ThisNode()
 	// If we are running in dev mode, just return thisNode
@@ -92,14 +93,14 @@ func MembersForQuery() ([]Node, error) {
 			continue
 		}
 		for _, part := range member.GetPartitions() {
+			priority := queryPriority(member)
 			if _, ok := membersMap[part]; !ok {
 				membersMap[part] = &partitionCandidates{
-					priority: member.GetPriority(),
+					priority: priority,
 					nodes:    []Node{member},
 				}
 				continue
 			}
-			priority := member.GetPriority()
 			if membersMap[part].priority == priority {
 				membersMap[part].nodes = append(membersMap[part].nodes, member)
 			} else if membersMap[part].priority > priority {
@@ -156,7 +157,8 @@ LOOP:
 }
 
 // MembersForSpeculativeQuery returns a prioritized list of nodes for each shard group
-// keyed by the first (lowest) partition of their shard group
+// keyed by the first (lowest) partition of their shard group.
+// Nodes with an open circuit breaker come last.
 func MembersForSpeculativeQuery() (map[int32][]Node, error) {
 	thisNode := Manager.ThisNode()
 	allNodes := Manager.MemberList(true, true)
@@ -193,7 +195,7 @@ func MembersForSpeculativeQuery() (map[int32][]Node, error) {
 			shard[i], shard[j] = shard[j], shard[i]
 		}
 		sort.Slice(shard, func(i, j int) bool {
-			return shard[i].GetPriority() < shard[j].GetPriority()
+			return queryPriority(shard[i]) < queryPriority(shard[j])
 		})
 	}
 
@@ -92,6 +92,23 @@ func TestPeersForQueryShard(t *testing.T) {
 			}
 		})
 	})
+	Convey("when the circuit breaker of a peer is open", t, func() {
+		breakerErrorRatio, breakerMinRequests, breakerOpenPeriod = 0.5, 10, time.Minute
+		defer forgetHealth("node3")
+		for i := 0; i < 10; i++ {
+			Health("node3").Record(time.Second, true)
+		}
+		peerCount := make(map[string]int)
+		for i := 0; i < 100; i++ {
+			selected, err := MembersForQuery()
+			So(err, ShouldBeNil)
+			for _, p := range selected {
+				peerCount[p.GetName()]++
+			}
+		}
+		So(peerCount["node3"], ShouldEqual, 0)
+		So(peerCount["node4"], ShouldEqual, 100)
+	})
 	Convey("when shards missing", t, func() {
 		minAvailableShards = 5
 		selected, err := MembersForQuery()
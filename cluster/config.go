@@ -25,6 +25,22 @@ var (
 	gcPercentNotReady  int
 	GossipSettlePeriod time.Duration // if gossip not enabled, will be 0 regardless of config
 
+	primaryElection        bool
+	primaryElectionDelay   time.Duration
+	primaryElectionMaxPrio int
+	primaryElectionQuorum  int
+
+	discovery         string
+	discoveryName     string
+	discoveryFile     string
+	discoveryInterval time.Duration
+
+	peerStream bool
+
+	breakerErrorRatio  float64
+	breakerMinRequests int
+	breakerOpenPeriod  time.Duration
+
 	gossipSettlePeriodStr string
 
 	swimUseConfig               = "default-lan"
@@ -79,6 +95,18 @@ func ConfigSetup() {
 	clusterCfg.IntVar(&minAvailableShards, "min-available-shards", 0, "minimum number of shards that must be available for a query to be handled.")
 	clusterCfg.IntVar(&gcPercentNotReady, "gc-percent-not-ready", gcPercent, "GOGC value to use when node is not ready.  Defaults to GOGC")
 	clusterCfg.StringVar(&gossipSettlePeriodStr, "gossip-settle-period", "10s", "duration until when the cluster topology can be considered up-to-date and this node to be ready to serve requests (when gossip enabled).")
+	clusterCfg.BoolVar(&primaryElection, "primary-election", false, "automatically promote a secondary to primary when its shard group has no primary, and demote redundant primaries. (shard mode only)")
+	clusterCfg.DurationVar(&primaryElectionDelay, "primary-election-delay", 30*time.Second, "how long a shard group must be without a primary before a secondary promotes itself. also the minimum time the candidate must have been ready")
+	clusterCfg.IntVar(&primaryElectionMaxPrio, "primary-election-max-priority", 2, "maximum priority (e.g. kafka lag in seconds) of a secondary to be considered caught up enough to be promoted")
+	clusterCfg.IntVar(&primaryElectionQuorum, "primary-election-quorum", 1, "minimum number of cluster members (including this node) this node must see to promote itself. set to a majority of the cluster size to prevent nodes that are cut off from the cluster from promoting themselves")
+	clusterCfg.StringVar(&discovery, "discovery", "static", "how to find the peers to join. static uses the peers setting. dns-srv resolves the discovery-name SRV records, dns resolves the host of discovery-name (host:port) and file reads discovery-file (static|dns-srv|dns|file)")
+	clusterCfg.StringVar(&discoveryName, "discovery-name", "", "DNS name to resolve for dns-srv and dns discovery. e.g. _gossip._tcp.metrictank.default.svc.cluster.local or metrictank.default.svc.cluster.local:7946")
+	clusterCfg.StringVar(&discoveryFile, "discovery-file", "", "file with the TCP addresses of the peers, separated by commas or newlines, for file discovery")
+	clusterCfg.DurationVar(&discoveryInterval, "discovery-interval", 30*time.Second, "how often to discover the peers, and join those that are not members of the cluster")
+	clusterCfg.BoolVar(&peerStream, "peer-stream", true, "ask peers to stream their responses to data and index requests in a binary format, rather than buffering them. peers that don't support it respond with a regular http response")
+	clusterCfg.Float64Var(&breakerErrorRatio, "breaker-error-ratio", 0.5, "ratio of failed requests among the recent requests to a peer at which its circuit breaker opens, after which it is only queried for partitions that no other peer can serve. 0 disables the circuit breakers")
+	clusterCfg.IntVar(&breakerMinRequests, "breaker-min-requests", 10, "minimum number of recent requests to a peer before its circuit breaker can open")
+	clusterCfg.DurationVar(&breakerOpenPeriod, "breaker-open-period", 10*time.Second, "how long the circuit breaker of a peer stays open, before requests are sent to it again to probe whether it has recovered")
 	globalconf.Register("cluster", clusterCfg, flag.ExitOnError)
 
 	swimCfg := flag.NewFlagSet("swim", flag.ExitOnError)
@@ -131,6 +159,16 @@ func ConfigProcess() {
 		Timeout:   httpTimeout,
 	}
 
+	if breakerErrorRatio < 0 || breakerErrorRatio > 1 {
+		log.Fatal("CLU Config: breaker-error-ratio must be between 0 and 1")
+	}
+	if breakerMinRequests < 1 {
+		log.Fatal("CLU Config: breaker-min-requests must be at least 1")
+	}
+	if breakerOpenPeriod <= 0 {
+		log.Fatal("CLU Config: breaker-open-period must be a non-zero duration string like 10s")
+	}
+
 	// all further stuff is only relevant in shard/query mode
 	if Mode == ModeDev {
 		return
@@ -141,6 +179,39 @@ func ConfigProcess() {
 		log.Fatalf("CLU Config: invalid gossip-settle-period: %s", err.Error())
 	}
 
+	if primaryElection {
+		if primaryElectionDelay <= 0 {
+			log.Fatal("CLU Config: primary-election-delay must be a non-zero duration string like 30s")
+		}
+		if primaryElectionMaxPrio > maxPrio {
+			log.Fatal("CLU Config: primary-election-max-priority must not be larger than max-priority")
+		}
+		if primaryElectionQuorum < 1 {
+			log.Fatal("CLU Config: primary-election-quorum must be at least 1")
+		}
+	}
+
+	switch discovery {
+	case "static":
+	case "dns-srv":
+		if discoveryName == "" {
+			log.Fatal("CLU Config: discovery-name must be set for dns-srv discovery")
+		}
+	case "dns":
+		if _, _, err := net.SplitHostPort(discoveryName); err != nil {
+			log.Fatalf("CLU Config: discovery-name must be a host:port for dns discovery: %s", err.Error())
+		}
+	case "file":
+		if discoveryFile == "" {
+			log.Fatal("CLU Config: discovery-file must be set for file discovery")
+		}
+	default:
+		log.Fatalf("CLU Config: invalid discovery %q. must be one of static, dns-srv, dns or file", discovery)
+	}
+	if discovery != "static" && discoveryInterval <= 0 {
+		log.Fatal("CLU Config: discovery-interval must be a non-zero duration string like 30s")
+	}
+
 	// check settings in swim section
 	if swimUseConfig != "manual" && swimUseConfig != "default-lan" && swimUseConfig != "default-local" && swimUseConfig != "default-wan" {
 		log.Fatal("CLU Config: invalid swim-use-config setting")
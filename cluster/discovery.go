@@ -0,0 +1,225 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/stats"
+	"github.com/hashicorp/memberlist"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// metric cluster.discovery.healthy is whether the last discovery of peers succeeded
+	discoveryHealthy = stats.NewBool("cluster.discovery.healthy")
+	// metric cluster.discovery.errors is how many discoveries of peers failed
+	discoveryErrors = stats.NewCounter32("cluster.discovery.errors")
+	// metric cluster.discovery.peers is how many peers were found by the last successful discovery
+	discoveryPeers = stats.NewGauge32("cluster.discovery.peers")
+	// metric cluster.discovery.joins is how many discovered peers were joined because they were not members of the cluster
+	discoveryJoins = stats.NewCounter32("cluster.discovery.joins")
+)
+
+// resolver is the subset of net.Resolver used for discovery
+type resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// peerDiscovery finds the addresses of the peers to join, as host or host:port
+type peerDiscovery interface {
+	Peers(ctx context.Context) ([]string, error)
+	String() string
+}
+
+// dnsSRVDiscovery finds peers from the targets and ports of DNS SRV records,
+// e.g. those of a kubernetes headless service, or a consul service.
+type dnsSRVDiscovery struct {
+	name     string
+	resolver resolver
+}
+
+func (d dnsSRVDiscovery) Peers(ctx context.Context) ([]string, error) {
+	_, records, err := d.resolver.LookupSRV(ctx, "", "", d.name)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]string, 0, len(records))
+	for _, r := range records {
+		peers = append(peers, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+	}
+	return peers, nil
+}
+
+func (d dnsSRVDiscovery) String() string {
+	return "dns-srv " + d.name
+}
+
+// dnsDiscovery finds peers from the addresses of a host name, which all use the same port
+type dnsDiscovery struct {
+	host     string
+	port     string
+	resolver resolver
+}
+
+func (d dnsDiscovery) Peers(ctx context.Context) ([]string, error) {
+	addrs, err := d.resolver.LookupHost(ctx, d.host)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		peers = append(peers, net.JoinHostPort(addr, d.port))
+	}
+	return peers, nil
+}
+
+func (d dnsDiscovery) String() string {
+	return "dns " + net.JoinHostPort(d.host, d.port)
+}
+
+// fileDiscovery reads the peers from a file, separated by commas or whitespace.
+// lines starting with # are comments.
+// the file is re-read for every discovery, so changes are picked up without a restart.
+type fileDiscovery struct {
+	path string
+}
+
+func (d fileDiscovery) Peers(ctx context.Context) ([]string, error) {
+	data, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return nil, err
+	}
+	var peers []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		peers = append(peers, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})...)
+	}
+	return peers, nil
+}
+
+func (d fileDiscovery) String() string {
+	return "file " + d.path
+}
+
+// newPeerDiscovery returns the configured discovery, or nil if the peers are static
+func newPeerDiscovery() peerDiscovery {
+	switch discovery {
+	case "dns-srv":
+		return dnsSRVDiscovery{name: discoveryName, resolver: net.DefaultResolver}
+	case "dns":
+		host, port, _ := net.SplitHostPort(discoveryName) // already validated
+		return dnsDiscovery{host: host, port: port, resolver: net.DefaultResolver}
+	case "file":
+		return fileDiscovery{path: discoveryFile}
+	}
+	return nil
+}
+
+// discoverPeers returns the sorted, deduplicated addresses of the discovered peers, as ip:port.
+// host names are resolved, and peers without port are assumed to use defaultPort, like memberlist does.
+// peers whose name can't be resolved are skipped, as they may just not have been registered in DNS yet.
+func discoverPeers(ctx context.Context, d peerDiscovery, r resolver, defaultPort int) ([]string, error) {
+	peers, err := d.Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	var out []string
+	for _, peer := range peers {
+		host, port, err := net.SplitHostPort(peer)
+		if err != nil {
+			host, port = peer, strconv.Itoa(defaultPort)
+		}
+		addrs := []string{host}
+		if net.ParseIP(host) == nil {
+			addrs, err = r.LookupHost(ctx, host)
+			if err != nil {
+				log.Warnf("CLU discovery: skipping peer %s: %s", peer, err.Error())
+				continue
+			}
+		}
+		for _, addr := range addrs {
+			addr = net.JoinHostPort(addr, port)
+			if _, ok := seen[addr]; !ok {
+				seen[addr] = struct{}{}
+				out = append(out, addr)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// unknownPeers returns the peers that are not members of the cluster
+func unknownPeers(peers []string, members []*memberlist.Node) []string {
+	known := make(map[string]struct{}, len(members))
+	for _, m := range members {
+		known[net.JoinHostPort(m.Addr.String(), strconv.Itoa(int(m.Port)))] = struct{}{}
+	}
+	var out []string
+	for _, peer := range peers {
+		if _, ok := known[peer]; !ok {
+			out = append(out, peer)
+		}
+	}
+	return out
+}
+
+// runDiscovery discovers the peers every interval, and joins those that are not (or no longer) members of the cluster,
+// e.g. because they were just started, or because they were declared dead during a network partition.
+func (c *MemberlistManager) runDiscovery(d peerDiscovery, interval time.Duration, stop chan struct{}) {
+	log.Infof("CLU discovery: discovering peers via %s every %s", d, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.discover(d, interval); err != nil {
+			discoveryHealthy.SetFalse()
+			discoveryErrors.Inc()
+			log.Errorf("CLU discovery: failed to discover peers via %s: %s", d, err.Error())
+		} else {
+			discoveryHealthy.SetTrue()
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *MemberlistManager) discover(d peerDiscovery, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	peers, err := discoverPeers(ctx, d, net.DefaultResolver, c.cfg.BindPort)
+	if err != nil {
+		return err
+	}
+	discoveryPeers.Set(len(peers))
+
+	c.RLock()
+	list := c.list
+	c.RUnlock()
+	peers = unknownPeers(peers, list.Members())
+	if len(peers) == 0 {
+		return nil
+	}
+	n, err := list.Join(peers)
+	discoveryJoins.Add(n)
+	if err != nil && n == 0 {
+		return fmt.Errorf("failed to join any of %v: %s", peers, err.Error())
+	}
+	log.Infof("CLU discovery: joined %d of the new peers %v", n, peers)
+	return nil
+}
@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// stubResolver resolves from fixed records
+type stubResolver struct {
+	srv   map[string][]*net.SRV
+	hosts map[string][]string
+}
+
+func (r stubResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	records, ok := r.srv[name]
+	if !ok {
+		return "", nil, fmt.Errorf("no such host %s", name)
+	}
+	return name, records, nil
+}
+
+func (r stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	return addrs, nil
+}
+
+var testResolver = stubResolver{
+	srv: map[string][]*net.SRV{
+		"_gossip._tcp.mt.svc": {
+			{Target: "mt-0.mt.svc.", Port: 7946},
+			{Target: "mt-1.mt.svc.", Port: 7946},
+			{Target: "mt-2.mt.svc.", Port: 7946}, // not resolvable yet
+		},
+	},
+	hosts: map[string][]string{
+		"mt.svc":       {"10.0.0.2", "10.0.0.1"},
+		"mt-0.mt.svc":  {"10.0.0.1"},
+		"mt-1.mt.svc":  {"10.0.0.2"},
+		"query.mt.svc": {"10.0.1.1"},
+	},
+}
+
+func TestDiscoverPeers(t *testing.T) {
+	f, err := ioutil.TempFile("", "peers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# shard nodes\n10.0.0.1:7946, 10.0.0.2:7946\n\n10.0.0.1:7946\nquery.mt.svc\n")
+	f.Close()
+
+	cases := []struct {
+		d   peerDiscovery
+		exp []string
+	}{
+		{dnsSRVDiscovery{"_gossip._tcp.mt.svc", testResolver}, []string{"10.0.0.1:7946", "10.0.0.2:7946"}},
+		{dnsDiscovery{"mt.svc", "7000", testResolver}, []string{"10.0.0.1:7000", "10.0.0.2:7000"}},
+		{fileDiscovery{f.Name()}, []string{"10.0.0.1:7946", "10.0.0.2:7946", "10.0.1.1:7946"}},
+	}
+	for _, c := range cases {
+		peers, err := discoverPeers(context.Background(), c.d, testResolver, 7946)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", c.d, err)
+		}
+		if !reflect.DeepEqual(peers, c.exp) {
+			t.Fatalf("%s: expected peers %v, got %v", c.d, c.exp, peers)
+		}
+	}
+
+	failing := []peerDiscovery{
+		dnsSRVDiscovery{"_gossip._tcp.unknown.svc", testResolver},
+		dnsDiscovery{"unknown.svc", "7946", testResolver},
+		fileDiscovery{f.Name() + ".missing"},
+	}
+	for _, d := range failing {
+		if _, err := discoverPeers(context.Background(), d, testResolver, 7946); err == nil {
+			t.Fatalf("%s: expected error", d)
+		}
+	}
+}
+
+func TestUnknownPeers(t *testing.T) {
+	members := []*memberlist.Node{
+		{Addr: net.ParseIP("10.0.0.1"), Port: 7946},
+		{Addr: net.ParseIP("10.0.0.2"), Port: 7000},
+	}
+	peers := []string{"10.0.0.1:7946", "10.0.0.2:7946", "10.0.0.3:7946"}
+	exp := []string{"10.0.0.2:7946", "10.0.0.3:7946"}
+	if got := unknownPeers(peers, members); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
@@ -0,0 +1,167 @@
+package cluster
+
+import (
+	"sort"
+	"time"
+
+	"github.com/grafana/metrictank/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// metric cluster.election.promotions is how many times this node promoted itself to primary because its shard group had none
+	electionPromotions = stats.NewCounter32("cluster.election.promotions")
+	// metric cluster.election.demotions is how many times this node demoted itself to secondary because its shard group had another primary
+	electionDemotions = stats.NewCounter32("cluster.election.demotions")
+)
+
+type electionAction uint8
+
+const (
+	electionNone electionAction = iota
+	electionPromote
+	electionDemote
+)
+
+// elect decides whether self should change its primary status, based on the state of the
+// other members of its shard group (the shard nodes consuming the same partitions).
+// members is the cluster as seen by self, and may include self.
+// leaderless is when self first saw its shard group without a primary, or zero if it has one.
+// the updated value of leaderless is returned, along with the action to take.
+//
+// Every member runs the same election against its own view of the gossiped cluster state.
+// A secondary only promotes itself when the group has been without primary for primaryElectionDelay,
+// and it is the best candidate: ready, caught up (low priority), and preferring the node that has been
+// running the longest, as it is the most likely to have complete chunks in memory.
+// Views may briefly disagree while gossip propagates, so multiple nodes may promote themselves.
+// To resolve such split-brain situations, a primary that sees another primary in its group
+// that became primary before it (ties broken by name) demotes itself.
+func elect(self HTTPNode, members []HTTPNode, leaderless, now time.Time) (electionAction, time.Time) {
+	if self.Mode != ModeShard || !self.HasData() {
+		return electionNone, time.Time{}
+	}
+	var group []HTTPNode
+	for _, m := range members {
+		if m.Name != self.Name && m.Mode == ModeShard && samePartitions(m.Partitions, self.Partitions) {
+			group = append(group, m)
+		}
+	}
+
+	if self.Primary {
+		for _, m := range group {
+			if m.Primary && primaryOutranks(m, self) {
+				return electionDemote, time.Time{}
+			}
+		}
+		return electionNone, time.Time{}
+	}
+
+	// any primary counts, even one that is not ready: it may just be lagging, but will still save its chunks
+	for _, m := range group {
+		if m.Primary {
+			return electionNone, time.Time{}
+		}
+	}
+	if leaderless.IsZero() {
+		leaderless = now
+	}
+	if now.Sub(leaderless) < primaryElectionDelay {
+		return electionNone, leaderless
+	}
+
+	// guard against promoting ourselves when we're cut off from the rest of the cluster
+	seen := 1
+	for _, m := range members {
+		if m.Name != self.Name {
+			seen++
+		}
+	}
+	if seen < primaryElectionQuorum {
+		return electionNone, leaderless
+	}
+
+	if !isCandidate(self) || now.Sub(self.StateChange) < primaryElectionDelay {
+		return electionNone, leaderless
+	}
+	for _, m := range group {
+		if isCandidate(m) && candidateOutranks(m, self) {
+			return electionNone, leaderless
+		}
+	}
+	return electionPromote, time.Time{}
+}
+
+// isCandidate returns whether the node is healthy and caught up enough to become primary
+func isCandidate(n HTTPNode) bool {
+	return n.IsReady() && n.Priority <= primaryElectionMaxPrio
+}
+
+// candidateOutranks returns whether candidate a is preferred over candidate b to become primary
+func candidateOutranks(a, b HTTPNode) bool {
+	if a.Priority != b.Priority {
+		return a.Priority < b.Priority
+	}
+	if !a.Started.Equal(b.Started) {
+		return a.Started.Before(b.Started)
+	}
+	return a.Name < b.Name
+}
+
+// primaryOutranks returns whether primary a should remain primary over primary b
+func primaryOutranks(a, b HTTPNode) bool {
+	if !a.PrimaryChange.Equal(b.PrimaryChange) {
+		return a.PrimaryChange.Before(b.PrimaryChange)
+	}
+	return a.Name < b.Name
+}
+
+// samePartitions returns whether the partition lists have the same partitions.
+// they are in the order of the configuration of the nodes, which may differ between replicas
+func samePartitions(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sorted := func(p []int32) []int32 {
+		out := make([]int32, len(p))
+		copy(out, p)
+		sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+		return out
+	}
+	a, b = sorted(a), sorted(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// runElection periodically runs the primary election, until stop is closed
+func (c *MemberlistManager) runElection(stop chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var leaderless time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			var action electionAction
+			prev := leaderless
+			action, leaderless = elect(c.thisNode(), c.memberList(false, false), leaderless, now)
+			if prev.IsZero() && !leaderless.IsZero() {
+				log.Warnf("CLU election: shard group of this node has no primary. will promote the best candidate after %s", primaryElectionDelay)
+			}
+			switch action {
+			case electionPromote:
+				log.Infof("CLU election: promoting this node to primary")
+				electionPromotions.Inc()
+				c.SetPrimary(true)
+			case electionDemote:
+				log.Infof("CLU election: shard group of this node has another primary. demoting this node to secondary")
+				electionDemotions.Inc()
+				c.SetPrimary(false)
+			}
+		}
+	}
+}
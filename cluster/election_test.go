@@ -0,0 +1,194 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestElect(t *testing.T) {
+	maxPrio = 10
+	primaryElectionDelay = 30 * time.Second
+	primaryElectionMaxPrio = 2
+	primaryElectionQuorum = 1
+
+	now := time.Now()
+	longAgo := now.Add(-time.Hour)
+	node := func(name string, primary bool, prio int, partitions ...int32) HTTPNode {
+		return HTTPNode{
+			Name:          name,
+			Primary:       primary,
+			PrimaryChange: longAgo,
+			Mode:          ModeShard,
+			State:         NodeReady,
+			Priority:      prio,
+			Started:       longAgo,
+			StateChange:   longAgo,
+			Partitions:    partitions,
+		}
+	}
+	notReady := func(n HTTPNode) HTTPNode {
+		n.State = NodeNotReady
+		return n
+	}
+	started := func(n HTTPNode, t time.Time) HTTPNode {
+		n.Started = t
+		return n
+	}
+	primaryChange := func(n HTTPNode, t time.Time) HTTPNode {
+		n.PrimaryChange = t
+		return n
+	}
+
+	type testCase struct {
+		name       string
+		self       HTTPNode
+		others     []HTTPNode
+		leaderless time.Time
+		quorum     int
+		expAction  electionAction
+		expSince   time.Time
+	}
+	cases := []testCase{
+		{
+			name:       "group has a primary",
+			self:       node("b", false, 0, 1, 2),
+			others:     []HTTPNode{node("a", true, 0, 1, 2)},
+			leaderless: longAgo,
+			expAction:  electionNone,
+		},
+		{
+			name:       "group has a primary with the partitions configured in another order",
+			self:       node("b", false, 0, 2, 1),
+			others:     []HTTPNode{node("a", true, 0, 1, 2)},
+			leaderless: longAgo,
+			expAction:  electionNone,
+		},
+		{
+			name:       "group has a primary that is not ready",
+			self:       node("b", false, 0, 1, 2),
+			others:     []HTTPNode{notReady(node("a", true, 0, 1, 2))},
+			leaderless: longAgo,
+			expAction:  electionNone,
+		},
+		{
+			name:      "group just became leaderless",
+			self:      node("b", false, 0, 1, 2),
+			others:    []HTTPNode{node("a", true, 0, 3, 4)},
+			expAction: electionNone,
+			expSince:  now,
+		},
+		{
+			name:       "group leaderless shorter than the delay",
+			self:       node("b", false, 0, 1, 2),
+			leaderless: now.Add(-10 * time.Second),
+			expAction:  electionNone,
+			expSince:   now.Add(-10 * time.Second),
+		},
+		{
+			name:       "best candidate",
+			self:       node("b", false, 0, 1, 2),
+			others:     []HTTPNode{node("a", false, 1, 1, 2), node("c", true, 0, 3, 4)},
+			leaderless: longAgo,
+			expAction:  electionPromote,
+		},
+		{
+			name:       "other candidate has lower priority",
+			self:       node("b", false, 1, 1, 2),
+			others:     []HTTPNode{node("a", false, 0, 1, 2)},
+			leaderless: longAgo,
+			expAction:  electionNone,
+			expSince:   longAgo,
+		},
+		{
+			name:       "other candidate has been running longer",
+			self:       node("a", false, 0, 1, 2),
+			others:     []HTTPNode{started(node("b", false, 0, 1, 2), longAgo.Add(-time.Hour))},
+			leaderless: longAgo,
+			expAction:  electionNone,
+			expSince:   longAgo,
+		},
+		{
+			name:       "ties are broken by name",
+			self:       node("b", false, 0, 1, 2),
+			others:     []HTTPNode{node("a", false, 0, 1, 2)},
+			leaderless: longAgo,
+			expAction:  electionNone,
+			expSince:   longAgo,
+		},
+		{
+			name:       "better candidates that are not ready or lagging are ignored",
+			self:       node("c", false, 2, 1, 2),
+			others:     []HTTPNode{notReady(node("a", false, 0, 1, 2)), node("b", false, 5, 1, 2)},
+			leaderless: longAgo,
+			expAction:  electionPromote,
+		},
+		{
+			name:       "self is lagging",
+			self:       node("b", false, 5, 1, 2),
+			leaderless: longAgo,
+			expAction:  electionNone,
+			expSince:   longAgo,
+		},
+		{
+			name:       "self has not been ready for long enough",
+			self:       func() HTTPNode { n := node("b", false, 0, 1, 2); n.StateChange = now; return n }(),
+			leaderless: longAgo,
+			expAction:  electionNone,
+			expSince:   longAgo,
+		},
+		{
+			name:       "self sees too few members",
+			self:       node("b", false, 0, 1, 2),
+			others:     []HTTPNode{node("c", true, 0, 3, 4)},
+			leaderless: longAgo,
+			quorum:     3,
+			expAction:  electionNone,
+			expSince:   longAgo,
+		},
+		{
+			name:      "primary that became primary first stays primary",
+			self:      primaryChange(node("b", true, 0, 1, 2), now),
+			others:    []HTTPNode{node("a", true, 0, 1, 2), node("c", true, 0, 1, 2)},
+			expAction: electionDemote,
+		},
+		{
+			name:      "primary that became primary first demotes the other",
+			self:      node("b", true, 0, 1, 2),
+			others:    []HTTPNode{primaryChange(node("a", true, 0, 1, 2), now)},
+			expAction: electionNone,
+		},
+		{
+			name:      "primaries that changed at the same time are broken by name",
+			self:      node("b", true, 0, 1, 2),
+			others:    []HTTPNode{node("a", true, 0, 1, 2)},
+			expAction: electionDemote,
+		},
+		{
+			name:      "primaries with the partitions configured in another order are in the same group",
+			self:      node("b", true, 0, 2, 1),
+			others:    []HTTPNode{node("a", true, 0, 1, 2)},
+			expAction: electionDemote,
+		},
+		{
+			name:       "query nodes have no shard group",
+			self:       func() HTTPNode { n := node("q", false, 0); n.Mode = ModeQuery; return n }(),
+			leaderless: longAgo,
+			expAction:  electionNone,
+		},
+	}
+	for _, c := range cases {
+		primaryElectionQuorum = 1
+		if c.quorum > 0 {
+			primaryElectionQuorum = c.quorum
+		}
+		members := append([]HTTPNode{c.self}, c.others...)
+		action, since := elect(c.self, members, c.leaderless, now)
+		if action != c.expAction {
+			t.Errorf("%s: expected action %d, got %d", c.name, c.expAction, action)
+		}
+		if !since.Equal(c.expSince) {
+			t.Errorf("%s: expected leaderless since %v, got %v", c.name, c.expSince, since)
+		}
+	}
+	primaryElectionQuorum = 1
+}
@@ -0,0 +1,222 @@
+package cluster
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/metrictank/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// metric cluster.breaker.trips is how many times the circuit breaker of a peer opened
+var breakerTrips = stats.NewCounter32("cluster.breaker.trips")
+
+// the health of a peer is based on its most recent requests
+const healthWindow = 100
+
+// the minimum number of successful recent requests to a peer for its latency quantiles to be known
+const healthMinLatencies = 10
+
+//go:generate stringer -type=BreakerState -trimprefix=Breaker
+type BreakerState uint8
+
+const (
+	BreakerClosed   BreakerState = iota // requests to the peer flow as usual
+	BreakerOpen                         // the peer is only used for partitions that no other peer can serve
+	BreakerHalfOpen                     // the peer is used again, and the next request decides whether the breaker closes or opens again
+)
+
+// MarshalJSON marshals a BreakerState
+func (s BreakerState) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+// PeerHealth tracks the latency and errors of the recent requests to a peer, and the state of its circuit breaker.
+// the breaker opens when too many of the recent requests failed, and half-opens after breaker-open-period.
+type PeerHealth struct {
+	sync.Mutex
+	name      string
+	latencies [healthWindow]time.Duration
+	failed    [healthWindow]bool
+	n         int // number of requests in the window
+	pos       int // position of the next request in the window
+	state     BreakerState
+	opened    time.Time
+}
+
+// Record records the outcome of a request to the peer
+func (h *PeerHealth) Record(latency time.Duration, failed bool) {
+	h.Lock()
+	defer h.Unlock()
+	h.latencies[h.pos] = latency
+	h.failed[h.pos] = failed
+	h.pos = (h.pos + 1) % healthWindow
+	if h.n < healthWindow {
+		h.n++
+	}
+
+	if breakerErrorRatio == 0 {
+		return
+	}
+	switch h.getState() {
+	case BreakerClosed:
+		if h.n >= breakerMinRequests && h.errorRatio() >= breakerErrorRatio {
+			h.open()
+		}
+	case BreakerHalfOpen:
+		if failed {
+			h.open()
+			return
+		}
+		log.Infof("CLU health: circuit breaker of peer %s closed", h.name)
+		h.state = BreakerClosed
+		// forget the failures that opened the breaker
+		h.n, h.pos = 0, 0
+	}
+}
+
+func (h *PeerHealth) open() {
+	log.Warnf("CLU health: circuit breaker of peer %s opened. %d of its last %d requests failed", h.name, h.failures(), h.n)
+	breakerTrips.Inc()
+	h.state = BreakerOpen
+	h.opened = time.Now()
+}
+
+// getState returns the state of the breaker, which half-opens once it has been open for breakerOpenPeriod.
+// h must be locked.
+func (h *PeerHealth) getState() BreakerState {
+	if h.state == BreakerOpen && time.Since(h.opened) >= breakerOpenPeriod {
+		h.state = BreakerHalfOpen
+	}
+	return h.state
+}
+
+// State returns the state of the circuit breaker of the peer
+func (h *PeerHealth) State() BreakerState {
+	h.Lock()
+	defer h.Unlock()
+	return h.getState()
+}
+
+func (h *PeerHealth) failures() int {
+	var failures int
+	for i := 0; i < h.n; i++ {
+		if h.failed[i] {
+			failures++
+		}
+	}
+	return failures
+}
+
+func (h *PeerHealth) errorRatio() float64 {
+	if h.n == 0 {
+		return 0
+	}
+	return float64(h.failures()) / float64(h.n)
+}
+
+// quantiles returns the given quantiles of the latency of the successful recent requests,
+// and whether there were enough of them. h must be locked.
+func (h *PeerHealth) quantiles(qs ...float64) ([]time.Duration, bool) {
+	latencies := make([]time.Duration, 0, h.n)
+	for i := 0; i < h.n; i++ {
+		if !h.failed[i] {
+			latencies = append(latencies, h.latencies[i])
+		}
+	}
+	if len(latencies) < healthMinLatencies {
+		return nil, false
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	out := make([]time.Duration, len(qs))
+	for i, q := range qs {
+		out[i] = latencies[int(q*float64(len(latencies)-1))]
+	}
+	return out, true
+}
+
+// Quantile returns the given quantile (e.g. 0.9) of the latency of the successful recent requests to the peer,
+// and whether there were enough of them to tell
+func (h *PeerHealth) Quantile(q float64) (time.Duration, bool) {
+	h.Lock()
+	defer h.Unlock()
+	out, ok := h.quantiles(q)
+	if !ok {
+		return 0, false
+	}
+	return out[0], true
+}
+
+// PeerHealthStatus is the health of a peer, as shown in /cluster
+type PeerHealthStatus struct {
+	Breaker    BreakerState `json:"breaker"`
+	Requests   int          `json:"requests"` // number of recent requests the status is based on
+	ErrorRatio float64      `json:"errorRatio"`
+	LatencyP50 string       `json:"latencyP50,omitempty"`
+	LatencyP90 string       `json:"latencyP90,omitempty"`
+	LatencyP99 string       `json:"latencyP99,omitempty"`
+}
+
+func (h *PeerHealth) Status() PeerHealthStatus {
+	h.Lock()
+	defer h.Unlock()
+	status := PeerHealthStatus{
+		Breaker:    h.getState(),
+		Requests:   h.n,
+		ErrorRatio: h.errorRatio(),
+	}
+	if q, ok := h.quantiles(0.5, 0.9, 0.99); ok {
+		status.LatencyP50 = q[0].String()
+		status.LatencyP90 = q[1].String()
+		status.LatencyP99 = q[2].String()
+	}
+	return status
+}
+
+var peerHealth = struct {
+	sync.Mutex
+	peers map[string]*PeerHealth
+}{peers: make(map[string]*PeerHealth)}
+
+// Health returns the health of the peer with the given name
+func Health(name string) *PeerHealth {
+	peerHealth.Lock()
+	defer peerHealth.Unlock()
+	h, ok := peerHealth.peers[name]
+	if !ok {
+		h = &PeerHealth{name: name}
+		peerHealth.peers[name] = h
+	}
+	return h
+}
+
+// HealthStatus returns the health status of all peers that have been sent requests, by name
+func HealthStatus() map[string]PeerHealthStatus {
+	peerHealth.Lock()
+	defer peerHealth.Unlock()
+	out := make(map[string]PeerHealthStatus, len(peerHealth.peers))
+	for name, h := range peerHealth.peers {
+		out[name] = h.Status()
+	}
+	return out
+}
+
+// forgetHealth forgets the health of a peer that left the cluster
+func forgetHealth(name string) {
+	peerHealth.Lock()
+	delete(peerHealth.peers, name)
+	peerHealth.Unlock()
+}
+
+// queryPriority returns the priority of the node for the selection of the nodes to query.
+// nodes with an open circuit breaker rank after all ready nodes, so they are only used for partitions no other node can serve.
+func queryPriority(n Node) int {
+	peerHealth.Lock()
+	h, ok := peerHealth.peers[n.GetName()]
+	peerHealth.Unlock()
+	if !ok || h.State() != BreakerOpen {
+		return n.GetPriority()
+	}
+	return n.GetPriority() + maxPrio + 1
+}
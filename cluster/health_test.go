@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	breakerErrorRatio, breakerMinRequests, breakerOpenPeriod = 0.5, 10, time.Minute
+	defer func() { breakerErrorRatio = 0 }()
+	h := &PeerHealth{name: "peer"}
+
+	// too few requests to tell
+	for i := 0; i < 5; i++ {
+		h.Record(time.Millisecond, true)
+	}
+	if s := h.State(); s != BreakerClosed {
+		t.Fatalf("expected breaker to be closed after 5 requests, got %s", s)
+	}
+
+	for i := 0; i < 5; i++ {
+		h.Record(time.Millisecond, false)
+	}
+	if s := h.State(); s != BreakerOpen {
+		t.Fatalf("expected breaker to open when half of the requests failed, got %s", s)
+	}
+
+	// after the open period, a failed probe opens it again, and a successful one closes it
+	h.opened = time.Now().Add(-time.Minute)
+	if s := h.State(); s != BreakerHalfOpen {
+		t.Fatalf("expected breaker to half-open after the open period, got %s", s)
+	}
+	h.Record(time.Millisecond, true)
+	if s := h.State(); s != BreakerOpen {
+		t.Fatalf("expected breaker to open again after a failed probe, got %s", s)
+	}
+	h.opened = time.Now().Add(-time.Minute)
+	h.Record(time.Millisecond, false)
+	if s := h.State(); s != BreakerClosed {
+		t.Fatalf("expected breaker to close after a successful probe, got %s", s)
+	}
+	if status := h.Status(); status.Requests != 0 || status.ErrorRatio != 0 {
+		t.Fatalf("expected the failures to be forgotten once the breaker closed, got %+v", status)
+	}
+}
+
+func TestHealthQuantile(t *testing.T) {
+	h := &PeerHealth{name: "peer"}
+	for i := 1; i <= healthMinLatencies-1; i++ {
+		h.Record(time.Duration(i)*time.Millisecond, false)
+	}
+	if _, ok := h.Quantile(0.5); ok {
+		t.Fatal("expected quantile to be unknown with too few requests")
+	}
+
+	// failed requests don't count towards the latency
+	h.Record(time.Minute, true)
+	for i := healthMinLatencies; i <= 2*healthWindow; i++ {
+		h.Record(time.Duration(i)*time.Millisecond, false)
+	}
+	// the window holds the latencies of the last 100 requests: 101ms-200ms
+	cases := map[float64]time.Duration{0: 101 * time.Millisecond, 0.5: 150 * time.Millisecond, 0.99: 199 * time.Millisecond}
+	for q, exp := range cases {
+		if got, ok := h.Quantile(q); !ok || got != exp {
+			t.Fatalf("expected quantile %f to be %s, got %s (known: %t)", q, exp, got, ok)
+		}
+	}
+}
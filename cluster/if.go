@@ -13,5 +13,6 @@ type Node interface {
 	HasData() bool
 	Post(context.Context, string, string, Traceable) ([]byte, error)
 	PostRaw(ctx context.Context, name, path string, body Traceable) (io.ReadCloser, error)
+	PostStream(ctx context.Context, name, path string, body Traceable) (*StreamReader, error)
 	GetName() string
 }
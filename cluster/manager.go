@@ -73,6 +73,7 @@ type MemberlistManager struct {
 	nodeName string
 	list     *memberlist.Memberlist
 	cfg      *memberlist.Config
+	stop     chan struct{}
 }
 
 func NewMemberlistManager(thisNode HTTPNode) *MemberlistManager {
@@ -81,6 +82,7 @@ func NewMemberlistManager(thisNode HTTPNode) *MemberlistManager {
 			thisNode.Name: thisNode,
 		},
 		nodeName: thisNode.Name,
+		stop:     make(chan struct{}),
 	}
 	switch swimUseConfig {
 	case "manual":
@@ -134,6 +136,15 @@ func (c *MemberlistManager) Start() {
 	}
 	c.setList(list)
 
+	if primaryElection && Mode == ModeShard {
+		go c.runElection(c.stop)
+	}
+
+	if d := newPeerDiscovery(); d != nil {
+		go c.runDiscovery(d, discoveryInterval, c.stop)
+		return
+	}
+
 	if peersStr == "" {
 		return
 	}
@@ -272,6 +283,7 @@ func (c *MemberlistManager) NotifyLeave(node *memberlist.Node) {
 	defer c.Unlock()
 	log.Infof("CLU manager: HTTPNode %s has left the cluster", node.Name)
 	delete(c.members, node.Name)
+	forgetHealth(node.Name)
 	c.clusterStats()
 }
 
@@ -455,6 +467,7 @@ func (c *MemberlistManager) SetPriority(prio int) {
 }
 
 func (c *MemberlistManager) Stop() {
+	close(c.stop)
 	c.list.Leave(time.Second)
 }
 
@@ -46,6 +46,10 @@ func (n MockNode) PostRaw(ctx context.Context, name, path string, body Traceable
 	return ioutil.NopCloser(bytes.NewReader(n.postResponse)), nil
 }
 
+func (n MockNode) PostStream(ctx context.Context, name, path string, body Traceable) (*StreamReader, error) {
+	return NewStreamReader(ioutil.NopCloser(bytes.NewReader(n.postResponse)), false), nil
+}
+
 func (n *MockNode) GetName() string {
 	return n.name
 }
@@ -256,6 +256,60 @@ func (n *HTTPNode) SetPartitions(part []int32) {
 }
 
 func (n HTTPNode) PostRaw(ctx context.Context, name, path string, body Traceable) (io.ReadCloser, error) {
+	rsp, err := n.post(ctx, name, path, body, false)
+	if rsp == nil || err != nil {
+		return nil, err
+	}
+	return rsp.Body, nil
+}
+
+// PostStream is like PostRaw, but asks the peer to stream its response, unless disabled via the peer-stream setting.
+// Peers that don't support streams respond with their buffered response instead.
+func (n HTTPNode) PostStream(ctx context.Context, name, path string, body Traceable) (*StreamReader, error) {
+	pre := time.Now()
+	rsp, err := n.post(ctx, name, path, body, peerStream)
+	if rsp == nil || err != nil {
+		return nil, err
+	}
+	streamed := isStream(rsp)
+	if peerStream && !streamed {
+		streamFallbacks.Inc()
+	}
+	reader := NewStreamReader(rsp.Body, streamed)
+	if streamed {
+		// the peer responds as soon as it starts the stream, so the request is only done when the stream has ended
+		health := Health(n.Name)
+		reader.onFinish = func(err error) {
+			if ctx.Err() != nil {
+				// canceled by us, e.g. because another peer responded first
+				return
+			}
+			health.Record(time.Since(pre), peerFailed(err))
+		}
+	}
+	return reader, nil
+}
+
+func isStream(rsp *http.Response) bool {
+	return rsp.Header.Get("Content-Type") == StreamContentType
+}
+
+// peerFailed returns whether the error means the peer failed to handle the request.
+// requests that the peer rejects are not held against it, only its failures are
+func peerFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+	if e, ok := err.(*Error); ok {
+		return e.code >= 500
+	}
+	return true
+}
+
+// post sends the request to the peer, and returns its response if it succeeded.
+// if stream is true, the peer is asked to stream the response. streams are not compressed,
+// so that the items can be flushed to us as they are produced.
+func (n HTTPNode) post(ctx context.Context, name, path string, body Traceable, stream bool) (*http.Response, error) {
 	ctx, span := tracing.NewSpan(ctx, Tracer, name)
 	tags.SpanKindRPCClient.Set(span)
 	tags.PeerService.Set(span, "metrictank")
@@ -292,6 +346,11 @@ func (n HTTPNode) PostRaw(ctx context.Context, name, path string, body Traceable
 	req.Header.Add("Content-Type", "application/json")
 	ua := fmt.Sprintf("metrictank/%s (mode %s; state %s) Go/%s", n.Version, n.Mode.String(), n.State.String(), runtime.Version())
 	req.Header.Set("User-Agent", ua)
+	if stream {
+		req.Header.Set("Accept", StreamContentType)
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	pre := time.Now()
 	rsp, err := client.Do(req)
 
 	select {
@@ -302,6 +361,17 @@ func (n HTTPNode) PostRaw(ctx context.Context, name, path string, body Traceable
 	default:
 	}
 
+	// requests that the peer rejects are not held against it, only its failures are
+	health := Health(n.Name)
+	switch {
+	case err != nil || rsp.StatusCode >= 500:
+		health.Record(time.Since(pre), true)
+	case rsp.StatusCode == 200 && isStream(rsp):
+		// recorded once the stream has ended. see PostStream
+	default:
+		health.Record(time.Since(pre), false)
+	}
+
 	if err != nil {
 		tags.Error.Set(span, true)
 		log.Errorf("CLU HTTPNode: error trying to talk to peer %s: %s", n.Name, err.Error())
@@ -313,7 +383,7 @@ func (n HTTPNode) PostRaw(ctx context.Context, name, path string, body Traceable
 		rsp.Body.Close()
 		return nil, NewError(rsp.StatusCode, fmt.Errorf(rsp.Status))
 	}
-	return rsp.Body, nil
+	return rsp, nil
 }
 
 func (n HTTPNode) Post(ctx context.Context, name, path string, body Traceable) (ret []byte, err error) {
@@ -0,0 +1,246 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/stats"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// StreamContentType is the content type of streamed peer responses.
+// peers ask for a stream by accepting it, and peers that don't support streams
+// ignore it and respond with their regular buffered response.
+const StreamContentType = "application/x-metrictank-stream"
+
+// a stream is a sequence of frames, each consisting of the frame type followed by its msgp encoded payload.
+// a stream must end with an end, trailer or error frame. if it doesn't, the peer went away mid-response.
+const (
+	frameItem    uint8 = iota // payload is an item of the response
+	frameEnd                  // no payload
+	frameTrailer              // payload is the trailer of the response, e.g. the stats of a getdata request
+	frameError                // payload is the http status code and the error message
+)
+
+// how often a stream is flushed to the peer, while items are being written to it
+var streamFlushInterval = 100 * time.Millisecond
+
+// metric cluster.stream.fallbacks is how many requests to peers that asked for a stream, got a buffered response
+var streamFallbacks = stats.NewCounter32("cluster.stream.fallbacks")
+
+var errNoTrailer = errors.New("stream has no trailer")
+
+// WantsStream returns whether the peer that sent the request accepts a streamed response
+func WantsStream(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), StreamContentType)
+}
+
+// StreamReader reads the response of a peer to a request made with PostStream.
+// if the peer streamed its response, the items are read with Next.
+// otherwise, the buffered response is read with Read, and decoded the same way as for PostRaw.
+type StreamReader struct {
+	body     io.ReadCloser
+	r        *msgp.Reader
+	streamed bool
+	done     bool // the stream has ended
+	trailer  bool // the stream ended with a trailer that has not been read yet
+
+	// onFinish, if set, is called once with the outcome of the stream, when it has been read completely or failed.
+	// it is not called for streams that are closed before they ended.
+	onFinish func(err error)
+	finished bool
+}
+
+func NewStreamReader(body io.ReadCloser, streamed bool) *StreamReader {
+	s := &StreamReader{
+		body:     body,
+		streamed: streamed,
+	}
+	if streamed {
+		s.r = msgp.NewReader(body)
+	}
+	return s
+}
+
+// Streamed returns whether the peer streamed its response
+func (s *StreamReader) Streamed() bool {
+	return s.streamed
+}
+
+// Read reads the body of a buffered response
+func (s *StreamReader) Read(p []byte) (int, error) {
+	return s.body.Read(p)
+}
+
+// Next decodes the next item of the stream into item.
+// It returns io.EOF when the stream has ended, and the error sent by the peer if it failed.
+func (s *StreamReader) Next(item msgp.Decodable) error {
+	if s.done {
+		return io.EOF
+	}
+	frame, err := s.r.ReadUint8()
+	if err != nil {
+		s.done = true
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		s.finish(err)
+		return err
+	}
+	switch frame {
+	case frameItem:
+		err := item.DecodeMsg(s.r)
+		if err != nil {
+			s.finish(err)
+		}
+		return err
+	case frameEnd:
+		s.done = true
+		s.finish(nil)
+		return io.EOF
+	case frameTrailer:
+		// finished once the trailer is read, or the stream is closed
+		s.done = true
+		s.trailer = true
+		return io.EOF
+	case frameError:
+		s.done = true
+		code, err := s.r.ReadInt()
+		if err != nil {
+			s.finish(err)
+			return err
+		}
+		msg, err := s.r.ReadString()
+		if err != nil {
+			s.finish(err)
+			return err
+		}
+		err = NewError(code, errors.New(msg))
+		s.finish(err)
+		return err
+	}
+	s.done = true
+	err = fmt.Errorf("invalid stream frame type %d", frame)
+	s.finish(err)
+	return err
+}
+
+func (s *StreamReader) finish(err error) {
+	if s.onFinish != nil && !s.finished {
+		s.finished = true
+		s.onFinish(err)
+	}
+}
+
+// Trailer decodes the trailer that ended the stream into t.
+// It must be called after Next returned io.EOF.
+func (s *StreamReader) Trailer(t msgp.Decodable) error {
+	if !s.trailer {
+		return errNoTrailer
+	}
+	s.trailer = false
+	err := t.DecodeMsg(s.r)
+	s.finish(err)
+	return err
+}
+
+// Close closes the response body. Closing it before the stream has ended
+// aborts the request, so the peer stops producing the response.
+func (s *StreamReader) Close() error {
+	if s.trailer {
+		// the trailer was not read, but the stream did end
+		s.finish(nil)
+	}
+	return s.body.Close()
+}
+
+// StreamWriter streams the response to a request that WantsStream.
+// Items are written to the peer as they are produced. When the peer can't keep up,
+// Write blocks, and when the request is canceled, it returns the error of the context.
+type StreamWriter struct {
+	ctx       context.Context
+	rw        http.ResponseWriter
+	w         *msgp.Writer
+	lastFlush time.Time
+}
+
+// NewStreamWriter starts a stream on the given ResponseWriter.
+// The stream must be ended with Close or Fail.
+func NewStreamWriter(ctx context.Context, rw http.ResponseWriter) *StreamWriter {
+	rw.Header().Set("Content-Type", StreamContentType)
+	rw.WriteHeader(http.StatusOK)
+	return &StreamWriter{
+		ctx:       ctx,
+		rw:        rw,
+		w:         msgp.NewWriter(rw),
+		lastFlush: time.Now(),
+	}
+}
+
+// Write writes an item to the stream
+func (s *StreamWriter) Write(item msgp.Encodable) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.w.WriteUint8(frameItem); err != nil {
+		return err
+	}
+	if err := item.EncodeMsg(s.w); err != nil {
+		return err
+	}
+	if time.Since(s.lastFlush) > streamFlushInterval {
+		return s.flush()
+	}
+	return nil
+}
+
+// Close ends the stream, with the given trailer if it is not nil
+func (s *StreamWriter) Close(trailer msgp.Encodable) error {
+	if trailer == nil {
+		if err := s.w.WriteUint8(frameEnd); err != nil {
+			return err
+		}
+		return s.flush()
+	}
+	if err := s.w.WriteUint8(frameTrailer); err != nil {
+		return err
+	}
+	if err := trailer.EncodeMsg(s.w); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// Fail ends the stream with an error. The peer discards the items it has read so far.
+func (s *StreamWriter) Fail(err error) error {
+	code := http.StatusInternalServerError
+	if e, ok := err.(interface{ HTTPStatusCode() int }); ok {
+		code = e.HTTPStatusCode()
+	}
+	if err := s.w.WriteUint8(frameError); err != nil {
+		return err
+	}
+	if err := s.w.WriteInt(code); err != nil {
+		return err
+	}
+	if err := s.w.WriteString(err.Error()); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *StreamWriter) flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if f, ok := s.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	s.lastFlush = time.Now()
+	return nil
+}
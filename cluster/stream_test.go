@@ -0,0 +1,188 @@
+package cluster
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/schema"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+type testBody struct{}
+
+func (b testBody) Trace(span opentracing.Span)      {}
+func (b testBody) TraceDebug(span opentracing.Span) {}
+
+// postStream posts to a test server that runs the given handler, with streams enabled or not
+func postStream(t *testing.T, stream bool, handler http.HandlerFunc) *StreamReader {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	apiPort, _ := strconv.Atoi(port)
+	node := HTTPNode{Name: "peer", RemoteAddr: host, ApiPort: apiPort, ApiScheme: "http"}
+
+	Tracer = opentracing.NoopTracer{}
+	peerStream = stream
+	defer func() { peerStream = true }()
+	ctx := opentracing.ContextWithSpan(context.Background(), Tracer.StartSpan("test"))
+	reader, err := node.PostStream(ctx, "test", "/test", testBody{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	return reader
+}
+
+func TestStream(t *testing.T) {
+	items := []schema.MetricData{{Name: "a", Value: 1}, {Name: "b", Value: 2}}
+	trailer := schema.MetricData{Name: "trailer"}
+	buffered := []byte("buffered")
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !WantsStream(r) {
+			w.Write(buffered)
+			return
+		}
+		stream := NewStreamWriter(r.Context(), w)
+		for i := range items {
+			if err := stream.Write(&items[i]); err != nil {
+				t.Errorf("failed to write item: %s", err)
+			}
+		}
+		stream.Close(&trailer)
+	}
+
+	reader := postStream(t, true, handler)
+	if !reader.Streamed() {
+		t.Fatal("expected a streamed response")
+	}
+	for i := 0; ; i++ {
+		var md schema.MetricData
+		err := reader.Next(&md)
+		if err == io.EOF {
+			if i != len(items) {
+				t.Fatalf("expected %d items, got %d", len(items), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if md.Name != items[i].Name || md.Value != items[i].Value {
+			t.Fatalf("expected item %v, got %v", items[i], md)
+		}
+	}
+	var md schema.MetricData
+	if err := reader.Trailer(&md); err != nil || md.Name != trailer.Name {
+		t.Fatalf("expected trailer %v, got %v (err: %v)", trailer, md, err)
+	}
+
+	// with streams disabled, we get the buffered response
+	reader = postStream(t, false, handler)
+	if reader.Streamed() {
+		t.Fatal("expected a buffered response")
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil || string(body) != string(buffered) {
+		t.Fatalf("expected buffered response %q, got %q (err: %v)", buffered, body, err)
+	}
+}
+
+func TestStreamFailure(t *testing.T) {
+	reader := postStream(t, true, func(w http.ResponseWriter, r *http.Request) {
+		stream := NewStreamWriter(r.Context(), w)
+		stream.Write(&schema.MetricData{Name: "a"})
+		stream.Fail(NewError(http.StatusBadRequest, io.ErrShortBuffer))
+	})
+	var md schema.MetricData
+	if err := reader.Next(&md); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err := reader.Next(&md)
+	if e, ok := err.(*Error); !ok || e.HTTPStatusCode() != http.StatusBadRequest || e.Error() != io.ErrShortBuffer.Error() {
+		t.Fatalf("expected the error of the peer, got %v", err)
+	}
+
+	// a stream that ends without end frame is incomplete
+	reader = postStream(t, true, func(w http.ResponseWriter, r *http.Request) {
+		stream := NewStreamWriter(r.Context(), w)
+		stream.Write(&schema.MetricData{Name: "a"})
+		stream.flush()
+	})
+	if err := reader.Next(&md); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := reader.Next(&md); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+// lastHealth returns the number of recorded requests to the peer, and the latency and outcome of the last one
+func lastHealth(name string) (int, time.Duration, bool) {
+	h := Health(name)
+	h.Lock()
+	defer h.Unlock()
+	last := (h.pos + healthWindow - 1) % healthWindow
+	return h.n, h.latencies[last], h.failed[last]
+}
+
+// the outcome and latency of a streamed request are recorded when the stream ends, rather than when it starts
+func TestStreamHealth(t *testing.T) {
+	delay := 50 * time.Millisecond
+	reader := postStream(t, true, func(w http.ResponseWriter, r *http.Request) {
+		stream := NewStreamWriter(r.Context(), w)
+		stream.Write(&schema.MetricData{Name: "a"})
+		stream.flush()
+		time.Sleep(delay)
+		stream.Close(nil)
+	})
+	before, _, _ := lastHealth("peer")
+	var md schema.MetricData
+	if err := reader.Next(&md); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n, _, _ := lastHealth("peer"); n != before {
+		t.Fatalf("expected nothing to be recorded before the stream ended")
+	}
+	if err := reader.Next(&md); err != io.EOF {
+		t.Fatalf("expected %v, got %v", io.EOF, err)
+	}
+	n, latency, failed := lastHealth("peer")
+	if n != before+1 || failed || latency < delay {
+		t.Fatalf("expected a successful request of at least %s to be recorded, got n=%d latency=%s failed=%t", delay, n-before, latency, failed)
+	}
+
+	// streams that end without end frame are failures
+	reader = postStream(t, true, func(w http.ResponseWriter, r *http.Request) {
+		stream := NewStreamWriter(r.Context(), w)
+		stream.Write(&schema.MetricData{Name: "a"})
+		stream.flush()
+	})
+	before, _, _ = lastHealth("peer")
+	for reader.Next(&md) == nil {
+	}
+	if n, _, failed := lastHealth("peer"); n != before+1 || !failed {
+		t.Fatalf("expected a failed request to be recorded, got n=%d failed=%t", n-before, failed)
+	}
+
+	// as are streams that fail, unless the peer rejected the request
+	for _, code := range []int{http.StatusInternalServerError, http.StatusBadRequest} {
+		reader = postStream(t, true, func(w http.ResponseWriter, r *http.Request) {
+			stream := NewStreamWriter(r.Context(), w)
+			stream.Fail(NewError(code, io.ErrShortBuffer))
+		})
+		before, _, _ = lastHealth("peer")
+		reader.Next(&md)
+		if n, _, failed := lastHealth("peer"); n != before+1 || failed != (code >= 500) {
+			t.Fatalf("status %d: expected a request with failed=%t to be recorded, got n=%d failed=%t", code, code >= 500, n-before, failed)
+		}
+	}
+}
@@ -23,6 +23,12 @@ import (
 	"github.com/grafana/metrictank/idx"
 	"github.com/grafana/metrictank/idx/bigtable"
 	"github.com/grafana/metrictank/idx/cassandra"
+	"github.com/grafana/metrictank/idx/events"
+	eventsBt "github.com/grafana/metrictank/idx/events/bigtable"
+	eventsCass "github.com/grafana/metrictank/idx/events/cassandra"
+	"github.com/grafana/metrictank/idx/macros"
+	macrosBt "github.com/grafana/metrictank/idx/macros/bigtable"
+	macrosCass "github.com/grafana/metrictank/idx/macros/cassandra"
 	"github.com/grafana/metrictank/idx/memory"
 	metatagsBt "github.com/grafana/metrictank/idx/metatags/bigtable"
 	metatagsCass "github.com/grafana/metrictank/idx/metatags/cassandra"
@@ -34,10 +40,13 @@ import (
 	"github.com/grafana/metrictank/mdata"
 	"github.com/grafana/metrictank/mdata/cache"
 	"github.com/grafana/metrictank/mdata/notifierKafka"
+	"github.com/grafana/metrictank/mdata/snapshot"
+	"github.com/grafana/metrictank/mdata/wal"
 	"github.com/grafana/metrictank/stats"
 	statsConfig "github.com/grafana/metrictank/stats/config"
 	bigtableStore "github.com/grafana/metrictank/store/bigtable"
 	cassandraStore "github.com/grafana/metrictank/store/cassandra"
+	"github.com/grafana/metrictank/store/tiered"
 	"github.com/grafana/metrictank/util"
 	"github.com/raintank/dur"
 	log "github.com/sirupsen/logrus"
@@ -49,11 +58,15 @@ var (
 	version      = "(none)"
 
 	metrics     *mdata.AggMetrics
+	snapshotter *snapshot.Snapshotter
+	walLog      *wal.WAL
 	metricIndex idx.MetricIndex
 	apiServer   *api.Server
 	inputs      []input.Plugin
 	store       mdata.Store
 	metaRecords idx.MetaRecordIdx
+	macroIdx    idx.MacroIdx
+	eventIdx    idx.EventIdx
 
 	// Misc:
 	instance    = flag.String("instance", "default", "instance identifier. must be unique. used in clustering messages, for naming queue consumers and emitted metrics")
@@ -130,6 +143,8 @@ func main() {
 
 	// storage-schemas, storage-aggregation files
 	mdata.ConfigSetup()
+	snapshot.ConfigSetup()
+	wal.ConfigSetup()
 
 	// cassandra Store
 	cassandraStore.ConfigSetup()
@@ -137,10 +152,21 @@ func main() {
 	// bigtable store
 	bigtableStore.ConfigSetup()
 
+	// tiered store
+	tiered.ConfigSetup()
+
 	// meta tag indexes
 	metatagsCass.ConfigSetup()
 	metatagsBt.ConfigSetup()
 
+	// macro indexes
+	macrosCass.ConfigSetup()
+	macrosBt.ConfigSetup()
+
+	// event indexes
+	eventsCass.ConfigSetup()
+	eventsBt.ConfigSetup()
+
 	jaeger.ConfigSetup()
 
 	config.ParseAll()
@@ -191,6 +217,9 @@ func main() {
 		bigtable.CliConfig.Enabled = false
 		cassandraStore.CliConfig.Enabled = false
 		bigtableStore.CliConfig.Enabled = false
+		tiered.Enabled = false
+		snapshot.Enabled = false
+		wal.Enabled = false
 	}
 
 	/***********************************
@@ -202,12 +231,24 @@ func main() {
 	notifierKafka.ConfigProcess(*instance)
 	statsConfig.ConfigProcess(*instance)
 	mdata.ConfigProcess()
+	if statsConfig.LocalEnabled {
+		mdata.SetOrgSchema(statsConfig.LocalOrg, "stats", statsConfig.LocalRetentions)
+		// no other node ingests our stats, so we must save them even if we're not a primary
+		mdata.SetAlwaysPersist(statsConfig.LocalOrg)
+	}
+	snapshot.ConfigProcess()
+	wal.ConfigProcess()
 	cassandra.ConfigProcess()
 	bigtable.ConfigProcess()
 	bigtableStore.ConfigProcess(mdata.MaxChunkSpan())
+	tiered.ConfigProcess(mdata.MaxChunkSpan())
 	jaeger.ConfigProcess()
 	metatagsCass.ConfigProcess()
 	metatagsBt.ConfigProcess()
+	macrosCass.ConfigProcess()
+	macrosBt.ConfigProcess()
+	eventsCass.ConfigProcess()
+	eventsBt.ConfigProcess()
 
 	inputEnabled := inCarbon.Enabled || inKafkaMdm.Enabled
 	wantInput := cluster.Mode == cluster.ModeDev || cluster.Mode == cluster.ModeShard
@@ -217,6 +258,17 @@ func main() {
 	if inputEnabled && !wantInput {
 		log.Fatal("you should not have an input enabled in 'query' cluster mode")
 	}
+	if statsConfig.LocalEnabled && !wantInput {
+		log.Fatal("stats.local needs an index and a store to ingest the stats into: it can not be enabled in 'query' cluster mode")
+	}
+	// metrics restored from a snapshot would not be in the index, as their MetricData messages are not replayed
+	if snapshot.Enabled && !cassandra.CliConfig.Enabled && !bigtable.CliConfig.Enabled {
+		log.Fatal("snapshots require a persistent index: enable cassandra-idx or bigtable-idx")
+	}
+	// both restore the in-memory data on startup, the snapshot is meant for kafka-mdm and the wal for other inputs
+	if snapshot.Enabled && wal.Enabled {
+		log.Fatal("snapshot and wal can not both be enabled")
+	}
 
 	sec := dur.MustParseNDuration("warm-up-period", *warmUpPeriodStr)
 	warmupPeriod = time.Duration(sec) * time.Second
@@ -295,9 +347,15 @@ func main() {
 			log.Fatal("no backend store plugin may be enabled in 'query' cluster mode")
 		}
 	}
+	// with the tiered store, the backend store only keeps chunks up to the tiered store's age,
+	// but still reads the chunks saved with the full ttls before it was enabled
+	ttls := mdata.TTLs()
+	if tiered.Enabled {
+		ttls = tiered.BackendTTLs(ttls)
+	}
 	if bigtableStore.CliConfig.Enabled {
 		schemaMaxChunkSpan := mdata.MaxChunkSpan()
-		store, err = bigtableStore.NewStore(bigtableStore.CliConfig, mdata.TTLs(), schemaMaxChunkSpan)
+		store, err = bigtableStore.NewStore(bigtableStore.CliConfig, ttls, schemaMaxChunkSpan)
 		if err != nil {
 			log.Fatalf("failed to initialize bigtable backend store. %s", err)
 		}
@@ -305,12 +363,22 @@ func main() {
 	}
 	if cassandraStore.CliConfig.Enabled {
 		schemaMaxChunkSpan := mdata.MaxChunkSpan()
-		store, err = cassandraStore.NewCassandraStore(cassandraStore.CliConfig, mdata.TTLs(), schemaMaxChunkSpan)
+		store, err = cassandraStore.NewCassandraStore(cassandraStore.CliConfig, ttls, schemaMaxChunkSpan)
 		if err != nil {
 			log.Fatalf("failed to initialize cassandra backend store. %s", err)
 		}
 		store.SetTracer(tracer)
 	}
+	if tiered.Enabled && store != nil {
+		objects, err := tiered.NewObjectStore()
+		if err != nil {
+			log.Fatalf("failed to initialize object storage for the tiered store. %s", err)
+		}
+		store, err = tiered.New(store, objects, *instance, mdata.MaxChunkSpan())
+		if err != nil {
+			log.Fatalf("failed to initialize tiered store. %s", err)
+		}
+	}
 
 	/***********************************
 		Initialize the Chunk Cache
@@ -336,6 +404,30 @@ func main() {
 		metrics = mdata.NewAggMetrics(store, ccache, *dropFirstChunk, ingestFrom, chunkMaxStale, metricMaxStale, gcInterval)
 	}
 
+	/***********************************
+		Restore the snapshot of our MemoryStore
+	***********************************/
+	// dataSince is the time since which our in-memory data is complete. unless restored, it's when we start consuming
+	var dataSince time.Time
+	var snapshotOffsets []snapshot.Offset
+	if snapshot.Enabled && metrics != nil {
+		hdr, ok := snapshot.Load(metrics)
+		if ok {
+			dataSince = time.Unix(hdr.DataSince, 0)
+			snapshotOffsets = hdr.Offsets
+		}
+	}
+
+	/***********************************
+		Replay the write-ahead log into our MemoryStore
+	***********************************/
+	if wal.Enabled && metrics != nil {
+		walLog, err = wal.New(metrics)
+		if err != nil {
+			log.Fatalf("failed to initialize wal: %s", err.Error())
+		}
+	}
+
 	/***********************************
 		Initialize our Inputs
 	***********************************/
@@ -346,7 +438,11 @@ func main() {
 
 	if inKafkaMdm.Enabled {
 		sarama.Logger = l.New(os.Stdout, "[Sarama] ", l.LstdFlags)
-		inputs = append(inputs, inKafkaMdm.New())
+		kafkaMdm := inKafkaMdm.New()
+		if snapshotOffsets != nil {
+			kafkaMdm.ResumeFrom(snapshotOffsets)
+		}
+		inputs = append(inputs, kafkaMdm)
 	}
 
 	if cluster.Mode == cluster.ModeShard && len(inputs) > 1 {
@@ -427,6 +523,63 @@ func main() {
 		}
 	}
 
+	// macros are needed by every node that handles queries, so unlike meta records
+	// they are also available in 'query' cluster mode
+	memMacroIdx := macros.New()
+	macroIdx = memMacroIdx
+
+	if macrosCass.CliConfig.Enabled && macrosBt.CliConfig.Enabled {
+		log.Fatal("Only 1 macro index handler can be enabled.")
+	}
+
+	if macrosCass.CliConfig.Enabled {
+		macrosCassIdx := macrosCass.NewCassandraMacroIdx(macrosCass.CliConfig, memMacroIdx)
+		err = macrosCassIdx.Init()
+		if err != nil {
+			log.Fatalf("Failed to initialize cassandra macro index: %s", err)
+		}
+		macrosCassIdx.Start()
+		macroIdx = macrosCassIdx
+	}
+
+	if macrosBt.CliConfig.Enabled {
+		macrosBtIdx := macrosBt.NewBigTableMacroIdx(macrosBt.CliConfig, memMacroIdx)
+		err = macrosBtIdx.Init()
+		if err != nil {
+			log.Fatalf("Failed to initialize bigtable macro index: %s", err)
+		}
+		macrosBtIdx.Start()
+		macroIdx = macrosBtIdx
+	}
+
+	// like macros, events are needed by every node that handles queries
+	memEventIdx := events.New()
+	eventIdx = memEventIdx
+
+	if eventsCass.CliConfig.Enabled && eventsBt.CliConfig.Enabled {
+		log.Fatal("Only 1 event index handler can be enabled.")
+	}
+
+	if eventsCass.CliConfig.Enabled {
+		eventsCassIdx := eventsCass.NewCassandraEventIdx(eventsCass.CliConfig, memEventIdx)
+		err = eventsCassIdx.Init()
+		if err != nil {
+			log.Fatalf("Failed to initialize cassandra event index: %s", err)
+		}
+		eventsCassIdx.Start()
+		eventIdx = eventsCassIdx
+	}
+
+	if eventsBt.CliConfig.Enabled {
+		eventsBtIdx := eventsBt.NewBigTableEventIdx(eventsBt.CliConfig, memEventIdx)
+		err = eventsBtIdx.Init()
+		if err != nil {
+			log.Fatalf("Failed to initialize bigtable event index: %s", err)
+		}
+		eventsBtIdx.Start()
+		eventIdx = eventsBtIdx
+	}
+
 	/***********************************
 		Initialize our API server
 	***********************************/
@@ -439,8 +592,13 @@ func main() {
 	apiServer.BindMemoryStore(metrics)
 	apiServer.BindBackendStore(store)
 	apiServer.BindMetaRecords(metaRecords)
+	apiServer.BindMacros(macroIdx)
+	apiServer.BindEvents(eventIdx)
 	apiServer.BindCache(ccache)
 	apiServer.BindTracer(tracer)
+	if statsConfig.LocalEnabled {
+		apiServer.BindLocalOrg(statsConfig.LocalOrg)
+	}
 	cluster.Tracer = tracer
 	go apiServer.Run()
 
@@ -463,7 +621,16 @@ func main() {
 		if notifierKafka.Enabled {
 			// The notifierKafka notifiers will block here until it has processed the backlog of metricPersist messages.
 			// it will block for at most kafka-cluster.backlog-process-timeout (default 60s)
-			notifiers = append(notifiers, notifierKafka.New(*instance, mdata.NewDefaultNotifierHandler(metrics, metricIndex)))
+			handler := mdata.NewDefaultNotifierHandler(metrics, metricIndex)
+			if walLog != nil {
+				// on secondaries, the saves of the primary are what allows the wal to remove segments
+				handler = mdata.NewDefaultNotifierHandler(metrics, metricIndex, walLog)
+			}
+			notifiers = append(notifiers, notifierKafka.New(*instance, handler))
+		}
+		if walLog != nil {
+			// the wal removes segments once the chunks they have points for are saved
+			notifiers = append(notifiers, walLog)
 		}
 		mdata.InitPersistNotifier(notifiers...)
 	}
@@ -479,7 +646,11 @@ func main() {
 		if carbonPlugin, ok := plugin.(*inCarbon.Carbon); ok {
 			carbonPlugin.IntervalGetter(inCarbon.NewIndexIntervalGetter(metricIndex))
 		}
-		err = plugin.Start(input.NewDefaultHandler(metrics, metricIndex, plugin.Name()), cancel)
+		handler := input.NewDefaultHandler(metrics, metricIndex, plugin.Name())
+		if walLog != nil {
+			handler = input.NewDefaultHandlerWithWAL(metrics, metricIndex, walLog, plugin.Name())
+		}
+		err = plugin.Start(handler, cancel)
 		if err != nil {
 			shutdown()
 			return
@@ -488,19 +659,55 @@ func main() {
 		apiServer.BindPrioritySetter(plugin)
 	}
 
+	if statsConfig.LocalEnabled {
+		handler := input.NewDefaultHandler(metrics, metricIndex, "stats")
+		if walLog != nil {
+			handler = input.NewDefaultHandlerWithWAL(metrics, metricIndex, walLog, "stats")
+		}
+		// the stats are stored under one of our own partitions, so that queries for them are served by this node
+		var partition int32
+		if partitions := cluster.Manager.GetPartitions(); len(partitions) > 0 {
+			partition = partitions[0]
+		}
+		statsConfig.StartLocal(handler, partition)
+	}
+
+	if dataSince.IsZero() {
+		dataSince = time.Now()
+	}
+
+	if walLog != nil {
+		walLog.Start()
+	}
+
+	if snapshot.Enabled && metrics != nil {
+		var snapshotInputs []snapshot.Input
+		for _, plugin := range inputs {
+			if in, ok := plugin.(snapshot.Input); ok {
+				snapshotInputs = append(snapshotInputs, in)
+			}
+		}
+		snapshotter = snapshot.NewSnapshotter(metrics, snapshotInputs, dataSince)
+		snapshotter.Start()
+	}
+
 	// metric cluster.self.promotion_wait is how long a candidate (secondary node) has to wait until it can become a primary
 	// When the timer becomes 0 it means the in-memory buffer has been able to fully populate so that if you stop a primary
 	// and it was able to save its complete chunks, this node will be able to take over without dataloss.
 	// You can upgrade a candidate to primary while the timer is not 0 yet, it just means it may have missing data in the chunks that it will save.
 	maxChunkSpan := mdata.MaxChunkSpan()
-	stats.NewTimeDiffReporter32("cluster.self.promotion_wait", (uint32(time.Now().Unix())/maxChunkSpan+1)*maxChunkSpan)
+	stats.NewTimeDiffReporter32("cluster.self.promotion_wait", (uint32(dataSince.Unix())/maxChunkSpan+1)*maxChunkSpan)
 
 	/***********************************
 		Set our ready state so we can accept requests from users
 		For this, both warm-up-period and gossip-settle-period must have lapsed
 		(it is valid for either, or both to be 0)
 	***********************************/
-	waitWarmup := warmupPeriod
+	// data restored from a snapshot counts towards the warmup
+	waitWarmup := warmupPeriod - time.Since(dataSince)
+	if waitWarmup < 0 {
+		waitWarmup = 0
+	}
 	waitSettle := cluster.GossipSettlePeriod
 
 	// for primary nodes and query nodes, no warmup
@@ -560,6 +767,16 @@ func shutdown() {
 		timer.Stop()
 	}
 
+	if snapshotter != nil {
+		log.Info("taking final snapshot")
+		snapshotter.Stop()
+	}
+
+	if walLog != nil {
+		log.Info("closing wal")
+		walLog.Stop()
+	}
+
 	if cluster.Mode != cluster.ModeQuery {
 		log.Info("closing store")
 		store.Stop()
@@ -576,5 +793,19 @@ func shutdown() {
 		}
 	}
 
+	switch concrete := macroIdx.(type) {
+	case *macrosBt.MacroIdx:
+		concrete.Stop()
+	case *macrosCass.MacroIdx:
+		concrete.Stop()
+	}
+
+	switch concrete := eventIdx.(type) {
+	case *eventsBt.EventIdx:
+		concrete.Stop()
+	case *eventsCass.EventIdx:
+		concrete.Stop()
+	}
+
 	log.Info("terminating.")
 }
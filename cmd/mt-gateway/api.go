@@ -5,6 +5,7 @@ import (
 	"github.com/grafana/metrictank/stats"
 	"net/http"
 	"net/http/httputil"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -15,41 +16,58 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-//Maintains a set of `http.Handlers` for the different API endpoints.
-//Used to generate an http.ServeMux via `api.Mux()`
+// Maintains a set of `http.Handlers` for the different API endpoints.
+// Used to generate an http.ServeMux via `api.Mux()`
 type Api struct {
 	ingestHandler     http.Handler
+	influxHandler     http.Handler
+	openTSDBHandler   http.Handler
 	metrictankHandler http.Handler
+	deleteHandler     http.Handler
 	graphiteHandler   http.Handler
 	bulkImportHandler http.Handler
 }
 
-//Constructs a new Api based on the passed in URLS
-func NewApi(urls Urls) Api {
+// Constructs a new Api based on the passed in URLS.
+// If keys is not nil, all requests must be authenticated with an api key
+func NewApi(urls Urls, keys *apiKeyStore) Api {
 	api := Api{}
-	api.ingestHandler = withMiddleware("ingest", ingestHandler(urls))
-	api.graphiteHandler = withMiddleware("graphite", httputil.NewSingleHostReverseProxy(urls.graphite))
-	api.metrictankHandler = withMiddleware("metrictank", httputil.NewSingleHostReverseProxy(urls.metrictank))
-	api.bulkImportHandler = withMiddleware("bulk-importer", bulkImportHandler(urls))
+	ingestEnabled := initIngest(urls)
+	metrictankProxy := httputil.NewSingleHostReverseProxy(urls.metrictank)
+	api.ingestHandler = withMiddleware("ingest", keys, scopeWrite, ingestHandler(ingestEnabled, ingest.Metrics))
+	api.influxHandler = withMiddleware("influx", keys, scopeWrite, ingestHandler(ingestEnabled, ingest.InfluxWrite))
+	api.openTSDBHandler = withMiddleware("opentsdb", keys, scopeWrite, ingestHandler(ingestEnabled, ingest.OpenTSDBPut))
+	api.graphiteHandler = withScopedMiddleware("graphite", keys, proxyScope, httputil.NewSingleHostReverseProxy(urls.graphite))
+	api.metrictankHandler = withMiddleware("metrictank", keys, scopeRead, metrictankProxy)
+	api.deleteHandler = withMiddleware("metrictank", keys, scopeDelete, metrictankProxy)
+	api.bulkImportHandler = withMiddleware("bulk-importer", keys, scopeImport, bulkImportHandler(urls))
 	return api
 }
 
-func ingestHandler(urls Urls) http.Handler {
+// Sets up publishing to kafka, returns whether metrics ingestion is enabled
+func initIngest(urls Urls) bool {
 	publisher := kafka.New(strings.Split(urls.kafkaBrokers, ","), true)
 	if publisher == nil {
 		log.Info("metrics ingestion not enabled (no kafka brokers configured)")
+		return false
+	}
+	publish.Init(publisher)
+	ingest.SetIntervalGetter(publisher)
+	return true
+}
+
+// Returns the given ingest handler if ingestion is enabled, otherwise a handler that always returns a 503
+func ingestHandler(enabled bool, handler http.HandlerFunc) http.Handler {
+	if !enabled {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusServiceUnavailable)
 			_, _ = fmt.Fprintln(w, "metrics ingestion not enabled (no kafka brokers configured)")
 		})
-	} else {
-		publish.Init(publisher)
-		return http.HandlerFunc(ingest.Metrics)
 	}
-
+	return handler
 }
 
-//Returns a proxy to the bulk importer if one is configured, otherwise a handler that always returns a 503
+// Returns a proxy to the bulk importer if one is configured, otherwise a handler that always returns a 503
 func bulkImportHandler(urls Urls) http.Handler {
 	if urls.bulkImporter.String() != "" {
 		log.WithField("url", urls.bulkImporter.String()).Info("bulk importer configured")
@@ -62,7 +80,7 @@ func bulkImportHandler(urls Urls) http.Handler {
 	})
 }
 
-//Builds an http.ServeMux based on the handlers defined in the Api
+// Builds an http.ServeMux based on the handlers defined in the Api
 func (api Api) Mux() *http.ServeMux {
 	mux := http.NewServeMux()
 	//By default everything is proxied to graphite
@@ -70,20 +88,108 @@ func (api Api) Mux() *http.ServeMux {
 	mux.Handle("/", api.graphiteHandler)
 	//`/metrics` is handled locally by the kafka ingester (not yet implemented)
 	mux.Handle("/metrics", api.ingestHandler)
+	//influxdb line protocol and opentsdb json are converted and ingested into kafka as well
+	mux.Handle("/write", api.influxHandler)
+	mux.Handle("/api/put", api.openTSDBHandler)
 	//other endpoints are proxied to metrictank or mt-whisper-import-writer
 	mux.Handle("/metrics/index.json", api.metrictankHandler)
-	mux.Handle("/metrics/delete", api.metrictankHandler)
+	mux.Handle("/metrics/delete", api.deleteHandler)
 	mux.Handle("/metrics/import", api.bulkImportHandler)
 
 	return mux
 }
 
-//Add logging and default orgId middleware to the http handler
-func withMiddleware(svc string, base http.Handler) http.Handler {
+// Add logging and either api key authentication or default orgId middleware to the http handler
+func withMiddleware(svc string, keys *apiKeyStore, s scope, base http.Handler) http.Handler {
+	if keys != nil {
+		return statsMiddleware(loggingMiddleware(svc, authMiddleware(keys, s, base)))
+	}
+	return defaultOrgIdMiddleware(statsMiddleware(loggingMiddleware(svc, base)))
+}
+
+// Like withMiddleware, but the required scope depends on the request. With api key authentication,
+// requests for which scopeOf returns false are rejected. Without it, all requests are passed on, as there is no scope to enforce
+func withScopedMiddleware(svc string, keys *apiKeyStore, scopeOf func(r *http.Request) (scope, bool), base http.Handler) http.Handler {
+	if keys != nil {
+		return statsMiddleware(loggingMiddleware(svc, scopedAuthMiddleware(keys, scopeOf, base)))
+	}
 	return defaultOrgIdMiddleware(statsMiddleware(loggingMiddleware(svc, base)))
 }
 
-//add request metrics to the given handler
+// Mutating endpoints of graphite and metrictank that are proxied by the catch-all handler, and the scope they require,
+// whatever the method. Paths are lower case, as metrictank matches them case insensitively
+var mutatingPaths = map[string]scope{
+	"/tags/delseries":      scopeDelete,
+	"/tags/delbyquery":     scopeDelete,
+	"/tags/tagseries":      scopeWrite,
+	"/tags/tagmultiseries": scopeWrite,
+	"/metrics/delete":      scopeDelete,
+	"/macros/delete":       scopeDelete,
+	// cluster endpoints of metrictank that also accept GET
+	"/index/delete":          scopeDelete,
+	"/index/tags/delseries":  scopeDelete,
+	"/index/tags/delbyquery": scopeDelete,
+	"/ccache/delete":         scopeDelete,
+	"/events":                scopeWrite,
+	"/events/":               scopeWrite,
+	"/metatags/upsert":       scopeWrite,
+	"/metatags/swap":         scopeWrite,
+	"/macros/upsert":         scopeWrite,
+	"/macros/swap":           scopeWrite,
+}
+
+// Read endpoints that graphite clients may also POST to, e.g. to send long queries
+var postReadPaths = map[string]struct{}{
+	"/render":                   {},
+	"/metrics/find":             {},
+	"/metrics/expand":           {},
+	"/tags":                     {},
+	"/tags/findseries":          {},
+	"/tags/terms":               {},
+	"/tags/autocomplete/tags":   {},
+	"/tags/autocomplete/values": {},
+	"/functions":                {},
+	"/showplan":                 {},
+}
+
+// The details of a tag, and the description of a function, which are read endpoints that graphite clients may also POST to.
+// Mutating endpoints under /tags/ must be listed in mutatingPaths, which take precedence
+var (
+	tagDetailsPath = regexp.MustCompile(`^/tags/[0-9a-z]+$`)
+	functionPath   = regexp.MustCompile(`^/functions/.+$`)
+)
+
+// proxyScope returns the scope a request to the catch-all handler requires.
+// It returns false for requests that may mutate data on an endpoint we don't know, which must be rejected.
+func proxyScope(r *http.Request) (scope, bool) {
+	path := strings.ToLower(r.URL.Path)
+	if s, ok := mutatingPaths[path]; ok {
+		return s, true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return scopeRead, true
+	case http.MethodDelete:
+		if strings.HasPrefix(path, "/events/") {
+			return scopeDelete, true
+		}
+	case http.MethodPost:
+		if _, ok := postReadPaths[path]; ok {
+			return scopeRead, true
+		}
+		if tagDetailsPath.MatchString(path) || functionPath.MatchString(path) {
+			return scopeRead, true
+		}
+	}
+	return "", false
+}
+
+// rejectRequest responds to a request that is not allowed through the gateway
+func rejectRequest(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, fmt.Sprintf("%s %s is not allowed through the gateway", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+}
+
+// add request metrics to the given handler
 func statsMiddleware(base http.Handler) http.Handler {
 	stats := requestStats{
 		responseCounts:    make(map[string]map[int]*stats.CounterRate32),
@@ -105,7 +211,7 @@ func statsMiddleware(base http.Handler) http.Handler {
 	})
 }
 
-//add request logging to the given handler
+// add request logging to the given handler
 func loggingMiddleware(svc string, base http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
 		recorder := responseRecorder{w, -1, 0}
@@ -117,7 +223,7 @@ func loggingMiddleware(svc string, base http.Handler) http.Handler {
 	})
 }
 
-//Set the `X-Org-Id` header to the default if there is not one present
+// Set the `X-Org-Id` header to the default if there is not one present
 func defaultOrgIdMiddleware(base http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("X-Org-Id") == "" && *defaultOrgId != -1 {
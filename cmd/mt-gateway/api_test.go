@@ -11,7 +11,10 @@ import (
 func TestApi(t *testing.T) {
 	mux := Api{
 		ingestHandler:     stubHandler("ingest"),
+		influxHandler:     stubHandler("influx"),
+		openTSDBHandler:   stubHandler("opentsdb"),
 		metrictankHandler: stubHandler("metrictank"),
+		deleteHandler:     stubHandler("delete"),
 		graphiteHandler:   stubHandler("graphite"),
 		bulkImportHandler: stubHandler("bulk-import"),
 	}.Mux()
@@ -38,13 +41,21 @@ func TestApi(t *testing.T) {
 			path: "/metrics",
 			want: "ingest",
 		},
+		{
+			path: "/write",
+			want: "influx",
+		},
+		{
+			path: "/api/put",
+			want: "opentsdb",
+		},
 		{
 			path: "/metrics/index.json",
 			want: "metrictank",
 		},
 		{
 			path: "/metrics/delete",
-			want: "metrictank",
+			want: "delete",
 		},
 		{
 			path: "/metrics/import",
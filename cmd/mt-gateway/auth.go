@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/configparser"
+	"github.com/grafana/metrictank/cmd/mt-gateway/ingest"
+	"github.com/grafana/metrictank/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+//A scope is a permission an api key can be granted
+type scope string
+
+const (
+	scopeRead   scope = "read"
+	scopeWrite  scope = "write"
+	scopeImport scope = "import"
+	scopeDelete scope = "delete"
+)
+
+var validScopes = map[scope]struct{}{
+	scopeRead:   {},
+	scopeWrite:  {},
+	scopeImport: {},
+	scopeDelete: {},
+}
+
+var (
+	authUnauthenticated = stats.NewCounterRate32("api.auth.unauthenticated") // requests without a valid api key
+	authForbidden       = stats.NewCounterRate32("api.auth.forbidden")       // requests with a valid api key that lacks the required scope
+	authReloadErrors    = stats.NewCounter32("api.auth.reload_errors")       // failed reloads of the api keys file
+)
+
+//An apiKey grants access to the data of a single org, limited to its scopes
+type apiKey struct {
+	name   string
+	key    string
+	orgId  int
+	scopes map[scope]struct{}
+
+	requests  *stats.CounterRate32
+	forbidden *stats.CounterRate32
+}
+
+func (k *apiKey) allows(s scope) bool {
+	_, ok := k.scopes[s]
+	return ok
+}
+
+//readApiKeys parses an api keys file. Every section defines one key:
+//
+//  [name]
+//  key = <secret>
+//  org-id = <org>
+//  scopes = read,write,import,delete
+func readApiKeys(file string) (map[string]*apiKey, error) {
+	config, err := configparser.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	_, sections, err := config.AllSections()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*apiKey)
+	names := make(map[string]struct{})
+	for _, s := range sections {
+		k := apiKey{
+			name:   s.Name(),
+			scopes: make(map[scope]struct{}),
+		}
+		if k.name == "" {
+			return nil, errors.New("encountered an api key section with empty name")
+		}
+		if _, ok := names[k.name]; ok {
+			return nil, fmt.Errorf("[%s]: duplicate api key name", k.name)
+		}
+		names[k.name] = struct{}{}
+
+		k.key = s.ValueOfWithoutComments("key")
+		if k.key == "" {
+			return nil, fmt.Errorf("[%s]: missing key", k.name)
+		}
+		if _, ok := keys[k.key]; ok {
+			return nil, fmt.Errorf("[%s]: key is already used by [%s]", k.name, keys[k.key].name)
+		}
+
+		orgId := s.ValueOfWithoutComments("org-id")
+		k.orgId, err = strconv.Atoi(orgId)
+		if err != nil || k.orgId < 1 {
+			return nil, fmt.Errorf("[%s]: invalid org-id %q", k.name, orgId)
+		}
+
+		for _, str := range strings.Split(s.ValueOfWithoutComments("scopes"), ",") {
+			sc := scope(strings.TrimSpace(str))
+			if sc == "" {
+				continue
+			}
+			if _, ok := validScopes[sc]; !ok {
+				return nil, fmt.Errorf("[%s]: invalid scope %q", k.name, sc)
+			}
+			k.scopes[sc] = struct{}{}
+		}
+		if len(k.scopes) == 0 {
+			return nil, fmt.Errorf("[%s]: no scopes", k.name)
+		}
+
+		// the registry returns the existing counters of keys that were already loaded before
+		k.requests = stats.NewCounterRate32(fmt.Sprintf("api.auth.key.%s.requests", k.name))
+		k.forbidden = stats.NewCounterRate32(fmt.Sprintf("api.auth.key.%s.forbidden", k.name))
+		keys[k.key] = &k
+	}
+	return keys, nil
+}
+
+//apiKeyStore holds the api keys loaded from a file, and reloads them when the file changes
+type apiKeyStore struct {
+	sync.RWMutex
+	file    string
+	modTime time.Time
+	keys    map[string]*apiKey
+}
+
+//newApiKeyStore loads the api keys from the given file
+func newApiKeyStore(file string) (*apiKeyStore, error) {
+	s := &apiKeyStore{
+		file: file,
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := readApiKeys(file)
+	if err != nil {
+		return nil, err
+	}
+	s.set(keys, info.ModTime())
+	return s, nil
+}
+
+func (s *apiKeyStore) set(keys map[string]*apiKey, modTime time.Time) {
+	s.Lock()
+	s.keys = keys
+	s.modTime = modTime
+	s.Unlock()
+}
+
+//reload re-reads the api keys file if it was modified since it was last loaded.
+//if the file can't be read or is invalid, the previously loaded keys remain in use
+func (s *apiKeyStore) reload() error {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return err
+	}
+	s.RLock()
+	modTime := s.modTime
+	s.RUnlock()
+	if info.ModTime().Equal(modTime) {
+		return nil
+	}
+	keys, err := readApiKeys(s.file)
+	if err != nil {
+		return err
+	}
+	s.set(keys, info.ModTime())
+	log.WithField("file", s.file).WithField("keys", len(keys)).Info("reloaded api keys")
+	return nil
+}
+
+//reloadLoop checks the api keys file for changes every interval, until done is closed
+func (s *apiKeyStore) reloadLoop(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := s.reload(); err != nil {
+				authReloadErrors.Inc()
+				log.WithField("file", s.file).WithError(err).Error("failed to reload api keys, keeping previous keys")
+			}
+		}
+	}
+}
+
+//get returns the api key with the given secret, if any
+func (s *apiKeyStore) get(key string) (*apiKey, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	for secret, k := range s.keys {
+		// compare all keys in constant time, so that response times don't leak the secrets
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(key)) == 1 {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+//requestKey returns the api key presented in the request, either as a bearer token
+//or as the password of basic auth (the username is ignored)
+func requestKey(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+//Require a valid api key with the given scope. The org of the key is set as `X-Org-Id` header
+//for downstream services and as the org of any ingested data
+func authMiddleware(keys *apiKeyStore, s scope, base http.Handler) http.Handler {
+	return scopedAuthMiddleware(keys, func(r *http.Request) (scope, bool) { return s, true }, base)
+}
+
+//Like authMiddleware, but the required scope depends on the request.
+//Requests for which scopeOf returns false are rejected, whatever the key.
+func scopedAuthMiddleware(keys *apiKeyStore, scopeOf func(r *http.Request) (scope, bool), base http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := scopeOf(r)
+		if !ok {
+			rejectRequest(w, r)
+			return
+		}
+		k, ok := keys.get(requestKey(r))
+		if !ok {
+			authUnauthenticated.Inc()
+			w.Header().Set("WWW-Authenticate", `Basic realm="mt-gateway"`)
+			http.Error(w, "missing or invalid api key", http.StatusUnauthorized)
+			return
+		}
+		k.requests.Inc()
+		if !k.allows(s) {
+			authForbidden.Inc()
+			k.forbidden.Inc()
+			http.Error(w, fmt.Sprintf("api key does not have the %q scope", s), http.StatusForbidden)
+			return
+		}
+		// the key is for the gateway only, downstream services must not see it
+		r.Header.Del("Authorization")
+		r.Header.Set("X-Org-Id", strconv.Itoa(k.orgId))
+		base.ServeHTTP(w, r.WithContext(ingest.WithOrgId(r.Context(), k.orgId)))
+	})
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testApiKeys = `
+[writer]
+key = secret1
+org-id = 3
+scopes = write, import
+
+[reader]
+key = secret2 # comment
+org-id = 4
+scopes = read
+`
+
+func writeApiKeys(t *testing.T, dir, content string) string {
+	file := filepath.Join(dir, "api-keys.ini")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write api keys file: %s", err)
+	}
+	return file
+}
+
+func TestReadApiKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mt-gateway-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys, err := readApiKeys(writeApiKeys(t, dir, testApiKeys))
+	if err != nil {
+		t.Fatalf("failed to read api keys: %s", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+	k, ok := keys["secret2"]
+	if !ok || k.name != "reader" || k.orgId != 4 || !k.allows(scopeRead) || k.allows(scopeWrite) {
+		t.Fatalf("unexpected key %+v", k)
+	}
+	k = keys["secret1"]
+	if k.orgId != 3 || !k.allows(scopeWrite) || !k.allows(scopeImport) || k.allows(scopeDelete) {
+		t.Fatalf("unexpected key %+v", k)
+	}
+
+	invalid := map[string]string{
+		"missing key":    "[a]\norg-id = 1\nscopes = read\n",
+		"invalid org":    "[a]\nkey = x\norg-id = 0\nscopes = read\n",
+		"invalid scope":  "[a]\nkey = x\norg-id = 1\nscopes = admin\n",
+		"no scopes":      "[a]\nkey = x\norg-id = 1\n",
+		"duplicate key":  "[a]\nkey = x\norg-id = 1\nscopes = read\n[b]\nkey = x\norg-id = 2\nscopes = read\n",
+		"duplicate name": "[a]\nkey = x\norg-id = 1\nscopes = read\n[a]\nkey = y\norg-id = 2\nscopes = read\n",
+	}
+	for name, content := range invalid {
+		if _, err := readApiKeys(writeApiKeys(t, dir, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mt-gateway-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys, err := newApiKeyStore(writeApiKeys(t, dir, testApiKeys))
+	if err != nil {
+		t.Fatalf("failed to load api keys: %s", err)
+	}
+
+	// responds with the org and authorization headers the downstream service sees
+	downstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Org-Id") + "|" + r.Header.Get("Authorization")))
+	})
+	handler := authMiddleware(keys, scopeWrite, downstream)
+
+	type args struct {
+		name      string
+		setAuth   func(r *http.Request)
+		expStatus int
+		expBody   string
+	}
+	tests := []args{
+		{
+			name:      "no key",
+			setAuth:   func(r *http.Request) {},
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "unknown key",
+			setAuth:   func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") },
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "missing scope",
+			setAuth:   func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret2") },
+			expStatus: http.StatusForbidden,
+		},
+		{
+			name:      "bearer",
+			setAuth:   func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret1") },
+			expStatus: http.StatusOK,
+			expBody:   "3|",
+		},
+		{
+			name:      "basic",
+			setAuth:   func(r *http.Request) { r.SetBasicAuth("api_key", "secret1") },
+			expStatus: http.StatusOK,
+			expBody:   "3|",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/metrics", nil)
+			// a client provided org must never be trusted
+			req.Header.Set("X-Org-Id", "1")
+			test.setAuth(req)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if recorder.Code != test.expStatus {
+				t.Fatalf("expected status %d, got %d", test.expStatus, recorder.Code)
+			}
+			if test.expStatus == http.StatusOK && recorder.Body.String() != test.expBody {
+				t.Fatalf("expected body %q, got %q", test.expBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestApiKeyStoreReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mt-gateway-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := writeApiKeys(t, dir, testApiKeys)
+	keys, err := newApiKeyStore(file)
+	if err != nil {
+		t.Fatalf("failed to load api keys: %s", err)
+	}
+
+	// an invalid file keeps the previous keys
+	writeApiKeys(t, dir, "[a]\nkey = x\n")
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Minute))
+	if err := keys.reload(); err == nil {
+		t.Fatalf("expected reload of an invalid file to fail")
+	}
+	if _, ok := keys.get("secret1"); !ok {
+		t.Fatalf("expected previous keys to remain in use")
+	}
+
+	writeApiKeys(t, dir, strings.Replace(testApiKeys, "secret1", "secret3", 1))
+	os.Chtimes(file, time.Now(), time.Now().Add(2*time.Minute))
+	if err := keys.reload(); err != nil {
+		t.Fatalf("failed to reload api keys: %s", err)
+	}
+	if _, ok := keys.get("secret1"); ok {
+		t.Fatalf("expected secret1 to be removed")
+	}
+	if k, ok := keys.get("secret3"); !ok || k.name != "writer" {
+		t.Fatalf("expected secret3 to be loaded for writer")
+	}
+}
+
+func TestProxyScopes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mt-gateway-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys, err := newApiKeyStore(writeApiKeys(t, dir, testApiKeys))
+	if err != nil {
+		t.Fatalf("failed to load api keys: %s", err)
+	}
+	downstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := scopedAuthMiddleware(keys, proxyScope, downstream)
+
+	type args struct {
+		method    string
+		path      string
+		key       string
+		expStatus int
+	}
+	tests := []args{
+		{"GET", "/render", "secret2", http.StatusOK},
+		{"POST", "/render", "secret2", http.StatusOK},
+		{"POST", "/tags/name", "secret2", http.StatusOK},
+		{"POST", "/tags/terms", "secret2", http.StatusOK},
+		{"POST", "/tags/tagSeries", "secret2", http.StatusForbidden},
+		{"POST", "/tags/tagMultiSeries", "secret2", http.StatusForbidden},
+		{"POST", "/tags/tagMultiSeries", "secret1", http.StatusOK},
+		{"POST", "/tags/name/other", "secret2", http.StatusMethodNotAllowed},
+		{"POST", "/functions/sumSeries", "secret2", http.StatusOK},
+		{"POST", "/tags/delSeries", "secret2", http.StatusForbidden},
+		{"POST", "/TAGS/DELSERIES", "secret2", http.StatusForbidden},
+		{"GET", "/tags/delByQuery", "secret2", http.StatusForbidden},
+		{"DELETE", "/events/1", "secret2", http.StatusForbidden},
+		{"POST", "/events", "secret2", http.StatusForbidden},
+		{"POST", "/events", "secret1", http.StatusOK},
+		{"POST", "/unknown", "secret2", http.StatusMethodNotAllowed},
+		{"PUT", "/render", "secret1", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			req.Header.Set("Authorization", "Bearer "+test.key)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if recorder.Code != test.expStatus {
+				t.Fatalf("expected status %d, got %d", test.expStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+// without api key authentication, there are no scopes to enforce, so all requests are proxied as before
+func TestProxyWithoutApiKeys(t *testing.T) {
+	downstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := withScopedMiddleware("graphite", nil, proxyScope, downstream)
+	for _, method := range []string{"POST", "PUT"} {
+		req := httptest.NewRequest(method, "/unknown", nil)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", method, http.StatusOK, recorder.Code)
+		}
+	}
+}
+
+func TestApiKeyStoreReloadLoopStops(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mt-gateway-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys, err := newApiKeyStore(writeApiKeys(t, dir, testApiKeys))
+	if err != nil {
+		t.Fatalf("failed to load api keys: %s", err)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		keys.reloadLoop(time.Millisecond, done)
+		close(stopped)
+	}()
+	close(done)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the reload loop to stop")
+	}
+}
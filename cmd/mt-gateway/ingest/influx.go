@@ -0,0 +1,244 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/schema"
+)
+
+var (
+	// InfluxFieldSeparator separates the measurement and the field name in the names of the series
+	InfluxFieldSeparator = "."
+	// InfluxValueFields are the fields which map to a series named after just the measurement
+	InfluxValueFields = map[string]struct{}{"value": {}}
+
+	errInfluxInvalidLine      = errors.New("invalid line protocol")
+	errInfluxStringField      = errors.New("string fields are not supported")
+	errInfluxInvalidField     = errors.New("invalid field value")
+	errInfluxInvalidTs        = errors.New("invalid timestamp")
+	errInfluxInvalidPrecision = errors.New("invalid precision")
+)
+
+// influxPrecisions maps the precisions supported by influxdb to the duration of their unit
+var influxPrecisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// InfluxWrite handles the influxdb /write endpoint, which takes the influx line protocol.
+// each field of each line becomes a series named <measurement><separator><field>,
+// except for the value fields which become a series named after the measurement.
+// the tags of the line become the tags of the series.
+func InfluxWrite(w http.ResponseWriter, r *http.Request) {
+	precision, ok := influxPrecisions[r.URL.Query().Get("precision")]
+	if !ok {
+		writeErrorResponse(w, 400, "%s %q", errInfluxInvalidPrecision, r.URL.Query().Get("precision"))
+		return
+	}
+	orgId, err := getOrgId(r)
+	if err != nil {
+		writeErrorResponse(w, 400, "%s", err)
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	resp := NewMetricsResponse()
+	discards := make(discardsByOrg)
+	var metrics []*schema.MetricData
+	var lines []int
+	now := time.Now()
+	for i, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		lineMetrics, stringFields, err := parseInfluxLine(line, orgId, precision, now)
+		if err != nil {
+			resp.AddInvalid(err, i)
+			discards.Add(orgId, err.Error())
+			continue
+		}
+		for j := 0; j < stringFields; j++ {
+			discards.Add(orgId, errInfluxStringField.Error())
+		}
+		for _, m := range lineMetrics {
+			metrics = append(metrics, m)
+			lines = append(lines, i)
+		}
+	}
+
+	toPublish := make([]*schema.MetricData, 0, len(metrics))
+	toPublish, resp = prepareIngestWithDiscards(metrics, lines, toPublish, resp, discards)
+	// like influxdb, we return no content if all points were written
+	publishAndRespond(w, r, toPublish, resp, http.StatusNoContent)
+}
+
+// parseInfluxLine parses a line of the influx line protocol into one MetricData per field.
+// string fields can't be stored, so they are skipped and only counted, the other fields of the line are kept.
+// https://docs.influxdata.com/influxdb/v1.8/write_protocols/line_protocol_reference/
+func parseInfluxLine(line string, orgId int, precision time.Duration, now time.Time) ([]*schema.MetricData, int, error) {
+	sections := splitInfluxEscaped(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, 0, errInfluxInvalidLine
+	}
+
+	key := splitInfluxEscaped(sections[0], ',', false)
+	measurement := unescapeInflux(key[0])
+	if measurement == "" {
+		return nil, 0, errInfluxInvalidLine
+	}
+	tags := make([]string, 0, len(key)-1)
+	for _, tag := range key[1:] {
+		kv := splitInfluxEscaped(tag, '=', false)
+		if len(kv) != 2 {
+			return nil, 0, errInfluxInvalidLine
+		}
+		tags = append(tags, unescapeInflux(kv[0])+"="+unescapeInflux(kv[1]))
+	}
+
+	ts := now.Unix()
+	if len(sections) == 3 {
+		raw, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, 0, errInfluxInvalidTs
+		}
+		if precision > time.Second {
+			ts = raw * int64(precision/time.Second)
+		} else {
+			ts = raw / int64(time.Second/precision)
+		}
+	}
+
+	var metrics []*schema.MetricData
+	var stringFields int
+	for _, field := range splitInfluxEscaped(sections[1], ',', true) {
+		kv := splitInfluxEscaped(field, '=', true)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, 0, errInfluxInvalidLine
+		}
+		value, err := parseInfluxFieldValue(kv[1])
+		if err == errInfluxStringField {
+			stringFields++
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		fieldName := unescapeInflux(kv[0])
+		name := measurement + InfluxFieldSeparator + fieldName
+		if _, ok := InfluxValueFields[fieldName]; ok {
+			name = measurement
+		}
+		m := &schema.MetricData{
+			OrgId: orgId,
+			Name:  name,
+			Value: value,
+			Time:  ts,
+			Tags:  append(make([]string, 0, len(tags)), tags...),
+		}
+		m.Interval = getInterval(m)
+		metrics = append(metrics, m)
+	}
+	return metrics, stringFields, nil
+}
+
+func parseInfluxFieldValue(v string) (float64, error) {
+	if v == "" {
+		return 0, errInfluxInvalidField
+	}
+	if v[0] == '"' {
+		return 0, errInfluxStringField
+	}
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, nil
+	}
+	switch v[len(v)-1] {
+	case 'i':
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return 0, errInfluxInvalidField
+		}
+		return float64(i), nil
+	case 'u':
+		u, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return 0, errInfluxInvalidField
+		}
+		return float64(u), nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errInfluxInvalidField
+	}
+	return f, nil
+}
+
+// splitInfluxEscaped splits s on each occurrence of sep that is not escaped by a backslash.
+// if quotes is true, separators within double quotes (string field values) are ignored as well.
+// escape sequences are kept, so they can be handled by the caller.
+func splitInfluxEscaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	start := 0
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeInflux removes the backslashes of the escaped commas, equal signs and spaces of
+// measurements, tag keys, tag values and field keys
+func unescapeInflux(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == ',' || s[i+1] == '=' || s[i+1] == ' ') {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// getOrgId returns the authenticated org of the request, or otherwise the org id from the X-Org-Id header,
+// which mt-gateway defaults to -default-org-id.
+// unlike the metrictank payloads, the influx and opentsdb payloads don't contain the org id.
+func getOrgId(r *http.Request) (int, error) {
+	if orgId, ok := authenticatedOrgId(r); ok {
+		return orgId, nil
+	}
+	orgId, err := strconv.Atoi(r.Header.Get("X-Org-Id"))
+	if err != nil || orgId < 1 {
+		return 0, fmt.Errorf("missing or invalid X-Org-Id header %q", r.Header.Get("X-Org-Id"))
+	}
+	return orgId, nil
+}
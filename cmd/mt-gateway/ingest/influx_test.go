@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/publish"
+	"github.com/grafana/metrictank/schema"
+)
+
+type fixedIntervalGetter int
+
+func (f fixedIntervalGetter) GetInterval(name string) int {
+	return int(f)
+}
+
+func TestParseInfluxLine(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	cases := []struct {
+		line         string
+		precision    time.Duration
+		exp          []*schema.MetricData
+		stringFields int
+		err          error
+	}{
+		{
+			line:      `cpu,host=server01,region=us-west value=0.64 1600000000000000000`,
+			precision: time.Nanosecond,
+			exp: []*schema.MetricData{
+				{OrgId: 1, Name: "cpu", Value: 0.64, Time: 1600000000, Tags: []string{"host=server01", "region=us-west"}},
+			},
+		},
+		{
+			line:      `disk\ io,path=/var\,log used=10i,free=20u,ok=true,bad=F 1600000010`,
+			precision: time.Second,
+			exp: []*schema.MetricData{
+				{OrgId: 1, Name: "disk io.used", Value: 10, Time: 1600000010, Tags: []string{"path=/var,log"}},
+				{OrgId: 1, Name: "disk io.free", Value: 20, Time: 1600000010, Tags: []string{"path=/var,log"}},
+				{OrgId: 1, Name: "disk io.ok", Value: 1, Time: 1600000010, Tags: []string{"path=/var,log"}},
+				{OrgId: 1, Name: "disk io.bad", Value: 0, Time: 1600000010, Tags: []string{"path=/var,log"}},
+			},
+		},
+		{
+			line:      `mem free=1.5e3`,
+			precision: time.Nanosecond,
+			exp: []*schema.MetricData{
+				{OrgId: 1, Name: "mem.free", Value: 1500, Time: 1600000000, Tags: []string{}},
+			},
+		},
+		{
+			line:      `load value=2 26666667`,
+			precision: time.Minute,
+			exp: []*schema.MetricData{
+				{OrgId: 1, Name: "load", Value: 2, Time: 1600000020, Tags: []string{}},
+			},
+		},
+		{
+			line: `event,host=a msg="hello, world",value=1,status="ok" 1600000000`,
+			exp: []*schema.MetricData{
+				{OrgId: 1, Name: "event", Value: 1, Time: 1600000000, Tags: []string{"host=a"}},
+			},
+			precision:    time.Second,
+			stringFields: 2,
+		},
+		{
+			line:         `event msg="hello"`,
+			stringFields: 1,
+		},
+		{
+			line: `cpu value=abc`,
+			err:  errInfluxInvalidField,
+		},
+		{
+			line: `cpu value=1 notatimestamp`,
+			err:  errInfluxInvalidTs,
+		},
+		{
+			line: `cpu`,
+			err:  errInfluxInvalidLine,
+		},
+		{
+			line: `cpu,host value=1`,
+			err:  errInfluxInvalidLine,
+		},
+	}
+
+	for i, c := range cases {
+		got, stringFields, err := parseInfluxLine(c.line, 1, c.precision, now)
+		if err != c.err {
+			t.Fatalf("case %d: expected error %v, got %v", i, c.err, err)
+		}
+		if stringFields != c.stringFields {
+			t.Fatalf("case %d: expected %d string fields, got %d", i, c.stringFields, stringFields)
+		}
+		if !reflect.DeepEqual(got, c.exp) {
+			gotJson, _ := json.Marshal(got)
+			t.Fatalf("case %d: expected %+v, got %s", i, c.exp, gotJson)
+		}
+	}
+}
+
+func TestInfluxWrite(t *testing.T) {
+	publish.Init(nil)
+	SetIntervalGetter(fixedIntervalGetter(10))
+	defer SetIntervalGetter(nil)
+
+	body := strings.Join([]string{
+		`cpu,host=a value=1 1600000000`,
+		``,
+		`# a comment`,
+		`cpu,host=b value=abc 1600000000`,
+		`mem,host=a used=5,free=10,state="ok" 1600000000`,
+	}, "\n")
+
+	req := httptest.NewRequest("POST", "/write?db=foo&precision=s", strings.NewReader(body))
+	req.Header.Set("X-Org-Id", "3")
+	recorder := httptest.NewRecorder()
+	InfluxWrite(recorder, req)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 because of the invalid field, got %d", recorder.Code)
+	}
+	var resp MetricsResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	expErr := ValidationError{Count: 1, ExampleIds: []int{3}}
+	if resp.Published != 3 || resp.Invalid != 1 || !reflect.DeepEqual(resp.ValidationErrors[errInfluxInvalidField.Error()], expErr) {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	// string fields are skipped, the numeric fields of their line are kept
+	req = httptest.NewRequest("POST", "/write?precision=s", strings.NewReader(`mem,host=a used=5,state="ok" 1600000000`))
+	req.Header.Set("X-Org-Id", "3")
+	recorder = httptest.NewRecorder()
+	InfluxWrite(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// all valid
+	req = httptest.NewRequest("POST", "/write?precision=s", strings.NewReader(`cpu,host=a value=1 1600000000`))
+	req.Header.Set("X-Org-Id", "3")
+	recorder = httptest.NewRecorder()
+	InfluxWrite(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// without org
+	req = httptest.NewRequest("POST", "/write", strings.NewReader(`cpu,host=a value=1`))
+	recorder = httptest.NewRecorder()
+	InfluxWrite(recorder, req)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without org, got %d", recorder.Code)
+	}
+
+	// invalid precision
+	req = httptest.NewRequest("POST", "/write?precision=d", strings.NewReader(`cpu,host=a value=1`))
+	req.Header.Set("X-Org-Id", "3")
+	recorder = httptest.NewRecorder()
+	InfluxWrite(recorder, req)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an invalid precision, got %d", recorder.Code)
+	}
+}
@@ -1,6 +1,8 @@
 package ingest
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -61,6 +63,31 @@ func Metrics(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type orgIdKey struct{}
+
+// WithOrgId returns a context which marks the request as authenticated for the given org.
+// all data ingested with such a request is stored under this org, regardless of the org in the payload
+func WithOrgId(ctx context.Context, orgId int) context.Context {
+	return context.WithValue(ctx, orgIdKey{}, orgId)
+}
+
+// authenticatedOrgId returns the org the request was authenticated for, if any
+func authenticatedOrgId(r *http.Request) (int, bool) {
+	orgId, ok := r.Context().Value(orgIdKey{}).(int)
+	return orgId, ok
+}
+
+// enforceOrgId sets the org of the given metrics to the authenticated org of the request, if any
+func enforceOrgId(r *http.Request, metrics []*schema.MetricData) {
+	orgId, ok := authenticatedOrgId(r)
+	if !ok {
+		return
+	}
+	for _, m := range metrics {
+		m.OrgId = orgId
+	}
+}
+
 type discardsByReason map[string]int
 type discardsByOrg map[int]discardsByReason
 
@@ -74,9 +101,14 @@ func (dbo discardsByOrg) Add(org int, reason string) {
 }
 
 func prepareIngest(in []*schema.MetricData, toPublish []*schema.MetricData) ([]*schema.MetricData, MetricsResponse) {
-	resp := NewMetricsResponse()
-	promDiscards := make(discardsByOrg)
+	return prepareIngestWithDiscards(in, nil, toPublish, NewMetricsResponse(), make(discardsByOrg))
+}
 
+// prepareIngestWithDiscards is like prepareIngest, for payloads that need to be converted to MetricData first.
+// resp and promDiscards may already contain the discards of the conversion.
+// indexes are the indexes of the metrics within the request, to be reported for invalid metrics. if nil,
+// the indexes within in are used.
+func prepareIngestWithDiscards(in []*schema.MetricData, indexes []int, toPublish []*schema.MetricData, resp MetricsResponse, promDiscards discardsByOrg) ([]*schema.MetricData, MetricsResponse) {
 	var metricTimestamp *stats.Range32
 
 	for i, m := range in {
@@ -85,7 +117,11 @@ func prepareIngest(in []*schema.MetricData, toPublish []*schema.MetricData) ([]*
 		}
 		if err := m.Validate(); err != nil {
 			log.Debugf("received invalid metric: %v %v %v", m.Name, m.OrgId, m.Tags)
-			resp.AddInvalid(err, i)
+			if indexes != nil {
+				resp.AddInvalid(err, indexes[i])
+			} else {
+				resp.AddInvalid(err, i)
+			}
 			promDiscards.Add(m.OrgId, err.Error())
 			continue
 		}
@@ -129,6 +165,7 @@ func metricsJson(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	enforceOrgId(r, metrics)
 	toPublish := make([]*schema.MetricData, 0, len(metrics))
 	toPublish, resp := prepareIngest(metrics, toPublish)
 
@@ -187,6 +224,7 @@ func metricsBinary(w http.ResponseWriter, r *http.Request, compressed bool) {
 		return
 	}
 
+	enforceOrgId(r, metricData.Metrics)
 	toPublish := make([]*schema.MetricData, 0, len(metricData.Metrics))
 	toPublish, resp := prepareIngest(metricData.Metrics, toPublish)
 
@@ -209,6 +247,84 @@ func metricsBinary(w http.ResponseWriter, r *http.Request, compressed bool) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// IntervalGetter is anything that can return the interval for the given name (including tags).
+// it is used for protocols which don't specify the interval of their series.
+type IntervalGetter interface {
+	GetInterval(name string) int
+}
+
+var intervalGetter IntervalGetter
+
+func SetIntervalGetter(i IntervalGetter) {
+	intervalGetter = i
+}
+
+// getInterval returns the interval of the given metric, or 0 if it can't be determined
+func getInterval(m *schema.MetricData) int {
+	if intervalGetter == nil {
+		return 0
+	}
+	return intervalGetter.GetInterval(schema.MetricDefinitionFromMetricData(m).NameWithTags())
+}
+
+// readBody reads the (optionally gzipped) body of the request.
+// if it fails, it writes the error response and returns false
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Body == nil {
+		writeErrorResponse(w, 400, "no data included in request.")
+		return nil, false
+	}
+	defer r.Body.Close()
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeErrorResponse(w, 400, "unable to decompress request body. %s", err)
+			return nil, false
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		select {
+		case <-r.Context().Done():
+			writeErrorResponse(w, 499, "request canceled")
+		default:
+			writeErrorResponse(w, 500, "unable to read request body. %s", err)
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+// publishAndRespond publishes the given metrics and writes the response.
+// if any metric was invalid, the response has status 400, otherwise the given status.
+func publishAndRespond(w http.ResponseWriter, r *http.Request, toPublish []*schema.MetricData, resp MetricsResponse, status int) {
+	select {
+	case <-r.Context().Done():
+		writeErrorResponse(w, 499, "request canceled")
+		return
+	default:
+	}
+
+	err := publish.Publish(toPublish)
+	if err != nil {
+		writeErrorResponse(w, 500, "failed to publish metrics. %s", err)
+		return
+	}
+
+	// track published in the response (it already has discards)
+	resp.Published = len(toPublish)
+	if resp.Invalid > 0 {
+		status = 400
+	}
+	w.WriteHeader(status)
+	if status != http.StatusNoContent {
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
 func writeErrorResponse(w http.ResponseWriter, status int, msg string, fmtArgs ...interface{}) {
 	w.WriteHeader(status)
 	formatted := fmt.Sprintf(msg, fmtArgs...)
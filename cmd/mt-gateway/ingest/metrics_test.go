@@ -0,0 +1,36 @@
+package ingest
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/metrictank/schema"
+)
+
+func TestEnforceOrgId(t *testing.T) {
+	metrics := []*schema.MetricData{{OrgId: 1}, {OrgId: 2}}
+
+	// unauthenticated requests keep the orgs of the payload
+	req := httptest.NewRequest("POST", "/metrics", nil)
+	enforceOrgId(req, metrics)
+	if metrics[0].OrgId != 1 || metrics[1].OrgId != 2 {
+		t.Fatalf("expected orgs to be unchanged, got %d and %d", metrics[0].OrgId, metrics[1].OrgId)
+	}
+
+	req = req.WithContext(WithOrgId(req.Context(), 5))
+	enforceOrgId(req, metrics)
+	if metrics[0].OrgId != 5 || metrics[1].OrgId != 5 {
+		t.Fatalf("expected orgs to be set to 5, got %d and %d", metrics[0].OrgId, metrics[1].OrgId)
+	}
+}
+
+func TestGetOrgIdAuthenticated(t *testing.T) {
+	// the authenticated org takes precedence over the header
+	req := httptest.NewRequest("POST", "/write", nil)
+	req.Header.Set("X-Org-Id", "3")
+	req = req.WithContext(WithOrgId(req.Context(), 5))
+	orgId, err := getOrgId(req)
+	if err != nil || orgId != 5 {
+		t.Fatalf("expected org 5, got %d (err %v)", orgId, err)
+	}
+}
@@ -0,0 +1,105 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/metrictank/schema"
+)
+
+var errOpenTSDBInvalidValue = errors.New("invalid value")
+
+// openTSDBPoint is a datapoint as sent to the opentsdb /api/put endpoint
+// http://opentsdb.net/docs/build/html/api_http/put.html
+type openTSDBPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     json.RawMessage   `json:"value"` // a number, or a string holding a number
+	Tags      map[string]string `json:"tags"`
+}
+
+// OpenTSDBPut handles the opentsdb /api/put endpoint, which takes a json datapoint or a list of them.
+func OpenTSDBPut(w http.ResponseWriter, r *http.Request) {
+	orgId, err := getOrgId(r)
+	if err != nil {
+		writeErrorResponse(w, 400, "%s", err)
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var points []openTSDBPoint
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		points = make([]openTSDBPoint, 1)
+		err = json.Unmarshal(body, &points[0])
+	} else {
+		err = json.Unmarshal(body, &points)
+	}
+	if err != nil {
+		writeErrorResponse(w, 400, "unable to parse request body. %s", err)
+		return
+	}
+
+	resp := NewMetricsResponse()
+	discards := make(discardsByOrg)
+	metrics := make([]*schema.MetricData, 0, len(points))
+	indexes := make([]int, 0, len(points))
+	for i, p := range points {
+		m, err := p.toMetricData(orgId)
+		if err != nil {
+			resp.AddInvalid(err, i)
+			discards.Add(orgId, err.Error())
+			continue
+		}
+		metrics = append(metrics, m)
+		indexes = append(indexes, i)
+	}
+
+	toPublish := make([]*schema.MetricData, 0, len(metrics))
+	toPublish, resp = prepareIngestWithDiscards(metrics, indexes, toPublish, resp, discards)
+
+	// like opentsdb, we only return the details if they were asked for
+	status := http.StatusNoContent
+	query := r.URL.Query()
+	if _, ok := query["summary"]; ok {
+		status = http.StatusOK
+	}
+	if _, ok := query["details"]; ok {
+		status = http.StatusOK
+	}
+	publishAndRespond(w, r, toPublish, resp, status)
+}
+
+func (p openTSDBPoint) toMetricData(orgId int) (*schema.MetricData, error) {
+	value, err := strconv.ParseFloat(strings.Trim(string(p.Value), `"`), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, errOpenTSDBInvalidValue
+	}
+	// timestamps with more than 10 digits are in milliseconds
+	ts := p.Timestamp
+	if ts > 9999999999 {
+		ts /= 1000
+	}
+	m := &schema.MetricData{
+		OrgId: orgId,
+		Name:  p.Metric,
+		Value: value,
+		Time:  ts,
+		Tags:  make([]string, 0, len(p.Tags)),
+	}
+	for k, v := range p.Tags {
+		m.Tags = append(m.Tags, k+"="+v)
+	}
+	sort.Strings(m.Tags)
+	m.Interval = getInterval(m)
+	return m, nil
+}
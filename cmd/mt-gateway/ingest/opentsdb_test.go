@@ -0,0 +1,102 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grafana/metrictank/publish"
+	"github.com/grafana/metrictank/schema"
+)
+
+func TestOpenTSDBToMetricData(t *testing.T) {
+	SetIntervalGetter(fixedIntervalGetter(60))
+	defer SetIntervalGetter(nil)
+
+	cases := []struct {
+		in  string
+		exp *schema.MetricData
+		err error
+	}{
+		{
+			in:  `{"metric":"sys.cpu.nice","timestamp":1600000000,"value":18,"tags":{"host":"web01","dc":"lga"}}`,
+			exp: &schema.MetricData{OrgId: 2, Name: "sys.cpu.nice", Interval: 60, Value: 18, Time: 1600000000, Tags: []string{"dc=lga", "host=web01"}},
+		},
+		{
+			in:  `{"metric":"sys.cpu.nice","timestamp":1600000000123,"value":"1.5"}`,
+			exp: &schema.MetricData{OrgId: 2, Name: "sys.cpu.nice", Interval: 60, Value: 1.5, Time: 1600000000, Tags: []string{}},
+		},
+		{
+			in:  `{"metric":"sys.cpu.nice","timestamp":1600000000,"value":"NaN"}`,
+			err: errOpenTSDBInvalidValue,
+		},
+	}
+	for i, c := range cases {
+		var p openTSDBPoint
+		if err := json.Unmarshal([]byte(c.in), &p); err != nil {
+			t.Fatalf("case %d: failed to decode: %s", i, err)
+		}
+		got, err := p.toMetricData(2)
+		if err != c.err {
+			t.Fatalf("case %d: expected error %v, got %v", i, c.err, err)
+		}
+		if !reflect.DeepEqual(got, c.exp) {
+			t.Fatalf("case %d: expected %+v, got %+v", i, c.exp, got)
+		}
+	}
+}
+
+func TestOpenTSDBPut(t *testing.T) {
+	publish.Init(nil)
+	SetIntervalGetter(fixedIntervalGetter(10))
+	defer SetIntervalGetter(nil)
+
+	cases := []struct {
+		body         string
+		query        string
+		gzip         bool
+		expStatus    int
+		expPublished int
+		expInvalid   int
+	}{
+		{`{"metric":"a","timestamp":1600000000,"value":1,"tags":{"host":"x"}}`, "", false, 204, 1, 0},
+		{`[{"metric":"a","timestamp":1600000000,"value":1},{"metric":"b","timestamp":1600000000,"value":2}]`, "?summary", true, 200, 2, 0},
+		// the second one has no name, the third one an invalid value
+		{`[{"metric":"a","timestamp":1600000000,"value":1},{"timestamp":1600000000,"value":2},{"metric":"c","timestamp":1600000000,"value":"x"}]`, "", false, 400, 1, 2},
+		{`not json`, "", false, 400, 0, 0},
+	}
+	for i, c := range cases {
+		body := []byte(c.body)
+		if c.gzip {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write(body)
+			gz.Close()
+			body = buf.Bytes()
+		}
+		req := httptest.NewRequest("POST", "/api/put"+c.query, bytes.NewReader(body))
+		req.Header.Set("X-Org-Id", "1")
+		if c.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		recorder := httptest.NewRecorder()
+		OpenTSDBPut(recorder, req)
+		if recorder.Code != c.expStatus {
+			t.Fatalf("case %d: expected status %d, got %d: %s", i, c.expStatus, recorder.Code, recorder.Body.String())
+		}
+		if c.expStatus == 204 || !strings.HasPrefix(recorder.Body.String(), "{") {
+			continue
+		}
+		var resp MetricsResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("case %d: failed to decode response: %s", i, err)
+		}
+		if resp.Published != c.expPublished || resp.Invalid != c.expInvalid {
+			t.Fatalf("case %d: unexpected response %+v", i, resp)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/grafana/globalconf"
+	"github.com/grafana/metrictank/cmd/mt-gateway/ingest"
 	"github.com/grafana/metrictank/logger"
 	"github.com/grafana/metrictank/stats"
 	log "github.com/sirupsen/logrus"
@@ -28,6 +29,14 @@ var (
 	brokers       = flag.String("kafka-tcp-addr", "localhost:9092", "kafka tcp address(es) for metrics, in csv host[:port] format")
 	logLevel      = flag.String("log-level", "info", "log level. panic|fatal|error|warning|info|debug")
 
+	// authentication
+	apiKeysFile           = flag.String("api-keys-file", "", "path to the api keys file. if set, all requests must be authenticated with an api key and default-org-id is ignored")
+	apiKeysReloadInterval = flag.Duration("api-keys-reload-interval", time.Minute, "interval at which the api keys file is checked for changes. 0 disables reloading")
+
+	// influx line protocol
+	influxFieldSeparator = flag.String("influx-field-separator", ".", "separator between the measurement and field name in the names of series ingested via /write")
+	influxValueFields    = flag.String("influx-value-fields", "value", "comma separated list of fields which map to a series named after just the measurement, when ingested via /write")
+
 	// stats
 	statsEnabled    = flag.Bool("stats-enabled", false, "enable sending graphite messages for instrumentation")
 	statsPrefix     = flag.String("stats-prefix", "mt-gateway.stats.default.$hostname", "stats prefix (will add trailing dot automatically if needed)")
@@ -97,6 +106,14 @@ func main() {
 		stats.NewDevnull()
 	}
 
+	ingest.InfluxFieldSeparator = *influxFieldSeparator
+	ingest.InfluxValueFields = make(map[string]struct{})
+	for _, field := range strings.Split(*influxValueFields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			ingest.InfluxValueFields[field] = struct{}{}
+		}
+	}
+
 	urls := Urls{}
 	urls.kafkaBrokers = *brokers
 
@@ -113,6 +130,21 @@ func main() {
 		log.Fatal(err)
 	}
 
+	var keys *apiKeyStore
+	done := make(chan struct{})
+	if *apiKeysFile != "" {
+		keys, err = newApiKeyStore(*apiKeysFile)
+		if err != nil {
+			log.Fatalf("failed to load api keys: %s", err)
+		}
+		if *apiKeysReloadInterval > 0 {
+			go keys.reloadLoop(*apiKeysReloadInterval, done)
+		}
+		log.WithField("file", *apiKeysFile).Info("api key authentication enabled")
+	}
+
 	log.WithField("addr", *addr).Info("starting server")
-	log.WithError(http.ListenAndServe(*addr, NewApi(urls).Mux())).Fatal("terminating")
+	err = http.ListenAndServe(*addr, NewApi(urls, keys).Mux())
+	close(done)
+	log.WithError(err).Fatal("terminating")
 }
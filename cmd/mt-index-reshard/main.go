@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/grafana/metrictank/cluster/partitioner"
+	"github.com/grafana/metrictank/logger"
+	"github.com/grafana/metrictank/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	logLevel        = flag.String("log-level", "info", "log level. panic|fatal|error|warning|info|debug")
+	dryRun          = flag.Bool("dry-run", true, "run in dry-run mode. Only report which series move to which partition, no changes will be made.")
+	cassAddr        = flag.String("cass-addr", "localhost", "Address of cassandra host.")
+	keyspace        = flag.String("keyspace", "metrictank", "Cassandra keyspace in use.")
+	table           = flag.String("table", "metric_idx", "Cassandra table name in use.")
+	partitionScheme = flag.String("partition-scheme", "bySeries", "method used for partitioning metrics. (byOrg|bySeries|bySeriesWithTags|bySeriesWithTagsFnv|bySeriesConsistent)")
+	numPartitions   = flag.Int("num-partitions", 1, "number of partitions after resharding")
+)
+
+// move is a series that changes partition
+type move struct {
+	def  schema.MetricDefinition
+	from int32
+}
+
+// plan tracks, for each new partition, how many series it holds and the old partitions they come from
+type plan struct {
+	series  map[int32]int
+	sources map[int32]map[int32]int
+	moved   int
+}
+
+func newPlan() *plan {
+	return &plan{
+		series:  make(map[int32]int),
+		sources: make(map[int32]map[int32]int),
+	}
+}
+
+func (p *plan) add(from, to int32) {
+	p.series[to]++
+	if from == to {
+		return
+	}
+	p.moved++
+	if _, ok := p.sources[to]; !ok {
+		p.sources[to] = make(map[int32]int)
+	}
+	p.sources[to][from]++
+}
+
+func (p *plan) print() {
+	total := 0
+	var parts []int
+	for part, n := range p.series {
+		total += n
+		parts = append(parts, int(part))
+	}
+	sort.Ints(parts)
+	fmt.Printf("%d series, of which %d move to another partition\n\n", total, p.moved)
+	fmt.Println("partition  series  moved  from old partitions (reshard-from-partitions)")
+	for _, part := range parts {
+		var from []int
+		moved := 0
+		for old, n := range p.sources[int32(part)] {
+			from = append(from, int(old))
+			moved += n
+		}
+		sort.Ints(from)
+		fmt.Printf("%9d  %6d  %5d  %v\n", part, p.series[int32(part)], moved, from)
+	}
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "mt-index-reshard")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Reassign the series in the cassandra metric index to their partition in a new number of partitions.")
+		fmt.Fprintln(os.Stderr, "In dry-run mode, it reports for every new partition which old partitions its series come from,")
+		fmt.Fprintln(os.Stderr, "which is what the nodes consuming it need as kafka-mdm-in.reshard-from-partitions during the resharding transition.")
+		fmt.Fprintln(os.Stderr, "Otherwise, it moves the index entries of the series whose partition changes.")
+		fmt.Fprintf(os.Stderr, "\nFlags:\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	formatter := &logger.TextFormatter{}
+	formatter.TimestampFormat = "2006-01-02 15:04:05.000"
+	log.SetFormatter(formatter)
+	lvl, err := log.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("failed to parse log-level, %s", err.Error())
+	}
+	log.SetLevel(lvl)
+	log.Infof("logging level set to '%s'", *logLevel)
+
+	if *numPartitions < 1 {
+		log.Fatalf("number of partitions must be set to at least 1")
+	}
+	partitioner, err := partitioner.NewKafka(*partitionScheme)
+	if err != nil {
+		log.Fatalf("failed to initialize partitioner. %s", err.Error())
+	}
+
+	cluster := gocql.NewCluster(*cassAddr)
+	cluster.Consistency = gocql.ParseConsistency("one")
+	cluster.Timeout = time.Second
+	cluster.NumConns = 2
+	cluster.ProtoVersion = 4
+	cluster.Keyspace = *keyspace
+	session, err := cluster.CreateSession()
+	if err != nil {
+		log.Fatalf("failed to create cql session for cassandra. %s", err.Error())
+	}
+
+	moves := make(chan move, 100)
+	done := make(chan struct{})
+	go func() {
+		moveDefs(session, moves)
+		close(done)
+	}()
+
+	p := newPlan()
+	iter := session.Query(fmt.Sprintf("SELECT id, orgid, partition, name, interval, unit, mtype, tags, lastupdate from %s", *table)).Iter()
+	var id, name, unit, mtype string
+	var orgId, interval int
+	var partition int32
+	var lastupdate int64
+	var tags []string
+	for iter.Scan(&id, &orgId, &partition, &name, &interval, &unit, &mtype, &tags, &lastupdate) {
+		mkey, err := schema.MKeyFromString(id)
+		if err != nil {
+			log.Errorf("could not parse ID %q: %s -> skipping", id, err.Error())
+			continue
+		}
+		def := schema.MetricDefinition{
+			Id:         mkey,
+			OrgId:      uint32(orgId),
+			Partition:  partition,
+			Name:       name,
+			Interval:   interval,
+			Unit:       unit,
+			Mtype:      mtype,
+			Tags:       tags,
+			LastUpdate: lastupdate,
+		}
+		newPartition, err := partitioner.Partition(&def, int32(*numPartitions))
+		if err != nil {
+			log.Fatalf("failed to get partition id of metric. %s", err.Error())
+		}
+		p.add(partition, newPartition)
+		if newPartition != partition {
+			def.Partition = newPartition
+			moves <- move{def: def, from: partition}
+		}
+	}
+	if err := iter.Close(); err != nil {
+		log.Fatalf("failed to read the index. %s", err.Error())
+	}
+	close(moves)
+	<-done
+
+	p.print()
+}
+
+// moveDefs saves the definitions under their new partition, and then deletes them from their old one.
+// the definitions are never missing from the index, so the tool can be re-run after a failure.
+func moveDefs(session *gocql.Session, moves chan move) {
+	insertQry := fmt.Sprintf("INSERT INTO %s (id, orgid, partition, name, interval, unit, mtype, tags, lastupdate) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", *table)
+	deleteQry := fmt.Sprintf("DELETE FROM %s where partition=? AND id=?", *table)
+	counter := 0
+	pre := time.Now()
+	for m := range moves {
+		def := m.def
+		if *dryRun {
+			log.Debugf("would move %s from partition %d to %d", def.Id, m.from, def.Partition)
+			continue
+		}
+		exec(session.Query(insertQry, def.Id.String(), def.OrgId, def.Partition, def.Name, def.Interval, def.Unit, def.Mtype, def.Tags, def.LastUpdate), "save", def.Id)
+		exec(session.Query(deleteQry, m.from, def.Id.String()), "delete", def.Id)
+		counter++
+	}
+	if !*dryRun {
+		log.Infof("Moved %d metricDefs in %s", counter, time.Since(pre).String())
+	}
+}
+
+// exec executes the query until it succeeds
+func exec(qry *gocql.Query, action string, id schema.MKey) {
+	for attempts := 0; ; attempts++ {
+		err := qry.Exec()
+		if err == nil {
+			log.Debugf("cassandra-idx metricDef %s: %s done", id, action)
+			return
+		}
+		if (attempts % 20) == 0 {
+			log.Warnf("cassandra-idx Failed to %s def %s. it will be retried. %s", action, id, err)
+		}
+		sleepTime := 100 * attempts
+		if sleepTime > 2000 {
+			sleepTime = 2000
+		}
+		time.Sleep(time.Duration(sleepTime) * time.Millisecond)
+	}
+}
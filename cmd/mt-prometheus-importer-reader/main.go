@@ -0,0 +1,488 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/logger"
+	"github.com/grafana/metrictank/mdata/importer"
+	"github.com/grafana/metrictank/schema"
+	"github.com/kisielk/whisper-go/whisper"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	httpEndpoint = flag.String(
+		"http-endpoint",
+		"http://127.0.0.1:8080/metrics/import",
+		"The http endpoint to send the data to",
+	)
+	tsdbDir = flag.String(
+		"tsdb-dir",
+		"",
+		"A prometheus TSDB block directory, or a prometheus data directory of which all blocks will be imported",
+	)
+	openMetricsFile = flag.String(
+		"openmetrics-file",
+		"",
+		"A file in the OpenMetrics text format, with timestamps for all samples. use - for stdin",
+	)
+	namePrefix = flag.String(
+		"name-prefix",
+		"",
+		"Prefix to prepend before every metric name, should include the '.' if necessary",
+	)
+	threads = flag.Int(
+		"threads",
+		10,
+		"Number of workers threads to process and convert series",
+	)
+	interval = flag.Int(
+		"interval",
+		0,
+		"The interval of the imported series in seconds. 0 to derive it from the most common interval between the samples of each series",
+	)
+	writeUnfinishedChunks = flag.Bool(
+		"write-unfinished-chunks",
+		false,
+		"Defines if chunks that have not completed their chunk span should be written",
+	)
+	insecureSSL = flag.Bool(
+		"insecure-ssl",
+		false,
+		"Disables ssl certificate verification",
+	)
+	httpAuth = flag.String(
+		"http-auth",
+		"",
+		"The credentials used to authenticate in the format \"user:password\"",
+	)
+	dstSchemas = flag.String(
+		"dst-schemas",
+		"",
+		"The filename of the output schemas definition file",
+	)
+	dstAggregations = flag.String(
+		"dst-aggregations",
+		"",
+		"The filename of the output aggregations definition file, which defines the rollups to generate. if not set, only averages are generated",
+	)
+	nameFilterPattern = flag.String(
+		"name-filter",
+		"",
+		"A regex pattern to be applied to all metric names including their tags (name;tag=value;...), only matching ones will be imported",
+	)
+	importUntil = flag.Uint(
+		"import-until",
+		math.MaxUint32,
+		"Only import up to, but not including, the specified timestamp",
+	)
+	importFrom = flag.Uint(
+		"import-from",
+		0,
+		"Only import starting from the specified timestamp",
+	)
+	verbose = flag.Bool(
+		"verbose",
+		false,
+		"More detailed logging",
+	)
+	customHeadersString = flag.String(
+		"custom-headers",
+		"",
+		"headers to add to every request, in the format \"<name>:<value>;<name>:<value>\"",
+	)
+	schemas        conf.Schemas
+	aggregations   conf.Aggregations
+	nameFilter     *regexp.Regexp
+	processedCount uint32
+	skippedCount   uint32
+	customHeaders  map[string]string
+)
+
+// series is a series to import. loading its points is deferred to the workers
+type series struct {
+	md   schema.MetricData
+	load func() ([]whisper.Point, error)
+}
+
+func init() {
+	formatter := &logger.TextFormatter{}
+	formatter.TimestampFormat = "2006-01-02 15:04:05.000"
+	log.SetFormatter(formatter)
+	log.SetLevel(log.InfoLevel)
+}
+
+func main() {
+	var err error
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "mt-prometheus-importer-reader")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Reads series from prometheus TSDB blocks or an OpenMetrics dump and sends them to mt-whisper-importer-writer,")
+		fmt.Fprintln(os.Stderr, "generating the rollups according to the destination schemas and aggregations.")
+		fmt.Fprintln(os.Stderr, "Tombstones of TSDB blocks are not applied.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *verbose {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+	}
+
+	if (*tsdbDir == "") == (*openMetricsFile == "") {
+		log.Fatalf("Exactly one of -tsdb-dir and -openmetrics-file must be specified")
+	}
+	if *interval < 0 {
+		log.Fatalf("Invalid interval %d", *interval)
+	}
+
+	if len(*customHeadersString) > 0 {
+		customHeaders = make(map[string]string)
+		for _, header := range strings.Split(*customHeadersString, ";") {
+			splits := strings.SplitN(header, ":", 2)
+			if len(splits) < 2 {
+				log.Fatalf("Invalid custom headers specified: %q", *customHeadersString)
+			}
+			customHeaders[splits[0]] = splits[1]
+		}
+	}
+
+	nameFilter = regexp.MustCompile(*nameFilterPattern)
+	schemas, err = conf.ReadSchemas(*dstSchemas)
+	if err != nil {
+		log.Fatalf("Error when parsing schemas file: %q", err)
+	}
+	aggregations = conf.NewAggregations()
+	if *dstAggregations != "" {
+		aggregations, err = conf.ReadAggregations(*dstAggregations)
+		if err != nil {
+			log.Fatalf("Error when parsing aggregations file: %q", err)
+		}
+	}
+
+	seriesChan := make(chan series)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(*threads)
+	for i := 0; i < *threads; i++ {
+		go processFromChan(seriesChan, wg)
+	}
+
+	if *tsdbDir != "" {
+		var blocks []*tsdbBlock
+		blocks, err = openBlocks(*tsdbDir)
+		if err != nil {
+			log.Fatalf("Failed to open blocks: %s", err)
+		}
+		if len(blocks) == 0 {
+			log.Fatalf("No blocks found in %s", *tsdbDir)
+		}
+		// the workers read from the blocks until they are done
+		defer func() {
+			for _, b := range blocks {
+				b.Close()
+			}
+		}()
+		err = getTSDBSeriesIntoChan(blocks, seriesChan)
+	} else {
+		err = getOpenMetricsSeriesIntoChan(*openMetricsFile, seriesChan)
+	}
+	close(seriesChan)
+	wg.Wait()
+	if err != nil {
+		log.Fatalf("Failed to read series: %s", err)
+	}
+
+	processed := atomic.LoadUint32(&processedCount)
+	skipped := atomic.LoadUint32(&skippedCount)
+	log.Infof("All done. Processed %d series, %d skipped", processed, skipped)
+}
+
+// newMetricData creates the MetricData for the prometheus series with the given name and labels,
+// and returns whether it should be imported
+func newMetricData(name string, labels []label, mtype string) (schema.MetricData, bool) {
+	md := schema.MetricData{
+		Name:  *namePrefix + name,
+		Mtype: mtype,
+		Tags:  []string{},
+	}
+	for _, l := range labels {
+		if l.Name == "__name__" || l.Value == "" {
+			continue
+		}
+		md.Tags = append(md.Tags, l.Name+"="+l.Value)
+	}
+	sort.Strings(md.Tags)
+
+	nameWithTags := schema.MetricDefinitionFromMetricData(&md).NameWithTags()
+	if !nameFilter.MatchString(nameWithTags) {
+		log.Debugf("Skipping series %s", nameWithTags)
+		atomic.AddUint32(&skippedCount, 1)
+		return md, false
+	}
+	if err := schema.ValidateTags(md.Tags); err != nil {
+		log.Warnf("Skipping series %s because it has invalid tags", nameWithTags)
+		atomic.AddUint32(&skippedCount, 1)
+		return md, false
+	}
+	return md, true
+}
+
+// getTSDBSeriesIntoChan feeds the series of all given blocks into the given channel.
+// series that are in multiple blocks are merged, so that each series is imported only once,
+// because importing it per block would overwrite the chunks that span the block boundaries.
+func getTSDBSeriesIntoChan(blocks []*tsdbBlock, seriesChan chan series) error {
+	type source struct {
+		block  *tsdbBlock
+		chunks []chunkMeta
+	}
+	type merged struct {
+		name    string
+		labels  []label
+		sources []source
+	}
+	index := make(map[string]*merged)
+	var all []*merged
+	for _, b := range blocks {
+		log.Infof("Reading index of block %s (%s)", b.dir, b.meta.ULID)
+		blockSeries, err := b.series()
+		if err != nil {
+			return fmt.Errorf("block %s: %s", b.dir, err)
+		}
+		for _, s := range blockSeries {
+			var name string
+			for _, l := range s.labels {
+				if l.Name == "__name__" {
+					name = l.Value
+				}
+			}
+			key := seriesKey(name, s.labels)
+			m, ok := index[key]
+			if !ok {
+				m = &merged{name: name, labels: s.labels}
+				index[key] = m
+				all = append(all, m)
+			}
+			m.sources = append(m.sources, source{block: b, chunks: s.chunks})
+		}
+	}
+	log.Infof("Found %d series in %d blocks", len(all), len(blocks))
+
+	from, until := int64(*importFrom)*1000, int64(*importUntil)*1000
+	for _, m := range all {
+		md, ok := newMetricData(m.name, m.labels, tsdbMtype(m.name))
+		if !ok {
+			continue
+		}
+		sources := m.sources
+		seriesChan <- series{
+			md: md,
+			load: func() ([]whisper.Point, error) {
+				var points []whisper.Point
+				for _, src := range sources {
+					for _, c := range src.chunks {
+						if c.maxT < from || c.minT >= until {
+							continue
+						}
+						samples, err := src.block.samples(c)
+						if err != nil {
+							return nil, err
+						}
+						for _, s := range samples {
+							// chunks can straddle the boundaries of the range
+							if s.t <= 0 || s.t < from || s.t >= until || math.Float64bits(s.v) == staleNaN {
+								continue
+							}
+							points = append(points, whisper.Point{Timestamp: uint32(s.t / 1000), Value: s.v})
+						}
+					}
+				}
+				return points, nil
+			},
+		}
+	}
+	return nil
+}
+
+// tsdbMtype guesses the mtype of a series based on the prometheus naming conventions,
+// because TSDB blocks don't store the metric types
+func tsdbMtype(name string) string {
+	for _, suffix := range []string{"_total", "_count", "_sum", "_bucket"} {
+		if strings.HasSuffix(name, suffix) {
+			return "counter"
+		}
+	}
+	return "gauge"
+}
+
+func getOpenMetricsSeriesIntoChan(file string, seriesChan chan series) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	all, skipped, err := parseOpenMetrics(r)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		log.Warnf("Skipped %d samples without timestamp or of _created series", skipped)
+	}
+	log.Infof("Found %d series", len(all))
+
+	for _, s := range all {
+		md, ok := newMetricData(s.name, s.labels, s.mtype)
+		if !ok {
+			continue
+		}
+		points := s.points
+		seriesChan <- series{
+			md: md,
+			load: func() ([]whisper.Point, error) {
+				return points, nil
+			},
+		}
+	}
+	return nil
+}
+
+// guessInterval returns the most common interval between the given points,
+// preferring the smallest one in case of a tie.
+func guessInterval(points []whisper.Point) int {
+	timestamps := make([]uint32, 0, len(points))
+	for _, p := range points {
+		timestamps = append(timestamps, p.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	counts := make(map[uint32]int)
+	for i := 1; i < len(timestamps); i++ {
+		if delta := timestamps[i] - timestamps[i-1]; delta > 0 {
+			counts[delta]++
+		}
+	}
+	best, bestCount := uint32(1), 0
+	for delta, count := range counts {
+		if count > bestCount || (count == bestCount && delta < best) {
+			best, bestCount = delta, count
+		}
+	}
+	return int(best)
+}
+
+func processFromChan(seriesChan chan series, wg *sync.WaitGroup) {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecureSSL},
+	}
+	client := &http.Client{Transport: tr}
+
+	for s := range seriesChan {
+		name := schema.MetricDefinitionFromMetricData(&s.md).NameWithTags()
+		points, err := s.load()
+		if err != nil {
+			log.Errorf("Failed to load samples of %s: %s", name, err.Error())
+			atomic.AddUint32(&skippedCount, 1)
+			continue
+		}
+		if len(points) == 0 {
+			log.Debugf("Skipping series %s without samples", name)
+			atomic.AddUint32(&skippedCount, 1)
+			continue
+		}
+
+		md := s.md
+		md.Interval = *interval
+		if md.Interval == 0 {
+			md.Interval = guessInterval(points)
+		}
+
+		log.Debugf("Processing series %s with %d samples and interval %d", name, len(points), md.Interval)
+		data, err := importer.NewArchiveRequestFromPoints(md, points, schemas, aggregations, uint32(*importFrom), uint32(*importUntil)-1, *writeUnfinishedChunks)
+		if err != nil {
+			log.Errorf("Failed to get metric: %q", err.Error())
+			atomic.AddUint32(&skippedCount, 1)
+			continue
+		}
+
+		if log.GetLevel() >= log.DebugLevel {
+			details := fmt.Sprintf("Name: %s\nId: %s\nLastUpdate: %d\n", name, data.MetricData.Id, data.MetricData.Time)
+			for _, cwr := range data.ChunkWriteRequests {
+				details += fmt.Sprintf("Chunk write request Archive: %s T0: %d TTL: %d Size: %d\n", cwr.Archive, cwr.T0, cwr.TTL, len(cwr.Data))
+			}
+			log.Debugf("Sending archive request:\n%s", details)
+		}
+
+		success := false
+		attempts := 0
+		for !success {
+			b, err := data.MarshalCompressed()
+			if err != nil {
+				log.Errorf("Failed to encode metric: %q", err.Error())
+				continue
+			}
+			size := b.Len()
+
+			req, err := http.NewRequest("POST", *httpEndpoint, io.Reader(b))
+			if err != nil {
+				log.Fatalf("Cannot construct request to http endpoint %q: %q", *httpEndpoint, err.Error())
+			}
+
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", "gzip")
+			for name, value := range customHeaders {
+				req.Header.Set(name, value)
+			}
+
+			if len(*httpAuth) > 0 {
+				req.Header.Add("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(*httpAuth)))
+			}
+
+			pre := time.Now()
+			resp, err := client.Do(req)
+			passed := time.Now().Sub(pre).Seconds()
+			if err != nil {
+				log.Warningf("Error posting %s (%d bytes), to endpoint %q (attempt %d/%fs, retrying): %s", name, size, *httpEndpoint, attempts, passed, err.Error())
+				attempts++
+				continue
+			}
+			if resp.StatusCode >= 300 {
+				log.Warningf("Error posting %s (%d bytes) to endpoint %q status %d (attempt %d/%fs, retrying)", name, size, *httpEndpoint, resp.StatusCode, attempts, passed)
+				attempts++
+			} else {
+				log.Debugf("Posted %s (%d bytes) to endpoint %q in %f seconds", name, size, *httpEndpoint, passed)
+				success = true
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		processed := atomic.AddUint32(&processedCount, 1)
+		if processed%100 == 0 {
+			skipped := atomic.LoadUint32(&skippedCount)
+			log.Infof("Processed %d series, %d skipped", processed, skipped)
+		}
+	}
+	wg.Done()
+}
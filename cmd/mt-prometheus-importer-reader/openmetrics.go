@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kisielk/whisper-go/whisper"
+)
+
+// omSeries is a series read from an OpenMetrics dump, with all its points
+type omSeries struct {
+	name   string
+	labels []label
+	mtype  string
+	points []whisper.Point
+}
+
+// parseOpenMetrics reads an OpenMetrics text exposition with timestamps, as used for backfilling
+// https://github.com/OpenObservability/OpenMetrics/blob/master/specification/OpenMetrics.md
+// it returns the series in the order they were first seen, and the number of samples that were
+// skipped because they have no timestamp or are _created samples.
+func parseOpenMetrics(r io.Reader) ([]*omSeries, int, error) {
+	types := make(map[string]string)
+	index := make(map[string]*omSeries)
+	var res []*omSeries
+	var skipped int
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[1] == "EOF" {
+				break
+			}
+			if len(fields) == 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		name, labels, ts, val, hasTs, err := parseOpenMetricsSample(line)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		mtype, ok := sampleMtype(name, types)
+		if !ok || !hasTs {
+			skipped++
+			continue
+		}
+
+		key := seriesKey(name, labels)
+		s, ok := index[key]
+		if !ok {
+			s = &omSeries{name: name, labels: labels, mtype: mtype}
+			index[key] = s
+			res = append(res, s)
+		}
+		s.points = append(s.points, whisper.Point{Timestamp: ts, Value: val})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return res, skipped, nil
+}
+
+// parseOpenMetricsSample parses a line like `name{label="value",...} value timestamp # exemplar`
+func parseOpenMetricsSample(line string) (string, []label, uint32, float64, bool, error) {
+	var labels []label
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return "", nil, 0, 0, false, fmt.Errorf("invalid sample %q", line)
+	}
+	name := line[:end]
+	rest := line[end:]
+
+	if rest[0] == '{' {
+		var err error
+		labels, rest, err = parseOpenMetricsLabels(rest[1:])
+		if err != nil {
+			return "", nil, 0, 0, false, err
+		}
+	}
+
+	// strip the exemplar, if any
+	if pos := strings.Index(rest, " # "); pos >= 0 {
+		rest = rest[:pos]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", nil, 0, 0, false, fmt.Errorf("invalid sample %q", line)
+	}
+	val, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, 0, false, fmt.Errorf("invalid value %q", fields[0])
+	}
+	if len(fields) == 1 {
+		return name, labels, 0, val, false, nil
+	}
+
+	// OpenMetrics timestamps are in seconds, possibly with a fraction
+	ts, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || ts < 1 || ts > math.MaxUint32 {
+		return "", nil, 0, 0, false, fmt.Errorf("invalid timestamp %q", fields[1])
+	}
+	return name, labels, uint32(ts), val, true, nil
+}
+
+// parseOpenMetricsLabels parses the labels after the opening brace,
+// returning the labels sorted by name and the remainder after the closing brace
+func parseOpenMetricsLabels(s string) ([]label, string, error) {
+	var labels []label
+	for {
+		if strings.HasPrefix(s, "}") {
+			sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+			return labels, s[1:], nil
+		}
+		eq := strings.Index(s, "=\"")
+		if eq <= 0 {
+			return nil, "", fmt.Errorf("invalid labels %q", s)
+		}
+		name := s[:eq]
+		s = s[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if c == '"' {
+				s = s[i+1:]
+				closed = true
+				break
+			}
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated label value for label %q", name)
+		}
+		labels = append(labels, label{Name: name, Value: value.String()})
+		s = strings.TrimPrefix(s, ",")
+	}
+}
+
+// sampleMtype returns the metrictank mtype of the sample with the given name, based on the type of its
+// metric family. _created samples hold the creation time of counters, summaries and histograms.
+// they don't have any use in metrictank, so they are reported as not ok.
+func sampleMtype(name string, types map[string]string) (string, bool) {
+	if typ, ok := types[name]; ok {
+		if typ == "counter" {
+			return "counter", true
+		}
+		return "gauge", true
+	}
+	for _, suffix := range []string{"_total", "_created", "_count", "_sum", "_bucket", "_gcount", "_gsum", "_info"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		typ := types[strings.TrimSuffix(name, suffix)]
+		if suffix == "_created" && (typ == "counter" || typ == "summary" || typ == "histogram") {
+			return "", false
+		}
+		switch typ {
+		case "counter", "summary", "histogram":
+			return "counter", true
+		}
+	}
+	return "gauge", true
+}
+
+// seriesKey returns a unique key for the series with the given name and sorted labels
+func seriesKey(name string, labels []label) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, l := range labels {
+		b.WriteByte(0)
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kisielk/whisper-go/whisper"
+)
+
+func TestParseOpenMetrics(t *testing.T) {
+	in := `# HELP http_requests Total requests.
+# TYPE http_requests counter
+http_requests_total{path="/api",code="200"} 10 1600000000
+http_requests_created{path="/api",code="200"} 1590000000 1600000000
+http_requests_total{code="200",path="/api"} 12 1600000015.5 # {trace_id="abc"} 1 1600000015
+http_requests_total{path="/a\"b\\c",code="500"} 1 1600000000
+# TYPE temperature gauge
+temperature 21.5 1600000000
+temperature +Inf 1600000015
+temperature 22
+# TYPE rpc_duration summary
+rpc_duration{quantile="0.99"} 0.3 1600000000
+rpc_duration_count 7 1600000000
+# EOF
+ignored 1 1600000000
+`
+	series, skipped, err := parseOpenMetrics(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if skipped != 2 {
+		t.Fatalf("Expected 2 skipped samples, got %d", skipped)
+	}
+
+	inf := whisper.Point{Timestamp: 1600000015}
+	inf.Value = math.Inf(1)
+	exp := []omSeries{
+		{
+			name:   "http_requests_total",
+			labels: []label{{"code", "200"}, {"path", "/api"}},
+			mtype:  "counter",
+			points: []whisper.Point{{1600000000, 10}, {1600000015, 12}},
+		},
+		{
+			name:   "http_requests_total",
+			labels: []label{{"code", "500"}, {"path", `/a"b\c`}},
+			mtype:  "counter",
+			points: []whisper.Point{{1600000000, 1}},
+		},
+		{
+			name:   "temperature",
+			mtype:  "gauge",
+			points: []whisper.Point{{1600000000, 21.5}, inf},
+		},
+		{
+			name:   "rpc_duration",
+			labels: []label{{"quantile", "0.99"}},
+			mtype:  "gauge",
+			points: []whisper.Point{{1600000000, 0.3}},
+		},
+		{
+			name:   "rpc_duration_count",
+			mtype:  "counter",
+			points: []whisper.Point{{1600000000, 7}},
+		},
+	}
+	if len(series) != len(exp) {
+		t.Fatalf("Expected %d series, got %d: %+v", len(exp), len(series), series)
+	}
+	for i := range exp {
+		if !reflect.DeepEqual(*series[i], exp[i]) {
+			t.Fatalf("Series %d: expected %+v, got %+v", i, exp[i], *series[i])
+		}
+	}
+}
+
+func TestParseOpenMetricsInvalid(t *testing.T) {
+	for _, in := range []string{
+		`foo{bar="baz} 1 1600000000`,
+		`foo{bar} 1 1600000000`,
+		`foo notanumber 1600000000`,
+		`foo 1 1600000000 extra`,
+		`foo 1 -5`,
+	} {
+		if _, _, err := parseOpenMetrics(strings.NewReader(in)); err == nil {
+			t.Fatalf("Expected error for %q", in)
+		}
+	}
+}
+
+func TestGuessInterval(t *testing.T) {
+	points := []whisper.Point{{100, 0}, {115, 0}, {130, 0}, {131, 0}, {160, 0}, {145, 0}}
+	if got := guessInterval(points); got != 15 {
+		t.Fatalf("Expected interval 15, got %d", got)
+	}
+	if got := guessInterval(points[:1]); got != 1 {
+		t.Fatalf("Expected interval 1 for a single point, got %d", got)
+	}
+}
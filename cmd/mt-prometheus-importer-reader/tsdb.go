@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// this implements just enough of the prometheus tsdb block format to read all series and their samples.
+// https://github.com/prometheus/prometheus/tree/master/tsdb/docs/format
+// tombstones are not applied, so deleted data that was not compacted away yet gets imported.
+
+const (
+	indexMagic       = 0xBAAAD700
+	indexVersion2    = 2
+	indexTOCLen      = 6*8 + 4
+	chunksMagic      = 0x85BD40DD
+	chunksHeaderSize = 8
+	encXOR           = 1
+)
+
+var (
+	castagnoli    = crc32.MakeTable(crc32.Castagnoli)
+	errInvalidIdx = errors.New("invalid index")
+)
+
+type blockMeta struct {
+	ULID    string `json:"ulid"`
+	MinTime int64  `json:"minTime"`
+	MaxTime int64  `json:"maxTime"`
+	Version int    `json:"version"`
+}
+
+type label struct {
+	Name  string
+	Value string
+}
+
+// chunkMeta references a chunk in the chunks files of a block, and the time range it covers (in ms)
+type chunkMeta struct {
+	ref        uint64
+	minT, maxT int64
+}
+
+type blockSeries struct {
+	labels []label
+	chunks []chunkMeta
+}
+
+type tsdbBlock struct {
+	dir        string
+	meta       blockMeta
+	index      []byte
+	symbols    []string
+	chunkFiles []*os.File
+}
+
+// openBlocks opens the block in dir, or if dir is a prometheus data directory, all the blocks in it
+func openBlocks(dir string) ([]*tsdbBlock, error) {
+	if _, err := os.Stat(filepath.Join(dir, "meta.json")); err == nil {
+		b, err := openBlock(dir)
+		if err != nil {
+			return nil, err
+		}
+		return []*tsdbBlock{b}, nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []*tsdbBlock
+	for _, e := range entries {
+		blockDir := filepath.Join(dir, e.Name())
+		if !e.IsDir() || filepath.Ext(e.Name()) == ".tmp" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(blockDir, "meta.json")); err != nil {
+			continue
+		}
+		b, err := openBlock(blockDir)
+		if err != nil {
+			for _, b := range blocks {
+				b.Close()
+			}
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].meta.MinTime < blocks[j].meta.MinTime })
+	return blocks, nil
+}
+
+func openBlock(dir string) (*tsdbBlock, error) {
+	b := &tsdbBlock{dir: dir}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &b.meta); err != nil {
+		return nil, fmt.Errorf("block %s: failed to parse meta.json: %s", dir, err)
+	}
+	if b.meta.Version != 1 {
+		return nil, fmt.Errorf("block %s: unsupported meta.json version %d", dir, b.meta.Version)
+	}
+
+	b.index, err = ioutil.ReadFile(filepath.Join(dir, "index"))
+	if err != nil {
+		return nil, err
+	}
+	if err := b.readSymbols(); err != nil {
+		return nil, fmt.Errorf("block %s: %s", dir, err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "chunks", "[0-9][0-9][0-9][0-9][0-9][0-9]"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+		b.chunkFiles = append(b.chunkFiles, f)
+		header := make([]byte, chunksHeaderSize)
+		if _, err := f.ReadAt(header, 0); err != nil || binary.BigEndian.Uint32(header) != chunksMagic {
+			b.Close()
+			return nil, fmt.Errorf("block %s: invalid chunks file %s", dir, path)
+		}
+	}
+	return b, nil
+}
+
+func (b *tsdbBlock) Close() {
+	for _, f := range b.chunkFiles {
+		f.Close()
+	}
+}
+
+// toc returns the offsets of the symbols, series, label indices, label offset table,
+// postings and postings offset table sections.
+func (b *tsdbBlock) toc() ([6]uint64, error) {
+	var toc [6]uint64
+	if len(b.index) < 5+indexTOCLen || binary.BigEndian.Uint32(b.index) != indexMagic {
+		return toc, errInvalidIdx
+	}
+	if b.index[4] != indexVersion2 {
+		return toc, fmt.Errorf("unsupported index version %d", b.index[4])
+	}
+	buf := b.index[len(b.index)-indexTOCLen:]
+	if crc32.Checksum(buf[:indexTOCLen-4], castagnoli) != binary.BigEndian.Uint32(buf[indexTOCLen-4:]) {
+		return toc, fmt.Errorf("index TOC checksum mismatch")
+	}
+	for i := range toc {
+		toc[i] = binary.BigEndian.Uint64(buf[i*8:])
+		if toc[i] >= uint64(len(b.index)) {
+			return toc, errInvalidIdx
+		}
+	}
+	return toc, nil
+}
+
+// section returns the content of the section at the given offset which is prefixed
+// by a 4 byte length, excluding the length and the trailing checksum.
+func (b *tsdbBlock) section(off uint64) (decbuf, error) {
+	if off+4 > uint64(len(b.index)) {
+		return decbuf{}, errInvalidIdx
+	}
+	l := uint64(binary.BigEndian.Uint32(b.index[off:]))
+	if off+4+l+4 > uint64(len(b.index)) {
+		return decbuf{}, errInvalidIdx
+	}
+	return decbuf{b: b.index[off+4 : off+4+l]}, nil
+}
+
+func (b *tsdbBlock) readSymbols() error {
+	toc, err := b.toc()
+	if err != nil {
+		return err
+	}
+	d, err := b.section(toc[0])
+	if err != nil {
+		return err
+	}
+	num := int(d.be32())
+	b.symbols = make([]string, 0, num)
+	for i := 0; i < num && d.err == nil; i++ {
+		b.symbols = append(b.symbols, d.uvarintStr())
+	}
+	return d.err
+}
+
+func (b *tsdbBlock) symbol(ref uint64) (string, error) {
+	if ref >= uint64(len(b.symbols)) {
+		return "", fmt.Errorf("invalid symbol reference %d", ref)
+	}
+	return b.symbols[ref], nil
+}
+
+// series returns all series of the block, in the order of their label sets
+func (b *tsdbBlock) series() ([]blockSeries, error) {
+	toc, err := b.toc()
+	if err != nil {
+		return nil, err
+	}
+
+	// the postings of the empty label pair list all series
+	d, err := b.section(toc[5])
+	if err != nil {
+		return nil, err
+	}
+	allPostings := uint64(0)
+	num := int(d.be32())
+	for i := 0; i < num && d.err == nil; i++ {
+		d.uvarint() // number of label parts, always 2
+		name := d.uvarintStr()
+		value := d.uvarintStr()
+		off := d.uvarint()
+		if name == "" && value == "" {
+			allPostings = off
+			break
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if allPostings == 0 {
+		return nil, nil
+	}
+
+	d, err = b.section(allPostings)
+	if err != nil {
+		return nil, err
+	}
+	num = int(d.be32())
+	res := make([]blockSeries, 0, num)
+	for i := 0; i < num && d.err == nil; i++ {
+		// in index version 2, series references are their offset divided by 16
+		s, err := b.readSeries(uint64(d.be32()) * 16)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, d.err
+}
+
+func (b *tsdbBlock) readSeries(off uint64) (blockSeries, error) {
+	var s blockSeries
+	if off >= uint64(len(b.index)) {
+		return s, errInvalidIdx
+	}
+	l, n := binary.Uvarint(b.index[off:])
+	if n <= 0 || off+uint64(n)+l > uint64(len(b.index)) {
+		return s, errInvalidIdx
+	}
+	d := decbuf{b: b.index[off+uint64(n) : off+uint64(n)+l]}
+
+	numLabels := int(d.uvarint())
+	for i := 0; i < numLabels && d.err == nil; i++ {
+		name, err := b.symbol(d.uvarint())
+		if err != nil {
+			return s, err
+		}
+		value, err := b.symbol(d.uvarint())
+		if err != nil {
+			return s, err
+		}
+		s.labels = append(s.labels, label{Name: name, Value: value})
+	}
+
+	numChunks := int(d.uvarint())
+	var prev chunkMeta
+	for i := 0; i < numChunks && d.err == nil; i++ {
+		var c chunkMeta
+		if i == 0 {
+			c.minT = d.varint()
+			c.maxT = c.minT + int64(d.uvarint())
+			c.ref = d.uvarint()
+		} else {
+			c.minT = prev.maxT + int64(d.uvarint())
+			c.maxT = c.minT + int64(d.uvarint())
+			c.ref = uint64(int64(prev.ref) + d.varint())
+		}
+		s.chunks = append(s.chunks, c)
+		prev = c
+	}
+	return s, d.err
+}
+
+// samples returns the samples of the given chunk
+func (b *tsdbBlock) samples(c chunkMeta) ([]xorSample, error) {
+	seq := int(c.ref >> 32)
+	off := int64(uint32(c.ref))
+	if seq >= len(b.chunkFiles) {
+		return nil, fmt.Errorf("block %s: chunk reference %d points to missing chunks file", b.dir, c.ref)
+	}
+	f := b.chunkFiles[seq]
+
+	head := make([]byte, binary.MaxVarintLen32+1)
+	n, err := f.ReadAt(head, off)
+	if n == 0 {
+		return nil, fmt.Errorf("block %s: failed to read chunk %d: %s", b.dir, c.ref, err)
+	}
+	l, ln := binary.Uvarint(head[:n])
+	if ln <= 0 || ln >= n {
+		return nil, fmt.Errorf("block %s: failed to read length of chunk %d", b.dir, c.ref)
+	}
+	enc := head[ln]
+	if enc != encXOR {
+		return nil, fmt.Errorf("block %s: chunk %d has unsupported encoding %d", b.dir, c.ref, enc)
+	}
+
+	// read the encoding, data and checksum
+	buf := make([]byte, 1+l+4)
+	if _, err := f.ReadAt(buf, off+int64(ln)); err != nil {
+		return nil, fmt.Errorf("block %s: failed to read chunk %d: %s", b.dir, c.ref, err)
+	}
+	if crc32.Checksum(buf[:1+l], castagnoli) != binary.BigEndian.Uint32(buf[1+l:]) {
+		return nil, fmt.Errorf("block %s: checksum mismatch for chunk %d", b.dir, c.ref)
+	}
+	return decodeXORChunk(buf[1 : 1+l])
+}
+
+// decbuf decodes the values of an index section, remembering the first error
+type decbuf struct {
+	b   []byte
+	err error
+}
+
+func (d *decbuf) be32() uint32 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) < 4 {
+		d.err = errInvalidIdx
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *decbuf) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errInvalidIdx
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decbuf) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errInvalidIdx
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decbuf) uvarintStr() string {
+	l := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.b)) < l {
+		d.err = errInvalidIdx
+		return ""
+	}
+	s := string(d.b[:l])
+	d.b = d.b[l:]
+	return s
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/kisielk/whisper-go/whisper"
+)
+
+// bitWriter and encodeXORChunk mirror the prometheus tsdb xor appender, to generate test data
+type bitWriter struct {
+	stream []byte
+	count  uint8 // number of bits still free in the last byte
+}
+
+func (b *bitWriter) writeBit(bit bool) {
+	if b.count == 0 {
+		b.stream = append(b.stream, 0)
+		b.count = 8
+	}
+	b.count--
+	if bit {
+		b.stream[len(b.stream)-1] |= 1 << b.count
+	}
+}
+
+func (b *bitWriter) writeBits(u uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		b.writeBit(u&(1<<uint(i)) != 0)
+	}
+}
+
+func (b *bitWriter) writeBytes(buf []byte) {
+	for _, byt := range buf {
+		b.writeBits(uint64(byt), 8)
+	}
+}
+
+func encodeXORChunk(samples []xorSample) []byte {
+	b := &bitWriter{}
+	var t int64
+	var tDelta uint64
+	var v float64
+	leading, trailing := uint8(0xff), uint8(0)
+
+	writeValue := func(nv float64) {
+		delta := math.Float64bits(nv) ^ math.Float64bits(v)
+		if delta == 0 {
+			b.writeBit(false)
+			return
+		}
+		b.writeBit(true)
+		l := uint8(bits.LeadingZeros64(delta))
+		tr := uint8(bits.TrailingZeros64(delta))
+		if l >= 32 {
+			l = 31
+		}
+		if leading != 0xff && l >= leading && tr >= trailing {
+			b.writeBit(false)
+			b.writeBits(delta>>trailing, 64-int(leading)-int(trailing))
+			return
+		}
+		leading, trailing = l, tr
+		b.writeBit(true)
+		b.writeBits(uint64(l), 5)
+		sigbits := 64 - l - tr
+		b.writeBits(uint64(sigbits), 6)
+		b.writeBits(delta>>tr, int(sigbits))
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	for i, s := range samples {
+		switch i {
+		case 0:
+			b.writeBytes(buf[:binary.PutVarint(buf, s.t)])
+			b.writeBits(math.Float64bits(s.v), 64)
+		case 1:
+			tDelta = uint64(s.t - t)
+			b.writeBytes(buf[:binary.PutUvarint(buf, tDelta)])
+			writeValue(s.v)
+		default:
+			newDelta := uint64(s.t - t)
+			dod := int64(newDelta - tDelta)
+			bitRange := func(nbits uint) bool { return -((1<<(nbits-1))-1) <= dod && dod <= 1<<(nbits-1) }
+			switch {
+			case dod == 0:
+				b.writeBit(false)
+			case bitRange(14):
+				b.writeBits(0x02, 2)
+				b.writeBits(uint64(dod), 14)
+			case bitRange(17):
+				b.writeBits(0x06, 3)
+				b.writeBits(uint64(dod), 17)
+			case bitRange(20):
+				b.writeBits(0x0e, 4)
+				b.writeBits(uint64(dod), 20)
+			default:
+				b.writeBits(0x0f, 4)
+				b.writeBits(uint64(dod), 64)
+			}
+			tDelta = newDelta
+			writeValue(s.v)
+		}
+		t, v = s.t, s.v
+	}
+	header := make([]byte, 2)
+	binary.BigEndian.PutUint16(header, uint16(len(samples)))
+	return append(header, b.stream...)
+}
+
+type testSeries struct {
+	labels []label // sorted
+	chunks [][]xorSample
+}
+
+func putUvarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+func putVarint(b []byte, v int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutVarint(buf, v)]...)
+}
+
+func putBE32(b []byte, v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, v)
+	return append(b, buf...)
+}
+
+func putCRC(b []byte, start int) []byte {
+	return putBE32(b, crc32.Checksum(b[start:], castagnoli))
+}
+
+// writeTestBlock writes a prometheus tsdb block with the given series, sorted by their labels
+func writeTestBlock(t *testing.T, dir string, minT, maxT int64, series []testSeries) {
+	if err := os.MkdirAll(filepath.Join(dir, "chunks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	meta := fmt.Sprintf(`{"ulid":"%s","minTime":%d,"maxTime":%d,"version":1}`, filepath.Base(dir), minT, maxT)
+	if err := ioutil.WriteFile(filepath.Join(dir, "meta.json"), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// chunks
+	chunks := putBE32(nil, chunksMagic)
+	chunks = append(chunks, 1, 0, 0, 0)
+	refs := make([][]uint64, len(series))
+	for i, s := range series {
+		for _, c := range s.chunks {
+			refs[i] = append(refs[i], uint64(len(chunks)))
+			data := encodeXORChunk(c)
+			chunks = putUvarint(chunks, uint64(len(data)))
+			start := len(chunks)
+			chunks = append(chunks, encXOR)
+			chunks = append(chunks, data...)
+			chunks = putCRC(chunks, start)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "chunks", "000001"), chunks, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// index
+	symbolSet := map[string]struct{}{"": {}}
+	for _, s := range series {
+		for _, l := range s.labels {
+			symbolSet[l.Name] = struct{}{}
+			symbolSet[l.Value] = struct{}{}
+		}
+	}
+	var symbols []string
+	for s := range symbolSet {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	symbolRef := make(map[string]uint64)
+
+	var toc [6]uint64
+	idx := putBE32(nil, indexMagic)
+	idx = append(idx, indexVersion2)
+
+	toc[0] = uint64(len(idx))
+	body := putBE32(nil, uint32(len(symbols)))
+	for i, s := range symbols {
+		symbolRef[s] = uint64(i)
+		body = putUvarint(body, uint64(len(s)))
+		body = append(body, s...)
+	}
+	idx = putBE32(idx, uint32(len(body)))
+	start := len(idx)
+	idx = putCRC(append(idx, body...), start)
+
+	var seriesRefs []uint32
+	for i, s := range series {
+		for len(idx)%16 != 0 {
+			idx = append(idx, 0)
+		}
+		if i == 0 {
+			toc[1] = uint64(len(idx))
+		}
+		seriesRefs = append(seriesRefs, uint32(len(idx)/16))
+		body := putUvarint(nil, uint64(len(s.labels)))
+		for _, l := range s.labels {
+			body = putUvarint(body, symbolRef[l.Name])
+			body = putUvarint(body, symbolRef[l.Value])
+		}
+		body = putUvarint(body, uint64(len(s.chunks)))
+		var prevMaxT int64
+		var prevRef uint64
+		for j, c := range s.chunks {
+			minT, maxT := c[0].t, c[len(c)-1].t
+			if j == 0 {
+				body = putVarint(body, minT)
+				body = putUvarint(body, uint64(maxT-minT))
+				body = putUvarint(body, refs[i][j])
+			} else {
+				body = putUvarint(body, uint64(minT-prevMaxT))
+				body = putUvarint(body, uint64(maxT-minT))
+				body = putVarint(body, int64(refs[i][j]-prevRef))
+			}
+			prevMaxT, prevRef = maxT, refs[i][j]
+		}
+		idx = putUvarint(idx, uint64(len(body)))
+		start := len(idx)
+		idx = putCRC(append(idx, body...), start)
+	}
+
+	// we only write the postings of all series
+	toc[4] = uint64(len(idx))
+	body = putBE32(nil, uint32(len(seriesRefs)))
+	for _, ref := range seriesRefs {
+		body = putBE32(body, ref)
+	}
+	idx = putBE32(idx, uint32(len(body)))
+	start = len(idx)
+	idx = putCRC(append(idx, body...), start)
+
+	toc[5] = uint64(len(idx))
+	body = putBE32(nil, 1)
+	body = putUvarint(body, 2)
+	body = putUvarint(body, 0)
+	body = putUvarint(body, 0)
+	body = putUvarint(body, toc[4])
+	idx = putBE32(idx, uint32(len(body)))
+	start = len(idx)
+	idx = putCRC(append(idx, body...), start)
+
+	start = len(idx)
+	for _, off := range toc {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, off)
+		idx = append(idx, buf...)
+	}
+	idx = putCRC(idx, start)
+	if err := ioutil.WriteFile(filepath.Join(dir, "index"), idx, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeXORChunk(t *testing.T) {
+	samples := []xorSample{
+		{t: 1600000000000, v: 1},
+		{t: 1600000015000, v: 1},
+		{t: 1600000030000, v: 2.5},
+		{t: 1600000045003, v: -7},
+		{t: 1600000060000, v: math.MaxFloat64},
+		{t: 1600000200000, v: 1e-300},
+		{t: 1600010000000, v: 3},
+		{t: 1600010000001, v: 3},
+		{t: 1600010015001, v: math.Float64frombits(staleNaN)},
+	}
+	for i := 1; i <= len(samples); i++ {
+		got, err := decodeXORChunk(encodeXORChunk(samples[:i]))
+		if err != nil {
+			t.Fatalf("Unexpected error decoding %d samples: %s", i, err)
+		}
+		for j := range got {
+			if got[j].t != samples[j].t || math.Float64bits(got[j].v) != math.Float64bits(samples[j].v) {
+				t.Fatalf("Decoding %d samples: expected %+v, got %+v", i, samples[:i], got)
+			}
+		}
+	}
+
+	data := encodeXORChunk(samples)
+	if _, err := decodeXORChunk(data[:len(data)-3]); err != errShortChunk {
+		t.Fatalf("Expected errShortChunk, got %v", err)
+	}
+}
+
+func TestTSDBBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mt-prometheus-importer-reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	up := []label{{"__name__", "up"}, {"instance", "a:9090"}, {"job", "prometheus"}}
+	requests := []label{{"__name__", "requests_total"}, {"code", "200"}}
+	writeTestBlock(t, filepath.Join(dir, "01BKGV7JBM69T2G1BGBGM6KB12"), 0, 60000, []testSeries{
+		{labels: requests, chunks: [][]xorSample{{{1000, 1}, {16000, 2}}}},
+		{labels: up, chunks: [][]xorSample{{{1000, 1}, {16000, 1}}, {{31000, 0}, {46000, math.Float64frombits(staleNaN)}}}},
+	})
+	writeTestBlock(t, filepath.Join(dir, "01BKGTZQ1SYQJTR4PB43C8PD98"), 60000, 120000, []testSeries{
+		{labels: up, chunks: [][]xorSample{{{61000, 1}, {76500, 1}}}},
+	})
+	// not a block
+	if err := os.MkdirAll(filepath.Join(dir, "wal"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	nameFilter = regexp.MustCompile("")
+	seriesChan := make(chan series)
+	var got []series
+	done := make(chan struct{})
+	go func() {
+		for s := range seriesChan {
+			got = append(got, s)
+		}
+		close(done)
+	}()
+	blocks, err := openBlocks(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error opening blocks: %s", err)
+	}
+	defer func() {
+		for _, b := range blocks {
+			b.Close()
+		}
+	}()
+	if len(blocks) != 2 || blocks[0].meta.ULID != "01BKGV7JBM69T2G1BGBGM6KB12" {
+		t.Fatalf("Expected 2 blocks ordered by time, got %d", len(blocks))
+	}
+	err = getTSDBSeriesIntoChan(blocks, seriesChan)
+	close(seriesChan)
+	<-done
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(got))
+	}
+	exp := []struct {
+		name   string
+		tags   []string
+		mtype  string
+		points []whisper.Point
+	}{
+		{"requests_total", []string{"code=200"}, "counter", []whisper.Point{{1, 1}, {16, 2}}},
+		{"up", []string{"instance=a:9090", "job=prometheus"}, "gauge", []whisper.Point{{1, 1}, {16, 1}, {31, 0}, {61, 1}, {76, 1}}},
+	}
+	for i, e := range exp {
+		md := got[i].md
+		if md.Name != e.name || !reflect.DeepEqual(md.Tags, e.tags) || md.Mtype != e.mtype {
+			t.Fatalf("Series %d: unexpected metric data %+v", i, md)
+		}
+		points, err := got[i].load()
+		if err != nil {
+			t.Fatalf("Series %d: unexpected error loading points: %s", i, err)
+		}
+		if !reflect.DeepEqual(points, e.points) {
+			t.Fatalf("Series %d: expected points %v, got %v", i, e.points, points)
+		}
+	}
+}
+
+// testdata contains a block written by prometheus' tsdb (github.com/prometheus/tsdb v0.10.0), with 300 samples
+// at a 15s interval for each of its series. temperature has a staleness marker at its 150th sample.
+func TestTSDBPrometheusBlock(t *testing.T) {
+	defer func(from, until uint) {
+		*importFrom, *importUntil = from, until
+	}(*importFrom, *importUntil)
+
+	base := uint32(1600000000)
+	cases := []struct {
+		from, until uint32
+		first, last uint32 // indexes of the first and last expected samples
+	}{
+		{0, math.MaxUint32, 0, 299},
+		// straddles the first and second chunks, which hold 120 samples each
+		{base + 100*15, base + 130*15, 100, 129},
+	}
+
+	nameFilter = regexp.MustCompile("")
+	blocks, err := openBlocks("testdata")
+	if err != nil {
+		t.Fatalf("Unexpected error opening blocks: %s", err)
+	}
+	defer func() {
+		for _, b := range blocks {
+			b.Close()
+		}
+	}()
+
+	for i, c := range cases {
+		*importFrom, *importUntil = uint(c.from), uint(c.until)
+		seriesChan := make(chan series)
+		var got []series
+		done := make(chan struct{})
+		go func() {
+			for s := range seriesChan {
+				got = append(got, s)
+			}
+			close(done)
+		}()
+		err = getTSDBSeriesIntoChan(blocks, seriesChan)
+		close(seriesChan)
+		<-done
+		if err != nil {
+			t.Fatalf("Case %d: unexpected error: %s", i, err)
+		}
+
+		exp := []struct {
+			name  string
+			tags  []string
+			mtype string
+			value func(i uint32) float64
+		}{
+			{"http_requests_total", []string{"code=200", "job=api"}, "counter", func(i uint32) float64 { return float64(i * 3) }},
+			{"http_requests_total", []string{"code=500", "job=api"}, "counter", func(i uint32) float64 { return float64(i / 10) }},
+			{"temperature", []string{"room=kitchen"}, "gauge", func(i uint32) float64 { return 0.25 + float64(i%7)*1.5 }},
+		}
+		if len(got) != len(exp) {
+			t.Fatalf("Case %d: expected %d series, got %d", i, len(exp), len(got))
+		}
+		for j, e := range exp {
+			md := got[j].md
+			if md.Name != e.name || !reflect.DeepEqual(md.Tags, e.tags) || md.Mtype != e.mtype {
+				t.Fatalf("Case %d: series %d: unexpected metric data %+v", i, j, md)
+			}
+			points, err := got[j].load()
+			if err != nil {
+				t.Fatalf("Case %d: series %d: unexpected error loading points: %s", i, j, err)
+			}
+			var expPoints []whisper.Point
+			for k := c.first; k <= c.last; k++ {
+				if e.name == "temperature" && k == 150 {
+					continue
+				}
+				expPoints = append(expPoints, whisper.Point{Timestamp: base + k*15, Value: e.value(k)})
+			}
+			if !reflect.DeepEqual(points, expPoints) {
+				t.Fatalf("Case %d: series %d: expected points %v, got %v", i, j, expPoints, points)
+			}
+		}
+	}
+}
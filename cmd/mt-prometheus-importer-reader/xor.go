@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// staleNaN is the value prometheus uses to mark a series as stale
+// https://github.com/prometheus/prometheus/blob/master/pkg/value/value.go
+const staleNaN uint64 = 0x7ff0000000000002
+
+var errShortChunk = errors.New("xor chunk is shorter than its number of samples")
+
+// bitReader reads a stream of bits, as written by the prometheus tsdb
+type bitReader struct {
+	stream []byte
+	count  uint8 // number of bits not read yet in stream[0]
+}
+
+func newBitReader(b []byte) *bitReader {
+	return &bitReader{stream: b, count: 8}
+}
+
+func (b *bitReader) readBit() (bool, error) {
+	if b.count == 0 {
+		if len(b.stream) <= 1 {
+			return false, io.EOF
+		}
+		b.stream = b.stream[1:]
+		b.count = 8
+	}
+	if len(b.stream) == 0 {
+		return false, io.EOF
+	}
+	b.count--
+	return b.stream[0]&(1<<b.count) != 0, nil
+}
+
+func (b *bitReader) readBits(nbits int) (uint64, error) {
+	var u uint64
+	for i := 0; i < nbits; i++ {
+		bit, err := b.readBit()
+		if err != nil {
+			return 0, err
+		}
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, nil
+}
+
+// ReadByte implements io.ByteReader, so we can read varints from the stream
+func (b *bitReader) ReadByte() (byte, error) {
+	u, err := b.readBits(8)
+	return byte(u), err
+}
+
+// xorSample is a sample as stored in prometheus, with a timestamp in milliseconds
+type xorSample struct {
+	t int64
+	v float64
+}
+
+// decodeXORChunk decodes the samples of a prometheus XOR chunk, which is gorilla
+// encoding with millisecond timestamps and wider delta-of-delta buckets.
+// https://github.com/prometheus/prometheus/blob/master/tsdb/chunkenc/xor.go
+func decodeXORChunk(data []byte) ([]xorSample, error) {
+	if len(data) < 2 {
+		return nil, errShortChunk
+	}
+	num := int(binary.BigEndian.Uint16(data))
+	samples := make([]xorSample, 0, num)
+	br := newBitReader(data[2:])
+
+	var t int64
+	var tDelta uint64
+	var v uint64
+	var leading, trailing uint8
+
+	readValue := func() error {
+		bit, err := br.readBit()
+		if err != nil || !bit {
+			return err
+		}
+		bit, err = br.readBit()
+		if err != nil {
+			return err
+		}
+		if bit {
+			bits, err := br.readBits(5)
+			if err != nil {
+				return err
+			}
+			leading = uint8(bits)
+			bits, err = br.readBits(6)
+			if err != nil {
+				return err
+			}
+			sigbits := uint8(bits)
+			// 0 significant bits means 64, as that doesn't fit in 6 bits
+			if sigbits == 0 {
+				sigbits = 64
+			}
+			trailing = 64 - leading - sigbits
+		}
+		bits, err := br.readBits(int(64 - leading - trailing))
+		if err != nil {
+			return err
+		}
+		v ^= bits << trailing
+		return nil
+	}
+
+	for i := 0; i < num; i++ {
+		switch i {
+		case 0:
+			first, err := binary.ReadVarint(br)
+			if err != nil {
+				return nil, errShortChunk
+			}
+			t = first
+			v, err = br.readBits(64)
+			if err != nil {
+				return nil, errShortChunk
+			}
+		case 1:
+			delta, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, errShortChunk
+			}
+			tDelta = delta
+			t += int64(tDelta)
+			if err := readValue(); err != nil {
+				return nil, errShortChunk
+			}
+		default:
+			// the delta-of-delta is prefixed by up to 4 bits describing its size
+			var d byte
+			for j := 0; j < 4; j++ {
+				bit, err := br.readBit()
+				if err != nil {
+					return nil, errShortChunk
+				}
+				if !bit {
+					break
+				}
+				d++
+			}
+			var sz int
+			switch d {
+			case 1:
+				sz = 14
+			case 2:
+				sz = 17
+			case 3:
+				sz = 20
+			case 4:
+				sz = 64
+			}
+			var dod int64
+			if sz != 0 {
+				bits, err := br.readBits(sz)
+				if err != nil {
+					return nil, errShortChunk
+				}
+				if sz != 64 && bits > (1<<uint(sz-1)) {
+					bits -= 1 << uint(sz)
+				}
+				dod = int64(bits)
+			}
+			tDelta = uint64(int64(tDelta) + dod)
+			t += int64(tDelta)
+			if err := readValue(); err != nil {
+				return nil, errShortChunk
+			}
+		}
+		samples = append(samples, xorSample{t: t, v: math.Float64frombits(v)})
+	}
+	return samples, nil
+}
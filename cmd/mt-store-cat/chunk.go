@@ -10,6 +10,7 @@ import (
 )
 
 // printChunkSummary prints a summary of chunks in the store matching the given conditions, grouped in buckets of groupTTL size by their TTL
+// along with their size and compression ratio
 func printChunkSummary(ctx context.Context, store *cassandra.CassandraStore, tables []cassandra.Table, metrics []Metric, groupTTL string) error {
 	now := uint32(time.Now().Unix())
 	endMonth := now / cassandra.Month_sec
@@ -21,7 +22,7 @@ func printChunkSummary(ctx context.Context, store *cassandra.CassandraStore, tab
 		startMonth := start / cassandra.Month_sec
 		fmt.Println("## Table", tbl.Name)
 		if len(metrics) == 0 {
-			query := fmt.Sprintf("select key, ttl(data) from %s", tbl.Name)
+			query := fmt.Sprintf("select key, ts, ttl(data), data from %s", tbl.Name)
 			session := store.Session.CurrentSession()
 			iter := session.Query(query).Iter()
 			showKeyTTL(iter, groupTTL)
@@ -29,7 +30,7 @@ func printChunkSummary(ctx context.Context, store *cassandra.CassandraStore, tab
 			for _, metric := range metrics {
 				for num := startMonth; num <= endMonth; num += 1 {
 					row_key := fmt.Sprintf("%s_%d", metric.AMKey.String(), num)
-					query := fmt.Sprintf("select key, ttl(data) from %s where key=?", tbl.Name)
+					query := fmt.Sprintf("select key, ts, ttl(data), data from %s where key=?", tbl.Name)
 					session := store.Session.CurrentSession()
 					iter := session.Query(query, row_key).Iter()
 					showKeyTTL(iter, groupTTL)
@@ -3,30 +3,41 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/gocql/gocql"
+	"github.com/grafana/metrictank/mdata/chunk"
 	log "github.com/sirupsen/logrus"
 )
 
+// size of a point without any compression: a uint32 timestamp and a float64 value
+const rawPointSize = 12
+
 type bucket struct {
 	key string
 	ttl int
 }
 
-type bucketWithCount struct {
-	key string
-	ttl int
-	c   int
+type bucketStats struct {
+	c       int
+	bytes   int
+	points  int
+	formats map[chunk.Format]int
+}
+
+type bucketWithStats struct {
+	bucket
+	bucketStats
 }
 
-type byTTL []bucketWithCount
+type byTTL []bucketWithStats
 
 func (a byTTL) Len() int           { return len(a) }
 func (a byTTL) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a byTTL) Less(i, j int) bool { return a[i].ttl < a[j].ttl }
 
-// shows an overview of all keys and their ttls and closes the iter
-// iter must return rows of key and ttl.
+// shows an overview of all keys and their ttls, along with the size and compression ratio of their chunks, and closes the iter
+// iter must return rows of key, ts, ttl and data.
 func showKeyTTL(iter *gocql.Iter, groupTTL string) {
 	roundTTL := 1
 	switch groupTTL {
@@ -39,27 +50,76 @@ func showKeyTTL(iter *gocql.Iter, groupTTL string) {
 	}
 
 	var b bucket
-	bucketMap := make(map[bucket]int)
-	for iter.Scan(&b.key, &b.ttl) {
+	var ts int
+	var data []byte
+	bucketMap := make(map[bucket]*bucketStats)
+	for iter.Scan(&b.key, &ts, &b.ttl, &data) {
 		b.ttl /= roundTTL
-		bucketMap[b] += 1
+		stats, ok := bucketMap[b]
+		if !ok {
+			stats = &bucketStats{formats: make(map[chunk.Format]int)}
+			bucketMap[b] = stats
+		}
+		stats.c++
+		stats.bytes += len(data)
+		if len(data) > 0 {
+			stats.formats[chunk.Format(data[0])]++
+		}
+		stats.points += countPoints(b.key, uint32(ts), data)
 	}
 
-	var bucketList []bucketWithCount
-	for b, count := range bucketMap {
-		bucketList = append(bucketList, bucketWithCount{
-			b.key,
-			b.ttl,
-			count,
-		})
+	var bucketList []bucketWithStats
+	for b, stats := range bucketMap {
+		bucketList = append(bucketList, bucketWithStats{b, *stats})
 	}
 
 	sort.Sort(byTTL(bucketList))
 	for _, b := range bucketList {
-		fmt.Printf("%s %d%s %d\n", b.key, b.ttl, groupTTL, b.c)
+		var bytesPerPoint, ratio float64
+		if b.points > 0 {
+			bytesPerPoint = float64(b.bytes) / float64(b.points)
+			ratio = rawPointSize / bytesPerPoint
+		}
+		fmt.Printf("%s %d%s %d bytes=%d points=%d bytes/point=%.2f ratio=%.2f formats=%s\n", b.key, b.ttl, groupTTL, b.c, b.bytes, b.points, bytesPerPoint, ratio, formatCounts(b.formats))
 	}
 	err := iter.Close()
 	if err != nil {
 		log.Errorf("cassandra query error. %s", err)
 	}
 }
+
+// countPoints decodes the chunk and returns its number of points
+func countPoints(key string, t0 uint32, data []byte) int {
+	if len(data) == 0 {
+		log.Errorf("chunk %s at %d is empty", key, t0)
+		return 0
+	}
+	itgen, err := chunk.NewIterGen(t0, 0, data)
+	if err != nil {
+		log.Errorf("chunk %s at %d is invalid: %s", key, t0, err)
+		return 0
+	}
+	it, err := itgen.Get()
+	if err != nil {
+		log.Errorf("chunk %s at %d can't be decoded: %s", key, t0, err)
+		return 0
+	}
+	var n int
+	for it.Next() {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		log.Errorf("chunk %s at %d is corrupt: %s", key, t0, err)
+	}
+	return n
+}
+
+// formatCounts returns the number of chunks per format, like "FormatGoTszLongWithSpan:10,FormatIntDeltaWithSpan:5"
+func formatCounts(formats map[chunk.Format]int) string {
+	var list []string
+	for f, c := range formats {
+		list = append(list, fmt.Sprintf("%s:%d", f, c))
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
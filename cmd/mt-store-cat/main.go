@@ -98,7 +98,7 @@ func main() {
 		fmt.Printf("	                     format:\n")
 		fmt.Printf("	                            - points\n")
 		fmt.Printf("	                            - point-summary\n")
-		fmt.Printf("	                            - chunk-summary (shows TTL's, optionally bucketed. See groupTTL flag)\n")
+		fmt.Printf("	                            - chunk-summary (shows TTL's, optionally bucketed (see groupTTL flag), with the size, bytes per point, compression ratio and formats of the chunks)\n")
 		fmt.Printf("	                            - chunk-csv (for importing into cassandra)\n")
 		fmt.Println()
 		fmt.Println("EXAMPLES:")
@@ -113,6 +113,7 @@ func main() {
 		fmt.Println("   With great power comes great responsibility")
 		fmt.Println(" * points that are not in the `from <= ts < to` range, are prefixed with `-`. In range has prefix of '>`")
 		fmt.Println(" * When using chunk-summary, if there's data that should have been expired by cassandra, but for some reason didn't, we won't see or report it")
+		fmt.Println(" * chunk-summary decodes all chunks. The compression ratio is relative to 12 bytes per point (uncompressed uint32 timestamp and float64 value)")
 		fmt.Println(" * Doesn't automatically return data for aggregated series. It's up to you to query for an AMKey (id_<rollup>_<span>) when appropriate")
 		fmt.Println(" * (rollup is one of sum, cnt, lst, max, min and span is a number in seconds)")
 	}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/grafana/globalconf"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/idx/bigtable"
+	"github.com/grafana/metrictank/idx/cassandra"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/mdata/chunk"
+	"github.com/grafana/metrictank/schema"
+	bigtableStore "github.com/grafana/metrictank/store/bigtable"
+	cassandraStore "github.com/grafana/metrictank/store/cassandra"
+	opentracing "github.com/opentracing/opentracing-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// backend is the store and index configured in a metrictank config file
+type backend struct {
+	path     string
+	isSource bool
+	store    mdata.Store
+	casIdx   *cassandra.CasIdx
+	btIdx    *bigtable.BigtableIdx
+}
+
+// loadBackend reads the config file and initializes the store and index enabled in it.
+// the index of the source is only opened for reading, whereas the index of the destination
+// is fully initialized so that it can be written to.
+// the configs are process-wide, so each backend must be fully initialized before loading the next.
+func loadBackend(path string, isSource bool) backend {
+	if _, err := os.Stat(path); err != nil {
+		log.Fatalf("can't read config file %q: %s", path, err.Error())
+	}
+	config, err := globalconf.NewWithOptions(&globalconf.Options{
+		Filename: path,
+	})
+	if err != nil {
+		log.Fatalf("error with configuration file %q: %s", path, err.Error())
+	}
+
+	// reset to the defaults, so that we don't inherit settings from the previously loaded config
+	*cassandra.CliConfig = *cassandra.NewIdxConfig()
+	*bigtable.CliConfig = *bigtable.NewIdxConfig()
+	*cassandraStore.CliConfig = *cassandraStore.NewStoreConfig()
+	*bigtableStore.CliConfig = *bigtableStore.NewStoreConfig()
+
+	config.ParseAll()
+
+	// the storage schemas and aggregations of the source determine what we copy
+	if isSource {
+		mdata.ConfigProcess()
+	}
+	cassandra.ConfigProcess()
+	bigtable.ConfigProcess()
+	bigtableStore.ConfigProcess(mdata.MaxChunkSpan())
+
+	if (cassandraStore.CliConfig.Enabled && bigtableStore.CliConfig.Enabled) || !(cassandraStore.CliConfig.Enabled || bigtableStore.CliConfig.Enabled) {
+		log.Fatalf("%s: exactly 1 backend store plugin must be enabled. cassandra: %t bigtable: %t", path, cassandraStore.CliConfig.Enabled, bigtableStore.CliConfig.Enabled)
+	}
+	if (cassandra.CliConfig.Enabled && bigtable.CliConfig.Enabled) || !(cassandra.CliConfig.Enabled || bigtable.CliConfig.Enabled) {
+		log.Fatalf("%s: exactly 1 backend index plugin must be enabled. cassandra: %t bigtable: %t", path, cassandra.CliConfig.Enabled, bigtable.CliConfig.Enabled)
+	}
+
+	b := backend{path: path, isSource: isSource}
+	if cassandraStore.CliConfig.Enabled {
+		b.store, err = cassandraStore.NewCassandraStore(cassandraStore.CliConfig, mdata.TTLs(), chunk.MaxConfigurableSpan())
+		if err != nil {
+			log.Fatalf("%s: failed to initialize cassandra backend store. %s", path, err)
+		}
+	} else {
+		b.store, err = bigtableStore.NewStore(bigtableStore.CliConfig, mdata.TTLs(), mdata.MaxChunkSpan())
+		if err != nil {
+			log.Fatalf("%s: failed to initialize bigtable backend store. %s", path, err)
+		}
+	}
+	b.store.SetTracer(opentracing.NoopTracer{})
+
+	// the index constructors keep a reference to the config, so hand them a copy
+	if cassandra.CliConfig.Enabled {
+		cfg := *cassandra.CliConfig
+		b.casIdx = cassandra.New(&cfg)
+		if isSource {
+			err = b.casIdx.InitBare()
+		} else {
+			err = b.casIdx.Init()
+		}
+	} else {
+		cfg := *bigtable.CliConfig
+		b.btIdx = bigtable.New(&cfg)
+		if isSource {
+			err = b.btIdx.InitBare()
+		} else {
+			err = b.btIdx.Init()
+		}
+	}
+	if err != nil {
+		log.Fatalf("%s: failed to initialize index. %s", path, err)
+	}
+	return b
+}
+
+func (b backend) String() string {
+	storeName, idxName := "cassandra", "cassandra-idx"
+	if _, ok := b.store.(*bigtableStore.Store); ok {
+		storeName = "bigtable"
+	}
+	if b.btIdx != nil {
+		idxName = "bigtable-idx"
+	}
+	return b.path + " (" + storeName + ", " + idxName + ")"
+}
+
+// index returns the index to write to
+func (b backend) index() idx.MetricIndex {
+	if b.casIdx != nil {
+		return b.casIdx
+	}
+	return b.btIdx
+}
+
+// loadDefs returns all metric definitions in the given partitions, or all partitions if nil
+func (b backend) loadDefs(partitions []int32) []schema.MetricDefinition {
+	now := time.Now()
+	if b.casIdx != nil {
+		if partitions == nil {
+			return b.casIdx.Load(nil, now)
+		}
+		return b.casIdx.LoadPartitions(partitions, nil, now)
+	}
+
+	// bigtable row keys are prefixed by partition, so we need to know which ones exist
+	if partitions == nil {
+		for p := 0; p < *numPartitions; p++ {
+			partitions = append(partitions, int32(p))
+		}
+	}
+	var defs []schema.MetricDefinition
+	for _, p := range partitions {
+		defs = b.btIdx.LoadPartition(p, defs, now, -1)
+	}
+	return defs
+}
+
+func (b backend) stop() {
+	b.store.Stop()
+	// the index of the source was never fully initialized, and has nothing to flush
+	if b.isSource {
+		return
+	}
+	if b.casIdx != nil {
+		b.casIdx.Stop()
+	} else {
+		b.btIdx.Stop()
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/grafana/metrictank/schema"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkpoint records which series have been migrated, one id per line
+type checkpoint struct {
+	sync.Mutex
+	done map[schema.MKey]struct{}
+	f    *os.File
+}
+
+// openCheckpoint reads the series already migrated from the given file, and opens it
+// for recording additional ones. if path is empty, nothing is recorded.
+func openCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{
+		done: make(map[schema.MKey]struct{}),
+	}
+	if path == "" {
+		return cp, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		mkey, err := schema.MKeyFromString(line)
+		if err != nil {
+			// most likely a partially written line from an interrupted run
+			log.Warnf("checkpoint: ignoring invalid line %q: %s", line, err.Error())
+			continue
+		}
+		cp.done[mkey] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if len(cp.done) > 0 {
+		log.Infof("checkpoint: %d series were already migrated and will be skipped", len(cp.done))
+	}
+	cp.f = f
+	return cp, nil
+}
+
+func (cp *checkpoint) isDone(mkey schema.MKey) bool {
+	cp.Lock()
+	_, ok := cp.done[mkey]
+	cp.Unlock()
+	return ok
+}
+
+func (cp *checkpoint) markDone(mkey schema.MKey) error {
+	cp.Lock()
+	defer cp.Unlock()
+	cp.done[mkey] = struct{}{}
+	if cp.f == nil {
+		return nil
+	}
+	// we start with a newline, so that a line partially written by a previous run doesn't corrupt ours
+	_, err := cp.f.WriteString("\n" + mkey.String())
+	return err
+}
+
+func (cp *checkpoint) Close() error {
+	if cp.f == nil {
+		return nil
+	}
+	return cp.f.Close()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/cluster"
+	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/idx/bigtable"
+	"github.com/grafana/metrictank/idx/cassandra"
+	"github.com/grafana/metrictank/idx/memory"
+	"github.com/grafana/metrictank/logger"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/stats"
+	bigtableStore "github.com/grafana/metrictank/store/bigtable"
+	cassandraStore "github.com/grafana/metrictank/store/cassandra"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+var (
+	version = "(none)"
+
+	showVersion    = flag.Bool("version", false, "print version string")
+	logLevel       = flag.String("log-level", "info", "log level. panic|fatal|error|warning|info|debug")
+	srcConfig      = flag.String("src-config", "", "metrictank config file describing the store and index to migrate from")
+	dstConfig      = flag.String("dst-config", "", "metrictank config file describing the store and index to migrate to")
+	partitionStr   = flag.String("partitions", "*", "only migrate series in these partitions (comma separated list of partition numbers or '*' for all)")
+	numPartitions  = flag.Int("num-partitions", 1, "number of partitions in the cluster. used to determine all partitions when migrating from bigtable with partitions '*'")
+	numThreads     = flag.Int("threads", 10, "number of series to migrate concurrently")
+	maxChunksPerS  = flag.Int("max-chunks-per-second", 0, "max number of chunks to copy per second, across all threads. 0 for unlimited")
+	checkpointFile = flag.String("checkpoint-file", "mt-store-migrate.checkpoint", "file to record migrated series in, so that an interrupted migration can be resumed. empty to disable")
+	skipIndex      = flag.Bool("skip-index", false, "only copy the data, not the index")
+	progressEvery  = flag.Int("progress-every", 10000, "log progress every this many series")
+)
+
+func init() {
+	formatter := &logger.TextFormatter{}
+	formatter.TimestampFormat = "2006-01-02 15:04:05.000"
+	log.SetFormatter(formatter)
+	log.SetLevel(log.InfoLevel)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "mt-store-migrate")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Copies the data and index of all series from one store and index to another, e.g. from cassandra to bigtable.")
+		fmt.Fprintln(os.Stderr, "Both sides are described by a metrictank config file, of which exactly one backend store and one backend index must be enabled.")
+		fmt.Fprintln(os.Stderr, "The storage-schemas.conf and storage-aggregation.conf of the source config determine which archives are copied.")
+		fmt.Fprintln(os.Stderr, "After copying the chunks of a series, they are read back from the destination to verify that all of them made it.")
+		fmt.Fprintln(os.Stderr, "Series that were migrated and verified are recorded in the checkpoint file, and skipped when running again.")
+		fmt.Fprintln(os.Stderr, "Note: MT_ environment variables are not applied, as they would apply to both sides.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "	mt-store-migrate -src-config cassandra.ini -dst-config bigtable.ini [flags]")
+		fmt.Fprintf(os.Stderr, "\nFlags:\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("mt-store-migrate (version: %s - runtime: %s)\n", version, runtime.Version())
+		return
+	}
+
+	lvl, err := log.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("failed to parse log-level, %s", err.Error())
+	}
+	log.SetLevel(lvl)
+
+	if *srcConfig == "" || *dstConfig == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *numThreads < 1 {
+		log.Fatal("threads must be at least 1")
+	}
+	partitions, err := parsePartitions(*partitionStr)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	stats.NewDevnull() // make sure metrics don't pile up without getting discarded
+
+	// we want to see all series, regardless of how stale they are
+	memory.IndexRules = conf.NewIndexRules()
+
+	// the index needs this to initialize. the specified port is not relevant as we don't use clustering with this tool
+	cluster.Init("mt-store-migrate", version, time.Now(), "http", int(80))
+
+	mdata.ConfigSetup()
+	cassandra.ConfigSetup()
+	bigtable.ConfigSetup()
+	cassandraStore.ConfigSetup()
+	bigtableStore.ConfigSetup()
+
+	src := loadBackend(*srcConfig, true)
+	dst := loadBackend(*dstConfig, false)
+	log.Infof("migrating from %s to %s", src, dst)
+
+	defs := src.loadDefs(partitions)
+	log.Infof("found %d series to migrate", len(defs))
+
+	cp, err := openCheckpoint(*checkpointFile)
+	if err != nil {
+		log.Fatalf("failed to open checkpoint file: %s", err.Error())
+	}
+
+	m := &migrator{
+		src:        src.store,
+		dst:        dst.store,
+		checkpoint: cp,
+		limiter:    rate.NewLimiter(rate.Inf, 1),
+	}
+	if *maxChunksPerS > 0 {
+		m.limiter = rate.NewLimiter(rate.Limit(*maxChunksPerS), *maxChunksPerS)
+	}
+	if !*skipIndex {
+		m.index = dst.index()
+	}
+
+	res := m.run(defs, *numThreads, *progressEvery)
+
+	if err := cp.Close(); err != nil {
+		log.Errorf("failed to close checkpoint file: %s", err.Error())
+	}
+	src.stop()
+	dst.stop()
+
+	log.Infof("DONE. %s", res)
+	if res.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// parsePartitions parses a comma separated list of partitions, or '*' for all of them,
+// in which case nil is returned.
+func parsePartitions(str string) ([]int32, error) {
+	if str == "*" {
+		return nil, nil
+	}
+	var partitions []int32
+	for _, part := range strings.Split(str, ",") {
+		p, err := strconv.ParseInt(strings.TrimSpace(part), 10, 32)
+		if err != nil || p < 0 {
+			return nil, fmt.Errorf("invalid partition %q", part)
+		}
+		partitions = append(partitions, int32(p))
+	}
+	return partitions, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/schema"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+type migrator struct {
+	src        mdata.Store
+	dst        mdata.Store
+	index      idx.MetricIndex // index to add the migrated series to. nil to skip
+	checkpoint *checkpoint
+	limiter    *rate.Limiter
+}
+
+// archive is a series as stored in the store: either the raw series or a rollup
+type archive struct {
+	key schema.AMKey
+	ttl uint32
+}
+
+type result struct {
+	migrated uint64 // series
+	skipped  uint64 // series already migrated according to the checkpoint
+	failed   uint64 // series that failed to copy or verify
+	chunks   uint64
+}
+
+func (r result) String() string {
+	return fmt.Sprintf("migrated %d series (%d chunks), skipped %d, failed %d", r.migrated, r.chunks, r.skipped, r.failed)
+}
+
+// archives returns the raw series and rollups of the given series,
+// according to the storage schemas and aggregations in use.
+func archives(def schema.MetricDefinition) []archive {
+	_, sch := mdata.MatchSchema(def.NameWithTags(), def.Interval)
+	_, agg := mdata.MatchAgg(def.NameWithTags())
+
+	rets := sch.Retentions.Rets
+	out := []archive{{
+		key: schema.AMKey{MKey: def.Id},
+		ttl: uint32(rets[0].MaxRetention()),
+	}}
+	for _, ret := range rets[1:] {
+		span := uint32(ret.SecondsPerPoint)
+		ttl := uint32(ret.MaxRetention())
+		seen := make(map[schema.Method]bool)
+		for _, method := range agg.AggregationMethod {
+			var methods []schema.Method
+			switch method {
+			case conf.Avg:
+				methods = []schema.Method{schema.Sum, schema.Cnt}
+			case conf.Sum:
+				methods = []schema.Method{schema.Sum}
+			case conf.Lst:
+				methods = []schema.Method{schema.Lst}
+			case conf.Max:
+				methods = []schema.Method{schema.Max}
+			case conf.Min:
+				methods = []schema.Method{schema.Min}
+			}
+			for _, m := range methods {
+				if seen[m] {
+					continue
+				}
+				seen[m] = true
+				out = append(out, archive{
+					key: schema.AMKey{MKey: def.Id, Archive: schema.NewArchive(m, span)},
+					ttl: ttl,
+				})
+			}
+		}
+	}
+	return out
+}
+
+// run migrates the given series using the given number of threads
+func (m *migrator) run(defs []schema.MetricDefinition, threads, progressEvery int) result {
+	var res result
+	var processed uint64
+	pre := time.Now()
+
+	jobs := make(chan schema.MetricDefinition, threads)
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for def := range jobs {
+				if m.checkpoint.isDone(def.Id) {
+					// the index is cheap to sync and may not have been flushed when we got interrupted
+					m.addToIndex(def)
+					atomic.AddUint64(&res.skipped, 1)
+				} else {
+					chunks, err := m.migrateSeries(context.Background(), def, time.Now())
+					atomic.AddUint64(&res.chunks, uint64(chunks))
+					if err != nil {
+						log.Errorf("failed to migrate %s (%s): %s", def.Id, def.NameWithTags(), err.Error())
+						atomic.AddUint64(&res.failed, 1)
+					} else {
+						atomic.AddUint64(&res.migrated, 1)
+					}
+				}
+				done := atomic.AddUint64(&processed, 1)
+				if progressEvery > 0 && done%uint64(progressEvery) == 0 {
+					log.Infof("WORKING: processed %d/%d series in %s", done, len(defs), time.Since(pre).Round(time.Second))
+				}
+			}
+		}()
+	}
+	for _, def := range defs {
+		jobs <- def
+	}
+	close(jobs)
+	wg.Wait()
+	return res
+}
+
+// migrateSeries copies all chunks of all archives of the given series, verifies them,
+// and then adds the series to the index and marks it as done.
+// it returns the number of chunks copied.
+func (m *migrator) migrateSeries(ctx context.Context, def schema.MetricDefinition, now time.Time) (int, error) {
+	var copied int
+	for _, arch := range archives(def) {
+		n, err := m.migrateArchive(ctx, arch, now)
+		copied += n
+		if err != nil {
+			return copied, fmt.Errorf("archive %s: %s", arch.key, err.Error())
+		}
+	}
+	m.addToIndex(def)
+	if err := m.checkpoint.markDone(def.Id); err != nil {
+		return copied, fmt.Errorf("failed to record checkpoint: %s", err.Error())
+	}
+	return copied, nil
+}
+
+// migrateArchive copies all chunks of the archive that have not expired yet,
+// waits until they are saved, and verifies that they can be read back.
+func (m *migrator) migrateArchive(ctx context.Context, arch archive, now time.Time) (int, error) {
+	nowUnix := uint32(now.Unix())
+	from := uint32(1)
+	if nowUnix > arch.ttl {
+		from = nowUnix - arch.ttl
+	}
+	// chunks can't start in the future, but let's not be too strict about clocks
+	to := nowUnix + 1
+
+	itgens, err := m.src.Search(ctx, arch.key, arch.ttl, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from source: %s", err.Error())
+	}
+
+	var wg sync.WaitGroup
+	expected := make(map[uint32]struct{}, len(itgens))
+	for _, itgen := range itgens {
+		span := itgen.Span()
+		if span == 0 {
+			span = mdata.MaxChunkSpan()
+		}
+		// like the stores, we consider a chunk expired once its last point is older than the ttl
+		if itgen.T0+span+arch.ttl <= nowUnix {
+			continue
+		}
+		if err := m.limiter.Wait(ctx); err != nil {
+			return 0, err
+		}
+		expected[itgen.T0] = struct{}{}
+		wg.Add(1)
+		cwr := mdata.NewChunkWriteRequest(wg.Done, arch.key, arch.ttl, itgen.T0, itgen.B, time.Now())
+		m.dst.Add(&cwr)
+	}
+	wg.Wait()
+
+	if len(expected) == 0 {
+		return 0, nil
+	}
+	return len(expected), m.verify(ctx, arch, expected, from, to)
+}
+
+// verify checks that all the chunks we expect are present in the destination
+func (m *migrator) verify(ctx context.Context, arch archive, expected map[uint32]struct{}, from, to uint32) error {
+	itgens, err := m.dst.Search(ctx, arch.key, arch.ttl, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to read back from destination: %s", err.Error())
+	}
+	found := 0
+	for _, itgen := range itgens {
+		if _, ok := expected[itgen.T0]; ok {
+			found++
+		}
+	}
+	if found != len(expected) {
+		return fmt.Errorf("verification failed: copied %d chunks, but found %d of them in the destination", len(expected), found)
+	}
+	return nil
+}
+
+func (m *migrator) addToIndex(def schema.MetricDefinition) {
+	if m.index == nil {
+		return
+	}
+	md := schema.MetricData{
+		Id:       def.Id.String(),
+		OrgId:    int(def.OrgId),
+		Name:     def.Name,
+		Interval: def.Interval,
+		Unit:     def.Unit,
+		Mtype:    def.Mtype,
+		Tags:     def.Tags,
+		Time:     def.LastUpdate,
+	}
+	m.index.AddOrUpdate(def.Id, &md, def.Partition)
+}
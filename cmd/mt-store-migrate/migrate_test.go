@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/mdata/chunk"
+	"github.com/grafana/metrictank/schema"
+	"golang.org/x/time/rate"
+)
+
+// callbackStore is a MockStore that is safe for concurrent use and,
+// like the real stores, calls the callback once a chunk is saved
+type callbackStore struct {
+	sync.Mutex
+	*mdata.MockStore
+}
+
+func newCallbackStore() *callbackStore {
+	return &callbackStore{MockStore: mdata.NewMockStore()}
+}
+
+func (c *callbackStore) Add(cwr *mdata.ChunkWriteRequest) {
+	c.Lock()
+	c.MockStore.Add(cwr)
+	c.Unlock()
+	if cwr.Callback != nil {
+		cwr.Callback()
+	}
+}
+
+func (c *callbackStore) Search(ctx context.Context, key schema.AMKey, ttl, start, end uint32) ([]chunk.IterGen, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.MockStore.Search(ctx, key, ttl, start, end)
+}
+
+func setTestSchemas() func() {
+	_schemas, _aggregations := mdata.Schemas, mdata.Aggregations
+	mdata.Schemas = conf.NewSchemas([]conf.Schema{{
+		Name:       "default",
+		Pattern:    regexp.MustCompile(".*"),
+		Retentions: conf.MustParseRetentions("10s:1d:1h:2,1m:7d:6h:2"),
+	}})
+	mdata.Aggregations = conf.NewAggregations()
+	return func() {
+		mdata.Schemas, mdata.Aggregations = _schemas, _aggregations
+	}
+}
+
+func testDef() schema.MetricDefinition {
+	def := schema.MetricDefinition{
+		OrgId:    1,
+		Name:     "some.metric",
+		Interval: 10,
+		Mtype:    "gauge",
+	}
+	def.SetId()
+	return def
+}
+
+// addChunks adds a chunk for every hour in [from, to) to the store
+func addChunks(store mdata.Store, key schema.AMKey, ttl, from, to uint32) int {
+	var n int
+	for t0 := from; t0 < to; t0 += 3600 {
+		c := chunk.New(t0)
+		c.Push(t0, 1)
+		c.Finish()
+		cwr := mdata.NewChunkWriteRequest(nil, key, ttl, t0, c.Encode(3600), time.Now())
+		store.Add(&cwr)
+		n++
+	}
+	return n
+}
+
+func TestArchives(t *testing.T) {
+	defer setTestSchemas()()
+
+	def := testDef()
+	got := archives(def)
+	// the default aggregation is avg, which is stored as sum and cnt
+	exp := []archive{
+		{key: schema.AMKey{MKey: def.Id}, ttl: 86400},
+		{key: schema.AMKey{MKey: def.Id, Archive: schema.NewArchive(schema.Sum, 60)}, ttl: 7 * 86400},
+		{key: schema.AMKey{MKey: def.Id, Archive: schema.NewArchive(schema.Cnt, 60)}, ttl: 7 * 86400},
+	}
+	if len(got) != len(exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Fatalf("archive %d: expected %v, got %v", i, exp[i], got[i])
+		}
+	}
+}
+
+func TestMigrateSeries(t *testing.T) {
+	defer setTestSchemas()()
+
+	now := time.Unix(10*86400, 0)
+	nowUnix := uint32(now.Unix())
+	def := testDef()
+	src := newCallbackStore()
+	var exp int
+	for _, arch := range archives(def) {
+		// include a few chunks that have expired, which should not be copied
+		exp += addChunks(src, arch.key, arch.ttl, nowUnix-arch.ttl+3600, nowUnix)
+		addChunks(src, arch.key, arch.ttl, nowUnix-arch.ttl-3*3600, nowUnix-arch.ttl-3600)
+	}
+
+	dst := newCallbackStore()
+	m := &migrator{
+		src:        src,
+		dst:        dst,
+		checkpoint: &checkpoint{done: make(map[schema.MKey]struct{})},
+		limiter:    rate.NewLimiter(rate.Inf, 1),
+	}
+	copied, err := m.migrateSeries(context.Background(), def, now)
+	if err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	if copied != exp || dst.Items() != exp {
+		t.Fatalf("expected %d chunks to be copied, got %d and %d in the destination", exp, copied, dst.Items())
+	}
+	if !m.checkpoint.isDone(def.Id) {
+		t.Fatalf("expected series to be marked as done")
+	}
+
+	// a destination that loses writes should fail verification, and not be marked as done
+	lossy := newCallbackStore()
+	lossy.Drop = true
+	m.dst = lossy
+	m.checkpoint = &checkpoint{done: make(map[schema.MKey]struct{})}
+	if _, err := m.migrateSeries(context.Background(), def, now); err == nil {
+		t.Fatalf("expected verification to fail")
+	}
+	if m.checkpoint.isDone(def.Id) {
+		t.Fatalf("expected series to not be marked as done")
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mt-store-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+
+	def := testDef()
+	cp, err := openCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.isDone(def.Id) {
+		t.Fatalf("expected series to not be done yet")
+	}
+	if err := cp.markDone(def.Id); err != nil {
+		t.Fatal(err)
+	}
+	cp.Close()
+
+	// simulate a line that was partially written when we got interrupted
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\n1.123")
+	f.Close()
+
+	cp, err = openCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+	if !cp.isDone(def.Id) || len(cp.done) != 1 {
+		t.Fatalf("expected exactly our series to be done after reopening, got %v", cp.done)
+	}
+}
@@ -14,8 +14,11 @@ import (
 // Schemas contains schema settings
 type Schemas struct {
 	raw           []Schema // parsed from the config file
-	index         []Schema // the "expanded" structure (built from raw+DefaultSchema) that will actually be used.
+	index         []Schema // the "expanded" structure (built from raw+DefaultSchema+orgs) that will actually be used.
 	DefaultSchema Schema
+	orgs          map[uint32]Schema // schemas that apply to all metrics of an org, regardless of the patterns
+	orgIndex      map[uint32]int    // position of the schemas of the orgs in the index
+	orgStart      int               // position of the first schema of an org in the index. they come after the default schema
 }
 
 type SchemaSlice []Schema
@@ -60,30 +63,49 @@ func (s Schemas) Len() int {
 func (s *Schemas) BuildIndex() {
 	s.index = make([]Schema, 0)
 	for _, schema := range s.raw {
-		for pos := range schema.Retentions.Rets {
-			s.index = append(s.index, Schema{
-				Name:               schema.Name,
-				Pattern:            schema.Pattern,
-				Retentions:         schema.Retentions.Sub(pos),
-				Priority:           schema.Priority,
-				ReorderWindow:      schema.ReorderWindow,
-				ReorderAllowUpdate: schema.ReorderAllowUpdate,
-			})
-		}
+		s.expand(schema)
 	}
 	// add the default schema
-	for pos := range s.DefaultSchema.Retentions.Rets {
+	s.expand(s.DefaultSchema)
+
+	// add the schemas of the orgs, in a deterministic order
+	orgs := make([]int, 0, len(s.orgs))
+	for orgId := range s.orgs {
+		orgs = append(orgs, int(orgId))
+	}
+	sort.Ints(orgs)
+	s.orgStart = len(s.index)
+	s.orgIndex = make(map[uint32]int, len(orgs))
+	for _, orgId := range orgs {
+		s.orgIndex[uint32(orgId)] = len(s.index)
+		s.expand(s.orgs[uint32(orgId)])
+	}
+}
+
+// expand adds the schema to the index, once for each sublist of its retentions
+func (s *Schemas) expand(schema Schema) {
+	for pos := range schema.Retentions.Rets {
 		s.index = append(s.index, Schema{
-			Name:               s.DefaultSchema.Name,
-			Pattern:            s.DefaultSchema.Pattern,
-			Retentions:         s.DefaultSchema.Retentions.Sub(pos),
-			Priority:           s.DefaultSchema.Priority,
-			ReorderWindow:      s.DefaultSchema.ReorderWindow,
-			ReorderAllowUpdate: s.DefaultSchema.ReorderAllowUpdate,
+			Name:               schema.Name,
+			Pattern:            schema.Pattern,
+			Retentions:         schema.Retentions.Sub(pos),
+			Priority:           schema.Priority,
+			ReorderWindow:      schema.ReorderWindow,
+			ReorderAllowUpdate: schema.ReorderAllowUpdate,
 		})
 	}
 }
 
+// SetOrgSchema sets the schema of all metrics of the given org.
+// It takes precedence over the schemas from the config file, and its pattern is not used.
+func (s *Schemas) SetOrgSchema(orgId uint32, schema Schema) {
+	if s.orgs == nil {
+		s.orgs = make(map[uint32]Schema)
+	}
+	s.orgs[orgId] = schema
+	s.BuildIndex()
+}
+
 // ReadSchemas reads and parses a storage-schemas.conf file and returns a sorted schemas structure
 // see https://graphite.readthedocs.io/en/0.9.9/config-carbon.html#storage-schemas-conf
 func ReadSchemas(file string) (Schemas, error) {
@@ -188,35 +210,11 @@ func ReadSchemas(file string) (Schemas, error) {
 //     (pattern3).
 func (s Schemas) Match(metric string, interval int) (uint16, Schema) {
 	i := 0
-	for i < len(s.index) {
+	// the schemas of the orgs are only matched by MatchOrg
+	for i < s.orgStart {
 		schema := s.index[i]
 		if schema.Pattern.MatchString(metric) {
-			// no interval passed,use the raw retentions.
-			// This is primarily used by the carbon input plugin.
-			if interval == 0 {
-				return uint16(i), schema
-			}
-			// search through the retentions to find the first one where
-			// the metric interval is < SecondsPerPoint of the retention.
-			// The schema is then the previous retention.
-			for j, ret := range schema.Retentions.Rets {
-				if interval < ret.SecondsPerPoint {
-					// if there are no retentions with SecondsPerPoint <= interval (j==0)
-					// then we need to use the first retention. Otherwise, the retention
-					// we want to use is the previous one.
-					if j > 0 {
-						j--
-					}
-					// the position in the index (schemaId) is the position of the schema we used for the
-					// regex match + the position of the retention.
-					pos := i + j
-					return uint16(pos), s.index[pos]
-				}
-			}
-			// no retentions found with SecondsPerPoint > interval. So lets just use the retention
-			// with the largest secondsPerPoint.
-			pos := i + len(schema.Retentions.Rets) - 1
-			return uint16(pos), s.index[pos]
+			return s.matchInterval(i, interval)
 		}
 		// the next len(schema.Retentions) schemas in the index all have the
 		// same schema pattern, so we can skip over them.
@@ -228,6 +226,46 @@ func (s Schemas) Match(metric string, interval int) (uint16, Schema) {
 	return uint16(len(s.index)), s.DefaultSchema
 }
 
+// MatchOrg is like Match, but if the org has its own schema, it returns that one regardless of the metric name
+func (s Schemas) MatchOrg(orgId uint32, metric string, interval int) (uint16, Schema) {
+	if i, ok := s.orgIndex[orgId]; ok {
+		return s.matchInterval(i, interval)
+	}
+	return s.Match(metric, interval)
+}
+
+// matchInterval returns the schema from the index, among the ones of the matched schema at position i,
+// whose raw retention fits the interval best.
+func (s Schemas) matchInterval(i int, interval int) (uint16, Schema) {
+	schema := s.index[i]
+	// no interval passed,use the raw retentions.
+	// This is primarily used by the carbon input plugin.
+	if interval == 0 {
+		return uint16(i), schema
+	}
+	// search through the retentions to find the first one where
+	// the metric interval is < SecondsPerPoint of the retention.
+	// The schema is then the previous retention.
+	for j, ret := range schema.Retentions.Rets {
+		if interval < ret.SecondsPerPoint {
+			// if there are no retentions with SecondsPerPoint <= interval (j==0)
+			// then we need to use the first retention. Otherwise, the retention
+			// we want to use is the previous one.
+			if j > 0 {
+				j--
+			}
+			// the position in the index (schemaId) is the position of the schema we used for the
+			// regex match + the position of the retention.
+			pos := i + j
+			return uint16(pos), s.index[pos]
+		}
+	}
+	// no retentions found with SecondsPerPoint > interval. So lets just use the retention
+	// with the largest secondsPerPoint.
+	pos := i + len(schema.Retentions.Rets) - 1
+	return uint16(pos), s.index[pos]
+}
+
 // Get returns the schema setting corresponding to the given index
 func (s Schemas) Get(i uint16) Schema {
 	if i+1 > uint16(len(s.index)) {
@@ -247,6 +285,11 @@ func (schemas Schemas) TTLs() []uint32 {
 	for _, r := range schemas.DefaultSchema.Retentions.Rets {
 		ttls[uint32(r.MaxRetention())] = struct{}{}
 	}
+	for _, s := range schemas.orgs {
+		for _, r := range s.Retentions.Rets {
+			ttls[uint32(r.MaxRetention())] = struct{}{}
+		}
+	}
 	var ttlSlice []uint32
 	for ttl := range ttls {
 		ttlSlice = append(ttlSlice, ttl)
@@ -265,6 +308,11 @@ func (schemas Schemas) MaxChunkSpan() uint32 {
 	for _, r := range schemas.DefaultSchema.Retentions.Rets {
 		max = util.Max(max, r.ChunkSpan)
 	}
+	for _, s := range schemas.orgs {
+		for _, r := range s.Retentions.Rets {
+			max = util.Max(max, r.ChunkSpan)
+		}
+	}
 	return max
 }
 
@@ -277,5 +325,8 @@ func (schemas Schemas) MaxRawRetention() int {
 	}
 	rawRetention := schemas.DefaultSchema.Retentions.Rets[0]
 	max = util.MaxInt(max, rawRetention.MaxRetention())
+	for _, s := range schemas.orgs {
+		max = util.MaxInt(max, s.Retentions.Rets[0].MaxRetention())
+	}
 	return max
 }
@@ -154,6 +154,40 @@ func TestDefaultSchema(t *testing.T) {
 	})
 }
 
+func TestOrgSchema(t *testing.T) {
+	schemas := schemasForTest()
+	schemas.SetOrgSchema(5, Schema{
+		Name: "org5",
+		Retentions: BuildFromRetentions(
+			NewRetentionMT(1, 3600, 60*10, 0, 0),
+			NewRetentionMT(60, 86400*400, 60*60*24, 0, 0),
+		),
+	})
+
+	Convey("When matching metrics of the org", t, func() {
+		id, schema := schemas.MatchOrg(5, "a.foo", 1)
+		So(schema.Name, ShouldEqual, "org5")
+		So(schema.Retentions.Rets[0].SecondsPerPoint, ShouldEqual, 1)
+		So(schemas.Get(id).Name, ShouldEqual, "org5")
+
+		id, schema = schemas.MatchOrg(5, "a.foo", 60)
+		So(schema.Name, ShouldEqual, "org5")
+		So(schema.Retentions.Rets[0].SecondsPerPoint, ShouldEqual, 60)
+		So(schemas.Get(id).Name, ShouldEqual, "org5")
+	})
+	Convey("When matching metrics of other orgs", t, func() {
+		_, schema := schemas.MatchOrg(1, "a.foo", 1)
+		So(schema.Name, ShouldEqual, "a")
+		_, schema = schemas.Match("unmatched.foo", 1)
+		So(schema.Name, ShouldEqual, "default")
+	})
+	Convey("When getting the list of TTLs", t, func() {
+		So(schemas.TTLs(), ShouldContain, uint32(86400*400))
+		So(schemas.MaxRawRetention(), ShouldEqual, 86400)
+		So(schemas.MaxChunkSpan(), ShouldEqual, 60*60*24)
+	})
+}
+
 func TestTTLs(t *testing.T) {
 	schemas := schemasForTest()
 	Convey("When getting list of TTLS", t, func() {
@@ -404,11 +404,18 @@ func (e expr) consumeKwarg(key string, optArgs []Arg) error {
 		*v.val = got.int
 	case ArgFloat:
 		switch got.etype {
-		case etInt:
-			// integer is also a valid float, just happened to have no decimals
-			*v.val = float64(got.int)
-		case etFloat:
-			*v.val = got.float
+		// integer is also a valid float, just happened to have no decimals
+		case etInt, etFloat:
+			for _, va := range v.validator {
+				if err := va(got); err != nil {
+					return generateValidatorError(v.key, err)
+				}
+			}
+			if got.etype == etInt {
+				*v.val = float64(got.int)
+			} else {
+				*v.val = got.float
+			}
 		default:
 			return ErrBadKwarg{key, exp, got.etype}
 		}
@@ -0,0 +1,79 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/schema"
+)
+
+type FuncAggregateLine struct {
+	in       GraphiteFunc
+	fn       string
+	keepStep bool
+	first    uint32
+	last     uint32
+}
+
+func NewAggregateLine() GraphiteFunc {
+	return &FuncAggregateLine{fn: "average"}
+}
+
+func (s *FuncAggregateLine) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "func", opt: true, val: &s.fn, validator: []Validator{IsConsolFunc}},
+		ArgBool{key: "keepStep", opt: true, val: &s.keepStep},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncAggregateLine) Context(context Context) Context {
+	// like constantLine, from and to are both inclusive
+	s.first = context.from - 1
+	s.last = context.to - 1
+	return context
+}
+
+func (s *FuncAggregateLine) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	// note that s.fn has already been validated at series construction time using consolidation.IsConsolFunc
+	aggFunc := consolidation.GetAggFunc(consolidation.FromConsolidateBy(s.fn))
+
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		value := aggFunc(serie.Datapoints)
+		name := fmt.Sprintf("aggregateLine(%s, None)", serie.Target)
+		if !math.IsNaN(value) {
+			name = fmt.Sprintf("aggregateLine(%s, %.6g)", serie.Target, value)
+		}
+
+		if s.keepStep {
+			out := pointSlicePool.Get()
+			for _, p := range serie.Datapoints {
+				out = append(out, schema.Point{Val: value, Ts: p.Ts})
+			}
+			serie.Target = name
+			serie.QueryPatt = name
+			serie.Tags = serie.CopyTagsWith("name", name)
+			serie.Datapoints = out
+			outputs = append(outputs, serie)
+			continue
+		}
+
+		line := models.Series{
+			Target:     name,
+			QueryPatt:  name,
+			Datapoints: constantLinePoints(value, s.first, s.last),
+		}
+		line.SetTags()
+		outputs = append(outputs, line)
+	}
+	dataMap.Add(Req{}, outputs...)
+	return outputs, nil
+}
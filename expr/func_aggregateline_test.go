@@ -0,0 +1,93 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+func TestAggregateLineKeepStep(t *testing.T) {
+	testAggregateLine(
+		"keepstep",
+		"max",
+		true,
+		[]models.Series{
+			getSeriesNamed("foo", a),
+		},
+		[]models.Series{
+			getSeriesNamed("aggregateLine(foo, 1.23457e+09)", []schema.Point{
+				{Val: 1234567890, Ts: 10},
+				{Val: 1234567890, Ts: 20},
+				{Val: 1234567890, Ts: 30},
+				{Val: 1234567890, Ts: 40},
+				{Val: 1234567890, Ts: 50},
+				{Val: 1234567890, Ts: 60},
+			}),
+		},
+		t,
+	)
+}
+
+func TestAggregateLineConstant(t *testing.T) {
+	testAggregateLine(
+		"constant",
+		"average",
+		false,
+		[]models.Series{
+			getSeriesNamed("foo", a),
+			getSeriesNamed("bar", allNulls),
+		},
+		[]models.Series{
+			{
+				Target:    "aggregateLine(foo, 3.08642e+08)",
+				QueryPatt: "aggregateLine(foo, 3.08642e+08)",
+				Datapoints: []schema.Point{
+					{Val: 308641973.875, Ts: 9},
+					{Val: 308641973.875, Ts: 34},
+					{Val: 308641973.875, Ts: 60},
+				},
+			},
+			{
+				Target:    "aggregateLine(bar, None)",
+				QueryPatt: "aggregateLine(bar, None)",
+				Datapoints: []schema.Point{
+					{Val: math.NaN(), Ts: 9},
+					{Val: math.NaN(), Ts: 34},
+					{Val: math.NaN(), Ts: 60},
+				},
+			},
+		},
+		t,
+	)
+}
+
+func testAggregateLine(name, fn string, keepStep bool, in []models.Series, out []models.Series, t *testing.T) {
+	f := NewAggregateLine()
+	f.(*FuncAggregateLine).in = NewMock(in)
+	f.(*FuncAggregateLine).fn = fn
+	f.(*FuncAggregateLine).keepStep = keepStep
+	f.Context(Context{from: 10, to: 61})
+
+	inputCopy := models.SeriesCopy(in) // to later verify that it is unchanged
+
+	dataMap := initDataMap(in)
+
+	got, err := f.Exec(dataMap)
+	if err := equalOutput(out, got, nil, err); err != nil {
+		t.Fatalf("Case %s: %s", name, err)
+	}
+
+	t.Run("DidNotModifyInput", func(t *testing.T) {
+		if err := equalOutput(inputCopy, in, nil, nil); err != nil {
+			t.Fatalf("Case %s: Input was modified, err = %s", name, err)
+		}
+	})
+
+	t.Run("DoesNotDoubleReturnPoints", func(t *testing.T) {
+		if err := dataMap.CheckForOverlappingPoints(); err != nil {
+			t.Fatalf("Case %s: Point slices in datamap overlap, err = %s", name, err)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package expr
+
+import (
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncAlpha struct {
+	in    GraphiteFunc
+	alpha float64
+}
+
+func NewAlpha() GraphiteFunc {
+	return &FuncAlpha{}
+}
+
+func (s *FuncAlpha) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "alpha", val: &s.alpha, validator: []Validator{WithinZeroOneInclusiveInterval}},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncAlpha) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncAlpha) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		serie.Style.Alpha = s.alpha
+		outputs = append(outputs, serie)
+	}
+	return outputs, nil
+}
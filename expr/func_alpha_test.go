@@ -0,0 +1,31 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestAlpha(t *testing.T) {
+	in := []models.Series{
+		getSeriesNamed("foo", a),
+		getSeriesNamed("bar", b),
+	}
+	exp := models.SeriesCopy(in)
+	for i := range exp {
+		exp[i].Style.Alpha = 0.5
+	}
+
+	f := NewAlpha()
+	f.(*FuncAlpha).in = NewMock(in)
+	f.(*FuncAlpha).alpha = 0.5
+
+	inputCopy := models.SeriesCopy(in)
+	got, err := f.Exec(initDataMap(in))
+	if err := equalOutput(exp, got, nil, err); err != nil {
+		t.Fatal(err)
+	}
+	if err := equalOutput(inputCopy, in, nil, nil); err != nil {
+		t.Fatalf("Input was modified, err = %s", err)
+	}
+}
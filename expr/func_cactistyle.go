@@ -0,0 +1,88 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/batch"
+	"github.com/grafana/metrictank/util"
+)
+
+type FuncCactiStyle struct {
+	in     GraphiteFunc
+	system string
+	units  string
+}
+
+func NewCactiStyle() GraphiteFunc {
+	return &FuncCactiStyle{}
+}
+
+func (s *FuncCactiStyle) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "system", opt: true, val: &s.system, validator: []Validator{IsUnitSystem}},
+		ArgString{key: "units", opt: true, val: &s.units},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncCactiStyle) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncCactiStyle) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	// like graphite, we align the columns based on the width of the integer parts of the values
+	// (or of 3 if there is no value, or it is 0)
+	var nameLen, lastLen, maxLen, minLen int
+	for _, serie := range series {
+		nameLen = util.MaxInt(nameLen, utf8.RuneCountInString(serie.Target))
+		lastLen = util.MaxInt(lastLen, len(s.format(truncOrThree(batch.Lst(serie.Datapoints))))+3)
+		maxLen = util.MaxInt(maxLen, len(s.format(truncOrThree(batch.Max(serie.Datapoints))))+3)
+		minLen = util.MaxInt(minLen, len(s.format(truncOrThree(batch.Min(serie.Datapoints))))+3)
+	}
+
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		last := s.formatOrNaN(batch.Lst(serie.Datapoints))
+		maximum := s.formatOrNaN(batch.Max(serie.Datapoints))
+		minimum := s.formatOrNaN(batch.Min(serie.Datapoints))
+		serie.Target = fmt.Sprintf("%-*s Current:%-*s Max:%-*s Min:%-*s ", nameLen, serie.Target, lastLen, last, maxLen, maximum, minLen, minimum)
+		outputs = append(outputs, serie)
+	}
+	return outputs, nil
+}
+
+func (s *FuncCactiStyle) format(v float64) string {
+	if s.system != "" {
+		v, prefix := formatUnits(v, s.system)
+		if s.units != "" {
+			return fmt.Sprintf("%.2f %s%s", v, prefix, s.units)
+		}
+		return fmt.Sprintf("%.2f%s", v, prefix)
+	}
+	if s.units != "" {
+		return fmt.Sprintf("%.2f %s", v, s.units)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+func (s *FuncCactiStyle) formatOrNaN(v float64) string {
+	if math.IsNaN(v) {
+		return "nan"
+	}
+	return s.format(v)
+}
+
+func truncOrThree(v float64) float64 {
+	if math.IsNaN(v) || v == 0 {
+		return 3
+	}
+	return math.Trunc(v)
+}
@@ -0,0 +1,61 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestCactiStyleNoArgs(t *testing.T) {
+	testCactiStyle(
+		"no-args",
+		"",
+		"",
+		[]models.Series{
+			getSeriesNamed("foo", a),
+			getSeriesNamed("longername", allNulls),
+		},
+		[]models.Series{
+			getSeries("foo        Current:1234567890.00    Max:1234567890.00    Min:0.00    ", "foo", a),
+			getSeries("longername Current:nan              Max:nan              Min:nan     ", "longername", allNulls),
+		},
+		t,
+	)
+}
+
+func TestCactiStyleSystemAndUnits(t *testing.T) {
+	testCactiStyle(
+		"si-units",
+		"si",
+		"b",
+		[]models.Series{
+			getSeriesNamed("foo", a),
+		},
+		[]models.Series{
+			getSeries("foo Current:1.23 Gb    Max:1.23 Gb    Min:0.00 b    ", "foo", a),
+		},
+		t,
+	)
+}
+
+func testCactiStyle(name, system, units string, in []models.Series, out []models.Series, t *testing.T) {
+	f := NewCactiStyle()
+	f.(*FuncCactiStyle).in = NewMock(in)
+	f.(*FuncCactiStyle).system = system
+	f.(*FuncCactiStyle).units = units
+
+	inputCopy := models.SeriesCopy(in) // to later verify that it is unchanged
+
+	dataMap := initDataMap(in)
+
+	got, err := f.Exec(dataMap)
+	if err := equalOutput(out, got, nil, err); err != nil {
+		t.Fatalf("Case %s: %s", name, err)
+	}
+
+	t.Run("DidNotModifyInput", func(t *testing.T) {
+		if err := equalOutput(inputCopy, in, nil, nil); err != nil {
+			t.Fatalf("Case %s: Input was modified, err = %s", name, err)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package expr
+
+import (
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncColor struct {
+	in    GraphiteFunc
+	color string
+}
+
+func NewColor() GraphiteFunc {
+	return &FuncColor{}
+}
+
+func (s *FuncColor) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "theColor", val: &s.color},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncColor) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncColor) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		serie.Style.Color = s.color
+		outputs = append(outputs, serie)
+	}
+	return outputs, nil
+}
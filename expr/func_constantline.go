@@ -36,33 +36,38 @@ func (s *FuncConstantLine) Context(context Context) Context {
 }
 
 func (s *FuncConstantLine) Exec(dataMap DataMap) ([]models.Series, error) {
-	out := pointSlicePool.Get()
-
-	out = append(out, schema.Point{Val: s.value, Ts: s.first})
-	diff := s.last - s.first
-
-	// edge cases
-	// if first = last - 1, return one datapoint to user, so don't add more points
-	// if first = last - 2, return two datapoints where timestamps are first, first +1
-	if diff > 2 {
-		out = append(out,
-			schema.Point{Val: s.value, Ts: s.first + uint32(diff/2.0)},
-			schema.Point{Val: s.value, Ts: s.last},
-		)
-	} else if diff == 2 {
-		out = append(out, schema.Point{Val: s.value, Ts: s.first + 1})
-	}
-
 	strValue := fmt.Sprintf("%g", s.value)
 
 	outputs := make([]models.Series, 1)
 	outputs[0] = models.Series{
 		Target:     strValue,
 		QueryPatt:  strValue,
-		Datapoints: out,
+		Datapoints: constantLinePoints(s.value, s.first, s.last),
 	}
 	outputs[0].SetTags()
 
 	dataMap.Add(Req{}, outputs...)
 	return outputs, nil
 }
+
+// constantLinePoints returns a pooled slice of points describing a line of the given value
+// from first to last (both inclusive). see FuncConstantLine.Context
+func constantLinePoints(value float64, first, last uint32) []schema.Point {
+	out := pointSlicePool.Get()
+
+	out = append(out, schema.Point{Val: value, Ts: first})
+	diff := last - first
+
+	// edge cases
+	// if first = last - 1, return one datapoint to user, so don't add more points
+	// if first = last - 2, return two datapoints where timestamps are first, first +1
+	if diff > 2 {
+		out = append(out,
+			schema.Point{Val: value, Ts: first + uint32(diff/2.0)},
+			schema.Point{Val: value, Ts: last},
+		)
+	} else if diff == 2 {
+		out = append(out, schema.Point{Val: value, Ts: first + 1})
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncDashed struct {
+	in         GraphiteFunc
+	dashLength float64
+}
+
+func NewDashed() GraphiteFunc {
+	return &FuncDashed{dashLength: 5}
+}
+
+func (s *FuncDashed) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "dashLength", opt: true, val: &s.dashLength, validator: []Validator{AtLeastOne}},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncDashed) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncDashed) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		serie.Target = fmt.Sprintf("dashed(%s, %g)", serie.Target, s.dashLength)
+		serie.QueryPatt = fmt.Sprintf("dashed(%s, %g)", serie.QueryPatt, s.dashLength)
+		serie.Style.Dashed = s.dashLength
+		outputs = append(outputs, serie)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,52 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestDashed(t *testing.T) {
+	cases := []struct {
+		dashLength float64
+		target     string
+	}{
+		{5, "dashed(foo, 5)"},
+		{2.5, "dashed(foo, 2.5)"},
+	}
+	for _, c := range cases {
+		in := []models.Series{
+			getSeriesNamed("foo", a),
+		}
+		exp := getSeriesNamed(c.target, a)
+		exp.Style.Dashed = c.dashLength
+
+		f := NewDashed()
+		f.(*FuncDashed).in = NewMock(in)
+		f.(*FuncDashed).dashLength = c.dashLength
+
+		got, err := f.Exec(initDataMap(in))
+		if err := equalOutput([]models.Series{exp}, got, nil, err); err != nil {
+			t.Fatalf("dashLength %g: %s", c.dashLength, err)
+		}
+	}
+}
+
+func TestDashedInvalidLength(t *testing.T) {
+	for _, target := range []string{
+		"dashed(foo, 0.000001)",
+		"dashed(foo, 0)",
+		"dashed(foo, -1)",
+		"dashed(foo, dashLength=0.000001)",
+	} {
+		exprs, err := ParseMany([]string{target})
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", target, err)
+		}
+		_, err = NewPlan(exprs, 0, 3600, 800, true, Optimizations{})
+		if err == nil || !strings.Contains(err.Error(), ErrAtLeastOne.Error()) {
+			t.Fatalf("%s: expected error %q, got %v", target, ErrAtLeastOne, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package expr
+
+import (
+	"math"
+	"strings"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/schema"
+)
+
+// eventsStep is the interval of the series returned by events().
+// graphite uses a step of 1 second, which results in needlessly large series for typical time ranges
+const eventsStep = 60
+
+// EventsGetter returns the events which happened within from (inclusive) and to (exclusive)
+// and which have all the given tags.
+type EventsGetter func(from, to uint32, tags []string) []idx.Event
+
+// eventSource allows the events() functions of a plan to get the EventsGetter,
+// which is only known to the caller after the plan has been created.
+type eventSource struct {
+	get EventsGetter
+}
+
+type FuncEvents struct {
+	tags   []string
+	from   uint32
+	to     uint32
+	source *eventSource
+}
+
+func NewEvents() GraphiteFunc {
+	return &FuncEvents{}
+}
+
+func (s *FuncEvents) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgStrings{key: "tags", opt: true, val: &s.tags},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncEvents) Context(context Context) Context {
+	s.from = context.from
+	s.to = context.to
+	s.source = context.events
+	return context
+}
+
+func (s *FuncEvents) Exec(dataMap DataMap) ([]models.Series, error) {
+	name := `events("` + strings.Join(s.tags, `", "`) + `")`
+
+	tags := s.tags
+	if len(tags) == 1 && tags[0] == "*" {
+		tags = nil
+	}
+
+	// buckets are aligned to the step. the last one may extend beyond the end of the range
+	start := s.from - s.from%eventsStep
+	end := s.to
+	if end%eventsStep != 0 {
+		end += eventsStep - end%eventsStep
+	}
+
+	out := pointSlicePool.GetMin(int((end - start) / eventsStep))
+	for ts := start; ts < end; ts += eventsStep {
+		out = append(out, schema.Point{Val: math.NaN(), Ts: ts})
+	}
+
+	if s.source != nil && s.source.get != nil {
+		for _, event := range s.source.get(start, end, tags) {
+			if event.When < int64(start) || event.When >= int64(end) {
+				continue
+			}
+			i := (uint32(event.When) - start) / eventsStep
+			if math.IsNaN(out[i].Val) {
+				out[i].Val = 1
+			} else {
+				out[i].Val++
+			}
+		}
+	}
+
+	outputs := make([]models.Series, 1)
+	outputs[0] = models.Series{
+		Target:       name,
+		QueryPatt:    name,
+		Interval:     eventsStep,
+		QueryFrom:    s.from,
+		QueryTo:      s.to,
+		Consolidator: consolidation.Sum,
+		QueryCons:    consolidation.Sum,
+		Datapoints:   out,
+	}
+	outputs[0].SetTags()
+
+	dataMap.Add(Req{}, outputs...)
+	return outputs, nil
+}
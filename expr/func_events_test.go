@@ -0,0 +1,146 @@
+package expr
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/schema"
+)
+
+var testEvents = []idx.Event{
+	{Id: 1, When: 130, What: "deploy api", Tags: []string{"deploy", "api"}},
+	{Id: 2, When: 150, What: "deploy web", Tags: []string{"deploy", "web"}},
+	{Id: 3, When: 200, What: "outage", Tags: []string{"outage"}},
+	{Id: 4, When: 290, What: "deploy api", Tags: []string{"deploy", "api"}},
+}
+
+func testEventsGetter(gotTags *[]string) EventsGetter {
+	return func(from, to uint32, tags []string) []idx.Event {
+		*gotTags = tags
+		var res []idx.Event
+		for _, e := range testEvents {
+			if e.When >= int64(from) && e.When < int64(to) && e.HasTags(tags) {
+				res = append(res, e)
+			}
+		}
+		return res
+	}
+}
+
+func TestEvents(t *testing.T) {
+	cases := []struct {
+		tags    []string
+		expTags []string
+		out     []schema.Point
+		name    string
+	}{
+		{
+			tags:    []string{"*"},
+			expTags: nil,
+			name:    `events("*")`,
+			out: []schema.Point{
+				{Val: math.NaN(), Ts: 60},
+				{Val: 2, Ts: 120},
+				{Val: 1, Ts: 180},
+				{Val: 1, Ts: 240},
+			},
+		},
+		{
+			tags:    []string{"deploy", "api"},
+			expTags: []string{"deploy", "api"},
+			name:    `events("deploy", "api")`,
+			out: []schema.Point{
+				{Val: math.NaN(), Ts: 60},
+				{Val: 1, Ts: 120},
+				{Val: math.NaN(), Ts: 180},
+				{Val: 1, Ts: 240},
+			},
+		},
+		{
+			tags:    []string{"nonexistent"},
+			expTags: []string{"nonexistent"},
+			name:    `events("nonexistent")`,
+			out: []schema.Point{
+				{Val: math.NaN(), Ts: 60},
+				{Val: math.NaN(), Ts: 120},
+				{Val: math.NaN(), Ts: 180},
+				{Val: math.NaN(), Ts: 240},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		var gotTags []string
+		f := NewEvents()
+		f.(*FuncEvents).tags = c.tags
+		f.Context(Context{from: 100, to: 281, events: &eventSource{get: testEventsGetter(&gotTags)}})
+
+		got, err := f.Exec(make(DataMap))
+		exp := []models.Series{
+			{
+				Target:       c.name,
+				QueryPatt:    c.name,
+				Interval:     eventsStep,
+				QueryFrom:    100,
+				QueryTo:      281,
+				Consolidator: consolidation.Sum,
+				QueryCons:    consolidation.Sum,
+				Datapoints:   c.out,
+			},
+		}
+		if err := equalOutput(exp, got, nil, err); err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(gotTags, c.expTags) {
+			t.Fatalf("case %d: expected getter to be called with tags %v, got %v", i, c.expTags, gotTags)
+		}
+	}
+}
+
+func TestEventsPlanBinding(t *testing.T) {
+	exprs, err := ParseMany([]string{`events("deploy")`})
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	plan, err := NewPlan(exprs, 120, 240, 0, false, Optimizations{})
+	if err != nil {
+		t.Fatalf("failed to create plan: %s", err)
+	}
+	if len(plan.Reqs) != 0 {
+		t.Fatalf("expected events() to not need any data, got reqs %v", plan.Reqs)
+	}
+
+	// without bound events, we get an empty series
+	got, err := plan.Run(make(DataMap))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 1 || len(got[0].Datapoints) != 2 || !math.IsNaN(got[0].Datapoints[0].Val) || !math.IsNaN(got[0].Datapoints[1].Val) {
+		t.Fatalf("expected a single series with 2 null points, got %v", got)
+	}
+
+	var gotTags []string
+	plan.BindEvents(testEventsGetter(&gotTags))
+	got, err = plan.Run(make(DataMap))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	exp := []schema.Point{{Val: 2, Ts: 120}, {Val: math.NaN(), Ts: 180}}
+	expSeries := models.Series{
+		Target:       `events("deploy")`,
+		QueryPatt:    `events("deploy")`,
+		Interval:     eventsStep,
+		QueryFrom:    120,
+		QueryTo:      240,
+		Consolidator: consolidation.Sum,
+		QueryCons:    consolidation.Sum,
+		Datapoints:   exp,
+	}
+	if err := equalOutput([]models.Series{expSeries}, got, nil, err); err != nil {
+		t.Fatalf("%s", err)
+	}
+}
@@ -0,0 +1,114 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/errors"
+)
+
+type FuncLegendValue struct {
+	in         GraphiteFunc
+	valueTypes []string
+}
+
+func NewLegendValue() GraphiteFunc {
+	return &FuncLegendValue{}
+}
+
+func (s *FuncLegendValue) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgStrings{key: "valueTypes", opt: true, val: &s.valueTypes, validator: []Validator{IsConsolFuncOrUnitSystem}},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncLegendValue) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncLegendValue) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	// like graphite, a unit system may only be specified as the last value type
+	valueTypes := s.valueTypes
+	var system string
+	if len(valueTypes) > 0 && isUnitSystem(valueTypes[len(valueTypes)-1]) {
+		system = valueTypes[len(valueTypes)-1]
+		valueTypes = valueTypes[:len(valueTypes)-1]
+	}
+	for _, valueType := range valueTypes {
+		if isUnitSystem(valueType) {
+			return nil, errors.NewBadRequest("unit system must be the last value type, got " + valueType)
+		}
+	}
+
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		for _, valueType := range valueTypes {
+			value := consolidation.GetAggFunc(consolidation.FromConsolidateBy(valueType))(serie.Datapoints)
+			formatted := "None"
+			if !math.IsNaN(value) {
+				if system != "" {
+					v, prefix := formatUnits(value, system)
+					formatted = fmt.Sprintf("%.2f%s", v, prefix)
+				} else {
+					formatted = fmt.Sprintf("%.2f", value)
+				}
+			}
+			serie.Target = fmt.Sprintf("%-20s%-5s%-10s", serie.Target, valueType, formatted)
+		}
+		outputs = append(outputs, serie)
+	}
+	return outputs, nil
+}
+
+type unitPrefix struct {
+	prefix string
+	size   float64
+}
+
+// unitSystems lists the prefixes of each supported unit system, from largest to smallest
+var unitSystems = map[string][]unitPrefix{
+	"binary": {
+		{"Pi", 1 << 50},
+		{"Ti", 1 << 40},
+		{"Gi", 1 << 30},
+		{"Mi", 1 << 20},
+		{"Ki", 1 << 10},
+	},
+	"si": {
+		{"P", 1e15},
+		{"T", 1e12},
+		{"G", 1e9},
+		{"M", 1e6},
+		{"K", 1e3},
+	},
+}
+
+func isUnitSystem(s string) bool {
+	_, ok := unitSystems[s]
+	return ok
+}
+
+// formatUnits scales the value down by the largest prefix of the given unit system that fits it,
+// and returns the scaled value along with the prefix. it mimics graphite's format_units
+func formatUnits(v float64, system string) (float64, string) {
+	var prefix string
+	for _, u := range unitSystems[system] {
+		if math.Abs(v) >= u.size {
+			v = v / u.size
+			prefix = u.prefix
+			break
+		}
+	}
+	if v-math.Floor(v) < 0.00000000001 && v > 1 {
+		v = math.Floor(v)
+	}
+	return v, prefix
+}
@@ -0,0 +1,100 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestLegendValueSingle(t *testing.T) {
+	testLegendValue(
+		"single",
+		[]string{"avg"},
+		[]models.Series{
+			getSeriesNamed("foo", a),
+		},
+		[]models.Series{
+			getSeries("foo                 avg  308641973.88", "foo", a),
+		},
+		t,
+	)
+}
+
+func TestLegendValueMultipleTypesWithSystem(t *testing.T) {
+	testLegendValue(
+		"multiple-types-si",
+		[]string{"avg", "last", "si"},
+		[]models.Series{
+			getSeriesNamed("foo", a),
+		},
+		[]models.Series{
+			getSeries("foo                 avg  308.64M   last 1.23G     ", "foo", a),
+		},
+		t,
+	)
+}
+
+func TestLegendValueNoData(t *testing.T) {
+	testLegendValue(
+		"no-data",
+		[]string{"max"},
+		[]models.Series{
+			getSeriesNamed("foo", allNulls),
+		},
+		[]models.Series{
+			getSeries("foo                 max  None      ", "foo", allNulls),
+		},
+		t,
+	)
+}
+
+func testLegendValue(name string, valueTypes []string, in []models.Series, out []models.Series, t *testing.T) {
+	f := NewLegendValue()
+	f.(*FuncLegendValue).in = NewMock(in)
+	f.(*FuncLegendValue).valueTypes = valueTypes
+
+	inputCopy := models.SeriesCopy(in) // to later verify that it is unchanged
+
+	dataMap := initDataMap(in)
+
+	got, err := f.Exec(dataMap)
+	if err := equalOutput(out, got, nil, err); err != nil {
+		t.Fatalf("Case %s: %s", name, err)
+	}
+
+	t.Run("DidNotModifyInput", func(t *testing.T) {
+		if err := equalOutput(inputCopy, in, nil, nil); err != nil {
+			t.Fatalf("Case %s: Input was modified, err = %s", name, err)
+		}
+	})
+
+	t.Run("DoesNotDoubleReturnPoints", func(t *testing.T) {
+		if err := dataMap.CheckForOverlappingPoints(); err != nil {
+			t.Fatalf("Case %s: Point slices in datamap overlap, err = %s", name, err)
+		}
+	})
+}
+
+func TestFormatUnits(t *testing.T) {
+	cases := []struct {
+		in     float64
+		system string
+		val    float64
+		prefix string
+	}{
+		{0, "si", 0, ""},
+		{999, "si", 999, ""},
+		{1000, "si", 1, "K"},
+		{1500000, "si", 1.5, "M"},
+		{-2000, "si", -2, "K"},
+		{1024, "binary", 1, "Ki"},
+		{1000, "binary", 1000, ""},
+		{3 * 1024 * 1024 * 1024, "binary", 3, "Gi"},
+	}
+	for _, c := range cases {
+		val, prefix := formatUnits(c.in, c.system)
+		if val != c.val || prefix != c.prefix {
+			t.Errorf("formatUnits(%f, %q): expected %f %q, got %f %q", c.in, c.system, c.val, c.prefix, val, prefix)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package expr
+
+import (
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncLineWidth struct {
+	in    GraphiteFunc
+	width float64
+}
+
+func NewLineWidth() GraphiteFunc {
+	return &FuncLineWidth{}
+}
+
+func (s *FuncLineWidth) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgFloat{key: "width", val: &s.width, validator: []Validator{IsLineWidth}},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncLineWidth) Context(context Context) Context {
+	return context
+}
+
+func (s *FuncLineWidth) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		serie.Style.LineWidth = s.width
+		outputs = append(outputs, serie)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,49 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+func TestLineWidth(t *testing.T) {
+	in := []models.Series{
+		getSeriesNamed("foo", a),
+		getSeriesNamed("bar", b),
+	}
+	exp := models.SeriesCopy(in)
+	for i := range exp {
+		exp[i].Style.LineWidth = 2.5
+	}
+
+	f := NewLineWidth()
+	f.(*FuncLineWidth).in = NewMock(in)
+	f.(*FuncLineWidth).width = 2.5
+
+	inputCopy := models.SeriesCopy(in)
+	got, err := f.Exec(initDataMap(in))
+	if err := equalOutput(exp, got, nil, err); err != nil {
+		t.Fatal(err)
+	}
+	if err := equalOutput(inputCopy, in, nil, nil); err != nil {
+		t.Fatalf("Input was modified, err = %s", err)
+	}
+}
+
+func TestLineWidthInvalid(t *testing.T) {
+	for _, target := range []string{
+		"lineWidth(foo, 0)",
+		"lineWidth(foo, -1)",
+		"lineWidth(foo, 1e9)",
+	} {
+		exprs, err := ParseMany([]string{target})
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", target, err)
+		}
+		_, err = NewPlan(exprs, 0, 3600, 800, true, Optimizations{})
+		if err == nil || !strings.Contains(err.Error(), ErrLineWidth.Error()) {
+			t.Fatalf("%s: expected error %q, got %v", target, ErrLineWidth, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/batch"
+	"github.com/grafana/metrictank/schema"
+)
+
+type FuncSeasonalBands struct {
+	in GraphiteFunc
+	seasonal
+	delta float64
+}
+
+func NewSeasonalBands() GraphiteFunc {
+	return &FuncSeasonalBands{seasonal: seasonal{season: "1w", seasons: 4}, delta: 3}
+}
+
+func (s *FuncSeasonalBands) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "season", opt: true, val: &s.season, validator: []Validator{IsPositiveIntervalString}},
+		ArgInt{key: "seasons", opt: true, val: &s.seasons, validator: []Validator{IntPositive}},
+		ArgFloat{key: "delta", opt: true, val: &s.delta},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncSeasonalBands) Context(context Context) Context {
+	return s.context(context)
+}
+
+// Exec returns, for every input series, an upper and a lower band which lie
+// delta standard deviations above and below the mean of the values at the same
+// time of the previous seasons.
+func (s *FuncSeasonalBands) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var hist []schema.Point
+	outputs := make([]models.Series, 0, 2*len(series))
+	for _, serie := range series {
+		start, from := s.outputStart(serie)
+		numPoints := seasonPoints(s.seasonSecs, serie.Interval)
+
+		upper := pointSlicePool.GetMin(len(serie.Datapoints) - start)
+		lower := pointSlicePool.GetMin(len(serie.Datapoints) - start)
+		for i := start; i < len(serie.Datapoints); i++ {
+			ts := serie.Datapoints[i].Ts
+			hist = history(serie.Datapoints, i, numPoints, int(s.seasons), hist)
+			if len(hist) < 2 {
+				upper = append(upper, schema.Point{Val: math.NaN(), Ts: ts})
+				lower = append(lower, schema.Point{Val: math.NaN(), Ts: ts})
+				continue
+			}
+			avg := batch.Avg(hist)
+			stdDev := batch.StdDev(hist)
+			upper = append(upper, schema.Point{Val: avg + s.delta*stdDev, Ts: ts})
+			lower = append(lower, schema.Point{Val: avg - s.delta*stdDev, Ts: ts})
+		}
+
+		for _, band := range []struct {
+			name   string
+			points []schema.Point
+		}{
+			{"seasonalUpperBand", upper},
+			{"seasonalLowerBand", lower},
+		} {
+			output := serie
+			output.Target = fmt.Sprintf("%s(%s)", band.name, serie.Target)
+			output.QueryPatt = fmt.Sprintf("%s(%s)", band.name, serie.QueryPatt)
+			output.Tags = serie.CopyTagsWith(band.name, s.season)
+			output.QueryFrom = from
+			output.Datapoints = band.points
+			outputs = append(outputs, output)
+		}
+	}
+
+	dataMap.Add(Req{}, outputs...)
+	return outputs, nil
+}
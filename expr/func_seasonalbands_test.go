@@ -0,0 +1,51 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+func TestSeasonalBands(t *testing.T) {
+	in := getTimeRangeSeriesListNamed("a", "a", 10, 10, 100, seasonalInput)
+	out := append(
+		getTimeRangeSeriesListNamed("seasonalUpperBand(a)", "seasonalUpperBand(a)", 10, 70, 100, []schema.Point{
+			{Val: 4, Ts: 70},
+			{Val: 5, Ts: 80},
+			{Val: 6, Ts: 90},
+		}),
+		getTimeRangeSeriesListNamed("seasonalLowerBand(a)", "seasonalLowerBand(a)", 10, 70, 100, []schema.Point{
+			{Val: 0, Ts: 70},
+			{Val: 1, Ts: 80},
+			{Val: 2, Ts: 90},
+		})...,
+	)
+
+	f := NewSeasonalBands()
+	f.(*FuncSeasonalBands).in = NewMock(in)
+	f.(*FuncSeasonalBands).season = "30s"
+	f.(*FuncSeasonalBands).seasons = 2
+	f.(*FuncSeasonalBands).delta = 2
+	f.Context(Context{from: 70, to: 100})
+
+	inputCopy := models.SeriesCopy(in) // to later verify that it is unchanged
+	dataMap := initDataMapMultiple([][]models.Series{in})
+
+	got, err := f.Exec(dataMap)
+	if err := equalOutput(out, got, nil, err); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("DidNotModifyInput", func(t *testing.T) {
+		if err := equalOutput(in, inputCopy, nil, nil); err != nil {
+			t.Fatalf("Input was modified, err = %s", err)
+		}
+	})
+
+	t.Run("DoesNotDoubleReturnPoints", func(t *testing.T) {
+		if err := dataMap.CheckForOverlappingPoints(); err != nil {
+			t.Fatalf("Point slices in datamap overlap, err = %s", err)
+		}
+	})
+}
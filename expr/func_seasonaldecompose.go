@@ -0,0 +1,172 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+type FuncSeasonalDecompose struct {
+	in GraphiteFunc
+	seasonal
+	component string
+}
+
+func NewSeasonalDecompose() GraphiteFunc {
+	return &FuncSeasonalDecompose{seasonal: seasonal{season: "1d", seasons: 7}, component: "residual"}
+}
+
+func (s *FuncSeasonalDecompose) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "season", opt: true, val: &s.season, validator: []Validator{IsPositiveIntervalString}},
+		ArgInt{key: "seasons", opt: true, val: &s.seasons, validator: []Validator{IntPositive}},
+		ArgString{key: "component", opt: true, val: &s.component, validator: []Validator{IsSeasonalComponent}},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncSeasonalDecompose) Context(context Context) Context {
+	return s.context(context)
+}
+
+// Exec decomposes each series into a trend, a seasonal and a residual component
+// and returns the requested component.
+// This is a classical additive decomposition, which is a simpler variant of STL.
+// The trend is a moving average over one season, centered on each point.
+// The seasonal component is the average of the detrended values at the same phase of each season,
+// normalized to have a mean of zero.
+// The residual is what remains after subtracting trend and seasonal component.
+func (s *FuncSeasonalDecompose) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	formatStr := fmt.Sprintf("seasonalDecompose(%%s,\"%s\",%d,\"%s\")", s.season, s.seasons, s.component)
+	newName := func(oldName string) string {
+		return fmt.Sprintf(formatStr, oldName)
+	}
+
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		start, from := s.outputStart(serie)
+		numPoints := seasonPoints(s.seasonSecs, serie.Interval)
+
+		trend := seasonalTrend(serie.Datapoints, numPoints)
+		seasonals := seasonalComponent(serie.Datapoints, trend, numPoints, serie.Interval)
+
+		out := pointSlicePool.GetMin(len(serie.Datapoints) - start)
+		for i := start; i < len(serie.Datapoints); i++ {
+			p := serie.Datapoints[i]
+			val := math.NaN()
+			switch s.component {
+			case "trend":
+				val = trend[i]
+			case "seasonal":
+				if len(seasonals) > 0 {
+					val = seasonals[seasonalPhase(p.Ts, serie.Interval, numPoints)]
+				}
+			case "residual":
+				if len(seasonals) > 0 {
+					val = p.Val - trend[i] - seasonals[seasonalPhase(p.Ts, serie.Interval, numPoints)]
+				}
+			}
+			out = append(out, schema.Point{Val: val, Ts: p.Ts})
+		}
+
+		serie.Target = newName(serie.Target)
+		serie.QueryPatt = newName(serie.QueryPatt)
+		serie.Tags = serie.CopyTagsWith("seasonalDecompose", s.component)
+		serie.QueryFrom = from
+		serie.Datapoints = out
+
+		outputs = append(outputs, serie)
+	}
+
+	dataMap.Add(Req{}, outputs...)
+	return outputs, nil
+}
+
+// seasonalPhase returns the position of the given timestamp within its season
+func seasonalPhase(ts, interval uint32, seasonPoints int) int {
+	return int(ts/interval) % seasonPoints
+}
+
+// seasonalTrend returns, for each point, the average of the non-null values within
+// the season-long window centered on it. near the edges the window is truncated.
+func seasonalTrend(points []schema.Point, seasonPoints int) []float64 {
+	trend := make([]float64, len(points))
+	if seasonPoints < 1 {
+		seasonPoints = 1
+	}
+
+	// cumulative sums and counts of the non-null values, so we can compute each window in constant time
+	sums := make([]float64, len(points)+1)
+	counts := make([]int, len(points)+1)
+	for i, p := range points {
+		sums[i+1] = sums[i]
+		counts[i+1] = counts[i]
+		if !math.IsNaN(p.Val) {
+			sums[i+1] += p.Val
+			counts[i+1]++
+		}
+	}
+
+	for i := range points {
+		lo := i - seasonPoints/2
+		hi := lo + seasonPoints
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(points) {
+			hi = len(points)
+		}
+		if cnt := counts[hi] - counts[lo]; cnt > 0 {
+			trend[i] = (sums[hi] - sums[lo]) / float64(cnt)
+		} else {
+			trend[i] = math.NaN()
+		}
+	}
+	return trend
+}
+
+// seasonalComponent returns, for each phase of a season, the average of the detrended values
+// at that phase, normalized such that the components add up to zero.
+// it returns nil if the season does not consist of at least 2 points.
+func seasonalComponent(points []schema.Point, trend []float64, seasonPoints int, interval uint32) []float64 {
+	if seasonPoints < 2 {
+		return nil
+	}
+	sums := make([]float64, seasonPoints)
+	counts := make([]int, seasonPoints)
+	for i, p := range points {
+		detrended := p.Val - trend[i]
+		if math.IsNaN(detrended) {
+			continue
+		}
+		phase := seasonalPhase(p.Ts, interval, seasonPoints)
+		sums[phase] += detrended
+		counts[phase]++
+	}
+
+	var total float64
+	var valid int
+	for phase := range sums {
+		if counts[phase] == 0 {
+			sums[phase] = math.NaN()
+			continue
+		}
+		sums[phase] /= float64(counts[phase])
+		total += sums[phase]
+		valid++
+	}
+	if valid > 0 {
+		mean := total / float64(valid)
+		for phase := range sums {
+			sums[phase] -= mean
+		}
+	}
+	return sums
+}
@@ -0,0 +1,101 @@
+package expr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+// a series with a season of 3 points (30s), starting 2 seasons before the requested range [90,120)
+var seasonalPattern = []schema.Point{
+	{Val: 1, Ts: 30},
+	{Val: 2, Ts: 40},
+	{Val: 3, Ts: 50},
+	{Val: 1, Ts: 60},
+	{Val: 2, Ts: 70},
+	{Val: 3, Ts: 80},
+	{Val: 1, Ts: 90},
+	{Val: 2, Ts: 100},
+	{Val: 3, Ts: 110},
+}
+
+var constantPattern = []schema.Point{
+	{Val: 5, Ts: 30},
+	{Val: 5, Ts: 40},
+	{Val: 5, Ts: 50},
+	{Val: 5, Ts: 60},
+	{Val: 5, Ts: 70},
+	{Val: 5, Ts: 80},
+	{Val: 5, Ts: 90},
+	{Val: 5, Ts: 100},
+	{Val: 5, Ts: 110},
+}
+
+func TestSeasonalDecompose(t *testing.T) {
+	cases := []struct {
+		component string
+		in        []schema.Point
+		exp       []schema.Point
+	}{
+		{
+			component: "trend",
+			in:        seasonalPattern,
+			// the last window is truncated at the end of the series
+			exp: []schema.Point{{Val: 2, Ts: 90}, {Val: 2, Ts: 100}, {Val: 2.5, Ts: 110}},
+		},
+		{
+			component: "seasonal",
+			in:        seasonalPattern,
+			exp:       []schema.Point{{Val: -2.5 / 3, Ts: 90}, {Val: 0, Ts: 100}, {Val: 2.5 / 3, Ts: 110}},
+		},
+		{
+			component: "residual",
+			in:        seasonalPattern,
+			exp:       []schema.Point{{Val: -1 + 2.5/3, Ts: 90}, {Val: 0, Ts: 100}, {Val: 0.5 - 2.5/3, Ts: 110}},
+		},
+		{
+			component: "trend",
+			in:        constantPattern,
+			exp:       []schema.Point{{Val: 5, Ts: 90}, {Val: 5, Ts: 100}, {Val: 5, Ts: 110}},
+		},
+		{
+			component: "seasonal",
+			in:        constantPattern,
+			exp:       []schema.Point{{Val: 0, Ts: 90}, {Val: 0, Ts: 100}, {Val: 0, Ts: 110}},
+		},
+		{
+			component: "residual",
+			in:        constantPattern,
+			exp:       []schema.Point{{Val: 0, Ts: 90}, {Val: 0, Ts: 100}, {Val: 0, Ts: 110}},
+		},
+	}
+
+	for i, c := range cases {
+		name := fmt.Sprintf("seasonalDecompose(a,\"30s\",2,\"%s\")", c.component)
+		in := getTimeRangeSeriesListNamed("a", "a", 10, 30, 120, c.in)
+		out := getTimeRangeSeriesListNamed(name, name, 10, 90, 120, c.exp)
+
+		f := NewSeasonalDecompose()
+		f.(*FuncSeasonalDecompose).in = NewMock(in)
+		f.(*FuncSeasonalDecompose).season = "30s"
+		f.(*FuncSeasonalDecompose).seasons = 2
+		f.(*FuncSeasonalDecompose).component = c.component
+		f.Context(Context{from: 90, to: 120})
+
+		inputCopy := models.SeriesCopy(in) // to later verify that it is unchanged
+		dataMap := initDataMapMultiple([][]models.Series{in})
+
+		got, err := f.Exec(dataMap)
+		if err := equalOutput(out, got, nil, err); err != nil {
+			t.Fatalf("case %d (%s): %s", i, c.component, err)
+		}
+		if err := equalOutput(in, inputCopy, nil, nil); err != nil {
+			t.Fatalf("case %d (%s): Input was modified, err = %s", i, c.component, err)
+		}
+		if err := dataMap.CheckForOverlappingPoints(); err != nil {
+			t.Fatalf("case %d (%s): Point slices in datamap overlap, err = %s", i, c.component, err)
+		}
+	}
+}
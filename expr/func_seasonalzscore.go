@@ -0,0 +1,76 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/batch"
+	"github.com/grafana/metrictank/schema"
+)
+
+type FuncSeasonalZScore struct {
+	in GraphiteFunc
+	seasonal
+}
+
+func NewSeasonalZScore() GraphiteFunc {
+	return &FuncSeasonalZScore{seasonal: seasonal{season: "1w", seasons: 4}}
+}
+
+func (s *FuncSeasonalZScore) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "season", opt: true, val: &s.season, validator: []Validator{IsPositiveIntervalString}},
+		ArgInt{key: "seasons", opt: true, val: &s.seasons, validator: []Validator{IntPositive}},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncSeasonalZScore) Context(context Context) Context {
+	return s.context(context)
+}
+
+// Exec returns, for every point, how many standard deviations it lies away from the mean
+// of the values at the same time of the previous seasons.
+func (s *FuncSeasonalZScore) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	formatStr := fmt.Sprintf("seasonalZScore(%%s,\"%s\",%d)", s.season, s.seasons)
+	newName := func(oldName string) string {
+		return fmt.Sprintf(formatStr, oldName)
+	}
+
+	var hist []schema.Point
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		start, from := s.outputStart(serie)
+		numPoints := seasonPoints(s.seasonSecs, serie.Interval)
+
+		out := pointSlicePool.GetMin(len(serie.Datapoints) - start)
+		for i := start; i < len(serie.Datapoints); i++ {
+			p := serie.Datapoints[i]
+			hist = history(serie.Datapoints, i, numPoints, int(s.seasons), hist)
+			score := math.NaN()
+			if len(hist) > 1 && !math.IsNaN(p.Val) {
+				if stdDev := batch.StdDev(hist); stdDev != 0 {
+					score = (p.Val - batch.Avg(hist)) / stdDev
+				}
+			}
+			out = append(out, schema.Point{Val: score, Ts: p.Ts})
+		}
+
+		serie.Target = newName(serie.Target)
+		serie.QueryPatt = newName(serie.QueryPatt)
+		serie.Tags = serie.CopyTagsWith("seasonalZScore", s.season)
+		serie.QueryFrom = from
+		serie.Datapoints = out
+
+		outputs = append(outputs, serie)
+	}
+
+	dataMap.Add(Req{}, outputs...)
+	return outputs, nil
+}
@@ -0,0 +1,120 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+// a series with a season of 3 points (30s), starting 2 seasons before the requested range [70,100)
+var seasonalInput = []schema.Point{
+	{Val: 1, Ts: 10},
+	{Val: 2, Ts: 20},
+	{Val: 3, Ts: 30},
+	{Val: 3, Ts: 40},
+	{Val: 4, Ts: 50},
+	{Val: 5, Ts: 60},
+	{Val: 5, Ts: 70},
+	{Val: 100, Ts: 80},
+	{Val: 7, Ts: 90},
+}
+
+func TestSeasonalZScore(t *testing.T) {
+	testSeasonalZScore(
+		"basic",
+		getTimeRangeSeriesListNamed("a", "a", 10, 10, 100, seasonalInput),
+		getTimeRangeSeriesListNamed("seasonalZScore(a,\"30s\",2)", "seasonalZScore(a,\"30s\",2)", 10, 70, 100, []schema.Point{
+			{Val: 3, Ts: 70},
+			{Val: 97, Ts: 80},
+			{Val: 3, Ts: 90},
+		}),
+		"30s",
+		2,
+		t)
+}
+
+func TestSeasonalZScoreNotEnoughHistory(t *testing.T) {
+	// a single previous season is not enough to compute a standard deviation
+	testSeasonalZScore(
+		"one season",
+		getTimeRangeSeriesListNamed("a", "a", 10, 40, 100, seasonalInput[3:]),
+		getTimeRangeSeriesListNamed("seasonalZScore(a,\"30s\",1)", "seasonalZScore(a,\"30s\",1)", 10, 70, 100, []schema.Point{
+			{Val: math.NaN(), Ts: 70},
+			{Val: math.NaN(), Ts: 80},
+			{Val: math.NaN(), Ts: 90},
+		}),
+		"30s",
+		1,
+		t)
+}
+
+func testSeasonalZScore(name string, in []models.Series, out []models.Series, season string, seasons int64, t *testing.T) {
+	f := NewSeasonalZScore()
+	f.(*FuncSeasonalZScore).in = NewMock(in)
+	f.(*FuncSeasonalZScore).season = season
+	f.(*FuncSeasonalZScore).seasons = seasons
+
+	// in all our cases, the requested range starts at 70 and the output should only cover that range
+	f.Context(Context{from: 70, to: 100})
+
+	inputCopy := models.SeriesCopy(in) // to later verify that it is unchanged
+	dataMap := initDataMapMultiple([][]models.Series{in})
+
+	got, err := f.Exec(dataMap)
+	if err := equalOutput(out, got, nil, err); err != nil {
+		t.Fatalf("Case %s: %s", name, err)
+	}
+	for i := range got {
+		if got[i].QueryFrom != out[i].QueryFrom {
+			t.Fatalf("Case %s: expected QueryFrom %d, got %d", name, out[i].QueryFrom, got[i].QueryFrom)
+		}
+	}
+
+	t.Run("DidNotModifyInput", func(t *testing.T) {
+		if err := equalOutput(in, inputCopy, nil, nil); err != nil {
+			t.Fatalf("Case %s: Input was modified, err = %s", name, err)
+		}
+	})
+
+	t.Run("DoesNotDoubleReturnPoints", func(t *testing.T) {
+		if err := dataMap.CheckForOverlappingPoints(); err != nil {
+			t.Fatalf("Case %s: Point slices in datamap overlap, err = %s", name, err)
+		}
+	})
+}
+
+func TestSeasonalContext(t *testing.T) {
+	s := seasonal{season: "1w", seasons: 4}
+	ctx := s.context(Context{from: 10 * 7 * 86400, to: 11 * 7 * 86400})
+	if ctx.from != 6*7*86400 {
+		t.Fatalf("expected context to be extended by 4 weeks, got from %d", ctx.from)
+	}
+
+	// we can't go back further than the epoch
+	s = seasonal{season: "1w", seasons: 4}
+	ctx = s.context(Context{from: 86400, to: 2 * 86400})
+	if ctx.from != 0 || s.offset != 86400 {
+		t.Fatalf("expected context to be extended to 0, got from %d and offset %d", ctx.from, s.offset)
+	}
+}
+
+func TestSeasonPoints(t *testing.T) {
+	cases := []struct {
+		seasonSecs, interval uint32
+		exp                  int
+	}{
+		{604800, 60, 10080},
+		{604800, 3600, 168},
+		// not a multiple: rounds to the nearest number of points
+		{100, 30, 3},
+		{110, 30, 4},
+		{100, 0, 0},
+	}
+	for _, c := range cases {
+		if got := seasonPoints(c.seasonSecs, c.interval); got != c.exp {
+			t.Fatalf("seasonPoints(%d, %d): expected %d, got %d", c.seasonSecs, c.interval, c.exp, got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+type FuncStacked struct {
+	in    GraphiteFunc
+	stack string
+}
+
+func NewStacked() GraphiteFunc {
+	return &FuncStacked{stack: "__DEFAULT__"}
+}
+
+func (s *FuncStacked) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgSeriesList{val: &s.in},
+		ArgString{key: "stack", opt: true, val: &s.stack},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncStacked) Context(context Context) Context {
+	return context
+}
+
+// Exec stacks each series on top of the ones before it, by replacing each value with the running total
+// of the values at the same position. nulls are retained as-is and do not affect the total.
+// note: unlike graphite, totals are not shared between multiple stacked() calls of the same stack name.
+func (s *FuncStacked) Exec(dataMap DataMap) ([]models.Series, error) {
+	series, err := s.in.Exec(dataMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalStack []float64
+	outputs := make([]models.Series, 0, len(series))
+	for _, serie := range series {
+		out := pointSlicePool.Get()
+		for i, p := range serie.Datapoints {
+			if len(totalStack) <= i {
+				totalStack = append(totalStack, 0)
+			}
+			if math.IsNaN(p.Val) {
+				out = append(out, p)
+				continue
+			}
+			totalStack[i] += p.Val
+			out = append(out, schema.Point{Val: totalStack[i], Ts: p.Ts})
+		}
+
+		// like graphite, named stacks keep the name of the series
+		if s.stack == "__DEFAULT__" {
+			serie.Target = fmt.Sprintf("stacked(%s)", serie.Target)
+			serie.QueryPatt = fmt.Sprintf("stacked(%s)", serie.QueryPatt)
+		}
+		serie.Style.Stacked = true
+		serie.Datapoints = out
+		outputs = append(outputs, serie)
+	}
+	dataMap.Add(Req{}, outputs...)
+	return outputs, nil
+}
@@ -0,0 +1,92 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+var stackA = []schema.Point{
+	{Val: 1, Ts: 10},
+	{Val: math.NaN(), Ts: 20},
+	{Val: 3, Ts: 30},
+}
+
+var stackB = []schema.Point{
+	{Val: 10, Ts: 10},
+	{Val: 20, Ts: 20},
+	{Val: math.NaN(), Ts: 30},
+}
+
+var stackC = []schema.Point{
+	{Val: 100, Ts: 10},
+	{Val: 200, Ts: 20},
+	{Val: 300, Ts: 30},
+}
+
+func TestStackedDefault(t *testing.T) {
+	testStacked(
+		"default",
+		"__DEFAULT__",
+		[]models.Series{
+			getSeriesNamed("a", stackA),
+			getSeriesNamed("b", stackB),
+			getSeriesNamed("c", stackC),
+		},
+		[]models.Series{
+			getStackedSeries("stacked(a)", stackA),
+			getStackedSeries("stacked(b)", []schema.Point{{Val: 11, Ts: 10}, {Val: 20, Ts: 20}, {Val: math.NaN(), Ts: 30}}),
+			getStackedSeries("stacked(c)", []schema.Point{{Val: 111, Ts: 10}, {Val: 220, Ts: 20}, {Val: 303, Ts: 30}}),
+		},
+		t,
+	)
+}
+
+func TestStackedNamed(t *testing.T) {
+	testStacked(
+		"named",
+		"foo",
+		[]models.Series{
+			getSeriesNamed("a", stackA),
+		},
+		[]models.Series{
+			getStackedSeries("a", stackA),
+		},
+		t,
+	)
+}
+
+func getStackedSeries(name string, data []schema.Point) models.Series {
+	s := getSeriesNamed(name, data)
+	s.Style.Stacked = true
+	return s
+}
+
+func testStacked(name, stack string, in []models.Series, out []models.Series, t *testing.T) {
+	f := NewStacked()
+	f.(*FuncStacked).in = NewMock(in)
+	f.(*FuncStacked).stack = stack
+
+	inputCopy := models.SeriesCopy(in) // to later verify that it is unchanged
+
+	dataMap := initDataMap(in)
+
+	got, err := f.Exec(dataMap)
+	if err := equalOutput(out, got, nil, err); err != nil {
+		t.Fatalf("Case %s: %s", name, err)
+	}
+
+	t.Run("DidNotModifyInput", func(t *testing.T) {
+		if err := equalOutput(inputCopy, in, nil, nil); err != nil {
+			t.Fatalf("Case %s: Input was modified, err = %s", name, err)
+		}
+	})
+
+	t.Run("DoesNotDoubleReturnPoints", func(t *testing.T) {
+		if err := dataMap.CheckForOverlappingPoints(); err != nil {
+			t.Fatalf("Case %s: Point slices in datamap overlap, err = %s", name, err)
+		}
+	})
+}
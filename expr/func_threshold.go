@@ -0,0 +1,53 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/grafana/metrictank/api/models"
+)
+
+type FuncThreshold struct {
+	value float64
+	label string
+	color string
+	first uint32
+	last  uint32
+}
+
+func NewThreshold() GraphiteFunc {
+	return &FuncThreshold{}
+}
+
+func (s *FuncThreshold) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgFloat{key: "value", val: &s.value},
+		ArgString{key: "label", opt: true, val: &s.label},
+		ArgString{key: "color", opt: true, val: &s.color},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncThreshold) Context(context Context) Context {
+	// like constantLine, from and to are both inclusive
+	s.first = context.from - 1
+	s.last = context.to - 1
+	return context
+}
+
+func (s *FuncThreshold) Exec(dataMap DataMap) ([]models.Series, error) {
+	name := s.label
+	if name == "" {
+		name = fmt.Sprintf("%.6g", s.value)
+	}
+
+	outputs := make([]models.Series, 1)
+	outputs[0] = models.Series{
+		Target:     name,
+		QueryPatt:  name,
+		Style:      models.SeriesStyle{Color: s.color},
+		Datapoints: constantLinePoints(s.value, s.first, s.last),
+	}
+	outputs[0].SetTags()
+
+	dataMap.Add(Req{}, outputs...)
+	return outputs, nil
+}
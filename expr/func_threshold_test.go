@@ -0,0 +1,57 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+)
+
+func TestThreshold(t *testing.T) {
+	cases := []struct {
+		value float64
+		label string
+		color string
+		out   models.Series
+	}{
+		{
+			value: 1.5,
+			out: models.Series{
+				Target:     "1.5",
+				QueryPatt:  "1.5",
+				Datapoints: []schema.Point{{Val: 1.5, Ts: 9}, {Val: 1.5, Ts: 34}, {Val: 1.5, Ts: 60}},
+			},
+		},
+		{
+			value: 2.0 / 3,
+			out: models.Series{
+				Target:     "0.666667",
+				QueryPatt:  "0.666667",
+				Datapoints: []schema.Point{{Val: 2.0 / 3, Ts: 9}, {Val: 2.0 / 3, Ts: 34}, {Val: 2.0 / 3, Ts: 60}},
+			},
+		},
+		{
+			value: 1.5,
+			label: "max",
+			color: "red",
+			out: models.Series{
+				Target:     "max",
+				QueryPatt:  "max",
+				Style:      models.SeriesStyle{Color: "red"},
+				Datapoints: []schema.Point{{Val: 1.5, Ts: 9}, {Val: 1.5, Ts: 34}, {Val: 1.5, Ts: 60}},
+			},
+		},
+	}
+	for i, c := range cases {
+		f := NewThreshold()
+		f.(*FuncThreshold).value = c.value
+		f.(*FuncThreshold).label = c.label
+		f.(*FuncThreshold).color = c.color
+		f.Context(Context{from: 10, to: 61})
+
+		got, err := f.Exec(make(DataMap))
+		if err := equalOutput([]models.Series{c.out}, got, nil, err); err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+	}
+}
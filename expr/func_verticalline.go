@@ -0,0 +1,89 @@
+package expr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/errors"
+	"github.com/grafana/metrictank/schema"
+	"github.com/raintank/dur"
+)
+
+// locationSource allows the functions of a plan to get the timezone of the request,
+// which is only known to the caller after the plan has been created.
+type locationSource struct {
+	loc *time.Location
+}
+
+type FuncVerticalLine struct {
+	ts     string
+	label  string
+	color  string
+	from   uint32
+	to     uint32
+	source *locationSource
+}
+
+func NewVerticalLine() GraphiteFunc {
+	return &FuncVerticalLine{}
+}
+
+func (s *FuncVerticalLine) Signature() ([]Arg, []Arg) {
+	return []Arg{
+		ArgString{key: "ts", val: &s.ts},
+		ArgString{key: "label", opt: true, val: &s.label},
+		ArgString{key: "color", opt: true, val: &s.color},
+	}, []Arg{ArgSeriesList{}}
+}
+
+func (s *FuncVerticalLine) Context(context Context) Context {
+	s.from = context.from
+	s.to = context.to
+	s.source = context.location
+	return context
+}
+
+func (s *FuncVerticalLine) Exec(dataMap DataMap) ([]models.Series, error) {
+	// like the from/to of the request, the timestamp is interpreted in the timezone of the request
+	loc := time.Local
+	if s.source != nil && s.source.loc != nil {
+		loc = s.source.loc
+	}
+	ts, err := dur.ParseDateTime(s.ts, loc, time.Now(), 0)
+	if err != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("verticalLine(): could not parse timestamp %q: %s", s.ts, err.Error()))
+	}
+	if ts < s.from {
+		return nil, errors.NewBadRequest(fmt.Sprintf("verticalLine(): timestamp %d exists before start of range", ts))
+	}
+	if ts > s.to {
+		return nil, errors.NewBadRequest(fmt.Sprintf("verticalLine(): timestamp %d exists after end of range", ts))
+	}
+
+	name := s.label
+	if name == "" {
+		name = s.ts
+	}
+
+	out := pointSlicePool.Get()
+	out = append(out, schema.Point{Val: 1, Ts: ts}, schema.Point{Val: 1, Ts: ts + 1})
+
+	outputs := make([]models.Series, 1)
+	outputs[0] = models.Series{
+		Target:    name,
+		QueryPatt: name,
+		Interval:  1,
+		QueryFrom: s.from,
+		QueryTo:   s.to,
+		Style: models.SeriesStyle{
+			Color:          s.color,
+			DrawAsInfinite: true,
+		},
+		Datapoints: out,
+	}
+	outputs[0].SetTags()
+
+	dataMap.Add(Req{}, outputs...)
+	return outputs, nil
+}
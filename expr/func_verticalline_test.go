@@ -0,0 +1,88 @@
+package expr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/errors"
+	"github.com/grafana/metrictank/schema"
+)
+
+func TestVerticalLine(t *testing.T) {
+	cases := []struct {
+		ts     string
+		label  string
+		color  string
+		out    []models.Series
+		expErr error
+	}{
+		{
+			ts: "1000",
+			out: []models.Series{
+				{
+					Target:     "1000",
+					QueryPatt:  "1000",
+					Interval:   1,
+					QueryFrom:  500,
+					QueryTo:    1500,
+					Style:      models.SeriesStyle{DrawAsInfinite: true},
+					Datapoints: []schema.Point{{Val: 1, Ts: 1000}, {Val: 1, Ts: 1001}},
+				},
+			},
+		},
+		{
+			ts:    "1200",
+			label: "deploy",
+			color: "blue",
+			out: []models.Series{
+				{
+					Target:     "deploy",
+					QueryPatt:  "deploy",
+					Interval:   1,
+					QueryFrom:  500,
+					QueryTo:    1500,
+					Style:      models.SeriesStyle{Color: "blue", DrawAsInfinite: true},
+					Datapoints: []schema.Point{{Val: 1, Ts: 1200}, {Val: 1, Ts: 1201}},
+				},
+			},
+		},
+		{
+			ts:     "100",
+			expErr: errors.NewBadRequest("verticalLine(): timestamp 100 exists before start of range"),
+		},
+		{
+			ts:     "2000",
+			expErr: errors.NewBadRequest("verticalLine(): timestamp 2000 exists after end of range"),
+		},
+	}
+	for i, c := range cases {
+		f := NewVerticalLine()
+		f.(*FuncVerticalLine).ts = c.ts
+		f.(*FuncVerticalLine).label = c.label
+		f.(*FuncVerticalLine).color = c.color
+		f.Context(Context{from: 500, to: 1500})
+
+		got, err := f.Exec(make(DataMap))
+		if err := equalOutput(c.out, got, c.expErr, err); err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+	}
+}
+
+func TestVerticalLineLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+1", 3600)
+	ts := uint32(time.Date(2020, 1, 2, 3, 4, 0, 0, loc).Unix())
+
+	f := NewVerticalLine()
+	f.(*FuncVerticalLine).ts = "03:04_20200102"
+	f.Context(Context{from: ts - 100, to: ts + 100, location: &locationSource{loc: loc}})
+
+	got, err := f.Exec(make(DataMap))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got[0].Datapoints[0].Ts != ts {
+		t.Fatalf("expected timestamp %d, got %d", ts, got[0].Datapoints[0].Ts)
+	}
+}
@@ -13,6 +13,8 @@ type Context struct {
 	PNGroup       models.PNGroup             // pre-normalization group. if the data can be safely pre-normalized
 	MDP           uint32                     // if we can MDP-optimize, reflects runtime consolidation MaxDataPoints. 0 otherwise
 	optimizations Optimizations
+	events        *eventSource    // shared by all contexts of a plan, see Plan.BindEvents
+	location      *locationSource // shared by all contexts of a plan, see Plan.BindLocation
 }
 
 // GraphiteFunc defines a graphite processing function
@@ -54,28 +56,34 @@ func init() {
 	funcs = map[string]funcDef{
 		"absolute":                     {NewAbsolute, true},
 		"aggregate":                    {NewAggregate, true},
+		"aggregateLine":                {NewAggregateLine, false},
 		"aggregateSeriesWithWildcards": {NewAggregateWithWildcardsConstructor(""), true},
 		"alias":                        {NewAlias, true},
 		"aliasByMetric":                {NewAliasByMetric, true},
 		"aliasByTags":                  {NewAliasByNode, true},
 		"aliasByNode":                  {NewAliasByNode, true},
 		"aliasSub":                     {NewAliasSub, true},
+		"alpha":                        {NewAlpha, true},
 		"asPercent":                    {NewAsPercent, true},
 		"avg":                          {NewAggregateConstructor("average"), true},
 		"averageAbove":                 {NewFilterSeriesConstructor("average", ">"), true},
 		"averageBelow":                 {NewFilterSeriesConstructor("average", "<="), true},
 		"averageSeries":                {NewAggregateConstructor("average"), true},
 		"averageSeriesWithWildcards":   {NewAggregateWithWildcardsConstructor("average"), true},
+		"cactiStyle":                   {NewCactiStyle, true},
+		"color":                        {NewColor, true},
 		"consolidateBy":                {NewConsolidateBy, true},
 		"constantLine":                 {NewConstantLine, false},
 		"countSeries":                  {NewCountSeries, true},
 		"cumulative":                   {NewConsolidateByConstructor("sum"), true},
 		"currentAbove":                 {NewFilterSeriesConstructor("last", ">"), true},
 		"currentBelow":                 {NewFilterSeriesConstructor("last", "<="), true},
+		"dashed":                       {NewDashed, true},
 		"derivative":                   {NewDerivative, true},
 		"diffSeries":                   {NewAggregateConstructor("diff"), true},
 		"divideSeries":                 {NewDivideSeries, true},
 		"divideSeriesLists":            {NewDivideSeriesLists, true},
+		"events":                       {NewEvents, false},
 		"exclude":                      {NewExclude, true},
 		"fallbackSeries":               {NewFallbackSeries, true},
 		"filterSeries":                 {NewFilterSeries, true},
@@ -92,6 +100,8 @@ func init() {
 		"invert":                       {NewInvert, true},
 		"isNonNull":                    {NewIsNonNull, true},
 		"keepLastValue":                {NewKeepLastValue, true},
+		"legendValue":                  {NewLegendValue, true},
+		"lineWidth":                    {NewLineWidth, true},
 		"lowest":                       {NewHighestLowestConstructor("", false), true},
 		"lowestAverage":                {NewHighestLowestConstructor("average", false), true},
 		"lowestCurrent":                {NewHighestLowestConstructor("current", false), true},
@@ -124,20 +134,26 @@ func init() {
 		"round":                        {NewRound, true},
 		"scale":                        {NewScale, true},
 		"scaleToSeconds":               {NewScaleToSeconds, true},
+		"seasonalBands":                {NewSeasonalBands, true},
+		"seasonalDecompose":            {NewSeasonalDecompose, true},
+		"seasonalZScore":               {NewSeasonalZScore, true},
 		"smartSummarize":               {NewSmartSummarize, false},
 		"sortBy":                       {NewSortByConstructor("", false), true},
 		"sortByMaxima":                 {NewSortByConstructor("max", true), true},
 		"sortByName":                   {NewSortByName, true},
 		"sortByTotal":                  {NewSortByConstructor("sum", true), true},
+		"stacked":                      {NewStacked, true},
 		"stddevSeries":                 {NewAggregateConstructor("stddev"), true},
 		"substr":                       {NewSubstr, true},
 		"sum":                          {NewAggregateConstructor("sum"), true},
 		"sumSeries":                    {NewAggregateConstructor("sum"), true},
 		"sumSeriesWithWildcards":       {NewAggregateWithWildcardsConstructor("sum"), true},
 		"summarize":                    {NewSummarize, true},
+		"threshold":                    {NewThreshold, false},
 		"timeShift":                    {NewTimeShift, true},
 		"transformNull":                {NewTransformNull, true},
 		"unique":                       {NewUnique, true},
+		"verticalLine":                 {NewVerticalLine, false},
 	}
 }
 
@@ -0,0 +1,222 @@
+package expr
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/grafana/metrictank/errors"
+	"github.com/grafana/metrictank/idx"
+)
+
+// maxMacroDepth is the maximum nesting of macros referencing other macros.
+// it protects us from macros which (indirectly) reference themselves
+const maxMacroDepth = 10
+
+// MacroGetter returns the macro with the given name and whether it exists
+type MacroGetter func(name string) (idx.Macro, bool)
+
+// ParseMacro parses the expression of the given macro, to validate it
+func ParseMacro(macro idx.Macro) (*expr, error) {
+	exprs, err := ParseMany([]string{macro.Expr})
+	if err != nil {
+		return nil, errors.NewBadRequestf("macro %q: %s", macro.Name, err.Error())
+	}
+	return exprs[0], nil
+}
+
+// ExpandMacros replaces all calls to macro("name", args...) in the given expressions
+// by the parsed expressions of the referenced macros, in which the "$param" placeholders
+// have been substituted with the given arguments.
+// an argument can be given positionally, in order of the macro's params, or by param name.
+// a placeholder which makes up an entire argument gets replaced by the given argument
+// (which may itself be a function call), otherwise the placeholder is replaced textually,
+// e.g. within a metric pattern like foo.$dc.bar or a tag expression like 'dc=$dc'
+func ExpandMacros(exprs []*expr, getter MacroGetter) ([]*expr, error) {
+	out := make([]*expr, len(exprs))
+	for i, e := range exprs {
+		var err error
+		out[i], err = expandMacros(e, getter, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func expandMacros(e *expr, getter MacroGetter, depth int) (*expr, error) {
+	if e.etype != etFunc {
+		return e, nil
+	}
+
+	for i, arg := range e.args {
+		var err error
+		e.args[i], err = expandMacros(arg, getter, depth)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for k, arg := range e.namedArgs {
+		var err error
+		e.namedArgs[k], err = expandMacros(arg, getter, depth)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.str != "macro" {
+		return e, nil
+	}
+
+	if depth >= maxMacroDepth {
+		return nil, errors.NewBadRequestf("macros nested more than %d levels deep. do they reference themselves?", maxMacroDepth)
+	}
+	if len(e.args) == 0 || e.args[0].etype != etString {
+		return nil, errors.NewBadRequest("macro() requires the name of the macro as its first argument")
+	}
+	name := e.args[0].str
+	if getter == nil {
+		return nil, errors.NewBadRequestf("unknown macro %q", name)
+	}
+	macro, ok := getter(name)
+	if !ok {
+		return nil, errors.NewBadRequestf("unknown macro %q", name)
+	}
+
+	values, err := macroArgs(macro, e.args[1:], e.namedArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ParseMacro(macro)
+	if err != nil {
+		return nil, err
+	}
+	body, err = substituteParams(body, values, macro.Params)
+	if err != nil {
+		return nil, errors.NewBadRequestf("macro %q: %s", name, err.Error())
+	}
+
+	return expandMacros(body, getter, depth+1)
+}
+
+// macroArgs maps the arguments given to macro() to the params of the given macro
+func macroArgs(macro idx.Macro, args []*expr, namedArgs map[string]*expr) (map[string]*expr, error) {
+	if len(args) > len(macro.Params) {
+		return nil, errors.NewBadRequestf("macro %q takes %d arguments, got %d", macro.Name, len(macro.Params), len(args))
+	}
+	values := make(map[string]*expr, len(macro.Params))
+	for i, arg := range args {
+		values[macro.Params[i]] = arg
+	}
+	for k, arg := range namedArgs {
+		if !isMacroParam(macro, k) {
+			return nil, errors.NewBadRequestf("macro %q: unknown argument %q", macro.Name, k)
+		}
+		if _, ok := values[k]; ok {
+			return nil, errors.NewBadRequestf("macro %q: argument %q specified more than once", macro.Name, k)
+		}
+		values[k] = arg
+	}
+	for _, param := range macro.Params {
+		if _, ok := values[param]; !ok {
+			return nil, errors.NewBadRequestf("macro %q: missing argument %q", macro.Name, param)
+		}
+	}
+	return values, nil
+}
+
+func isMacroParam(macro idx.Macro, name string) bool {
+	for _, param := range macro.Params {
+		if param == name {
+			return true
+		}
+	}
+	return false
+}
+
+// substituteParams replaces the placeholders of the given params within e
+func substituteParams(e *expr, values map[string]*expr, params []string) (*expr, error) {
+	// replace longer names first, so that $foobar doesn't get replaced by the value of $foo
+	sorted := make([]string, len(params))
+	copy(sorted, params)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	var subst func(e *expr) (*expr, error)
+	subst = func(e *expr) (*expr, error) {
+		switch e.etype {
+		case etName, etString:
+			if strings.HasPrefix(e.str, "$") {
+				if value, ok := values[e.str[1:]]; ok {
+					res := *value
+					if e.etype == etName && value.etype == etString {
+						// a quoted argument substituted where a series is expected is a metric pattern
+						res.etype = etName
+					}
+					return &res, nil
+				}
+			}
+			str, err := substituteText(e.str, values, sorted)
+			if err != nil {
+				return nil, err
+			}
+			res := *e
+			res.str = str
+			return &res, nil
+		case etFunc:
+			res := *e
+			var err error
+			res.argsStr = substituteArgsStr(e.argsStr, values, sorted)
+			res.args = make([]*expr, len(e.args))
+			for i, arg := range e.args {
+				res.args[i], err = subst(arg)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if e.namedArgs != nil {
+				res.namedArgs = make(map[string]*expr, len(e.namedArgs))
+				for k, arg := range e.namedArgs {
+					res.namedArgs[k], err = subst(arg)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+			return &res, nil
+		}
+		return e, nil
+	}
+	return subst(e)
+}
+
+// substituteText replaces all placeholders within the given string with the
+// textual representation of their values
+func substituteText(str string, values map[string]*expr, params []string) (string, error) {
+	if !strings.Contains(str, "$") {
+		return str, nil
+	}
+	for _, param := range params {
+		placeholder := "$" + param
+		if !strings.Contains(str, placeholder) {
+			continue
+		}
+		value := values[param]
+		if value.etype == etFunc {
+			return "", errors.NewBadRequestf("cannot substitute a function call for %s within %q", placeholder, str)
+		}
+		str = strings.Replace(str, placeholder, value.str, -1)
+	}
+	return str, nil
+}
+
+// substituteArgsStr is like substituteText, but for the literal args string of a function.
+// placeholders of function call arguments are left as-is, because we don't
+// have their literal representation
+func substituteArgsStr(str string, values map[string]*expr, params []string) string {
+	for _, param := range params {
+		if value := values[param]; value.etype != etFunc {
+			str = strings.Replace(str, "$"+param, value.str, -1)
+		}
+	}
+	return str
+}
@@ -0,0 +1,152 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/grafana/metrictank/idx"
+)
+
+func testMacroGetter(macros ...idx.Macro) MacroGetter {
+	return func(name string) (idx.Macro, bool) {
+		for _, m := range macros {
+			if m.Name == name {
+				return m, true
+			}
+		}
+		return idx.Macro{}, false
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	getter := testMacroGetter(
+		idx.Macro{
+			Name:   "egress_bits",
+			Params: []string{"filter"},
+			Expr:   "sumSeries(scale(perSecond(seriesByTag('name=egress', '$filter')),8))",
+		},
+		idx.Macro{
+			Name:   "dc_pattern",
+			Params: []string{"dc", "dcname"},
+			Expr:   "aliasByNode(servers.$dcname.$dc.*.cpu, 2)",
+		},
+		idx.Macro{
+			Name:   "scaled",
+			Params: []string{"series", "factor"},
+			Expr:   "scale($series, $factor)",
+		},
+		idx.Macro{
+			Name:   "nested",
+			Params: []string{"filter"},
+			Expr:   "alias(macro('egress_bits', '$filter'), 'egress')",
+		},
+		idx.Macro{
+			Name: "self",
+			Expr: "macro('self')",
+		},
+	)
+
+	tests := []struct {
+		target   string
+		expected string
+		wantErr  bool
+	}{
+		{
+			target:   "foo.bar",
+			expected: "foo.bar",
+		},
+		{
+			target:   `macro("egress_bits", "dc=eu")`,
+			expected: "sumSeries(scale(perSecond(seriesByTag('name=egress', 'dc=eu')),8))",
+		},
+		{
+			target:   `macro("egress_bits", filter="dc=eu")`,
+			expected: "sumSeries(scale(perSecond(seriesByTag('name=egress', 'dc=eu')),8))",
+		},
+		{
+			target:   `macro("dc_pattern", "eu", "west")`,
+			expected: "aliasByNode(servers.west.eu.*.cpu, 2)",
+		},
+		{
+			target:   `macro("scaled", "a.b.c", 2.5)`,
+			expected: "scale(a.b.c, 2.5)",
+		},
+		{
+			target:   `alias(macro("scaled", a.b.c, 2), "foo")`,
+			expected: `alias(scale(a.b.c, 2), "foo")`,
+		},
+		{
+			target:  `a.b.c | macro("scaled", factor=3)`,
+			wantErr: true,
+		},
+		{
+			target:   `macro("nested", "dc=us")`,
+			expected: "alias(sumSeries(scale(perSecond(seriesByTag('name=egress', 'dc=us')),8)), 'egress')",
+		},
+		{
+			target:  `macro("unknown")`,
+			wantErr: true,
+		},
+		{
+			target:  `macro("egress_bits")`,
+			wantErr: true,
+		},
+		{
+			target:  `macro("egress_bits", "a", "b")`,
+			wantErr: true,
+		},
+		{
+			target:  `macro("egress_bits", foo="a")`,
+			wantErr: true,
+		},
+		{
+			target:  `macro("dc_pattern", sum(a), "west")`,
+			wantErr: true,
+		},
+		{
+			target:  `macro("self")`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		exprs, err := ParseMany([]string{tc.target})
+		if err != nil {
+			t.Fatalf("case %q: failed to parse: %s", tc.target, err)
+		}
+		got, err := ExpandMacros(exprs, getter)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("case %q: expected error, got %s", tc.target, spew.Sdump(got))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %q: unexpected error: %s", tc.target, err)
+		}
+		expected, err := ParseMany([]string{tc.expected})
+		if err != nil {
+			t.Fatalf("case %q: failed to parse expected expression: %s", tc.target, err)
+		}
+		// the literal args string is only used by seriesByTag, and can't be reconstructed
+		// for functions which had macro calls as arguments
+		stripArgsStr(got...)
+		stripArgsStr(expected...)
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("case %q: expansion mismatch.\nexpected: %s\ngot:      %s", tc.target, spew.Sdump(expected), spew.Sdump(got))
+		}
+	}
+}
+
+func stripArgsStr(exprs ...*expr) {
+	for _, e := range exprs {
+		if e.str != "seriesByTag" {
+			e.argsStr = ""
+		}
+		stripArgsStr(e.args...)
+		for _, arg := range e.namedArgs {
+			stripArgsStr(arg)
+		}
+	}
+}
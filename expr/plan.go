@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/grafana/metrictank/api/models"
 	"github.com/grafana/metrictank/consolidation"
@@ -115,6 +116,8 @@ type Plan struct {
 	From          uint32  // global request scoped from
 	To            uint32  // global request scoped to
 	dataMap       DataMap // set via Run()
+	events        *eventSource
+	location      *locationSource
 }
 
 func (p Plan) Dump(w io.Writer) {
@@ -157,6 +160,8 @@ func NewPlan(exprs []*expr, from, to, mdp uint32, stable bool, optimizations Opt
 		MaxDataPoints: mdp,
 		From:          from,
 		To:            to,
+		events:        &eventSource{},
+		location:      &locationSource{},
 	}
 	for _, e := range exprs {
 		context := Context{
@@ -165,6 +170,8 @@ func NewPlan(exprs []*expr, from, to, mdp uint32, stable bool, optimizations Opt
 			MDP:           mdp,
 			PNGroup:       0, // making this explicit here for easy code grepping
 			optimizations: optimizations,
+			events:        plan.events,
+			location:      plan.location,
 		}
 		fn, reqs, err := newplan(e, context, stable, plan.Reqs)
 		if err != nil {
@@ -321,6 +328,22 @@ func newplanFunc(e *expr, fn GraphiteFunc, context Context, stable bool, reqs []
 	return reqs, err
 }
 
+// BindEvents sets the getter used by the events() function to look up the events.
+// it must be called before Run. Without it, events() returns an empty series.
+func (p *Plan) BindEvents(getter EventsGetter) {
+	if p.events != nil {
+		p.events.get = getter
+	}
+}
+
+// BindLocation sets the timezone of the request, in which functions interpret absolute times.
+// it must be called before Run. Without it, the server's timezone is used.
+func (p *Plan) BindLocation(loc *time.Location) {
+	if p.location != nil {
+		p.location.loc = loc
+	}
+}
+
 // Run invokes all processing as specified in the plan (expressions, from/to) against the given datamap
 func (p *Plan) Run(dataMap DataMap) ([]models.Series, error) {
 	var out []models.Series
@@ -0,0 +1,75 @@
+package expr
+
+import (
+	"math"
+
+	"github.com/grafana/metrictank/api/models"
+	"github.com/grafana/metrictank/schema"
+	"github.com/raintank/dur"
+)
+
+// seasonal describes the history needed by the seasonal anomaly functions:
+// the length of one season and how many past seasons to look at.
+// Just like movingWindow, the seasonal functions fetch their history by extending
+// the start of the requested time range, so that the regular archive selection and
+// consolidation apply to the extended range.
+type seasonal struct {
+	season  string
+	seasons int64
+
+	seasonSecs uint32
+	offset     uint32 // how far back we need to fetch: seasons * seasonSecs
+}
+
+// context extends the given context to include all the required past seasons
+func (s *seasonal) context(context Context) Context {
+	// shouldn't fail, validated via IsIntervalString
+	secs, _ := dur.ParseDuration(s.season)
+	s.seasonSecs = secs
+	s.offset = uint32(s.seasons) * secs
+	if s.offset > context.from {
+		s.offset = context.from
+	}
+	context.from -= s.offset
+	return context
+}
+
+// seasonPoints returns the number of points in one season of a series with the given interval.
+// if the season is not a multiple of the interval (e.g. because a rollup archive was selected),
+// it gets rounded to the nearest number of points
+func seasonPoints(seasonSecs, interval uint32) int {
+	if interval == 0 {
+		return 0
+	}
+	return int(math.Floor(float64(seasonSecs)/float64(interval) + 0.5))
+}
+
+// outputStart returns the index of the first point of the given series which lies within the
+// originally requested time range, as well as the start of that range.
+func (s *seasonal) outputStart(serie models.Series) (int, uint32) {
+	start := serie.QueryFrom + s.offset
+	i := 0
+	for i < len(serie.Datapoints) && serie.Datapoints[i].Ts < start {
+		i++
+	}
+	return i, start
+}
+
+// history collects the values of the given number of previous seasons at the same phase as the point at index i
+// into buf. buf is truncated first, and returned with the non-null values
+func history(points []schema.Point, i, seasonPoints, seasons int, buf []schema.Point) []schema.Point {
+	buf = buf[:0]
+	if seasonPoints <= 0 {
+		return buf
+	}
+	for k := 1; k <= seasons; k++ {
+		j := i - k*seasonPoints
+		if j < 0 {
+			break
+		}
+		if !math.IsNaN(points[j].Val) {
+			buf = append(buf, points[j])
+		}
+	}
+	return buf
+}
@@ -66,6 +66,9 @@ func equalSeries(exp, got models.Series) error {
 	if got.Consolidator != exp.Consolidator {
 		return fmt.Errorf("Consolidator %v, got %v", exp.Consolidator, got.Consolidator)
 	}
+	if got.Style != exp.Style {
+		return fmt.Errorf("Style %+v, got %+v", exp.Style, got.Style)
+	}
 	if len(got.Datapoints) != len(exp.Datapoints) {
 		return fmt.Errorf("output expected %d, got %d", len(exp.Datapoints), len(got.Datapoints))
 	}
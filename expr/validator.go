@@ -11,6 +11,8 @@ var ErrIntZeroOrPositive = errors.NewBadRequest("integer must be zero or positiv
 var ErrInvalidAggFunc = errors.NewBadRequest("Invalid aggregation func")
 var ErrNonNegativePercent = errors.NewBadRequest("The requested percent is required to be greater than 0")
 var ErrWithinZeroOneInclusiveInterval = errors.NewBadRequest("value must lie within interval [0,1]")
+var ErrAtLeastOne = errors.NewBadRequest("value must be at least 1")
+var ErrLineWidth = errors.NewBadRequest("line width must be greater than 0 and at most 100")
 
 // Validator is a function to validate an input
 type Validator func(e *expr) error
@@ -48,6 +50,18 @@ func IsIntervalString(e *expr) error {
 	return err
 }
 
+// IsPositiveIntervalString validates whether the string is a non-zero interval
+func IsPositiveIntervalString(e *expr) error {
+	secs, err := dur.ParseDuration(e.str)
+	if err != nil {
+		return err
+	}
+	if secs == 0 {
+		return errors.NewBadRequest("interval must be greater than 0")
+	}
+	return nil
+}
+
 func IsSignedIntervalString(e *expr) error {
 	durStr := e.str
 	if durStr[0] == '-' || durStr[0] == '+' {
@@ -78,3 +92,49 @@ func WithinZeroOneInclusiveInterval(e *expr) error {
 	}
 	return nil
 }
+
+// AtLeastOne validates whether a number (int or float) is at least 1
+func AtLeastOne(e *expr) error {
+	if e.etype == etInt && e.int < 1 || e.etype != etInt && !(e.float >= 1) {
+		return ErrAtLeastOne
+	}
+	return nil
+}
+
+// IsLineWidth validates whether a number (int or float) is a valid line width in pixels:
+// greater than 0 and at most 100, like the lineWidth render parameter
+func IsLineWidth(e *expr) error {
+	v := e.float
+	if e.etype == etInt {
+		v = float64(e.int)
+	}
+	if !(v > 0 && v <= 100) {
+		return ErrLineWidth
+	}
+	return nil
+}
+
+// IsConsolFuncOrUnitSystem validates whether the string is either a consolidation function
+// or a unit system (si or binary), as used by legendValue()
+func IsConsolFuncOrUnitSystem(e *expr) error {
+	if isUnitSystem(e.str) {
+		return nil
+	}
+	return consolidation.Validate(e.str)
+}
+
+func IsUnitSystem(e *expr) error {
+	if !isUnitSystem(e.str) {
+		return errors.NewBadRequest("Unsupported unit system: " + e.str)
+	}
+	return nil
+}
+
+// IsSeasonalComponent validates whether the string is a component returned by seasonalDecompose
+func IsSeasonalComponent(e *expr) error {
+	switch e.str {
+	case "trend", "seasonal", "residual":
+		return nil
+	}
+	return errors.NewBadRequest("Unsupported component: " + e.str)
+}
@@ -0,0 +1,48 @@
+package idx
+
+// Event is a graphite-style event, as used for annotations.
+type Event struct {
+	Id   int64    `json:"id"`
+	When int64    `json:"when"` // unix timestamp in seconds
+	What string   `json:"what"`
+	Data string   `json:"data"`
+	Tags []string `json:"tags"`
+}
+
+// HasTags returns whether the event has all the given tags
+func (e Event) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range e.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type EventIdx interface {
+	// EventAdd stores the given event under a new id and returns it with the id set.
+	EventAdd(orgId uint32, event Event) (Event, error)
+
+	// EventGet returns the event with the given id and whether it exists.
+	EventGet(orgId uint32, id int64) (Event, bool)
+
+	// EventDelete deletes the event with the given id. Deleting an event
+	// which doesn't exist is not an error.
+	EventDelete(orgId uint32, id int64) error
+
+	// EventFind returns the events of the given org which happened within
+	// from (inclusive) and to (exclusive) and which have all the given tags,
+	// sorted by time.
+	EventFind(orgId uint32, from, to int64, tags []string) []Event
+
+	// EventSwap takes a set of events and completely replaces the existing
+	// ones of the given org with the new ones.
+	EventSwap(orgId uint32, events []Event) error
+}
@@ -0,0 +1,67 @@
+package bigtable
+
+import (
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/grafana/globalconf"
+	log "github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	Enabled          bool
+	gcpProject       string
+	bigtableInstance string
+	tableName        string
+	eventCf          string
+	pollInterval     time.Duration
+	retention        time.Duration
+	updateEvents     bool
+	createCf         bool
+}
+
+func (cfg *Config) Validate() error {
+	if cfg.pollInterval == 0 {
+		return errors.New("poll-interval must be greater than 0")
+	}
+	return nil
+}
+
+// return Config with default values set.
+func NewConfig() *Config {
+	return &Config{
+		Enabled:          false,
+		gcpProject:       "default",
+		bigtableInstance: "default",
+		tableName:        "events",
+		eventCf:          "e", // currently not configurable
+		pollInterval:     time.Second * 10,
+		retention:        time.Hour * 24 * 365,
+		updateEvents:     true,
+		createCf:         true,
+	}
+}
+
+var CliConfig = NewConfig()
+
+func ConfigSetup() {
+	btIdx := flag.NewFlagSet("bigtable-event-idx", flag.ExitOnError)
+
+	btIdx.BoolVar(&CliConfig.Enabled, "enabled", CliConfig.Enabled, "")
+	btIdx.StringVar(&CliConfig.gcpProject, "gcp-project", CliConfig.gcpProject, "Name of GCP project the bigtable cluster resides in")
+	btIdx.StringVar(&CliConfig.bigtableInstance, "bigtable-instance", CliConfig.bigtableInstance, "Name of bigtable instance")
+	btIdx.StringVar(&CliConfig.tableName, "table-name", CliConfig.tableName, "Table to store events")
+	btIdx.DurationVar(&CliConfig.pollInterval, "poll-interval", CliConfig.pollInterval, "Interval at which to poll store for event updates")
+	btIdx.DurationVar(&CliConfig.retention, "retention", CliConfig.retention, "How long to keep events, based on their timestamp. Older events are removed by the GC policy of the column family (only set when creating it), and not loaded. 0 keeps events forever")
+	btIdx.BoolVar(&CliConfig.updateEvents, "update-events", CliConfig.updateEvents, "Synchronize event changes to bigtable. not all your nodes need to do this")
+	btIdx.BoolVar(&CliConfig.createCf, "create-cf", CliConfig.createCf, "Enable the creation of the table and column families")
+
+	globalconf.Register("bigtable-event-idx", btIdx, flag.ExitOnError)
+}
+
+func ConfigProcess() {
+	if err := CliConfig.Validate(); err != nil {
+		log.Fatalf("bt-event-idx: Config validation error. %s", err)
+	}
+}
@@ -0,0 +1,316 @@
+package bigtable
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	btUtils "github.com/grafana/metrictank/bigtable"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/idx/events"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errIdxUpdatesDisabled = fmt.Errorf("BigTable event updates are disabled")
+)
+
+// EventIdx persists events in bigtable and periodically loads them
+// into the wrapped memory event index, which serves all reads
+type EventIdx struct {
+	wg          sync.WaitGroup
+	shutdown    chan struct{}
+	cfg         *Config
+	memoryIdx   *events.EventIdx
+	client      *bigtable.Client
+	adminClient *bigtable.AdminClient
+	eventTable  *bigtable.Table
+}
+
+func NewBigTableEventIdx(cfg *Config, memoryIdx *events.EventIdx) *EventIdx {
+	return &EventIdx{
+		shutdown:  make(chan struct{}),
+		cfg:       cfg,
+		memoryIdx: memoryIdx,
+	}
+}
+
+func (e *EventIdx) Init() error {
+	ctx := context.Background()
+	err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	gcPolicy := bigtable.MaxVersionsPolicy(1)
+	if e.cfg.retention > 0 {
+		// cells are timestamped with the time of the event, see eventMutation
+		gcPolicy = bigtable.UnionPolicy(gcPolicy, bigtable.MaxAgePolicy(e.cfg.retention))
+	}
+	err = btUtils.EnsureTableExists(ctx, e.cfg.createCf, e.adminClient, e.cfg.tableName, map[string]bigtable.GCPolicy{
+		e.cfg.eventCf: gcPolicy,
+	})
+	if err != nil {
+		return err
+	}
+
+	e.eventTable = e.client.Open(e.cfg.tableName)
+	e.loadEvents()
+
+	return nil
+}
+
+func (e *EventIdx) connect(ctx context.Context) error {
+	var err error
+	e.client, err = bigtable.NewClient(ctx, e.cfg.gcpProject, e.cfg.bigtableInstance)
+	if err != nil {
+		log.Errorf("bt-event-idx: failed to create bigtable client: %s", err)
+		return err
+	}
+
+	e.adminClient, err = bigtable.NewAdminClient(ctx, e.cfg.gcpProject, e.cfg.bigtableInstance)
+	if err != nil {
+		log.Errorf("bt-event-idx: failed to create bigtable admin client: %s", err)
+	}
+
+	return err
+}
+
+func (e *EventIdx) Start() {
+	e.wg.Add(1)
+	go e.pollBigtable()
+}
+
+func (e *EventIdx) Stop() {
+	close(e.shutdown)
+	e.wg.Wait()
+	e.client.Close()
+	e.adminClient.Close()
+}
+
+func (e *EventIdx) pollBigtable() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.cfg.pollInterval)
+	for {
+		select {
+		case <-e.shutdown:
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			e.loadEvents()
+		}
+	}
+}
+
+// loadEvents reads all events within the retention from bigtable and replaces the events
+// of each org in the memory index with them
+func (e *EventIdx) loadEvents() {
+	now := time.Now()
+	byOrg := make(map[uint32][]idx.Event)
+	err := e.eventTable.ReadRows(context.Background(), bigtable.InfiniteRange(""), func(row bigtable.Row) bool {
+		orgId, id, err := decodeEventRowKey(row.Key())
+		if err != nil {
+			log.Errorf("bt-event-idx: Failed to decode event row key %q: %s", row.Key(), err)
+			return true
+		}
+
+		columns, ok := row[e.cfg.eventCf]
+		if !ok {
+			log.Errorf("bt-event-idx: Row from event table was missing expected column family %s", e.cfg.eventCf)
+			return true
+		}
+
+		event := idx.Event{Id: id}
+		for _, col := range columns {
+			switch strings.SplitN(col.Column, ":", 2)[1] {
+			case "when":
+				event.When, err = binary.ReadVarint(bytes.NewReader(col.Value))
+				if err != nil {
+					log.Errorf("bt-event-idx: Row from event table contained invalid when value %x: %s", col.Value, err)
+					return true
+				}
+			case "what":
+				event.What = string(col.Value)
+			case "data":
+				event.Data = string(col.Value)
+			case "tags":
+				err = json.Unmarshal(col.Value, &event.Tags)
+				if err != nil {
+					log.Errorf("bt-event-idx: Row from event table contained invalid tags value %q: %s", col.Value, err)
+					return true
+				}
+			}
+		}
+
+		// garbage collection is not immediate, and tables created without a retention have no max age policy
+		if !events.Expired(event, e.cfg.retention, now) {
+			byOrg[orgId] = append(byOrg[orgId], event)
+		}
+		return true
+	}, bigtable.RowFilter(bigtable.ChainFilters(bigtable.FamilyFilter(e.cfg.eventCf), bigtable.LatestNFilter(1))))
+
+	if err != nil {
+		log.Errorf("bt-event-idx: Failed to load events: %s", err)
+		return
+	}
+
+	// orgs whose events have all been deleted need to get swapped with an empty set
+	for _, orgId := range e.memoryIdx.Orgs() {
+		if _, ok := byOrg[orgId]; !ok {
+			byOrg[orgId] = nil
+		}
+	}
+
+	for orgId, orgEvents := range byOrg {
+		if err := e.memoryIdx.EventSwap(orgId, orgEvents); err != nil {
+			log.Errorf("bt-event-idx: Error when swapping events of org %d: %s", orgId, err)
+		}
+	}
+}
+
+func formatEventRowKey(orgId uint32, id int64) string {
+	return strconv.Itoa(int(orgId)) + "_" + strconv.FormatInt(id, 10)
+}
+
+func decodeEventRowKey(key string) (uint32, int64, error) {
+	parts := strings.SplitN(key, "_", 2)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("Invalid row key format: %q", key)
+	}
+	orgId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid org id %q in row key: %q", parts[0], key)
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid event id %q in row key: %q", parts[1], key)
+	}
+	return uint32(orgId), id, nil
+}
+
+func (e *EventIdx) eventMutation(event idx.Event) (*bigtable.Mutation, error) {
+	tags, err := json.Marshal(event.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal tags: %s", err)
+	}
+	when := make([]byte, 8)
+	binary.PutVarint(when, event.When)
+
+	// timestamp the cells with the time of the event, so the max age GC policy expires them based on it
+	ts := bigtable.Time(time.Unix(event.When, 0))
+	mut := bigtable.NewMutation()
+	mut.Set(e.cfg.eventCf, "when", ts, when)
+	mut.Set(e.cfg.eventCf, "what", ts, []byte(event.What))
+	mut.Set(e.cfg.eventCf, "data", ts, []byte(event.Data))
+	mut.Set(e.cfg.eventCf, "tags", ts, tags)
+	return mut, nil
+}
+
+func (e *EventIdx) EventAdd(orgId uint32, event idx.Event) (idx.Event, error) {
+	if !e.cfg.updateEvents {
+		return event, errIdxUpdatesDisabled
+	}
+	if err := events.Validate(event); err != nil {
+		return event, err
+	}
+	if events.Expired(event, e.cfg.retention, time.Now()) {
+		return event, events.ErrExpired
+	}
+	if event.Id == 0 {
+		event.Id = events.NewId()
+	}
+
+	mut, err := e.eventMutation(event)
+	if err != nil {
+		return event, err
+	}
+	err = e.eventTable.Apply(context.Background(), formatEventRowKey(orgId, event.Id), mut)
+	if err != nil {
+		log.Errorf("bt-event-idx: Failed to persist event %d/%d: %s", orgId, event.Id, err)
+		return event, fmt.Errorf("Failed to update bigtable: %s", err)
+	}
+
+	return e.memoryIdx.EventAdd(orgId, event)
+}
+
+func (e *EventIdx) EventGet(orgId uint32, id int64) (idx.Event, bool) {
+	return e.memoryIdx.EventGet(orgId, id)
+}
+
+func (e *EventIdx) EventDelete(orgId uint32, id int64) error {
+	if !e.cfg.updateEvents {
+		return errIdxUpdatesDisabled
+	}
+
+	mut := bigtable.NewMutation()
+	mut.DeleteRow()
+	err := e.eventTable.Apply(context.Background(), formatEventRowKey(orgId, id), mut)
+	if err != nil {
+		log.Errorf("bt-event-idx: Failed to delete event %d/%d: %s", orgId, id, err)
+		return fmt.Errorf("Failed to update bigtable: %s", err)
+	}
+
+	return e.memoryIdx.EventDelete(orgId, id)
+}
+
+func (e *EventIdx) EventFind(orgId uint32, from, to int64, tags []string) []idx.Event {
+	return e.memoryIdx.EventFind(orgId, from, to, tags)
+}
+
+func (e *EventIdx) EventSwap(orgId uint32, newEvents []idx.Event) error {
+	if !e.cfg.updateEvents {
+		return errIdxUpdatesDisabled
+	}
+
+	now := time.Now()
+	rowKeys := make([]string, len(newEvents))
+	muts := make([]*bigtable.Mutation, len(newEvents))
+	for i := range newEvents {
+		if err := events.Validate(newEvents[i]); err != nil {
+			return err
+		}
+		if events.Expired(newEvents[i], e.cfg.retention, now) {
+			return events.ErrExpired
+		}
+		if newEvents[i].Id == 0 {
+			newEvents[i].Id = events.NewId()
+		}
+		var err error
+		muts[i], err = e.eventMutation(newEvents[i])
+		if err != nil {
+			return err
+		}
+		rowKeys[i] = formatEventRowKey(orgId, newEvents[i].Id)
+	}
+
+	// unfortunately dropping a row range requires using the admin client
+	err := e.adminClient.DropRowRange(context.Background(), e.cfg.tableName, strconv.Itoa(int(orgId))+"_")
+	if err != nil {
+		log.Errorf("bt-event-idx: Failed to drop events of org %d: %s", orgId, err)
+		return err
+	}
+
+	if len(muts) > 0 {
+		errs, err := e.eventTable.ApplyBulk(context.Background(), rowKeys, muts)
+		if err != nil {
+			log.Errorf("bt-event-idx: Failed to apply events in bulk: %s", err)
+			return err
+		}
+		for _, err = range errs {
+			if err != nil {
+				log.Errorf("bt-event-idx: One or multiple errors when storing %d events, first error: %s", len(rowKeys), err)
+				return err
+			}
+		}
+	}
+
+	return e.memoryIdx.EventSwap(orgId, newEvents)
+}
@@ -0,0 +1,264 @@
+package cassandra
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	cassUtils "github.com/grafana/metrictank/cassandra"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/idx/events"
+	"github.com/grafana/metrictank/util"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// try executing each query 10 times
+	// when a query fails we retry 9 times with the following sleep times in-between
+	// 100ms, 200ms, 400ms, 800ms, 1.6s, 3.2s, 6.4s, 12.8s, 20s
+	// the total time to fail is 45.5s, which is less than the default http timeout
+	eventRetryPolicy = gocql.ExponentialBackoffRetryPolicy{
+		NumRetries: 9,
+		Min:        time.Millisecond * time.Duration(100),
+		Max:        time.Second * time.Duration(20),
+	}
+
+	errIdxUpdatesDisabled = fmt.Errorf("Cassandra event updates are disabled")
+)
+
+// EventIdx persists events in cassandra and periodically loads them
+// into the wrapped memory event index, which serves all reads
+type EventIdx struct {
+	wg        sync.WaitGroup
+	shutdown  chan struct{}
+	cfg       *Config
+	memoryIdx *events.EventIdx
+	cluster   *gocql.ClusterConfig
+	session   *cassUtils.Session
+}
+
+func NewCassandraEventIdx(cfg *Config, memoryIdx *events.EventIdx) *EventIdx {
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("cass-event-idx: %s", err)
+	}
+	cluster := gocql.NewCluster(strings.Split(cfg.hosts, ",")...)
+	cluster.Consistency = gocql.ParseConsistency(cfg.consistency)
+	cluster.Keyspace = cfg.keyspace
+	cluster.Timeout = cfg.timeout
+	cluster.ConnectTimeout = cluster.Timeout
+	cluster.NumConns = cfg.numConns
+	cluster.ProtoVersion = cfg.protoVer
+	cluster.DisableInitialHostLookup = cfg.disableInitialHostLookup
+	if cfg.ssl {
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 cfg.caPath,
+			EnableHostVerification: cfg.hostVerification,
+		}
+	}
+	if cfg.auth {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: cfg.username,
+			Password: cfg.password,
+		}
+	}
+
+	return &EventIdx{
+		shutdown:  make(chan struct{}),
+		cfg:       cfg,
+		memoryIdx: memoryIdx,
+		cluster:   cluster,
+	}
+}
+
+func (e *EventIdx) Init() error {
+	var err error
+	e.session, err = cassUtils.NewSession(e.cluster, e.cfg.connectionCheckTimeout, e.cfg.connectionCheckInterval, e.cfg.hosts, "cass-event-idx")
+	if err != nil {
+		return fmt.Errorf("cass-event-idx: Failed to create cassandra session: %s", err)
+	}
+
+	schema := fmt.Sprintf(util.ReadEntry(e.cfg.schemaFile, "schema_event_table").(string), e.cfg.keyspace, e.cfg.eventTable)
+	err = cassUtils.EnsureTableExists(e.session.CurrentSession(), e.cfg.createKeyspace, e.cfg.keyspace, schema, e.cfg.eventTable)
+	if err != nil {
+		return err
+	}
+
+	e.loadEvents()
+
+	return nil
+}
+
+func (e *EventIdx) Start() {
+	e.wg.Add(1)
+	go e.pollStore()
+}
+
+func (e *EventIdx) Stop() {
+	close(e.shutdown)
+	e.wg.Wait()
+	e.session.Stop()
+}
+
+func (e *EventIdx) pollStore() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.cfg.pollInterval)
+	for {
+		select {
+		case <-e.shutdown:
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			e.loadEvents()
+		}
+	}
+}
+
+// loadEvents reads all events within the retention from cassandra and replaces the events
+// of each org in the memory index with them
+func (e *EventIdx) loadEvents() {
+	now := time.Now()
+	q := fmt.Sprintf("SELECT orgid, id, ts, what, data, tags FROM %s", e.cfg.eventTable)
+
+	session := e.session.CurrentSession()
+	iter := session.Query(q).RetryPolicy(&eventRetryPolicy).Iter()
+	var orgId uint32
+	var event idx.Event
+	byOrg := make(map[uint32][]idx.Event)
+	for iter.Scan(&orgId, &event.Id, &event.When, &event.What, &event.Data, &event.Tags) {
+		// the TTL is only applied by compactions, or the event may predate the retention
+		if !events.Expired(event, e.cfg.retention, now) {
+			byOrg[orgId] = append(byOrg[orgId], event)
+		}
+		event = idx.Event{}
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Errorf("cass-event-idx: Error when loading events: %s", err.Error())
+		return
+	}
+
+	// orgs whose events have all been deleted need to get swapped with an empty set
+	for _, orgId := range e.memoryIdx.Orgs() {
+		if _, ok := byOrg[orgId]; !ok {
+			byOrg[orgId] = nil
+		}
+	}
+
+	for orgId, orgEvents := range byOrg {
+		if err := e.memoryIdx.EventSwap(orgId, orgEvents); err != nil {
+			log.Errorf("cass-event-idx: Error when swapping events of org %d: %s", orgId, err.Error())
+		}
+	}
+}
+
+// ttl returns the TTL in seconds to store the event with, so it expires once it falls out of the retention
+func (e *EventIdx) ttl(event idx.Event) (int64, error) {
+	if e.cfg.retention == 0 {
+		return 0, nil
+	}
+	ttl := event.When + int64(e.cfg.retention/time.Second) - time.Now().Unix()
+	if ttl <= 0 {
+		return 0, events.ErrExpired
+	}
+	return ttl, nil
+}
+
+func (e *EventIdx) EventAdd(orgId uint32, event idx.Event) (idx.Event, error) {
+	if !e.cfg.updateCassIdx {
+		return event, errIdxUpdatesDisabled
+	}
+	if err := events.Validate(event); err != nil {
+		return event, err
+	}
+	ttl, err := e.ttl(event)
+	if err != nil {
+		return event, err
+	}
+	if event.Id == 0 {
+		event.Id = events.NewId()
+	}
+
+	session := e.session.CurrentSession()
+	qry := fmt.Sprintf("INSERT INTO %s (orgid, id, ts, what, data, tags) VALUES (?, ?, ?, ?, ?, ?) USING TTL ?", e.cfg.eventTable)
+	err = session.Query(
+		qry,
+		orgId,
+		event.Id,
+		event.When,
+		event.What,
+		event.Data,
+		event.Tags,
+		ttl,
+	).RetryPolicy(&eventRetryPolicy).Exec()
+	if err != nil {
+		log.Errorf("cass-event-idx: Failed to save event in cassandra: %s", err)
+		return event, fmt.Errorf("Failed to update cassandra: %s", err)
+	}
+
+	return e.memoryIdx.EventAdd(orgId, event)
+}
+
+func (e *EventIdx) EventGet(orgId uint32, id int64) (idx.Event, bool) {
+	return e.memoryIdx.EventGet(orgId, id)
+}
+
+func (e *EventIdx) EventDelete(orgId uint32, id int64) error {
+	if !e.cfg.updateCassIdx {
+		return errIdxUpdatesDisabled
+	}
+
+	session := e.session.CurrentSession()
+	qry := fmt.Sprintf("DELETE FROM %s WHERE orgid=? AND id=?", e.cfg.eventTable)
+	err := session.Query(qry, orgId, id).RetryPolicy(&eventRetryPolicy).Exec()
+	if err != nil {
+		log.Errorf("cass-event-idx: Failed to delete event from cassandra: %s", err)
+		return fmt.Errorf("Failed to update cassandra: %s", err)
+	}
+
+	return e.memoryIdx.EventDelete(orgId, id)
+}
+
+func (e *EventIdx) EventFind(orgId uint32, from, to int64, tags []string) []idx.Event {
+	return e.memoryIdx.EventFind(orgId, from, to, tags)
+}
+
+func (e *EventIdx) EventSwap(orgId uint32, newEvents []idx.Event) error {
+	if !e.cfg.updateCassIdx {
+		return errIdxUpdatesDisabled
+	}
+	ttls := make([]int64, len(newEvents))
+	for i, event := range newEvents {
+		if err := events.Validate(event); err != nil {
+			return err
+		}
+		var err error
+		ttls[i], err = e.ttl(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	session := e.session.CurrentSession()
+	qry := fmt.Sprintf("DELETE FROM %s WHERE orgid=?", e.cfg.eventTable)
+	err := session.Query(qry, orgId).RetryPolicy(&eventRetryPolicy).Exec()
+	if err != nil {
+		return fmt.Errorf("Failed to delete events: %s", err)
+	}
+
+	for i := range newEvents {
+		if newEvents[i].Id == 0 {
+			newEvents[i].Id = events.NewId()
+		}
+		event := newEvents[i]
+		qry := fmt.Sprintf("INSERT INTO %s (orgid, id, ts, what, data, tags) VALUES (?, ?, ?, ?, ?, ?) USING TTL ?", e.cfg.eventTable)
+		err := session.Query(qry, orgId, event.Id, event.When, event.What, event.Data, event.Tags, ttls[i]).RetryPolicy(&eventRetryPolicy).Exec()
+		if err != nil {
+			return fmt.Errorf("Failed to save event: %s", err)
+		}
+	}
+
+	return e.memoryIdx.EventSwap(orgId, newEvents)
+}
@@ -0,0 +1,141 @@
+// Package events provides storage of the per-org graphite-style events,
+// which are used for annotations and by the events() function
+package events
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/metrictank/errors"
+	"github.com/grafana/metrictank/idx"
+)
+
+// EventIdx keeps the events of all orgs in memory.
+// the persistent event indexes (cassandra, bigtable) use it as their cache
+type EventIdx struct {
+	sync.RWMutex
+	byOrg map[uint32]map[int64]idx.Event
+}
+
+func New() *EventIdx {
+	return &EventIdx{
+		byOrg: make(map[uint32]map[int64]idx.Event),
+	}
+}
+
+// NewId generates a new event id.
+// ids are based on the current time in milliseconds, with 10 random bits added to avoid
+// collisions between nodes. they stay below 2^53 so they can be represented by javascript numbers.
+func NewId() int64 {
+	return time.Now().UnixNano()/int64(time.Millisecond)<<10 | rand.Int63n(1<<10)
+}
+
+// ErrExpired is returned when storing an event that is older than the retention
+var ErrExpired = errors.NewBadRequest("event is older than the event retention")
+
+// Expired returns whether the event is older than the given retention.
+// a retention of 0 means events never expire
+func Expired(event idx.Event, retention time.Duration, now time.Time) bool {
+	return retention > 0 && event.When < now.Add(-retention).Unix()
+}
+
+// Validate checks whether the given event is valid
+func Validate(event idx.Event) error {
+	if event.What == "" {
+		return errors.NewBadRequest("event has no 'what'")
+	}
+	if event.When <= 0 {
+		return errors.NewBadRequestf("event has invalid 'when' %d", event.When)
+	}
+	return nil
+}
+
+func (e *EventIdx) EventAdd(orgId uint32, event idx.Event) (idx.Event, error) {
+	if err := Validate(event); err != nil {
+		return event, err
+	}
+	if event.Id == 0 {
+		event.Id = NewId()
+	}
+	e.Lock()
+	defer e.Unlock()
+	events, ok := e.byOrg[orgId]
+	if !ok {
+		events = make(map[int64]idx.Event)
+		e.byOrg[orgId] = events
+	}
+	events[event.Id] = event
+	return event, nil
+}
+
+func (e *EventIdx) EventGet(orgId uint32, id int64) (idx.Event, bool) {
+	e.RLock()
+	defer e.RUnlock()
+	event, ok := e.byOrg[orgId][id]
+	return event, ok
+}
+
+func (e *EventIdx) EventDelete(orgId uint32, id int64) error {
+	e.Lock()
+	defer e.Unlock()
+	events, ok := e.byOrg[orgId]
+	if !ok {
+		return nil
+	}
+	delete(events, id)
+	if len(events) == 0 {
+		delete(e.byOrg, orgId)
+	}
+	return nil
+}
+
+func (e *EventIdx) EventFind(orgId uint32, from, to int64, tags []string) []idx.Event {
+	res := make([]idx.Event, 0)
+	e.RLock()
+	for _, event := range e.byOrg[orgId] {
+		if event.When >= from && event.When < to && event.HasTags(tags) {
+			res = append(res, event)
+		}
+	}
+	e.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].When == res[j].When {
+			return res[i].Id < res[j].Id
+		}
+		return res[i].When < res[j].When
+	})
+	return res
+}
+
+func (e *EventIdx) EventSwap(orgId uint32, events []idx.Event) error {
+	newEvents := make(map[int64]idx.Event, len(events))
+	for _, event := range events {
+		if err := Validate(event); err != nil {
+			return err
+		}
+		newEvents[event.Id] = event
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	if len(newEvents) == 0 {
+		delete(e.byOrg, orgId)
+		return nil
+	}
+	e.byOrg[orgId] = newEvents
+	return nil
+}
+
+// Orgs returns the ids of all orgs which have at least one event
+func (e *EventIdx) Orgs() []uint32 {
+	e.RLock()
+	defer e.RUnlock()
+	res := make([]uint32, 0, len(e.byOrg))
+	for orgId := range e.byOrg {
+		res = append(res, orgId)
+	}
+	return res
+}
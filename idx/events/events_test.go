@@ -0,0 +1,99 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/idx"
+)
+
+func TestEventIdx(t *testing.T) {
+	e := New()
+
+	deploy, err := e.EventAdd(1, idx.Event{When: 100, What: "deploy", Tags: []string{"deploy", "api"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if deploy.Id == 0 {
+		t.Fatalf("expected event to get an id assigned")
+	}
+	outage, err := e.EventAdd(1, idx.Event{Id: 5, When: 50, What: "outage", Data: "db down", Tags: []string{"outage"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if outage.Id != 5 {
+		t.Fatalf("expected given id to be kept, got %d", outage.Id)
+	}
+	other, err := e.EventAdd(2, idx.Event{When: 100, What: "deploy", Tags: []string{"deploy"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := e.EventAdd(1, idx.Event{When: 100}); err == nil {
+		t.Fatalf("expected error when adding event without what")
+	}
+	if _, err := e.EventAdd(1, idx.Event{What: "deploy"}); err == nil {
+		t.Fatalf("expected error when adding event without when")
+	}
+
+	if got := e.EventFind(1, 0, 200, nil); !reflect.DeepEqual(got, []idx.Event{outage, deploy}) {
+		t.Fatalf("unexpected events of org 1: %v", got)
+	}
+	if got := e.EventFind(1, 0, 100, nil); !reflect.DeepEqual(got, []idx.Event{outage}) {
+		t.Fatalf("expected 'to' to be exclusive, got %v", got)
+	}
+	if got := e.EventFind(1, 0, 200, []string{"api", "deploy"}); !reflect.DeepEqual(got, []idx.Event{deploy}) {
+		t.Fatalf("unexpected events of org 1 with tags api and deploy: %v", got)
+	}
+	if got := e.EventFind(1, 0, 200, []string{"api", "outage"}); len(got) != 0 {
+		t.Fatalf("expected no events with tags api and outage, got %v", got)
+	}
+	if got, ok := e.EventGet(2, other.Id); !ok || !reflect.DeepEqual(got, other) {
+		t.Fatalf("expected to get event %d of org 2, got %v (%t)", other.Id, got, ok)
+	}
+	if _, ok := e.EventGet(2, outage.Id); ok {
+		t.Fatalf("expected event %d to not exist in org 2", outage.Id)
+	}
+
+	if err := e.EventDelete(1, deploy.Id); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := e.EventFind(1, 0, 200, nil); !reflect.DeepEqual(got, []idx.Event{outage}) {
+		t.Fatalf("unexpected events of org 1 after delete: %v", got)
+	}
+
+	if err := e.EventSwap(2, []idx.Event{outage}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := e.EventFind(2, 0, 200, nil); !reflect.DeepEqual(got, []idx.Event{outage}) {
+		t.Fatalf("unexpected events of org 2 after swap: %v", got)
+	}
+	if err := e.EventSwap(2, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := e.Orgs(); !reflect.DeepEqual(got, []uint32{1}) {
+		t.Fatalf("expected only org 1 to have events, got %v", got)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Unix(10000, 0)
+	cases := []struct {
+		when      int64
+		retention time.Duration
+		exp       bool
+	}{
+		{9000, 0, false},
+		{1, 0, false},
+		{9000, time.Hour, false},
+		{10000 - 3600, time.Hour, false},
+		{10000 - 3601, time.Hour, true},
+		{1, time.Hour, true},
+	}
+	for _, c := range cases {
+		if got := Expired(idx.Event{When: c.when}, c.retention, now); got != c.exp {
+			t.Fatalf("when %d, retention %s: expected expired %t, got %t", c.when, c.retention, c.exp, got)
+		}
+	}
+}
@@ -153,6 +153,22 @@ type MetricIndex interface {
 	DeleteTagged(orgId uint32, query tagquery.Query) ([]Archive, error)
 }
 
+// BatchIdx is implemented by indexes that can return the results of some queries in batches,
+// e.g. per partition, so that they can be streamed to a peer without building the full result first.
+// fn is called with each batch, without holding any index locks. The batches together contain the same
+// results as the corresponding MetricIndex method, except that they are not deduplicated or sorted.
+// If fn returns an error, no more batches are returned and the error is returned.
+type BatchIdx interface {
+	// ListFunc is like MetricIndex.List
+	ListFunc(orgId uint32, fn func([]Archive) error) error
+
+	// FindByTagFunc is like MetricIndex.FindByTag
+	FindByTagFunc(orgId uint32, query tagquery.Query, fn func([]Node) error) error
+
+	// TagsFunc is like MetricIndex.Tags
+	TagsFunc(orgId uint32, filter *regexp.Regexp, fn func([]string) error) error
+}
+
 type MetaRecordIdx interface {
 	// MetaTagRecordUpsert inserts, updates or deletes a meta record, depending on
 	// whether it already exists or is new. The identity of a record is determined
@@ -0,0 +1,30 @@
+package idx
+
+// Macro is a named, parametrized graphite expression which can be referenced
+// in queries via macro("name", args...)
+type Macro struct {
+	Name   string   `json:"name"`
+	Params []string `json:"params"`
+	Expr   string   `json:"expr"`
+}
+
+type MacroIdx interface {
+	// MacroUpsert inserts the given macro, or replaces the existing one
+	// with the same name.
+	MacroUpsert(orgId uint32, macro Macro) error
+
+	// MacroDelete deletes the macro with the given name. Deleting a macro
+	// which doesn't exist is not an error.
+	MacroDelete(orgId uint32, name string) error
+
+	// MacroList takes an org id and returns the list of all macros
+	// of that given org, sorted by name.
+	MacroList(orgId uint32) []Macro
+
+	// MacroGet returns the macro with the given name and whether it exists.
+	MacroGet(orgId uint32, name string) (Macro, bool)
+
+	// MacroSwap takes a set of macros and completely replaces the existing
+	// ones of the given org with the new ones.
+	MacroSwap(orgId uint32, macros []Macro) error
+}
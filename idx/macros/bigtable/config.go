@@ -0,0 +1,64 @@
+package bigtable
+
+import (
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/grafana/globalconf"
+	log "github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	Enabled          bool
+	gcpProject       string
+	bigtableInstance string
+	tableName        string
+	macroCf          string
+	pollInterval     time.Duration
+	updateMacros     bool
+	createCf         bool
+}
+
+func (cfg *Config) Validate() error {
+	if cfg.pollInterval == 0 {
+		return errors.New("poll-interval must be greater than 0")
+	}
+	return nil
+}
+
+// return Config with default values set.
+func NewConfig() *Config {
+	return &Config{
+		Enabled:          false,
+		gcpProject:       "default",
+		bigtableInstance: "default",
+		tableName:        "macros",
+		macroCf:          "m", // currently not configurable
+		pollInterval:     time.Second * 10,
+		updateMacros:     true,
+		createCf:         true,
+	}
+}
+
+var CliConfig = NewConfig()
+
+func ConfigSetup() {
+	btIdx := flag.NewFlagSet("bigtable-macro-idx", flag.ExitOnError)
+
+	btIdx.BoolVar(&CliConfig.Enabled, "enabled", CliConfig.Enabled, "")
+	btIdx.StringVar(&CliConfig.gcpProject, "gcp-project", CliConfig.gcpProject, "Name of GCP project the bigtable cluster resides in")
+	btIdx.StringVar(&CliConfig.bigtableInstance, "bigtable-instance", CliConfig.bigtableInstance, "Name of bigtable instance")
+	btIdx.StringVar(&CliConfig.tableName, "table-name", CliConfig.tableName, "Table to store macros")
+	btIdx.DurationVar(&CliConfig.pollInterval, "poll-interval", CliConfig.pollInterval, "Interval at which to poll store for macro updates")
+	btIdx.BoolVar(&CliConfig.updateMacros, "update-macros", CliConfig.updateMacros, "Synchronize macro changes to bigtable. not all your nodes need to do this")
+	btIdx.BoolVar(&CliConfig.createCf, "create-cf", CliConfig.createCf, "Enable the creation of the table and column families")
+
+	globalconf.Register("bigtable-macro-idx", btIdx, flag.ExitOnError)
+}
+
+func ConfigProcess() {
+	if err := CliConfig.Validate(); err != nil {
+		log.Fatalf("bt-macro-idx: Config validation error. %s", err)
+	}
+}
@@ -0,0 +1,273 @@
+package bigtable
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	btUtils "github.com/grafana/metrictank/bigtable"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/idx/macros"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errIdxUpdatesDisabled = fmt.Errorf("BigTable macro updates are disabled")
+)
+
+// MacroIdx persists macros in bigtable and periodically loads them
+// into the wrapped memory macro index, which serves all reads
+type MacroIdx struct {
+	wg          sync.WaitGroup
+	shutdown    chan struct{}
+	cfg         *Config
+	memoryIdx   *macros.MacroIdx
+	client      *bigtable.Client
+	adminClient *bigtable.AdminClient
+	macroTable  *bigtable.Table
+}
+
+func NewBigTableMacroIdx(cfg *Config, memoryIdx *macros.MacroIdx) *MacroIdx {
+	return &MacroIdx{
+		shutdown:  make(chan struct{}),
+		cfg:       cfg,
+		memoryIdx: memoryIdx,
+	}
+}
+
+func (m *MacroIdx) Init() error {
+	ctx := context.Background()
+	err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = btUtils.EnsureTableExists(ctx, m.cfg.createCf, m.adminClient, m.cfg.tableName, map[string]bigtable.GCPolicy{
+		m.cfg.macroCf: bigtable.MaxVersionsPolicy(1),
+	})
+	if err != nil {
+		return err
+	}
+
+	m.macroTable = m.client.Open(m.cfg.tableName)
+	m.loadMacros()
+
+	return nil
+}
+
+func (m *MacroIdx) connect(ctx context.Context) error {
+	var err error
+	m.client, err = bigtable.NewClient(ctx, m.cfg.gcpProject, m.cfg.bigtableInstance)
+	if err != nil {
+		log.Errorf("bt-macro-idx: failed to create bigtable client: %s", err)
+		return err
+	}
+
+	m.adminClient, err = bigtable.NewAdminClient(ctx, m.cfg.gcpProject, m.cfg.bigtableInstance)
+	if err != nil {
+		log.Errorf("bt-macro-idx: failed to create bigtable admin client: %s", err)
+	}
+
+	return err
+}
+
+func (m *MacroIdx) Start() {
+	m.wg.Add(1)
+	go m.pollBigtable()
+}
+
+func (m *MacroIdx) Stop() {
+	close(m.shutdown)
+	m.wg.Wait()
+	m.client.Close()
+	m.adminClient.Close()
+}
+
+func (m *MacroIdx) pollBigtable() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.cfg.pollInterval)
+	for {
+		select {
+		case <-m.shutdown:
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			m.loadMacros()
+		}
+	}
+}
+
+// loadMacros reads all macros from bigtable and replaces the macros
+// of each org in the memory index with them
+func (m *MacroIdx) loadMacros() {
+	byOrg := make(map[uint32][]idx.Macro)
+	err := m.macroTable.ReadRows(context.Background(), bigtable.InfiniteRange(""), func(row bigtable.Row) bool {
+		orgId, name, err := decodeMacroRowKey(row.Key())
+		if err != nil {
+			log.Errorf("bt-macro-idx: Failed to decode macro row key %q: %s", row.Key(), err)
+			return true
+		}
+
+		columns, ok := row[m.cfg.macroCf]
+		if !ok {
+			log.Errorf("bt-macro-idx: Row from macro table was missing expected column family %s", m.cfg.macroCf)
+			return true
+		}
+
+		macro := idx.Macro{Name: name}
+		for _, col := range columns {
+			switch strings.SplitN(col.Column, ":", 2)[1] {
+			case "params":
+				err = json.Unmarshal(col.Value, &macro.Params)
+				if err != nil {
+					log.Errorf("bt-macro-idx: Row from macro table contained invalid params value %q: %s", col.Value, err)
+					return true
+				}
+			case "expr":
+				macro.Expr = string(col.Value)
+			}
+		}
+
+		byOrg[orgId] = append(byOrg[orgId], macro)
+		return true
+	}, bigtable.RowFilter(bigtable.ChainFilters(bigtable.FamilyFilter(m.cfg.macroCf), bigtable.LatestNFilter(1))))
+
+	if err != nil {
+		log.Errorf("bt-macro-idx: Failed to load macros: %s", err)
+		return
+	}
+
+	// orgs whose macros have all been deleted need to get swapped with an empty set
+	for _, orgId := range m.memoryIdx.Orgs() {
+		if _, ok := byOrg[orgId]; !ok {
+			byOrg[orgId] = nil
+		}
+	}
+
+	for orgId, orgMacros := range byOrg {
+		if err := m.memoryIdx.MacroSwap(orgId, orgMacros); err != nil {
+			log.Errorf("bt-macro-idx: Error when swapping macros of org %d: %s", orgId, err)
+		}
+	}
+}
+
+func formatMacroRowKey(orgId uint32, name string) string {
+	return strconv.Itoa(int(orgId)) + "_" + name
+}
+
+func decodeMacroRowKey(key string) (uint32, string, error) {
+	parts := strings.SplitN(key, "_", 2)
+	if len(parts) < 2 {
+		return 0, "", fmt.Errorf("Invalid row key format: %q", key)
+	}
+	orgId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("Invalid org id %q in row key: %q", parts[0], key)
+	}
+	return uint32(orgId), parts[1], nil
+}
+
+func (m *MacroIdx) macroMutation(macro idx.Macro) (*bigtable.Mutation, error) {
+	params, err := json.Marshal(macro.Params)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal params: %s", err)
+	}
+	mut := bigtable.NewMutation()
+	mut.Set(m.cfg.macroCf, "params", bigtable.Now(), params)
+	mut.Set(m.cfg.macroCf, "expr", bigtable.Now(), []byte(macro.Expr))
+	return mut, nil
+}
+
+func (m *MacroIdx) MacroUpsert(orgId uint32, macro idx.Macro) error {
+	if !m.cfg.updateMacros {
+		return errIdxUpdatesDisabled
+	}
+	if err := macros.Validate(macro); err != nil {
+		return err
+	}
+
+	mut, err := m.macroMutation(macro)
+	if err != nil {
+		return err
+	}
+	err = m.macroTable.Apply(context.Background(), formatMacroRowKey(orgId, macro.Name), mut)
+	if err != nil {
+		log.Errorf("bt-macro-idx: Failed to persist macro %d/%s: %s", orgId, macro.Name, err)
+		return fmt.Errorf("Failed to update bigtable: %s", err)
+	}
+
+	return m.memoryIdx.MacroUpsert(orgId, macro)
+}
+
+func (m *MacroIdx) MacroDelete(orgId uint32, name string) error {
+	if !m.cfg.updateMacros {
+		return errIdxUpdatesDisabled
+	}
+
+	mut := bigtable.NewMutation()
+	mut.DeleteRow()
+	err := m.macroTable.Apply(context.Background(), formatMacroRowKey(orgId, name), mut)
+	if err != nil {
+		log.Errorf("bt-macro-idx: Failed to delete macro %d/%s: %s", orgId, name, err)
+		return fmt.Errorf("Failed to update bigtable: %s", err)
+	}
+
+	return m.memoryIdx.MacroDelete(orgId, name)
+}
+
+func (m *MacroIdx) MacroList(orgId uint32) []idx.Macro {
+	return m.memoryIdx.MacroList(orgId)
+}
+
+func (m *MacroIdx) MacroGet(orgId uint32, name string) (idx.Macro, bool) {
+	return m.memoryIdx.MacroGet(orgId, name)
+}
+
+func (m *MacroIdx) MacroSwap(orgId uint32, newMacros []idx.Macro) error {
+	if !m.cfg.updateMacros {
+		return errIdxUpdatesDisabled
+	}
+
+	rowKeys := make([]string, len(newMacros))
+	muts := make([]*bigtable.Mutation, len(newMacros))
+	for i, macro := range newMacros {
+		if err := macros.Validate(macro); err != nil {
+			return err
+		}
+		var err error
+		muts[i], err = m.macroMutation(macro)
+		if err != nil {
+			return err
+		}
+		rowKeys[i] = formatMacroRowKey(orgId, macro.Name)
+	}
+
+	// unfortunately dropping a row range requires using the admin client
+	err := m.adminClient.DropRowRange(context.Background(), m.cfg.tableName, formatMacroRowKey(orgId, ""))
+	if err != nil {
+		log.Errorf("bt-macro-idx: Failed to drop macros of org %d: %s", orgId, err)
+		return err
+	}
+
+	if len(muts) > 0 {
+		errs, err := m.macroTable.ApplyBulk(context.Background(), rowKeys, muts)
+		if err != nil {
+			log.Errorf("bt-macro-idx: Failed to apply macros in bulk: %s", err)
+			return err
+		}
+		for _, err = range errs {
+			if err != nil {
+				log.Errorf("bt-macro-idx: One or multiple errors when storing %d macros, first error: %s", len(rowKeys), err)
+				return err
+			}
+		}
+	}
+
+	return m.memoryIdx.MacroSwap(orgId, newMacros)
+}
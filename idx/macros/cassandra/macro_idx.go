@@ -0,0 +1,240 @@
+package cassandra
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	cassUtils "github.com/grafana/metrictank/cassandra"
+	"github.com/grafana/metrictank/idx"
+	"github.com/grafana/metrictank/idx/macros"
+	"github.com/grafana/metrictank/util"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// try executing each query 10 times
+	// when a query fails we retry 9 times with the following sleep times in-between
+	// 100ms, 200ms, 400ms, 800ms, 1.6s, 3.2s, 6.4s, 12.8s, 20s
+	// the total time to fail is 45.5s, which is less than the default http timeout
+	macroRetryPolicy = gocql.ExponentialBackoffRetryPolicy{
+		NumRetries: 9,
+		Min:        time.Millisecond * time.Duration(100),
+		Max:        time.Second * time.Duration(20),
+	}
+
+	errIdxUpdatesDisabled = fmt.Errorf("Cassandra macro updates are disabled")
+)
+
+// MacroIdx persists macros in cassandra and periodically loads them
+// into the wrapped memory macro index, which serves all reads
+type MacroIdx struct {
+	wg        sync.WaitGroup
+	shutdown  chan struct{}
+	cfg       *Config
+	memoryIdx *macros.MacroIdx
+	cluster   *gocql.ClusterConfig
+	session   *cassUtils.Session
+}
+
+func NewCassandraMacroIdx(cfg *Config, memoryIdx *macros.MacroIdx) *MacroIdx {
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("cass-macro-idx: %s", err)
+	}
+	cluster := gocql.NewCluster(strings.Split(cfg.hosts, ",")...)
+	cluster.Consistency = gocql.ParseConsistency(cfg.consistency)
+	cluster.Keyspace = cfg.keyspace
+	cluster.Timeout = cfg.timeout
+	cluster.ConnectTimeout = cluster.Timeout
+	cluster.NumConns = cfg.numConns
+	cluster.ProtoVersion = cfg.protoVer
+	cluster.DisableInitialHostLookup = cfg.disableInitialHostLookup
+	if cfg.ssl {
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 cfg.caPath,
+			EnableHostVerification: cfg.hostVerification,
+		}
+	}
+	if cfg.auth {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: cfg.username,
+			Password: cfg.password,
+		}
+	}
+
+	return &MacroIdx{
+		shutdown:  make(chan struct{}),
+		cfg:       cfg,
+		memoryIdx: memoryIdx,
+		cluster:   cluster,
+	}
+}
+
+func (m *MacroIdx) Init() error {
+	var err error
+	m.session, err = cassUtils.NewSession(m.cluster, m.cfg.connectionCheckTimeout, m.cfg.connectionCheckInterval, m.cfg.hosts, "cass-macro-idx")
+	if err != nil {
+		return fmt.Errorf("cass-macro-idx: Failed to create cassandra session: %s", err)
+	}
+
+	schema := fmt.Sprintf(util.ReadEntry(m.cfg.schemaFile, "schema_macro_table").(string), m.cfg.keyspace, m.cfg.macroTable)
+	err = cassUtils.EnsureTableExists(m.session.CurrentSession(), m.cfg.createKeyspace, m.cfg.keyspace, schema, m.cfg.macroTable)
+	if err != nil {
+		return err
+	}
+
+	m.loadMacros()
+
+	return nil
+}
+
+func (m *MacroIdx) Start() {
+	m.wg.Add(1)
+	go m.pollStore()
+}
+
+func (m *MacroIdx) Stop() {
+	close(m.shutdown)
+	m.wg.Wait()
+	m.session.Stop()
+}
+
+func (m *MacroIdx) pollStore() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.cfg.pollInterval)
+	for {
+		select {
+		case <-m.shutdown:
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			m.loadMacros()
+		}
+	}
+}
+
+// loadMacros reads all macros from cassandra and replaces the macros
+// of each org in the memory index with them
+func (m *MacroIdx) loadMacros() {
+	q := fmt.Sprintf("SELECT orgid, name, params, expr FROM %s", m.cfg.macroTable)
+
+	session := m.session.CurrentSession()
+	iter := session.Query(q).RetryPolicy(&macroRetryPolicy).Iter()
+	var orgId uint32
+	var name, params, expr string
+	byOrg := make(map[uint32][]idx.Macro)
+	for iter.Scan(&orgId, &name, &params, &expr) {
+		macro := idx.Macro{Name: name, Expr: expr}
+		err := json.Unmarshal([]byte(params), &macro.Params)
+		if err != nil {
+			log.Errorf("cass-macro-idx: loadMacros() could not parse stored params (%s) of macro %d/%s: %s", params, orgId, name, err)
+			continue
+		}
+		byOrg[orgId] = append(byOrg[orgId], macro)
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Errorf("cass-macro-idx: Error when loading macros: %s", err.Error())
+		return
+	}
+
+	// orgs whose macros have all been deleted need to get swapped with an empty set
+	for _, orgId := range m.memoryIdx.Orgs() {
+		if _, ok := byOrg[orgId]; !ok {
+			byOrg[orgId] = nil
+		}
+	}
+
+	for orgId, orgMacros := range byOrg {
+		if err := m.memoryIdx.MacroSwap(orgId, orgMacros); err != nil {
+			log.Errorf("cass-macro-idx: Error when swapping macros of org %d: %s", orgId, err.Error())
+		}
+	}
+}
+
+func (m *MacroIdx) MacroUpsert(orgId uint32, macro idx.Macro) error {
+	if !m.cfg.updateCassIdx {
+		return errIdxUpdatesDisabled
+	}
+	if err := macros.Validate(macro); err != nil {
+		return err
+	}
+
+	if err := m.persistMacro(orgId, macro); err != nil {
+		log.Errorf("cass-macro-idx: Failed to save macro in cassandra: %s", err)
+		return fmt.Errorf("Failed to update cassandra: %s", err)
+	}
+
+	return m.memoryIdx.MacroUpsert(orgId, macro)
+}
+
+func (m *MacroIdx) MacroDelete(orgId uint32, name string) error {
+	if !m.cfg.updateCassIdx {
+		return errIdxUpdatesDisabled
+	}
+
+	session := m.session.CurrentSession()
+	qry := fmt.Sprintf("DELETE FROM %s WHERE orgid=? AND name=?", m.cfg.macroTable)
+	err := session.Query(qry, orgId, name).RetryPolicy(&macroRetryPolicy).Exec()
+	if err != nil {
+		log.Errorf("cass-macro-idx: Failed to delete macro from cassandra: %s", err)
+		return fmt.Errorf("Failed to update cassandra: %s", err)
+	}
+
+	return m.memoryIdx.MacroDelete(orgId, name)
+}
+
+func (m *MacroIdx) MacroList(orgId uint32) []idx.Macro {
+	return m.memoryIdx.MacroList(orgId)
+}
+
+func (m *MacroIdx) MacroGet(orgId uint32, name string) (idx.Macro, bool) {
+	return m.memoryIdx.MacroGet(orgId, name)
+}
+
+func (m *MacroIdx) MacroSwap(orgId uint32, newMacros []idx.Macro) error {
+	if !m.cfg.updateCassIdx {
+		return errIdxUpdatesDisabled
+	}
+	for _, macro := range newMacros {
+		if err := macros.Validate(macro); err != nil {
+			return err
+		}
+	}
+
+	session := m.session.CurrentSession()
+	qry := fmt.Sprintf("DELETE FROM %s WHERE orgid=?", m.cfg.macroTable)
+	err := session.Query(qry, orgId).RetryPolicy(&macroRetryPolicy).Exec()
+	if err != nil {
+		return fmt.Errorf("Failed to delete macros: %s", err)
+	}
+
+	for _, macro := range newMacros {
+		if err := m.persistMacro(orgId, macro); err != nil {
+			return fmt.Errorf("Failed to save macro: %s", err)
+		}
+	}
+
+	return m.memoryIdx.MacroSwap(orgId, newMacros)
+}
+
+func (m *MacroIdx) persistMacro(orgId uint32, macro idx.Macro) error {
+	params, err := json.Marshal(macro.Params)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal params: %s", err)
+	}
+
+	session := m.session.CurrentSession()
+	qry := fmt.Sprintf("INSERT INTO %s (orgid, name, params, expr) VALUES (?, ?, ?, ?)", m.cfg.macroTable)
+	return session.Query(
+		qry,
+		orgId,
+		macro.Name,
+		string(params),
+		macro.Expr,
+	).RetryPolicy(&macroRetryPolicy).Exec()
+}
@@ -0,0 +1,143 @@
+// Package macros provides storage of the per-org macros that can be
+// referenced in graphite queries via macro("name", args...)
+package macros
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/grafana/metrictank/errors"
+	"github.com/grafana/metrictank/idx"
+)
+
+// MacroIdx keeps the macros of all orgs in memory.
+// the persistent macro indexes (cassandra, bigtable) use it as their cache
+type MacroIdx struct {
+	sync.RWMutex
+	byOrg map[uint32]map[string]idx.Macro
+}
+
+func New() *MacroIdx {
+	return &MacroIdx{
+		byOrg: make(map[uint32]map[string]idx.Macro),
+	}
+}
+
+// Validate checks whether the name and the params of the given macro are valid.
+// it does not validate the expression, which is up to the caller
+func Validate(macro idx.Macro) error {
+	if !validName(macro.Name) {
+		return errors.NewBadRequestf("invalid macro name %q", macro.Name)
+	}
+	if macro.Expr == "" {
+		return errors.NewBadRequestf("macro %q has no expression", macro.Name)
+	}
+	seen := make(map[string]struct{}, len(macro.Params))
+	for _, param := range macro.Params {
+		if !validName(param) {
+			return errors.NewBadRequestf("macro %q has invalid parameter name %q", macro.Name, param)
+		}
+		if _, ok := seen[param]; ok {
+			return errors.NewBadRequestf("macro %q has duplicate parameter %q", macro.Name, param)
+		}
+		seen[param] = struct{}{}
+	}
+	return nil
+}
+
+// validName returns whether the given string is a valid name for a macro or a macro parameter
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r == '-' || r == '.' ||
+			'a' <= r && r <= 'z' ||
+			'A' <= r && r <= 'Z' ||
+			'0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MacroIdx) MacroUpsert(orgId uint32, macro idx.Macro) error {
+	if err := Validate(macro); err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	macros, ok := m.byOrg[orgId]
+	if !ok {
+		macros = make(map[string]idx.Macro)
+		m.byOrg[orgId] = macros
+	}
+	macros[macro.Name] = macro
+	return nil
+}
+
+func (m *MacroIdx) MacroDelete(orgId uint32, name string) error {
+	m.Lock()
+	defer m.Unlock()
+	macros, ok := m.byOrg[orgId]
+	if !ok {
+		return nil
+	}
+	delete(macros, name)
+	if len(macros) == 0 {
+		delete(m.byOrg, orgId)
+	}
+	return nil
+}
+
+func (m *MacroIdx) MacroList(orgId uint32) []idx.Macro {
+	m.RLock()
+	res := make([]idx.Macro, 0, len(m.byOrg[orgId]))
+	for _, macro := range m.byOrg[orgId] {
+		res = append(res, macro)
+	}
+	m.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func (m *MacroIdx) MacroGet(orgId uint32, name string) (idx.Macro, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	macro, ok := m.byOrg[orgId][name]
+	return macro, ok
+}
+
+func (m *MacroIdx) MacroSwap(orgId uint32, macros []idx.Macro) error {
+	newMacros := make(map[string]idx.Macro, len(macros))
+	for _, macro := range macros {
+		if err := Validate(macro); err != nil {
+			return err
+		}
+		if _, ok := newMacros[macro.Name]; ok {
+			return errors.NewBadRequestf("duplicate macro %q", macro.Name)
+		}
+		newMacros[macro.Name] = macro
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if len(newMacros) == 0 {
+		delete(m.byOrg, orgId)
+		return nil
+	}
+	m.byOrg[orgId] = newMacros
+	return nil
+}
+
+// Orgs returns the ids of all orgs which have at least one macro
+func (m *MacroIdx) Orgs() []uint32 {
+	m.RLock()
+	defer m.RUnlock()
+	res := make([]uint32, 0, len(m.byOrg))
+	for orgId := range m.byOrg {
+		res = append(res, orgId)
+	}
+	return res
+}
@@ -0,0 +1,83 @@
+package macros
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/metrictank/idx"
+)
+
+func TestMacroIdx(t *testing.T) {
+	m := New()
+
+	foo := idx.Macro{Name: "foo", Params: []string{"a"}, Expr: "sum($a)"}
+	bar := idx.Macro{Name: "bar", Expr: "a.b.c"}
+
+	if err := m.MacroUpsert(1, foo); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := m.MacroUpsert(1, bar); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := m.MacroUpsert(2, bar); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := m.MacroList(1); !reflect.DeepEqual(got, []idx.Macro{bar, foo}) {
+		t.Fatalf("unexpected macros of org 1: %v", got)
+	}
+	if got, ok := m.MacroGet(2, "bar"); !ok || !reflect.DeepEqual(got, bar) {
+		t.Fatalf("expected to get macro bar of org 2, got %v (%t)", got, ok)
+	}
+	if _, ok := m.MacroGet(2, "foo"); ok {
+		t.Fatalf("expected macro foo to not exist in org 2")
+	}
+
+	updated := idx.Macro{Name: "foo", Params: []string{"a"}, Expr: "avg($a)"}
+	if err := m.MacroUpsert(1, updated); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, _ := m.MacroGet(1, "foo"); !reflect.DeepEqual(got, updated) {
+		t.Fatalf("expected macro foo to be updated, got %v", got)
+	}
+
+	if err := m.MacroDelete(1, "bar"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := m.MacroList(1); !reflect.DeepEqual(got, []idx.Macro{updated}) {
+		t.Fatalf("unexpected macros of org 1 after delete: %v", got)
+	}
+
+	if err := m.MacroSwap(2, []idx.Macro{foo}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := m.MacroList(2); !reflect.DeepEqual(got, []idx.Macro{foo}) {
+		t.Fatalf("unexpected macros of org 2 after swap: %v", got)
+	}
+	if err := m.MacroSwap(2, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := m.Orgs(); !reflect.DeepEqual(got, []uint32{1}) {
+		t.Fatalf("expected only org 1 to have macros, got %v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		macro idx.Macro
+		valid bool
+	}{
+		{idx.Macro{Name: "egress_bits", Params: []string{"dc"}, Expr: "a.$dc"}, true},
+		{idx.Macro{Name: "", Expr: "a"}, false},
+		{idx.Macro{Name: "foo bar", Expr: "a"}, false},
+		{idx.Macro{Name: "foo", Expr: ""}, false},
+		{idx.Macro{Name: "foo", Params: []string{"a", "a"}, Expr: "$a"}, false},
+		{idx.Macro{Name: "foo", Params: []string{"$a"}, Expr: "$a"}, false},
+	}
+	for i, c := range cases {
+		err := Validate(c.macro)
+		if c.valid != (err == nil) {
+			t.Fatalf("case %d: expected valid=%t, got error %v", i, c.valid, err)
+		}
+	}
+}
@@ -133,6 +133,7 @@ func ConfigProcess() {
 type MemoryIndex interface {
 	idx.MetricIndex
 	idx.MetaRecordIdx
+	idx.BatchIdx
 	LoadPartition(int32, []schema.MetricDefinition) int
 	UpdateArchiveLastSave(schema.MKey, int32, uint32)
 	add(*idx.Archive)
@@ -575,7 +576,7 @@ func (m *UnpartitionedMemoryIdx) Load(defs []schema.MetricDefinition) int {
 
 func createArchive(def *schema.MetricDefinition) *idx.Archive {
 	path := def.NameWithTags()
-	schemaId, _ := mdata.MatchSchema(path, def.Interval)
+	schemaId, _ := mdata.MatchSchemaOrg(def.OrgId, path, def.Interval)
 	aggId, _ := mdata.MatchAgg(path)
 	irId, _ := IndexRules.Match(path)
 
@@ -1480,6 +1481,21 @@ func (m *UnpartitionedMemoryIdx) List(orgId uint32) []idx.Archive {
 	return defs
 }
 
+// ListFunc calls fn with the result of List, as a single batch
+func (m *UnpartitionedMemoryIdx) ListFunc(orgId uint32, fn func([]idx.Archive) error) error {
+	return fn(m.List(orgId))
+}
+
+// FindByTagFunc calls fn with the result of FindByTag, as a single batch
+func (m *UnpartitionedMemoryIdx) FindByTagFunc(orgId uint32, query tagquery.Query, fn func([]idx.Node) error) error {
+	return fn(m.FindByTag(orgId, query))
+}
+
+// TagsFunc calls fn with the result of Tags, as a single batch
+func (m *UnpartitionedMemoryIdx) TagsFunc(orgId uint32, filter *regexp.Regexp, fn func([]string) error) error {
+	return fn(m.Tags(orgId, filter))
+}
+
 func (m *UnpartitionedMemoryIdx) DeleteTagged(orgId uint32, query tagquery.Query) ([]idx.Archive, error) {
 	if !TagSupport {
 		log.Warn("memory-idx: received tag query, but tag support is disabled")
@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"regexp"
@@ -1675,3 +1676,69 @@ func BenchmarkAddingMetaRecordsToIdxWith100kMetrics(b *testing.B) {
 
 	waitForMetaTagEnrichers(b, ix)
 }
+
+func TestBatchFuncs(t *testing.T) {
+	withAndWithoutPartitionedIndex(testBatchFuncs)(t)
+}
+
+func testBatchFuncs(t *testing.T) {
+	_tagSupport := TagSupport
+	defer func() { TagSupport = _tagSupport }()
+	TagSupport = true
+
+	ix := New()
+	ix.Init()
+	defer ix.Stop()
+
+	for _, s := range getMetricData(1, 2, 50, 10, "metric.batch", true) {
+		mkey, _ := schema.MKeyFromString(s.Id)
+		ix.AddOrUpdate(mkey, s, getPartition(s))
+	}
+
+	var defs int
+	ix.ListFunc(1, func(batch []idx.Archive) error {
+		defs += len(batch)
+		return nil
+	})
+	if exp := len(ix.List(1)); defs != exp {
+		t.Fatalf("expected %d defs in the batches, got %d", exp, defs)
+	}
+
+	query := parseQueryMustCompile(t, []string{"series_id=~[0-9]+"})
+	var nodes int
+	ix.FindByTagFunc(1, query, func(batch []idx.Node) error {
+		nodes += len(batch)
+		return nil
+	})
+	if exp := len(ix.FindByTag(1, query)); nodes != exp || nodes != 50 {
+		t.Fatalf("expected %d (50) nodes in the batches, got %d", exp, nodes)
+	}
+
+	tags := make(map[string]struct{})
+	ix.TagsFunc(1, nil, func(batch []string) error {
+		for _, tag := range batch {
+			tags[tag] = struct{}{}
+		}
+		return nil
+	})
+	exp := ix.Tags(1, nil)
+	if len(tags) != len(exp) {
+		t.Fatalf("expected tags %v in the batches, got %v", exp, tags)
+	}
+	for _, tag := range exp {
+		if _, ok := tags[tag]; !ok {
+			t.Fatalf("expected tag %q in the batches, got %v", tag, tags)
+		}
+	}
+
+	// an error aborts the batches
+	errStop := errors.New("stop")
+	var calls int
+	err := ix.ListFunc(1, func(batch []idx.Archive) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Fatalf("expected the error to be returned after the first batch, got %v after %d batches", err, calls)
+	}
+}
@@ -255,6 +255,37 @@ func (p *PartitionedMemoryIdx) List(orgId uint32) []idx.Archive {
 	return response
 }
 
+// ListFunc calls fn with the Archives of each partition, one partition at a time
+func (p *PartitionedMemoryIdx) ListFunc(orgId uint32, fn func([]idx.Archive) error) error {
+	for _, m := range p.Partition {
+		if err := fn(m.List(orgId)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindByTagFunc calls fn with the Nodes of each partition matching the query, one partition at a time
+func (p *PartitionedMemoryIdx) FindByTagFunc(orgId uint32, query tagquery.Query, fn func([]idx.Node) error) error {
+	for _, m := range p.Partition {
+		if err := fn(m.FindByTag(orgId, query)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TagsFunc calls fn with the tag keys of each partition, one partition at a time.
+// tag keys that exist in multiple partitions are returned multiple times.
+func (p *PartitionedMemoryIdx) TagsFunc(orgId uint32, filter *regexp.Regexp, fn func([]string) error) error {
+	for _, m := range p.Partition {
+		if err := fn(m.Tags(orgId, filter)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Prune deletes all metrics that haven't been seen since the given timestamp.
 // It returns all Archives deleted and any error encountered.
 func (p *PartitionedMemoryIdx) Prune(oldest time.Time) ([]idx.Archive, error) {
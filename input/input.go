@@ -32,6 +32,11 @@ type Handler interface {
 	ProcessMetricPoint(point schema.MetricPoint, format msg.Format, partition int32)
 }
 
+// WAL is a write-ahead log that points are appended to before they are added to their AggMetric
+type WAL interface {
+	Append(key schema.MKey, schemaId, aggId uint16, interval, ts uint32, val float64)
+}
+
 // TODO: clever way to document all metrics for all different inputs
 
 // Default is a base handler for a metrics packet, aimed to be embedded by concrete implementations
@@ -46,6 +51,7 @@ type DefaultHandler struct {
 
 	metrics     mdata.Metrics
 	metricIndex idx.MetricIndex
+	wal         WAL
 }
 
 // Possible reason labels for Prometheus metric discarded_samples_total
@@ -60,6 +66,12 @@ const (
 )
 
 func NewDefaultHandler(metrics mdata.Metrics, metricIndex idx.MetricIndex, input string) DefaultHandler {
+	return NewDefaultHandlerWithWAL(metrics, metricIndex, nil, input)
+}
+
+// NewDefaultHandlerWithWAL is like NewDefaultHandler, but appends all points to the given WAL
+// before adding them to their metric.
+func NewDefaultHandlerWithWAL(metrics mdata.Metrics, metricIndex idx.MetricIndex, wal WAL, input string) DefaultHandler {
 	return DefaultHandler{
 		// metric input.%s.metricdata.received is the count of metricdata datapoints received by input plugin
 		receivedMD: stats.NewCounter32(fmt.Sprintf("input.%s.metricdata.received", input)),
@@ -79,9 +91,16 @@ func NewDefaultHandler(metrics mdata.Metrics, metricIndex idx.MetricIndex, input
 
 		metrics:     metrics,
 		metricIndex: metricIndex,
+		wal:         wal,
 	}
 }
 
+// Definition returns the definition of the series in the index, if any
+func (in DefaultHandler) Definition(key schema.MKey) (schema.MetricDefinition, bool) {
+	archive, ok := in.metricIndex.Get(key)
+	return archive.MetricDefinition, ok
+}
+
 // ProcessMetricPoint updates the index if possible, and stores the data if we have an index entry
 // concurrency-safe.
 func (in DefaultHandler) ProcessMetricPoint(point schema.MetricPoint, format msg.Format, partition int32) {
@@ -107,6 +126,9 @@ func (in DefaultHandler) ProcessMetricPoint(point schema.MetricPoint, format msg
 		return
 	}
 
+	if in.wal != nil {
+		in.wal.Append(point.MKey, archive.SchemaId, archive.AggId, uint32(archive.Interval), point.Time, point.Value)
+	}
 	m := in.metrics.GetOrCreate(point.MKey, archive.SchemaId, archive.AggId, uint32(archive.Interval))
 	m.Add(point.Time, point.Value)
 }
@@ -179,6 +201,9 @@ func (in DefaultHandler) ProcessMetricData(md *schema.MetricData, partition int3
 
 	archive, _, _ := in.metricIndex.AddOrUpdate(mkey, md, partition)
 
+	if in.wal != nil {
+		in.wal.Append(mkey, archive.SchemaId, archive.AggId, uint32(md.Interval), uint32(md.Time), md.Value)
+	}
 	m := in.metrics.GetOrCreate(mkey, archive.SchemaId, archive.AggId, uint32(md.Interval))
 	m.Add(uint32(md.Time), md.Value)
 }
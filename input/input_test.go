@@ -165,6 +165,46 @@ func TestIngestValidAndInvalidTagsAndValuesWithAndWithoutRejection(t *testing.T)
 	}
 }
 
+type walRecord struct {
+	key      schema.MKey
+	interval uint32
+	ts       uint32
+	val      float64
+}
+
+type mockWAL []walRecord
+
+func (w *mockWAL) Append(key schema.MKey, schemaId, aggId uint16, interval, ts uint32, val float64) {
+	*w = append(*w, walRecord{key, interval, ts, val})
+}
+
+func TestProcessAppendsToWAL(t *testing.T) {
+	handler, index, reset := getDefaultHandler(t)
+	defer reset()
+	wal := &mockWAL{}
+	handler.wal = wal
+
+	data := getTestMetricData()
+	data.SetId()
+	handler.ProcessMetricData(&data, 0)
+
+	// invalid data is not appended
+	invalid := getTestMetricData()
+	invalid.Interval = 0
+	handler.ProcessMetricData(&invalid, 0)
+
+	mkey, _ := schema.MKeyFromString(data.Id)
+	handler.ProcessMetricPoint(schema.MetricPoint{MKey: mkey, Value: 5, Time: 4}, 0, 0)
+
+	exp := mockWAL{{mkey, 1, 3, 2}, {mkey, 1, 4, 5}}
+	if len(*wal) != len(exp) || (*wal)[0] != exp[0] || (*wal)[1] != exp[1] {
+		t.Fatalf("expected WAL records %v, got %v", exp, *wal)
+	}
+	if len(index.List(1)) != 1 {
+		t.Fatalf("expected the metric to be indexed")
+	}
+}
+
 func generateInvalidTags(t *testing.T) []string {
 	t.Helper()
 
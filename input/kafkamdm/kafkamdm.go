@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -15,6 +16,7 @@ import (
 	"github.com/grafana/metrictank/cluster"
 	"github.com/grafana/metrictank/input"
 	"github.com/grafana/metrictank/kafka"
+	"github.com/grafana/metrictank/mdata/snapshot"
 	"github.com/grafana/metrictank/schema"
 	"github.com/grafana/metrictank/schema/msg"
 	"github.com/grafana/metrictank/stats"
@@ -34,6 +36,11 @@ type KafkaMdm struct {
 	lagMonitor *LagMonitor
 	wg         sync.WaitGroup
 
+	// offsets to start consuming from, overriding the configured offset. see ResumeFrom
+	resumeFrom map[string]map[int32]int64
+	// the next offset to consume, per topic and partition. accessed atomically
+	offsets map[string]map[int32]*int64
+
 	shutdown chan struct{}
 	// signal to caller that it should shutdown
 	cancel context.CancelFunc
@@ -70,6 +77,12 @@ var saslEnabled bool
 var saslMechanism string
 var saslUsername string
 var saslPassword string
+var reshardNumPartitions int
+var reshardPartitionScheme string
+var reshardCutover int64
+var reshardFromPartitionStr string
+var reshardFromPartitions []int32
+var reshard *resharder
 
 func ConfigSetup() {
 	inKafkaMdm := flag.NewFlagSet("kafka-mdm-in", flag.ExitOnError)
@@ -94,9 +107,26 @@ func ConfigSetup() {
 	inKafkaMdm.StringVar(&saslMechanism, "sasl-mechanism", "", "The SASL mechanism configuration (possible values: SCRAM-SHA-256, SCRAM-SHA-512, PLAINTEXT)")
 	inKafkaMdm.StringVar(&saslUsername, "sasl-username", "", "Username for client authentication (use with -sasl-enabled and -sasl-password)")
 	inKafkaMdm.StringVar(&saslPassword, "sasl-password", "", "Password for client authentication (use with -sasl-enabled and -sasl-user)")
+	inKafkaMdm.IntVar(&reshardNumPartitions, "reshard-num-partitions", 0, "number of partitions the topics are being resharded to. enables the resharding transition, during which metrics produced before the cutover are only ingested if their series belongs to one of our partitions in the new partitioning. 0 to disable")
+	inKafkaMdm.StringVar(&reshardPartitionScheme, "reshard-partition-scheme", "bySeries", "method used by the producers for partitioning metrics, during the resharding transition. (byOrg|bySeries|bySeriesWithTags|bySeriesWithTagsFnv|bySeriesConsistent)")
+	inKafkaMdm.Int64Var(&reshardCutover, "reshard-cutover", 0, "unix timestamp at which the producers switched to the new number of partitions, during the resharding transition")
+	inKafkaMdm.StringVar(&reshardFromPartitionStr, "reshard-from-partitions", "", "partitions of the old partitioning that hold series which now belong to our partitions, during the resharding transition. they are consumed in addition to our partitions, up to the cutover. comma separated list of id's. see mt-index-reshard")
 	globalconf.Register("kafka-mdm-in", inKafkaMdm, flag.ExitOnError)
 }
 
+// parsePartitions parses a comma separated list of partition id's
+func parsePartitions(s string) ([]int32, error) {
+	var parts []int32
+	for _, part := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse partition %q. partitions must be a comma separated list of id's", part)
+		}
+		parts = append(parts, int32(i))
+	}
+	return parts, nil
+}
+
 func ConfigProcess(instance string) {
 	if !Enabled {
 		return
@@ -185,19 +215,39 @@ func ConfigProcess(instance string) {
 	if partitionStr == "*" {
 		partitions = availParts
 	} else {
-		parts := strings.Split(partitionStr, ",")
-		for _, part := range parts {
-			i, err := strconv.Atoi(part)
-			if err != nil {
-				log.Fatalf("could not parse partition %q. partitions must be '*' or a comma separated list of id's", part)
-			}
-			partitions = append(partitions, int32(i))
+		partitions, err = parsePartitions(partitionStr)
+		if err != nil {
+			log.Fatalf("kafkamdm: %s, or '*'", err.Error())
 		}
 		missing := kafka.DiffPartitions(partitions, availParts)
 		if len(missing) > 0 {
 			log.Fatalf("kafkamdm: configured partitions not in list of available partitions. missing %v", missing)
 		}
 	}
+	if reshardNumPartitions > 0 {
+		method, err := schema.PartitonMethodFromString(reshardPartitionScheme)
+		if err != nil {
+			log.Fatalf("kafkamdm: invalid reshard-partition-scheme. %s", err.Error())
+		}
+		if reshardCutover <= 0 {
+			log.Fatal("kafkamdm: reshard-cutover must be set to the unix timestamp at which the producers switched to the new number of partitions")
+		}
+		reshard, err = newResharder(method, int32(reshardNumPartitions), time.Unix(reshardCutover, 0), partitions)
+		if err != nil {
+			log.Fatalf("kafkamdm: invalid reshard-num-partitions. %s", err.Error())
+		}
+		if reshardFromPartitionStr != "" {
+			reshardFromPartitions, err = parsePartitions(reshardFromPartitionStr)
+			if err != nil {
+				log.Fatalf("kafkamdm: invalid reshard-from-partitions. %s", err.Error())
+			}
+			missing := kafka.DiffPartitions(reshardFromPartitions, availParts)
+			if len(missing) > 0 {
+				log.Fatalf("kafkamdm: reshard-from-partitions not in list of available partitions. missing %v", missing)
+			}
+		}
+		log.Infof("kafkamdm: resharding to %d partitions. metrics produced before %s are filtered, and partitions %v are consumed up to then", reshardNumPartitions, reshard.cutover, reshardFromPartitions)
+	}
 	// record our partitions so others (MetricIdx) can use the partitioning information.
 	// but only if the manager has been created (e.g. in metrictank), not when this input plugin is used in other contexts
 	if cluster.Manager != nil {
@@ -236,29 +286,104 @@ func New() *KafkaMdm {
 func (k *KafkaMdm) Start(handler input.Handler, cancel context.CancelFunc) error {
 	k.Handler = handler
 	k.cancel = cancel
-	var err error
+	k.offsets = make(map[string]map[int32]*int64)
 	for _, topic := range topics {
+		k.offsets[topic] = make(map[int32]*int64)
 		for _, partition := range partitions {
-			var offset int64
-			switch offsetStr {
-			case "oldest":
-				offset = sarama.OffsetOldest
-			case "newest":
-				offset = sarama.OffsetNewest
-			default:
-				offset, err = k.client.GetOffset(topic, partition, time.Now().Add(-1*offsetDuration).UnixNano()/int64(time.Millisecond))
-				if err != nil {
-					offset = sarama.OffsetOldest
-					log.Warnf("kafkamdm: failed to get offset %s: %s -> will use oldest instead", offsetDuration, err)
-				}
+			next := new(int64)
+			*next = -1 // not consuming yet
+			k.offsets[topic][partition] = next
+			if offset, ok := k.resumeFrom[topic][partition]; ok {
+				offset = k.resumeOffset(topic, partition, offset)
+				k.wg.Add(1)
+				go k.consumePartition(topic, partition, offset, next)
+				continue
 			}
 			k.wg.Add(1)
-			go k.consumePartition(topic, partition, offset)
+			go k.consumePartition(topic, partition, k.startOffset(topic, partition), next)
+		}
+		for _, partition := range kafka.DiffPartitions(reshardFromPartitions, partitions) {
+			reshardPending.Inc()
+			k.wg.Add(1)
+			go k.consumeUntilCutover(topic, partition, k.startOffset(topic, partition))
 		}
 	}
 	return nil
 }
 
+// startOffset returns the configured offset to start consuming from
+func (k *KafkaMdm) startOffset(topic string, partition int32) int64 {
+	switch offsetStr {
+	case "oldest":
+		return sarama.OffsetOldest
+	case "newest":
+		return sarama.OffsetNewest
+	}
+	offset, err := k.client.GetOffset(topic, partition, time.Now().Add(-1*offsetDuration).UnixNano()/int64(time.Millisecond))
+	if err != nil {
+		log.Warnf("kafkamdm: failed to get offset %s: %s -> will use oldest instead", offsetDuration, err)
+		return sarama.OffsetOldest
+	}
+	return offset
+}
+
+// ResumeFrom makes Start consume from the given offsets, rather than the configured offset,
+// for the topics and partitions they apply to.
+func (k *KafkaMdm) ResumeFrom(offsets []snapshot.Offset) {
+	k.resumeFrom = make(map[string]map[int32]int64)
+	for _, o := range offsets {
+		if _, ok := k.resumeFrom[o.Topic]; !ok {
+			k.resumeFrom[o.Topic] = make(map[int32]int64)
+		}
+		k.resumeFrom[o.Topic][o.Partition] = o.Offset
+	}
+}
+
+// Offsets returns, for each topic and partition, the offset of the message following
+// the last message that has been fully processed.
+func (k *KafkaMdm) Offsets() []snapshot.Offset {
+	var offsets []snapshot.Offset
+	for topic, partitionOffsets := range k.offsets {
+		for partition, next := range partitionOffsets {
+			offset := atomic.LoadInt64(next)
+			if offset < 0 {
+				continue
+			}
+			offsets = append(offsets, snapshot.Offset{
+				Topic:     topic,
+				Partition: partition,
+				Offset:    offset,
+			})
+		}
+	}
+	return offsets
+}
+
+// resumeOffset returns the offset to resume consuming from, which is the requested offset
+// unless kafka does not have it (anymore)
+func (k *KafkaMdm) resumeOffset(topic string, partition int32, offset int64) int64 {
+	oldest, err := k.client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		log.Warnf("kafkamdm: failed to get oldest offset of %s:%d: %s. will try to resume from offset %d anyway", topic, partition, err, offset)
+		return offset
+	}
+	newest, err := k.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		log.Warnf("kafkamdm: failed to get newest offset of %s:%d: %s. will try to resume from offset %d anyway", topic, partition, err, offset)
+		return offset
+	}
+	if offset < oldest {
+		log.Warnf("kafkamdm: offset %d to resume %s:%d from is no longer available. resuming from oldest offset %d. some data will be missing", offset, topic, partition, oldest)
+		return oldest
+	}
+	if offset > newest {
+		log.Warnf("kafkamdm: offset %d to resume %s:%d from is beyond the newest offset %d. resuming from newest", offset, topic, partition, newest)
+		return newest
+	}
+	log.Infof("kafkamdm: resuming %s:%d from offset %d", topic, partition, offset)
+	return offset
+}
+
 // tryGetOffset will to query kafka repeatedly for the requested offset and give up after attempts unsuccesfull attempts
 // an error is returned when it had to give up
 func (k *KafkaMdm) tryGetOffset(topic string, partition int32, offset int64, attempts int, sleep time.Duration) (int64, error) {
@@ -295,7 +420,8 @@ func (k *KafkaMdm) tryGetOffset(topic string, partition int32, offset int64, att
 }
 
 // consumePartition consumes from the topic until k.shutdown is triggered.
-func (k *KafkaMdm) consumePartition(topic string, partition int32, currentOffset int64) {
+// next is kept up to date with the offset of the next message to consume.
+func (k *KafkaMdm) consumePartition(topic string, partition int32, currentOffset int64, next *int64) {
 	defer k.wg.Done()
 
 	// determine the pos of the topic and the initial offset of our consumer
@@ -316,6 +442,8 @@ func (k *KafkaMdm) consumePartition(topic string, partition int32, currentOffset
 		}
 	}
 
+	atomic.StoreInt64(next, currentOffset)
+
 	kafkaStats := kafkaStats[partition]
 	kafkaStats.Offset.Set(int(currentOffset))
 	kafkaStats.LogSize.Set(int(newest))
@@ -343,7 +471,8 @@ func (k *KafkaMdm) consumePartition(topic string, partition int32, currentOffset
 			if log.IsLevelEnabled(log.DebugLevel) {
 				log.Debugf("kafkamdm: received message: Topic %s, Partition: %d, Offset: %d, Key: %x", msg.Topic, msg.Partition, msg.Offset, msg.Key)
 			}
-			k.handleMsg(msg.Value, partition)
+			k.handleMsg(msg.Value, partition, msg.Timestamp)
+			atomic.StoreInt64(next, msg.Offset+1)
 			kafkaStats.Offset.Set(int(msg.Offset))
 		case <-k.shutdown:
 			pc.Close()
@@ -353,7 +482,44 @@ func (k *KafkaMdm) consumePartition(topic string, partition int32, currentOffset
 	}
 }
 
-func (k *KafkaMdm) handleMsg(data []byte, partition int32) {
+// consumeUntilCutover consumes a partition of the old partitioning that we don't consume otherwise,
+// until the first message that was produced after the resharding cutover.
+func (k *KafkaMdm) consumeUntilCutover(topic string, partition int32, offset int64) {
+	defer k.wg.Done()
+	defer reshardPending.Dec()
+
+	log.Infof("kafkamdm: consuming from %s:%d from offset %d up to the resharding cutover", topic, partition, offset)
+	pc, err := k.consumer.ConsumePartition(topic, partition, offset)
+	if err != nil {
+		log.Errorf("kafkamdm: failed to start partitionConsumer for %s:%d. %s", topic, partition, err)
+		k.cancel()
+		return
+	}
+	defer pc.Close()
+	messages := pc.Messages()
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				log.Errorf("kafkamdm: kafka consumer for %s:%d has shutdown. stop consuming", topic, partition)
+				k.cancel()
+				return
+			}
+			if !reshard.beforeCutover(msg.Timestamp) {
+				log.Infof("kafkamdm: reached the resharding cutover in %s:%d at offset %d. stop consuming", topic, partition, msg.Offset)
+				return
+			}
+			k.handleMsg(msg.Value, partition, msg.Timestamp)
+		case <-k.shutdown:
+			log.Infof("kafkamdm: consumer for %s:%d ended.", topic, partition)
+			return
+		}
+	}
+}
+
+// handleMsg decodes and processes a message, that was produced at the given time
+func (k *KafkaMdm) handleMsg(data []byte, partition int32, produced time.Time) {
+	resharding := reshard != nil && reshard.beforeCutover(produced)
 	format, isPointMsg := msg.IsPointMsg(data)
 	if isPointMsg {
 		_, point, err := msg.ReadPointMsg(data, uint32(orgId))
@@ -362,6 +528,19 @@ func (k *KafkaMdm) handleMsg(data []byte, partition int32) {
 			log.Errorf("kafkamdm: decode error, skipping message. %s", err)
 			return
 		}
+		if resharding {
+			// without a definition, we can't tell the partition. but then the handler discards the point anyway.
+			if getter, ok := k.Handler.(definitionGetter); ok {
+				if def, ok := getter.Definition(point.MKey); ok {
+					var ours bool
+					partition, ours, err = reshard.partition(&def)
+					if err != nil || !ours {
+						reshardSkipped.Inc()
+						return
+					}
+				}
+			}
+		}
 		k.Handler.ProcessMetricPoint(point, format, partition)
 		return
 	}
@@ -374,6 +553,14 @@ func (k *KafkaMdm) handleMsg(data []byte, partition int32) {
 		return
 	}
 	metricsPerMessage.ValueUint32(1)
+	if resharding {
+		var ours bool
+		partition, ours, err = reshard.partition(&md)
+		if err != nil || !ours {
+			reshardSkipped.Inc()
+			return
+		}
+	}
 	k.Handler.ProcessMetricData(&md, partition)
 }
 
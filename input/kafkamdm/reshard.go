@@ -0,0 +1,63 @@
+package kafkamdm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/metrictank/schema"
+	"github.com/grafana/metrictank/stats"
+)
+
+// metric input.kafka-mdm.reshard.skipped is how many metrics produced before the resharding cutover were skipped, because their series belongs to a partition we don't consume
+var reshardSkipped = stats.NewCounter32("input.kafka-mdm.reshard.skipped")
+
+// metric input.kafka-mdm.reshard.pending is how many partitions of the old partitioning are still being consumed up to the resharding cutover
+var reshardPending = stats.NewGauge32("input.kafka-mdm.reshard.pending")
+
+// definitionGetter looks up the definition of a series.
+// it is needed to compute the partition of metric points, which don't have a name or tags.
+type definitionGetter interface {
+	Definition(key schema.MKey) (schema.MetricDefinition, bool)
+}
+
+// resharder decides, during the transition to a new number of partitions, which of the metrics
+// that were produced before the cutover we ingest, and under which partition.
+// metrics produced after the cutover are in their new partition already.
+type resharder struct {
+	method     schema.PartitionByMethod
+	partitions int32 // number of partitions after resharding
+	cutover    time.Time
+	ours       map[int32]struct{}
+}
+
+func newResharder(method schema.PartitionByMethod, numPartitions int32, cutover time.Time, ours []int32) (*resharder, error) {
+	r := &resharder{
+		method:     method,
+		partitions: numPartitions,
+		cutover:    cutover,
+		ours:       make(map[int32]struct{}, len(ours)),
+	}
+	for _, p := range ours {
+		if p >= numPartitions {
+			return nil, fmt.Errorf("partition %d does not exist in the new partitioning of %d partitions", p, numPartitions)
+		}
+		r.ours[p] = struct{}{}
+	}
+	return r, nil
+}
+
+// beforeCutover returns whether a message was produced before the producers switched to the new number of partitions.
+// messages without timestamp are assumed to be.
+func (r *resharder) beforeCutover(produced time.Time) bool {
+	return produced.Before(r.cutover)
+}
+
+// partition returns the partition of the metric in the new partitioning, and whether it is one of ours
+func (r *resharder) partition(m schema.PartitionedMetric) (int32, bool, error) {
+	p, err := m.PartitionID(r.method, r.partitions)
+	if err != nil {
+		return 0, false, err
+	}
+	_, ok := r.ours[p]
+	return p, ok, nil
+}
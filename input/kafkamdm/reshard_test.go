@@ -0,0 +1,91 @@
+package kafkamdm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/schema"
+	"github.com/grafana/metrictank/schema/msg"
+)
+
+// recordingHandler records the partitions of the metrics it processes
+type recordingHandler struct {
+	defs       map[schema.MKey]schema.MetricDefinition
+	partitions map[string]int32
+}
+
+func (h *recordingHandler) ProcessMetricData(md *schema.MetricData, partition int32) {
+	h.partitions[md.Name] = partition
+}
+
+func (h *recordingHandler) ProcessMetricPoint(point schema.MetricPoint, format msg.Format, partition int32) {
+	h.partitions[h.defs[point.MKey].Name] = partition
+}
+
+func (h *recordingHandler) Definition(key schema.MKey) (schema.MetricDefinition, bool) {
+	def, ok := h.defs[key]
+	return def, ok
+}
+
+func TestReshardHandleMsg(t *testing.T) {
+	cutover := time.Unix(1000, 0)
+	r, err := newResharder(schema.PartitionBySeries, 4, cutover, []int32{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reshard = r
+	defer func() { reshard = nil }()
+
+	// find a series in our new partition, and one in another
+	var ours, theirs *schema.MetricData
+	for i := 0; ours == nil || theirs == nil; i++ {
+		md := &schema.MetricData{OrgId: 1, Name: fmt.Sprintf("some.series.%d", i), Interval: 10, Value: 1, Time: 100, Mtype: "gauge"}
+		md.SetId()
+		if _, ok, _ := r.partition(md); ok {
+			ours = md
+		} else {
+			theirs = md
+		}
+	}
+
+	h := &recordingHandler{defs: make(map[schema.MKey]schema.MetricDefinition), partitions: make(map[string]int32)}
+	k := &KafkaMdm{Handler: h}
+	for _, md := range []*schema.MetricData{ours, theirs} {
+		data, err := md.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k.handleMsg(data, 3, cutover.Add(-time.Second))
+	}
+	if p, ok := h.partitions[ours.Name]; !ok || p != 1 {
+		t.Fatalf("expected %s to be ingested under its new partition 1, got %d (ingested: %t)", ours.Name, p, ok)
+	}
+	if _, ok := h.partitions[theirs.Name]; ok {
+		t.Fatalf("expected %s to be skipped", theirs.Name)
+	}
+
+	// metric points are partitioned based on their definition
+	def := schema.MetricDefinitionFromMetricData(theirs)
+	h.defs[def.Id] = *def
+	data, err := msg.WritePointMsg(schema.MetricPoint{MKey: def.Id, Value: 2, Time: 110}, make([]byte, 0, 33), msg.FormatMetricPoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.handleMsg(data, 3, cutover.Add(-time.Second))
+	if _, ok := h.partitions[theirs.Name]; ok {
+		t.Fatalf("expected point of %s to be skipped", theirs.Name)
+	}
+
+	// after the cutover, metrics are in their new partition already
+	k.handleMsg(data, 3, cutover)
+	if p := h.partitions[theirs.Name]; p != 3 {
+		t.Fatalf("expected point of %s produced after the cutover to be ingested under partition 3, got %d", theirs.Name, p)
+	}
+}
+
+func TestNewResharder(t *testing.T) {
+	if _, err := newResharder(schema.PartitionBySeries, 4, time.Unix(1000, 0), []int32{1, 4}); err == nil {
+		t.Fatal("expected error for partition that does not exist in the new partitioning")
+	}
+}
@@ -46,8 +46,14 @@ type AggMetric struct {
 	futureTolerance uint32
 	ttl             uint32
 	lastSaveStart   uint32 // last chunk T0 that was added to the write Queue.
+	lastSaveFinish  uint32 // last chunk T0 that was confirmed saved (by us or by another node)
 	lastWrite       uint32 // wall clock time of when last point was successfully added (possibly to the ROB)
 	firstTs         uint32 // timestamp of first point seen
+
+	// the properties the AggMetric was created with by AggMetrics, needed to recreate it from a snapshot
+	schemaId uint16
+	aggId    uint16
+	interval uint32
 }
 
 // NewAggMetric creates a metric with given key, it retains the given number of chunks each chunkSpan seconds long
@@ -96,6 +102,7 @@ func NewAggMetric(store Store, cachePusher cache.CachePusher, key schema.AMKey,
 func (a *AggMetric) SyncChunkSaveState(ts uint32, sendPersist bool) ChunkSaveCallback {
 	return func() {
 		util.AtomicBumpUint32(&a.lastSaveStart, ts)
+		util.AtomicBumpUint32(&a.lastSaveFinish, ts)
 
 		log.Debugf("AM: metric %s at chunk T0=%d has been saved.", a.key, ts)
 		if sendPersist {
@@ -349,6 +356,16 @@ func (a *AggMetric) pushToCache(c *chunk.Chunk) {
 	go a.cachePusher.AddIfHot(a.key, 0, itergen)
 }
 
+// shouldPersist returns whether we should save our chunks: when we are a primary,
+// or when no other node ingests them (see SetAlwaysPersist)
+func (a *AggMetric) shouldPersist() bool {
+	if cluster.Manager.IsPrimary() {
+		return true
+	}
+	_, ok := alwaysPersist[a.key.MKey.Org]
+	return ok
+}
+
 // write a chunk to persistent storage.
 // never persist a chunk that may receive further updates!
 // (because the stores will read out chunk data on the unlocked chunk)
@@ -507,6 +524,7 @@ func (a *AggMetric) add(ts uint32, val float64) {
 		a.lastWrite = uint32(time.Now().Unix())
 		if a.dropFirstChunk {
 			util.AtomicBumpUint32(&a.lastSaveStart, t0)
+			util.AtomicBumpUint32(&a.lastSaveFinish, t0)
 		}
 		a.addAggregators(ts, val)
 		return
@@ -548,7 +566,7 @@ func (a *AggMetric) add(ts uint32, val float64) {
 
 		a.pushToCache(currentChunk)
 		// If we are a primary node, then add the chunk to the write queue to be saved to Cassandra
-		if cluster.Manager.IsPrimary() {
+		if a.shouldPersist() {
 			log.Debugf("AM: persist(): node is primary, saving chunk. %s T0: %d", a.key, currentChunk.Series.T0)
 			// persist the chunk. If the writeQueue is full, then this will block.
 			a.persist(a.currentChunkPos)
@@ -653,7 +671,7 @@ func (a *AggMetric) GC(now, chunkMinTs, metricMinTs uint32) (uint32, bool) {
 		log.Debugf("AM: Found stale Chunk, adding end-of-stream bytes. key: %v T0: %d", a.key, currentChunk.Series.T0)
 		currentChunk.Finish()
 		a.pushToCache(currentChunk)
-		if cluster.Manager.IsPrimary() {
+		if a.shouldPersist() {
 			log.Debugf("AM: persist(): node is primary, saving chunk. %v T0: %d", a.key, currentChunk.Series.T0)
 			// persist the chunk. If the writeQueue is full, then this will block.
 			a.persist(a.currentChunkPos)
@@ -164,6 +164,29 @@ func testMetricPersistOptionalPrimary(t *testing.T, primary bool) {
 	}
 }
 
+func TestMetricPersistAlwaysPersistOrg(t *testing.T) {
+	mockstore.Reset()
+	defer mockstore.Reset()
+
+	cluster.Init("default", "test", time.Now(), "http", 6060)
+	cluster.Manager.SetPrimary(false)
+
+	key := test.GetAMKey(42)
+	SetAlwaysPersist(key.MKey.Org)
+	defer delete(alwaysPersist, key.MKey.Org)
+
+	chunkAddCount, chunkSpan := uint32(10), uint32(300)
+	rets := conf.MustParseRetentions("1s:1s:5min:5:true")
+	agg := NewAggMetric(mockstore, &cache.MockCache{}, key, rets, 0, chunkSpan, nil, false, false, 0)
+	for ts := chunkSpan; ts <= chunkSpan*chunkAddCount; ts += chunkSpan {
+		agg.Add(ts, 1)
+	}
+
+	if uint32(mockstore.Items()) != chunkAddCount-1 {
+		t.Fatalf("secondary should have saved %d chunks of an org that is always persisted, but got %d", chunkAddCount-1, mockstore.Items())
+	}
+}
+
 func TestAggMetric(t *testing.T) {
 	cluster.Init("default", "test", time.Now(), "http", 6060)
 
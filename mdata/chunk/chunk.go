@@ -58,6 +58,13 @@ func (c *Chunk) Finish() {
 // note: chunks don't know their own span, the caller/owner manages that,
 // so for formats that encode it, it needs to be passed in.
 // the returned value contains no references to the chunk. data is copied.
+// If IntEncoding is enabled, integer-valued chunks use FormatIntDeltaWithSpan when it is smaller.
 func (c *Chunk) Encode(span uint32) []byte {
-	return encode(span, FormatGoTszLongWithSpan, c.Series.Bytes())
+	data := c.Series.Bytes()
+	if IntEncoding {
+		if intData, ok := encodeInt(c.Series.T0, c.Series.Iter()); ok && len(intData) < len(data) {
+			return encode(span, FormatIntDeltaWithSpan, intData)
+		}
+	}
+	return encode(span, FormatGoTszLongWithSpan, data)
 }
@@ -10,7 +10,7 @@ import (
 // input data is copied
 func encode(span uint32, format Format, data []byte) []byte {
 	switch format {
-	case FormatStandardGoTszWithSpan, FormatGoTszLongWithSpan:
+	case FormatStandardGoTszWithSpan, FormatGoTszLongWithSpan, FormatIntDeltaWithSpan:
 		buf := new(bytes.Buffer)
 		binary.Write(buf, binary.LittleEndian, format)
 
@@ -12,4 +12,5 @@ const (
 	FormatStandardGoTsz Format = iota
 	FormatStandardGoTszWithSpan
 	FormatGoTszLongWithSpan // like FormatStandardGoTszWithSpan but using tsz.SeriesLong
+	FormatIntDeltaWithSpan  // integer values, delta-of-delta varint encoded. see IterInt
 )
@@ -0,0 +1,121 @@
+package chunk
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/grafana/metrictank/mdata/chunk/tsz"
+)
+
+// IntEncoding enables FormatIntDeltaWithSpan for chunks of which all values are integers,
+// whenever it is more compact than the tsz encoding.
+// It should only be enabled once all nodes reading the chunks know the format.
+var IntEncoding bool
+
+// maxInt is the largest integer magnitude that float64 represents exactly.
+// limiting values to it guarantees their delta-of-deltas fit in an int64.
+const maxInt = 1 << 53
+
+var errCorruptInt = errors.New("corrupt data, invalid int chunk")
+
+// encodeInt encodes the points of the iterator in the FormatIntDeltaWithSpan payload:
+//
+//	<uvarint count><varint ts dod><varint val dod>[...]
+//
+// timestamps are encoded as delta-of-delta against t0, values as delta-of-delta against 0,
+// both assuming a starting delta of 0. the varints are zigzag encoded.
+// It returns false if the iterator has no points, or if any value is not an integer
+// that float64 represents exactly.
+func encodeInt(t0 uint32, it tsz.Iter) ([]byte, bool) {
+	var points []byte
+	var count uint64
+	var tmp [binary.MaxVarintLen64]byte
+
+	prevTs, prevTsDelta := int64(t0), int64(0)
+	prevVal, prevValDelta := int64(0), int64(0)
+	for it.Next() {
+		ts, val := it.Values()
+		if val != math.Trunc(val) || math.Abs(val) > maxInt || (val == 0 && math.Signbit(val)) {
+			// also covers NaN and Inf
+			return nil, false
+		}
+		tsDelta := int64(ts) - prevTs
+		n := binary.PutVarint(tmp[:], tsDelta-prevTsDelta)
+		points = append(points, tmp[:n]...)
+		prevTs, prevTsDelta = int64(ts), tsDelta
+
+		v := int64(val)
+		valDelta := v - prevVal
+		n = binary.PutVarint(tmp[:], valDelta-prevValDelta)
+		points = append(points, tmp[:n]...)
+		prevVal, prevValDelta = v, valDelta
+		count++
+	}
+	if it.Err() != nil || count == 0 {
+		return nil, false
+	}
+	n := binary.PutUvarint(tmp[:], count)
+	buf := make([]byte, 0, n+len(points))
+	buf = append(buf, tmp[:n]...)
+	return append(buf, points...), true
+}
+
+// IterInt iterates over the points of a FormatIntDeltaWithSpan chunk.
+// It implements tsz.Iter. It is not concurrency-safe.
+type IterInt struct {
+	b     []byte
+	count uint64
+
+	ts, tsDelta   int64
+	val, valDelta int64
+
+	err error
+}
+
+// NewIteratorInt creates an iterator for the given payload of a FormatIntDeltaWithSpan chunk.
+// the data is not modified.
+func NewIteratorInt(t0 uint32, b []byte) (*IterInt, error) {
+	count, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, errCorruptInt
+	}
+	return &IterInt{
+		b:     b[n:],
+		count: count,
+		ts:    int64(t0),
+	}, nil
+}
+
+func (it *IterInt) Next() bool {
+	if it.err != nil || it.count == 0 {
+		return false
+	}
+	tsDod, n := binary.Varint(it.b)
+	if n <= 0 {
+		it.err = errCorruptInt
+		return false
+	}
+	it.b = it.b[n:]
+	valDod, n := binary.Varint(it.b)
+	if n <= 0 {
+		it.err = errCorruptInt
+		return false
+	}
+	it.b = it.b[n:]
+
+	it.tsDelta += tsDod
+	it.ts += it.tsDelta
+	it.valDelta += valDod
+	it.val += it.valDelta
+	it.count--
+	return true
+}
+
+func (it *IterInt) Values() (uint32, float64) {
+	return uint32(it.ts), float64(it.val)
+}
+
+func (it *IterInt) Err() error {
+	return it.err
+}
@@ -0,0 +1,159 @@
+package chunk
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/metrictank/schema"
+)
+
+func encodeTestChunk(t *testing.T, t0 uint32, points []schema.Point) []byte {
+	t.Helper()
+	c := New(t0)
+	for _, p := range points {
+		if err := c.Push(p.Ts, p.Val); err != nil {
+			t.Fatalf("failed to push %v: %s", p, err)
+		}
+	}
+	c.Finish()
+	return c.Encode(600)
+}
+
+func decodeTestChunk(t *testing.T, t0 uint32, data []byte) []schema.Point {
+	t.Helper()
+	itgen, err := NewIterGen(t0, 10, data)
+	if err != nil {
+		t.Fatalf("could not construct itergen: %s", err)
+	}
+	if itgen.Span() != 600 {
+		t.Fatalf("expected span 600, got %d", itgen.Span())
+	}
+	iter, err := itgen.Get()
+	if err != nil {
+		t.Fatalf("could not get iterator: %s", err)
+	}
+	var got []schema.Point
+	for iter.Next() {
+		ts, val := iter.Values()
+		got = append(got, schema.Point{Val: val, Ts: ts})
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("iter.Err returned %v", err)
+	}
+	return got
+}
+
+func TestIntEncoding(t *testing.T) {
+	defer func(orig bool) { IntEncoding = orig }(IntEncoding)
+	IntEncoding = true
+
+	t0 := uint32(1600000200)
+	cases := []struct {
+		name   string
+		points []schema.Point
+		format Format
+	}{
+		{
+			name:   "counter",
+			points: []schema.Point{{Val: 100, Ts: t0 + 10}, {Val: 110, Ts: t0 + 20}, {Val: 125, Ts: t0 + 30}, {Val: 125, Ts: t0 + 40}, {Val: 140, Ts: t0 + 60}},
+			format: FormatIntDeltaWithSpan,
+		},
+		{
+			name:   "negative",
+			points: []schema.Point{{Val: -5, Ts: t0}, {Val: -3, Ts: t0 + 10}, {Val: 2, Ts: t0 + 599}},
+			format: FormatIntDeltaWithSpan,
+		},
+		{
+			// the int encoding is valid, but larger than tsz
+			name:   "large jumps",
+			points: []schema.Point{{Val: 1 << 52, Ts: t0 + 10}, {Val: -(1 << 52), Ts: t0 + 20}, {Val: 1 << 52, Ts: t0 + 30}, {Val: -(1 << 52), Ts: t0 + 40}},
+			format: FormatGoTszLongWithSpan,
+		},
+		{
+			name:   "floats",
+			points: []schema.Point{{Val: 1, Ts: t0 + 10}, {Val: 1.5, Ts: t0 + 20}},
+			format: FormatGoTszLongWithSpan,
+		},
+		{
+			name:   "NaN",
+			points: []schema.Point{{Val: 1, Ts: t0 + 10}, {Val: math.NaN(), Ts: t0 + 20}},
+			format: FormatGoTszLongWithSpan,
+		},
+		{
+			name:   "negative zero",
+			points: []schema.Point{{Val: math.Copysign(0, -1), Ts: t0 + 10}},
+			format: FormatGoTszLongWithSpan,
+		},
+		{
+			name:   "too large",
+			points: []schema.Point{{Val: 1 << 54, Ts: t0 + 10}},
+			format: FormatGoTszLongWithSpan,
+		},
+	}
+	for _, c := range cases {
+		data := encodeTestChunk(t, t0, c.points)
+		if Format(data[0]) != c.format {
+			t.Errorf("case %q: expected format %s, got %s", c.name, c.format, Format(data[0]))
+		}
+		got := decodeTestChunk(t, t0, data)
+		if !equal(c.points, got) {
+			t.Errorf("case %q: output mismatch:\nexpected:\n%v\ngot:\n%v", c.name, c.points, got)
+		}
+	}
+}
+
+func TestIntEncodingExtremes(t *testing.T) {
+	t0 := uint32(1600000200)
+	points := []schema.Point{{Val: maxInt, Ts: t0}, {Val: -maxInt, Ts: t0 + 1}, {Val: maxInt, Ts: math.MaxUint32}, {Val: 0, Ts: math.MaxUint32 - 1}}
+	c := New(t0)
+	for _, p := range points {
+		c.Series.Push(p.Ts, p.Val)
+	}
+	data, ok := encodeInt(t0, c.Series.Iter())
+	if !ok {
+		t.Fatal("expected points to be int encodable")
+	}
+	it, err := NewIteratorInt(t0, data)
+	if err != nil {
+		t.Fatalf("could not get iterator: %s", err)
+	}
+	var got []schema.Point
+	for it.Next() {
+		ts, val := it.Values()
+		got = append(got, schema.Point{Val: val, Ts: ts})
+	}
+	if it.Err() != nil || !equal(points, got) {
+		t.Fatalf("output mismatch (err %v):\nexpected:\n%v\ngot:\n%v", it.Err(), points, got)
+	}
+}
+
+func TestIntEncodingDisabled(t *testing.T) {
+	t0 := uint32(1600000200)
+	data := encodeTestChunk(t, t0, []schema.Point{{Val: 1, Ts: t0 + 10}, {Val: 2, Ts: t0 + 20}})
+	if Format(data[0]) != FormatGoTszLongWithSpan {
+		t.Fatalf("expected format %s, got %s", FormatGoTszLongWithSpan, Format(data[0]))
+	}
+}
+
+func TestIntEncodingCorrupt(t *testing.T) {
+	defer func(orig bool) { IntEncoding = orig }(IntEncoding)
+	IntEncoding = true
+
+	t0 := uint32(1600000200)
+	data := encodeTestChunk(t, t0, []schema.Point{{Val: 1, Ts: t0 + 10}, {Val: 2, Ts: t0 + 20}, {Val: 300, Ts: t0 + 30}})
+	itgen, err := NewIterGen(t0, 10, data[:len(data)-1])
+	if err != nil {
+		t.Fatalf("could not construct itergen: %s", err)
+	}
+	iter, err := itgen.Get()
+	if err != nil {
+		t.Fatalf("could not get iterator: %s", err)
+	}
+	var n int
+	for iter.Next() {
+		n++
+	}
+	if n != 2 || iter.Err() != errCorruptInt {
+		t.Fatalf("expected 2 points and errCorruptInt, got %d points and %v", n, iter.Err())
+	}
+}
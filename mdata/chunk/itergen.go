@@ -28,7 +28,7 @@ func NewIterGen(t0, intervalHint uint32, b []byte) (IterGen, error) {
 		if len(b) == 1 {
 			return IterGen{}, errShort
 		}
-	case FormatStandardGoTszWithSpan, FormatGoTszLongWithSpan:
+	case FormatStandardGoTszWithSpan, FormatGoTszLongWithSpan, FormatIntDeltaWithSpan:
 		if len(b) <= 2 {
 			return IterGen{}, errShort
 		}
@@ -64,6 +64,9 @@ func (ig *IterGen) Get() (tsz.Iter, error) {
 		dest := make([]byte, len(src))
 		copy(dest, src)
 		return tsz.NewIteratorLong(ig.T0, dest)
+	case FormatIntDeltaWithSpan:
+		// IterInt doesn't modify the data, no need to copy
+		return NewIteratorInt(ig.T0, ig.B[2:])
 	}
 	return nil, errUnknownChunkFormat
 }
@@ -58,7 +58,9 @@ func ExtractChunkSpan(chunk []byte) uint32 {
 		return 0
 	}
 
-	if Format(chunk[0]) != FormatStandardGoTszWithSpan && Format(chunk[0]) != FormatGoTszLongWithSpan {
+	switch Format(chunk[0]) {
+	case FormatStandardGoTszWithSpan, FormatGoTszLongWithSpan, FormatIntDeltaWithSpan:
+	default:
 		return 0
 	}
 
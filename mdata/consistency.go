@@ -0,0 +1,122 @@
+package mdata
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"sort"
+	"time"
+)
+
+// ChunkDigest summarizes the raw data of a metric within the timespan of a chunk,
+// such that it can be compared across replicas.
+type ChunkDigest struct {
+	T0        uint32 `json:"t0"`
+	Points    uint32 `json:"points"`    // number of points within the requested range
+	Checksum  uint32 `json:"checksum"`  // crc32 of the timestamps and values of those points
+	NumPoints uint32 `json:"numPoints"` // number of points in the in-memory chunk. 0 if there is none (e.g. points only in the reorder buffer)
+	Finished  bool   `json:"finished"`  // whether the in-memory chunk is finished, and thus should be saved
+	First     bool   `json:"first"`     // whether the in-memory chunk holds the first point seen, and thus may be incomplete
+}
+
+// MetricDigest summarizes the raw data of a metric held in memory
+type MetricDigest struct {
+	ChunkSpan uint32        `json:"chunkSpan"`
+	TTL       uint32        `json:"ttl"`
+	Oldest    uint32        `json:"oldest"` // see Result.Oldest
+	Chunks    []ChunkDigest `json:"chunks"` // sorted by T0
+}
+
+// Digest returns the digest of the raw data in the range [from, to), as returned by Get,
+// along with the state of the in-memory chunks covering the range.
+func (a *AggMetric) Digest(from, to uint32) (MetricDigest, error) {
+	res, err := a.Get(from, to)
+	if err != nil {
+		return MetricDigest{}, err
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+	d := MetricDigest{
+		ChunkSpan: a.chunkSpan,
+		TTL:       a.ttl,
+		Oldest:    res.Oldest,
+	}
+	byT0 := make(map[uint32]*ChunkDigest)
+	get := func(t0 uint32) *ChunkDigest {
+		cd, ok := byT0[t0]
+		if !ok {
+			cd = &ChunkDigest{T0: t0}
+			byT0[t0] = cd
+		}
+		return cd
+	}
+	var buf [12]byte
+	add := func(ts uint32, val float64) {
+		if ts < from || ts >= to {
+			return
+		}
+		cd := get(ts - ts%a.chunkSpan)
+		binary.LittleEndian.PutUint32(buf[:4], ts)
+		binary.LittleEndian.PutUint64(buf[4:], math.Float64bits(val))
+		cd.Checksum = crc32.Update(cd.Checksum, crc32.IEEETable, buf[:])
+		cd.Points++
+	}
+	// the reorder buffer only has points newer than those in the chunks
+	for _, it := range res.Iters {
+		for it.Next() {
+			add(it.Values())
+		}
+	}
+	for _, p := range res.Points {
+		add(p.Ts, p.Val)
+	}
+	for _, c := range a.chunks {
+		if c.Series.T0 >= to || c.Series.T0+a.chunkSpan <= from {
+			continue
+		}
+		cd := get(c.Series.T0)
+		cd.NumPoints = c.NumPoints
+		cd.Finished = c.Series.Finished
+		cd.First = c.First
+	}
+
+	d.Chunks = make([]ChunkDigest, 0, len(byT0))
+	for _, cd := range byT0 {
+		d.Chunks = append(d.Chunks, *cd)
+	}
+	sort.Slice(d.Chunks, func(i, j int) bool { return d.Chunks[i].T0 < d.Chunks[j].T0 })
+	return d, nil
+}
+
+// RepairChunks saves the finished in-memory chunks with the given t0's to the store,
+// regardless of whether this node is a primary, or whether they were saved before.
+// It returns the t0's of the chunks that were saved.
+func (a *AggMetric) RepairChunks(t0s []uint32) []uint32 {
+	want := make(map[uint32]struct{}, len(t0s))
+	for _, t0 := range t0s {
+		want[t0] = struct{}{}
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+	var saved []uint32
+	for _, c := range a.chunks {
+		t0 := c.Series.T0
+		if _, ok := want[t0]; !ok || !c.Series.Finished {
+			continue
+		}
+		cwr := NewChunkWriteRequest(
+			a.SyncChunkSaveState(t0, true),
+			a.key,
+			a.ttl,
+			t0,
+			c.Encode(a.chunkSpan),
+			time.Now(),
+		)
+		a.store.Add(&cwr)
+		saved = append(saved, t0)
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i] < saved[j] })
+	return saved
+}
@@ -0,0 +1,80 @@
+package mdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/cluster"
+	"github.com/grafana/metrictank/schema"
+)
+
+func TestAggMetricDigestAndRepair(t *testing.T) {
+	cluster.Init("default", "test", time.Now(), "http", 6060)
+	cluster.Manager.SetPrimary(false)
+
+	_aggregations := Aggregations
+	_schemas := Schemas
+	defer func() {
+		Aggregations = _aggregations
+		Schemas = _schemas
+	}()
+	setSnapshotTestConfig(3)
+
+	key, _ := schema.MKeyFromString("1.12345678901234567890123456789012")
+	store := NewMockStore()
+	a := NewAggMetrics(store, NewMockCachePusher(), false, nil, 60, 120, 0).GetOrCreate(key, 0, 0, 1).(*AggMetric)
+	b := NewAggMetrics(NewMockStore(), NewMockCachePusher(), false, nil, 60, 120, 0).GetOrCreate(key, 0, 0, 1).(*AggMetric)
+	for ts := uint32(10); ts <= 200; ts++ {
+		a.Add(ts, float64(ts%13))
+		if ts == 150 {
+			// a replica that got a different value
+			b.Add(ts, 1000)
+			continue
+		}
+		b.Add(ts, float64(ts%13))
+	}
+
+	da, err := a.Digest(70, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := b.Digest(70, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(da.Chunks) != 3 || len(db.Chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %v and %v", da.Chunks, db.Chunks)
+	}
+	if da.ChunkSpan != 60 || da.TTL != 3600 || da.Oldest != 60 {
+		t.Fatalf("unexpected digest %+v", da)
+	}
+	exp := []ChunkDigest{
+		{T0: 60, Points: 50, NumPoints: 60, Finished: true},
+		{T0: 120, Points: 60, NumPoints: 60, Finished: true},
+		{T0: 180, Points: 20, NumPoints: 16}, // the newest points are in the reorder buffer
+	}
+	for i, cd := range da.Chunks {
+		e := exp[i]
+		if cd.T0 != e.T0 || cd.Points != e.Points || cd.NumPoints != e.NumPoints || cd.Finished != e.Finished || cd.First {
+			t.Fatalf("chunk %d: expected %+v, got %+v", i, e, cd)
+		}
+	}
+	for i := range da.Chunks {
+		same := da.Chunks[i].Checksum == db.Chunks[i].Checksum
+		if same != (da.Chunks[i].T0 != 120) {
+			t.Fatalf("chunk %d: expected only the checksums of chunk 120 to differ, got %+v and %+v", i, da.Chunks[i], db.Chunks[i])
+		}
+	}
+
+	// secondaries don't save chunks, unless repairing
+	if store.Items() != 0 {
+		t.Fatalf("expected no chunks to be saved, got %d", store.Items())
+	}
+	saved := a.RepairChunks([]uint32{60, 120, 180, 240})
+	if len(saved) != 2 || saved[0] != 60 || saved[1] != 120 {
+		t.Fatalf("expected chunks 60 and 120 to be saved, got %v", saved)
+	}
+	if store.Items() != 2 {
+		t.Fatalf("expected 2 chunks in the store, got %d", store.Items())
+	}
+}
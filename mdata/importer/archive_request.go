@@ -89,6 +89,73 @@ func NewArchiveRequest(w *whisper.Whisper, schemas conf.Schemas, file, name stri
 	return res, nil
 }
 
+// NewArchiveRequestFromPoints creates an ArchiveRequest from raw points that don't come from
+// a whisper file, such as prometheus samples. md must have its Name, Tags, Interval and Mtype set.
+// the points get quantized to md.Interval, and the rollups are generated from them
+// according to the matching schema and aggregation, the same way metrictank would.
+func NewArchiveRequestFromPoints(md schema.MetricData, points []whisper.Point, schemas conf.Schemas, aggs conf.Aggregations, from, until uint32, writeUnfinishedChunks bool) (*ArchiveRequest, error) {
+	if md.Interval <= 0 {
+		return nil, fmt.Errorf("Invalid interval %d for metric %q", md.Interval, md.Name)
+	}
+	interval := uint32(md.Interval)
+	raw := quantizePoints(points, interval, from, until)
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("No points to import for metric %q", md.Name)
+	}
+
+	res := &ArchiveRequest{MetricData: md}
+	res.MetricData.Value = 0
+	res.MetricData.Time = int64(raw[len(raw)-1].Timestamp)
+	if res.MetricData.Unit == "" {
+		res.MetricData.Unit = "unknown"
+	}
+	if res.MetricData.Tags == nil {
+		res.MetricData.Tags = []string{}
+	}
+	res.MetricData.SetId()
+
+	nameWithTags := schema.MetricDefinitionFromMetricData(&res.MetricData).NameWithTags()
+	_, selectedSchema := schemas.Match(nameWithTags, md.Interval)
+	_, selectedAgg := aggs.Match(nameWithTags)
+
+	for retIdx, retention := range selectedSchema.Retentions.Rets {
+		spp := uint32(retention.SecondsPerPoint)
+		convertedPoints := map[schema.Method][]whisper.Point{0: raw}
+		if retIdx > 0 {
+			convertedPoints = rollupPoints(raw, selectedAgg.AggregationMethod, interval, spp, from, until)
+		}
+		for m, p := range convertedPoints {
+			// like the whisper path, only keep as many points as the retention can hold
+			if len(p) > retention.NumberOfPoints {
+				p = p[len(p)-retention.NumberOfPoints:]
+			}
+			if len(p) == 0 {
+				continue
+			}
+
+			var archive schema.Archive
+			intervalIn := interval
+			if retIdx > 0 {
+				archive = schema.NewArchive(m, spp)
+				intervalIn = spp
+			}
+
+			encodedChunks := encodeChunksFromPoints(p, intervalIn, retention.ChunkSpan, writeUnfinishedChunks)
+			for _, chunk := range encodedChunks {
+				res.ChunkWriteRequests = append(res.ChunkWriteRequests, NewChunkWriteRequest(
+					archive,
+					uint32(retention.MaxRetention()),
+					chunk.Series.T0,
+					chunk.Encode(retention.ChunkSpan),
+					time.Now(),
+				))
+			}
+		}
+	}
+
+	return res, nil
+}
+
 func (a *ArchiveRequest) MarshalCompressed() (*bytes.Buffer, error) {
 	var buf bytes.Buffer
 
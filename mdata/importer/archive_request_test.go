@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"math"
+	"regexp"
+	"testing"
+
+	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/mdata/chunk"
+	"github.com/grafana/metrictank/schema"
+	"github.com/kisielk/whisper-go/whisper"
+)
+
+func TestNewArchiveRequestFromPoints(t *testing.T) {
+	schemas := conf.NewSchemas([]conf.Schema{{
+		Name:       "test",
+		Pattern:    regexp.MustCompile("^test"),
+		Retentions: conf.MustParseRetentions("10s:1h:2min:1,1min:1d:10min:1"),
+	}})
+	aggs := conf.NewAggregations()
+	aggs.DefaultAggregation.AggregationMethod = []conf.Method{conf.Avg, conf.Max}
+
+	// 2 hours worth of slightly jittered points, like prometheus would scrape them
+	var points []whisper.Point
+	for ts := uint32(7200); ts < 14400; ts += 10 {
+		points = append(points, whisper.Point{Timestamp: ts - 3, Value: float64(ts)})
+	}
+
+	md := schema.MetricData{
+		OrgId:    1,
+		Name:     "test.metric",
+		Interval: 10,
+		Mtype:    "counter",
+		Tags:     []string{"job=test"},
+	}
+	ar, err := NewArchiveRequestFromPoints(md, points, schemas, aggs, 0, math.MaxUint32, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if ar.MetricData.Id == "" || ar.MetricData.Time != 14390 || ar.MetricData.Mtype != "counter" {
+		t.Fatalf("Unexpected metric data: %+v", ar.MetricData)
+	}
+
+	// the raw retention can only hold 1h of data, so we expect 30 chunks of 2min.
+	// the rollups have 2h of data in 10min chunks, for sum, cnt and max.
+	// the last rollup point is not generated, because its aggregation would not be complete
+	expected := map[schema.Archive]int{
+		0:                                 30,
+		schema.NewArchive(schema.Sum, 60): 12,
+		schema.NewArchive(schema.Cnt, 60): 12,
+		schema.NewArchive(schema.Max, 60): 12,
+	}
+	got := make(map[schema.Archive]int)
+	for _, cwr := range ar.ChunkWriteRequests {
+		got[cwr.Archive]++
+		if cwr.Archive == 0 && cwr.TTL != 3600 {
+			t.Fatalf("Expected raw ttl 3600, got %d", cwr.TTL)
+		}
+		itgen, err := chunk.NewIterGen(cwr.T0, 10, cwr.Data)
+		if err != nil {
+			t.Fatalf("Failed to decode chunk: %s", err)
+		}
+		it, err := itgen.Get()
+		if err != nil {
+			t.Fatalf("Failed to decode chunk: %s", err)
+		}
+		for it.Next() {
+			ts, val := it.Values()
+			if cwr.Archive == 0 && (ts%10 != 0 || val != float64(ts)) {
+				t.Fatalf("Unexpected raw point %d:%f", ts, val)
+			}
+			if cwr.Archive == schema.NewArchive(schema.Cnt, 60) && ts != 7200 && val != 6 {
+				t.Fatalf("Unexpected count point %d:%f", ts, val)
+			}
+		}
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected chunks %v, got %v", expected, got)
+	}
+	for archive, num := range expected {
+		if got[archive] != num {
+			t.Fatalf("Expected chunks %v, got %v", expected, got)
+		}
+	}
+}
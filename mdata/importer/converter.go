@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/grafana/metrictank/conf"
 	"github.com/grafana/metrictank/mdata"
 	"github.com/grafana/metrictank/schema"
 	"github.com/kisielk/whisper-go/whisper"
@@ -268,6 +269,45 @@ func decResolution(points []whisper.Point, method schema.Method, inRes, outRes,
 	return out
 }
 
+// quantizePoints quantizes the given raw points to the given interval, the same way metrictank
+// does when reading raw data. if multiple points fall into the same slot, the last one wins.
+// points outside of from and until are dropped. the result is sorted.
+func quantizePoints(points []whisper.Point, interval, from, until uint32) []whisper.Point {
+	var out []whisper.Point
+	for _, p := range sortPoints(points) {
+		if p.Timestamp == 0 {
+			continue
+		}
+		p.Timestamp = mdata.AggBoundary(p.Timestamp, interval)
+		if p.Timestamp > until || p.Timestamp < from {
+			continue
+		}
+		if len(out) > 0 && out[len(out)-1].Timestamp == p.Timestamp {
+			out[len(out)-1] = p
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// rollupPoints generates the rollups of the given raw points for each of the given aggregation methods,
+// resulting in the same archives that metrictank's aggregators would create.
+func rollupPoints(raw []whisper.Point, methods []conf.Method, rawRes, outRes, from, until uint32) map[schema.Method][]whisper.Point {
+	res := make(map[schema.Method][]whisper.Point)
+	for _, m := range methods {
+		method := convertConfMethod(m)
+		for outMethod, points := range decResolution(raw, method, rawRes, outRes, rawRes, from, until) {
+			// only avg needs the count, just like in metrictank
+			if outMethod == schema.Cnt && m != conf.Avg {
+				continue
+			}
+			res[outMethod] = points
+		}
+	}
+	return res
+}
+
 // pointSorter sorts points by timestamp
 type pointSorter []whisper.Point
 
@@ -298,3 +338,18 @@ func convertWhisperMethod(whisperMethod whisper.AggregationMethod) (schema.Metho
 		return 0, fmt.Errorf("Unknown whisper method: %d", whisperMethod)
 	}
 }
+
+func convertConfMethod(method conf.Method) schema.Method {
+	switch method {
+	case conf.Avg:
+		return fakeAvg
+	case conf.Sum:
+		return schema.Sum
+	case conf.Lst:
+		return schema.Lst
+	case conf.Max:
+		return schema.Max
+	default:
+		return schema.Min
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"math"
 	"testing"
 
+	"github.com/grafana/metrictank/conf"
 	"github.com/grafana/metrictank/schema"
 	"github.com/kisielk/whisper-go/whisper"
 )
@@ -1395,3 +1396,76 @@ func TestPointsConversionWithoutAnyChange(t *testing.T) {
 	verifyPointMaps(t, points1, expected0)
 	verifyPointMaps(t, points2, expected1)
 }
+
+func TestQuantizePoints(t *testing.T) {
+	inData := []whisper.Point{
+		{31, 4},
+		{0, 100},
+		{1, 1},
+		{9, 2},
+		{12, 3},
+		{45, 5},
+	}
+	expected := []whisper.Point{
+		{10, 2},
+		{20, 3},
+		{40, 4},
+	}
+	outData := quantizePoints(inData, 10, 0, 40)
+	if len(outData) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, outData)
+	}
+	for i := range expected {
+		if outData[i] != expected[i] {
+			t.Fatalf("Expected %+v, got %+v", expected, outData)
+		}
+	}
+}
+
+func TestRollupPoints(t *testing.T) {
+	raw := []whisper.Point{
+		{10, 1},
+		{20, 2},
+		{30, 3},
+		{40, 4},
+		{50, 5},
+		{60, 6},
+		{70, 7},
+	}
+	// the last aggregation is incomplete, so like in metrictank it does not get generated
+	expectedResult := map[schema.Method][]whisper.Point{
+		schema.Sum: {
+			{30, 6},
+			{60, 15},
+		},
+		schema.Cnt: {
+			{30, 3},
+			{60, 3},
+		},
+		schema.Max: {
+			{30, 3},
+			{60, 6},
+		},
+	}
+	outData := rollupPoints(raw, []conf.Method{conf.Avg, conf.Max}, 10, 30, 0, math.MaxUint32)
+	if len(outData) != len(expectedResult) {
+		t.Fatalf("Expected:\n%+v\nGot:\n%+v\n", expectedResult, outData)
+	}
+	for m, ep := range expectedResult {
+		p := outData[m]
+		if len(p) != len(ep) {
+			t.Fatalf("Expected:\n%+v\nGot:\n%+v\n", expectedResult, outData)
+		}
+		for i := range p {
+			if p[i] != ep[i] {
+				t.Fatalf("Expected:\n%+v\nGot:\n%+v\n", expectedResult, outData)
+			}
+		}
+	}
+
+	// sum does not need a count archive
+	outData = rollupPoints(raw, []conf.Method{conf.Sum}, 10, 30, 0, math.MaxUint32)
+	if _, ok := outData[schema.Cnt]; ok || len(outData) != 1 {
+		t.Fatalf("Expected only a sum archive, got %+v", outData)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/grafana/globalconf"
 	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/mdata/chunk"
 	"github.com/grafana/metrictank/stats"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -120,6 +121,7 @@ func ConfigSetup() {
 	retentionConf.StringVar(&aggFile, "aggregations-file", "/etc/metrictank/storage-aggregation.conf", "path to storage-aggregation.conf file")
 	retentionConf.UintVar(&futureToleranceRatio, "future-tolerance-ratio", 10, "defines until how far in the future we accept datapoints. defined as a percentage fraction of the raw ttl of the matching retention storage schema")
 	retentionConf.BoolVar(&enforceFutureTolerance, "enforce-future-tolerance", true, "enables/disables the enforcement of the future tolerance limitation")
+	retentionConf.BoolVar(&chunk.IntEncoding, "int-chunk-encoding", false, "encode chunks of which all values are integers with the more compact integer chunk format. only enable once all nodes reading the chunks (including tools) support it")
 	globalconf.Register("retention", retentionConf, flag.ExitOnError)
 }
 
@@ -56,14 +56,19 @@ type NotifierHandler interface {
 }
 
 type DefaultNotifierHandler struct {
-	idx     idx.MetricIndex
-	metrics Metrics
+	idx       idx.MetricIndex
+	metrics   Metrics
+	notifiers []Notifier
 }
 
-func NewDefaultNotifierHandler(metrics Metrics, idx idx.MetricIndex) DefaultNotifierHandler {
+// NewDefaultNotifierHandler creates a handler that syncs the save state of our AggMetrics with the saves of other nodes.
+// The saved chunks are also sent to the given local notifiers (e.g. a write-ahead log), which are otherwise
+// only told about the chunks we save ourselves.
+func NewDefaultNotifierHandler(metrics Metrics, idx idx.MetricIndex, notifiers ...Notifier) DefaultNotifierHandler {
 	return DefaultNotifierHandler{
-		idx:     idx,
-		metrics: metrics,
+		idx:       idx,
+		metrics:   metrics,
+		notifiers: notifiers,
 	}
 }
 
@@ -88,6 +93,9 @@ func (dn DefaultNotifierHandler) Handle(data []byte) {
 				log.Errorf("notifier: failed to convert %q to AMKey: %s -- skipping", c.Key, err)
 				continue
 			}
+			for _, n := range dn.notifiers {
+				n.Send(c)
+			}
 			// we only need to handle saves for series that we know about.
 			// if the series is not in the index, then we dont need to worry about it.
 			def, ok := dn.idx.Get(amkey.MKey)
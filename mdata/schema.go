@@ -1,6 +1,8 @@
 package mdata
 
 import (
+	"regexp"
+
 	"github.com/grafana/metrictank/conf"
 )
 
@@ -25,6 +27,30 @@ func MatchSchema(key string, interval int) (uint16, conf.Schema) {
 	return Schemas.Match(key, interval)
 }
 
+// MatchSchemaOrg is like MatchSchema, but returns the schema of the org if it has one (see SetOrgSchema)
+func MatchSchemaOrg(orgId uint32, key string, interval int) (uint16, conf.Schema) {
+	return Schemas.MatchOrg(orgId, key, interval)
+}
+
+// SetOrgSchema makes all metrics of the given org use the given retentions
+func SetOrgSchema(orgId uint32, name string, ret conf.Retentions) {
+	Schemas.SetOrgSchema(orgId, conf.Schema{
+		Name:       name,
+		Pattern:    regexp.MustCompile(".*"),
+		Retentions: ret,
+	})
+}
+
+// orgs whose chunks are saved by all nodes, see SetAlwaysPersist
+var alwaysPersist = make(map[uint32]struct{})
+
+// SetAlwaysPersist makes all nodes save the chunks of the given org, not just primaries.
+// this is for series that are only ingested by a single node, such as metrictank's own stats.
+// it must be called before ingestion starts.
+func SetAlwaysPersist(orgId uint32) {
+	alwaysPersist[orgId] = struct{}{}
+}
+
 func SetSingleSchema(ret conf.Retentions) {
 	Schemas = conf.NewSchemas(nil)
 	Schemas.DefaultSchema.Retentions = ret
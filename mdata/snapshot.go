@@ -0,0 +1,294 @@
+package mdata
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/grafana/metrictank/mdata/chunk"
+	"github.com/grafana/metrictank/schema"
+)
+
+//go:generate msgp
+
+var errSnapshotMismatch = errors.New("snapshot does not match the current configuration of the metric")
+
+// MetricSnapshot is the in-memory state of an AggMetric (including its rollups),
+// along with what's needed to recreate the AggMetric.
+type MetricSnapshot struct {
+	Key      schema.MKey
+	SchemaId uint16
+	AggId    uint16
+	Interval uint32
+	State    AggMetricState
+}
+
+// AggMetricState is the state of an AggMetric that is not persisted yet:
+// its chunks, reorder buffer and aggregators.
+type AggMetricState struct {
+	ChunkSpan       uint32
+	NumChunks       uint32
+	CurrentChunkPos int
+	Chunks          []ChunkState
+	Rob             *ReorderBufferState
+	Aggregators     []AggregatorState
+	LastSaveFinish  uint32 // chunks that were queued for saving, but not confirmed saved, are saved again after a restore
+	LastWrite       uint32
+	FirstTs         uint32
+}
+
+// ChunkState is the state of a chunk, which may still be receiving data
+type ChunkState struct {
+	Series    []byte // see tsz.SeriesLong.MarshalBinary
+	Finished  bool
+	NumPoints uint32
+	First     bool
+}
+
+type ReorderBufferState struct {
+	Newest uint32
+	Buf    []schema.Point
+}
+
+type AggregatorState struct {
+	Span            uint32
+	CurrentBoundary uint32
+	Min             float64
+	Max             float64
+	Sum             float64
+	Cnt             float64
+	Lst             float64
+	MinMetric       *AggMetricState
+	MaxMetric       *AggMetricState
+	SumMetric       *AggMetricState
+	CntMetric       *AggMetricState
+	LstMetric       *AggMetricState
+}
+
+// Snapshot calls fn with the snapshot of each metric.
+// it is safe to call while data is being added.
+func (ms *AggMetrics) Snapshot(fn func(MetricSnapshot) error) error {
+	ms.RLock()
+	metrics := make([]*AggMetric, 0, len(ms.Metrics))
+	for _, orgMetrics := range ms.Metrics {
+		for _, m := range orgMetrics {
+			metrics = append(metrics, m)
+		}
+	}
+	ms.RUnlock()
+
+	for _, m := range metrics {
+		snap := MetricSnapshot{
+			Key:      m.key.MKey,
+			SchemaId: m.schemaId,
+			AggId:    m.aggId,
+			Interval: m.interval,
+		}
+		var err error
+		m.RLock()
+		snap.State, err = m.state()
+		m.RUnlock()
+		if err != nil {
+			return fmt.Errorf("failed to snapshot metric %s: %s", m.key, err)
+		}
+		if err := fn(snap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore creates the metric of the given snapshot and restores its state.
+// if the metric already has data, or its configuration does not match the
+// snapshot anymore (e.g. because the storage-schemas changed), an error is returned
+// and the metric is left alone.
+func (ms *AggMetrics) Restore(snap MetricSnapshot) error {
+	m := ms.GetOrCreate(snap.Key, snap.SchemaId, snap.AggId, snap.Interval).(*AggMetric)
+	m.Lock()
+	defer m.Unlock()
+	if len(m.chunks) != 0 || (m.rob != nil && !m.rob.IsEmpty()) {
+		return fmt.Errorf("metric %s already has data", m.key)
+	}
+	if err := m.checkState(snap.State); err != nil {
+		return err
+	}
+	return m.restore(snap.State)
+}
+
+// state returns the state of the AggMetric.
+// caller must hold at least a read lock
+func (a *AggMetric) state() (AggMetricState, error) {
+	st := AggMetricState{
+		ChunkSpan:       a.chunkSpan,
+		NumChunks:       a.numChunks,
+		CurrentChunkPos: a.currentChunkPos,
+		Chunks:          make([]ChunkState, len(a.chunks)),
+		LastSaveFinish:  atomic.LoadUint32(&a.lastSaveFinish),
+		LastWrite:       a.lastWrite,
+		FirstTs:         a.firstTs,
+	}
+	for i, c := range a.chunks {
+		series, err := c.Series.MarshalBinary()
+		if err != nil {
+			return st, err
+		}
+		st.Chunks[i] = ChunkState{
+			Series:    series,
+			Finished:  c.Series.Finished,
+			NumPoints: c.NumPoints,
+			First:     c.First,
+		}
+	}
+	if a.rob != nil {
+		st.Rob = &ReorderBufferState{
+			Newest: a.rob.newest,
+			Buf:    make([]schema.Point, len(a.rob.buf)),
+		}
+		copy(st.Rob.Buf, a.rob.buf)
+	}
+
+	// aggregators are protected by our lock, but their metrics have their own locks
+	for _, agg := range a.aggregators {
+		aggSt := AggregatorState{
+			Span:            agg.span,
+			CurrentBoundary: agg.currentBoundary,
+			Min:             agg.agg.Min,
+			Max:             agg.agg.Max,
+			Sum:             agg.agg.Sum,
+			Cnt:             agg.agg.Cnt,
+			Lst:             agg.agg.Lst,
+		}
+		for _, pair := range []struct {
+			dst **AggMetricState
+			src *AggMetric
+		}{
+			{&aggSt.MinMetric, agg.minMetric},
+			{&aggSt.MaxMetric, agg.maxMetric},
+			{&aggSt.SumMetric, agg.sumMetric},
+			{&aggSt.CntMetric, agg.cntMetric},
+			{&aggSt.LstMetric, agg.lstMetric},
+		} {
+			if pair.src == nil {
+				continue
+			}
+			pair.src.RLock()
+			metricSt, err := pair.src.state()
+			pair.src.RUnlock()
+			if err != nil {
+				return st, err
+			}
+			*pair.dst = &metricSt
+		}
+		st.Aggregators = append(st.Aggregators, aggSt)
+	}
+	return st, nil
+}
+
+// checkState verifies that the given state can be restored into the AggMetric,
+// in other words that the retentions, reorder window and aggregations did not change.
+func (a *AggMetric) checkState(st AggMetricState) error {
+	if st.ChunkSpan != a.chunkSpan || st.NumChunks != a.numChunks || len(st.Chunks) > int(a.numChunks) {
+		return errSnapshotMismatch
+	}
+	if len(st.Chunks) > 0 && (st.CurrentChunkPos < 0 || st.CurrentChunkPos >= len(st.Chunks)) {
+		return errSnapshotMismatch
+	}
+	if (st.Rob == nil) != (a.rob == nil) {
+		return errSnapshotMismatch
+	}
+	if st.Rob != nil && (len(st.Rob.Buf) != len(a.rob.buf) || int(st.Rob.Newest) >= len(a.rob.buf)) {
+		return errSnapshotMismatch
+	}
+	if len(st.Aggregators) != len(a.aggregators) {
+		return errSnapshotMismatch
+	}
+	for i, agg := range a.aggregators {
+		aggSt := st.Aggregators[i]
+		if aggSt.Span != agg.span {
+			return errSnapshotMismatch
+		}
+		for _, pair := range []struct {
+			st *AggMetricState
+			m  *AggMetric
+		}{
+			{aggSt.MinMetric, agg.minMetric},
+			{aggSt.MaxMetric, agg.maxMetric},
+			{aggSt.SumMetric, agg.sumMetric},
+			{aggSt.CntMetric, agg.cntMetric},
+			{aggSt.LstMetric, agg.lstMetric},
+		} {
+			if (pair.st == nil) != (pair.m == nil) {
+				return errSnapshotMismatch
+			}
+			if pair.m != nil {
+				if err := pair.m.checkState(*pair.st); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// restore sets the state of the AggMetric. the state must have been checked via checkState.
+// caller must hold the write lock
+func (a *AggMetric) restore(st AggMetricState) error {
+	chunks := make([]*chunk.Chunk, len(st.Chunks), a.numChunks)
+	var points uint32
+	for i, cs := range st.Chunks {
+		c := &chunk.Chunk{
+			NumPoints: cs.NumPoints,
+			First:     cs.First,
+		}
+		if err := c.Series.UnmarshalBinary(cs.Series); err != nil {
+			return fmt.Errorf("failed to decode chunk %d of metric %s: %s", i, a.key, err)
+		}
+		// the stream already contains the end-of-stream marker, if any
+		c.Series.Finished = cs.Finished
+		chunks[i] = c
+		points += cs.NumPoints
+	}
+	a.chunks = chunks
+	a.currentChunkPos = st.CurrentChunkPos
+	// chunks that were in the write queue when the snapshot was taken may never have been saved
+	a.lastSaveStart = st.LastSaveFinish
+	a.lastSaveFinish = st.LastSaveFinish
+	a.lastWrite = st.LastWrite
+	a.firstTs = st.FirstTs
+	if st.Rob != nil {
+		a.rob.newest = st.Rob.Newest
+		copy(a.rob.buf, st.Rob.Buf)
+	}
+	totalPoints.AddUint64(uint64(points))
+
+	for i, agg := range a.aggregators {
+		aggSt := st.Aggregators[i]
+		agg.currentBoundary = aggSt.CurrentBoundary
+		agg.agg.Min = aggSt.Min
+		agg.agg.Max = aggSt.Max
+		agg.agg.Sum = aggSt.Sum
+		agg.agg.Cnt = aggSt.Cnt
+		agg.agg.Lst = aggSt.Lst
+		for _, pair := range []struct {
+			st *AggMetricState
+			m  *AggMetric
+		}{
+			{aggSt.MinMetric, agg.minMetric},
+			{aggSt.MaxMetric, agg.maxMetric},
+			{aggSt.SumMetric, agg.sumMetric},
+			{aggSt.CntMetric, agg.cntMetric},
+			{aggSt.LstMetric, agg.lstMetric},
+		} {
+			if pair.m == nil {
+				continue
+			}
+			pair.m.Lock()
+			err := pair.m.restore(*pair.st)
+			pair.m.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
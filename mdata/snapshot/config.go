@@ -0,0 +1,37 @@
+package snapshot
+
+import (
+	"flag"
+	"time"
+
+	"github.com/grafana/globalconf"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	Enabled  bool
+	dir      string
+	interval time.Duration
+	maxAge   time.Duration
+)
+
+func ConfigSetup() {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	fs.BoolVar(&Enabled, "enabled", false, "periodically snapshot the in-memory data to local disk, and restore it on startup. requires an input that can resume from the recorded offsets (kafka-mdm)")
+	fs.StringVar(&dir, "dir", "/var/lib/metrictank/snapshot", "directory to store the snapshot in")
+	fs.DurationVar(&interval, "interval", 10*time.Minute, "interval at which to take snapshots. a final snapshot is always taken on shutdown")
+	fs.DurationVar(&maxAge, "max-age", 6*time.Hour, "snapshots older than this are not restored, e.g. because kafka may not have the data since then anymore. 0 to disable")
+	globalconf.Register("snapshot", fs, flag.ExitOnError)
+}
+
+func ConfigProcess() {
+	if !Enabled {
+		return
+	}
+	if dir == "" {
+		log.Fatal("snapshot: dir must be set")
+	}
+	if interval <= 0 {
+		log.Fatal("snapshot: interval must be greater than 0")
+	}
+}
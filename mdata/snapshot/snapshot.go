@@ -0,0 +1,263 @@
+// Package snapshot periodically saves the in-memory state of the AggMetrics to local disk,
+// along with the input offsets it corresponds to, such that after a restart the state can be
+// restored and ingestion resumed from those offsets, rather than replaying the full kafka backlog.
+package snapshot
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/stats"
+	log "github.com/sirupsen/logrus"
+	"github.com/tinylib/msgp/msgp"
+)
+
+//go:generate msgp
+//msgp:ignore Snapshotter
+
+const (
+	version  = 1
+	fileName = "aggmetrics.snap"
+)
+
+var (
+	// metric tank.snapshot.save is the duration of taking a snapshot
+	saveDuration = stats.NewLatencyHistogram15s32("tank.snapshot.save")
+
+	// metric tank.snapshot.save-errors is the number of snapshots that could not be taken
+	saveErrors = stats.NewCounter32("tank.snapshot.save-errors")
+
+	// metric tank.snapshot.metrics is the number of metrics in the last snapshot
+	snapshotMetrics = stats.NewGauge32("tank.snapshot.metrics")
+
+	// metric tank.snapshot.restored is the number of metrics restored from the snapshot at startup
+	restoredMetrics = stats.NewGauge32("tank.snapshot.restored")
+
+	// metric tank.snapshot.discarded is the number of metrics in the snapshot at startup that could not be restored
+	discardedMetrics = stats.NewGauge32("tank.snapshot.discarded")
+)
+
+// Offset is the position of an input in a partition of a topic.
+// Offset is the next offset to consume.
+type Offset struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// Header precedes the metrics in the snapshot file
+type Header struct {
+	Version uint8
+	Created int64
+	// since when (unix timestamp) the in-memory data is complete.
+	// used to determine how much warmup is still needed after restoring.
+	DataSince int64
+	Offsets   []Offset
+}
+
+// Input is an input that can resume consuming from the offsets recorded in a snapshot
+type Input interface {
+	// Offsets returns the offsets of all data that has been fully processed
+	Offsets() []Offset
+	// ResumeFrom makes the input start consuming at the given offsets. must be called before Start
+	ResumeFrom(offsets []Offset)
+}
+
+// Save writes a snapshot of the metrics to disk, replacing the previous one.
+func Save(metrics *mdata.AggMetrics, inputs []Input, dataSince time.Time) error {
+	pre := time.Now()
+
+	// the offsets must be recorded before capturing the metrics, so that at worst we replay
+	// some data upon restoring, which will be recognized as duplicate.
+	hdr := Header{
+		Version:   version,
+		Created:   pre.Unix(),
+		DataSince: dataSince.Unix(),
+	}
+	for _, in := range inputs {
+		hdr.Offsets = append(hdr.Offsets, in.Offsets()...)
+	}
+
+	path := filepath.Join(dir, fileName)
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	count, err := write(f, hdr, metrics)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	saveDuration.Value(time.Since(pre))
+	snapshotMetrics.SetUint32(count)
+	log.Infof("snapshot: saved %d metrics in %s", count, time.Since(pre))
+	return nil
+}
+
+func write(f *os.File, hdr Header, metrics *mdata.AggMetrics) (uint32, error) {
+	w := msgp.NewWriter(f)
+	if err := hdr.EncodeMsg(w); err != nil {
+		return 0, err
+	}
+	var count uint32
+	err := metrics.Snapshot(func(snap mdata.MetricSnapshot) error {
+		count++
+		if err := w.WriteBool(true); err != nil {
+			return err
+		}
+		return snap.EncodeMsg(w)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := w.WriteBool(false); err != nil {
+		return 0, err
+	}
+	return count, w.Flush()
+}
+
+// Load restores the metrics from the snapshot on disk, if any.
+// the returned bool indicates whether the snapshot was fully restored, in which case
+// inputs should resume from the offsets in the header.
+// if it was not, the restored data (if any) will be complemented by consuming from the
+// configured offsets as usual, with the data already present being discarded as duplicate.
+func Load(metrics *mdata.AggMetrics) (Header, bool) {
+	pre := time.Now()
+	path := filepath.Join(dir, fileName)
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("snapshot: failed to open %s: %s", path, err.Error())
+		}
+		return Header{}, false
+	}
+	defer f.Close()
+
+	r := msgp.NewReader(bufio.NewReader(f))
+	var hdr Header
+	if err := hdr.DecodeMsg(r); err != nil {
+		log.Errorf("snapshot: failed to decode header of %s: %s", path, err.Error())
+		return Header{}, false
+	}
+	if hdr.Version != version {
+		log.Warnf("snapshot: ignoring %s: unsupported version %d", path, hdr.Version)
+		return Header{}, false
+	}
+	age := pre.Sub(time.Unix(hdr.Created, 0))
+	if maxAge > 0 && age > maxAge {
+		log.Warnf("snapshot: ignoring %s: it is %s old, which is more than max-age %s", path, age, maxAge)
+		return Header{}, false
+	}
+
+	restored, discarded, err := restore(r, metrics)
+	restoredMetrics.SetUint32(restored)
+	discardedMetrics.SetUint32(discarded)
+	if err != nil {
+		log.Errorf("snapshot: failed to read %s after restoring %d metrics: %s. will consume inputs from their configured offsets", path, restored, err.Error())
+		return Header{}, false
+	}
+	if discarded > 0 {
+		log.Warnf("snapshot: restored %d metrics, but %d could not be restored. will consume inputs from their configured offsets", restored, discarded)
+		return Header{}, false
+	}
+	log.Infof("snapshot: restored %d metrics from %s old snapshot in %s", restored, age, time.Since(pre))
+	return hdr, true
+}
+
+func restore(r *msgp.Reader, metrics *mdata.AggMetrics) (uint32, uint32, error) {
+	var restored, discarded uint32
+	for {
+		more, err := r.ReadBool()
+		if err != nil {
+			return restored, discarded, err
+		}
+		if !more {
+			return restored, discarded, nil
+		}
+		var snap mdata.MetricSnapshot
+		if err := snap.DecodeMsg(r); err != nil {
+			return restored, discarded, err
+		}
+		if err := metrics.Restore(snap); err != nil {
+			log.Debugf("snapshot: could not restore metric %s: %s", snap.Key, err.Error())
+			discarded++
+			continue
+		}
+		restored++
+	}
+}
+
+// Snapshotter takes snapshots at the configured interval, and a final one when stopped
+type Snapshotter struct {
+	sync.Mutex
+	metrics   *mdata.AggMetrics
+	inputs    []Input
+	dataSince time.Time
+	shutdown  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewSnapshotter creates a Snapshotter. dataSince is the time since which the data
+// in metrics is complete: the time the process started, or the DataSince of the restored snapshot.
+func NewSnapshotter(metrics *mdata.AggMetrics, inputs []Input, dataSince time.Time) *Snapshotter {
+	return &Snapshotter{
+		metrics:   metrics,
+		inputs:    inputs,
+		dataSince: dataSince,
+		shutdown:  make(chan struct{}),
+	}
+}
+
+func (s *Snapshotter) Start() {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatalf("snapshot: failed to create dir %s: %s", dir, err.Error())
+	}
+	s.wg.Add(1)
+	go s.run()
+}
+
+func (s *Snapshotter) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.shutdown:
+			return
+		case <-ticker.C:
+			s.save()
+		}
+	}
+}
+
+func (s *Snapshotter) save() {
+	s.Lock()
+	defer s.Unlock()
+	if err := Save(s.metrics, s.inputs, s.dataSince); err != nil {
+		saveErrors.Inc()
+		log.Errorf("snapshot: failed to save: %s", err.Error())
+	}
+}
+
+// Stop stops taking periodic snapshots, and takes a final one.
+// inputs should be stopped before calling Stop.
+func (s *Snapshotter) Stop() {
+	close(s.shutdown)
+	s.wg.Wait()
+	s.save()
+}
@@ -0,0 +1,120 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/cluster"
+	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/mdata/cache"
+	"github.com/grafana/metrictank/schema"
+)
+
+type mockInput struct {
+	offsets []Offset
+}
+
+func (m *mockInput) Offsets() []Offset {
+	return m.offsets
+}
+
+func (m *mockInput) ResumeFrom(offsets []Offset) {
+	m.offsets = offsets
+}
+
+func setup(t *testing.T) func() {
+	cluster.Init("default", "test", time.Now(), "http", 6060)
+	cluster.Manager.SetPrimary(false)
+
+	_aggregations := mdata.Aggregations
+	_schemas := mdata.Schemas
+	mdata.Aggregations = conf.NewAggregations()
+	mdata.Schemas = conf.NewSchemas([]conf.Schema{{
+		Name: "schema1",
+		Retentions: conf.Retentions{
+			Orig: "1s:1h:60s:3",
+			Rets: []conf.Retention{{
+				SecondsPerPoint: 1,
+				NumberOfPoints:  3600,
+				ChunkSpan:       60,
+				NumChunks:       3,
+			}},
+		},
+	}})
+
+	_dir, _maxAge := dir, maxAge
+	tmp, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = tmp
+	maxAge = time.Hour
+
+	return func() {
+		os.RemoveAll(tmp)
+		dir, maxAge = _dir, _maxAge
+		mdata.Aggregations = _aggregations
+		mdata.Schemas = _schemas
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	defer setup(t)()
+
+	key, _ := schema.MKeyFromString("1.12345678901234567890123456789012")
+	orig := mdata.NewAggMetrics(mdata.NewMockStore(), cache.NewMockCache(), false, nil, 60, 120, 0)
+	m := orig.GetOrCreate(key, 0, 0, 1)
+	for ts := uint32(10); ts < 150; ts++ {
+		m.Add(ts, float64(ts))
+	}
+
+	in := &mockInput{offsets: []Offset{{Topic: "mdm", Partition: 0, Offset: 1234}, {Topic: "mdm", Partition: 1, Offset: 5678}}}
+	dataSince := time.Unix(1000, 0)
+	if err := Save(orig, []Input{in}, dataSince); err != nil {
+		t.Fatalf("failed to save snapshot: %s", err)
+	}
+
+	restored := mdata.NewAggMetrics(mdata.NewMockStore(), cache.NewMockCache(), false, nil, 60, 120, 0)
+	hdr, ok := Load(restored)
+	if !ok {
+		t.Fatalf("expected snapshot to be loaded")
+	}
+	if hdr.DataSince != dataSince.Unix() {
+		t.Fatalf("expected DataSince %d, got %d", dataSince.Unix(), hdr.DataSince)
+	}
+	if !reflect.DeepEqual(hdr.Offsets, in.offsets) {
+		t.Fatalf("expected offsets %v, got %v", in.offsets, hdr.Offsets)
+	}
+
+	r, ok := restored.Get(key)
+	if !ok {
+		t.Fatalf("expected metric to be restored")
+	}
+	exp, _ := m.Get(0, 1000)
+	got, _ := r.Get(0, 1000)
+	if got.Oldest != exp.Oldest || len(got.Iters) != len(exp.Iters) {
+		t.Fatalf("expected restored metric to have oldest %d and %d iters, got %d and %d", exp.Oldest, len(exp.Iters), got.Oldest, len(got.Iters))
+	}
+}
+
+func TestLoadMissingOrExpired(t *testing.T) {
+	defer setup(t)()
+
+	metrics := mdata.NewAggMetrics(mdata.NewMockStore(), cache.NewMockCache(), false, nil, 60, 120, 0)
+	if _, ok := Load(metrics); ok {
+		t.Fatalf("expected no snapshot to be loaded when there is none")
+	}
+
+	if err := Save(metrics, nil, time.Now()); err != nil {
+		t.Fatalf("failed to save snapshot: %s", err)
+	}
+	maxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, ok := Load(metrics); ok {
+		t.Fatalf("expected snapshot older than max-age to not be loaded")
+	}
+}
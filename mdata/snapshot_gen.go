@@ -0,0 +1,1719 @@
+package mdata
+
+// Code generated by github.com/tinylib/msgp DO NOT EDIT.
+
+import (
+	"github.com/grafana/metrictank/schema"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// DecodeMsg implements msgp.Decodable
+func (z *AggMetricState) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "ChunkSpan":
+			z.ChunkSpan, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "ChunkSpan")
+				return
+			}
+		case "NumChunks":
+			z.NumChunks, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "NumChunks")
+				return
+			}
+		case "CurrentChunkPos":
+			z.CurrentChunkPos, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "CurrentChunkPos")
+				return
+			}
+		case "Chunks":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Chunks")
+				return
+			}
+			if cap(z.Chunks) >= int(zb0002) {
+				z.Chunks = (z.Chunks)[:zb0002]
+			} else {
+				z.Chunks = make([]ChunkState, zb0002)
+			}
+			for za0001 := range z.Chunks {
+				err = z.Chunks[za0001].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Chunks", za0001)
+					return
+				}
+			}
+		case "Rob":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "Rob")
+					return
+				}
+				z.Rob = nil
+			} else {
+				if z.Rob == nil {
+					z.Rob = new(ReorderBufferState)
+				}
+				var zb0003 uint32
+				zb0003, err = dc.ReadMapHeader()
+				if err != nil {
+					err = msgp.WrapError(err, "Rob")
+					return
+				}
+				for zb0003 > 0 {
+					zb0003--
+					field, err = dc.ReadMapKeyPtr()
+					if err != nil {
+						err = msgp.WrapError(err, "Rob")
+						return
+					}
+					switch msgp.UnsafeString(field) {
+					case "Newest":
+						z.Rob.Newest, err = dc.ReadUint32()
+						if err != nil {
+							err = msgp.WrapError(err, "Rob", "Newest")
+							return
+						}
+					case "Buf":
+						var zb0004 uint32
+						zb0004, err = dc.ReadArrayHeader()
+						if err != nil {
+							err = msgp.WrapError(err, "Rob", "Buf")
+							return
+						}
+						if cap(z.Rob.Buf) >= int(zb0004) {
+							z.Rob.Buf = (z.Rob.Buf)[:zb0004]
+						} else {
+							z.Rob.Buf = make([]schema.Point, zb0004)
+						}
+						for za0002 := range z.Rob.Buf {
+							err = z.Rob.Buf[za0002].DecodeMsg(dc)
+							if err != nil {
+								err = msgp.WrapError(err, "Rob", "Buf", za0002)
+								return
+							}
+						}
+					default:
+						err = dc.Skip()
+						if err != nil {
+							err = msgp.WrapError(err, "Rob")
+							return
+						}
+					}
+				}
+			}
+		case "Aggregators":
+			var zb0005 uint32
+			zb0005, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Aggregators")
+				return
+			}
+			if cap(z.Aggregators) >= int(zb0005) {
+				z.Aggregators = (z.Aggregators)[:zb0005]
+			} else {
+				z.Aggregators = make([]AggregatorState, zb0005)
+			}
+			for za0003 := range z.Aggregators {
+				err = z.Aggregators[za0003].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Aggregators", za0003)
+					return
+				}
+			}
+		case "LastSaveFinish":
+			z.LastSaveFinish, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "LastSaveFinish")
+				return
+			}
+		case "LastWrite":
+			z.LastWrite, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "LastWrite")
+				return
+			}
+		case "FirstTs":
+			z.FirstTs, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "FirstTs")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *AggMetricState) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 9
+	// write "ChunkSpan"
+	err = en.Append(0x89, 0xa9, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x70, 0x61, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.ChunkSpan)
+	if err != nil {
+		err = msgp.WrapError(err, "ChunkSpan")
+		return
+	}
+	// write "NumChunks"
+	err = en.Append(0xa9, 0x4e, 0x75, 0x6d, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.NumChunks)
+	if err != nil {
+		err = msgp.WrapError(err, "NumChunks")
+		return
+	}
+	// write "CurrentChunkPos"
+	err = en.Append(0xaf, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x50, 0x6f, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.CurrentChunkPos)
+	if err != nil {
+		err = msgp.WrapError(err, "CurrentChunkPos")
+		return
+	}
+	// write "Chunks"
+	err = en.Append(0xa6, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Chunks)))
+	if err != nil {
+		err = msgp.WrapError(err, "Chunks")
+		return
+	}
+	for za0001 := range z.Chunks {
+		err = z.Chunks[za0001].EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "Chunks", za0001)
+			return
+		}
+	}
+	// write "Rob"
+	err = en.Append(0xa3, 0x52, 0x6f, 0x62)
+	if err != nil {
+		return
+	}
+	if z.Rob == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		// map header, size 2
+		// write "Newest"
+		err = en.Append(0x82, 0xa6, 0x4e, 0x65, 0x77, 0x65, 0x73, 0x74)
+		if err != nil {
+			return
+		}
+		err = en.WriteUint32(z.Rob.Newest)
+		if err != nil {
+			err = msgp.WrapError(err, "Rob", "Newest")
+			return
+		}
+		// write "Buf"
+		err = en.Append(0xa3, 0x42, 0x75, 0x66)
+		if err != nil {
+			return
+		}
+		err = en.WriteArrayHeader(uint32(len(z.Rob.Buf)))
+		if err != nil {
+			err = msgp.WrapError(err, "Rob", "Buf")
+			return
+		}
+		for za0002 := range z.Rob.Buf {
+			err = z.Rob.Buf[za0002].EncodeMsg(en)
+			if err != nil {
+				err = msgp.WrapError(err, "Rob", "Buf", za0002)
+				return
+			}
+		}
+	}
+	// write "Aggregators"
+	err = en.Append(0xab, 0x41, 0x67, 0x67, 0x72, 0x65, 0x67, 0x61, 0x74, 0x6f, 0x72, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Aggregators)))
+	if err != nil {
+		err = msgp.WrapError(err, "Aggregators")
+		return
+	}
+	for za0003 := range z.Aggregators {
+		err = z.Aggregators[za0003].EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "Aggregators", za0003)
+			return
+		}
+	}
+	// write "LastSaveFinish"
+	err = en.Append(0xae, 0x4c, 0x61, 0x73, 0x74, 0x53, 0x61, 0x76, 0x65, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.LastSaveFinish)
+	if err != nil {
+		err = msgp.WrapError(err, "LastSaveFinish")
+		return
+	}
+	// write "LastWrite"
+	err = en.Append(0xa9, 0x4c, 0x61, 0x73, 0x74, 0x57, 0x72, 0x69, 0x74, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.LastWrite)
+	if err != nil {
+		err = msgp.WrapError(err, "LastWrite")
+		return
+	}
+	// write "FirstTs"
+	err = en.Append(0xa7, 0x46, 0x69, 0x72, 0x73, 0x74, 0x54, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.FirstTs)
+	if err != nil {
+		err = msgp.WrapError(err, "FirstTs")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *AggMetricState) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 9
+	// string "ChunkSpan"
+	o = append(o, 0x89, 0xa9, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x53, 0x70, 0x61, 0x6e)
+	o = msgp.AppendUint32(o, z.ChunkSpan)
+	// string "NumChunks"
+	o = append(o, 0xa9, 0x4e, 0x75, 0x6d, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x73)
+	o = msgp.AppendUint32(o, z.NumChunks)
+	// string "CurrentChunkPos"
+	o = append(o, 0xaf, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x50, 0x6f, 0x73)
+	o = msgp.AppendInt(o, z.CurrentChunkPos)
+	// string "Chunks"
+	o = append(o, 0xa6, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Chunks)))
+	for za0001 := range z.Chunks {
+		o, err = z.Chunks[za0001].MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "Chunks", za0001)
+			return
+		}
+	}
+	// string "Rob"
+	o = append(o, 0xa3, 0x52, 0x6f, 0x62)
+	if z.Rob == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		// map header, size 2
+		// string "Newest"
+		o = append(o, 0x82, 0xa6, 0x4e, 0x65, 0x77, 0x65, 0x73, 0x74)
+		o = msgp.AppendUint32(o, z.Rob.Newest)
+		// string "Buf"
+		o = append(o, 0xa3, 0x42, 0x75, 0x66)
+		o = msgp.AppendArrayHeader(o, uint32(len(z.Rob.Buf)))
+		for za0002 := range z.Rob.Buf {
+			o, err = z.Rob.Buf[za0002].MarshalMsg(o)
+			if err != nil {
+				err = msgp.WrapError(err, "Rob", "Buf", za0002)
+				return
+			}
+		}
+	}
+	// string "Aggregators"
+	o = append(o, 0xab, 0x41, 0x67, 0x67, 0x72, 0x65, 0x67, 0x61, 0x74, 0x6f, 0x72, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Aggregators)))
+	for za0003 := range z.Aggregators {
+		o, err = z.Aggregators[za0003].MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "Aggregators", za0003)
+			return
+		}
+	}
+	// string "LastSaveFinish"
+	o = append(o, 0xae, 0x4c, 0x61, 0x73, 0x74, 0x53, 0x61, 0x76, 0x65, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68)
+	o = msgp.AppendUint32(o, z.LastSaveFinish)
+	// string "LastWrite"
+	o = append(o, 0xa9, 0x4c, 0x61, 0x73, 0x74, 0x57, 0x72, 0x69, 0x74, 0x65)
+	o = msgp.AppendUint32(o, z.LastWrite)
+	// string "FirstTs"
+	o = append(o, 0xa7, 0x46, 0x69, 0x72, 0x73, 0x74, 0x54, 0x73)
+	o = msgp.AppendUint32(o, z.FirstTs)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *AggMetricState) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "ChunkSpan":
+			z.ChunkSpan, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ChunkSpan")
+				return
+			}
+		case "NumChunks":
+			z.NumChunks, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "NumChunks")
+				return
+			}
+		case "CurrentChunkPos":
+			z.CurrentChunkPos, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "CurrentChunkPos")
+				return
+			}
+		case "Chunks":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Chunks")
+				return
+			}
+			if cap(z.Chunks) >= int(zb0002) {
+				z.Chunks = (z.Chunks)[:zb0002]
+			} else {
+				z.Chunks = make([]ChunkState, zb0002)
+			}
+			for za0001 := range z.Chunks {
+				bts, err = z.Chunks[za0001].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Chunks", za0001)
+					return
+				}
+			}
+		case "Rob":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Rob = nil
+			} else {
+				if z.Rob == nil {
+					z.Rob = new(ReorderBufferState)
+				}
+				var zb0003 uint32
+				zb0003, bts, err = msgp.ReadMapHeaderBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Rob")
+					return
+				}
+				for zb0003 > 0 {
+					zb0003--
+					field, bts, err = msgp.ReadMapKeyZC(bts)
+					if err != nil {
+						err = msgp.WrapError(err, "Rob")
+						return
+					}
+					switch msgp.UnsafeString(field) {
+					case "Newest":
+						z.Rob.Newest, bts, err = msgp.ReadUint32Bytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Rob", "Newest")
+							return
+						}
+					case "Buf":
+						var zb0004 uint32
+						zb0004, bts, err = msgp.ReadArrayHeaderBytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Rob", "Buf")
+							return
+						}
+						if cap(z.Rob.Buf) >= int(zb0004) {
+							z.Rob.Buf = (z.Rob.Buf)[:zb0004]
+						} else {
+							z.Rob.Buf = make([]schema.Point, zb0004)
+						}
+						for za0002 := range z.Rob.Buf {
+							bts, err = z.Rob.Buf[za0002].UnmarshalMsg(bts)
+							if err != nil {
+								err = msgp.WrapError(err, "Rob", "Buf", za0002)
+								return
+							}
+						}
+					default:
+						bts, err = msgp.Skip(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Rob")
+							return
+						}
+					}
+				}
+			}
+		case "Aggregators":
+			var zb0005 uint32
+			zb0005, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Aggregators")
+				return
+			}
+			if cap(z.Aggregators) >= int(zb0005) {
+				z.Aggregators = (z.Aggregators)[:zb0005]
+			} else {
+				z.Aggregators = make([]AggregatorState, zb0005)
+			}
+			for za0003 := range z.Aggregators {
+				bts, err = z.Aggregators[za0003].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Aggregators", za0003)
+					return
+				}
+			}
+		case "LastSaveFinish":
+			z.LastSaveFinish, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "LastSaveFinish")
+				return
+			}
+		case "LastWrite":
+			z.LastWrite, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "LastWrite")
+				return
+			}
+		case "FirstTs":
+			z.FirstTs, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "FirstTs")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *AggMetricState) Msgsize() (s int) {
+	s = 1 + 10 + msgp.Uint32Size + 10 + msgp.Uint32Size + 16 + msgp.IntSize + 7 + msgp.ArrayHeaderSize
+	for za0001 := range z.Chunks {
+		s += z.Chunks[za0001].Msgsize()
+	}
+	s += 4
+	if z.Rob == nil {
+		s += msgp.NilSize
+	} else {
+		s += 1 + 7 + msgp.Uint32Size + 4 + msgp.ArrayHeaderSize
+		for za0002 := range z.Rob.Buf {
+			s += z.Rob.Buf[za0002].Msgsize()
+		}
+	}
+	s += 12 + msgp.ArrayHeaderSize
+	for za0003 := range z.Aggregators {
+		s += z.Aggregators[za0003].Msgsize()
+	}
+	s += 15 + msgp.Uint32Size + 10 + msgp.Uint32Size + 8 + msgp.Uint32Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *AggregatorState) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Span":
+			z.Span, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "Span")
+				return
+			}
+		case "CurrentBoundary":
+			z.CurrentBoundary, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "CurrentBoundary")
+				return
+			}
+		case "Min":
+			z.Min, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Min")
+				return
+			}
+		case "Max":
+			z.Max, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Max")
+				return
+			}
+		case "Sum":
+			z.Sum, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Sum")
+				return
+			}
+		case "Cnt":
+			z.Cnt, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Cnt")
+				return
+			}
+		case "Lst":
+			z.Lst, err = dc.ReadFloat64()
+			if err != nil {
+				err = msgp.WrapError(err, "Lst")
+				return
+			}
+		case "MinMetric":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "MinMetric")
+					return
+				}
+				z.MinMetric = nil
+			} else {
+				if z.MinMetric == nil {
+					z.MinMetric = new(AggMetricState)
+				}
+				err = z.MinMetric.DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "MinMetric")
+					return
+				}
+			}
+		case "MaxMetric":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "MaxMetric")
+					return
+				}
+				z.MaxMetric = nil
+			} else {
+				if z.MaxMetric == nil {
+					z.MaxMetric = new(AggMetricState)
+				}
+				err = z.MaxMetric.DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "MaxMetric")
+					return
+				}
+			}
+		case "SumMetric":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "SumMetric")
+					return
+				}
+				z.SumMetric = nil
+			} else {
+				if z.SumMetric == nil {
+					z.SumMetric = new(AggMetricState)
+				}
+				err = z.SumMetric.DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "SumMetric")
+					return
+				}
+			}
+		case "CntMetric":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "CntMetric")
+					return
+				}
+				z.CntMetric = nil
+			} else {
+				if z.CntMetric == nil {
+					z.CntMetric = new(AggMetricState)
+				}
+				err = z.CntMetric.DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "CntMetric")
+					return
+				}
+			}
+		case "LstMetric":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "LstMetric")
+					return
+				}
+				z.LstMetric = nil
+			} else {
+				if z.LstMetric == nil {
+					z.LstMetric = new(AggMetricState)
+				}
+				err = z.LstMetric.DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "LstMetric")
+					return
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *AggregatorState) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 12
+	// write "Span"
+	err = en.Append(0x8c, 0xa4, 0x53, 0x70, 0x61, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.Span)
+	if err != nil {
+		err = msgp.WrapError(err, "Span")
+		return
+	}
+	// write "CurrentBoundary"
+	err = en.Append(0xaf, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x42, 0x6f, 0x75, 0x6e, 0x64, 0x61, 0x72, 0x79)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.CurrentBoundary)
+	if err != nil {
+		err = msgp.WrapError(err, "CurrentBoundary")
+		return
+	}
+	// write "Min"
+	err = en.Append(0xa3, 0x4d, 0x69, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Min)
+	if err != nil {
+		err = msgp.WrapError(err, "Min")
+		return
+	}
+	// write "Max"
+	err = en.Append(0xa3, 0x4d, 0x61, 0x78)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Max)
+	if err != nil {
+		err = msgp.WrapError(err, "Max")
+		return
+	}
+	// write "Sum"
+	err = en.Append(0xa3, 0x53, 0x75, 0x6d)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Sum)
+	if err != nil {
+		err = msgp.WrapError(err, "Sum")
+		return
+	}
+	// write "Cnt"
+	err = en.Append(0xa3, 0x43, 0x6e, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Cnt)
+	if err != nil {
+		err = msgp.WrapError(err, "Cnt")
+		return
+	}
+	// write "Lst"
+	err = en.Append(0xa3, 0x4c, 0x73, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteFloat64(z.Lst)
+	if err != nil {
+		err = msgp.WrapError(err, "Lst")
+		return
+	}
+	// write "MinMetric"
+	err = en.Append(0xa9, 0x4d, 0x69, 0x6e, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if err != nil {
+		return
+	}
+	if z.MinMetric == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = z.MinMetric.EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "MinMetric")
+			return
+		}
+	}
+	// write "MaxMetric"
+	err = en.Append(0xa9, 0x4d, 0x61, 0x78, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if err != nil {
+		return
+	}
+	if z.MaxMetric == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = z.MaxMetric.EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "MaxMetric")
+			return
+		}
+	}
+	// write "SumMetric"
+	err = en.Append(0xa9, 0x53, 0x75, 0x6d, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if err != nil {
+		return
+	}
+	if z.SumMetric == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = z.SumMetric.EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "SumMetric")
+			return
+		}
+	}
+	// write "CntMetric"
+	err = en.Append(0xa9, 0x43, 0x6e, 0x74, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if err != nil {
+		return
+	}
+	if z.CntMetric == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = z.CntMetric.EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "CntMetric")
+			return
+		}
+	}
+	// write "LstMetric"
+	err = en.Append(0xa9, 0x4c, 0x73, 0x74, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if err != nil {
+		return
+	}
+	if z.LstMetric == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = z.LstMetric.EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "LstMetric")
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *AggregatorState) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 12
+	// string "Span"
+	o = append(o, 0x8c, 0xa4, 0x53, 0x70, 0x61, 0x6e)
+	o = msgp.AppendUint32(o, z.Span)
+	// string "CurrentBoundary"
+	o = append(o, 0xaf, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x42, 0x6f, 0x75, 0x6e, 0x64, 0x61, 0x72, 0x79)
+	o = msgp.AppendUint32(o, z.CurrentBoundary)
+	// string "Min"
+	o = append(o, 0xa3, 0x4d, 0x69, 0x6e)
+	o = msgp.AppendFloat64(o, z.Min)
+	// string "Max"
+	o = append(o, 0xa3, 0x4d, 0x61, 0x78)
+	o = msgp.AppendFloat64(o, z.Max)
+	// string "Sum"
+	o = append(o, 0xa3, 0x53, 0x75, 0x6d)
+	o = msgp.AppendFloat64(o, z.Sum)
+	// string "Cnt"
+	o = append(o, 0xa3, 0x43, 0x6e, 0x74)
+	o = msgp.AppendFloat64(o, z.Cnt)
+	// string "Lst"
+	o = append(o, 0xa3, 0x4c, 0x73, 0x74)
+	o = msgp.AppendFloat64(o, z.Lst)
+	// string "MinMetric"
+	o = append(o, 0xa9, 0x4d, 0x69, 0x6e, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if z.MinMetric == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o, err = z.MinMetric.MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "MinMetric")
+			return
+		}
+	}
+	// string "MaxMetric"
+	o = append(o, 0xa9, 0x4d, 0x61, 0x78, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if z.MaxMetric == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o, err = z.MaxMetric.MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "MaxMetric")
+			return
+		}
+	}
+	// string "SumMetric"
+	o = append(o, 0xa9, 0x53, 0x75, 0x6d, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if z.SumMetric == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o, err = z.SumMetric.MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "SumMetric")
+			return
+		}
+	}
+	// string "CntMetric"
+	o = append(o, 0xa9, 0x43, 0x6e, 0x74, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if z.CntMetric == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o, err = z.CntMetric.MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "CntMetric")
+			return
+		}
+	}
+	// string "LstMetric"
+	o = append(o, 0xa9, 0x4c, 0x73, 0x74, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63)
+	if z.LstMetric == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o, err = z.LstMetric.MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "LstMetric")
+			return
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *AggregatorState) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Span":
+			z.Span, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Span")
+				return
+			}
+		case "CurrentBoundary":
+			z.CurrentBoundary, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "CurrentBoundary")
+				return
+			}
+		case "Min":
+			z.Min, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Min")
+				return
+			}
+		case "Max":
+			z.Max, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Max")
+				return
+			}
+		case "Sum":
+			z.Sum, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Sum")
+				return
+			}
+		case "Cnt":
+			z.Cnt, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Cnt")
+				return
+			}
+		case "Lst":
+			z.Lst, bts, err = msgp.ReadFloat64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Lst")
+				return
+			}
+		case "MinMetric":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.MinMetric = nil
+			} else {
+				if z.MinMetric == nil {
+					z.MinMetric = new(AggMetricState)
+				}
+				bts, err = z.MinMetric.UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "MinMetric")
+					return
+				}
+			}
+		case "MaxMetric":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.MaxMetric = nil
+			} else {
+				if z.MaxMetric == nil {
+					z.MaxMetric = new(AggMetricState)
+				}
+				bts, err = z.MaxMetric.UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "MaxMetric")
+					return
+				}
+			}
+		case "SumMetric":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.SumMetric = nil
+			} else {
+				if z.SumMetric == nil {
+					z.SumMetric = new(AggMetricState)
+				}
+				bts, err = z.SumMetric.UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "SumMetric")
+					return
+				}
+			}
+		case "CntMetric":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.CntMetric = nil
+			} else {
+				if z.CntMetric == nil {
+					z.CntMetric = new(AggMetricState)
+				}
+				bts, err = z.CntMetric.UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "CntMetric")
+					return
+				}
+			}
+		case "LstMetric":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.LstMetric = nil
+			} else {
+				if z.LstMetric == nil {
+					z.LstMetric = new(AggMetricState)
+				}
+				bts, err = z.LstMetric.UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "LstMetric")
+					return
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *AggregatorState) Msgsize() (s int) {
+	s = 1 + 5 + msgp.Uint32Size + 16 + msgp.Uint32Size + 4 + msgp.Float64Size + 4 + msgp.Float64Size + 4 + msgp.Float64Size + 4 + msgp.Float64Size + 4 + msgp.Float64Size + 10
+	if z.MinMetric == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.MinMetric.Msgsize()
+	}
+	s += 10
+	if z.MaxMetric == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.MaxMetric.Msgsize()
+	}
+	s += 10
+	if z.SumMetric == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.SumMetric.Msgsize()
+	}
+	s += 10
+	if z.CntMetric == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.CntMetric.Msgsize()
+	}
+	s += 10
+	if z.LstMetric == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.LstMetric.Msgsize()
+	}
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *ChunkState) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Series":
+			z.Series, err = dc.ReadBytes(z.Series)
+			if err != nil {
+				err = msgp.WrapError(err, "Series")
+				return
+			}
+		case "Finished":
+			z.Finished, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "Finished")
+				return
+			}
+		case "NumPoints":
+			z.NumPoints, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "NumPoints")
+				return
+			}
+		case "First":
+			z.First, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "First")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *ChunkState) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 4
+	// write "Series"
+	err = en.Append(0x84, 0xa6, 0x53, 0x65, 0x72, 0x69, 0x65, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.Series)
+	if err != nil {
+		err = msgp.WrapError(err, "Series")
+		return
+	}
+	// write "Finished"
+	err = en.Append(0xa8, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x65, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.Finished)
+	if err != nil {
+		err = msgp.WrapError(err, "Finished")
+		return
+	}
+	// write "NumPoints"
+	err = en.Append(0xa9, 0x4e, 0x75, 0x6d, 0x50, 0x6f, 0x69, 0x6e, 0x74, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.NumPoints)
+	if err != nil {
+		err = msgp.WrapError(err, "NumPoints")
+		return
+	}
+	// write "First"
+	err = en.Append(0xa5, 0x46, 0x69, 0x72, 0x73, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.First)
+	if err != nil {
+		err = msgp.WrapError(err, "First")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *ChunkState) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 4
+	// string "Series"
+	o = append(o, 0x84, 0xa6, 0x53, 0x65, 0x72, 0x69, 0x65, 0x73)
+	o = msgp.AppendBytes(o, z.Series)
+	// string "Finished"
+	o = append(o, 0xa8, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x65, 0x64)
+	o = msgp.AppendBool(o, z.Finished)
+	// string "NumPoints"
+	o = append(o, 0xa9, 0x4e, 0x75, 0x6d, 0x50, 0x6f, 0x69, 0x6e, 0x74, 0x73)
+	o = msgp.AppendUint32(o, z.NumPoints)
+	// string "First"
+	o = append(o, 0xa5, 0x46, 0x69, 0x72, 0x73, 0x74)
+	o = msgp.AppendBool(o, z.First)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *ChunkState) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Series":
+			z.Series, bts, err = msgp.ReadBytesBytes(bts, z.Series)
+			if err != nil {
+				err = msgp.WrapError(err, "Series")
+				return
+			}
+		case "Finished":
+			z.Finished, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Finished")
+				return
+			}
+		case "NumPoints":
+			z.NumPoints, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "NumPoints")
+				return
+			}
+		case "First":
+			z.First, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "First")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *ChunkState) Msgsize() (s int) {
+	s = 1 + 7 + msgp.BytesPrefixSize + len(z.Series) + 9 + msgp.BoolSize + 10 + msgp.Uint32Size + 6 + msgp.BoolSize
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *MetricSnapshot) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Key":
+			err = z.Key.DecodeMsg(dc)
+			if err != nil {
+				err = msgp.WrapError(err, "Key")
+				return
+			}
+		case "SchemaId":
+			z.SchemaId, err = dc.ReadUint16()
+			if err != nil {
+				err = msgp.WrapError(err, "SchemaId")
+				return
+			}
+		case "AggId":
+			z.AggId, err = dc.ReadUint16()
+			if err != nil {
+				err = msgp.WrapError(err, "AggId")
+				return
+			}
+		case "Interval":
+			z.Interval, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "Interval")
+				return
+			}
+		case "State":
+			err = z.State.DecodeMsg(dc)
+			if err != nil {
+				err = msgp.WrapError(err, "State")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *MetricSnapshot) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 5
+	// write "Key"
+	err = en.Append(0x85, 0xa3, 0x4b, 0x65, 0x79)
+	if err != nil {
+		return
+	}
+	err = z.Key.EncodeMsg(en)
+	if err != nil {
+		err = msgp.WrapError(err, "Key")
+		return
+	}
+	// write "SchemaId"
+	err = en.Append(0xa8, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x49, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint16(z.SchemaId)
+	if err != nil {
+		err = msgp.WrapError(err, "SchemaId")
+		return
+	}
+	// write "AggId"
+	err = en.Append(0xa5, 0x41, 0x67, 0x67, 0x49, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint16(z.AggId)
+	if err != nil {
+		err = msgp.WrapError(err, "AggId")
+		return
+	}
+	// write "Interval"
+	err = en.Append(0xa8, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.Interval)
+	if err != nil {
+		err = msgp.WrapError(err, "Interval")
+		return
+	}
+	// write "State"
+	err = en.Append(0xa5, 0x53, 0x74, 0x61, 0x74, 0x65)
+	if err != nil {
+		return
+	}
+	err = z.State.EncodeMsg(en)
+	if err != nil {
+		err = msgp.WrapError(err, "State")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *MetricSnapshot) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 5
+	// string "Key"
+	o = append(o, 0x85, 0xa3, 0x4b, 0x65, 0x79)
+	o, err = z.Key.MarshalMsg(o)
+	if err != nil {
+		err = msgp.WrapError(err, "Key")
+		return
+	}
+	// string "SchemaId"
+	o = append(o, 0xa8, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x49, 0x64)
+	o = msgp.AppendUint16(o, z.SchemaId)
+	// string "AggId"
+	o = append(o, 0xa5, 0x41, 0x67, 0x67, 0x49, 0x64)
+	o = msgp.AppendUint16(o, z.AggId)
+	// string "Interval"
+	o = append(o, 0xa8, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c)
+	o = msgp.AppendUint32(o, z.Interval)
+	// string "State"
+	o = append(o, 0xa5, 0x53, 0x74, 0x61, 0x74, 0x65)
+	o, err = z.State.MarshalMsg(o)
+	if err != nil {
+		err = msgp.WrapError(err, "State")
+		return
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *MetricSnapshot) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Key":
+			bts, err = z.Key.UnmarshalMsg(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Key")
+				return
+			}
+		case "SchemaId":
+			z.SchemaId, bts, err = msgp.ReadUint16Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "SchemaId")
+				return
+			}
+		case "AggId":
+			z.AggId, bts, err = msgp.ReadUint16Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "AggId")
+				return
+			}
+		case "Interval":
+			z.Interval, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Interval")
+				return
+			}
+		case "State":
+			bts, err = z.State.UnmarshalMsg(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "State")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *MetricSnapshot) Msgsize() (s int) {
+	s = 1 + 4 + z.Key.Msgsize() + 9 + msgp.Uint16Size + 6 + msgp.Uint16Size + 9 + msgp.Uint32Size + 6 + z.State.Msgsize()
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *ReorderBufferState) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Newest":
+			z.Newest, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "Newest")
+				return
+			}
+		case "Buf":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Buf")
+				return
+			}
+			if cap(z.Buf) >= int(zb0002) {
+				z.Buf = (z.Buf)[:zb0002]
+			} else {
+				z.Buf = make([]schema.Point, zb0002)
+			}
+			for za0001 := range z.Buf {
+				err = z.Buf[za0001].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Buf", za0001)
+					return
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *ReorderBufferState) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 2
+	// write "Newest"
+	err = en.Append(0x82, 0xa6, 0x4e, 0x65, 0x77, 0x65, 0x73, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.Newest)
+	if err != nil {
+		err = msgp.WrapError(err, "Newest")
+		return
+	}
+	// write "Buf"
+	err = en.Append(0xa3, 0x42, 0x75, 0x66)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Buf)))
+	if err != nil {
+		err = msgp.WrapError(err, "Buf")
+		return
+	}
+	for za0001 := range z.Buf {
+		err = z.Buf[za0001].EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "Buf", za0001)
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *ReorderBufferState) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 2
+	// string "Newest"
+	o = append(o, 0x82, 0xa6, 0x4e, 0x65, 0x77, 0x65, 0x73, 0x74)
+	o = msgp.AppendUint32(o, z.Newest)
+	// string "Buf"
+	o = append(o, 0xa3, 0x42, 0x75, 0x66)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Buf)))
+	for za0001 := range z.Buf {
+		o, err = z.Buf[za0001].MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "Buf", za0001)
+			return
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *ReorderBufferState) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Newest":
+			z.Newest, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Newest")
+				return
+			}
+		case "Buf":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Buf")
+				return
+			}
+			if cap(z.Buf) >= int(zb0002) {
+				z.Buf = (z.Buf)[:zb0002]
+			} else {
+				z.Buf = make([]schema.Point, zb0002)
+			}
+			for za0001 := range z.Buf {
+				bts, err = z.Buf[za0001].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Buf", za0001)
+					return
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *ReorderBufferState) Msgsize() (s int) {
+	s = 1 + 7 + msgp.Uint32Size + 4 + msgp.ArrayHeaderSize
+	for za0001 := range z.Buf {
+		s += z.Buf[za0001].Msgsize()
+	}
+	return
+}
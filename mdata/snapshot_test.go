@@ -0,0 +1,221 @@
+package mdata
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/cluster"
+	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/schema"
+)
+
+func setSnapshotTestConfig(numChunks uint32) {
+	Aggregations = conf.NewAggregations()
+	Schemas = conf.NewSchemas([]conf.Schema{{
+		Name:          "schema1",
+		ReorderWindow: 5,
+		Retentions: conf.Retentions{
+			Orig: "1s:1h:60s:3,10s:1h:120s:2",
+			Rets: []conf.Retention{
+				{
+					SecondsPerPoint: 1,
+					NumberOfPoints:  3600,
+					ChunkSpan:       60,
+					NumChunks:       numChunks,
+				}, {
+					SecondsPerPoint: 10,
+					NumberOfPoints:  360,
+					ChunkSpan:       120,
+					NumChunks:       2,
+				}},
+		},
+	}})
+}
+
+// snapshotRoundTrip snapshots the given AggMetrics, and encodes and decodes the snapshots
+func snapshotRoundTrip(t *testing.T, ms *AggMetrics) []MetricSnapshot {
+	var snaps []MetricSnapshot
+	err := ms.Snapshot(func(snap MetricSnapshot) error {
+		buf, err := snap.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		var decoded MetricSnapshot
+		if _, err := decoded.UnmarshalMsg(buf); err != nil {
+			return err
+		}
+		snaps = append(snaps, decoded)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to snapshot: %s", err)
+	}
+	return snaps
+}
+
+func assertSameData(t *testing.T, exp, got Metric) {
+	expRes, err := exp.Get(0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotRes, err := got.Get(0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPointsEqual(t, gotRes.Points, expRes.Points)
+	assertPointsEqual(t, itersToPoints(gotRes.Iters), itersToPoints(expRes.Iters))
+	if gotRes.Oldest != expRes.Oldest {
+		t.Fatalf("expected oldest %d, got %d", expRes.Oldest, gotRes.Oldest)
+	}
+
+	for _, cons := range []consolidation.Consolidator{consolidation.Sum, consolidation.Cnt} {
+		expRes, err := exp.GetAggregated(cons, 10, 0, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotRes, err := got.GetAggregated(cons, 10, 0, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPointsEqual(t, itersToPoints(gotRes.Iters), itersToPoints(expRes.Iters))
+	}
+}
+
+func TestAggMetricsSnapshotRestore(t *testing.T) {
+	cluster.Init("default", "test", time.Now(), "http", 6060)
+	cluster.Manager.SetPrimary(false)
+
+	_aggregations := Aggregations
+	_schemas := Schemas
+	defer func() {
+		Aggregations = _aggregations
+		Schemas = _schemas
+	}()
+	setSnapshotTestConfig(3)
+
+	key, _ := schema.MKeyFromString("1.12345678901234567890123456789012")
+	orig := NewAggMetrics(NewMockStore(), NewMockCachePusher(), false, nil, 60, 120, 0)
+	m := orig.GetOrCreate(key, 0, 0, 1)
+	for ts := uint32(10); ts < 150; ts++ {
+		if ts%7 == 0 {
+			// leave gaps and send them out of order, so the reorder buffer has work to do
+			continue
+		}
+		m.Add(ts, float64(ts%13))
+		if ts%7 == 3 {
+			m.Add(ts-3, float64(ts))
+		}
+	}
+
+	snaps := snapshotRoundTrip(t, orig)
+	if len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(snaps))
+	}
+
+	restored := NewAggMetrics(NewMockStore(), NewMockCachePusher(), false, nil, 60, 120, 0)
+	if err := restored.Restore(snaps[0]); err != nil {
+		t.Fatalf("failed to restore: %s", err)
+	}
+	r, ok := restored.Get(key)
+	if !ok {
+		t.Fatalf("expected metric to exist after restore")
+	}
+	assertSameData(t, m, r)
+
+	// both should continue identically, including the in-progress chunks and aggregations
+	for ts := uint32(150); ts < 400; ts++ {
+		m.Add(ts, float64(ts%11))
+		r.Add(ts, float64(ts%11))
+	}
+	assertSameData(t, m, r)
+
+	// restoring into a metric which already has data is not allowed
+	if err := restored.Restore(snaps[0]); err == nil {
+		t.Fatalf("expected error when restoring into a metric with data")
+	}
+}
+
+func TestAggMetricsRestoreMismatch(t *testing.T) {
+	cluster.Init("default", "test", time.Now(), "http", 6060)
+	cluster.Manager.SetPrimary(false)
+
+	_aggregations := Aggregations
+	_schemas := Schemas
+	defer func() {
+		Aggregations = _aggregations
+		Schemas = _schemas
+	}()
+	setSnapshotTestConfig(3)
+
+	key, _ := schema.MKeyFromString("1.12345678901234567890123456789012")
+	orig := NewAggMetrics(NewMockStore(), NewMockCachePusher(), false, nil, 60, 120, 0)
+	m := orig.GetOrCreate(key, 0, 0, 1)
+	for ts := uint32(10); ts < 100; ts++ {
+		m.Add(ts, 1)
+	}
+	snaps := snapshotRoundTrip(t, orig)
+
+	// the number of chunks to keep changed since the snapshot was taken
+	setSnapshotTestConfig(4)
+	restored := NewAggMetrics(NewMockStore(), NewMockCachePusher(), false, nil, 60, 120, 0)
+	if err := restored.Restore(snaps[0]); err != errSnapshotMismatch {
+		t.Fatalf("expected errSnapshotMismatch, got %v", err)
+	}
+}
+
+// chunks that were queued for saving, but not confirmed saved, when the snapshot was taken
+// must be saved again after a restore.
+func TestAggMetricsRestoreUnconfirmedSaves(t *testing.T) {
+	cluster.Init("default", "test", time.Now(), "http", 6060)
+	cluster.Manager.SetPrimary(true)
+	defer cluster.Manager.SetPrimary(false)
+
+	_aggregations := Aggregations
+	_schemas := Schemas
+	defer func() {
+		Aggregations = _aggregations
+		Schemas = _schemas
+	}()
+	setSnapshotTestConfig(3)
+
+	key, _ := schema.MKeyFromString("1.12345678901234567890123456789012")
+	// the MockStore never confirms the saves, as if we crashed before the write queue was processed
+	store := NewMockStore()
+	orig := NewAggMetrics(store, NewMockCachePusher(), false, nil, 60, 120, 0)
+	m := orig.GetOrCreate(key, 0, 0, 1)
+	for ts := uint32(1000); ts < 1130; ts++ {
+		m.Add(ts, 1)
+	}
+	rawKey := schema.AMKey{MKey: key}
+	itgens, _ := store.Search(context.Background(), rawKey, 0, 0, 2000)
+	if len(itgens) != 2 {
+		t.Fatalf("expected chunks 960 and 1020 to be queued for saving, got %d chunks", len(itgens))
+	}
+	// only the save of the first chunk got confirmed
+	m.(*AggMetric).SyncChunkSaveState(960, false)()
+
+	snaps := snapshotRoundTrip(t, orig)
+	restoredStore := NewMockStore()
+	restored := NewAggMetrics(restoredStore, NewMockCachePusher(), false, nil, 60, 120, 0)
+	if err := restored.Restore(snaps[0]); err != nil {
+		t.Fatalf("failed to restore: %s", err)
+	}
+	r, _ := restored.Get(key)
+	for ts := uint32(1130); ts < 1150; ts++ {
+		r.Add(ts, 1)
+	}
+
+	itgens, _ = restoredStore.Search(context.Background(), rawKey, 0, 0, 2000)
+	var t0s []uint32
+	for _, itgen := range itgens {
+		t0s = append(t0s, itgen.T0)
+	}
+	sort.Slice(t0s, func(i, j int) bool { return t0s[i] < t0s[j] })
+	if !reflect.DeepEqual(t0s, []uint32{1020, 1080}) {
+		t.Fatalf("expected the unconfirmed chunk 1020 and the finished chunk 1080 to be saved after restore, got %v", t0s)
+	}
+}
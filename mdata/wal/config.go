@@ -0,0 +1,45 @@
+package wal
+
+import (
+	"flag"
+	"time"
+
+	"github.com/grafana/globalconf"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	Enabled      bool
+	dir          string
+	segmentSize  int
+	syncInterval time.Duration
+	numShards    int
+)
+
+func ConfigSetup() {
+	fs := flag.NewFlagSet("wal", flag.ExitOnError)
+	fs.BoolVar(&Enabled, "enabled", false, "append ingested points to a local write-ahead log, and replay it on startup, such that the data in unsaved chunks survives a restart. meant for inputs that can't replay data themselves (carbon)")
+	fs.StringVar(&dir, "dir", "/var/lib/metrictank/wal", "directory to store the write-ahead log segments in")
+	fs.IntVar(&segmentSize, "segment-size", 64*1024*1024, "size in bytes after which a new segment is started. segments can only be removed once all chunks they have points for are saved")
+	fs.IntVar(&numShards, "shards", 8, "number of independent logs the series are spread over, such that points of different series can be appended concurrently")
+	fs.DurationVar(&syncInterval, "sync-interval", time.Second, "interval at which appended points are written and synced to disk. points received within the last interval may be lost upon a crash")
+	globalconf.Register("wal", fs, flag.ExitOnError)
+}
+
+func ConfigProcess() {
+	if !Enabled {
+		return
+	}
+	if dir == "" {
+		log.Fatal("wal: dir must be set")
+	}
+	if segmentSize <= 0 {
+		log.Fatal("wal: segment-size must be greater than 0")
+	}
+	if numShards <= 0 {
+		log.Fatal("wal: shards must be greater than 0")
+	}
+	if syncInterval <= 0 {
+		log.Fatal("wal: sync-interval must be greater than 0")
+	}
+}
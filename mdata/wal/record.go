@@ -0,0 +1,111 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/grafana/metrictank/schema"
+)
+
+// record types
+const (
+	// a point of a series, along with what is needed to create the series in AggMetrics
+	recordPoint byte = 1
+	// the timestamp until which all raw data of a series has been saved
+	recordSaved byte = 2
+)
+
+// record sizes, including the type and the trailing crc
+const (
+	mkeySize        = 16 + 4
+	pointRecordSize = 1 + mkeySize + 2 + 2 + 4 + 4 + 8 + 4
+	savedRecordSize = 1 + mkeySize + 4 + 4
+)
+
+var errCorrupt = errors.New("corrupt record")
+
+type record struct {
+	typ      byte
+	key      schema.MKey
+	schemaId uint16
+	aggId    uint16
+	interval uint32
+	ts       uint32 // for recordSaved: all raw data before this timestamp has been saved
+	val      float64
+}
+
+// encode appends the encoded record to buf
+func (r record) encode(buf []byte) []byte {
+	start := len(buf)
+	var b [pointRecordSize]byte
+	b[0] = r.typ
+	copy(b[1:17], r.key.Key[:])
+	binary.LittleEndian.PutUint32(b[17:21], r.key.Org)
+	pos := 1 + mkeySize
+	if r.typ == recordPoint {
+		binary.LittleEndian.PutUint16(b[pos:], r.schemaId)
+		binary.LittleEndian.PutUint16(b[pos+2:], r.aggId)
+		binary.LittleEndian.PutUint32(b[pos+4:], r.interval)
+		binary.LittleEndian.PutUint32(b[pos+8:], r.ts)
+		binary.LittleEndian.PutUint64(b[pos+12:], math.Float64bits(r.val))
+		pos += 20
+	} else {
+		binary.LittleEndian.PutUint32(b[pos:], r.ts)
+		pos += 4
+	}
+	buf = append(buf, b[:pos]...)
+	return appendUint32(buf, crc32.ChecksumIEEE(buf[start:]))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// readRecord reads the next record.
+// it returns io.EOF if there are no more records, and errCorrupt or io.ErrUnexpectedEOF
+// if the record is invalid or incomplete, e.g. because we crashed while writing it.
+func readRecord(r *bufio.Reader, b []byte) (record, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return record{}, err
+	}
+	var size int
+	switch typ {
+	case recordPoint:
+		size = pointRecordSize
+	case recordSaved:
+		size = savedRecordSize
+	default:
+		return record{}, errCorrupt
+	}
+	b = b[:size]
+	b[0] = typ
+	if _, err := io.ReadFull(r, b[1:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return record{}, err
+	}
+	if crc32.ChecksumIEEE(b[:size-4]) != binary.LittleEndian.Uint32(b[size-4:]) {
+		return record{}, errCorrupt
+	}
+
+	rec := record{typ: typ}
+	copy(rec.key.Key[:], b[1:17])
+	rec.key.Org = binary.LittleEndian.Uint32(b[17:21])
+	pos := 1 + mkeySize
+	if typ == recordPoint {
+		rec.schemaId = binary.LittleEndian.Uint16(b[pos:])
+		rec.aggId = binary.LittleEndian.Uint16(b[pos+2:])
+		rec.interval = binary.LittleEndian.Uint32(b[pos+4:])
+		rec.ts = binary.LittleEndian.Uint32(b[pos+8:])
+		rec.val = math.Float64frombits(binary.LittleEndian.Uint64(b[pos+12:]))
+	} else {
+		rec.ts = binary.LittleEndian.Uint32(b[pos:])
+	}
+	return rec, nil
+}
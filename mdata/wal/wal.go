@@ -0,0 +1,622 @@
+// Package wal provides a write-ahead log for the points that are ingested into the AggMetrics.
+// Points are appended to the log before they are added to their AggMetric, and the log is
+// replayed on startup, such that the data in chunks that were not saved yet survives a restart.
+// This is meant for inputs which, unlike kafka-mdm, can't replay data themselves.
+//
+// The log consists of shards, which each hold the points of a subset of the series in their own
+// segments, such that points of different series can be appended concurrently.
+// A segment is removed once the raw chunks of all the points it holds have been saved, which the WAL
+// learns about as a persist notifier, both of our own saves and, via the cluster notifier, of the saves
+// of other nodes. Nodes that don't save chunks also remove segments once all their points have been
+// evicted from memory.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/metrictank/cluster"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/schema"
+	"github.com/grafana/metrictank/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	segmentSuffix = ".wal"
+	// interval at which we check whether segments can be removed
+	truncateInterval = time.Minute
+)
+
+var (
+	// metric tank.wal.replayed is the number of points replayed from the write-ahead log at startup
+	replayedPoints = stats.NewGauge32("tank.wal.replayed")
+
+	// metric tank.wal.replay-skipped is the number of points in the write-ahead log at startup that were already saved
+	skippedPoints = stats.NewGauge32("tank.wal.replay-skipped")
+
+	// metric tank.wal.replay-corrupt is the number of segments in the write-ahead log at startup that were (partially) corrupt
+	corruptSegments = stats.NewGauge32("tank.wal.replay-corrupt")
+
+	// metric tank.wal.segments is the number of segments of the write-ahead log on disk
+	numSegments = stats.NewGauge32("tank.wal.segments")
+
+	// metric tank.wal.write-errors is the number of errors writing to or syncing the write-ahead log
+	writeErrors = stats.NewCounter32("tank.wal.write-errors")
+)
+
+// seriesState is what the WAL tracks of each series it has points for
+type seriesState struct {
+	chunkSpan  uint32 // chunkspan of the raw archive
+	numChunks  uint32 // number of raw chunks kept in memory
+	savedUntil uint32 // all raw data before this timestamp has been saved
+	lastTs     uint32 // the highest timestamp of the points of the series
+}
+
+// inMemoryFrom returns the T0 of the oldest raw chunk that the AggMetric of the series still holds.
+// points before it have been evicted from memory, so there is no use in replaying them.
+func (st seriesState) inMemoryFrom() uint32 {
+	if st.chunkSpan == 0 {
+		return 0
+	}
+	t0 := st.lastTs - st.lastTs%st.chunkSpan
+	back := (st.numChunks - 1) * st.chunkSpan
+	if t0 < back {
+		return 0
+	}
+	return t0 - back
+}
+
+// segment is a file of the write-ahead log
+type segment struct {
+	id   int
+	path string
+	// the highest timestamp of the points of each series in the segment.
+	// once all of these are saved, the segment can be removed
+	series map[schema.MKey]uint32
+}
+
+func newSegment(dir string, id int) *segment {
+	return &segment{
+		id:     id,
+		path:   filepath.Join(dir, fmt.Sprintf("%08d%s", id, segmentSuffix)),
+		series: make(map[schema.MKey]uint32),
+	}
+}
+
+// shard is an independent log, that holds the points of a subset of the series.
+// points of different shards can be appended concurrently.
+type shard struct {
+	sync.Mutex
+	dir      string
+	series   map[schema.MKey]*seriesState
+	segments []*segment // closed segments, oldest first
+	cur      *segment
+	f        *os.File
+	w        *bufio.Writer
+	size     int
+	buf      []byte
+}
+
+// WAL is the write-ahead log. It implements mdata.Notifier to learn which chunks have been saved.
+// The series are spread over shards, each with their own segments in a subdirectory of dir.
+type WAL struct {
+	shards []*shard
+
+	// segments replayed on startup. they may hold points of series of any shard
+	// (e.g. written by an older version, or with a different number of shards)
+	sync.Mutex
+	replayed []*segment
+
+	shutdown chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New replays the write-ahead log on disk, if any, into metrics and returns a WAL that appends
+// to new segments. It must be called before any data is ingested.
+func New(metrics mdata.Metrics) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &WAL{
+		shutdown: make(chan struct{}),
+	}
+	for i := 0; i < numShards; i++ {
+		s := &shard{
+			dir:    filepath.Join(dir, strconv.Itoa(i)),
+			series: make(map[schema.MKey]*seriesState),
+		}
+		if err := os.MkdirAll(s.dir, 0755); err != nil {
+			return nil, err
+		}
+		w.shards = append(w.shards, s)
+	}
+
+	// the segments in dir itself were written before the log was sharded
+	dirs := []string{dir}
+	shardDirs, err := shardDirs()
+	if err != nil {
+		return nil, err
+	}
+	dirs = append(dirs, shardDirs...)
+	var segments []*segment
+	lastIds := make(map[string]int)
+	for _, d := range dirs {
+		ids, err := segmentIds(d)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			segments = append(segments, newSegment(d, id))
+			lastIds[d] = id
+		}
+	}
+	if err := w.replay(metrics, segments); err != nil {
+		return nil, err
+	}
+	for _, s := range w.shards {
+		if err := s.open(lastIds[s.dir] + 1); err != nil {
+			return nil, err
+		}
+	}
+	w.updateNumSegments()
+	return w, nil
+}
+
+// shardDirs returns the shard directories on disk, in ascending order
+func shardDirs() ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		id, err := strconv.Atoi(f.Name())
+		if err != nil {
+			log.Warnf("wal: ignoring unexpected directory %s", f.Name())
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	dirs := make([]string, len(ids))
+	for i, id := range ids {
+		dirs[i] = filepath.Join(dir, strconv.Itoa(id))
+	}
+	return dirs, nil
+}
+
+// segmentIds returns the ids of the segments in the given directory, in ascending order
+func segmentIds(dir string) ([]int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), segmentSuffix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(f.Name(), segmentSuffix))
+		if err != nil {
+			log.Warnf("wal: ignoring unexpected file %s", f.Name())
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// readSegment calls fn for each record in the segment.
+// it returns whether the segment was read entirely, or ended in a corrupt or incomplete record
+func readSegment(seg *segment, fn func(rec record)) (bool, error) {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	b := make([]byte, pointRecordSize)
+	for {
+		rec, err := readRecord(r, b)
+		if err == io.EOF {
+			return true, nil
+		}
+		if err == errCorrupt || err == io.ErrUnexpectedEOF {
+			log.Warnf("wal: segment %s ends in a corrupt or incomplete record. skipping the remainder", seg.path)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		fn(rec)
+	}
+}
+
+// replay adds the points of the given segments to metrics.
+// points that were already saved are skipped: adding them would create chunks that
+// only have part of the data, and those would overwrite the complete chunks in the store.
+// a saved record may come after points it applies to, so we first collect all of them.
+func (w *WAL) replay(metrics mdata.Metrics, segments []*segment) error {
+	if len(segments) == 0 {
+		return nil
+	}
+	pre := time.Now()
+	series := make(map[schema.MKey]*seriesState)
+	for _, seg := range segments {
+		_, err := readSegment(seg, func(rec record) {
+			if rec.typ != recordSaved {
+				return
+			}
+			st := state(series, rec.key)
+			if rec.ts > st.savedUntil {
+				st.savedUntil = rec.ts
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var replayed, skipped, corrupt uint32
+	for _, seg := range segments {
+		complete, err := readSegment(seg, func(rec record) {
+			if rec.typ != recordPoint {
+				return
+			}
+			st := pointState(series, rec.key, rec.schemaId)
+			if rec.ts < st.savedUntil {
+				skipped++
+				return
+			}
+			if rec.ts > seg.series[rec.key] {
+				seg.series[rec.key] = rec.ts
+			}
+			if rec.ts > st.lastTs {
+				st.lastTs = rec.ts
+			}
+			metrics.GetOrCreate(rec.key, rec.schemaId, rec.aggId, rec.interval).Add(rec.ts, rec.val)
+			replayed++
+		})
+		if err != nil {
+			return err
+		}
+		if !complete {
+			corrupt++
+		}
+		w.replayed = append(w.replayed, seg)
+	}
+	for key, st := range series {
+		w.shard(key).series[key] = st
+	}
+	replayedPoints.SetUint32(replayed)
+	skippedPoints.SetUint32(skipped)
+	corruptSegments.SetUint32(corrupt)
+	log.Infof("wal: replayed %d points from %d segments in %s. skipped %d points that were already saved", replayed, len(segments), time.Since(pre), skipped)
+	return nil
+}
+
+// shard returns the shard that holds the points of the given series
+func (w *WAL) shard(key schema.MKey) *shard {
+	return w.shards[binary.LittleEndian.Uint32(key.Key[:4])%uint32(len(w.shards))]
+}
+
+// state returns the state of the given series, creating it if needed.
+// caller must hold the lock of the shard of the series (or be the only user, during replay)
+func state(series map[schema.MKey]*seriesState, key schema.MKey) *seriesState {
+	st, ok := series[key]
+	if !ok {
+		st = &seriesState{}
+		series[key] = st
+	}
+	return st
+}
+
+// pointState is like state, for series we have a point of, which tells us the schema
+func pointState(series map[schema.MKey]*seriesState, key schema.MKey, schemaId uint16) *seriesState {
+	st := state(series, key)
+	if st.chunkSpan == 0 {
+		ret := mdata.Schemas.Get(schemaId).Retentions.Rets[0]
+		st.chunkSpan = ret.ChunkSpan
+		st.numChunks = ret.NumChunks
+	}
+	return st
+}
+
+// open starts a new segment with the given id
+// caller must hold the lock
+func (s *shard) open(id int) error {
+	seg := newSegment(s.dir, id)
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	s.cur = seg
+	s.f = f
+	s.w = bufio.NewWriterSize(f, 64*1024)
+	s.size = 0
+	return nil
+}
+
+// rotate closes the current segment and starts a new one
+// caller must hold the lock
+func (s *shard) rotate() {
+	if err := s.closeCurrent(); err != nil {
+		writeErrors.Inc()
+		log.Errorf("wal: failed to close segment %s: %s", s.cur.path, err.Error())
+	}
+	s.segments = append(s.segments, s.cur)
+	if err := s.open(s.cur.id + 1); err != nil {
+		// keep appending to the previous file, which is better than losing the data
+		writeErrors.Inc()
+		log.Errorf("wal: failed to start a new segment: %s", err.Error())
+		s.segments = s.segments[:len(s.segments)-1]
+		return
+	}
+	numSegments.Inc()
+}
+
+// closeCurrent flushes, syncs and closes the current segment
+// caller must hold the lock
+func (s *shard) closeCurrent() error {
+	err := s.w.Flush()
+	if syncErr := s.f.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := s.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// write appends a record to the current segment
+// caller must hold the lock
+func (s *shard) write(rec record) {
+	s.buf = rec.encode(s.buf[:0])
+	n, err := s.w.Write(s.buf)
+	s.size += n
+	if err != nil {
+		writeErrors.Inc()
+	}
+}
+
+// Append appends a point to the log. Must be called before the point is added to its AggMetric.
+// Only the shard of the series is locked, so points of series of different shards can be appended concurrently.
+func (w *WAL) Append(key schema.MKey, schemaId, aggId uint16, interval, ts uint32, val float64) {
+	s := w.shard(key)
+	s.Lock()
+	st := pointState(s.series, key, schemaId)
+	maxTs, ok := s.cur.series[key]
+	if !ok && st.savedUntil > 0 {
+		// every segment with points of a series also records until when it was saved,
+		// such that already saved points can be skipped when replaying, even if the segment
+		// with the original saved record has been removed.
+		s.write(record{typ: recordSaved, key: key, ts: st.savedUntil})
+	}
+	if !ok || ts > maxTs {
+		s.cur.series[key] = ts
+	}
+	if ts > st.lastTs {
+		st.lastTs = ts
+	}
+	s.write(record{typ: recordPoint, key: key, schemaId: schemaId, aggId: aggId, interval: interval, ts: ts, val: val})
+	if s.size >= segmentSize {
+		s.rotate()
+	}
+	s.Unlock()
+}
+
+// Send is called when a chunk has been saved, by us or (via the cluster notifier) by another node.
+// It implements mdata.Notifier
+func (w *WAL) Send(sc mdata.SavedChunk) {
+	amkey, err := schema.AMKeyFromString(sc.Key)
+	if err != nil {
+		log.Errorf("wal: failed to parse key %q of saved chunk: %s", sc.Key, err.Error())
+		return
+	}
+	// the data of rollup archives is generated from the raw data
+	if amkey.Archive != 0 {
+		return
+	}
+	s := w.shard(amkey.MKey)
+	s.Lock()
+	defer s.Unlock()
+	st, ok := s.series[amkey.MKey]
+	if !ok {
+		return
+	}
+	if until := sc.T0 + st.chunkSpan; until > st.savedUntil {
+		st.savedUntil = until
+		s.write(record{typ: recordSaved, key: amkey.MKey, ts: until})
+	}
+}
+
+// Start periodically syncs the log to disk and removes segments that are no longer needed
+func (w *WAL) Start() {
+	w.wg.Add(1)
+	go w.run()
+}
+
+func (w *WAL) run() {
+	defer w.wg.Done()
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+	truncateTicker := time.NewTicker(truncateInterval)
+	defer truncateTicker.Stop()
+	for {
+		select {
+		case <-w.shutdown:
+			return
+		case <-syncTicker.C:
+			w.sync()
+		case <-truncateTicker.C:
+			w.truncate()
+		}
+	}
+}
+
+// sync writes the buffered records to the current segments and syncs them to disk
+func (w *WAL) sync() {
+	for _, s := range w.shards {
+		s.Lock()
+		err := s.w.Flush()
+		f := s.f
+		s.Unlock()
+		if err == nil {
+			// a concurrent rotate may have closed f, in which case it already synced it
+			if err = f.Sync(); errors.Is(err, os.ErrClosed) {
+				err = nil
+			}
+		}
+		if err != nil {
+			writeErrors.Inc()
+			log.Errorf("wal: failed to sync: %s", err.Error())
+		}
+	}
+}
+
+// seriesState returns a copy of the state of the given series
+func (w *WAL) seriesState(key schema.MKey) (seriesState, bool) {
+	s := w.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	st, ok := s.series[key]
+	if !ok {
+		return seriesState{}, false
+	}
+	return *st, true
+}
+
+// removable returns whether none of the points in the segment need to be replayed anymore:
+// they have all been saved, or, on nodes that don't save chunks, they have all been evicted
+// from memory. the latter keeps the log bounded on secondaries that don't learn about saves.
+func (w *WAL) removable(seg *segment, primary bool) bool {
+	for key, maxTs := range seg.series {
+		st, ok := w.seriesState(key)
+		if !ok {
+			return false
+		}
+		if maxTs < st.savedUntil {
+			continue
+		}
+		if !primary && maxTs < st.inMemoryFrom() {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// split splits the given closed segments into the ones to keep and the ones to remove
+func (w *WAL) split(segments []*segment, primary bool) (keep, remove []*segment) {
+	for _, seg := range segments {
+		if w.removable(seg, primary) {
+			remove = append(remove, seg)
+		} else {
+			keep = append(keep, seg)
+		}
+	}
+	return keep, remove
+}
+
+// truncate removes the segments of which no points need to be replayed anymore,
+// and forgets about the series that no longer have points in any segment.
+// closed segments don't change, so they can be checked without holding the lock of their shard.
+func (w *WAL) truncate() {
+	primary := cluster.Manager.IsPrimary()
+
+	w.Lock()
+	keep, remove := w.split(w.replayed, primary)
+	w.replayed = keep
+	replayed := w.replayed
+	w.Unlock()
+
+	for _, s := range w.shards {
+		s.Lock()
+		segments := s.segments
+		s.Unlock()
+		keep, rm := w.split(segments, primary)
+		remove = append(remove, rm...)
+
+		s.Lock()
+		// segments closed in the meantime come after the ones we checked
+		s.segments = append(keep, s.segments[len(segments):]...)
+		if len(remove) > 0 {
+			for key := range s.series {
+				if !s.hasPoints(key) && !hasPoints(replayed, key) {
+					delete(s.series, key)
+				}
+			}
+		}
+		s.Unlock()
+	}
+	w.updateNumSegments()
+
+	for _, seg := range remove {
+		if err := os.Remove(seg.path); err != nil {
+			log.Errorf("wal: failed to remove segment %s: %s", seg.path, err.Error())
+			continue
+		}
+		log.Debugf("wal: removed segment %s", seg.path)
+	}
+}
+
+// hasPoints returns whether any segment of the shard has points of the given series
+// caller must hold the lock
+func (s *shard) hasPoints(key schema.MKey) bool {
+	if _, ok := s.cur.series[key]; ok {
+		return true
+	}
+	return hasPoints(s.segments, key)
+}
+
+// hasPoints returns whether any of the given segments has points of the given series
+func hasPoints(segments []*segment, key schema.MKey) bool {
+	for _, seg := range segments {
+		if _, ok := seg.series[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *WAL) updateNumSegments() {
+	w.Lock()
+	n := len(w.replayed)
+	w.Unlock()
+	for _, s := range w.shards {
+		s.Lock()
+		n += len(s.segments) + 1
+		s.Unlock()
+	}
+	numSegments.SetUint32(uint32(n))
+}
+
+// Stop stops the background work and closes the log.
+// inputs should be stopped before calling Stop.
+func (w *WAL) Stop() {
+	close(w.shutdown)
+	w.wg.Wait()
+	for _, s := range w.shards {
+		s.Lock()
+		if err := s.closeCurrent(); err != nil {
+			log.Errorf("wal: failed to close segment %s: %s", s.cur.path, err.Error())
+		}
+		s.Unlock()
+	}
+}
@@ -0,0 +1,302 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/cluster"
+	"github.com/grafana/metrictank/conf"
+	"github.com/grafana/metrictank/consolidation"
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/schema"
+)
+
+type point struct {
+	ts  uint32
+	val float64
+}
+
+// mockMetrics records the points added to each series
+type mockMetrics map[schema.MKey][]point
+
+func (m mockMetrics) Get(key schema.MKey) (mdata.Metric, bool) {
+	return nil, false
+}
+
+func (m mockMetrics) GetOrCreate(key schema.MKey, schemaId, aggId uint16, interval uint32) mdata.Metric {
+	return mockMetric{m, key}
+}
+
+type mockMetric struct {
+	metrics mockMetrics
+	key     schema.MKey
+}
+
+func (m mockMetric) Add(ts uint32, val float64) {
+	m.metrics[m.key] = append(m.metrics[m.key], point{ts, val})
+}
+
+func (m mockMetric) Get(from, to uint32) (mdata.Result, error) {
+	return mdata.Result{}, nil
+}
+
+func (m mockMetric) GetAggregated(consolidator consolidation.Consolidator, aggSpan, from, to uint32) (mdata.Result, error) {
+	return mdata.Result{}, nil
+}
+
+func setup(t *testing.T) func() {
+	t.Helper()
+	tmp, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDir, oldSegmentSize, oldNumShards, oldSchemas := dir, segmentSize, numShards, mdata.Schemas
+	dir = tmp
+	segmentSize = 64 * 1024 * 1024
+	numShards = 1
+	mdata.SetSingleSchema(conf.MustParseRetentions("10s:1d:10min:2"))
+	cluster.Init("default", "test", time.Now(), "http", 6060)
+	cluster.Manager.SetPrimary(true)
+	return func() {
+		dir, segmentSize, numShards, mdata.Schemas = oldDir, oldSegmentSize, oldNumShards, oldSchemas
+		os.RemoveAll(tmp)
+	}
+}
+
+func testKey(i byte) schema.MKey {
+	return schema.MKey{Key: schema.Key{i}, Org: 1}
+}
+
+func TestRecordEncodeDecode(t *testing.T) {
+	records := []record{
+		{typ: recordPoint, key: testKey(1), schemaId: 2, aggId: 3, interval: 10, ts: 1600000000, val: 1.5},
+		{typ: recordSaved, key: testKey(2), ts: 1600000600},
+	}
+	var buf []byte
+	for _, rec := range records {
+		buf = rec.encode(buf)
+	}
+	if len(buf) != pointRecordSize+savedRecordSize {
+		t.Fatalf("expected %d bytes, got %d", pointRecordSize+savedRecordSize, len(buf))
+	}
+
+	b := make([]byte, pointRecordSize)
+	r := bufio.NewReader(bytes.NewReader(buf))
+	for i, exp := range records {
+		rec, err := readRecord(r, b)
+		if err != nil {
+			t.Fatalf("record %d: unexpected error %s", i, err)
+		}
+		if rec != exp {
+			t.Fatalf("record %d: expected %+v, got %+v", i, exp, rec)
+		}
+	}
+	if _, err := readRecord(r, b); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	// an incomplete record, as left by a crash while writing
+	r = bufio.NewReader(bytes.NewReader(buf[:pointRecordSize-1]))
+	if _, err := readRecord(r, b); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF, got %v", err)
+	}
+
+	// a corrupt record
+	corrupt := append([]byte(nil), buf...)
+	corrupt[10]++
+	r = bufio.NewReader(bytes.NewReader(corrupt))
+	if _, err := readRecord(r, b); err != errCorrupt {
+		t.Fatalf("expected errCorrupt, got %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	defer setup(t)()
+
+	w, err := New(mockMetrics{})
+	if err != nil {
+		t.Fatalf("failed to create WAL: %s", err)
+	}
+	a, b := testKey(1), testKey(2)
+	for ts := uint32(0); ts < 1200; ts += 300 {
+		w.Append(a, 0, 0, 10, ts, float64(ts))
+		w.Append(b, 0, 0, 10, ts, float64(ts))
+	}
+	// the first chunk of a got saved: its points don't need to be replayed
+	w.Send(mdata.SavedChunk{Key: schema.AMKey{MKey: a}.String(), T0: 0})
+	// saves of rollup archives don't matter
+	w.Send(mdata.SavedChunk{Key: schema.AMKey{MKey: b, Archive: schema.NewArchive(schema.Sum, 600)}.String(), T0: 0})
+	w.Stop()
+
+	metrics := mockMetrics{}
+	w, err = New(metrics)
+	if err != nil {
+		t.Fatalf("failed to replay WAL: %s", err)
+	}
+	defer w.Stop()
+	exp := mockMetrics{
+		a: {{600, 600}, {900, 900}},
+		b: {{0, 0}, {300, 300}, {600, 600}, {900, 900}},
+	}
+	if !reflect.DeepEqual(metrics, exp) {
+		t.Fatalf("expected replayed points %v, got %v", exp, metrics)
+	}
+	if w.shards[0].series[a].savedUntil != 600 || w.shards[0].series[b].savedUntil != 0 {
+		t.Fatalf("unexpected saved state after replay: a %d, b %d", w.shards[0].series[a].savedUntil, w.shards[0].series[b].savedUntil)
+	}
+}
+
+func TestReplayIncompleteSegment(t *testing.T) {
+	defer setup(t)()
+
+	w, err := New(mockMetrics{})
+	if err != nil {
+		t.Fatalf("failed to create WAL: %s", err)
+	}
+	a := testKey(1)
+	w.Append(a, 0, 0, 10, 10, 1)
+	w.Append(a, 0, 0, 10, 20, 2)
+	w.Stop()
+
+	// simulate a crash while writing the last record
+	path := filepath.Join(dir, "0", "00000001.wal")
+	if err := os.Truncate(path, pointRecordSize+10); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := mockMetrics{}
+	w, err = New(metrics)
+	if err != nil {
+		t.Fatalf("failed to replay WAL: %s", err)
+	}
+	defer w.Stop()
+	exp := mockMetrics{a: {{10, 1}}}
+	if !reflect.DeepEqual(metrics, exp) {
+		t.Fatalf("expected replayed points %v, got %v", exp, metrics)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	defer setup(t)()
+	// every point starts a new segment
+	segmentSize = 1
+
+	w, err := New(mockMetrics{})
+	if err != nil {
+		t.Fatalf("failed to create WAL: %s", err)
+	}
+	defer w.Stop()
+	a, b := testKey(1), testKey(2)
+	w.Append(a, 0, 0, 10, 0, 1)   // segment 1
+	w.Append(b, 0, 0, 10, 0, 1)   // segment 2
+	w.Append(a, 0, 0, 10, 600, 2) // segment 3
+	if len(w.shards[0].segments) != 3 {
+		t.Fatalf("expected 3 closed segments, got %d", len(w.shards[0].segments))
+	}
+
+	w.Send(mdata.SavedChunk{Key: schema.AMKey{MKey: a}.String(), T0: 0})
+	w.truncate()
+	ids, err := segmentIds(filepath.Join(dir, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// segment 1 is saved, segment 4 is the current one
+	if !reflect.DeepEqual(ids, []int{2, 3, 4}) {
+		t.Fatalf("expected segments 2, 3 and 4 to remain, got %v", ids)
+	}
+
+	w.Send(mdata.SavedChunk{Key: schema.AMKey{MKey: a}.String(), T0: 600})
+	w.Send(mdata.SavedChunk{Key: schema.AMKey{MKey: b}.String(), T0: 0})
+	w.truncate()
+	ids, err = segmentIds(filepath.Join(dir, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int{4}) {
+		t.Fatalf("expected only the current segment to remain, got %v", ids)
+	}
+}
+
+func TestTruncateSecondary(t *testing.T) {
+	defer setup(t)()
+	cluster.Manager.SetPrimary(false)
+	defer cluster.Manager.SetPrimary(true)
+	// every point starts a new segment
+	segmentSize = 1
+
+	w, err := New(mockMetrics{})
+	if err != nil {
+		t.Fatalf("failed to create WAL: %s", err)
+	}
+	defer w.Stop()
+	a := testKey(1)
+	w.Append(a, 0, 0, 10, 0, 1)    // segment 1, chunk 0
+	w.Append(a, 0, 0, 10, 600, 2)  // segment 2, chunk 600
+	w.Append(a, 0, 0, 10, 1200, 3) // segment 3, chunk 1200
+
+	// we never learn about saves, but with 2 chunks in memory, chunk 0 has been evicted
+	w.truncate()
+	ids, err := segmentIds(filepath.Join(dir, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int{2, 3, 4}) {
+		t.Fatalf("expected segments 2, 3 and 4 to remain, got %v", ids)
+	}
+}
+
+func TestShards(t *testing.T) {
+	defer setup(t)()
+	numShards = 4
+
+	w, err := New(mockMetrics{})
+	if err != nil {
+		t.Fatalf("failed to create WAL: %s", err)
+	}
+	var wg sync.WaitGroup
+	exp := mockMetrics{}
+	for i := byte(0); i < 16; i++ {
+		key := testKey(i)
+		for ts := uint32(0); ts < 100; ts += 10 {
+			exp[key] = append(exp[key], point{ts, float64(ts)})
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ts := uint32(0); ts < 100; ts += 10 {
+				w.Append(key, 0, 0, 10, ts, float64(ts))
+			}
+		}()
+	}
+	wg.Wait()
+	w.Stop()
+
+	// a different number of shards replays the points of the previous ones
+	numShards = 3
+	metrics := mockMetrics{}
+	w, err = New(metrics)
+	if err != nil {
+		t.Fatalf("failed to replay WAL: %s", err)
+	}
+	defer w.Stop()
+	if !reflect.DeepEqual(metrics, exp) {
+		t.Fatalf("expected replayed points %v, got %v", exp, metrics)
+	}
+
+	// once saved, the replayed segments are removed
+	for key := range exp {
+		w.Send(mdata.SavedChunk{Key: schema.AMKey{MKey: key}.String(), T0: 0})
+	}
+	w.truncate()
+	if len(w.replayed) != 0 {
+		t.Fatalf("expected all replayed segments to be removed, got %d", len(w.replayed))
+	}
+}
@@ -74,7 +74,7 @@ func init() {
 	flag.StringVar(&discardPrefixesStr, "discard-prefixes", "", "discard data points starting with one of the given prefixes separated by | (may be given multiple times, once per topic specified in 'metrics-topic', as a comma-separated list)")
 	flag.StringVar(&codec, "metrics-kafka-comp", "snappy", "compression: none|gzip|snappy")
 	flag.BoolVar(&enabled, "metrics-publish", false, "enable metric publishing")
-	flag.StringVar(&partitionSchemesStr, "metrics-partition-scheme", "bySeries", "method used for partitioning metrics. (byOrg|bySeries|bySeriesWithTags|bySeriesWithTagsFnv) (may be given multiple times, once per topic, as a comma-separated list)")
+	flag.StringVar(&partitionSchemesStr, "metrics-partition-scheme", "bySeries", "method used for partitioning metrics. (byOrg|bySeries|bySeriesWithTags|bySeriesWithTagsFnv|bySeriesConsistent) (may be given multiple times, once per topic, as a comma-separated list)")
 	flag.DurationVar(&flushFreq, "metrics-flush-freq", time.Millisecond*50, "The best-effort frequency of flushes to kafka")
 	flag.IntVar(&maxMessages, "metrics-max-messages", 5000, "The maximum number of messages the producer will send in a single request")
 	flag.StringVar(&schemasConf, "schemas-file", "/etc/metrictank/storage-schemas.conf", "path to carbon storage-schemas.conf file")
@@ -406,6 +406,13 @@ func (m *mtPublisher) Publish(metrics []*schema.MetricData) error {
 	return nil
 }
 
+// GetInterval returns the interval of the series with the given name (including tags),
+// which is the raw interval of the matching schema. requires the publisher to be created with autoInterval.
+func (m *mtPublisher) GetInterval(name string) int {
+	_, schema := m.schemas.Match(name, 0)
+	return schema.Retentions.Rets[0].SecondsPerPoint
+}
+
 func (*mtPublisher) Type() string {
 	return "Metrictank"
 }
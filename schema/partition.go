@@ -27,6 +27,12 @@ const (
 	// compatible with PartitionBySeries if a metric has no tags,
 	// making it possible to adopt tags for existing PartitionBySeries deployments without a migration.
 	PartitionBySeriesWithTagsFnv
+
+	// partition by the metric name only, using jump consistent hashing.
+	// when the number of partitions grows from n to m, only (m-n)/m of the series move to another partition,
+	// whereas with PartitionBySeries nearly all of them do.
+	// (PartitionBySeriesWithTags also uses jump consistent hashing, on the name and tags)
+	PartitionBySeriesConsistent
 )
 
 func PartitonMethodFromString(input string) (PartitionByMethod, error) {
@@ -39,8 +45,10 @@ func PartitonMethodFromString(input string) (PartitionByMethod, error) {
 		return PartitionBySeriesWithTags, nil
 	case "bySeriesWithTagsFnv":
 		return PartitionBySeriesWithTagsFnv, nil
+	case "bySeriesConsistent":
+		return PartitionBySeriesConsistent, nil
 	}
-	return 0, fmt.Errorf("partitionBy must be one of 'byOrg|bySeries|bySeriesWithTags|bySeriesWithTagsFnv'. got %s", input)
+	return 0, fmt.Errorf("partitionBy must be one of 'byOrg|bySeries|bySeriesWithTags|bySeriesWithTagsFnv|bySeriesConsistent'. got %s", input)
 }
 
 func (m *MetricData) PartitionID(method PartitionByMethod, partitions int32) (int32, error) {
@@ -79,6 +87,10 @@ func (m *MetricData) PartitionID(method PartitionByMethod, partitions int32) (in
 		if partition < 0 {
 			partition = -partition
 		}
+	case PartitionBySeriesConsistent:
+		h := xxhash.New()
+		h.WriteString(m.Name)
+		partition = jump.Hash(h.Sum64(), int(partitions))
 	default:
 		return 0, ErrUnknownPartitionMethod
 	}
@@ -124,6 +136,10 @@ func (m *MetricDefinition) PartitionID(method PartitionByMethod, partitions int3
 		if partition < 0 {
 			partition = -partition
 		}
+	case PartitionBySeriesConsistent:
+		h := xxhash.New()
+		h.WriteString(m.Name)
+		partition = jump.Hash(h.Sum64(), int(partitions))
 	default:
 		return 0, ErrUnknownPartitionMethod
 	}
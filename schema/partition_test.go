@@ -255,6 +255,90 @@ func testPartitionWithSeriesWithTagsFnv(t *testing.T, byDef bool) {
 	}
 }
 
+func TestPartitionWithSeriesConsistentDefs(t *testing.T) {
+	testPartitionWithSeriesConsistent(t, true)
+}
+
+func TestPartitionWithSeriesConsistentData(t *testing.T) {
+	testPartitionWithSeriesConsistent(t, false)
+}
+
+func testPartitionWithSeriesConsistent(t *testing.T, byDef bool) {
+	var p int32
+	var err error
+	partitionCount := int32(32)
+	metricCount := 5000
+	series := getMetricData(1, 2, metricCount, 10, "metric.org1", true)
+
+	partitions := make(map[int32]int)
+	for _, md := range series {
+		if byDef {
+			def := MetricDefinitionFromMetricData(md)
+			p, err = def.PartitionID(PartitionBySeriesConsistent, partitionCount)
+		} else {
+			p, err = md.PartitionID(PartitionBySeriesConsistent, partitionCount)
+		}
+		if err != nil {
+			t.Fatalf("failed to get partition on %s with orgId=%d, using MetricDefinitions=%v", md.Id, md.OrgId, byDef)
+		}
+		if p < 0 || p >= partitionCount {
+			t.Fatalf("partition expected to be in [0, %d), p=%d, using MetricDefinitions=%v", partitionCount, p, byDef)
+		}
+
+		// the tags don't matter
+		untagged := *md
+		untagged.Tags = nil
+		pUntagged, err := untagged.PartitionID(PartitionBySeriesConsistent, partitionCount)
+		if err != nil {
+			t.Fatalf("failed to get partition on %s with orgId=%d, using MetricDefinitions=%v", md.Id, md.OrgId, byDef)
+		}
+		if p != pUntagged {
+			t.Fatalf("series %s with tags (%d) and without (%d) should yield the same partition ID", md.Name, p, pUntagged)
+		}
+
+		partitions[p] = partitions[p] + 1
+	}
+	if int32(len(partitions)) < partitionCount {
+		t.Fatalf("with %d series only %d/%d partitions seen", metricCount, len(partitions), partitionCount)
+	}
+}
+
+// TestPartitionGrowth checks how many series move to another partition when growing from 8 to 12 partitions
+func TestPartitionGrowth(t *testing.T) {
+	metricCount := 5000
+	series := getMetricData(1, 2, metricCount, 10, "metric.org1", false)
+
+	moved := func(method PartitionByMethod) float64 {
+		n := 0
+		for _, md := range series {
+			from, err := md.PartitionID(method, 8)
+			if err != nil {
+				t.Fatalf("failed to get partition of %s: %s", md.Id, err)
+			}
+			to, err := md.PartitionID(method, 12)
+			if err != nil {
+				t.Fatalf("failed to get partition of %s: %s", md.Id, err)
+			}
+			if from != to {
+				if method == PartitionBySeriesConsistent && to < 8 {
+					t.Fatalf("series %s moved from partition %d to %d, which already existed", md.Name, from, to)
+				}
+				n++
+			}
+		}
+		return float64(n) / float64(metricCount)
+	}
+
+	// ideally, only the series of the 4 new partitions move. with bySeries, 2/3 of the series move.
+	consistent := moved(PartitionBySeriesConsistent)
+	if consistent < 0.28 || consistent > 0.38 {
+		t.Fatalf("expected about 33%% of the series to move with bySeriesConsistent, got %.1f%%", consistent*100)
+	}
+	if bySeries := moved(PartitionBySeries); bySeries <= consistent {
+		t.Fatalf("expected more series to move with bySeries (%.1f%%) than with bySeriesConsistent (%.1f%%)", bySeries*100, consistent*100)
+	}
+}
+
 func benchPartitioning(method PartitionByMethod, b *testing.B) {
 	partitionCount := int32(32)
 	metricCount := 5000
@@ -287,3 +371,7 @@ func BenchmarkPartitionBySeriesWithTags(b *testing.B) {
 func BenchmarkPartitionBySeriesWithTagsFnv(b *testing.B) {
 	benchPartitioning(PartitionBySeriesWithTagsFnv, b)
 }
+
+func BenchmarkPartitionBySeriesConsistent(b *testing.B) {
+	benchPartitioning(PartitionBySeriesConsistent, b)
+}
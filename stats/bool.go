@@ -50,3 +50,7 @@ func (b *Bool) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
 	buf = WriteUint32(buf, prefix, b.name, []byte(".gauge1"), b.tags, val, now)
 	return buf
 }
+
+func (b *Bool) WritePrometheus(pb *promBuilder) {
+	pb.gauge(b.name, b.tags, "", float64(atomic.LoadUint32(&b.val)))
+}
@@ -2,11 +2,14 @@ package config
 
 import (
 	"flag"
+	"math"
 	"strings"
 	"time"
 
 	"github.com/grafana/globalconf"
+	"github.com/grafana/metrictank/conf"
 	"github.com/grafana/metrictank/stats"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -16,6 +19,15 @@ var addr string
 var interval int
 var bufferSize int
 var timeout time.Duration
+var prometheusEnabled bool
+
+// LocalEnabled, LocalOrg and LocalRetentions are set by ConfigProcess
+var LocalEnabled bool
+var LocalOrg uint32
+var LocalRetentions conf.Retentions
+var localOrg int
+var localRetentions string
+var localOut *stats.Local
 
 func ConfigSetup() {
 	inStats := flag.NewFlagSet("stats", flag.ExitOnError)
@@ -25,28 +37,58 @@ func ConfigSetup() {
 	inStats.IntVar(&interval, "interval", 1, "interval at which to send statistics")
 	inStats.DurationVar(&timeout, "timeout", time.Second*10, "timeout after which a write is considered not successful")
 	inStats.IntVar(&bufferSize, "buffer-size", 20000, "how many messages (holding all measurements from one interval. rule of thumb: a message is ~25kB) to buffer up in case graphite endpoint is unavailable. With the default of 20k you will use max about 500MB and bridge 5 hours of downtime when needed")
+	inStats.BoolVar(&LocalEnabled, "local", false, "instead of sending the stats to addr, ingest them into this metrictank instance, under local-org. requires enabled")
+	inStats.IntVar(&localOrg, "local-org", 2147483647, "org id under which the stats are ingested when local is set. it is reserved for the stats: it must not be used by anyone else")
+	inStats.StringVar(&localRetentions, "local-retentions", "1s:1d:10min:2,1min:30d:6h:2", "retentions of the stats ingested when local is set, in the storage-schemas.conf format. the raw interval must match interval")
+	inStats.BoolVar(&prometheusEnabled, "prometheus", true, "expose the stats in prometheus format on the /prometheus/metrics endpoint, prefixed with metrictank_ (works regardless of the enabled setting)")
 	globalconf.Register("stats", inStats, flag.ExitOnError)
 }
 
 func ConfigProcess(instance string) {
 	if !enabled {
+		LocalEnabled = false
 		return
 	}
 	// TODO validate tcp addr
 	prefix = strings.Replace(prefix, "$instance", instance, -1)
+
+	if !LocalEnabled {
+		return
+	}
+	if localOrg < 1 || localOrg > math.MaxInt32 {
+		log.Fatalf("stats: local-org must be between 1 and %d", math.MaxInt32)
+	}
+	LocalOrg = uint32(localOrg)
+	var err error
+	LocalRetentions, err = conf.ParseRetentions(localRetentions)
+	if err != nil {
+		log.Fatalf("stats: could not parse local-retentions %q: %s", localRetentions, err)
+	}
+	if LocalRetentions.Rets[0].SecondsPerPoint != interval {
+		log.Fatalf("stats: the raw interval of local-retentions must match interval (%ds)", interval)
+	}
 }
 
 func Start() {
-	if enabled {
+	if enabled || prometheusEnabled {
 		stats.NewMemoryReporter()
 
 		_, err := stats.NewProcessReporter()
 		if err != nil {
 			log.Fatalf("stats: could not initialize process reporter: %v", err)
 		}
+	}
+	if enabled && LocalEnabled {
+		localOut = stats.NewLocal(prefix, interval, bufferSize)
+	} else if enabled {
 		stats.NewGraphite(prefix, addr, interval, bufferSize, timeout)
 	} else {
 		stats.NewDevnull()
+	}
+	if prometheusEnabled {
+		prometheus.MustRegister(stats.NewPrometheusCollector("metrictank"))
+	}
+	if !enabled && !prometheusEnabled {
 		log.Warn("running metrictank without instrumentation.")
 	}
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/grafana/metrictank/input"
+	"github.com/grafana/metrictank/schema"
+	"github.com/grafana/metrictank/stats"
+	"github.com/metrics20/go-metrics20/carbon20"
+	log "github.com/sirupsen/logrus"
+)
+
+// metric stats.local.decode_err is how many of the stats could not be ingested into the local metrictank because they failed to parse
+var localDecodeErr = stats.NewCounter32("stats.local.decode_err")
+
+// StartLocal starts ingesting the stats into the local metrictank, under LocalOrg and the given partition.
+// The stats reported since Start are buffered until then.
+func StartLocal(handler input.Handler, partition int32) {
+	log.Infof("stats: ingesting the stats under org %d", LocalOrg)
+	go localOut.Run(func(line []byte) {
+		md, err := parseLocal(line)
+		if err != nil {
+			localDecodeErr.Inc()
+			log.Errorf("stats: invalid local metric: %s", err.Error())
+			return
+		}
+		handler.ProcessMetricData(md, partition)
+	})
+}
+
+// parseLocal parses a metric in the graphite line format, as reported by stats.Local
+func parseLocal(line []byte) (*schema.MetricData, error) {
+	key, val, ts, err := carbon20.ValidatePacket(line, carbon20.MediumLegacy, carbon20.NoneM20)
+	if err != nil {
+		return nil, err
+	}
+	nameSplits := strings.Split(string(key), ";")
+	md := &schema.MetricData{
+		Name:     nameSplits[0],
+		Interval: interval,
+		Value:    val,
+		Unit:     "unknown",
+		Time:     int64(ts),
+		Mtype:    "gauge",
+		Tags:     nameSplits[1:],
+		OrgId:    int(LocalOrg),
+	}
+	md.SetId()
+	return md, nil
+}
@@ -47,3 +47,7 @@ func (c *Counter32) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte
 	buf = WriteUint32(buf, prefix, c.name, []byte(".counter32"), c.tags, val, now)
 	return buf
 }
+
+func (c *Counter32) WritePrometheus(b *promBuilder) {
+	b.counter(c.name, c.tags, "", float64(atomic.LoadUint32(&c.val)))
+}
@@ -39,3 +39,7 @@ func (c *Counter64) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte
 	buf = WriteUint64(buf, prefix, c.name, []byte(".counter64"), c.tags, val, now)
 	return buf
 }
+
+func (c *Counter64) WritePrometheus(b *promBuilder) {
+	b.counter(c.name, c.tags, "", float64(atomic.LoadUint64(&c.val)))
+}
@@ -55,3 +55,8 @@ func (c *CounterRate32) WriteGraphiteLine(buf, prefix []byte, now time.Time) []b
 	c.since = now
 	return buf
 }
+
+func (c *CounterRate32) WritePrometheus(b *promBuilder) {
+	// prometheus computes rates itself
+	b.counter(c.name, c.tags, "", float64(atomic.LoadUint32(&c.val)))
+}
@@ -63,3 +63,7 @@ func (g *Gauge32) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
 	buf = WriteUint32(buf, prefix, g.name, []byte(".gauge32"), g.tags, val, now)
 	return buf
 }
+
+func (g *Gauge32) WritePrometheus(b *promBuilder) {
+	b.gauge(g.name, g.tags, "", float64(atomic.LoadUint32(&g.val)))
+}
@@ -67,3 +67,7 @@ func (g *Gauge64) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
 func (g *Gauge64) Peek() uint64 {
 	return atomic.LoadUint64(&g.val)
 }
+
+func (g *Gauge64) WritePrometheus(b *promBuilder) {
+	b.gauge(g.name, g.tags, "", float64(atomic.LoadUint64(&g.val)))
+}
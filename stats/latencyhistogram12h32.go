@@ -1,17 +1,36 @@
 package stats
 
 import (
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Dieterbe/artisanalhistogram/hist12h"
 )
 
+// upper bounds in seconds of the buckets of hist12h.Hist12h, except the last one which is unbounded.
+// hist12h defines the 15min bound as 9000000ms, as a result of which its binary search puts everything
+// up to 45min in that bucket, and the 20min, 30min and 45min buckets are never used.
+var hist12hBounds = []float64{
+	0.5, 1, 2, 3, 5, 7.5, 10, 15, 20, 30, 45, 60, 90, 120, 180, 240, 300, 450, 600, 750,
+	2700, 2700, 2700, 2700, 3600, 7200, 10800, 16200, 21600, 32400, 43200, math.Inf(1),
+}
+
 // tracks latency measurements in a given range as 32 bit counters
 type LatencyHistogram12h32 struct {
 	hist  hist12h.Hist12h
 	since time.Time
+	sum   uint64 // in millis. only used for prometheus
 	name  []byte
 	tags  []byte
+
+	// both graphite and prometheus take the measurements out of hist, so the
+	// measurements taken by one must be kept for the other
+	sync.Mutex
+	pending  [32]uint32 // counts not yet reported to graphite
+	total    [32]uint64 // counts since creation, for prometheus
+	totalSum uint64
 }
 
 func NewLatencyHistogram12h32(name string) *LatencyHistogram12h32 {
@@ -29,11 +48,29 @@ func NewLatencyHistogram12h32WithTags(name, tags string) *LatencyHistogram12h32
 }
 
 func (l *LatencyHistogram12h32) Value(t time.Duration) {
+	atomic.AddUint64(&l.sum, uint64(t.Nanoseconds()/1e6))
 	l.hist.AddDuration(t)
 }
 
-func (l *LatencyHistogram12h32) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
+// collect moves the measurements from hist to pending and total.
+// the lock must be held.
+func (l *LatencyHistogram12h32) collect() {
 	snap := l.hist.Snapshot()
+	for i, count := range snap {
+		l.pending[i] += count
+		l.total[i] += uint64(count)
+	}
+	l.totalSum += atomic.SwapUint64(&l.sum, 0)
+}
+
+func (l *LatencyHistogram12h32) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
+	l.Lock()
+	l.collect()
+	snap := make([]uint32, len(l.pending))
+	copy(snap, l.pending[:])
+	l.pending = [32]uint32{}
+	l.Unlock()
+
 	// TODO: once we can actually do cool stuff (e.g. visualize) histogram bucket data, report it
 	// for now, only report the summaries :(
 	r, ok := l.hist.Report(snap)
@@ -50,3 +87,14 @@ func (l *LatencyHistogram12h32) WriteGraphiteLine(buf, prefix []byte, now time.T
 	l.since = now
 	return buf
 }
+
+func (l *LatencyHistogram12h32) WritePrometheus(b *promBuilder) {
+	l.Lock()
+	l.collect()
+	total := l.total
+	sum := l.totalSum
+	l.Unlock()
+
+	count, buckets := cumulativeBuckets(total[:], hist12hBounds)
+	b.histogram(l.name, l.tags, "_latency_seconds", count, float64(sum)/1e3, buckets)
+}
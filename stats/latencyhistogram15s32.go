@@ -1,12 +1,20 @@
 package stats
 
 import (
+	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/Dieterbe/artisanalhistogram/hist15s"
 )
 
+// upper bounds in seconds of the buckets of hist15s.Hist15s, except the last one which is unbounded
+var hist15sBounds = []float64{
+	0.001, 0.002, 0.003, 0.005, 0.0075, 0.01, 0.015, 0.02, 0.03, 0.04, 0.05, 0.065, 0.08, 0.1, 0.15, 0.2,
+	0.3, 0.4, 0.5, 0.65, 0.8, 1, 1.5, 2, 3, 4, 5, 6.5, 8, 10, 15, math.Inf(1),
+}
+
 // tracks latency measurements in a given range as 32 bit counters
 type LatencyHistogram15s32 struct {
 	hist  hist15s.Hist15s
@@ -14,6 +22,14 @@ type LatencyHistogram15s32 struct {
 	sum   uint64 // in micros. to generate more accurate mean
 	name  []byte
 	tags  []byte
+
+	// both graphite and prometheus take the measurements out of hist, so the
+	// measurements taken by one must be kept for the other
+	sync.Mutex
+	pending    [32]uint32 // counts not yet reported to graphite
+	pendingSum uint64
+	total      [32]uint64 // counts since creation, for prometheus
+	totalSum   uint64
 }
 
 func NewLatencyHistogram15s32(name string) *LatencyHistogram15s32 {
@@ -35,13 +51,33 @@ func (l *LatencyHistogram15s32) Value(t time.Duration) {
 	l.hist.AddDuration(t)
 }
 
-func (l *LatencyHistogram15s32) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
+// collect moves the measurements from hist to pending and total.
+// the lock must be held.
+func (l *LatencyHistogram15s32) collect() {
 	snap := l.hist.Snapshot()
+	sum := atomic.SwapUint64(&l.sum, 0)
+	for i, count := range snap {
+		l.pending[i] += count
+		l.total[i] += uint64(count)
+	}
+	l.pendingSum += sum
+	l.totalSum += sum
+}
+
+func (l *LatencyHistogram15s32) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
+	l.Lock()
+	l.collect()
+	snap := make([]uint32, len(l.pending))
+	copy(snap, l.pending[:])
+	sum := l.pendingSum
+	l.pending = [32]uint32{}
+	l.pendingSum = 0
+	l.Unlock()
+
 	// TODO: once we can actually do cool stuff (e.g. visualize) histogram bucket data, report it
 	// for now, only report the summaries :(
 	r, ok := l.hist.Report(snap)
 	if ok {
-		sum := atomic.SwapUint64(&l.sum, 0)
 		buf = WriteUint32(buf, prefix, l.name, []byte(".latency.min.gauge32"), l.tags, r.Min/1000, now)
 		buf = WriteUint32(buf, prefix, l.name, []byte(".latency.mean.gauge32"), l.tags, uint32((sum / uint64(r.Count) / 1000)), now)
 		buf = WriteUint32(buf, prefix, l.name, []byte(".latency.median.gauge32"), l.tags, r.Median/1000, now)
@@ -55,3 +91,29 @@ func (l *LatencyHistogram15s32) WriteGraphiteLine(buf, prefix []byte, now time.T
 	l.since = now
 	return buf
 }
+
+func (l *LatencyHistogram15s32) WritePrometheus(b *promBuilder) {
+	l.Lock()
+	l.collect()
+	total := l.total
+	sum := l.totalSum
+	l.Unlock()
+
+	count, buckets := cumulativeBuckets(total[:], hist15sBounds)
+	b.histogram(l.name, l.tags, "_latency_seconds", count, float64(sum)/1e6, buckets)
+}
+
+// cumulativeBuckets converts the counts of histogram buckets with the given upper bounds
+// to cumulative counts by upper bound, as used by prometheus. It also returns the total count.
+// the +Inf bucket is omitted, buckets with the same upper bound are merged.
+func cumulativeBuckets(counts []uint64, bounds []float64) (uint64, map[float64]uint64) {
+	buckets := make(map[float64]uint64, len(bounds))
+	var count uint64
+	for i, c := range counts {
+		count += c
+		if !math.IsInf(bounds[i], 1) {
+			buckets[bounds[i]] = count
+		}
+	}
+	return count, buckets
+}
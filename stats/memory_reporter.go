@@ -4,6 +4,7 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/grafana/metrictank/util"
@@ -15,6 +16,7 @@ type MemoryReporter struct {
 	mem                  runtime.MemStats
 	gcCyclesTotal        uint32
 	timeBoundGetMemStats func() interface{}
+	getMemStatsLock      sync.Mutex // timeBoundGetMemStats is not safe for concurrent use
 }
 
 func NewMemoryReporter() *MemoryReporter {
@@ -45,8 +47,14 @@ func getGcPercent() int {
 	return val
 }
 
+func (m *MemoryReporter) getMemStats() runtime.MemStats {
+	m.getMemStatsLock.Lock()
+	defer m.getMemStatsLock.Unlock()
+	return m.timeBoundGetMemStats().(runtime.MemStats)
+}
+
 func (m *MemoryReporter) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
-	m.mem = m.timeBoundGetMemStats().(runtime.MemStats)
+	m.mem = m.getMemStats()
 	gcPercent := getGcPercent()
 
 	// metric memory.total_bytes_allocated is a counter of total number of bytes allocated during process lifetime
@@ -82,3 +90,16 @@ func (m *MemoryReporter) WriteGraphiteLine(buf, prefix []byte, now time.Time) []
 
 	return buf
 }
+
+func (m *MemoryReporter) WritePrometheus(b *promBuilder) {
+	mem := m.getMemStats()
+	b.counter([]byte("memory.total_bytes_allocated"), nil, "", float64(mem.TotalAlloc))
+	b.gauge([]byte("memory.bytes.allocated_in_heap"), nil, "", float64(mem.Alloc))
+	b.gauge([]byte("memory.bytes.obtained_from_sys"), nil, "", float64(mem.Sys))
+	b.counter([]byte("memory.total_gc_cycles"), nil, "", float64(mem.NumGC))
+	b.gauge([]byte("memory.gc.cpu_fraction"), nil, "", mem.GCCPUFraction)
+	b.gauge([]byte("memory.gc.heap_objects"), nil, "", float64(mem.HeapObjects))
+	b.gauge([]byte("memory.gc.last_duration"), nil, "", float64(mem.PauseNs[(mem.NumGC+255)%256]))
+	b.gauge([]byte("memory.gc.gogc"), nil, "", float64(getGcPercent()))
+	b.gauge([]byte("runtime.goroutines.total"), nil, "", float64(runtime.NumGoroutine()))
+}
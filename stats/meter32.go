@@ -25,6 +25,10 @@ type Meter32 struct {
 	since time.Time
 	name  []byte
 	tags  []byte
+
+	// totals since creation, for prometheus
+	totalCount uint64
+	totalSum   uint64
 }
 
 func NewMeter32(name string, approx bool) *Meter32 {
@@ -76,6 +80,8 @@ func (m *Meter32) ValueUint32(val uint32) {
 	}
 	m.hist[bin]++
 	m.count += 1
+	m.totalCount++
+	m.totalSum += uint64(val)
 	m.Unlock()
 }
 
@@ -97,6 +103,8 @@ func (m *Meter32) ValuesUint32(val, num uint32) {
 	}
 	m.hist[bin] += num
 	m.count += num
+	m.totalCount += uint64(num)
+	m.totalSum += uint64(val) * uint64(num)
 	m.Unlock()
 }
 
@@ -148,3 +156,31 @@ func (m *Meter32) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
 
 	return buf
 }
+
+// WritePrometheus exposes a summary with the quantiles of the values seen since the last graphite report,
+// and the count and sum of all values seen
+func (m *Meter32) WritePrometheus(b *promBuilder) {
+	m.Lock()
+	keys := make([]int, 0, len(m.hist))
+	for k := range m.hist {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+
+	quantiles := []float64{0.50, 0.75, 0.90}
+	values := make(map[float64]float64, len(quantiles))
+	pidx := 0
+	runningcount := uint32(0)
+	for _, k := range keys {
+		runningcount += m.hist[uint32(k)]
+		p := float64(runningcount) / float64(m.count)
+		for pidx < len(quantiles) && quantiles[pidx] <= p {
+			values[quantiles[pidx]] = float64(k)
+			pidx++
+		}
+	}
+	count, sum := m.totalCount, m.totalSum
+	m.Unlock()
+
+	b.summary(m.name, m.tags, "", count, float64(sum), values)
+}
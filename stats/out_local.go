@@ -0,0 +1,92 @@
+package stats
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/grafana/metrictank/clock"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	localQueueItems *Range32
+	localDropped    *Counter32
+)
+
+// Local is a reporter that hands the metrics to a function in the same process, rather than sending them
+// to a graphite endpoint, so that metrictank can ingest its own metrics.
+// The metrics are reported in the graphite line format, the same way as Graphite does.
+type Local struct {
+	prefix  []byte
+	toLocal chan []byte
+}
+
+// NewLocal creates and starts a local reporter.
+// prefix is a string prefix which is added to every metric
+// interval is the interval in seconds that metrics should be reported.
+// bufferSize determines how many reporting intervals should be buffered in memory, until they are consumed with Run.
+// If full, new intervals will not be reported
+func NewLocal(prefix string, interval, bufferSize int) *Local {
+	if len(prefix) != 0 && prefix[len(prefix)-1] != '.' {
+		prefix = prefix + "."
+	}
+	NewGauge32("stats.local.write_queue.size").Set(bufferSize)
+	localQueueItems = NewRange32("stats.local.write_queue.items")
+	// metric stats.local.dropped is how many reporting intervals were dropped because the write queue was full
+	localDropped = NewCounter32("stats.local.dropped")
+	// metric stats.generate_message is how long it takes to generate the stats
+	genDataDuration = NewGauge32("stats.generate_message.duration")
+
+	l := &Local{
+		prefix:  []byte(prefix),
+		toLocal: make(chan []byte, bufferSize),
+	}
+	go l.reporter(interval)
+	return l
+}
+
+// Report queues the metrics with the given timestamp
+func (l *Local) Report(now time.Time) {
+	log.Debugf("stats flushing for %s to local", now)
+	localQueueItems.Value(len(l.toLocal))
+	if len(l.toLocal) == cap(l.toLocal) {
+		// no space in buffer, no use in doing any work
+		localDropped.Inc()
+		return
+	}
+
+	pre := time.Now()
+	buf := make([]byte, 0)
+	for _, metric := range registry.list() {
+		buf = metric.WriteGraphiteLine(buf, l.prefix, now)
+	}
+	genDataDuration.Set(int(time.Since(pre).Nanoseconds()))
+	l.toLocal <- buf
+}
+
+func (l *Local) reporter(interval int) {
+	ticker := clock.AlignedTickLossy(time.Duration(interval) * time.Second)
+	for now := range ticker {
+		l.Report(now)
+	}
+}
+
+// Run calls process for every line of every reported interval. It never returns.
+func (l *Local) Run(process func(line []byte)) {
+	for buf := range l.toLocal {
+		localQueueItems.Value(len(l.toLocal))
+		for len(buf) > 0 {
+			i := bytes.IndexByte(buf, '\n')
+			if i < 0 {
+				i = len(buf)
+			}
+			if i > 0 {
+				process(buf[:i])
+			}
+			if i == len(buf) {
+				break
+			}
+			buf = buf[i+1:]
+		}
+	}
+}
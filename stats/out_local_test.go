@@ -0,0 +1,51 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	Clear()
+	defer Clear()
+
+	l := NewLocal("mt.local", 3600, 2)
+	NewCounter32("test.requests").Add(3)
+	NewCounter32WithTags("test.partition.requests", ";partition=1").Add(1)
+
+	l.Report(time.Unix(10, 0))
+	l.Report(time.Unix(20, 0))
+	// the buffer is full, so this interval is dropped
+	l.Report(time.Unix(30, 0))
+
+	lines := make(chan string, 1000)
+	go l.Run(func(line []byte) {
+		lines <- string(line)
+	})
+	exp := map[string]bool{
+		"mt.local.test.requests.counter32 3 10":                       false,
+		"mt.local.test.partition.requests.counter32;partition=1 1 10": false,
+		"mt.local.test.requests.counter32 3 20":                       false,
+		"mt.local.test.partition.requests.counter32;partition=1 1 20": false,
+	}
+
+	timeout := time.After(time.Second)
+	for missing := len(exp); missing > 0; {
+		select {
+		case line := <-lines:
+			if strings.HasSuffix(line, " 30") {
+				t.Fatalf("expected the interval reported while the buffer was full to be dropped, got %q", line)
+			}
+			if seen, ok := exp[line]; ok && !seen {
+				exp[line] = true
+				missing--
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for the reported lines. seen: %v", exp)
+		}
+	}
+	if localDropped.Peek() != 1 {
+		t.Fatalf("expected 1 dropped interval, got %d", localDropped.Peek())
+	}
+}
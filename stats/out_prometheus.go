@@ -0,0 +1,164 @@
+package stats
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// prometheusMetric is implemented by metrics that can be exposed to prometheus
+type prometheusMetric interface {
+	// WritePrometheus adds the current state of the metric to the builder.
+	// Unlike WriteGraphiteLine, it must not reset any measurements, as prometheus
+	// is scraped independently of the graphite reporting interval.
+	WritePrometheus(b *promBuilder)
+}
+
+// PrometheusCollector is a prometheus.Collector that exposes all metrics in the registry
+// Counters are exposed as counters with a _total suffix, gauges as gauges, meters as summaries
+// and latency histograms as histograms in seconds. Tags become labels.
+// As metrics are created dynamically, it is an unchecked collector: it does not describe its metrics upfront.
+type PrometheusCollector struct {
+	namespace string
+}
+
+// NewPrometheusCollector creates a collector, which prefixes all metric names with the given namespace
+func NewPrometheusCollector(namespace string) *PrometheusCollector {
+	return &PrometheusCollector{
+		namespace: namespace,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (p *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect implements prometheus.Collector
+func (p *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := registry.list()
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	// sort such that, if sanitized names collide, the same metric always wins
+	sort.Strings(keys)
+
+	b := newPromBuilder(p.namespace)
+	for _, key := range keys {
+		if metric, ok := metrics[key].(prometheusMetric); ok {
+			metric.WritePrometheus(b)
+		}
+	}
+	for _, m := range b.metrics {
+		ch <- m
+	}
+}
+
+// promBuilder collects the metrics to expose, making sure the result is consistent:
+// every family has a single type and every label set occurs only once per family.
+type promBuilder struct {
+	namespace string
+	kinds     map[string]string   // type of each family
+	seen      map[string]struct{} // family and labels of each metric
+	metrics   []prometheus.Metric
+}
+
+func newPromBuilder(namespace string) *promBuilder {
+	return &promBuilder{
+		namespace: namespace,
+		kinds:     make(map[string]string),
+		seen:      make(map[string]struct{}),
+	}
+}
+
+func (b *promBuilder) counter(name, tags []byte, suffix string, val float64) {
+	b.add(name, tags, suffix+"_total", "counter", func(desc *prometheus.Desc) (prometheus.Metric, error) {
+		return prometheus.NewConstMetric(desc, prometheus.CounterValue, val)
+	})
+}
+
+func (b *promBuilder) gauge(name, tags []byte, suffix string, val float64) {
+	b.add(name, tags, suffix, "gauge", func(desc *prometheus.Desc) (prometheus.Metric, error) {
+		return prometheus.NewConstMetric(desc, prometheus.GaugeValue, val)
+	})
+}
+
+func (b *promBuilder) summary(name, tags []byte, suffix string, count uint64, sum float64, quantiles map[float64]float64) {
+	b.add(name, tags, suffix, "summary", func(desc *prometheus.Desc) (prometheus.Metric, error) {
+		return prometheus.NewConstSummary(desc, count, sum, quantiles)
+	})
+}
+
+// histogram adds a histogram. buckets are cumulative counts by upper bound, without the +Inf bucket
+func (b *promBuilder) histogram(name, tags []byte, suffix string, count uint64, sum float64, buckets map[float64]uint64) {
+	b.add(name, tags, suffix, "histogram", func(desc *prometheus.Desc) (prometheus.Metric, error) {
+		return prometheus.NewConstHistogram(desc, count, sum, buckets)
+	})
+}
+
+func (b *promBuilder) add(name, tags []byte, suffix, kind string, newMetric func(*prometheus.Desc) (prometheus.Metric, error)) {
+	family := b.namespace + "_" + sanitizePromName(string(name)+suffix)
+	if existing, ok := b.kinds[family]; ok && existing != kind {
+		return
+	}
+	labels := promLabels(tags)
+	key := family + labelsKey(labels)
+	if _, ok := b.seen[key]; ok {
+		return
+	}
+	metric, err := newMetric(prometheus.NewDesc(family, "metrictank stat "+family, nil, labels))
+	if err != nil {
+		return
+	}
+	b.kinds[family] = kind
+	b.seen[key] = struct{}{}
+	b.metrics = append(b.metrics, metric)
+}
+
+// sanitizePromName replaces all characters that are not valid in prometheus metric names, such as dots, with underscores
+func sanitizePromName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// promLabels converts graphite tags (";key=value;key2=value2") to prometheus labels
+func promLabels(tags []byte) prometheus.Labels {
+	if len(tags) == 0 {
+		return nil
+	}
+	labels := make(prometheus.Labels)
+	for _, tag := range bytes.Split(tags, []byte(";")) {
+		eq := bytes.IndexByte(tag, '=')
+		if eq < 1 {
+			continue
+		}
+		key := strings.Replace(sanitizePromName(string(tag[:eq])), ":", "_", -1)
+		if key[0] >= '0' && key[0] <= '9' {
+			key = "_" + key
+		}
+		if strings.HasPrefix(key, "__") {
+			continue
+		}
+		labels[key] = string(tag[eq+1:])
+	}
+	return labels
+}
+
+func labelsKey(labels prometheus.Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var key strings.Builder
+	for _, k := range keys {
+		key.WriteString(";" + k + "=" + labels[k])
+	}
+	return key.String()
+}
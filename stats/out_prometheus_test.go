@@ -0,0 +1,139 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func gatherPrometheus(t *testing.T) map[string]*dto.MetricFamily {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewPrometheusCollector("mt"))
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %s", err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+	return byName
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	Clear()
+	defer Clear()
+
+	NewCounter32("test.requests").Add(3)
+	NewCounter32WithTags("test.partition.requests", ";partition=1").Add(1)
+	NewCounter32WithTags("test.partition.requests", ";partition=2").Add(2)
+	NewGauge64("test.queue.size").Set(42)
+	NewBool("test.ready").SetTrue()
+	r := NewRange32("test.depth")
+	r.Value(5)
+	r.Value(10)
+	m := NewMeter32("test.size", false)
+	for i := 1; i <= 10; i++ {
+		m.Value(i)
+	}
+	l := NewLatencyHistogram15s32("test.api")
+	l.Value(time.Millisecond)
+	l.Value(40 * time.Millisecond)
+	l.Value(time.Minute)
+	// a gauge whose name collides with the range: the range must win, as it sorts first
+	NewGauge32("test_depth_min").Set(1)
+
+	families := gatherPrometheus(t)
+
+	check := func(name string, typ dto.MetricType, num int) *dto.MetricFamily {
+		f, ok := families[name]
+		if !ok {
+			t.Fatalf("expected family %s, got %v", name, families)
+		}
+		if f.GetType() != typ || len(f.Metric) != num {
+			t.Fatalf("expected %s to have type %s and %d metrics, got %s", name, typ, num, f)
+		}
+		return f
+	}
+
+	f := check("mt_test_requests_total", dto.MetricType_COUNTER, 1)
+	if f.Metric[0].Counter.GetValue() != 3 {
+		t.Fatalf("unexpected counter %s", f)
+	}
+	f = check("mt_test_partition_requests_total", dto.MetricType_COUNTER, 2)
+	for _, metric := range f.Metric {
+		if len(metric.Label) != 1 || metric.Label[0].GetName() != "partition" {
+			t.Fatalf("expected partition label, got %s", metric)
+		}
+	}
+	if check("mt_test_queue_size", dto.MetricType_GAUGE, 1).Metric[0].Gauge.GetValue() != 42 {
+		t.Fatal("unexpected gauge value")
+	}
+	if check("mt_test_ready", dto.MetricType_GAUGE, 1).Metric[0].Gauge.GetValue() != 1 {
+		t.Fatal("unexpected bool value")
+	}
+	if check("mt_test_depth_min", dto.MetricType_GAUGE, 1).Metric[0].Gauge.GetValue() != 5 {
+		t.Fatal("unexpected range min")
+	}
+	if check("mt_test_depth_max", dto.MetricType_GAUGE, 1).Metric[0].Gauge.GetValue() != 10 {
+		t.Fatal("unexpected range max")
+	}
+
+	s := check("mt_test_size", dto.MetricType_SUMMARY, 1).Metric[0].Summary
+	if s.GetSampleCount() != 10 || s.GetSampleSum() != 55 {
+		t.Fatalf("unexpected summary %s", s)
+	}
+	for _, q := range s.Quantile {
+		if q.GetQuantile() == 0.5 && q.GetValue() != 5 {
+			t.Fatalf("expected median 5, got %s", q)
+		}
+	}
+
+	h := check("mt_test_api_latency_seconds", dto.MetricType_HISTOGRAM, 1).Metric[0].Histogram
+	if h.GetSampleCount() != 3 || math.Abs(h.GetSampleSum()-60.041) > 1e-9 {
+		t.Fatalf("unexpected histogram %s", h)
+	}
+	for _, b := range h.Bucket {
+		var exp uint64
+		switch {
+		case b.GetUpperBound() >= 0.04:
+			exp = 2
+		case b.GetUpperBound() >= 0.001:
+			exp = 1
+		}
+		if b.GetCumulativeCount() != exp {
+			t.Fatalf("bucket %v: expected %d, got %d", b.GetUpperBound(), exp, b.GetCumulativeCount())
+		}
+	}
+
+	// reporting to graphite resets the range and meter window and the latency histogram,
+	// but prometheus keeps seeing the cumulative counts
+	buf := l.WriteGraphiteLine(nil, nil, time.Now())
+	if len(buf) == 0 {
+		t.Fatal("expected graphite output")
+	}
+	r.WriteGraphiteLine(nil, nil, time.Now())
+	l.Value(time.Millisecond)
+
+	families = gatherPrometheus(t)
+	if _, ok := families["mt_test_depth_max"]; ok {
+		t.Fatal("expected range without values to not be exposed")
+	}
+	h = check("mt_test_api_latency_seconds", dto.MetricType_HISTOGRAM, 1).Metric[0].Histogram
+	if h.GetSampleCount() != 4 {
+		t.Fatalf("expected the histogram to keep counting, got %s", h)
+	}
+
+	// and vice versa, graphite sees the measurements made before the prometheus scrape
+	l.Value(time.Millisecond)
+	gatherPrometheus(t)
+	l.Lock()
+	pending := l.pending[0]
+	l.Unlock()
+	if pending != 2 {
+		t.Fatalf("expected 2 measurements pending for graphite, got %d", pending)
+	}
+}
@@ -47,3 +47,15 @@ func (m *ProcessReporter) WriteGraphiteLine(buf, prefix []byte, now time.Time) [
 
 	return buf
 }
+
+func (m *ProcessReporter) WritePrometheus(b *promBuilder) {
+	stat, err := m.proc.NewStat()
+	if err != nil {
+		return
+	}
+	b.gauge([]byte("process.virtual_memory_bytes"), nil, "", float64(stat.VirtualMemory()))
+	b.gauge([]byte("process.resident_memory_bytes"), nil, "", float64(stat.ResidentMemory()))
+	b.counter([]byte("process.minor_page_faults"), nil, "", float64(stat.MinFlt))
+	b.counter([]byte("process.major_page_faults"), nil, "", float64(stat.MajFlt))
+	b.counter([]byte("process.cpu_seconds"), nil, "", stat.CPUTime())
+}
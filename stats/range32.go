@@ -62,3 +62,14 @@ func (r *Range32) WriteGraphiteLine(buf, prefix []byte, now time.Time) []byte {
 	r.Unlock()
 	return buf
 }
+
+// WritePrometheus exposes the min and max of the values seen since the last graphite report
+func (r *Range32) WritePrometheus(b *promBuilder) {
+	r.Lock()
+	min, max, valid := r.min, r.max, r.valid
+	r.Unlock()
+	if valid {
+		b.gauge(r.name, r.tags, "_min", float64(min))
+		b.gauge(r.name, r.tags, "_max", float64(max))
+	}
+}
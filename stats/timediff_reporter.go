@@ -40,3 +40,13 @@ func (g *TimeDiffReporter32) WriteGraphiteLine(buf, prefix []byte, now time.Time
 	buf = WriteUint32(buf, prefix, g.name, []byte(".gauge32"), g.tags, report, now)
 	return buf
 }
+
+func (g *TimeDiffReporter32) WritePrometheus(b *promBuilder) {
+	target := atomic.LoadUint32(&g.target)
+	now32 := uint32(time.Now().Unix())
+	report := uint32(0)
+	if now32 < target {
+		report = target - now32
+	}
+	b.gauge(g.name, g.tags, "", float64(report))
+}
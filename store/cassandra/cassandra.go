@@ -90,6 +90,7 @@ type CassandraStore struct {
 	shutdown         chan struct{}
 	wg               sync.WaitGroup
 	cfg              *StoreConfig
+	compactedUntil   map[string]uint32 // per table, the cutoff of the last complete compaction run. only used by compactLoop
 }
 
 // ConvertTimeout provides backwards compatibility for values that used to be specified as integers,
@@ -216,6 +217,7 @@ func NewCassandraStore(config *StoreConfig, ttls []uint32, schemaMaxChunkSpan ui
 		tracer:           opentracing.NoopTracer{},
 		shutdown:         make(chan struct{}),
 		cfg:              config,
+		compactedUntil:   make(map[string]uint32),
 	}
 
 	for i := 0; i < config.WriteConcurrency; i++ {
@@ -230,6 +232,11 @@ func NewCassandraStore(config *StoreConfig, ttls []uint32, schemaMaxChunkSpan ui
 		go c.processReadQueue()
 	}
 
+	if config.ChunkCompactionEnabled {
+		c.wg.Add(1)
+		go c.compactLoop()
+	}
+
 	return c, err
 }
 
@@ -265,10 +272,11 @@ func (c *CassandraStore) FindExistingTables(keyspace string) error {
 			return fmt.Errorf("could not parse table %q", table.Name)
 		}
 		c.TTLTables[uint32(ttl)] = Table{
-			Name:       table.Name,
-			QueryRead:  fmt.Sprintf(QueryFmtRead, table.Name),
-			QueryWrite: fmt.Sprintf(QueryFmtWrite, table.Name),
-			TTL:        uint32(ttl),
+			Name:        table.Name,
+			QueryRead:   fmt.Sprintf(QueryFmtRead, table.Name),
+			QueryWrite:  fmt.Sprintf(QueryFmtWrite, table.Name),
+			QueryDelete: fmt.Sprintf(QueryFmtDelete, table.Name),
+			TTL:         uint32(ttl),
 		}
 	}
 	return nil
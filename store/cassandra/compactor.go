@@ -0,0 +1,334 @@
+package cassandra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/mdata/chunk"
+	"github.com/grafana/metrictank/schema"
+	"github.com/grafana/metrictank/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// chunk compaction merges the chunks of a series that fall within the same window of
+// compaction-span into a single chunk, so that reads need to fetch fewer rows.
+// this is useful for sparse series with long chunkspans, and for the partial chunks
+// that get written around restarts.
+//
+// windows are aligned to the compaction span, which divides Month_sec, so a merged chunk
+// always stays within the row (month) of the chunks it replaces. Because the merged chunk
+// has the t0 of its window, reads find it as long as the compaction span is not larger than max-chunkspan.
+//
+// each run only reads the chunks of the windows that became eligible since the last complete run of the table,
+// so the first run after a start goes over all chunks, and later runs only over the most recent ones.
+
+var (
+	// metric store.cassandra.compaction.windows is the number of windows of which the chunks were merged into a single chunk
+	compactionWindows = stats.NewCounter32("store.cassandra.compaction.windows")
+	// metric store.cassandra.compaction.chunks_removed is the number of chunks deleted after they were merged
+	compactionChunksRemoved = stats.NewCounter32("store.cassandra.compaction.chunks_removed")
+	// metric store.cassandra.compaction.errors is the number of errors encountered while compacting chunks
+	compactionErrors = stats.NewCounter32("store.cassandra.compaction.errors")
+	// metric store.cassandra.compaction.runs is the number of completed compaction runs over all tables
+	compactionRuns = stats.NewCounter32("store.cassandra.compaction.runs")
+
+	errShutdown = errors.New("cassandra-store: shutting down")
+)
+
+// storedChunk is a chunk as read from a table, along with its remaining ttl
+type storedChunk struct {
+	t0   uint32
+	ttl  uint32 // remaining ttl in seconds, as reported by cassandra
+	data []byte
+}
+
+// compaction is the replacement of the chunks of a window by a single chunk
+type compaction struct {
+	t0        uint32
+	data      []byte
+	remaining uint32   // the largest remaining ttl of the replaced chunks
+	chunkEnd  uint32   // the end of the replaced chunk that has the remaining ttl
+	delete    []uint32 // t0's of the chunks to delete once the merged chunk is saved
+	points    int
+}
+
+// planCompactions groups the given chunks (sorted by t0) into windows of the given span,
+// and returns how to merge the chunks of each window that can be compacted:
+// * the window must end before cutoff
+// * it must have at least 2 chunks, of which the span is known and which don't cross the window boundary
+// * the merged chunk must have no more than maxPoints points
+func planCompactions(chunks []storedChunk, span, cutoff, maxPoints uint32) []compaction {
+	var out []compaction
+	for i := 0; i < len(chunks); {
+		w := chunks[i].t0 - chunks[i].t0%span
+		j := i
+		for j < len(chunks) && chunks[j].t0 < w+span {
+			j++
+		}
+		if w+span <= cutoff && j-i >= 2 {
+			if comp, ok := merge(chunks[i:j], w, span, maxPoints); ok {
+				out = append(out, comp)
+			}
+		}
+		i = j
+	}
+	return out
+}
+
+// merge merges the chunks of the window starting at w into a single chunk.
+func merge(chunks []storedChunk, w, span, maxPoints uint32) (compaction, bool) {
+	comp := compaction{
+		t0: w,
+	}
+	c := chunk.New(w)
+	for _, sc := range chunks {
+		chunkSpan := chunk.ExtractChunkSpan(sc.data)
+		if chunkSpan == 0 || sc.t0+chunkSpan > w+span {
+			return comp, false
+		}
+		itgen, err := chunk.NewIterGen(sc.t0, 0, sc.data)
+		if err != nil {
+			return comp, false
+		}
+		it, err := itgen.Get()
+		if err != nil {
+			return comp, false
+		}
+		for it.Next() {
+			ts, val := it.Values()
+			// overlapping chunks may contain the same points. the first one wins.
+			if c.Push(ts, val) == nil {
+				comp.points++
+			}
+		}
+		if it.Err() != nil {
+			return comp, false
+		}
+		if sc.ttl >= comp.remaining {
+			comp.remaining = sc.ttl
+			comp.chunkEnd = sc.t0 + chunkSpan
+		}
+		if sc.t0 != w {
+			// the chunk at t0 w gets overwritten by the merged chunk
+			comp.delete = append(comp.delete, sc.t0)
+		}
+	}
+	if comp.points == 0 || comp.points > int(maxPoints) {
+		return comp, false
+	}
+	c.Finish()
+	comp.data = c.Encode(span)
+	return comp, true
+}
+
+// schemaTTL returns the ttl of the given ttls (those of a single table) that is closest to the ttl
+// which a chunk ending at chunkEnd, with the given remaining ttl, was saved with.
+func schemaTTL(ttls []uint32, remaining, chunkEnd uint32, now int64) uint32 {
+	// see insertChunk: remaining = chunkEnd + ttl - now
+	est := int64(remaining) + now - int64(chunkEnd)
+	best := ttls[0]
+	for _, ttl := range ttls[1:] {
+		if abs(int64(ttl)-est) < abs(int64(best)-est) {
+			best = ttl
+		}
+	}
+	return best
+}
+
+func abs(i int64) int64 {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// compactLoop compacts all tables every interval
+func (c *CassandraStore) compactLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.cfg.ChunkCompactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.shutdown:
+			log.Info("cassandra-store: received shutdown, exiting compactLoop")
+			return
+		case <-ticker.C:
+			if err := c.compact(); err != nil {
+				if err == errShutdown {
+					return
+				}
+				compactionErrors.Inc()
+				log.Errorf("cassandra-store: chunk compaction failed: %s", err)
+				continue
+			}
+			compactionRuns.Inc()
+		}
+	}
+}
+
+// compact compacts the chunks of all tables, in the windows that ended before the cutoff and that
+// have not been compacted by a previous run
+func (c *CassandraStore) compact() error {
+	span := uint32(c.cfg.ChunkCompactionSpan.Seconds())
+	now := time.Now().Unix()
+	cutoff := uint32(now - int64(c.cfg.ChunkCompactionMinAge.Seconds()))
+	cutoff -= cutoff % span
+
+	// multiple ttls may share a table
+	ttlsByTable := make(map[string][]uint32)
+	for ttl, table := range c.TTLTables {
+		ttlsByTable[table.Name] = append(ttlsByTable[table.Name], ttl)
+	}
+	for name, ttls := range ttlsByTable {
+		sort.Slice(ttls, func(i, j int) bool { return ttls[i] < ttls[j] })
+		pre := time.Now()
+		from := c.compactedUntil[name]
+		windows, complete, err := c.compactTable(c.TTLTables[ttls[0]], ttls, from, cutoff, now)
+		if err == errShutdown {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("table %s: %s", name, err)
+		}
+		if complete {
+			c.compactedUntil[name] = cutoff
+		}
+		log.Infof("cassandra-store: compacted %d windows of chunks between %d and %d in table %s in %s", windows, from, cutoff, name, time.Since(pre))
+	}
+	return nil
+}
+
+// compactTable compacts the chunks of all rows in the given table, with a t0 from (inclusive) until cutoff (exclusive).
+// It returns the number of compacted windows, and whether all rows were compacted.
+func (c *CassandraStore) compactTable(table Table, ttls []uint32, from, cutoff uint32, now int64) (int, bool, error) {
+	session := c.Session.CurrentSession()
+	iter := session.Query(fmt.Sprintf("SELECT DISTINCT key FROM %s", table.Name)).Iter()
+	var rowKey string
+	var windows int
+	complete := true
+	for iter.Scan(&rowKey) {
+		select {
+		case <-c.shutdown:
+			iter.Close()
+			return windows, false, errShutdown
+		default:
+		}
+		n, err := c.compactRow(table, ttls, rowKey, from, cutoff, now)
+		if err == errShutdown {
+			iter.Close()
+			return windows, false, err
+		}
+		if err != nil {
+			// one bad row shouldn't prevent compacting the others. it is retried in the next run
+			compactionErrors.Inc()
+			complete = false
+			log.Warnf("cassandra-store: failed to compact chunks of row %s in table %s: %s", rowKey, table.Name, err)
+		}
+		windows += n
+	}
+	return windows, complete, iter.Close()
+}
+
+// rowInRange returns whether the row of the given month may have chunks with a t0 from (inclusive) until cutoff (exclusive)
+func rowInRange(month, from, cutoff uint32) bool {
+	rowStart := uint64(month) * Month_sec
+	return rowStart+Month_sec > uint64(from) && rowStart < uint64(cutoff)
+}
+
+// compactRow compacts the chunks of a single row (a series for one month), with a t0 from (inclusive) until cutoff (exclusive).
+// It returns the number of compacted windows.
+func (c *CassandraStore) compactRow(table Table, ttls []uint32, rowKey string, from, cutoff uint32, now int64) (int, error) {
+	pos := strings.LastIndex(rowKey, "_")
+	if pos == -1 {
+		return 0, fmt.Errorf("invalid row key %q", rowKey)
+	}
+	key, err := schema.AMKeyFromString(rowKey[:pos])
+	if err != nil {
+		return 0, err
+	}
+	month, err := strconv.ParseUint(rowKey[pos+1:], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid row key %q", rowKey)
+	}
+	if !rowInRange(uint32(month), from, cutoff) {
+		return 0, nil
+	}
+
+	chunks, err := c.readRow(table, rowKey, from, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	span := uint32(c.cfg.ChunkCompactionSpan.Seconds())
+	comps := planCompactions(chunks, span, cutoff, uint32(c.cfg.ChunkCompactionMaxPoints))
+	for i, comp := range comps {
+		if err := c.replace(table, ttls, key, rowKey, comp, now); err != nil {
+			return i, err
+		}
+		compactionWindows.Inc()
+	}
+	return len(comps), nil
+}
+
+// readRow reads the chunks of the row with a t0 from (inclusive) until cutoff (exclusive), sorted by t0
+func (c *CassandraStore) readRow(table Table, rowKey string, from, cutoff uint32) ([]storedChunk, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cluster.Timeout)
+	defer cancel()
+	session := c.Session.CurrentSession()
+	query := fmt.Sprintf("SELECT ts, ttl(data), data FROM %s WHERE key = ? AND ts >= ? AND ts < ?", table.Name)
+	iter := session.Query(query, rowKey, from, cutoff).WithContext(ctx).Iter()
+	var chunks []storedChunk
+	var t0, ttl int
+	var b []byte
+	for iter.Scan(&t0, &ttl, &b) {
+		if len(b) < 2 {
+			continue
+		}
+		data := make([]byte, len(b))
+		copy(data, b)
+		chunks = append(chunks, storedChunk{uint32(t0), uint32(ttl), data})
+	}
+	if err := iter.Close(); err != nil {
+		errmetrics.Inc(err)
+		return nil, err
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].t0 < chunks[j].t0 })
+	return chunks, nil
+}
+
+// replace saves the merged chunk via the regular write path, and deletes the chunks it replaces once it is saved.
+// if we crash in between, the merged chunk and the remaining original chunks overlap until the next compaction run,
+// which merges them again.
+func (c *CassandraStore) replace(table Table, ttls []uint32, key schema.AMKey, rowKey string, comp compaction, now int64) error {
+	saved := make(chan struct{})
+	ttl := schemaTTL(ttls, comp.remaining, comp.chunkEnd, now)
+	cwr := mdata.NewChunkWriteRequest(func() { close(saved) }, key, ttl, comp.t0, comp.data, time.Now())
+	c.Add(&cwr)
+	select {
+	case <-saved:
+	case <-c.shutdown:
+		return errShutdown
+	}
+
+	session := c.Session.CurrentSession()
+	for _, t0 := range comp.delete {
+		ctx, cancel := context.WithTimeout(context.Background(), c.cluster.Timeout)
+		err := session.Query(table.QueryDelete, rowKey, t0).WithContext(ctx).Exec()
+		cancel()
+		if err != nil {
+			errmetrics.Inc(err)
+			return err
+		}
+		compactionChunksRemoved.Inc()
+	}
+	if log.IsLevelEnabled(log.DebugLevel) {
+		log.Debugf("cassandra-store: compacted chunks of %s into chunk at %d with %d points, deleted %d chunks", rowKey, comp.t0, comp.points, len(comp.delete))
+	}
+	return nil
+}
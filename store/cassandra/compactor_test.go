@@ -0,0 +1,110 @@
+package cassandra
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/metrictank/mdata/chunk"
+	"github.com/grafana/metrictank/schema"
+)
+
+func testChunk(t0, span, ttl uint32, points ...schema.Point) storedChunk {
+	c := chunk.New(t0)
+	for _, p := range points {
+		c.Push(p.Ts, p.Val)
+	}
+	c.Finish()
+	return storedChunk{t0: t0, ttl: ttl, data: c.Encode(span)}
+}
+
+func chunkPoints(t *testing.T, t0 uint32, data []byte) []schema.Point {
+	t.Helper()
+	itgen, err := chunk.NewIterGen(t0, 0, data)
+	if err != nil {
+		t.Fatalf("could not construct itergen: %s", err)
+	}
+	it, err := itgen.Get()
+	if err != nil {
+		t.Fatalf("could not get iterator: %s", err)
+	}
+	var points []schema.Point
+	for it.Next() {
+		ts, val := it.Values()
+		points = append(points, schema.Point{Val: val, Ts: ts})
+	}
+	return points
+}
+
+func TestPlanCompactions(t *testing.T) {
+	chunks := []storedChunk{
+		// window 0: 3 partial chunks, the first one overlapping the second
+		testChunk(0, 3600, 100, schema.Point{Val: 1, Ts: 10}, schema.Point{Val: 2, Ts: 3610}),
+		testChunk(3600, 3600, 200, schema.Point{Val: 20, Ts: 3610}, schema.Point{Val: 3, Ts: 3620}),
+		testChunk(7200, 1800, 300, schema.Point{Val: 4, Ts: 7300}),
+		// window 86400: a single chunk, nothing to merge
+		testChunk(86400, 3600, 400, schema.Point{Val: 5, Ts: 86410}),
+		// window 172800: a chunk crossing the window boundary
+		testChunk(172800, 3600, 500, schema.Point{Val: 6, Ts: 172810}),
+		testChunk(252000, 4*3600, 600, schema.Point{Val: 7, Ts: 252010}),
+		// window 259200: too many points
+		testChunk(259200, 3600, 700, schema.Point{Val: 8, Ts: 259210}, schema.Point{Val: 9, Ts: 259220}, schema.Point{Val: 9, Ts: 259230}),
+		testChunk(262800, 3600, 800, schema.Point{Val: 10, Ts: 262810}, schema.Point{Val: 11, Ts: 262820}, schema.Point{Val: 11, Ts: 262830}),
+		// window 345600: not old enough
+		testChunk(345600, 3600, 900, schema.Point{Val: 12, Ts: 345610}),
+		testChunk(349200, 3600, 1000, schema.Point{Val: 13, Ts: 349210}),
+	}
+
+	comps := planCompactions(chunks, 86400, 345600, 5)
+	if len(comps) != 1 {
+		t.Fatalf("expected 1 compaction, got %d", len(comps))
+	}
+	comp := comps[0]
+	if comp.t0 != 0 || comp.points != 4 || comp.remaining != 300 || comp.chunkEnd != 9000 {
+		t.Fatalf("unexpected compaction: t0 %d, points %d, remaining %d, chunkEnd %d", comp.t0, comp.points, comp.remaining, comp.chunkEnd)
+	}
+	if !reflect.DeepEqual(comp.delete, []uint32{3600, 7200}) {
+		t.Fatalf("expected chunks 3600 and 7200 to be deleted, got %v", comp.delete)
+	}
+	if span := chunk.ExtractChunkSpan(comp.data); span != 86400 {
+		t.Fatalf("expected merged chunk with span 86400, got %d", span)
+	}
+	exp := []schema.Point{{Val: 1, Ts: 10}, {Val: 2, Ts: 3610}, {Val: 3, Ts: 3620}, {Val: 4, Ts: 7300}}
+	if got := chunkPoints(t, comp.t0, comp.data); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected merged points %v, got %v", exp, got)
+	}
+}
+
+func TestSchemaTTL(t *testing.T) {
+	ttls := []uint32{oneDay * 35, oneDay * 40, oneDay * 60}
+	now := int64(100 * oneDay)
+	// a chunk that ended 10 days ago, saved with a ttl of 40 days, has 30 days left
+	if ttl := schemaTTL(ttls, 30*oneDay, 90*oneDay, now); ttl != oneDay*40 {
+		t.Fatalf("expected ttl %d, got %d", oneDay*40, ttl)
+	}
+	// cassandra may report slightly less, as time passed since we read the ttl
+	if ttl := schemaTTL(ttls, 30*oneDay-5, 90*oneDay, now); ttl != oneDay*40 {
+		t.Fatalf("expected ttl %d, got %d", oneDay*40, ttl)
+	}
+}
+
+func TestRowInRange(t *testing.T) {
+	tests := []struct {
+		month, from, cutoff uint32
+		exp                 bool
+	}{
+		// first run: all rows before the cutoff
+		{0, 0, Month_sec, true},
+		{1, 0, Month_sec, false},
+		// later runs: only the rows overlapping the windows that became eligible since
+		{1, 2*Month_sec - 86400, 2*Month_sec + 86400, true},
+		{2, 2*Month_sec - 86400, 2*Month_sec + 86400, true},
+		{0, 2*Month_sec - 86400, 2*Month_sec + 86400, false},
+		{3, 2*Month_sec - 86400, 2*Month_sec + 86400, false},
+		{2, 2 * Month_sec, 2 * Month_sec, false},
+	}
+	for _, tc := range tests {
+		if got := rowInRange(tc.month, tc.from, tc.cutoff); got != tc.exp {
+			t.Errorf("rowInRange(%d, %d, %d): expected %t, got %t", tc.month, tc.from, tc.cutoff, tc.exp, got)
+		}
+	}
+}
@@ -38,6 +38,11 @@ type StoreConfig struct {
 	ConnectionCheckInterval  time.Duration
 	ConnectionCheckTimeout   time.Duration
 	MaxChunkSpan             time.Duration
+	ChunkCompactionEnabled   bool
+	ChunkCompactionSpan      time.Duration
+	ChunkCompactionMinAge    time.Duration
+	ChunkCompactionInterval  time.Duration
+	ChunkCompactionMaxPoints int
 }
 
 // Validate makes sure the StoreConfig settings are valid
@@ -50,6 +55,31 @@ func (cfg *StoreConfig) Validate(schemaMaxChunkSpan uint32) error {
 			return fmt.Errorf("max-chunkspan must be at least as high as the max chunkspan used in your storage-schemas (which is %d)", schemaMaxChunkSpan)
 		}
 	}
+	if CliConfig.ChunkCompactionEnabled {
+		span := CliConfig.ChunkCompactionSpan
+		if span%time.Second != 0 {
+			return errors.New("chunk-compaction-span must be a whole number of seconds")
+		}
+		if _, ok := chunk.RevChunkSpans[uint32(span.Seconds())]; !ok {
+			return fmt.Errorf("chunk-compaction-span %s is not a valid chunkspan", span)
+		}
+		// merged chunks must stay within the row of the chunks they replace, and must be found by reads
+		if Month_sec%uint32(span.Seconds()) != 0 {
+			return fmt.Errorf("chunk-compaction-span %s must divide a month (%d seconds)", span, Month_sec)
+		}
+		if span > CliConfig.MaxChunkSpan {
+			return fmt.Errorf("chunk-compaction-span %s must not be larger than max-chunkspan %s", span, CliConfig.MaxChunkSpan)
+		}
+		if CliConfig.ChunkCompactionMinAge < span {
+			return errors.New("chunk-compaction-min-age must be at least chunk-compaction-span")
+		}
+		if CliConfig.ChunkCompactionInterval <= 0 {
+			return errors.New("chunk-compaction-interval must be positive")
+		}
+		if CliConfig.ChunkCompactionMaxPoints < 1 {
+			return errors.New("chunk-compaction-max-points must be at least 1")
+		}
+	}
 	return nil
 }
 
@@ -82,6 +112,11 @@ func NewStoreConfig() *StoreConfig {
 		ConnectionCheckInterval:  time.Second * 5,
 		ConnectionCheckTimeout:   time.Second * 30,
 		MaxChunkSpan:             time.Second * time.Duration(chunk.MaxConfigurableSpan()),
+		ChunkCompactionEnabled:   false,
+		ChunkCompactionSpan:      time.Hour * 24,
+		ChunkCompactionMinAge:    time.Hour * 24 * 7,
+		ChunkCompactionInterval:  time.Hour * 24,
+		ChunkCompactionMaxPoints: 2000,
 	}
 }
 
@@ -115,6 +150,11 @@ func ConfigSetup() *flag.FlagSet {
 	cas.DurationVar(&CliConfig.ConnectionCheckInterval, "connection-check-interval", CliConfig.ConnectionCheckInterval, "interval at which to perform a connection check to cassandra, set to 0 to disable.")
 	cas.DurationVar(&CliConfig.ConnectionCheckTimeout, "connection-check-timeout", CliConfig.ConnectionCheckTimeout, "maximum total time to wait before considering a connection to cassandra invalid. This value should be higher than connection-check-interval.")
 	cas.DurationVar(&CliConfig.MaxChunkSpan, "max-chunkspan", CliConfig.MaxChunkSpan, "Maximum chunkspan size used.")
+	cas.BoolVar(&CliConfig.ChunkCompactionEnabled, "chunk-compaction-enabled", CliConfig.ChunkCompactionEnabled, "enable merging the chunks of a series into chunks of chunk-compaction-span in the background. only enable this on a single node")
+	cas.DurationVar(&CliConfig.ChunkCompactionSpan, "chunk-compaction-span", CliConfig.ChunkCompactionSpan, "span of the merged chunks. must be a valid chunkspan that divides 28 days, and not larger than max-chunkspan")
+	cas.DurationVar(&CliConfig.ChunkCompactionMinAge, "chunk-compaction-min-age", CliConfig.ChunkCompactionMinAge, "only merge chunks that are older than this. should be well beyond the chunks that are still being written or held in the chunk cache")
+	cas.DurationVar(&CliConfig.ChunkCompactionInterval, "chunk-compaction-interval", CliConfig.ChunkCompactionInterval, "interval between compaction runs over all tables")
+	cas.IntVar(&CliConfig.ChunkCompactionMaxPoints, "chunk-compaction-max-points", CliConfig.ChunkCompactionMaxPoints, "don't merge chunks if the merged chunk would have more points than this")
 	globalconf.Register("cassandra", cas, flag.ExitOnError)
 	return cas
 }
@@ -7,6 +7,7 @@ import (
 
 const QueryFmtRead = "SELECT ts, data FROM %s WHERE key IN ? AND ts >= ? AND ts < ?"
 const QueryFmtWrite = "INSERT INTO %s (key, ts, data) values(?,?,?) USING TTL ?"
+const QueryFmtDelete = "DELETE FROM %s WHERE key = ? AND ts = ?"
 const Table_name_format = `metric_%d`
 
 func IsStoreTable(name string) bool {
@@ -25,11 +26,12 @@ func IsStoreTable(name string) bool {
 type TTLTables map[uint32]Table
 
 type Table struct {
-	Name       string
-	QueryRead  string
-	QueryWrite string
-	WindowSize uint32
-	TTL        uint32
+	Name        string
+	QueryRead   string
+	QueryWrite  string
+	QueryDelete string
+	WindowSize  uint32
+	TTL         uint32
 }
 
 // GetTTLTables returns table definitions for the given specifications (ttls is in seconds)
@@ -84,11 +86,12 @@ func GetTable(ttl uint32, windowFactor int, nameFormat string) Table {
 	tableName := fmt.Sprintf(nameFormat, preFactorWindow)
 	windowSize := preFactorWindow/uint32(windowFactor) + 1
 	return Table{
-		Name:       tableName,
-		QueryRead:  fmt.Sprintf(QueryFmtRead, tableName),
-		QueryWrite: fmt.Sprintf(QueryFmtWrite, tableName),
-		WindowSize: windowSize,
-		TTL:        ttl,
+		Name:        tableName,
+		QueryRead:   fmt.Sprintf(QueryFmtRead, tableName),
+		QueryWrite:  fmt.Sprintf(QueryFmtWrite, tableName),
+		QueryDelete: fmt.Sprintf(QueryFmtDelete, tableName),
+		WindowSize:  windowSize,
+		TTL:         ttl,
 	}
 }
 
@@ -0,0 +1,291 @@
+package tiered
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/metrictank/mdata/chunk"
+)
+
+//go:generate msgp
+
+// a block holds the chunks of all series of a ttl, with a t0 within a window of block-span,
+// as saved by one node. It consists of 2 objects:
+// * <name>.data: the chunks, grouped per series (sorted by key), each series' chunks sorted by t0
+// * <name>.index: the msgp encoded BlockIndex, describing where to find the chunks of each series.
+// the index is uploaded last, so a block without index is incomplete and ignored.
+
+const blocksPrefix = "blocks/"
+
+// BlockIndex is the index of a block
+type BlockIndex struct {
+	Series []SeriesIndex // sorted by Key
+}
+
+// SeriesIndex describes where the chunks of a series are stored within the data object of a block
+type SeriesIndex struct {
+	Key    string // the AMKey of the series
+	Offset uint64 // offset of the first chunk in the data object
+	Chunks []ChunkIndex
+}
+
+// ChunkIndex describes a chunk
+type ChunkIndex struct {
+	T0   uint32
+	Span uint32 // 0 if not known
+	Size uint32
+}
+
+// find returns the index of the given series, if present
+func (idx *BlockIndex) find(key string) (SeriesIndex, bool) {
+	i := sort.Search(len(idx.Series), func(i int) bool { return idx.Series[i].Key >= key })
+	if i < len(idx.Series) && idx.Series[i].Key == key {
+		return idx.Series[i], true
+	}
+	return SeriesIndex{}, false
+}
+
+// blockMeta identifies a block
+type blockMeta struct {
+	name   string // name of the objects, without extension
+	ttl    uint32
+	window uint32 // start of the window
+}
+
+func blockName(ttl, window uint32, id string) string {
+	return fmt.Sprintf("%s%d/%d/%s", blocksPrefix, ttl, window, id)
+}
+
+// parseBlockIndexName parses the name of the index object of a block
+func parseBlockIndexName(name string) (blockMeta, bool) {
+	if !strings.HasPrefix(name, blocksPrefix) || !strings.HasSuffix(name, ".index") {
+		return blockMeta{}, false
+	}
+	base := strings.TrimSuffix(name, ".index")
+	parts := strings.Split(strings.TrimPrefix(base, blocksPrefix), "/")
+	if len(parts) != 3 {
+		return blockMeta{}, false
+	}
+	ttl, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return blockMeta{}, false
+	}
+	window, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return blockMeta{}, false
+	}
+	return blockMeta{name: base, ttl: uint32(ttl), window: uint32(window)}, true
+}
+
+// spool files hold the chunks of a block until it is uploaded. They consist of records:
+// <uvarint key length><key><uint32 t0><uvarint data length><data><uint32 crc32 of all previous fields>
+
+var errCorruptSpool = errors.New("corrupt spool record")
+
+func appendSpoolRecord(buf []byte, key string, t0 uint32, data []byte) []byte {
+	start := len(buf)
+	buf = appendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	buf = appendUint32(buf, t0)
+	buf = appendUvarint(buf, uint64(len(data)))
+	buf = append(buf, data...)
+	return appendUint32(buf, crc32.ChecksumIEEE(buf[start:]))
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// spooledChunk is a chunk in a spool file
+type spooledChunk struct {
+	key    string
+	t0     uint32
+	offset int64 // offset of the data within the spool file
+	size   uint32
+}
+
+// readSpool returns the chunks in the spool file.
+// An incomplete or corrupt record at the end, as left by a crash, ends the file.
+func readSpool(f *os.File) ([]spooledChunk, error) {
+	r := bufio.NewReader(f)
+	var chunks []spooledChunk
+	var pos int64
+	for {
+		c, n, err := readSpoolRecord(r, pos)
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err == io.ErrUnexpectedEOF || err == errCorruptSpool {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+		pos += n
+	}
+}
+
+// readSpoolRecord reads a record starting at pos. It returns the chunk and the size of the record.
+func readSpoolRecord(r *bufio.Reader, pos int64) (spooledChunk, int64, error) {
+	var rec []byte
+	readUvarint := func() (uint64, error) {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return 0, err
+		}
+		rec = appendUvarint(rec, v)
+		return v, nil
+	}
+	readN := func(n uint64) error {
+		if n > 1<<30 {
+			return errCorruptSpool
+		}
+		start := len(rec)
+		rec = append(rec, make([]byte, n)...)
+		_, err := io.ReadFull(r, rec[start:])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	keyLen, err := readUvarint()
+	if err != nil {
+		return spooledChunk{}, 0, err
+	}
+	if err := readN(keyLen); err != nil {
+		return spooledChunk{}, 0, err
+	}
+	key := string(rec[len(rec)-int(keyLen):])
+	if err := readN(4); err != nil {
+		return spooledChunk{}, 0, err
+	}
+	t0 := binary.LittleEndian.Uint32(rec[len(rec)-4:])
+	size, err := readUvarint()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return spooledChunk{}, 0, err
+	}
+	dataOffset := pos + int64(len(rec))
+	if err := readN(size); err != nil {
+		return spooledChunk{}, 0, err
+	}
+	var crc [4]byte
+	if _, err := io.ReadFull(r, crc[:]); err != nil {
+		return spooledChunk{}, 0, io.ErrUnexpectedEOF
+	}
+	if crc32.ChecksumIEEE(rec) != binary.LittleEndian.Uint32(crc[:]) {
+		return spooledChunk{}, 0, errCorruptSpool
+	}
+	return spooledChunk{key: key, t0: t0, offset: dataOffset, size: uint32(size)}, int64(len(rec)) + 4, nil
+}
+
+// buildBlock writes the data object of a block with the given spooled chunks to data, and returns its index.
+// If a chunk was spooled multiple times (e.g. it was saved again), the last one wins.
+func buildBlock(spool *os.File, chunks []spooledChunk, data io.Writer) (BlockIndex, error) {
+	sort.SliceStable(chunks, func(i, j int) bool {
+		if chunks[i].key != chunks[j].key {
+			return chunks[i].key < chunks[j].key
+		}
+		return chunks[i].t0 < chunks[j].t0
+	})
+	var idx BlockIndex
+	var offset uint64
+	buf := make([]byte, 0, 4096)
+	for i, c := range chunks {
+		if i+1 < len(chunks) && chunks[i+1].key == c.key && chunks[i+1].t0 == c.t0 {
+			continue
+		}
+		if len(idx.Series) == 0 || idx.Series[len(idx.Series)-1].Key != c.key {
+			idx.Series = append(idx.Series, SeriesIndex{Key: c.key, Offset: offset})
+		}
+		if cap(buf) < int(c.size) {
+			buf = make([]byte, c.size)
+		}
+		buf = buf[:c.size]
+		if _, err := spool.ReadAt(buf, c.offset); err != nil {
+			return idx, err
+		}
+		if _, err := data.Write(buf); err != nil {
+			return idx, err
+		}
+		series := &idx.Series[len(idx.Series)-1]
+		series.Chunks = append(series.Chunks, ChunkIndex{
+			T0:   c.t0,
+			Span: chunk.ExtractChunkSpan(buf),
+			Size: c.size,
+		})
+		offset += uint64(c.size)
+	}
+	return idx, nil
+}
+
+// uploadBlock builds the block from the given spool file and uploads it
+func uploadBlock(ctx context.Context, objects ObjectStore, spoolPath, name string) (int, error) {
+	spool, err := os.Open(spoolPath)
+	if err != nil {
+		return 0, err
+	}
+	defer spool.Close()
+	chunks, err := readSpool(spool)
+	if err != nil {
+		return 0, err
+	}
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(spoolPath), ".block-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	w := bufio.NewWriter(tmp)
+	idx, err := buildBlock(spool, chunks, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return 0, err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := objects.Put(ctx, name+".data", tmp, size); err != nil {
+		return 0, err
+	}
+	idxData, err := idx.MarshalMsg(nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := objects.Put(ctx, name+".index", bytes.NewReader(idxData), int64(len(idxData))); err != nil {
+		return 0, err
+	}
+	return len(idx.Series), nil
+}
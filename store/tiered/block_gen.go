@@ -0,0 +1,600 @@
+package tiered
+
+// Code generated by github.com/tinylib/msgp DO NOT EDIT.
+
+import (
+	"github.com/tinylib/msgp/msgp"
+)
+
+// DecodeMsg implements msgp.Decodable
+func (z *BlockIndex) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Series":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Series")
+				return
+			}
+			if cap(z.Series) >= int(zb0002) {
+				z.Series = (z.Series)[:zb0002]
+			} else {
+				z.Series = make([]SeriesIndex, zb0002)
+			}
+			for za0001 := range z.Series {
+				err = z.Series[za0001].DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Series", za0001)
+					return
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *BlockIndex) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 1
+	// write "Series"
+	err = en.Append(0x81, 0xa6, 0x53, 0x65, 0x72, 0x69, 0x65, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Series)))
+	if err != nil {
+		err = msgp.WrapError(err, "Series")
+		return
+	}
+	for za0001 := range z.Series {
+		err = z.Series[za0001].EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "Series", za0001)
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *BlockIndex) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 1
+	// string "Series"
+	o = append(o, 0x81, 0xa6, 0x53, 0x65, 0x72, 0x69, 0x65, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Series)))
+	for za0001 := range z.Series {
+		o, err = z.Series[za0001].MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "Series", za0001)
+			return
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *BlockIndex) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Series":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Series")
+				return
+			}
+			if cap(z.Series) >= int(zb0002) {
+				z.Series = (z.Series)[:zb0002]
+			} else {
+				z.Series = make([]SeriesIndex, zb0002)
+			}
+			for za0001 := range z.Series {
+				bts, err = z.Series[za0001].UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Series", za0001)
+					return
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *BlockIndex) Msgsize() (s int) {
+	s = 1 + 7 + msgp.ArrayHeaderSize
+	for za0001 := range z.Series {
+		s += z.Series[za0001].Msgsize()
+	}
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *ChunkIndex) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "T0":
+			z.T0, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "T0")
+				return
+			}
+		case "Span":
+			z.Span, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "Span")
+				return
+			}
+		case "Size":
+			z.Size, err = dc.ReadUint32()
+			if err != nil {
+				err = msgp.WrapError(err, "Size")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z ChunkIndex) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "T0"
+	err = en.Append(0x83, 0xa2, 0x54, 0x30)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.T0)
+	if err != nil {
+		err = msgp.WrapError(err, "T0")
+		return
+	}
+	// write "Span"
+	err = en.Append(0xa4, 0x53, 0x70, 0x61, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.Span)
+	if err != nil {
+		err = msgp.WrapError(err, "Span")
+		return
+	}
+	// write "Size"
+	err = en.Append(0xa4, 0x53, 0x69, 0x7a, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint32(z.Size)
+	if err != nil {
+		err = msgp.WrapError(err, "Size")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z ChunkIndex) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "T0"
+	o = append(o, 0x83, 0xa2, 0x54, 0x30)
+	o = msgp.AppendUint32(o, z.T0)
+	// string "Span"
+	o = append(o, 0xa4, 0x53, 0x70, 0x61, 0x6e)
+	o = msgp.AppendUint32(o, z.Span)
+	// string "Size"
+	o = append(o, 0xa4, 0x53, 0x69, 0x7a, 0x65)
+	o = msgp.AppendUint32(o, z.Size)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *ChunkIndex) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "T0":
+			z.T0, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "T0")
+				return
+			}
+		case "Span":
+			z.Span, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Span")
+				return
+			}
+		case "Size":
+			z.Size, bts, err = msgp.ReadUint32Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Size")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z ChunkIndex) Msgsize() (s int) {
+	s = 1 + 3 + msgp.Uint32Size + 5 + msgp.Uint32Size + 5 + msgp.Uint32Size
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *SeriesIndex) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Key":
+			z.Key, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Key")
+				return
+			}
+		case "Offset":
+			z.Offset, err = dc.ReadUint64()
+			if err != nil {
+				err = msgp.WrapError(err, "Offset")
+				return
+			}
+		case "Chunks":
+			var zb0002 uint32
+			zb0002, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Chunks")
+				return
+			}
+			if cap(z.Chunks) >= int(zb0002) {
+				z.Chunks = (z.Chunks)[:zb0002]
+			} else {
+				z.Chunks = make([]ChunkIndex, zb0002)
+			}
+			for za0001 := range z.Chunks {
+				var zb0003 uint32
+				zb0003, err = dc.ReadMapHeader()
+				if err != nil {
+					err = msgp.WrapError(err, "Chunks", za0001)
+					return
+				}
+				for zb0003 > 0 {
+					zb0003--
+					field, err = dc.ReadMapKeyPtr()
+					if err != nil {
+						err = msgp.WrapError(err, "Chunks", za0001)
+						return
+					}
+					switch msgp.UnsafeString(field) {
+					case "T0":
+						z.Chunks[za0001].T0, err = dc.ReadUint32()
+						if err != nil {
+							err = msgp.WrapError(err, "Chunks", za0001, "T0")
+							return
+						}
+					case "Span":
+						z.Chunks[za0001].Span, err = dc.ReadUint32()
+						if err != nil {
+							err = msgp.WrapError(err, "Chunks", za0001, "Span")
+							return
+						}
+					case "Size":
+						z.Chunks[za0001].Size, err = dc.ReadUint32()
+						if err != nil {
+							err = msgp.WrapError(err, "Chunks", za0001, "Size")
+							return
+						}
+					default:
+						err = dc.Skip()
+						if err != nil {
+							err = msgp.WrapError(err, "Chunks", za0001)
+							return
+						}
+					}
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *SeriesIndex) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "Key"
+	err = en.Append(0x83, 0xa3, 0x4b, 0x65, 0x79)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Key)
+	if err != nil {
+		err = msgp.WrapError(err, "Key")
+		return
+	}
+	// write "Offset"
+	err = en.Append(0xa6, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint64(z.Offset)
+	if err != nil {
+		err = msgp.WrapError(err, "Offset")
+		return
+	}
+	// write "Chunks"
+	err = en.Append(0xa6, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Chunks)))
+	if err != nil {
+		err = msgp.WrapError(err, "Chunks")
+		return
+	}
+	for za0001 := range z.Chunks {
+		// map header, size 3
+		// write "T0"
+		err = en.Append(0x83, 0xa2, 0x54, 0x30)
+		if err != nil {
+			return
+		}
+		err = en.WriteUint32(z.Chunks[za0001].T0)
+		if err != nil {
+			err = msgp.WrapError(err, "Chunks", za0001, "T0")
+			return
+		}
+		// write "Span"
+		err = en.Append(0xa4, 0x53, 0x70, 0x61, 0x6e)
+		if err != nil {
+			return
+		}
+		err = en.WriteUint32(z.Chunks[za0001].Span)
+		if err != nil {
+			err = msgp.WrapError(err, "Chunks", za0001, "Span")
+			return
+		}
+		// write "Size"
+		err = en.Append(0xa4, 0x53, 0x69, 0x7a, 0x65)
+		if err != nil {
+			return
+		}
+		err = en.WriteUint32(z.Chunks[za0001].Size)
+		if err != nil {
+			err = msgp.WrapError(err, "Chunks", za0001, "Size")
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *SeriesIndex) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "Key"
+	o = append(o, 0x83, 0xa3, 0x4b, 0x65, 0x79)
+	o = msgp.AppendString(o, z.Key)
+	// string "Offset"
+	o = append(o, 0xa6, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74)
+	o = msgp.AppendUint64(o, z.Offset)
+	// string "Chunks"
+	o = append(o, 0xa6, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Chunks)))
+	for za0001 := range z.Chunks {
+		// map header, size 3
+		// string "T0"
+		o = append(o, 0x83, 0xa2, 0x54, 0x30)
+		o = msgp.AppendUint32(o, z.Chunks[za0001].T0)
+		// string "Span"
+		o = append(o, 0xa4, 0x53, 0x70, 0x61, 0x6e)
+		o = msgp.AppendUint32(o, z.Chunks[za0001].Span)
+		// string "Size"
+		o = append(o, 0xa4, 0x53, 0x69, 0x7a, 0x65)
+		o = msgp.AppendUint32(o, z.Chunks[za0001].Size)
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *SeriesIndex) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Key":
+			z.Key, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Key")
+				return
+			}
+		case "Offset":
+			z.Offset, bts, err = msgp.ReadUint64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Offset")
+				return
+			}
+		case "Chunks":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Chunks")
+				return
+			}
+			if cap(z.Chunks) >= int(zb0002) {
+				z.Chunks = (z.Chunks)[:zb0002]
+			} else {
+				z.Chunks = make([]ChunkIndex, zb0002)
+			}
+			for za0001 := range z.Chunks {
+				var zb0003 uint32
+				zb0003, bts, err = msgp.ReadMapHeaderBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Chunks", za0001)
+					return
+				}
+				for zb0003 > 0 {
+					zb0003--
+					field, bts, err = msgp.ReadMapKeyZC(bts)
+					if err != nil {
+						err = msgp.WrapError(err, "Chunks", za0001)
+						return
+					}
+					switch msgp.UnsafeString(field) {
+					case "T0":
+						z.Chunks[za0001].T0, bts, err = msgp.ReadUint32Bytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Chunks", za0001, "T0")
+							return
+						}
+					case "Span":
+						z.Chunks[za0001].Span, bts, err = msgp.ReadUint32Bytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Chunks", za0001, "Span")
+							return
+						}
+					case "Size":
+						z.Chunks[za0001].Size, bts, err = msgp.ReadUint32Bytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Chunks", za0001, "Size")
+							return
+						}
+					default:
+						bts, err = msgp.Skip(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "Chunks", za0001)
+							return
+						}
+					}
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SeriesIndex) Msgsize() (s int) {
+	s = 1 + 4 + msgp.StringPrefixSize + len(z.Key) + 7 + msgp.Uint64Size + 7 + msgp.ArrayHeaderSize + (len(z.Chunks) * (14 + msgp.Uint32Size + msgp.Uint32Size + msgp.Uint32Size))
+	return
+}
@@ -0,0 +1,93 @@
+package tiered
+
+import (
+	"flag"
+	"time"
+
+	"github.com/grafana/globalconf"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	Enabled         bool
+	age             time.Duration
+	blockSpan       time.Duration
+	flushDelay      time.Duration
+	spoolDir        string
+	refreshInterval time.Duration
+	indexCacheSize  int
+
+	backend     string
+	fsDir       string
+	s3Endpoint  string
+	s3Bucket    string
+	s3Region    string
+	s3AccessKey string
+	s3SecretKey string
+	s3Timeout   time.Duration
+)
+
+func ConfigSetup() {
+	fs := flag.NewFlagSet("tiered-store", flag.ExitOnError)
+	fs.BoolVar(&Enabled, "enabled", false, "keep chunks in the backend store only for the given age, and move older chunks to object storage -- This setting is ignored and overridden (set to false) in query mode")
+	fs.DurationVar(&age, "age", 30*24*time.Hour, "age after which chunks are only kept in object storage. only archives with a larger ttl are moved to object storage")
+	fs.DurationVar(&blockSpan, "block-span", 24*time.Hour, "chunks are uploaded in blocks which cover this timespan (by chunk t0). must divide 28 days")
+	fs.DurationVar(&flushDelay, "flush-delay", time.Hour, "how long to wait after the end of a block's timespan before uploading it, to include chunks that are saved late")
+	fs.StringVar(&spoolDir, "spool-dir", "/var/lib/metrictank/tiered-store", "directory to store chunks in until their block is uploaded")
+	fs.DurationVar(&refreshInterval, "refresh-interval", 5*time.Minute, "interval at which to refresh the list of blocks in object storage, to see the blocks uploaded by other nodes and remove expired ones")
+	fs.IntVar(&indexCacheSize, "index-cache-size", 100, "number of block indexes to keep in memory")
+	fs.StringVar(&backend, "backend", "s3", "object storage to use: s3 (for any s3 compatible storage, including GCS) or fs (local or network filesystem)")
+	fs.StringVar(&fsDir, "fs-dir", "/var/lib/metrictank/objects", "directory to store the blocks in, for the fs backend")
+	fs.StringVar(&s3Endpoint, "s3-endpoint", "https://s3.amazonaws.com", "s3 endpoint. e.g. https://s3.eu-west-1.amazonaws.com or https://storage.googleapis.com")
+	fs.StringVar(&s3Bucket, "s3-bucket", "metrictank", "s3 bucket")
+	fs.StringVar(&s3Region, "s3-region", "us-east-1", "s3 region. use auto for GCS")
+	fs.StringVar(&s3AccessKey, "s3-access-key", "", "s3 access key (HMAC key for GCS)")
+	fs.StringVar(&s3SecretKey, "s3-secret-key", "", "s3 secret key (HMAC secret for GCS)")
+	fs.DurationVar(&s3Timeout, "s3-timeout", time.Minute, "timeout of s3 requests")
+	globalconf.Register("tiered-store", fs, flag.ExitOnError)
+}
+
+func ConfigProcess(maxChunkSpan uint32) {
+	if !Enabled {
+		return
+	}
+	if blockSpan < time.Second || blockSpan%time.Second != 0 || (28*24*time.Hour)%blockSpan != 0 {
+		log.Fatal("tiered-store: block-span must be a whole number of seconds that divides 28 days")
+	}
+	if flushDelay < 0 {
+		log.Fatal("tiered-store: flush-delay can't be negative")
+	}
+	// blocks must be uploaded before the chunks expire from the backend store
+	if age <= blockSpan+flushDelay+time.Duration(maxChunkSpan)*time.Second {
+		log.Fatal("tiered-store: age must be larger than block-span plus flush-delay plus the max chunkspan in storage-schemas")
+	}
+	if spoolDir == "" {
+		log.Fatal("tiered-store: spool-dir must be set")
+	}
+	if refreshInterval <= 0 {
+		log.Fatal("tiered-store: refresh-interval must be greater than 0")
+	}
+	if indexCacheSize < 1 {
+		log.Fatal("tiered-store: index-cache-size must be at least 1")
+	}
+	switch backend {
+	case "fs":
+		if fsDir == "" {
+			log.Fatal("tiered-store: fs-dir must be set")
+		}
+	case "s3":
+		if s3Endpoint == "" || s3Bucket == "" {
+			log.Fatal("tiered-store: s3-endpoint and s3-bucket must be set")
+		}
+	default:
+		log.Fatalf("tiered-store: invalid backend %q", backend)
+	}
+}
+
+// NewObjectStore returns the configured object store
+func NewObjectStore() (ObjectStore, error) {
+	if backend == "fs" {
+		return NewFSObjectStore(fsDir)
+	}
+	return NewS3ObjectStore(s3Endpoint, s3Bucket, s3Region, s3AccessKey, s3SecretKey, s3Timeout)
+}
@@ -0,0 +1,126 @@
+package tiered
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var errNotFound = errors.New("object not found")
+
+// ObjectStore is a minimal interface to an object storage, such as S3 or GCS.
+// object names use '/' as separator.
+type ObjectStore interface {
+	// Put stores the object with the given name, reading size bytes from r
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Get returns the length bytes of the object at the given offset. A negative length means until the end.
+	// It returns errNotFound if the object doesn't exist.
+	Get(ctx context.Context, name string, offset, length int64) ([]byte, error)
+	// List returns the names of all objects with the given prefix, sorted
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete deletes the object with the given name. Deleting an object that doesn't exist is not an error.
+	Delete(ctx context.Context, name string) error
+}
+
+// FSObjectStore is an ObjectStore backed by a local (or network) filesystem
+type FSObjectStore struct {
+	dir string
+}
+
+func NewFSObjectStore(dir string) (*FSObjectStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FSObjectStore{dir: dir}, nil
+}
+
+func (s *FSObjectStore) path(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+func (s *FSObjectStore) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	path := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// write to a temporary file first, so that readers never see partial objects
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && n != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (s *FSObjectStore) Get(ctx context.Context, name string, offset, length int64) ([]byte, error) {
+	f, err := os.Open(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return ioutil.ReadAll(f)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (s *FSObjectStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+func (s *FSObjectStore) Delete(ctx context.Context, name string) error {
+	err := os.Remove(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package tiered
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal in-process stand-in for S3, supporting the requests made by S3ObjectStore
+type fakeS3 struct {
+	sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	maxKeys int // max number of keys per list response
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") || r.Header.Get("x-amz-date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>missing signature</Message></Error>")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path != f.bucket && !strings.HasPrefix(path, f.bucket+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Error><Code>NoSuchBucket</Code><Message>no such bucket</Message></Error>")
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(path, f.bucket), "/")
+
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case r.Method == "GET" && name == "":
+		f.list(w, r)
+	case r.Method == "PUT":
+		data, _ := ioutil.ReadAll(r.Body)
+		f.objects[name] = data
+	case r.Method == "GET":
+		data, ok := f.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>no such key</Message></Error>")
+			return
+		}
+		rng := r.Header.Get("Range")
+		if rng == "" {
+			w.Write(data)
+			return
+		}
+		parts := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+		start, _ := strconv.Atoi(parts[0])
+		end := len(data) - 1
+		if parts[1] != "" {
+			end, _ = strconv.Atoi(parts[1])
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : end+1])
+	case r.Method == "DELETE":
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, q.Get("prefix")) && k > q.Get("continuation-token") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var res listBucketResult
+	if len(keys) > f.maxKeys {
+		keys = keys[:f.maxKeys]
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, k := range keys {
+		res.Contents = append(res.Contents, struct {
+			Key string `xml:"Key"`
+		}{k})
+	}
+	xml.NewEncoder(w).Encode(res)
+}
+
+func TestS3ObjectStore(t *testing.T) {
+	fake := &fakeS3{bucket: "metrics", objects: make(map[string][]byte), maxKeys: 2}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	s, err := NewS3ObjectStore(srv.URL, "metrics", "us-east-1", "key", "secret", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	names := []string{"blocks/1/a.data", "blocks/1/a.index", "blocks/2/b c.data", "other"}
+	for _, name := range names {
+		data := []byte("data of " + name)
+		if err := s.Put(ctx, name, bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Fatalf("put %s: %s", name, err)
+		}
+	}
+
+	got, err := s.List(ctx, blocksPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != strings.Join(names[:3], ",") {
+		t.Fatalf("expected %v, got %v", names[:3], got)
+	}
+
+	data, err := s.Get(ctx, "blocks/2/b c.data", 8, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "blocks" {
+		t.Fatalf("expected range to be %q, got %q", "blocks", data)
+	}
+	data, err = s.Get(ctx, "blocks/1/a.index", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data of blocks/1/a.index" {
+		t.Fatalf("unexpected object %q", data)
+	}
+
+	if err := s.Delete(ctx, "blocks/1/a.index"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "blocks/1/a.index"); err != nil {
+		t.Fatalf("deleting a missing object should not fail, got %s", err)
+	}
+	if _, err := s.Get(ctx, "blocks/1/a.index", 0, -1); err != errNotFound {
+		t.Fatalf("expected errNotFound, got %v", err)
+	}
+
+	s.secretKey = ""
+	s.accessKey = "wrong"
+	if _, err := s.List(ctx, ""); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Fatalf("expected access denied error, got %v", err)
+	}
+}
+
+func TestUriEncode(t *testing.T) {
+	cases := []struct {
+		in          string
+		encodeSlash bool
+		exp         string
+	}{
+		{"/bucket/blocks/1/a.data", false, "/bucket/blocks/1/a.data"},
+		{"/bucket/a b+c~d", false, "/bucket/a%20b%2Bc~d"},
+		{"blocks/", true, "blocks%2F"},
+	}
+	for _, c := range cases {
+		if got := uriEncode(c.in, c.encodeSlash); got != c.exp {
+			t.Errorf("uriEncode(%q, %t): expected %q, got %q", c.in, c.encodeSlash, c.exp, got)
+		}
+	}
+}
@@ -0,0 +1,601 @@
+// Package tiered provides an mdata.Store that keeps recent chunks in a backend store (the hot tier),
+// and older chunks in object storage (the cold tier).
+//
+// Chunks of archives with a ttl larger than the configured age are saved in the backend store
+// with the age as ttl, such that the backend store expires them after the age.
+// They are also spooled to local disk, grouped in blocks by ttl and a window of block-span.
+// Once a window has passed, its block is uploaded to object storage, where it is kept for the full ttl.
+// Searches get the chunks older than the age from object storage, and the others from the backend store.
+// Chunks saved before the tiered store was enabled are read from the backend store tables of the full ttl,
+// until they have expired from them.
+package tiered
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/mdata/chunk"
+	"github.com/grafana/metrictank/schema"
+	"github.com/grafana/metrictank/stats"
+	"github.com/grafana/metrictank/util"
+	opentracing "github.com/opentracing/opentracing-go"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// metric store.tiered.spooled_chunks is the number of chunks spooled to local disk, to be uploaded to object storage
+	spooledChunks = stats.NewCounter32("store.tiered.spooled_chunks")
+	// metric store.tiered.spool_errors is the number of chunks that could not be spooled. they will be missing from object storage
+	spoolErrors = stats.NewCounter32("store.tiered.spool_errors")
+	// metric store.tiered.uploaded_blocks is the number of blocks uploaded to object storage
+	uploadedBlocks = stats.NewCounter32("store.tiered.uploaded_blocks")
+	// metric store.tiered.upload_errors is the number of failed block uploads. they are retried
+	uploadErrors = stats.NewCounter32("store.tiered.upload_errors")
+	// metric store.tiered.pending_blocks is the number of spooled blocks waiting to be uploaded
+	pendingBlocks = stats.NewGauge32("store.tiered.pending_blocks")
+	// metric store.tiered.blocks is the number of blocks in object storage
+	numBlocks = stats.NewGauge32("store.tiered.blocks")
+	// metric store.tiered.deleted_blocks is the number of expired blocks deleted from object storage
+	deletedBlocks = stats.NewCounter32("store.tiered.deleted_blocks")
+	// metric store.tiered.cold_reads is the number of searches that needed chunks from object storage
+	coldReads = stats.NewCounter32("store.tiered.cold_reads")
+	// metric store.tiered.cold_read_errors is the number of searches that failed to get chunks from object storage
+	coldReadErrors = stats.NewCounter32("store.tiered.cold_read_errors")
+	// metric store.tiered.cold_read is the duration of getting chunks from object storage
+	coldReadDuration = stats.NewLatencyHistogram15s32("store.tiered.cold_read")
+)
+
+// how often to check for blocks to upload
+var flushInterval = time.Minute
+
+// enabledAtName is the object that records when the tiered store was first enabled
+const enabledAtName = "enabled-at"
+
+// BackendTTLs returns the ttls the backend store needs to support, given the ttls of the storage schemas:
+// the reduced ttls chunks are saved with, and the full ttls to read the chunks saved before the tiered store was enabled
+func BackendTTLs(ttls []uint32) []uint32 {
+	seen := make(map[uint32]struct{})
+	var out []uint32
+	for _, ttl := range ttls {
+		for _, t := range []uint32{hotTTL(ttl), ttl} {
+			if _, ok := seen[t]; !ok {
+				seen[t] = struct{}{}
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+func hotTTL(ttl uint32) uint32 {
+	if a := uint32(age.Seconds()); ttl > a {
+		return a
+	}
+	return ttl
+}
+
+type spoolKey struct {
+	ttl    uint32
+	window uint32
+}
+
+type spoolFile struct {
+	path string
+	f    *os.File
+}
+
+// Store is an mdata.Store that moves chunks older than the age from the hot store to object storage
+type Store struct {
+	hot          mdata.Store
+	objects      ObjectStore
+	id           string // identifies the blocks uploaded by this node
+	age          uint32
+	blockSpan    uint32
+	flushDelay   uint32
+	maxChunkSpan uint32
+	enabledAt    uint32 // chunks saved before then are in the backend store tables of the full ttl
+
+	sync.Mutex
+	spools  map[spoolKey]*spoolFile
+	pending []string // closed spool files, to be uploaded. only accessed by the run loop after New()
+
+	blocksLock sync.RWMutex
+	blocks     map[uint32][]blockMeta // by ttl, sorted by window
+
+	indexes *indexCache
+
+	shutdown chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New creates a tiered store on top of the given hot store.
+// instance must be unique within the cluster. maxChunkSpan is the largest chunkspan in use.
+func New(hot mdata.Store, objects ObjectStore, instance string, maxChunkSpan uint32) (*Store, error) {
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		hot:          hot,
+		objects:      objects,
+		id:           instance,
+		age:          uint32(age.Seconds()),
+		blockSpan:    uint32(blockSpan.Seconds()),
+		flushDelay:   uint32(flushDelay.Seconds()),
+		maxChunkSpan: maxChunkSpan,
+		spools:       make(map[spoolKey]*spoolFile),
+		blocks:       make(map[uint32][]blockMeta),
+		indexes:      newIndexCache(indexCacheSize),
+		shutdown:     make(chan struct{}),
+	}
+
+	// spool files left by a previous run are uploaded as soon as their window has passed
+	files, err := ioutil.ReadDir(spoolDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		path := filepath.Join(spoolDir, f.Name())
+		if strings.HasPrefix(f.Name(), ".block-") {
+			os.Remove(path)
+			continue
+		}
+		if _, _, ok := parseSpoolName(f.Name()); ok {
+			s.pending = append(s.pending, path)
+		}
+	}
+	pendingBlocks.Set(len(s.pending))
+
+	s.enabledAt, err = loadEnabledAt(context.Background(), objects, uint32(time.Now().Unix()))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.refresh(time.Now()); err != nil {
+		log.Errorf("tiered-store: failed to list blocks in object storage: %s", err)
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// loadEnabledAt returns when the tiered store was first enabled, as recorded in object storage.
+// If it isn't recorded yet, it records now.
+func loadEnabledAt(ctx context.Context, objects ObjectStore, now uint32) (uint32, error) {
+	data, err := objects.Get(ctx, enabledAtName, 0, -1)
+	if err == nil {
+		ts, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("tiered-store: invalid %s object: %s", enabledAtName, err)
+		}
+		return uint32(ts), nil
+	}
+	if err != errNotFound {
+		return 0, fmt.Errorf("tiered-store: failed to read %s object: %s", enabledAtName, err)
+	}
+	val := strconv.FormatUint(uint64(now), 10)
+	if err := objects.Put(ctx, enabledAtName, strings.NewReader(val), int64(len(val))); err != nil {
+		return 0, fmt.Errorf("tiered-store: failed to write %s object: %s", enabledAtName, err)
+	}
+	log.Infof("tiered-store: enabled at %d. chunks saved before then are read from the backend store until they expire", now)
+	return now, nil
+}
+
+func spoolName(k spoolKey, seq int64) string {
+	return fmt.Sprintf("%d_%d_%d.spool", k.ttl, k.window, seq)
+}
+
+func parseSpoolName(name string) (spoolKey, string, bool) {
+	if !strings.HasSuffix(name, ".spool") {
+		return spoolKey{}, "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(name, ".spool"), "_")
+	if len(parts) != 3 {
+		return spoolKey{}, "", false
+	}
+	ttl, err1 := strconv.ParseUint(parts[0], 10, 32)
+	window, err2 := strconv.ParseUint(parts[1], 10, 32)
+	if err1 != nil || err2 != nil {
+		return spoolKey{}, "", false
+	}
+	return spoolKey{uint32(ttl), uint32(window)}, parts[2], true
+}
+
+// Add saves the chunk in the hot store, and if it is for an archive with a ttl larger than the age,
+// spools it to be uploaded to object storage.
+func (s *Store) Add(cwr *mdata.ChunkWriteRequest) {
+	if cwr.TTL > s.age {
+		if err := s.spool(cwr); err != nil {
+			spoolErrors.Inc()
+			log.Errorf("tiered-store: failed to spool chunk %s:%d: %s", cwr.Key, cwr.T0, err)
+		}
+	}
+	hot := *cwr
+	hot.TTL = hotTTL(cwr.TTL)
+	s.hot.Add(&hot)
+}
+
+func (s *Store) spool(cwr *mdata.ChunkWriteRequest) error {
+	k := spoolKey{cwr.TTL, cwr.T0 - cwr.T0%s.blockSpan}
+	rec := appendSpoolRecord(nil, cwr.Key.String(), cwr.T0, cwr.Data)
+
+	s.Lock()
+	defer s.Unlock()
+	sf, ok := s.spools[k]
+	if !ok {
+		path := filepath.Join(spoolDir, spoolName(k, time.Now().UnixNano()))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		sf = &spoolFile{path, f}
+		s.spools[k] = sf
+	}
+	if _, err := sf.f.Write(rec); err != nil {
+		return err
+	}
+	spooledChunks.Inc()
+	return nil
+}
+
+func (s *Store) run() {
+	defer s.wg.Done()
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+	refreshTicker := time.NewTicker(refreshInterval)
+	defer refreshTicker.Stop()
+	for {
+		select {
+		case <-s.shutdown:
+			return
+		case now := <-flushTicker.C:
+			s.flush(now)
+		case now := <-refreshTicker.C:
+			if err := s.refresh(now); err != nil {
+				log.Errorf("tiered-store: failed to refresh blocks from object storage: %s", err)
+			}
+		}
+	}
+}
+
+// flush uploads the blocks of which the window (plus flush delay) has passed
+func (s *Store) flush(now time.Time) {
+	ts := uint32(now.Unix())
+	s.Lock()
+	for k, sf := range s.spools {
+		if k.window+s.blockSpan+s.flushDelay <= ts {
+			sf.f.Sync()
+			sf.f.Close()
+			s.pending = append(s.pending, sf.path)
+			delete(s.spools, k)
+		}
+	}
+	s.Unlock()
+
+	var remaining []string
+	for _, path := range s.pending {
+		select {
+		case <-s.shutdown:
+			remaining = append(remaining, path)
+			continue
+		default:
+		}
+		k, seq, _ := parseSpoolName(filepath.Base(path))
+		if k.window+s.blockSpan+s.flushDelay > ts {
+			// spool file of a previous run, for a window that hasn't passed yet
+			remaining = append(remaining, path)
+			continue
+		}
+		name := blockName(k.ttl, k.window, s.id+"-"+seq)
+		series, err := uploadBlock(context.Background(), s.objects, path, name)
+		if err != nil {
+			uploadErrors.Inc()
+			log.Errorf("tiered-store: failed to upload block %s: %s. will retry", name, err)
+			remaining = append(remaining, path)
+			continue
+		}
+		os.Remove(path)
+		if series > 0 {
+			uploadedBlocks.Inc()
+			s.addBlock(blockMeta{name: name, ttl: k.ttl, window: k.window})
+			log.Infof("tiered-store: uploaded block %s with %d series", name, series)
+		}
+	}
+	s.pending = remaining
+	pendingBlocks.Set(len(s.pending))
+}
+
+func (s *Store) addBlock(b blockMeta) {
+	s.blocksLock.Lock()
+	defer s.blocksLock.Unlock()
+	for _, existing := range s.blocks[b.ttl] {
+		if existing.name == b.name {
+			return
+		}
+	}
+	blocks := append(s.blocks[b.ttl], b)
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].window < blocks[j].window })
+	s.blocks[b.ttl] = blocks
+}
+
+// expired returns whether all chunks in the block have expired
+func (s *Store) expired(b blockMeta, now uint32) bool {
+	return int64(b.window)+int64(s.blockSpan)+int64(s.maxChunkSpan)+int64(b.ttl) < int64(now)
+}
+
+// refresh lists the blocks in object storage, and deletes the expired ones
+func (s *Store) refresh(now time.Time) error {
+	ctx := context.Background()
+	names, err := s.objects.List(ctx, blocksPrefix)
+	if err != nil {
+		return err
+	}
+	ts := uint32(now.Unix())
+	blocks := make(map[uint32][]blockMeta)
+	var count int
+	for _, name := range names {
+		b, ok := parseBlockIndexName(name)
+		if !ok {
+			continue
+		}
+		if s.expired(b, ts) {
+			// delete the index first, so that the block can't be seen without its data
+			if err := s.objects.Delete(ctx, b.name+".index"); err != nil {
+				log.Warnf("tiered-store: failed to delete expired block %s: %s", b.name, err)
+				continue
+			}
+			if err := s.objects.Delete(ctx, b.name+".data"); err != nil {
+				log.Warnf("tiered-store: failed to delete data of expired block %s: %s", b.name, err)
+			}
+			s.indexes.remove(b.name)
+			deletedBlocks.Inc()
+			continue
+		}
+		blocks[b.ttl] = append(blocks[b.ttl], b)
+		count++
+	}
+	for _, list := range blocks {
+		sort.Slice(list, func(i, j int) bool { return list[i].window < list[j].window })
+	}
+	s.blocksLock.Lock()
+	s.blocks = blocks
+	s.blocksLock.Unlock()
+	numBlocks.Set(count)
+	return nil
+}
+
+// Search returns the chunks of the given archive from the hot store and/or object storage
+// start inclusive, end exclusive
+func (s *Store) Search(ctx context.Context, key schema.AMKey, ttl, start, end uint32) ([]chunk.IterGen, error) {
+	if ttl <= s.age {
+		return s.hot.Search(ctx, key, ttl, start, end)
+	}
+	now := uint32(time.Now().Unix())
+	// chunks that end before hotStart have expired from the hot store
+	hotStart := now - s.age
+	var tiers [][]chunk.IterGen // in order of preference, for chunks that are in multiple tiers
+	if end > hotStart {
+		hot, err := s.hot.Search(ctx, key, hotTTL(ttl), util.Max(start, hotStart), end)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, hot)
+	}
+	if s.legacy(ttl, start, now) {
+		legacy, err := s.hot.Search(ctx, key, ttl, start, util.Min(end, s.enabledAt))
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, legacy)
+	}
+	if start < hotStart {
+		cold, err := s.searchCold(ctx, key, ttl, start, end)
+		if err != nil {
+			coldReadErrors.Inc()
+			return nil, err
+		}
+		tiers = append(tiers, cold)
+	}
+	if len(tiers) == 1 {
+		return tiers[0], nil
+	}
+	return mergeIterGens(tiers...), nil
+}
+
+// legacy returns whether a search from start needs the chunks that were saved with the given (full) ttl,
+// before the tiered store was enabled, and that may not have expired from the backend store yet.
+func (s *Store) legacy(ttl, start, now uint32) bool {
+	return start < s.enabledAt && int64(now) < int64(s.enabledAt)+int64(ttl)+int64(s.maxChunkSpan)
+}
+
+// mergeIterGens merges the chunks from multiple tiers. chunks that are in multiple tiers are taken from the first one.
+func mergeIterGens(tiers ...[]chunk.IterGen) []chunk.IterGen {
+	seen := make(map[uint32]struct{})
+	var out []chunk.IterGen
+	for _, tier := range tiers {
+		for _, ig := range tier {
+			if _, ok := seen[ig.T0]; !ok {
+				seen[ig.T0] = struct{}{}
+				out = append(out, ig)
+			}
+		}
+	}
+	sort.Sort(chunk.IterGensAsc(out))
+	return out
+}
+
+// searchCold returns the chunks of the given archive from object storage
+func (s *Store) searchCold(ctx context.Context, key schema.AMKey, ttl, start, end uint32) ([]chunk.IterGen, error) {
+	pre := time.Now()
+	coldReads.Inc()
+
+	var blocks []blockMeta
+	s.blocksLock.RLock()
+	for _, b := range s.blocks[ttl] {
+		// a block has chunks with a t0 in its window, which may extend up to maxChunkSpan beyond it
+		if b.window < end && b.window+s.blockSpan+s.maxChunkSpan > start {
+			blocks = append(blocks, b)
+		}
+	}
+	s.blocksLock.RUnlock()
+
+	keyStr := key.String()
+	intervalHint := key.Archive.Span()
+	seen := make(map[uint32]struct{})
+	var itgens []chunk.IterGen
+	for _, b := range blocks {
+		idx, err := s.index(ctx, b)
+		if err == errNotFound {
+			// deleted since we listed the blocks
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		series, ok := idx.find(keyStr)
+		if !ok {
+			continue
+		}
+
+		// chunks are sorted by t0, so the ones we need are contiguous
+		first, last := -1, -1
+		var from, to, offset uint64
+		for i, c := range series.Chunks {
+			if c.T0 < end && (c.Span == 0 || c.T0+c.Span > start) {
+				if first == -1 {
+					first = i
+					from = offset
+				}
+				last = i
+				to = offset + uint64(c.Size)
+			}
+			offset += uint64(c.Size)
+		}
+		if first == -1 {
+			continue
+		}
+		data, err := s.objects.Get(ctx, b.name+".data", int64(series.Offset+from), int64(to-from))
+		if err != nil {
+			return nil, fmt.Errorf("tiered-store: failed to read block %s: %s", b.name, err)
+		}
+		var pos uint32
+		for _, c := range series.Chunks[first : last+1] {
+			buf := data[pos : pos+c.Size]
+			pos += c.Size
+			if _, ok := seen[c.T0]; ok {
+				// saved again, and uploaded as part of another block
+				continue
+			}
+			itgen, err := chunk.NewIterGen(c.T0, intervalHint, buf)
+			if err != nil {
+				return nil, fmt.Errorf("tiered-store: invalid chunk %s:%d in block %s: %s", keyStr, c.T0, b.name, err)
+			}
+			seen[c.T0] = struct{}{}
+			itgens = append(itgens, itgen)
+		}
+	}
+	sort.Sort(chunk.IterGensAsc(itgens))
+	coldReadDuration.Value(time.Since(pre))
+	return itgens, nil
+}
+
+// index returns the index of the given block
+func (s *Store) index(ctx context.Context, b blockMeta) (*BlockIndex, error) {
+	if idx, ok := s.indexes.get(b.name); ok {
+		return idx, nil
+	}
+	data, err := s.objects.Get(ctx, b.name+".index", 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	idx := &BlockIndex{}
+	if _, err := idx.UnmarshalMsg(data); err != nil {
+		return nil, fmt.Errorf("tiered-store: invalid index of block %s: %s", b.name, err)
+	}
+	s.indexes.add(b.name, idx)
+	return idx, nil
+}
+
+func (s *Store) SetTracer(t opentracing.Tracer) {
+	s.hot.SetTracer(t)
+}
+
+// Stop stops the store. Spooled chunks remain on disk, to be uploaded after restart.
+func (s *Store) Stop() {
+	close(s.shutdown)
+	s.wg.Wait()
+	s.Lock()
+	for k, sf := range s.spools {
+		sf.f.Sync()
+		sf.f.Close()
+		delete(s.spools, k)
+	}
+	s.Unlock()
+	s.hot.Stop()
+}
+
+// indexCache keeps the most recently used block indexes in memory
+type indexCache struct {
+	sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type indexCacheEntry struct {
+	name string
+	idx  *BlockIndex
+}
+
+func newIndexCache(size int) *indexCache {
+	return &indexCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *indexCache) get(name string) (*BlockIndex, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*indexCacheEntry).idx, true
+}
+
+func (c *indexCache) add(name string, idx *BlockIndex) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[name] = c.lru.PushFront(&indexCacheEntry{name, idx})
+	for c.lru.Len() > c.size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*indexCacheEntry).name)
+	}
+}
+
+func (c *indexCache) remove(name string) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.lru.Remove(e)
+		delete(c.entries, name)
+	}
+}
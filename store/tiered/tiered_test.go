@@ -0,0 +1,332 @@
+package tiered
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/metrictank/mdata"
+	"github.com/grafana/metrictank/mdata/chunk"
+	"github.com/grafana/metrictank/schema"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+const day = 24 * 3600
+
+func setupConfig(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "tiered-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	age = 10 * 24 * time.Hour
+	blockSpan = 24 * time.Hour
+	flushDelay = time.Hour
+	spoolDir = filepath.Join(dir, "spool")
+	fsDir = filepath.Join(dir, "objects")
+	refreshInterval = time.Hour
+	indexCacheSize = 2
+	return func() { os.RemoveAll(dir) }
+}
+
+func testKey(t *testing.T, id string) schema.AMKey {
+	mkey, err := schema.MKeyFromString(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema.AMKey{MKey: mkey}
+}
+
+// newChunk returns a chunk of an hour of points every 10s, with values starting at t0
+func newChunk(t0 uint32) []byte {
+	c := chunk.New(t0)
+	for ts := t0; ts < t0+3600; ts += 10 {
+		c.Push(ts, float64(ts))
+	}
+	c.Finish()
+	return c.Encode(3600)
+}
+
+func addChunk(s mdata.Store, key schema.AMKey, ttl, t0 uint32) {
+	cwr := mdata.NewChunkWriteRequest(nil, key, ttl, t0, newChunk(t0), time.Now())
+	s.Add(&cwr)
+}
+
+// checkChunks asserts that the itgens are the chunks with the given t0's, with the expected points
+func checkChunks(t *testing.T, itgens []chunk.IterGen, expT0s []uint32) {
+	t.Helper()
+	if len(itgens) != len(expT0s) {
+		t.Fatalf("expected %d chunks, got %d", len(expT0s), len(itgens))
+	}
+	for i, ig := range itgens {
+		if ig.T0 != expT0s[i] {
+			t.Fatalf("chunk %d: expected t0 %d, got %d", i, expT0s[i], ig.T0)
+		}
+		it, err := ig.Get()
+		if err != nil {
+			t.Fatalf("chunk %d: %s", i, err)
+		}
+		var count int
+		for it.Next() {
+			ts, val := it.Values()
+			if float64(ts) != val || ts < ig.T0 || ts >= ig.T0+3600 {
+				t.Fatalf("chunk %d: unexpected point %d %f", i, ts, val)
+			}
+			count++
+		}
+		if count != 360 {
+			t.Fatalf("chunk %d: expected 360 points, got %d", i, count)
+		}
+	}
+}
+
+func TestBackendTTLs(t *testing.T) {
+	defer setupConfig(t)()
+	got := BackendTTLs([]uint32{3600, 10 * day, 30 * day, 365 * day})
+	exp := []uint32{3600, 10 * day, 30 * day, 365 * day}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+// ttlStore is a backend store with a table per ttl
+type ttlStore struct {
+	tables map[uint32]*mdata.MockStore
+}
+
+func newTTLStore() *ttlStore {
+	return &ttlStore{tables: make(map[uint32]*mdata.MockStore)}
+}
+
+func (s *ttlStore) table(ttl uint32) *mdata.MockStore {
+	if _, ok := s.tables[ttl]; !ok {
+		s.tables[ttl] = mdata.NewMockStore()
+	}
+	return s.tables[ttl]
+}
+
+func (s *ttlStore) Add(cwr *mdata.ChunkWriteRequest) {
+	s.table(cwr.TTL).Add(cwr)
+}
+
+func (s *ttlStore) Search(ctx context.Context, key schema.AMKey, ttl, start, end uint32) ([]chunk.IterGen, error) {
+	return s.table(ttl).Search(ctx, key, ttl, start, end)
+}
+
+func (s *ttlStore) Stop() {}
+
+func (s *ttlStore) SetTracer(t opentracing.Tracer) {}
+
+// chunks saved before the tiered store was enabled are read from the table of the full ttl, until they expire
+func TestTieredStoreLegacy(t *testing.T) {
+	defer setupConfig(t)()
+	objects, err := NewFSObjectStore(fsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl := uint32(100 * day)
+	now := uint32(time.Now().Unix())
+	old := now - now%3600 - 20*day
+	recent := now - now%3600 - 3600
+	key := testKey(t, "1.01234567890123456789012345678901")
+
+	hot := newTTLStore()
+	addChunk(hot, key, ttl, old)
+	addChunk(hot, key, ttl, recent)
+
+	s, err := New(hot, objects, "node1", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	if s.enabledAt < now {
+		t.Fatalf("expected the tiered store to be enabled now, got %d", s.enabledAt)
+	}
+	addChunk(s, key, ttl, recent+3600)
+
+	itgens, err := s.Search(context.Background(), key, ttl, old, now+3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChunks(t, itgens, []uint32{old, recent, recent + 3600})
+
+	// other nodes, and restarts, use the time it was first enabled
+	enabledAt, err := loadEnabledAt(context.Background(), objects, now+day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabledAt != s.enabledAt {
+		t.Fatalf("expected enabled at %d, got %d", s.enabledAt, enabledAt)
+	}
+
+	// once the chunks have expired from the table of the full ttl, it is not read anymore
+	s.enabledAt = now - ttl - 3600 - 1
+	if s.legacy(ttl, 0, now) {
+		t.Fatalf("expected no search of the table of the full ttl after all its chunks expired")
+	}
+	itgens, err = s.Search(context.Background(), key, ttl, old, now+3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChunks(t, itgens, []uint32{recent + 3600})
+}
+
+func TestTieredStore(t *testing.T) {
+	defer setupConfig(t)()
+	objects, err := NewFSObjectStore(fsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot := mdata.NewMockStore()
+	s, err := New(hot, objects, "node1", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { s.Stop() }()
+
+	ttl := uint32(100 * day)
+	now := uint32(time.Now().Unix())
+	oldWindow := now - now%day - 20*day
+	recent := now - now%3600 - 3600
+	key1 := testKey(t, "1.01234567890123456789012345678901")
+	key2 := testKey(t, "1.11234567890123456789012345678901")
+	short := testKey(t, "1.21234567890123456789012345678901")
+
+	var oldT0s []uint32
+	for i := uint32(0); i < 4; i++ {
+		oldT0s = append(oldT0s, oldWindow+i*3600)
+		addChunk(s, key1, ttl, oldWindow+i*3600)
+	}
+	// saved again, e.g. by a new primary
+	addChunk(s, key1, ttl, oldWindow)
+	addChunk(s, key2, ttl, oldWindow+day)
+	addChunk(s, short, 10*day, oldWindow)
+	if hot.Items() != 7 {
+		t.Fatalf("expected all chunks to be saved in the hot store, got %d", hot.Items())
+	}
+	addChunk(s, key1, ttl, recent)
+
+	// the chunks of the old windows have expired from the hot store
+	hot.Reset()
+	addChunk(hot, key1, ttl, recent)
+
+	// just before the current window has passed
+	recentWindow := recent - recent%day
+	s.flush(time.Unix(int64(recentWindow+day-1), 0))
+	names, err := objects.List(context.Background(), blocksPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 4 {
+		t.Fatalf("expected 2 blocks of 2 objects each, got %v", names)
+	}
+	spools, _ := ioutil.ReadDir(spoolDir)
+	if len(spools) != 1 {
+		t.Fatalf("expected only the spool of the current window to remain, got %d files", len(spools))
+	}
+
+	// hot and cold
+	itgens, err := s.Search(context.Background(), key1, ttl, oldWindow, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChunks(t, itgens, append(oldT0s, recent))
+
+	// cold only, within a block
+	itgens, err = s.Search(context.Background(), key1, ttl, oldWindow+3600, oldWindow+3*3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChunks(t, itgens, oldT0s[1:3])
+
+	// series that isn't in the block of the window
+	itgens, err = s.Search(context.Background(), key2, ttl, oldWindow, oldWindow+day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChunks(t, itgens, nil)
+
+	// archives with a ttl smaller than the age are not in object storage
+	itgens, err = s.Search(context.Background(), short, 10*day, oldWindow, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChunks(t, itgens, nil)
+
+	// after a restart, the blocks are listed from object storage and the spool is picked up again
+	s.Stop()
+	s, err = New(hot, objects, "node1", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.pending) != 1 {
+		t.Fatalf("expected the spool file to be pending, got %v", s.pending)
+	}
+	itgens, err = s.Search(context.Background(), key2, ttl, oldWindow, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChunks(t, itgens, []uint32{oldWindow + day})
+
+	// the recent window is uploaded once it has passed
+	s.flush(time.Unix(int64(recentWindow+day+3600), 0))
+	if len(s.pending) != 0 {
+		t.Fatalf("expected no pending spool files, got %v", s.pending)
+	}
+
+	// blocks are deleted once all their chunks have expired
+	if err := s.refresh(time.Unix(int64(oldWindow+ttl+day+3600+1), 0)); err != nil {
+		t.Fatal(err)
+	}
+	names, _ = objects.List(context.Background(), blocksPrefix)
+	if len(names) != 4 {
+		t.Fatalf("expected the 2 blocks of the later windows to remain, got %v", names)
+	}
+	if len(s.blocks[ttl]) != 2 || s.blocks[ttl][0].window != oldWindow+day {
+		t.Fatalf("unexpected blocks %v", s.blocks)
+	}
+}
+
+func TestReadSpoolTornRecord(t *testing.T) {
+	f, err := ioutil.TempFile("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var buf []byte
+	buf = appendSpoolRecord(buf, "key1", 1000, []byte("abc"))
+	buf = appendSpoolRecord(buf, "key2", 2000, []byte("defg"))
+	full := len(buf)
+	buf = appendSpoolRecord(buf, "key3", 3000, []byte("hij"))
+	// a crash while writing the last record
+	if _, err := f.Write(buf[:len(buf)-2]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks, err := readSpool(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+	data := make([]byte, chunks[1].size)
+	if _, err := f.ReadAt(data, chunks[1].offset); err != nil {
+		t.Fatal(err)
+	}
+	if chunks[1].key != "key2" || chunks[1].t0 != 2000 || string(data) != "defg" {
+		t.Fatalf("unexpected chunk %+v with data %q", chunks[1], data)
+	}
+	if chunks[1].offset+int64(chunks[1].size)+4 != int64(full) {
+		t.Fatalf("unexpected offset %d", chunks[1].offset)
+	}
+}